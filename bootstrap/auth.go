@@ -0,0 +1,267 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The keys are fetched again after this interval
+	jwksRefreshInterval = 10 * time.Minute
+	// Minimum interval between fetches when a token is signed with an unknown key
+	jwksMinRefreshInterval = 30 * time.Second
+)
+
+// Methods of the services registered by the mock server itself, which never require authentication
+var grpcAuthExcludedPrefixes = []string{"/grpc.health.v1.", "/grpc.reflection."}
+
+// GRPCAuthConfig simulates the authentication and authorization of the gRPC calls so that the stubs don't need to
+// handle them. The calls without a valid bearer token in the authorization metadata fail with UNAUTHENTICATED and the
+// ones not allowed by the rules with PERMISSION_DENIED.
+type GRPCAuthConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// TokenPatterns are regular expressions of the tokens accepted, e.g. ^test-.*
+	TokenPatterns []string `yaml:"tokenPatterns"`
+	// JWKSURL is the URL of the JSON Web Key Set used to verify the JWTs accepted
+	JWKSURL string `yaml:"jwksURL"`
+	// Rules restrict the methods to the tokens with some scopes or claims
+	Rules []GRPCAuthRule `yaml:"rules"`
+}
+
+// GRPCAuthRule allows the calls to the methods only with the tokens that match the patterns or, for JWTs, have all the
+// scopes and claims given
+type GRPCAuthRule struct {
+	// Methods are full methods (/package.Service/Method) or all the methods of a service (/package.Service/*)
+	Methods []string `yaml:"methods"`
+	// Scopes required in the scope (space separated) or scp claims
+	Scopes []string `yaml:"scopes"`
+	// Claims required with the values given, matched as the claims of the stubs (see stub.ClaimsMatcher)
+	Claims map[string]string `yaml:"claims"`
+	// TokenPatterns are regular expressions of the tokens allowed
+	TokenPatterns []string `yaml:"tokenPatterns"`
+}
+
+// grpcAuth checks the tokens of the gRPC calls as configured
+type grpcAuth struct {
+	tokenPatterns []*regexp.Regexp
+	jwks          *jwksCache
+	rules         []grpcAuthRule
+}
+
+type grpcAuthRule struct {
+	GRPCAuthRule
+	tokenPatterns []*regexp.Regexp
+}
+
+func newGRPCAuth(config GRPCAuthConfig) (*grpcAuth, error) {
+	if len(config.TokenPatterns) == 0 && config.JWKSURL == "" {
+		return nil, fmt.Errorf("the gRPC authentication requires token patterns or a JWKS URL")
+	}
+	auth := new(grpcAuth)
+	var err error
+	if auth.tokenPatterns, err = compilePatterns(config.TokenPatterns); err != nil {
+		return nil, err
+	}
+	if config.JWKSURL != "" {
+		auth.jwks = &jwksCache{url: config.JWKSURL, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	for _, rule := range config.Rules {
+		patterns, err := compilePatterns(rule.TokenPatterns)
+		if err != nil {
+			return nil, err
+		}
+		auth.rules = append(auth.rules, grpcAuthRule{GRPCAuthRule: rule, tokenPatterns: patterns})
+	}
+	return auth, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token pattern %s: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// check returns the error the call fails with, if any
+func (a *grpcAuth) check(ctx context.Context, fullMethod string) error {
+	for _, prefix := range grpcAuthExcludedPrefixes {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return nil
+		}
+	}
+	token := bearerToken(ctx)
+	if token == "" {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	jwt, _ := util.ParseJWT(token)
+	if !matchesAnyPattern(a.tokenPatterns, token) {
+		if err := a.verifyJWT(jwt); err != nil {
+			return status.Errorf(codes.Unauthenticated, "invalid token: %s", err.Error())
+		}
+	}
+	for _, rule := range a.rules {
+		if methodMatches(rule.Methods, fullMethod) && !rule.allows(token, jwt) {
+			return status.Errorf(codes.PermissionDenied, "the token is not allowed to call %s", fullMethod)
+		}
+	}
+	return nil
+}
+
+func (a *grpcAuth) verifyJWT(jwt *util.JWT) error {
+	if jwt == nil || a.jwks == nil {
+		return fmt.Errorf("the token is not accepted")
+	}
+	kid, _ := jwt.Header["kid"].(string)
+	keys, err := a.jwks.get(kid)
+	if err != nil {
+		return err
+	}
+	if err := jwt.Verify(keys); err != nil {
+		return err
+	}
+	return jwt.ValidateTime(time.Now())
+}
+
+func (r grpcAuthRule) allows(token string, jwt *util.JWT) bool {
+	if matchesAnyPattern(r.tokenPatterns, token) {
+		return true
+	}
+	if jwt == nil || (len(r.Scopes) == 0 && len(r.Claims) == 0) {
+		return false
+	}
+	scopes := make(map[string]bool, 0)
+	for _, scope := range jwtScopes(jwt) {
+		scopes[scope] = true
+	}
+	for _, scope := range r.Scopes {
+		if !scopes[scope] {
+			return false
+		}
+	}
+	return stub.ClaimsMatcher(r.Claims).MatchJWT(jwt)
+}
+
+// jwtScopes returns the scopes in the scope claim (space separated) or in the scp claim (a list or space separated)
+func jwtScopes(jwt *util.JWT) []string {
+	scopes := make([]string, 0)
+	for _, name := range []string{"scope", "scp"} {
+		switch claim := jwt.Claims[name].(type) {
+		case string:
+			scopes = append(scopes, strings.Fields(claim)...)
+		case []interface{}:
+			for _, scope := range claim {
+				scopes = append(scopes, fmt.Sprint(scope))
+			}
+		}
+	}
+	return scopes
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			return strings.TrimSpace(value[len(bearerPrefix):])
+		}
+	}
+	return ""
+}
+
+func matchesAnyPattern(patterns []*regexp.Regexp, token string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(token) {
+			return true
+		}
+	}
+	return false
+}
+
+// methodMatches checks if the method is one of the full methods (/package.Service/Method) or services
+// (/package.Service/*) given
+func methodMatches(methods []string, fullMethod string) bool {
+	for _, method := range methods {
+		if method == fullMethod || (strings.HasSuffix(method, "/*") && strings.HasPrefix(fullMethod, strings.TrimSuffix(method, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *grpcAuth) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := a.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *grpcAuth) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// jwksCache fetches the keys from the JWKS URL when they are first needed and refreshes them periodically or when
+// a token is signed with an unknown key
+type jwksCache struct {
+	url       string
+	client    *http.Client
+	mutex     sync.Mutex
+	keys      *util.JWKS
+	fetchedAt time.Time
+}
+
+func (c *jwksCache) get(kid string) (*util.JWKS, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	age := time.Since(c.fetchedAt)
+	if c.keys != nil && age < jwksRefreshInterval && (c.keys.HasKey(kid) || age < jwksMinRefreshInterval) {
+		return c.keys, nil
+	}
+	keys, err := c.fetch()
+	if err != nil {
+		if c.keys == nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{"Error": err.Error()}).Warnf("Failed to refresh the JWKS from %s", c.url)
+		return c.keys, nil
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return keys, nil
+}
+
+func (c *jwksCache) fetch() (*util.JWKS, error) {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch the JWKS: status %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the JWKS: %w", err)
+	}
+	return util.ParseJWKS(data)
+}
@@ -0,0 +1,101 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newHS256Token(secret string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]interface{}{"alg": "HS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestGRPCAuth(t *testing.T) {
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":"test","alg":"HS256","k":"%s"}]}`, base64.RawURLEncoding.EncodeToString([]byte("secret")))
+	}))
+	defer jwksServer.Close()
+
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello\"}"},
+	})
+	config := &Config{GRPCAuth: GRPCAuthConfig{
+		Enabled:       true,
+		TokenPatterns: []string{"^test-.*"},
+		JWKSURL:       jwksServer.URL,
+		Rules: []GRPCAuthRule{
+			{Methods: []string{"/bench.Greeter/*"}, Scopes: []string{"greet"}, TokenPatterns: []string{"^test-admin$"}},
+		},
+	}}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(interceptorOptions(config, newInterceptorSettings(config))...)
+	server.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	call := func(authorization string) codes.Code {
+		ctx := context.Background()
+		if authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+		}
+		return status.Code(conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct)))
+	}
+	assert.Equal(t, codes.Unauthenticated, call(""))
+	assert.Equal(t, codes.Unauthenticated, call("Bearer other"))
+	assert.Equal(t, codes.PermissionDenied, call("Bearer test-user"))
+	assert.Equal(t, codes.OK, call("Bearer test-admin"))
+	assert.Equal(t, codes.OK, call("Bearer "+newHS256Token("secret", map[string]interface{}{"scope": "read greet"})))
+	assert.Equal(t, codes.PermissionDenied, call("Bearer "+newHS256Token("secret", map[string]interface{}{"scope": "read"})))
+	assert.Equal(t, codes.Unauthenticated, call("Bearer "+newHS256Token("wrong", map[string]interface{}{"scope": "greet"})))
+	assert.Equal(t, codes.Unauthenticated, call("Bearer "+newHS256Token("secret", map[string]interface{}{"scope": "greet", "exp": 1})))
+}
+
+func TestLoadConfig_GRPCAuth(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.GRPCAuth.Enabled = true }})
+	assert.Error(t, err)
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.GRPCAuth = GRPCAuthConfig{Enabled: true, TokenPatterns: []string{"("}}
+	}})
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_JWT(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.JWT = JWTConfig{Secret: "secret", PublicKeyFile: "/tmp/key.pem"}
+	}})
+	assert.Error(t, err)
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.JWT.PublicKeyFile = "/tmp/missing.pem" }})
+	assert.Error(t, err)
+	config, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.JWT.Secret = "secret" }})
+	assert.NoError(t, err)
+	keys, _ := config.JWT.keys()
+	assert.NotNil(t, keys)
+}
@@ -0,0 +1,77 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"testing"
+)
+
+const benchFullMethod = "/bench.Greeter/Hello"
+
+// benchServiceDesc mimics the service descriptor created by protoc-gen-mock for a unary method
+var benchServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bench.Greeter",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Hello",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(structpb.Struct)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return grpchandler.MockHandler(ctx, srv.(stub.StubsMatcher), benchFullMethod, in, new(structpb.Struct))
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: benchFullMethod}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return grpchandler.MockHandler(ctx, srv.(stub.StubsMatcher), benchFullMethod, req, new(structpb.Struct))
+				}
+				return interceptor(ctx, in, info, handler)
+			},
+		},
+	},
+}
+
+// BenchmarkUnaryCall measures a complete unary call to the mock server, from the client to the matched stub response.
+func BenchmarkUnaryCall(b *testing.B) {
+	log.SetLevel(log.WarnLevel)
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "exact", Content: "{\"name\":\"John\"}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello, John\"}"},
+	})
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	server.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	request := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"name": {Kind: &structpb.Value_StringValue{StringValue: "John"}},
+	}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp := new(structpb.Struct)
+		if err := conn.Invoke(context.Background(), benchFullMethod, request, resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package bootstrap
 
 import (
 	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	log "github.com/sirupsen/logrus"
 	"strings"
 )
@@ -14,28 +16,193 @@ import (
 // - restPort : the port where the REST server will be started
 // - grpcPort : the port where the gRPC server will be started
 // - servicesRegistrationCallback : a function called when the grpc server is ready so that the mock services can be registered
-func BootstrapServers(tmpPath string, restPort uint, grpcPort uint, serviceRegisterCallback func(stubsStore stub.StubsMatcher) grpchandler.MockService) {
-	setupLogrus()
+// - options : optional settings of the servers
+// The settings can also be provided in a YAML or JSON config file (see WithConfigFile and the MOCK_CONFIG_FILE
+// environment variable) and overridden by environment variables.
+func BootstrapServers(tmpPath string, restPort uint, grpcPort uint, serviceRegisterCallback func(stubsStore stub.StubsMatcher) grpchandler.MockService, options ...Option) {
+	load := func() (*Config, error) {
+		return loadConfig(tmpPath, restPort, grpcPort, options)
+	}
+	config, err := load()
+	if err != nil {
+		panic(err)
+	}
+	setupLogging(config)
+	setupStrictMode(config)
+	setupSimulation(config)
+	setupRequestValidation(config)
+	setupFieldMaskTrimming(config)
+	setupMethodDeprecations(config)
+	setupMethodAliases(config)
+	if err := setupJWTVerification(config); err != nil {
+		panic(err)
+	}
+	setupScripts(config)
+	setupShadowing(config)
+	setupGoldenFiles(config)
 
-	errorsEngine, err := stub.NewCustomErrorEngine(tmpPath)
+	errorsEngine, err := stub.NewCustomErrorEngine(config.TmpPath)
 	if err != nil {
 		panic(err)
 	}
 	stub.SetErrorEngine(errorsEngine)
+	clock := util.NewMockClock()
+	stub.SetClock(clock)
+	random := util.NewSeededRandom(config.Seed)
+	stub.SetRandom(random)
+	log.Infof("Random seed: %d", random.Seed())
+	stateStore := stub.NewInMemoryStateStore()
+	stub.SetStateStore(stateStore)
 
-	stubsStore := stub.NewInMemoryStubsStore()
-	stubsMatcher := stub.NewStubsMatcher(stubsStore)
+	stubsStore := stub.NewInMemoryStubsStore(stub.WithStubLimits(stub.StubLimits{
+		MaxStubs:          int(config.Store.MaxStubs),
+		MaxStubsPerMethod: int(config.Store.MaxStubsPerMethod),
+		Eviction:          config.Store.Eviction,
+	}))
+	scenariosStore := stub.NewInMemoryScenariosStore()
+	stubSetsStore := stub.NewInMemoryStubSetsStore()
+	callCounter := stub.NewInMemoryCallCounter()
+	methodCallCounter := stub.NewInMemoryCallCounter()
+	journal, err := newJournal(config.Journal)
+	if err != nil {
+		panic(err)
+	}
+	stubsMatcher := stub.NewStubsMatcher(stubsStore,
+		stub.WithScenarios(scenariosStore),
+		stub.WithStubSets(stubSetsStore),
+		stub.WithCallCounter(callCounter),
+		stub.WithMethodCallCounter(methodCallCounter),
+		stub.WithJournal(journal),
+		stub.WithMethodAliases(stub.GetMethodAliases()))
 
 	service := serviceRegisterCallback(stubsMatcher)
 	log.Info("Supported methods: ", strings.Join(service.GetSupportedMethods(), "  |  "))
+	if config.StubsDir != "" {
+		if err := loadStubs(config.StubsDir, stubsStore, service); err != nil {
+			panic(err)
+		}
+	}
+	fixturesStore := stub.NewInMemoryFixturesStore()
+	if config.FixturesDir != "" {
+		if err := loadFixtures(config.FixturesDir, fixturesStore, stubsStore, service); err != nil {
+			panic(err)
+		}
+	}
+	loadDefaultStubs(stubsStore, service)
+	if config.Kubernetes.LabelSelector != "" {
+		if err := startKubernetesStubs(config.Kubernetes, fixturesStore, stubsStore, service); err != nil {
+			panic(err)
+		}
+	}
 	stubsExamples := service.GetPayloadExamples()
-	go StartRESTServer(restPort, CreateRESTControllers(stubsExamples, stubsStore, service))
-	StarGRPCServer(grpcPort, service)
+	controllers := createRESTControllers(stubsExamples, stubsStore, fixturesStore,
+		stub.NewInMemoryTrash(config.Store.trashRetention()), service)
+	if config.Descriptors.URL != "" {
+		controllers = append(controllers,
+			restcontrollers.DescriptorsController{Descriptors: newDescriptors(config.Descriptors), StubsStore: stubsStore})
+	}
+	if config.Profiling {
+		log.Info("Profiling endpoints enabled on /debug/pprof")
+		controllers = append(controllers, restcontrollers.ProfilingController{})
+	}
+	settings := newRESTSettings(config)
+	interceptors := newInterceptorSettings(config)
+	reloader := newConfigReloader(config, settings, interceptors, load)
+	if config.configFile != "" {
+		reloader.watch(config.configFile, configWatchInterval, nil)
+	}
+	controllers = append(controllers,
+		restcontrollers.ConfigController{Reloader: reloader},
+		restcontrollers.ScenariosController{StubsStore: stubsStore, ScenariosStore: scenariosStore},
+		restcontrollers.StubSetsController{StubsStore: stubsStore, StubSetsStore: stubSetsStore},
+		restcontrollers.StateController{StateStore: stateStore},
+		restcontrollers.TimeController{Clock: clock},
+		restcontrollers.RandomController{Random: random},
+		restcontrollers.ExpectationsController{StubsStore: stubsStore, CallCounter: callCounter},
+		restcontrollers.CoverageController{Service: service, StubsStore: stubsStore, MethodCalls: methodCallCounter},
+		newContractController(config.Contract, service, stubsStore),
+		restcontrollers.JournalController{Journal: journal, Service: service, StubsMatcher: stubsMatcher},
+		restcontrollers.PactController{StubsStore: stubsStore, Journal: journal},
+		restcontrollers.ReplayController{Service: service, Journal: journal, Dial: dialService},
+		restcontrollers.StrictController{StrictMode: grpchandler.GetStrictMode()},
+		restcontrollers.SimulationController{Simulation: grpchandler.GetSimulation()},
+		restcontrollers.DeprecationsController{Deprecations: grpchandler.GetMethodDeprecations()},
+		restcontrollers.AliasesController{Aliases: stub.GetMethodAliases()},
+		restcontrollers.OperationsController{Operations: stub.GetOperations()},
+		restcontrollers.SummaryController{Summary: grpchandler.GetCallSummary()},
+		restcontrollers.GoldenController{Golden: grpchandler.GetGoldenFiles()},
+		restcontrollers.GraphQLController{StubsStore: stubsStore, Journal: journal, ScenariosStore: scenariosStore, CallCounter: callCounter},
+		restcontrollers.ChannelzController{Channelz: newChannelz()},
+		restcontrollers.HealthController{StubsStore: stubsStore, GRPCServing: isGRPCServing, StrictMode: grpchandler.GetStrictMode()})
+	faults := newConnectionFaults(random)
+	controllers = append(controllers, restcontrollers.FaultsController{Injector: faults})
+	startServiceRegistration(config)
+	if config.SinglePort {
+		startSinglePortServer(config, settings, interceptors, controllers, service, faults)
+		return
+	}
+	// The gRPC server is started first so that the faults controller can send GOAWAY as soon as the REST API serves
+	serveGRPC(config, interceptors, service, faults)
+	go startRESTServer(config, settings, controllers)
+	AwaitTermination(func() {
+		log.Warn("Shutting down the server")
+	})
 }
 
-func setupLogrus() {
+// setupLogging applies the logging settings of the (already validated) config
+func setupLogging(config *Config) {
+	level, _ := log.ParseLevel(config.Logging.Level)
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
 	})
-	log.SetLevel(log.DebugLevel)
+	log.SetLevel(level)
+	util.ConfigurePayloadLogging(!config.Logging.DisablePayloads, config.Logging.RedactedFields)
+}
+
+func setupStrictMode(config *Config) {
+	grpchandler.GetStrictMode().Configure(config.Strict.Enabled, config.Strict.FailReadiness)
+}
+
+func setupSimulation(config *Config) {
+	grpchandler.GetSimulation().Configure(config.Simulate.Services)
+}
+
+func setupRequestValidation(config *Config) {
+	grpchandler.GetRequestValidation().Configure(config.Validation.Enabled)
+}
+
+func setupFieldMaskTrimming(config *Config) {
+	grpchandler.GetFieldMaskTrimming().Configure(config.FieldMask.Enabled)
+}
+
+func setupMethodDeprecations(config *Config) {
+	deprecations := make([]grpchandler.MethodDeprecation, 0, len(config.Deprecations))
+	for _, deprecation := range config.Deprecations {
+		deprecations = append(deprecations, deprecation.deprecation())
+	}
+	grpchandler.GetMethodDeprecations().Configure(deprecations)
+}
+
+func setupMethodAliases(config *Config) {
+	aliases := make([]stub.MethodAlias, 0, len(config.Aliases))
+	for _, alias := range config.Aliases {
+		aliases = append(aliases, alias.alias())
+	}
+	stub.GetMethodAliases().Configure(aliases)
+}
+
+// setupScripts sets how long the scripts of the scripted responses can run
+func setupScripts(config *Config) {
+	stub.SetScriptTimeout(config.Scripts.timeout())
+}
+
+// setupJWTVerification sets the keys that verify the tokens matched by the claims of the stubs, or returns the error
+// reading them
+func setupJWTVerification(config *Config) error {
+	keys, err := config.JWT.keys()
+	if err != nil {
+		return err
+	}
+	stub.SetClaimsVerificationKeys(keys)
+	return nil
 }
@@ -0,0 +1,35 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelzservice "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+)
+
+// channelzAddress is the address of the in-memory listener of the channelz service read by the REST API
+const channelzAddress = "bufconn"
+
+// newChannelz serves the channelz service in memory, so that the REST API reads the channelz data regardless of the
+// port, TLS and authentication settings of the gRPC server. Channelz is enabled by the channelz service package.
+func newChannelz() *grpchandler.Channelz {
+	listener := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	channelzservice.RegisterChannelzServiceToServer(s)
+	go func() {
+		if err := s.Serve(listener); err != nil {
+			log.Errorf("Channelz server stopped: %v", err)
+		}
+	}()
+	conn, err := grpc.Dial(channelzAddress, grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	if err != nil {
+		log.Fatalf("Failed to connect to the channelz server: %v", err)
+	}
+	return &grpchandler.Channelz{Client: channelzpb.NewChannelzClient(conn), HiddenAddress: channelzAddress}
+}
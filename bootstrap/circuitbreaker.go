@@ -0,0 +1,126 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerConfig makes a method fail with UNAVAILABLE for a while after it served a number of failures in a row,
+// to exercise the circuit breakers of the clients end to end
+type CircuitBreakerConfig struct {
+	// Method is a full method (/package.Service/Method) or all the methods of a service (/package.Service/*), which
+	// then share the breaker
+	Method string `yaml:"method"`
+	// Failures is the number of calls in a row that failed (with any status but OK) after which the breaker opens
+	Failures int `yaml:"failures"`
+	// CoolDown is how long the breaker stays open, e.g. 30s
+	CoolDown string `yaml:"coolDown"`
+}
+
+func (c CircuitBreakerConfig) validate() error {
+	if c.Method == "" || c.Failures <= 0 {
+		return fmt.Errorf("circuit breakers require a method and a positive number of failures")
+	}
+	if d, err := time.ParseDuration(c.CoolDown); err != nil || d <= 0 {
+		return fmt.Errorf("invalid circuit breaker cool down: %s", c.CoolDown)
+	}
+	return nil
+}
+
+func (c CircuitBreakerConfig) appliesTo(fullMethod string) bool {
+	return c.Method == fullMethod || (strings.HasSuffix(c.Method, "/*") && strings.HasPrefix(fullMethod, strings.TrimSuffix(c.Method, "*")))
+}
+
+// circuitBreakers holds the state of each breaker. The first breaker that applies to a method is used.
+type circuitBreakers struct {
+	breakers []*circuitBreaker
+}
+
+type circuitBreaker struct {
+	config   CircuitBreakerConfig
+	coolDown time.Duration
+	now      func() time.Time
+	// failures is the number of calls in a row that failed, and openUntil the time the breaker closes when open
+	failures  int
+	openUntil time.Time
+	mutex     sync.Mutex
+}
+
+func newCircuitBreakers(configs []CircuitBreakerConfig) *circuitBreakers {
+	breakers := &circuitBreakers{breakers: make([]*circuitBreaker, 0, len(configs))}
+	for _, config := range configs {
+		coolDown, _ := time.ParseDuration(config.CoolDown)
+		breakers.breakers = append(breakers.breakers, &circuitBreaker{config: config, coolDown: coolDown, now: time.Now})
+	}
+	return breakers
+}
+
+func (b *circuitBreakers) get(fullMethod string) *circuitBreaker {
+	for _, breaker := range b.breakers {
+		if breaker.config.appliesTo(fullMethod) {
+			return breaker
+		}
+	}
+	return nil
+}
+
+// allow fails the call when the breaker is open
+func (b *circuitBreaker) allow(fullMethod string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if remaining := b.openUntil.Sub(b.now()); remaining > 0 {
+		return status.Errorf(codes.Unavailable, "the circuit of %s is open for %s", fullMethod, remaining.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// done counts the call served, opening the breaker when it is the last of the failures in a row
+func (b *circuitBreaker) done(fullMethod string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.config.Failures {
+		b.failures = 0
+		b.openUntil = b.now().Add(b.coolDown)
+		log.Infof("Circuit breaker %s opened by %s for %s", b.config.Method, fullMethod, b.coolDown)
+	}
+}
+
+func (b *circuitBreakers) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	breaker := b.get(info.FullMethod)
+	if breaker == nil {
+		return handler(ctx, req)
+	}
+	if err := breaker.allow(info.FullMethod); err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	breaker.done(info.FullMethod, err)
+	return resp, err
+}
+
+func (b *circuitBreakers) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	breaker := b.get(info.FullMethod)
+	if breaker == nil {
+		return handler(srv, stream)
+	}
+	if err := breaker.allow(info.FullMethod); err != nil {
+		return err
+	}
+	err := handler(srv, stream)
+	breaker.done(info.FullMethod, err)
+	return err
+}
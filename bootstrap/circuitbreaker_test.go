@@ -0,0 +1,44 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakers(t *testing.T) {
+	breakers := newCircuitBreakers([]CircuitBreakerConfig{{Method: "/acme.Orders/*", Failures: 2, CoolDown: "30s"}})
+	now := time.Now()
+	breakers.breakers[0].now = func() time.Time { return now }
+	fail := errors.New("failed")
+	call := func(method string, err error) error {
+		_, callErr := breakers.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, err })
+		return callErr
+	}
+
+	// A success resets the failures in a row
+	assert.Equal(t, fail, call("/acme.Orders/Get", fail))
+	assert.NoError(t, call("/acme.Orders/Get", nil))
+	assert.Equal(t, fail, call("/acme.Orders/Get", fail))
+	// The methods of the service share the breaker
+	assert.Equal(t, fail, call("/acme.Orders/List", fail))
+	assert.Equal(t, codes.Unavailable, status.Code(call("/acme.Orders/Get", nil)))
+	assert.Equal(t, codes.Unavailable, status.Code(call("/acme.Orders/List", nil)))
+	assert.Equal(t, fail, call("/acme.Payments/Charge", fail))
+
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, call("/acme.Orders/Get", nil))
+}
+
+func TestLoadConfig_CircuitBreakers(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.Interceptors.CircuitBreakers = []CircuitBreakerConfig{{Method: "/acme.Orders/Get", Failures: 3}}
+	}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// ConcurrencyLimitConfig caps the calls in flight to a method, to emulate upstreams with a limited thread pool
+type ConcurrencyLimitConfig struct {
+	// Method is a full method (/package.Service/Method) or all the methods of a service (/package.Service/*), which
+	// then share the limit
+	Method string `yaml:"method"`
+	// MaxInFlight is the number of calls served at the same time
+	MaxInFlight int `yaml:"maxInFlight"`
+	// Queue makes the calls over the limit wait for a call to finish instead of failing with UNAVAILABLE
+	Queue bool `yaml:"queue"`
+	// QueueTimeout is how long a call waits in the queue before failing with UNAVAILABLE, e.g. 500ms. The calls wait
+	// until they are cancelled when empty.
+	QueueTimeout string `yaml:"queueTimeout"`
+}
+
+func (c ConcurrencyLimitConfig) validate() error {
+	if c.Method == "" || c.MaxInFlight <= 0 {
+		return fmt.Errorf("concurrency limits require a method and a positive maxInFlight")
+	}
+	if c.QueueTimeout != "" {
+		if d, err := time.ParseDuration(c.QueueTimeout); err != nil || d < 0 {
+			return fmt.Errorf("invalid concurrency limit queue timeout: %s", c.QueueTimeout)
+		}
+	}
+	return nil
+}
+
+func (c ConcurrencyLimitConfig) appliesTo(fullMethod string) bool {
+	return c.Method == fullMethod || (strings.HasSuffix(c.Method, "/*") && strings.HasPrefix(fullMethod, strings.TrimSuffix(c.Method, "*")))
+}
+
+// concurrencyLimiter holds the calls in flight of each limit. The first limit that applies to a method is used.
+type concurrencyLimiter struct {
+	limits []concurrencyLimit
+}
+
+type concurrencyLimit struct {
+	config       ConcurrencyLimitConfig
+	queueTimeout time.Duration
+	// Each call in flight holds a slot
+	slots chan struct{}
+}
+
+func newConcurrencyLimiter(configs []ConcurrencyLimitConfig) *concurrencyLimiter {
+	limiter := &concurrencyLimiter{limits: make([]concurrencyLimit, 0, len(configs))}
+	for _, config := range configs {
+		queueTimeout, _ := time.ParseDuration(config.QueueTimeout)
+		limiter.limits = append(limiter.limits, concurrencyLimit{
+			config:       config,
+			queueTimeout: queueTimeout,
+			slots:        make(chan struct{}, config.MaxInFlight),
+		})
+	}
+	return limiter
+}
+
+// acquire takes a slot for the call, waiting for one when the calls queue, and returns the function that releases
+// it when the call finishes
+func (l *concurrencyLimiter) acquire(ctx context.Context, fullMethod string) (func(), error) {
+	for _, limit := range l.limits {
+		if limit.config.appliesTo(fullMethod) {
+			return limit.acquire(ctx, fullMethod)
+		}
+	}
+	return func() {}, nil
+}
+
+func (l concurrencyLimit) acquire(ctx context.Context, fullMethod string) (func(), error) {
+	release := func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	overLimit := status.Errorf(codes.Unavailable, "%s is at its limit of %d calls in flight", fullMethod, l.config.MaxInFlight)
+	if !l.config.Queue {
+		return nil, overLimit
+	}
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case <-timeout:
+		return nil, overLimit
+	}
+}
+
+func (l *concurrencyLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	release, err := l.acquire(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return handler(ctx, req)
+}
+
+func (l *concurrencyLimiter) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	release, err := l.acquire(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return handler(srv, stream)
+}
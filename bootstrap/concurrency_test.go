@@ -0,0 +1,56 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter_Reject(t *testing.T) {
+	limiter := newConcurrencyLimiter([]ConcurrencyLimitConfig{{Method: "/acme.Orders/*", MaxInFlight: 1}})
+
+	release, err := limiter.acquire(context.Background(), "/acme.Orders/Get")
+	assert.NoError(t, err)
+	// The methods of the service share the limit
+	_, err = limiter.acquire(context.Background(), "/acme.Orders/List")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = limiter.acquire(context.Background(), "/acme.Payments/Charge")
+	assert.NoError(t, err)
+
+	release()
+	_, err = limiter.acquire(context.Background(), "/acme.Orders/List")
+	assert.NoError(t, err)
+}
+
+func TestConcurrencyLimiter_Queue(t *testing.T) {
+	limiter := newConcurrencyLimiter([]ConcurrencyLimitConfig{{Method: "/acme.Orders/Get", MaxInFlight: 1, Queue: true, QueueTimeout: "50ms"}})
+
+	release, err := limiter.acquire(context.Background(), "/acme.Orders/Get")
+	assert.NoError(t, err)
+	start := time.Now()
+	_, err = limiter.acquire(context.Background(), "/acme.Orders/Get")
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	_, err = limiter.acquire(context.Background(), "/acme.Orders/Get")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.acquire(ctx, "/acme.Orders/Get")
+	assert.Equal(t, codes.Canceled, status.Code(err))
+}
+
+func TestLoadConfig_ConcurrencyLimits(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.Interceptors.ConcurrencyLimits = []ConcurrencyLimitConfig{{Method: "/acme.Orders/Get"}}
+	}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,669 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variable with the path of the config file, used when no config file is set with WithConfigFile
+const configFileEnvVar = "MOCK_CONFIG_FILE"
+
+// Store backends supported
+const storeBackendMemory = "memory"
+
+// Time the stubs deleted are kept in the trash when not configured
+const defaultTrashRetention = "24h"
+
+// Config holds the settings of the mock servers. They are set, in increasing order of precedence, by the parameters of
+// BootstrapServers, the options, the config file and the environment variables.
+type Config struct {
+	// TmpPath is the path to store temporary files
+	TmpPath string `yaml:"tmpPath"`
+	// RESTPort is the port where the REST server is started
+	RESTPort uint `yaml:"restPort"`
+	// GRPCPort is the port where the gRPC server is started
+	GRPCPort uint `yaml:"grpcPort"`
+	// SinglePort serves both the gRPC mock and the REST API on the REST port. GRPCPort is ignored.
+	SinglePort bool `yaml:"singlePort"`
+	// Profiling exposes the net/http/pprof endpoints under /debug/pprof on the REST port
+	Profiling bool `yaml:"profiling"`
+	// StubsDir is a directory with stub files (*.json) loaded when the server starts
+	StubsDir string `yaml:"stubsDir"`
+	// FixturesDir is a directory with fixtures (one *.json file per fixture) available to be activated
+	FixturesDir string        `yaml:"fixturesDir"`
+	Store       StoreConfig   `yaml:"store"`
+	TLS         TLSConfig     `yaml:"tls"`
+	CORS        CORSConfig    `yaml:"cors"`
+	Auth        AuthConfig    `yaml:"auth"`
+	Logging     LoggingConfig `yaml:"logging"`
+	Strict      StrictConfig  `yaml:"strict"`
+	// Simulate serves the standard methods of some services from in-memory resources when no stub matches
+	Simulate SimulateConfig `yaml:"simulate"`
+	// Validation rejects the requests that break the validation rules of their messages
+	Validation ValidationConfig `yaml:"validation"`
+	// FieldMask trims the responses to the field mask of the requests
+	FieldMask FieldMaskConfig `yaml:"fieldMask"`
+	// Deprecations mark methods as deprecated or unavailable
+	Deprecations []DeprecationConfig `yaml:"deprecations"`
+	// Aliases route the calls to renamed methods to the stubs of their former names
+	Aliases []AliasConfig `yaml:"aliases"`
+	// Interceptors enables the built-in interceptors of the gRPC server
+	Interceptors InterceptorsConfig `yaml:"interceptors"`
+	// GRPCAuth simulates the authentication and authorization of the gRPC calls
+	GRPCAuth GRPCAuthConfig `yaml:"grpcAuth"`
+	// JWT verifies the tokens matched by the claims of the stubs
+	JWT JWTConfig `yaml:"jwt"`
+	// Scripts limits the scripted responses
+	Scripts ScriptsConfig `yaml:"scripts"`
+	// Seed makes the random values of the responses and faults reproducible. A seed based on the current time is
+	// used when it is 0.
+	Seed int64 `yaml:"seed"`
+	// Contract is the real service the stubs are verified against
+	Contract ContractConfig `yaml:"contract"`
+	// Journal persists the calls received
+	Journal JournalConfig `yaml:"journal"`
+	// Discovery registers the gRPC endpoint in Consul or etcd
+	Discovery DiscoveryConfig `yaml:"discovery"`
+	// Kubernetes loads the stubs of labelled ConfigMaps and Secrets and keeps them in sync
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+	// Shadow sends a copy of the calls matched to a sink
+	Shadow ShadowConfig `yaml:"shadow"`
+	// Golden checks the responses served against the golden files of previous runs
+	Golden GoldenConfig `yaml:"golden"`
+	// Descriptors fetches the descriptors of the services the stubs are checked against
+	Descriptors DescriptorsConfig `yaml:"descriptors"`
+
+	configFile         string
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
+}
+
+type StoreConfig struct {
+	// Backend where the stubs are kept. Only memory is supported.
+	Backend string `yaml:"backend"`
+	// MaxStubs and MaxStubsPerMethod limit the number of stubs, 0 for no limit
+	MaxStubs          int64 `yaml:"maxStubs"`
+	MaxStubsPerMethod int64 `yaml:"maxStubsPerMethod"`
+	// Eviction is what happens when adding a stub over a limit: reject (the default), lru or oldest
+	Eviction string `yaml:"eviction"`
+	// TrashRetention is how long the stubs deleted can be restored, e.g. 24h. They are kept until restart when 0.
+	TrashRetention string `yaml:"trashRetention"`
+}
+
+func (c StoreConfig) trashRetention() time.Duration {
+	retention, _ := time.ParseDuration(c.TrashRetention)
+	return retention
+}
+
+// TLSConfig enables TLS on both the gRPC and REST servers when the certificate and key files are set
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// ClientCAFile has the CA certificates used to verify the certificates of the gRPC clients. The clients are not
+	// required to send a certificate, but the ones sent must be valid.
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// serverConfig loads the certificate of the server and the CA certificates of the clients
+func (c TLSConfig) serverConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed to call the REST API from a browser. * allows any origin.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+type AuthConfig struct {
+	// Token required in the Authorization header (Bearer <token>) of the REST API calls. No authentication is
+	// required when empty and there are no API keys. The changes made with it are recorded in the audit log as made
+	// by "token".
+	Token string `yaml:"token"`
+	// APIKeys are tokens accepted as well, each recorded by its name in the audit log as the actor of the changes
+	APIKeys []APIKeyConfig `yaml:"apiKeys"`
+}
+
+// APIKeyConfig is a named token of the REST API
+type APIKeyConfig struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+// The principal of the changes made with AuthConfig.Token
+const tokenPrincipal = "token"
+
+func (c AuthConfig) validate() error {
+	names := make(map[string]bool, len(c.APIKeys))
+	for _, key := range c.APIKeys {
+		if key.Name == "" || key.Token == "" {
+			return fmt.Errorf("the API keys require a name and a token")
+		}
+		if names[key.Name] || key.Name == tokenPrincipal {
+			return fmt.Errorf("duplicate API key name: %s", key.Name)
+		}
+		names[key.Name] = true
+	}
+	return nil
+}
+
+type LoggingConfig struct {
+	// Level is the minimum level of the messages logged: panic, fatal, error, warn, info, debug or trace
+	Level string `yaml:"level"`
+	// DisablePayloads stops requests, responses and stubs being written to the logs
+	DisablePayloads bool `yaml:"disablePayloads"`
+	// RedactedFields are the field paths (e.g. password or customer.ssn) whose values are replaced in the logs and in
+	// the payloads kept by the server
+	RedactedFields []string `yaml:"redactedFields"`
+}
+
+// StrictConfig makes the calls that don't match any stub fail with a distinctive status code (Unimplemented)
+type StrictConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// FailReadiness makes /readyz fail once an unexpected call is received
+	FailReadiness bool `yaml:"failReadiness"`
+}
+
+// SimulateConfig enables the CRUD simulation (see grpchandler.Simulation) of the services, e.g. acme.v1.Orders
+type SimulateConfig struct {
+	Services []string `yaml:"services"`
+}
+
+// ValidationConfig enables the validation (see grpchandler.RequestValidation) of the requests against the
+// protoc-gen-validate or protovalidate rules of their messages
+type ValidationConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// FieldMaskConfig enables the trimming (see grpchandler.FieldMaskTrimming) of the responses to the field mask of the
+// requests, e.g. read_mask
+type FieldMaskConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// DeprecationConfig marks a method as deprecated or unavailable (see grpchandler.MethodDeprecation)
+type DeprecationConfig struct {
+	// Method is a full method (/package.Service/Method) or all the methods of a service (/package.Service/*)
+	Method string `yaml:"method"`
+	// Unavailable makes the calls fail with UNIMPLEMENTED instead of sending the deprecation headers
+	Unavailable bool   `yaml:"unavailable"`
+	Message     string `yaml:"message"`
+	Sunset      string `yaml:"sunset"`
+}
+
+func (c DeprecationConfig) deprecation() grpchandler.MethodDeprecation {
+	return grpchandler.MethodDeprecation{Method: c.Method, Unavailable: c.Unavailable, Message: c.Message, Sunset: c.Sunset}
+}
+
+// AliasConfig routes the calls to a method to the stubs of another one (see stub.MethodAlias)
+type AliasConfig struct {
+	// Method is a full method (/package.Service/Method) or all the methods of a service (/package.Service/*)
+	Method string `yaml:"method"`
+	// Target is the full method the stubs are registered under or a service, for the methods of the same name
+	Target string `yaml:"target"`
+}
+
+func (c AliasConfig) alias() stub.MethodAlias {
+	return stub.MethodAlias{Method: c.Method, Target: c.Target}
+}
+
+// JWTConfig verifies the JWTs matched by the claims of the stubs with a secret (HS algorithms) or a public key (RS and
+// ES algorithms), so that only the tokens signed with it and not expired match. The tokens are decoded without being
+// verified when none is set.
+type JWTConfig struct {
+	Secret string `yaml:"secret"`
+	// PublicKeyFile is a PEM file with the public key or a certificate
+	PublicKeyFile string `yaml:"publicKeyFile"`
+}
+
+// ScriptsConfig limits the scripts of the scripted responses
+type ScriptsConfig struct {
+	// Timeout is how long a script can run before it is stopped and the call fails, e.g. 500ms. It is
+	// stub.DefaultScriptTimeout when not set.
+	Timeout string `yaml:"timeout"`
+}
+
+func (c ScriptsConfig) validate() error {
+	if c.Timeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid scripts timeout: %s", c.Timeout)
+	}
+	return nil
+}
+
+func (c ScriptsConfig) timeout() time.Duration {
+	timeout, _ := time.ParseDuration(c.Timeout)
+	return timeout
+}
+
+// keys returns the keys to verify the tokens, nil if they aren't verified
+func (c JWTConfig) keys() (*util.JWKS, error) {
+	switch {
+	case c.Secret != "" && c.PublicKeyFile != "":
+		return nil, fmt.Errorf("only one of the JWT secret and public key file can be set")
+	case c.Secret != "":
+		return util.NewSecretJWKS([]byte(c.Secret)), nil
+	case c.PublicKeyFile != "":
+		data, err := ioutil.ReadFile(c.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys, err := util.ParsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT public key file %s: %w", c.PublicKeyFile, err)
+		}
+		return keys, nil
+	}
+	return nil, nil
+}
+
+// Option changes the Config used by BootstrapServers
+type Option func(config *Config)
+
+// WithConfigFile loads the settings from a YAML or JSON file
+func WithConfigFile(path string) Option {
+	return func(config *Config) {
+		config.configFile = path
+	}
+}
+
+// WithSinglePort serves both the gRPC mock and the REST API on the REST port
+func WithSinglePort() Option {
+	return func(config *Config) {
+		config.SinglePort = true
+	}
+}
+
+// WithProfiling enables the pprof endpoints on the REST port
+func WithProfiling() Option {
+	return func(config *Config) {
+		config.Profiling = true
+	}
+}
+
+// WithLogLevel sets the minimum level of the messages logged. The default is debug.
+func WithLogLevel(level string) Option {
+	return func(config *Config) {
+		config.Logging.Level = level
+	}
+}
+
+// WithoutPayloadLogging stops requests, responses and stubs being written to the logs
+func WithoutPayloadLogging() Option {
+	return func(config *Config) {
+		config.Logging.DisablePayloads = true
+	}
+}
+
+// WithRedactedFields adds field paths whose values are redacted. A path without dots matches the field at any depth.
+func WithRedactedFields(fields ...string) Option {
+	return func(config *Config) {
+		config.Logging.RedactedFields = append(config.Logging.RedactedFields, fields...)
+	}
+}
+
+// WithStrictMode makes the calls that don't match any stub fail. When failReadiness is set, /readyz fails once an
+// unexpected call is received.
+func WithStrictMode(failReadiness bool) Option {
+	return func(config *Config) {
+		config.Strict = StrictConfig{Enabled: true, FailReadiness: failReadiness}
+	}
+}
+
+// WithSimulatedServices serves the standard methods (Create, Get, List, Update and Delete) of the services from
+// in-memory resources when no stub matches
+func WithSimulatedServices(services ...string) Option {
+	return func(config *Config) {
+		config.Simulate.Services = append(config.Simulate.Services, services...)
+	}
+}
+
+// WithRequestValidation rejects the requests that break the protoc-gen-validate or protovalidate rules of their
+// messages with INVALID_ARGUMENT before they are matched against the stubs
+func WithRequestValidation() Option {
+	return func(config *Config) {
+		config.Validation.Enabled = true
+	}
+}
+
+// WithFieldMaskTrimming trims the responses to the paths of the field mask of the requests (e.g. read_mask), so that
+// the stubs with the full resources answer the calls with any mask
+func WithFieldMaskTrimming() Option {
+	return func(config *Config) {
+		config.FieldMask.Enabled = true
+	}
+}
+
+// WithMethodAlias routes the calls to the method to the stubs of the target when none of its stubs matches, e.g. the
+// former name of a renamed method. Both can be all the methods of a service (/package.Service/*).
+func WithMethodAlias(method, target string) Option {
+	return func(config *Config) {
+		config.Aliases = append(config.Aliases, AliasConfig{Method: method, Target: target})
+	}
+}
+
+// WithStubsDir loads the stub files in the directory when the server starts
+func WithStubsDir(dir string) Option {
+	return func(config *Config) {
+		config.StubsDir = dir
+	}
+}
+
+// WithFixturesDir loads the fixtures in the directory when the server starts. The fixtures are not activated.
+func WithFixturesDir(dir string) Option {
+	return func(config *Config) {
+		config.FixturesDir = dir
+	}
+}
+
+// WithTLS enables TLS on the gRPC and REST servers
+func WithTLS(certFile, keyFile string) Option {
+	return func(config *Config) {
+		config.TLS = TLSConfig{CertFile: certFile, KeyFile: keyFile}
+	}
+}
+
+// WithTLSClientCA verifies the certificates of the gRPC clients with the CA certificates in the file. It requires TLS.
+func WithTLSClientCA(caFile string) Option {
+	return func(config *Config) {
+		config.TLS.ClientCAFile = caFile
+	}
+}
+
+// WithCORS allows browsers on the origins provided to call the REST API
+func WithCORS(allowedOrigins ...string) Option {
+	return func(config *Config) {
+		config.CORS.AllowedOrigins = append(config.CORS.AllowedOrigins, allowedOrigins...)
+	}
+}
+
+// WithJournalDir persists the journal of the calls in the directory, so it is reloaded on restart
+func WithJournalDir(dir string) Option {
+	return func(config *Config) {
+		config.Journal.Dir = dir
+	}
+}
+
+// WithAuthToken requires the token in the Authorization header of the REST API calls
+func WithAuthToken(token string) Option {
+	return func(config *Config) {
+		config.Auth.Token = token
+	}
+}
+
+func loadConfig(tmpPath string, restPort uint, grpcPort uint, options []Option) (*Config, error) {
+	config := &Config{
+		TmpPath:  tmpPath,
+		RESTPort: restPort,
+		GRPCPort: grpcPort,
+		Store:    StoreConfig{Backend: storeBackendMemory, TrashRetention: defaultTrashRetention},
+		Logging:  LoggingConfig{Level: log.DebugLevel.String()},
+	}
+	for _, option := range options {
+		option(config)
+	}
+	if config.configFile == "" {
+		config.configFile = os.Getenv(configFileEnvVar)
+	}
+	if config.configFile != "" {
+		if err := config.readFile(config.configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFile overrides the settings present in the file. JSON files are read as YAML, which is a superset of JSON.
+func (c *Config) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read config file %s: %w", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+type envOverride struct {
+	name  string
+	apply func(config *Config, value string) error
+}
+
+// Environment variables that override the settings
+var envOverrides = []envOverride{
+	{"MOCK_TMP_PATH", func(c *Config, v string) error { c.TmpPath = v; return nil }},
+	{"MOCK_REST_PORT", func(c *Config, v string) error { return parsePort(v, &c.RESTPort) }},
+	{"MOCK_GRPC_PORT", func(c *Config, v string) error { return parsePort(v, &c.GRPCPort) }},
+	{"MOCK_SINGLE_PORT", func(c *Config, v string) error { return parseBool(v, &c.SinglePort) }},
+	{"MOCK_PROFILING", func(c *Config, v string) error { return parseBool(v, &c.Profiling) }},
+	{"MOCK_STUBS_DIR", func(c *Config, v string) error { c.StubsDir = v; return nil }},
+	{"MOCK_FIXTURES_DIR", func(c *Config, v string) error { c.FixturesDir = v; return nil }},
+	{"MOCK_STORE_BACKEND", func(c *Config, v string) error { c.Store.Backend = v; return nil }},
+	{"MOCK_STORE_MAX_STUBS", func(c *Config, v string) error { return parseInt(v, &c.Store.MaxStubs) }},
+	{"MOCK_STORE_MAX_STUBS_PER_METHOD", func(c *Config, v string) error { return parseInt(v, &c.Store.MaxStubsPerMethod) }},
+	{"MOCK_STORE_EVICTION", func(c *Config, v string) error { c.Store.Eviction = v; return nil }},
+	{"MOCK_STORE_TRASH_RETENTION", func(c *Config, v string) error { c.Store.TrashRetention = v; return nil }},
+	{"MOCK_TLS_CERT_FILE", func(c *Config, v string) error { c.TLS.CertFile = v; return nil }},
+	{"MOCK_TLS_KEY_FILE", func(c *Config, v string) error { c.TLS.KeyFile = v; return nil }},
+	{"MOCK_TLS_CLIENT_CA_FILE", func(c *Config, v string) error { c.TLS.ClientCAFile = v; return nil }},
+	{"MOCK_CORS_ALLOWED_ORIGINS", func(c *Config, v string) error { c.CORS.AllowedOrigins = splitList(v); return nil }},
+	{"MOCK_AUTH_TOKEN", func(c *Config, v string) error { c.Auth.Token = v; return nil }},
+	{"MOCK_LOG_LEVEL", func(c *Config, v string) error { c.Logging.Level = v; return nil }},
+	{"MOCK_LOG_DISABLE_PAYLOADS", func(c *Config, v string) error { return parseBool(v, &c.Logging.DisablePayloads) }},
+	{"MOCK_LOG_REDACTED_FIELDS", func(c *Config, v string) error { c.Logging.RedactedFields = splitList(v); return nil }},
+	{"MOCK_STRICT", func(c *Config, v string) error { return parseBool(v, &c.Strict.Enabled) }},
+	{"MOCK_STRICT_FAIL_READINESS", func(c *Config, v string) error { return parseBool(v, &c.Strict.FailReadiness) }},
+	{"MOCK_SIMULATE_SERVICES", func(c *Config, v string) error { c.Simulate.Services = splitList(v); return nil }},
+	{"MOCK_VALIDATION", func(c *Config, v string) error { return parseBool(v, &c.Validation.Enabled) }},
+	{"MOCK_FIELD_MASK", func(c *Config, v string) error { return parseBool(v, &c.FieldMask.Enabled) }},
+	{"MOCK_INTERCEPTORS_METADATA_ECHO", func(c *Config, v string) error { return parseBool(v, &c.Interceptors.MetadataEcho) }},
+	{"MOCK_INTERCEPTORS_PROPAGATED_METADATA", func(c *Config, v string) error { c.Interceptors.PropagatedMetadata = splitList(v); return nil }},
+	{"MOCK_INTERCEPTORS_DELAY", func(c *Config, v string) error { c.Interceptors.Delay = v; return nil }},
+	{"MOCK_GRPC_AUTH_ENABLED", func(c *Config, v string) error { return parseBool(v, &c.GRPCAuth.Enabled) }},
+	{"MOCK_GRPC_AUTH_TOKEN_PATTERNS", func(c *Config, v string) error { c.GRPCAuth.TokenPatterns = splitList(v); return nil }},
+	{"MOCK_GRPC_AUTH_JWKS_URL", func(c *Config, v string) error { c.GRPCAuth.JWKSURL = v; return nil }},
+	{"MOCK_JWT_SECRET", func(c *Config, v string) error { c.JWT.Secret = v; return nil }},
+	{"MOCK_JWT_PUBLIC_KEY_FILE", func(c *Config, v string) error { c.JWT.PublicKeyFile = v; return nil }},
+	{"MOCK_SCRIPTS_TIMEOUT", func(c *Config, v string) error { c.Scripts.Timeout = v; return nil }},
+	{"MOCK_SEED", func(c *Config, v string) error { return parseInt(v, &c.Seed) }},
+	{"MOCK_CONTRACT_UPSTREAM", func(c *Config, v string) error { c.Contract.Upstream = v; return nil }},
+	{"MOCK_CONTRACT_TLS", func(c *Config, v string) error { return parseBool(v, &c.Contract.TLS) }},
+	{"MOCK_CONTRACT_IGNORED_FIELDS", func(c *Config, v string) error { c.Contract.IgnoredFields = splitList(v); return nil }},
+	{"MOCK_CONTRACT_TIMEOUT", func(c *Config, v string) error { c.Contract.Timeout = v; return nil }},
+	{"MOCK_JOURNAL_DIR", func(c *Config, v string) error { c.Journal.Dir = v; return nil }},
+	{"MOCK_JOURNAL_MAX_FILE_SIZE_MB", func(c *Config, v string) error { return parseInt(v, &c.Journal.MaxFileSizeMB) }},
+	{"MOCK_JOURNAL_ROTATE_INTERVAL", func(c *Config, v string) error { c.Journal.RotateInterval = v; return nil }},
+	{"MOCK_JOURNAL_MAX_FILES", func(c *Config, v string) error { return parseInt(v, &c.Journal.MaxFiles) }},
+	{"MOCK_JOURNAL_RETENTION", func(c *Config, v string) error { c.Journal.Retention = v; return nil }},
+	{"MOCK_DISCOVERY_BACKEND", func(c *Config, v string) error { c.Discovery.Backend = v; return nil }},
+	{"MOCK_DISCOVERY_ADDRESS", func(c *Config, v string) error { c.Discovery.Address = v; return nil }},
+	{"MOCK_DISCOVERY_SERVICE_NAMES", func(c *Config, v string) error { c.Discovery.ServiceNames = splitList(v); return nil }},
+	{"MOCK_DISCOVERY_ADVERTISE_ADDRESS", func(c *Config, v string) error { c.Discovery.AdvertiseAddress = v; return nil }},
+	{"MOCK_DISCOVERY_HEALTH_CHECK_INTERVAL", func(c *Config, v string) error { c.Discovery.HealthCheckInterval = v; return nil }},
+	{"MOCK_KUBERNETES_LABEL_SELECTOR", func(c *Config, v string) error { c.Kubernetes.LabelSelector = v; return nil }},
+	{"MOCK_KUBERNETES_NAMESPACE", func(c *Config, v string) error { c.Kubernetes.Namespace = v; return nil }},
+	{"MOCK_KUBERNETES_SECRETS", func(c *Config, v string) error { return parseBool(v, &c.Kubernetes.Secrets) }},
+	{"MOCK_SHADOW_TARGET", func(c *Config, v string) error { c.Shadow.Target = v; return nil }},
+	{"MOCK_SHADOW_TLS", func(c *Config, v string) error { return parseBool(v, &c.Shadow.TLS) }},
+	{"MOCK_SHADOW_QUEUE_SIZE", func(c *Config, v string) error { return parseInt(v, &c.Shadow.QueueSize) }},
+	{"MOCK_SHADOW_TIMEOUT", func(c *Config, v string) error { c.Shadow.Timeout = v; return nil }},
+	{"MOCK_GOLDEN_DIR", func(c *Config, v string) error { c.Golden.Dir = v; return nil }},
+	{"MOCK_GOLDEN_UPDATE", func(c *Config, v string) error { return parseBool(v, &c.Golden.Update) }},
+	{"MOCK_DESCRIPTORS_URL", func(c *Config, v string) error { c.Descriptors.URL = v; return nil }},
+	{"MOCK_DESCRIPTORS_TOKEN", func(c *Config, v string) error { c.Descriptors.Token = v; return nil }},
+}
+
+func (c *Config) applyEnv(lookup func(name string) (string, bool)) error {
+	for _, override := range envOverrides {
+		value, ok := lookup(override.name)
+		if !ok {
+			continue
+		}
+		if err := override.apply(c, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", override.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
+	if _, err := log.ParseLevel(c.Logging.Level); err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	if c.Store.Backend != storeBackendMemory {
+		return fmt.Errorf("unsupported store backend: %s", c.Store.Backend)
+	}
+	if c.Store.MaxStubs < 0 || c.Store.MaxStubsPerMethod < 0 {
+		return fmt.Errorf("the store limits can't be negative")
+	}
+	if err := stub.ValidateEviction(c.Store.Eviction); err != nil {
+		return err
+	}
+	if d, err := time.ParseDuration(c.Store.TrashRetention); err != nil || d < 0 {
+		return fmt.Errorf("invalid store trash retention: %s", c.Store.TrashRetention)
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("both the TLS certificate and key files must be set")
+	}
+	if delay := c.Interceptors.Delay; delay != "" {
+		if d, err := time.ParseDuration(delay); err != nil || d < 0 {
+			return fmt.Errorf("invalid interceptors delay: %s", delay)
+		}
+	}
+	for _, limit := range c.Interceptors.ConcurrencyLimits {
+		if err := limit.validate(); err != nil {
+			return err
+		}
+	}
+	for _, deprecation := range c.Deprecations {
+		if err := deprecation.deprecation().Validate(); err != nil {
+			return err
+		}
+	}
+	for _, alias := range c.Aliases {
+		if err := alias.alias().Validate(); err != nil {
+			return err
+		}
+	}
+	for _, breaker := range c.Interceptors.CircuitBreakers {
+		if err := breaker.validate(); err != nil {
+			return err
+		}
+	}
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
+	if c.GRPCAuth.Enabled {
+		if _, err := newGRPCAuth(c.GRPCAuth); err != nil {
+			return err
+		}
+	}
+	if _, err := c.JWT.keys(); err != nil {
+		return err
+	}
+	if err := c.Scripts.validate(); err != nil {
+		return err
+	}
+	if err := c.Contract.validate(); err != nil {
+		return err
+	}
+	if err := c.Journal.validate(); err != nil {
+		return err
+	}
+	if err := c.Discovery.validate(); err != nil {
+		return err
+	}
+	if err := c.Kubernetes.validate(); err != nil {
+		return err
+	}
+	if err := c.Shadow.validate(); err != nil {
+		return err
+	}
+	if err := c.Golden.validate(); err != nil {
+		return err
+	}
+	if err := c.Descriptors.validate(); err != nil {
+		return err
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		return fmt.Errorf("the TLS client CA file requires the TLS certificate and key files")
+	}
+	return nil
+}
+
+func parsePort(value string, port *uint) error {
+	parsed, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return err
+	}
+	*port = uint(parsed)
+	return nil
+}
+
+func parseInt(value string, i *int64) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = parsed
+	return nil
+}
+
+func parseBool(value string, b *bool) error {
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,117 @@
+package bootstrap
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config*.yaml")
+	assert.NoError(t, err)
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	config, err := loadConfig("/tmp", 1068, 10010, []Option{WithLogLevel("info")})
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp", config.TmpPath)
+	assert.Equal(t, uint(1068), config.RESTPort)
+	assert.Equal(t, uint(10010), config.GRPCPort)
+	assert.Equal(t, "memory", config.Store.Backend)
+	assert.Equal(t, "info", config.Logging.Level)
+}
+
+func TestLoadConfig_File(t *testing.T) {
+	file := writeConfigFile(t, `
+restPort: 8080
+stubsDir: ./stubs
+cors:
+  allowedOrigins: ["*"]
+logging:
+  level: warn
+  redactedFields:
+    - password
+`)
+	defer os.Remove(file)
+
+	config, err := loadConfig("/tmp", 1068, 10010, []Option{WithConfigFile(file), WithProfiling()})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(8080), config.RESTPort)
+	assert.Equal(t, uint(10010), config.GRPCPort)
+	assert.Equal(t, "./stubs", config.StubsDir)
+	assert.Equal(t, []string{"*"}, config.CORS.AllowedOrigins)
+	assert.Equal(t, "warn", config.Logging.Level)
+	assert.Equal(t, []string{"password"}, config.Logging.RedactedFields)
+	assert.True(t, config.Profiling)
+}
+
+func TestLoadConfig_JSONFile(t *testing.T) {
+	file := writeConfigFile(t, `{"grpcPort": 9000, "auth": {"token": "secret"}}`)
+	defer os.Remove(file)
+
+	config, err := loadConfig("/tmp", 1068, 10010, []Option{WithConfigFile(file)})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(9000), config.GRPCPort)
+	assert.Equal(t, "secret", config.Auth.Token)
+}
+
+func TestLoadConfig_InvalidFile(t *testing.T) {
+	file := writeConfigFile(t, `unknownSetting: true`)
+	defer os.Remove(file)
+
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{WithConfigFile(file)})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{WithConfigFile(file + ".missing")})
+	assert.Error(t, err)
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"MOCK_REST_PORT":            "9090",
+		"MOCK_LOG_DISABLE_PAYLOADS": "true",
+		"MOCK_CORS_ALLOWED_ORIGINS": "http://a.com, http://b.com",
+		"MOCK_STRICT":               "true",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	config := &Config{RESTPort: 1068}
+	assert.NoError(t, config.applyEnv(lookup))
+	assert.Equal(t, uint(9090), config.RESTPort)
+	assert.True(t, config.Logging.DisablePayloads)
+	assert.Equal(t, []string{"http://a.com", "http://b.com"}, config.CORS.AllowedOrigins)
+	assert.Equal(t, StrictConfig{Enabled: true}, config.Strict)
+
+	env["MOCK_GRPC_PORT"] = "not a port"
+	assert.Error(t, config.applyEnv(lookup))
+}
+
+func TestLoadConfig_Validation(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{WithLogLevel("loud")})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{WithTLS("cert.pem", "")})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{WithTLSClientCA("ca.pem")})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{WithMethodAlias("/acme.v2.Orders/*", "/acme.v1.Orders/Get")})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.Store.Backend = "redis" }})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{WithJournalDir("/tmp/journal"), func(config *Config) { config.Journal.Retention = "a week" }})
+	assert.Error(t, err)
+
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.Scripts.Timeout = "0s" }})
+	assert.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"time"
+)
+
+// ContractConfig sets the real service the stubs are verified against with POST /contract/verify
+type ContractConfig struct {
+	// Upstream is the address of the real service, e.g. orders.staging:443
+	Upstream string `yaml:"upstream"`
+	// TLS connects to the real service with TLS, verifying its certificate with the CAs of the system
+	TLS bool `yaml:"tls"`
+	// IgnoredFields are the paths of the fields that are not compared, e.g. response.content.updatedAt
+	IgnoredFields []string `yaml:"ignoredFields"`
+	// Timeout of each call to the real service, e.g. 5s. There is no timeout when empty.
+	Timeout string `yaml:"timeout"`
+}
+
+func (c ContractConfig) validate() error {
+	if c.Timeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(c.Timeout); err != nil || d < 0 {
+		return fmt.Errorf("invalid contract timeout: %s", c.Timeout)
+	}
+	return nil
+}
+
+func (c ContractConfig) options() grpchandler.ContractOptions {
+	timeout, _ := time.ParseDuration(c.Timeout)
+	return grpchandler.ContractOptions{IgnoredFields: c.IgnoredFields, Timeout: timeout}
+}
+
+func (c ContractConfig) dial(upstream string) (*grpc.ClientConn, error) {
+	return dialService(upstream, c.TLS)
+}
+
+// dialService connects to a real service, with TLS verifying its certificate with the CAs of the system
+func dialService(target string, useTLS bool) (*grpc.ClientConn, error) {
+	if useTLS {
+		return grpc.Dial(target, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	}
+	return grpc.Dial(target, grpc.WithInsecure())
+}
+
+func newContractController(config ContractConfig, service grpchandler.MockService, stubsStore stub.StubsStore) restcontrollers.ContractController {
+	return restcontrollers.ContractController{
+		Service:    service,
+		StubsStore: stubsStore,
+		Upstream:   config.Upstream,
+		Options:    config.options(),
+		Dial:       config.dial,
+	}
+}
@@ -0,0 +1,69 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DescriptorsConfig sets where the descriptors of the services are fetched from, so that the stubs are checked against
+// the current version of the APIs (see stub.Descriptors). They are fetched on start up and refreshed on demand with
+// POST /descriptors/refresh.
+type DescriptorsConfig struct {
+	// URL returns the FileDescriptorSet (with imports) of the services in binary, e.g. a Buf image built with
+	// buf build -o image.binpb. The descriptors are not fetched when empty.
+	URL string `yaml:"url"`
+	// Token is sent as bearer token to the URL, e.g. the token of a schema registry
+	Token string `yaml:"token"`
+}
+
+func (c DescriptorsConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	if u, err := url.ParseRequestURI(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid descriptors URL: %s", c.URL)
+	}
+	return nil
+}
+
+// fetch downloads the descriptor set from the URL
+func (c DescriptorsConfig) fetch(ctx context.Context) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Accept", "application/octet-stream")
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s failed with status %d: %s", c.URL, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// newDescriptors fetches the descriptors of the config. The stubs are not checked until the descriptors are refreshed
+// when they can't be fetched on start up.
+func newDescriptors(config DescriptorsConfig) *stub.Descriptors {
+	descriptors := stub.NewDescriptors(config.fetch)
+	if err := descriptors.Refresh(context.Background()); err != nil {
+		log.Warnf("Descriptors not loaded from %s: %s", config.URL, err.Error())
+	}
+	return descriptors
+}
@@ -0,0 +1,291 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service discovery backends supported
+const (
+	discoveryBackendConsul = "consul"
+	discoveryBackendEtcd   = "etcd"
+)
+
+// Interval of the health checks when not configured
+const defaultHealthCheckInterval = 10 * time.Second
+
+// DiscoveryConfig registers the gRPC endpoint of the mock in a service discovery system, so that the clients that
+// find their services there reach the mock without overriding their config
+type DiscoveryConfig struct {
+	// Backend is consul or etcd. The mock is not registered when empty.
+	Backend string `yaml:"backend"`
+	// Address is the URL of the HTTP API of the Consul agent or etcd, e.g. http://localhost:8500
+	Address string `yaml:"address"`
+	// ServiceNames are the names the mock is registered with, e.g. the ones of the services it replaces
+	ServiceNames []string `yaml:"serviceNames"`
+	// AdvertiseAddress is the host:port of the gRPC endpoint registered. The host name and the gRPC port (or the REST
+	// port in single port mode) are used when empty.
+	AdvertiseAddress string `yaml:"advertiseAddress"`
+	// HealthCheckInterval is how often Consul checks the gRPC health service of the mock, or the etcd lease of the
+	// registration is renewed (its TTL is 3 times the interval), e.g. 10s (the default)
+	HealthCheckInterval string `yaml:"healthCheckInterval"`
+}
+
+func (c DiscoveryConfig) validate() error {
+	switch c.Backend {
+	case "":
+		return nil
+	case discoveryBackendConsul, discoveryBackendEtcd:
+	default:
+		return fmt.Errorf("unsupported discovery backend: %s", c.Backend)
+	}
+	if c.Address == "" || len(c.ServiceNames) == 0 {
+		return fmt.Errorf("the discovery address and service names must be set")
+	}
+	if c.AdvertiseAddress != "" {
+		if _, _, err := net.SplitHostPort(c.AdvertiseAddress); err != nil {
+			return fmt.Errorf("invalid discovery advertise address: %s", c.AdvertiseAddress)
+		}
+	}
+	if c.HealthCheckInterval != "" {
+		if d, err := time.ParseDuration(c.HealthCheckInterval); err != nil || d < time.Second {
+			return fmt.Errorf("invalid discovery health check interval: %s", c.HealthCheckInterval)
+		}
+	}
+	return nil
+}
+
+func (c DiscoveryConfig) interval() time.Duration {
+	if interval, err := time.ParseDuration(c.HealthCheckInterval); err == nil {
+		return interval
+	}
+	return defaultHealthCheckInterval
+}
+
+// advertiseAddress is the address of the gRPC endpoint registered
+func (c DiscoveryConfig) advertiseAddress(port uint) string {
+	if c.AdvertiseAddress != "" {
+		return c.AdvertiseAddress
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+}
+
+func (c DiscoveryConfig) registry() serviceRegistry {
+	client := &http.Client{Timeout: 5 * time.Second}
+	address := strings.TrimSuffix(c.Address, "/")
+	if c.Backend == discoveryBackendEtcd {
+		return &etcdRegistry{address: address, client: client, ttl: 3 * c.interval()}
+	}
+	return &consulRegistry{address: address, client: client, interval: c.interval()}
+}
+
+// deregisterServices removes the registrations of the mock. It is nil when the mock is not registered.
+var deregisterServices func()
+
+// startServiceRegistration registers the gRPC endpoint of the mock when a discovery backend is configured
+func startServiceRegistration(config *Config) {
+	if config.Discovery.Backend == "" {
+		return
+	}
+	port := config.GRPCPort
+	if config.SinglePort {
+		port = config.RESTPort
+	}
+	deregisterServices = registerServices(config.Discovery, config.Discovery.advertiseAddress(port))
+}
+
+func stopServiceRegistration() {
+	if deregisterServices != nil {
+		log.Info("Removing the registrations in service discovery")
+		deregisterServices()
+		deregisterServices = nil
+	}
+}
+
+// serviceRegistry registers the endpoint of the mock with service names in a service discovery system
+type serviceRegistry interface {
+	register(name, endpoint string) error
+	// keepAlive renews the registrations. It fails when they were lost.
+	keepAlive() error
+	deregister(name, endpoint string) error
+}
+
+// registerServices registers the endpoint with the service names of the config and keeps the registrations alive,
+// retrying until the discovery system is reachable. It returns the function that removes the registrations.
+func registerServices(config DiscoveryConfig, endpoint string) func() {
+	registry := config.registry()
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		registered := false
+		for {
+			var err error
+			if registered {
+				err = registry.keepAlive()
+			} else {
+				for _, name := range config.ServiceNames {
+					if err = registry.register(name, endpoint); err != nil {
+						break
+					}
+				}
+				if err == nil {
+					log.Infof("Registered %s as %s in %s", endpoint, strings.Join(config.ServiceNames, ", "), config.Backend)
+				}
+			}
+			if err != nil {
+				log.Warnf("Failed to register %s in %s, retrying: %s", endpoint, config.Backend, err.Error())
+			}
+			registered = err == nil
+			select {
+			case <-stop:
+				return
+			case <-time.After(config.interval()):
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		for _, name := range config.ServiceNames {
+			if err := registry.deregister(name, endpoint); err != nil {
+				log.Warnf("Failed to deregister %s from %s: %s", name, config.Backend, err.Error())
+			}
+		}
+	}
+}
+
+// consulRegistry registers the services in the Consul agent, which checks them with the gRPC health service
+type consulRegistry struct {
+	address  string
+	client   *http.Client
+	interval time.Duration
+}
+
+func (r *consulRegistry) register(name, endpoint string) error {
+	host, port, _ := net.SplitHostPort(endpoint)
+	portNumber, _ := strconv.Atoi(port)
+	registration := map[string]interface{}{
+		"ID":      consulServiceID(name, endpoint),
+		"Name":    name,
+		"Address": host,
+		"Port":    portNumber,
+		"Tags":    []string{"mock"},
+		"Check": map[string]interface{}{
+			"GRPC":                           endpoint,
+			"Interval":                       r.interval.String(),
+			"DeregisterCriticalServiceAfter": (10 * r.interval).String(),
+		},
+	}
+	return callRegistry(r.client, http.MethodPut, r.address+"/v1/agent/service/register", registration, nil)
+}
+
+func (r *consulRegistry) keepAlive() error {
+	return nil
+}
+
+func (r *consulRegistry) deregister(name, endpoint string) error {
+	return callRegistry(r.client, http.MethodPut, r.address+"/v1/agent/service/deregister/"+consulServiceID(name, endpoint), nil, nil)
+}
+
+func consulServiceID(name, endpoint string) string {
+	return name + "-" + endpoint
+}
+
+// etcdRegistry registers the services in etcd, through its JSON API, with the keys <service name>/<endpoint> that the
+// etcd naming resolvers watch. The keys are attached to a lease, so that they are removed when the mock stops renewing
+// it.
+type etcdRegistry struct {
+	address string
+	client  *http.Client
+	ttl     time.Duration
+	leaseID string
+}
+
+func (r *etcdRegistry) register(name, endpoint string) error {
+	if r.leaseID == "" {
+		lease := struct {
+			ID string `json:"ID"`
+		}{}
+		ttl := map[string]interface{}{"TTL": int64(r.ttl / time.Second)}
+		if err := callRegistry(r.client, http.MethodPost, r.address+"/v3/lease/grant", ttl, &lease); err != nil {
+			return err
+		}
+		r.leaseID = lease.ID
+	}
+	value, _ := json.Marshal(map[string]string{"Addr": endpoint})
+	put := map[string]interface{}{
+		"key":   etcdKey(name, endpoint),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": r.leaseID,
+	}
+	return callRegistry(r.client, http.MethodPost, r.address+"/v3/kv/put", put, nil)
+}
+
+func (r *etcdRegistry) keepAlive() error {
+	renewed := struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}{}
+	err := callRegistry(r.client, http.MethodPost, r.address+"/v3/lease/keepalive", map[string]string{"ID": r.leaseID}, &renewed)
+	if err == nil && (renewed.Result.TTL == "" || renewed.Result.TTL == "0") {
+		err = fmt.Errorf("lease %s expired", r.leaseID)
+	}
+	if err != nil {
+		r.leaseID = ""
+	}
+	return err
+}
+
+func (r *etcdRegistry) deregister(name, endpoint string) error {
+	return callRegistry(r.client, http.MethodPost, r.address+"/v3/kv/deleterange", map[string]string{"key": etcdKey(name, endpoint)}, nil)
+}
+
+func etcdKey(name, endpoint string) string {
+	return base64.StdEncoding.EncodeToString([]byte(name + "/" + endpoint))
+}
+
+// callRegistry sends the body in JSON to the HTTP API of the discovery system and decodes the response into result,
+// when not nil
+func callRegistry(client *http.Client, method, url string, body interface{}, result interface{}) error {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	responseData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s failed with status %d: %s", method, url, response.StatusCode, strings.TrimSpace(string(responseData)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(responseData, result)
+}
@@ -0,0 +1,104 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// registryServer records the calls to the HTTP API of a discovery system
+type registryServer struct {
+	mutex sync.Mutex
+	calls []string
+	// bodies are the bodies of the calls by path
+	bodies map[string]map[string]interface{}
+}
+
+func newRegistryServer() (*registryServer, *httptest.Server) {
+	registry := &registryServer{bodies: make(map[string]map[string]interface{})}
+	return registry, httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, _ := ioutil.ReadAll(request.Body)
+		body := make(map[string]interface{})
+		json.Unmarshal(data, &body)
+		registry.mutex.Lock()
+		registry.calls = append(registry.calls, request.Method+" "+request.URL.Path)
+		registry.bodies[request.URL.Path] = body
+		registry.mutex.Unlock()
+		switch request.URL.Path {
+		case "/v3/lease/grant":
+			writer.Write([]byte(`{"ID":"7587","TTL":"30"}`))
+		case "/v3/lease/keepalive":
+			writer.Write([]byte(`{"result":{"ID":"7587","TTL":"30"}}`))
+		default:
+			writer.Write([]byte(`{}`))
+		}
+	}))
+}
+
+func (r *registryServer) getCalls() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func TestRegisterServices_Consul(t *testing.T) {
+	registry, server := newRegistryServer()
+	defer server.Close()
+	config := DiscoveryConfig{Backend: discoveryBackendConsul, Address: server.URL, ServiceNames: []string{"orders"}, HealthCheckInterval: "1s"}
+	assert.NoError(t, config.validate())
+
+	deregister := registerServices(config, "mock.local:10010")
+	time.Sleep(100 * time.Millisecond)
+	deregister()
+
+	assert.Equal(t, []string{
+		"PUT /v1/agent/service/register",
+		"PUT /v1/agent/service/deregister/orders-mock.local:10010",
+	}, registry.getCalls())
+	registration := registry.bodies["/v1/agent/service/register"]
+	assert.Equal(t, "orders", registration["Name"])
+	assert.Equal(t, "mock.local", registration["Address"])
+	assert.Equal(t, float64(10010), registration["Port"])
+	assert.Equal(t, "mock.local:10010", registration["Check"].(map[string]interface{})["GRPC"])
+}
+
+func TestRegisterServices_Etcd(t *testing.T) {
+	registry, server := newRegistryServer()
+	defer server.Close()
+	config := DiscoveryConfig{Backend: discoveryBackendEtcd, Address: server.URL, ServiceNames: []string{"orders", "customers"}, HealthCheckInterval: "1s"}
+
+	deregister := registerServices(config, "mock.local:10010")
+	time.Sleep(1500 * time.Millisecond)
+	deregister()
+
+	assert.Equal(t, []string{
+		"POST /v3/lease/grant",
+		"POST /v3/kv/put",
+		"POST /v3/kv/put",
+		"POST /v3/lease/keepalive",
+		"POST /v3/kv/deleterange",
+		"POST /v3/kv/deleterange",
+	}, registry.getCalls())
+	assert.Equal(t, float64(3), registry.bodies["/v3/lease/grant"]["TTL"])
+	put := registry.bodies["/v3/kv/put"]
+	key, _ := base64.StdEncoding.DecodeString(put["key"].(string))
+	value, _ := base64.StdEncoding.DecodeString(put["value"].(string))
+	assert.Equal(t, "customers/mock.local:10010", string(key))
+	assert.JSONEq(t, `{"Addr":"mock.local:10010"}`, string(value))
+	assert.Equal(t, "7587", put["lease"])
+}
+
+func TestDiscoveryConfig_Validate(t *testing.T) {
+	assert.NoError(t, DiscoveryConfig{}.validate())
+	assert.EqualError(t, DiscoveryConfig{Backend: "zookeeper"}.validate(), "unsupported discovery backend: zookeeper")
+	assert.EqualError(t, DiscoveryConfig{Backend: discoveryBackendEtcd, Address: "http://localhost:2379"}.validate(),
+		"the discovery address and service names must be set")
+	assert.EqualError(t, DiscoveryConfig{Backend: discoveryBackendConsul, Address: "http://localhost:8500", ServiceNames: []string{"orders"},
+		AdvertiseAddress: "mock"}.validate(), "invalid discovery advertise address: mock")
+}
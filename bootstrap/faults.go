@@ -0,0 +1,358 @@
+package bootstrap
+
+import (
+	"errors"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Time given to the calls in progress to finish after a GOAWAY is sent. The connections are closed after it.
+const goAwayGracePeriod = 10 * time.Second
+
+// Number of writes per second of the connections throttled, the data is written in chunks of a fraction of the
+// bandwidth
+const throttledWritesPerSecond = 10
+
+var (
+	errListenerSessionClosed = errors.New("listener session closed")
+	errListenerClosed        = errors.New("listener closed")
+	errConnectionStalled     = errors.New("connection stalled")
+)
+
+// connectionFaults injects faults in the connections to the gRPC server to test the reconnection logic of the
+// clients. It implements restcontrollers.FaultInjector.
+type connectionFaults struct {
+	mutex  sync.Mutex
+	faults restcontrollers.ConnectionFaults
+	conns  map[*faultConn]bool
+	random util.Random
+	// Set to 1 while the connections are stalled. It is read on every write.
+	stalled int32
+	// The connectionThrottle of the writes, also read on every write
+	throttle atomic.Value
+	// goAway replaces the gRPC server, sending GOAWAY to the connections of the current one. It is nil when the
+	// gRPC server doesn't serve on a faultListener. Guarded by mutex, as it is set while the REST API may be serving.
+	goAway func()
+}
+
+func newConnectionFaults(random util.Random) *connectionFaults {
+	f := &connectionFaults{
+		conns:  make(map[*faultConn]bool, 0),
+		random: random,
+	}
+	f.throttle.Store(connectionThrottle{})
+	return f
+}
+
+// connectionThrottle limits the bytes sent per second on each connection
+type connectionThrottle struct {
+	// bandwidth is the number of bytes per second, not limited when 0
+	bandwidth float64
+	// slowStart is the time after which the new connections get the whole bandwidth
+	slowStart time.Duration
+}
+
+// bandwidthAt returns the bandwidth of a connection open for the duration given, which grows linearly from a tenth of
+// the bandwidth during the slow start
+func (t connectionThrottle) bandwidthAt(age time.Duration) float64 {
+	if t.slowStart <= 0 || age >= t.slowStart {
+		return t.bandwidth
+	}
+	return t.bandwidth * (0.1 + 0.9*float64(age)/float64(t.slowStart))
+}
+
+func (f *connectionFaults) GetFaults() restcontrollers.FaultsStatus {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return restcontrollers.FaultsStatus{ConnectionFaults: f.faults, Connections: len(f.conns)}
+}
+
+// SetFaults replaces the faults injected. The connections stalled are closed when they stop being stalled, as the
+// data discarded left them unusable. When the max idle time or age of the connections change, the gRPC server is
+// replaced (see GoAway) by one that applies them.
+func (f *connectionFaults) SetFaults(faults restcontrollers.ConnectionFaults) {
+	f.mutex.Lock()
+	wasStalled := f.faults.StallConnections
+	keepaliveChanged := faults.MaxConnectionIdle != f.faults.MaxConnectionIdle || faults.MaxConnectionAge != f.faults.MaxConnectionAge
+	f.faults = faults
+	stalled := make([]*faultConn, 0)
+	if wasStalled && !faults.StallConnections {
+		for conn := range f.conns {
+			if conn.isDiscarding() {
+				stalled = append(stalled, conn)
+			}
+		}
+	}
+	atomic.StoreInt32(&f.stalled, boolToInt32(faults.StallConnections))
+	throttle := connectionThrottle{}
+	if faults.Bandwidth != "" {
+		throttle.bandwidth, _ = restcontrollers.ParseBandwidth(faults.Bandwidth)
+		throttle.slowStart, _ = time.ParseDuration(faults.SlowStart)
+	}
+	f.throttle.Store(throttle)
+	goAway := f.goAway
+	f.mutex.Unlock()
+
+	for _, conn := range stalled {
+		conn.Close()
+	}
+	if keepaliveChanged && goAway != nil {
+		goAway()
+	}
+}
+
+// keepaliveOptions returns the options of the gRPC server that send GOAWAY to the connections without calls for the
+// max idle time and to the ones open for the max age, letting their calls in progress finish within the grace period.
+// It must be called holding f.mutex.
+func (f *connectionFaults) keepaliveOptions() []grpc.ServerOption {
+	maxIdle, _ := time.ParseDuration(f.faults.MaxConnectionIdle)
+	maxAge, _ := time.ParseDuration(f.faults.MaxConnectionAge)
+	if maxIdle <= 0 && maxAge <= 0 {
+		return nil
+	}
+	return []grpc.ServerOption{grpc.KeepaliveParams(keepalive.ServerParameters{
+		MaxConnectionIdle:     maxIdle,
+		MaxConnectionAge:      maxAge,
+		MaxConnectionAgeGrace: goAwayGracePeriod,
+	})}
+}
+
+func (f *connectionFaults) GoAway() error {
+	f.mutex.Lock()
+	goAway := f.goAway
+	f.mutex.Unlock()
+
+	if goAway == nil {
+		return fmt.Errorf("GOAWAY is not supported by the server")
+	}
+	goAway()
+	return nil
+}
+
+// enableGoAway sends the GOAWAYs by replacing the gRPC server serving on the listener given with a new one, created
+// with the keepalive options of the faults current when it is replaced
+func (f *connectionFaults) enableGoAway(listener *faultListener, newServer func(options ...grpc.ServerOption) *grpc.Server) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.goAway = func() {
+		goAway(listener, func() *grpc.Server {
+			f.mutex.Lock()
+			options := f.keepaliveOptions()
+			f.mutex.Unlock()
+			return newServer(options...)
+		})
+	}
+}
+
+// accept decides if a new connection is dropped, in which case nil is returned, and tracks the ones accepted
+func (f *connectionFaults) accept(conn net.Conn) net.Conn {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.faults.DropConnectionsPercent > 0 && f.random.Intn(100) < f.faults.DropConnectionsPercent {
+		return nil
+	}
+	c := &faultConn{Conn: conn, faults: f, openedAt: time.Now()}
+	f.conns[c] = true
+	return c
+}
+
+func (f *connectionFaults) remove(conn *faultConn) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.conns, conn)
+}
+
+func (f *connectionFaults) isStalled() bool {
+	return atomic.LoadInt32(&f.stalled) == 1
+}
+
+func (f *connectionFaults) getThrottle() connectionThrottle {
+	return f.throttle.Load().(connectionThrottle)
+}
+
+// faultConn discards the data written while the connections are stalled, so that the server seems unresponsive to
+// the clients (e.g. their keepalive pings time out), and throttles the data written when the bandwidth is limited
+type faultConn struct {
+	net.Conn
+	faults   *connectionFaults
+	openedAt time.Time
+	// Set to 1 once data is discarded
+	discarding int32
+	closeOnce  sync.Once
+	// nextWrite is when the next chunk of data can be written without exceeding the bandwidth
+	nextWrite  time.Time
+	writeMutex sync.Mutex
+}
+
+func (c *faultConn) Write(b []byte) (int, error) {
+	if c.faults.isStalled() {
+		atomic.StoreInt32(&c.discarding, 1)
+		return len(b), nil
+	}
+	if c.isDiscarding() {
+		return 0, errConnectionStalled
+	}
+	return c.throttledWrite(b)
+}
+
+// throttledWrite writes the data in chunks spaced so that the bandwidth is not exceeded. The bandwidth is read for
+// every chunk, so that the changes apply to the writes in progress.
+func (c *faultConn) throttledWrite(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	written := 0
+	for written < len(b) {
+		bandwidth := c.faults.getThrottle().bandwidthAt(time.Since(c.openedAt))
+		if bandwidth <= 0 {
+			n, err := c.Conn.Write(b[written:])
+			return written + n, err
+		}
+		chunk := b[written:]
+		if size := int(bandwidth/throttledWritesPerSecond) + 1; len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		now := time.Now()
+		if c.nextWrite.Before(now) {
+			c.nextWrite = now
+		}
+		time.Sleep(c.nextWrite.Sub(now))
+		c.nextWrite = c.nextWrite.Add(time.Duration(float64(len(chunk)) / bandwidth * float64(time.Second)))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *faultConn) isDiscarding() bool {
+	return atomic.LoadInt32(&c.discarding) == 1
+}
+
+func (c *faultConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.faults.remove(c)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// faultListener drops the new connections as configured in the faults and hands the other ones to the gRPC server
+// currently serving, so that the server can be replaced without closing the listener.
+type faultListener struct {
+	net.Listener
+	faults *connectionFaults
+	conns  chan net.Conn
+}
+
+func newFaultListener(listener net.Listener, faults *connectionFaults) *faultListener {
+	l := &faultListener{
+		Listener: listener,
+		faults:   faults,
+		conns:    make(chan net.Conn),
+	}
+	go l.acceptConnections()
+	return l
+}
+
+func (l *faultListener) acceptConnections() {
+	defer close(l.conns)
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		accepted := l.faults.accept(conn)
+		if accepted == nil {
+			log.Debugf("Dropping connection from %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		l.conns <- accepted
+	}
+}
+
+// session creates a listener for a gRPC server. Closing it stops the server accepting connections but doesn't close
+// the underlying listener.
+func (l *faultListener) session() net.Listener {
+	return &listenerSession{
+		faultListener: l,
+		closed:        make(chan struct{}),
+	}
+}
+
+type listenerSession struct {
+	*faultListener
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *listenerSession) Accept() (net.Conn, error) {
+	select {
+	case <-s.closed:
+		return nil, errListenerSessionClosed
+	case conn, ok := <-s.conns:
+		if !ok {
+			return nil, errListenerClosed
+		}
+		return conn, nil
+	}
+}
+
+func (s *listenerSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+// goAway replaces the gRPC server with a new one serving on the same listener. The old server sends GOAWAY to its
+// connections so that the clients reconnect, and closes them once the calls in progress finish or after the grace
+// period.
+func goAway(listener *faultListener, newServer func() *grpc.Server) {
+	serverMutex.Lock()
+	old := server
+	server = newServer()
+	go serv(server, listener.session())
+	serverMutex.Unlock()
+
+	log.Info("Sending GOAWAY to the gRPC connections")
+	stopped := make(chan struct{})
+	go func() {
+		old.GracefulStop()
+		close(stopped)
+	}()
+	go func() {
+		select {
+		case <-stopped:
+		case <-time.After(goAwayGracePeriod):
+			old.Stop()
+		}
+	}()
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
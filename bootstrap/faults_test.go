@@ -0,0 +1,319 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func startFaultsServer(t *testing.T) (*connectionFaults, string, func()) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello\"}"},
+	})
+	newServer := func(options ...grpc.ServerOption) *grpc.Server {
+		s := grpc.NewServer(options...)
+		s.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+		s.RegisterService(&slowServiceDesc, nil)
+		return s
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	faults := newConnectionFaults(util.NewSeededRandom(0))
+	faultListener := newFaultListener(l, faults)
+	faults.enableGoAway(faultListener, newServer)
+	server = newServer()
+	go serv(server, faultListener.session())
+	return faults, l.Addr().String(), func() {
+		server.Stop()
+		l.Close()
+	}
+}
+
+// Duration of the calls to the slowServiceDesc
+const slowCallDuration = 500 * time.Millisecond
+
+// slowServiceDesc has a unary method and a server streaming method that take a while, to check that the calls in
+// progress finish when the connections are closed
+var slowServiceDesc = grpc.ServiceDesc{
+	ServiceName: "faults.Slow",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Wait",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(structpb.Struct)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				time.Sleep(slowCallDuration)
+				return in, nil
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				in := new(structpb.Struct)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				for i := 0; i < 5; i++ {
+					time.Sleep(slowCallDuration / 5)
+					if err := stream.SendMsg(in); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func invokeHello(conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct))
+}
+
+func TestConnectionFaults_GoAway(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, invokeHello(conn))
+	old := server
+
+	assert.NoError(t, faults.GoAway())
+	assert.False(t, old == server)
+	// The client reconnects to the new server, waiting longer than its reconnection backoff
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.WaitForReady(true)))
+}
+
+func TestConnectionFaults_DropConnections(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	faults.SetFaults(restcontrollers.ConnectionFaults{DropConnectionsPercent: 100})
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Error(t, invokeHello(conn))
+	assert.Equal(t, 0, faults.GetFaults().Connections)
+
+	faults.SetFaults(restcontrollers.ConnectionFaults{})
+	conn2, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn2.Close()
+	assert.NoError(t, invokeHello(conn2))
+}
+
+func TestConnectionFaults_StallConnections(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, invokeHello(conn))
+
+	faults.SetFaults(restcontrollers.ConnectionFaults{StallConnections: true})
+	assert.Error(t, invokeHello(conn))
+
+	// The stalled connection is closed and the client reconnects, waiting longer than its reconnection backoff
+	faults.SetFaults(restcontrollers.ConnectionFaults{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn.WaitForStateChange(ctx, connectivity.Ready)
+	assert.NoError(t, conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.WaitForReady(true)))
+}
+
+// openConnections returns the connections open
+func openConnections(faults *connectionFaults) []*faultConn {
+	faults.mutex.Lock()
+	defer faults.mutex.Unlock()
+
+	conns := make([]*faultConn, 0, len(faults.conns))
+	for conn := range faults.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func isOpen(faults *connectionFaults, conn *faultConn) bool {
+	faults.mutex.Lock()
+	defer faults.mutex.Unlock()
+
+	return faults.conns[conn]
+}
+
+func TestConnectionFaults_MaxConnectionAge(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	faults.SetFaults(restcontrollers.ConnectionFaults{MaxConnectionAge: "100ms"})
+	defer faults.SetFaults(restcontrollers.ConnectionFaults{})
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, invokeHello(conn))
+	opened := openConnections(faults)
+	assert.Equal(t, 1, len(opened))
+	time.Sleep(300 * time.Millisecond)
+	assert.False(t, isOpen(faults, opened[0]))
+	// The client reconnects
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.WaitForReady(true)))
+}
+
+func TestConnectionFaults_MaxConnectionAge_CallsInProgress(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	faults.SetFaults(restcontrollers.ConnectionFaults{MaxConnectionAge: "100ms"})
+	defer faults.SetFaults(restcontrollers.ConnectionFaults{})
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/faults.Slow/Watch")
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(&structpb.Struct{}))
+	assert.NoError(t, stream.CloseSend())
+	opened := openConnections(faults)
+	assert.Equal(t, 1, len(opened))
+
+	// The connection reaches its max age during the unary call and while the stream is open, which both finish
+	assert.NoError(t, conn.Invoke(ctx, "/faults.Slow/Wait", &structpb.Struct{}, new(structpb.Struct)))
+	received := 0
+	for {
+		err := stream.RecvMsg(new(structpb.Struct))
+		if err == io.EOF || !assert.NoError(t, err) {
+			break
+		}
+		received++
+	}
+	assert.Equal(t, 5, received)
+	assert.Eventually(t, func() bool { return !isOpen(faults, opened[0]) }, time.Second, 10*time.Millisecond)
+}
+
+func TestConnectionFaults_SetFaults_ReplacesServer(t *testing.T) {
+	faults, _, stop := startFaultsServer(t)
+	defer stop()
+	old := server
+
+	faults.SetFaults(restcontrollers.ConnectionFaults{DropConnectionsPercent: 10})
+	assert.True(t, old == server)
+	faults.SetFaults(restcontrollers.ConnectionFaults{DropConnectionsPercent: 10, MaxConnectionIdle: "30s"})
+	assert.False(t, old == server)
+	assert.Len(t, faults.keepaliveOptions(), 1)
+	faults.SetFaults(restcontrollers.ConnectionFaults{})
+	assert.Empty(t, faults.keepaliveOptions())
+}
+
+func TestConnectionFaults_MaxConnectionIdle(t *testing.T) {
+	faults, addr, stop := startFaultsServer(t)
+	defer stop()
+	faults.SetFaults(restcontrollers.ConnectionFaults{MaxConnectionIdle: "200ms"})
+	defer faults.SetFaults(restcontrollers.ConnectionFaults{})
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, invokeHello(conn))
+		time.Sleep(50 * time.Millisecond)
+	}
+	opened := openConnections(faults)
+	assert.Equal(t, 1, len(opened))
+	time.Sleep(400 * time.Millisecond)
+	assert.False(t, isOpen(faults, opened[0]))
+}
+
+func TestConnectionFaults_Validate(t *testing.T) {
+	assert.NoError(t, restcontrollers.ConnectionFaults{MaxConnectionIdle: "30s", MaxConnectionAge: "1m"}.Validate())
+	assert.EqualError(t, restcontrollers.ConnectionFaults{MaxConnectionAge: "0s"}.Validate(),
+		"maxConnectionAge must be a positive duration, e.g. 30s")
+	assert.EqualError(t, restcontrollers.ConnectionFaults{DropConnectionsPercent: 101}.Validate(),
+		"dropConnectionsPercent must be between 0 and 100")
+	assert.NoError(t, restcontrollers.ConnectionFaults{Bandwidth: "10KB/s", SlowStart: "5s"}.Validate())
+	assert.EqualError(t, restcontrollers.ConnectionFaults{SlowStart: "5s"}.Validate(), "slowStart requires a bandwidth")
+}
+
+func TestConnectionFaults_Bandwidth(t *testing.T) {
+	faults := newConnectionFaults(util.NewSeededRandom(0))
+	faults.SetFaults(restcontrollers.ConnectionFaults{Bandwidth: "10KB/s"})
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := faults.accept(server)
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, client)
+
+	// 3 chunks of 1025 bytes, the last one sent 200ms after the first one
+	start := time.Now()
+	n, err := conn.Write(make([]byte, 3000))
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, n)
+	assert.True(t, time.Since(start) >= 190*time.Millisecond)
+
+	faults.SetFaults(restcontrollers.ConnectionFaults{})
+	start = time.Now()
+	_, err = conn.Write(make([]byte, 3000))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+}
+
+func TestConnectionThrottle_BandwidthAt(t *testing.T) {
+	throttle := connectionThrottle{bandwidth: 1000, slowStart: 10 * time.Second}
+	assert.Equal(t, 100.0, throttle.bandwidthAt(0))
+	assert.Equal(t, 550.0, throttle.bandwidthAt(5*time.Second))
+	assert.Equal(t, 1000.0, throttle.bandwidthAt(time.Minute))
+	assert.Equal(t, 1000.0, connectionThrottle{bandwidth: 1000}.bandwidthAt(0))
+}
+
+func TestParseBandwidth(t *testing.T) {
+	bandwidth, err := restcontrollers.ParseBandwidth("10KB/s")
+	assert.NoError(t, err)
+	assert.Equal(t, 10240.0, bandwidth)
+	bandwidth, err = restcontrollers.ParseBandwidth("1.5MB/s")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5*1024*1024, bandwidth)
+	_, err = restcontrollers.ParseBandwidth("10Kbps")
+	assert.EqualError(t, err, "invalid bandwidth '10Kbps', e.g. 10KB/s")
+}
+
+func TestConnectionFaults_GoAwayWhileEnabling(t *testing.T) {
+	faults := newConnectionFaults(util.NewSeededRandom(0))
+	assert.Error(t, faults.GoAway())
+
+	sent := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for faults.GoAway() != nil {
+		}
+	}()
+	faults.mutex.Lock()
+	faults.goAway = func() { sent <- struct{}{} }
+	faults.mutex.Unlock()
+	<-done
+	assert.Len(t, sent, 1)
+}
@@ -0,0 +1,32 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+)
+
+// GoldenConfig keeps the responses served by the stubs in golden files and checks the responses of the following runs
+// against them (see grpchandler.GoldenFiles)
+type GoldenConfig struct {
+	// Dir is the directory of the golden files. The responses are not checked when empty.
+	Dir string `yaml:"dir"`
+	// Update rewrites the golden files with the responses served instead of checking them
+	Update bool `yaml:"update"`
+}
+
+func (c GoldenConfig) validate() error {
+	if c.Update && c.Dir == "" {
+		return fmt.Errorf("the golden files update mode requires the golden files dir")
+	}
+	return nil
+}
+
+func setupGoldenFiles(config *Config) {
+	if err := grpchandler.GetGoldenFiles().Configure(config.Golden.Dir, config.Golden.Update); err != nil {
+		log.Fatalf("Invalid golden files dir %s: %v", config.Golden.Dir, err)
+	}
+	if config.Golden.Dir != "" {
+		log.Infof("Checking the responses against the golden files in %s", config.Golden.Dir)
+	}
+}
@@ -1,16 +1,24 @@
 package bootstrap
 
 import (
+	longrunning "cloud.google.com/go/longrunning/autogen/longrunningpb"
 	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	channelzservice "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"net"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 )
 
@@ -18,31 +26,75 @@ import (
 var server *grpc.Server
 var listener net.Listener
 
+// Guards server, which is replaced when a GOAWAY is sent
+var serverMutex sync.Mutex
+
+// Set to 1 while the gRPC server is accepting connections
+var grpcServing int32
+
 // Start the server for the previously registered services
 func StarGRPCServer(port uint, service grpchandler.MockService) {
+	config := &Config{GRPCPort: port}
+	startGRPCServer(config, newInterceptorSettings(config), service, newConnectionFaults(util.NewSeededRandom(0)))
+}
 
-	server = grpc.NewServer()
-	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
-	reflection.Register(server)
+func startGRPCServer(config *Config, interceptors *interceptorSettings, service grpchandler.MockService, faults *connectionFaults) {
+	serveGRPC(config, interceptors, service, faults)
+	AwaitTermination(func() {
+		log.Warn("Shutting down the server")
+	})
+}
 
-	service.Register(server)
+// serveGRPC starts serving the gRPC mock on the gRPC port. The faults are ready to be injected when it returns.
+func serveGRPC(config *Config, interceptors *interceptorSettings, service grpchandler.MockService, faults *connectionFaults) {
+	serverOptions := interceptorOptions(config, interceptors)
+	if config.TLS.Enabled() {
+		tlsConfig, err := config.TLS.serverConfig()
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	newServer := func(options ...grpc.ServerOption) *grpc.Server {
+		return newGRPCServer(service, append(append([]grpc.ServerOption(nil), serverOptions...), options...)...)
+	}
+	server = newServer()
 
 	var err error
-	addr := fmt.Sprintf("0.0.0.0:%d", port)
+	addr := fmt.Sprintf("0.0.0.0:%d", config.GRPCPort)
 	listener, err = net.Listen("tcp", addr)
 
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
-	log.Infof("gRPC Server listening on port: %d", port)
-	go serv(listener)
+	log.Infof("gRPC Server listening on port: %d", config.GRPCPort)
+	faultListener := newFaultListener(listener, faults)
+	faults.enableGoAway(faultListener, newServer)
+	atomic.StoreInt32(&grpcServing, 1)
+	go serv(server, faultListener.session())
+}
 
-	if err != nil {
-		log.Fatalf("GRPC server failed to start %+v", err)
+func newGRPCServer(service grpchandler.MockService, options ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(append(options, grpc.CustomCodec(grpchandler.Codec{}))...)
+	grpc_health_v1.RegisterHealthServer(s, health.NewServer())
+	reflection.Register(s)
+	channelzservice.RegisterChannelzServiceToServer(s)
+	service.Register(s)
+	if !servesOperations(service) {
+		longrunning.RegisterOperationsServer(s, grpchandler.OperationsService{Operations: stub.GetOperations()})
 	}
-	AwaitTermination(func() {
-		log.Warn("Shutting down the server")
-	})
+	return s
+}
+
+// servesOperations checks if the google.longrunning.Operations service is mocked, in which case the operations
+// started by the stubs are not served
+func servesOperations(service grpchandler.MockService) bool {
+	for _, method := range service.GetSupportedMethods() {
+		if strings.HasPrefix(method, grpchandler.OperationsMethodPrefix) {
+			return true
+		}
+	}
+	return false
 }
 
 func AwaitTermination(shutdownHook func()) {
@@ -56,15 +108,25 @@ func AwaitTermination(shutdownHook func()) {
 }
 
 func cleanup() {
+	atomic.StoreInt32(&grpcServing, 0)
+	stopServiceRegistration()
 	log.Info("Stopping the server")
+	serverMutex.Lock()
 	server.GracefulStop()
+	serverMutex.Unlock()
 	log.Info("Closing the listener")
 	listener.Close()
 	log.Info("End of Program")
 }
 
-func serv(listener net.Listener) {
+func serv(server *grpc.Server, listener net.Listener) {
 	if err := server.Serve(listener); err != nil {
+		atomic.StoreInt32(&grpcServing, 0)
 		log.Errorf("failed to serve: %v", err)
 	}
 }
+
+// isGRPCServing checks if the gRPC server is accepting connections
+func isGRPCServing() bool {
+	return atomic.LoadInt32(&grpcServing) == 1
+}
@@ -0,0 +1,250 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InterceptorsConfig enables the built-in interceptors of the gRPC server. They run after the authentication (see
+// GRPCAuthConfig) and before the interceptors provided with WithUnaryInterceptors and WithStreamInterceptors. They are
+// reconfigured when the configuration is reloaded.
+type InterceptorsConfig struct {
+	// MetadataEcho sends the metadata received in each call back to the client as headers
+	MetadataEcho bool `yaml:"metadataEcho"`
+	// PropagatedMetadata are the metadata keys, e.g. x-request-id or traceparent, sent back to the client as headers in
+	// each call. They are all sent when MetadataEcho is enabled.
+	PropagatedMetadata []string `yaml:"propagatedMetadata"`
+	// Delay is added to every call, e.g. 100ms
+	Delay string `yaml:"delay"`
+	// ConcurrencyLimits cap the calls in flight to some methods
+	ConcurrencyLimits []ConcurrencyLimitConfig `yaml:"concurrencyLimits"`
+	// CircuitBreakers make some methods fail for a while after repeated failures
+	CircuitBreakers []CircuitBreakerConfig `yaml:"circuitBreakers"`
+}
+
+// Metadata that is not echoed as it describes the call itself
+var notEchoedMetadata = map[string]bool{
+	"content-type": true,
+	"user-agent":   true,
+	"te":           true,
+}
+
+// WithUnaryInterceptors adds interceptors to the unary calls of the gRPC server, called in the order given
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(config *Config) {
+		config.unaryInterceptors = append(config.unaryInterceptors, interceptors...)
+	}
+}
+
+// WithStreamInterceptors adds interceptors to the streaming calls of the gRPC server, called in the order given
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(config *Config) {
+		config.streamInterceptors = append(config.streamInterceptors, interceptors...)
+	}
+}
+
+// interceptorOptions chains the built-in interceptors enabled and the ones provided. The interceptors configured in
+// InterceptorsConfig are read from the settings on every call, so that they can be changed at runtime.
+func interceptorOptions(config *Config, settings *interceptorSettings) []grpc.ServerOption {
+	unary := []grpc.UnaryServerInterceptor{summaryUnaryInterceptor}
+	stream := []grpc.StreamServerInterceptor{summaryStreamInterceptor}
+	if config.GRPCAuth.Enabled {
+		auth, err := newGRPCAuth(config.GRPCAuth)
+		if err != nil {
+			log.Fatalf("Invalid gRPC authentication settings: %v", err)
+		}
+		unary = append(unary, auth.unaryInterceptor)
+		stream = append(stream, auth.streamInterceptor)
+	}
+	unary = append(unary, settings.unaryInterceptor)
+	stream = append(stream, settings.streamInterceptor)
+	unary = append(unary, config.unaryInterceptors...)
+	stream = append(stream, config.streamInterceptors...)
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)}
+}
+
+// interceptorSettings holds the built-in interceptors configured in InterceptorsConfig, which can be changed at runtime
+type interceptorSettings struct {
+	mutex sync.Mutex
+	value atomic.Value
+}
+
+type interceptorSettingsValues struct {
+	config InterceptorsConfig
+	unary  []grpc.UnaryServerInterceptor
+	stream []grpc.StreamServerInterceptor
+	// Kept when their settings don't change, so that the calls in flight and the breakers open are not reset
+	limiter  *concurrencyLimiter
+	breakers *circuitBreakers
+}
+
+func newInterceptorSettings(config *Config) *interceptorSettings {
+	settings := new(interceptorSettings)
+	settings.value.Store(interceptorSettingsValues{})
+	settings.apply(config)
+	return settings
+}
+
+func (s *interceptorSettings) apply(config *Config) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := s.get()
+	values := interceptorSettingsValues{config: config.Interceptors}
+	if config.Interceptors.MetadataEcho {
+		values.unary = append(values.unary, metadataEchoUnaryInterceptor(nil))
+		values.stream = append(values.stream, metadataEchoStreamInterceptor(nil))
+	} else if keys := config.Interceptors.propagatedKeys(); len(keys) > 0 {
+		values.unary = append(values.unary, metadataEchoUnaryInterceptor(keys))
+		values.stream = append(values.stream, metadataEchoStreamInterceptor(keys))
+	}
+	if len(config.Interceptors.CircuitBreakers) > 0 {
+		// Before the limits, so an open breaker rejects the calls right away
+		values.breakers = old.breakers
+		if values.breakers == nil || !reflect.DeepEqual(old.config.CircuitBreakers, config.Interceptors.CircuitBreakers) {
+			values.breakers = newCircuitBreakers(config.Interceptors.CircuitBreakers)
+		}
+		values.unary = append(values.unary, values.breakers.unaryInterceptor)
+		values.stream = append(values.stream, values.breakers.streamInterceptor)
+	}
+	if len(config.Interceptors.ConcurrencyLimits) > 0 {
+		// Before the delay, so the calls are in flight while delayed. The calls in flight when the limits change release
+		// the slots of the previous ones.
+		values.limiter = old.limiter
+		if values.limiter == nil || !reflect.DeepEqual(old.config.ConcurrencyLimits, config.Interceptors.ConcurrencyLimits) {
+			values.limiter = newConcurrencyLimiter(config.Interceptors.ConcurrencyLimits)
+		}
+		values.unary = append(values.unary, values.limiter.unaryInterceptor)
+		values.stream = append(values.stream, values.limiter.streamInterceptor)
+	}
+	if delay, _ := time.ParseDuration(config.Interceptors.Delay); delay > 0 {
+		values.unary = append(values.unary, delayUnaryInterceptor(delay))
+		values.stream = append(values.stream, delayStreamInterceptor(delay))
+	}
+	s.value.Store(values)
+}
+
+func (s *interceptorSettings) get() interceptorSettingsValues {
+	return s.value.Load().(interceptorSettingsValues)
+}
+
+// unaryInterceptor runs the built-in interceptors current when the call starts
+func (s *interceptorSettings) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return chainUnary(s.get().unary, info, handler)(ctx, req)
+}
+
+func (s *interceptorSettings) streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return chainStream(s.get().stream, info, handler)(srv, stream)
+}
+
+// chainUnary returns the handler that runs the interceptors in order before the handler given
+func chainUnary(interceptors []grpc.UnaryServerInterceptor, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) grpc.UnaryHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, req, info, next)
+		}
+	}
+	return handler
+}
+
+func chainStream(interceptors []grpc.StreamServerInterceptor, info *grpc.StreamServerInfo, handler grpc.StreamHandler) grpc.StreamHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(srv interface{}, stream grpc.ServerStream) error {
+			return interceptor(srv, stream, info, next)
+		}
+	}
+	return handler
+}
+
+// propagatedKeys returns the metadata keys propagated, in lowercase as in the metadata received
+func (c InterceptorsConfig) propagatedKeys() map[string]bool {
+	keys := make(map[string]bool, len(c.PropagatedMetadata))
+	for _, key := range c.PropagatedMetadata {
+		keys[strings.ToLower(key)] = true
+	}
+	return keys
+}
+
+// metadataEchoUnaryInterceptor echoes the metadata with the keys given, or all of it when keys is nil. The metadata
+// echoed is sent by the mock handlers, in the trailer when the response is trailers-only.
+func metadataEchoUnaryInterceptor(keys map[string]bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md := echoedMetadata(ctx, keys); md.Len() > 0 {
+			ctx = grpchandler.WithResponseHeader(ctx, md)
+		}
+		return handler(ctx, req)
+	}
+}
+
+func metadataEchoStreamInterceptor(keys map[string]bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if md := echoedMetadata(stream.Context(), keys); md.Len() > 0 {
+			stream = &contextStream{ServerStream: stream, ctx: grpchandler.WithResponseHeader(stream.Context(), md)}
+		}
+		return handler(srv, stream)
+	}
+}
+
+// contextStream replaces the context of a stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// echoedMetadata returns the metadata received with the keys given (all of them when keys is nil), without the pseudo
+// headers and the headers reserved by gRPC
+func echoedMetadata(ctx context.Context, keys map[string]bool) metadata.MD {
+	received, _ := metadata.FromIncomingContext(ctx)
+	md := metadata.MD{}
+	for key, values := range received {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || notEchoedMetadata[key] || (keys != nil && !keys[key]) {
+			continue
+		}
+		md[key] = values
+	}
+	return md
+}
+
+func delayUnaryInterceptor(delay time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func delayStreamInterceptor(delay time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := sleep(stream.Context(), delay); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// sleep waits for the delay or until the call is cancelled
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
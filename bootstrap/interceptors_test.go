@@ -0,0 +1,155 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInterceptors(t *testing.T) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello\"}"},
+	})
+	intercepted := make([]string, 0)
+	config := &Config{Interceptors: InterceptorsConfig{MetadataEcho: true, Delay: "50ms"}}
+	WithUnaryInterceptors(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = append(intercepted, info.FullMethod)
+		return handler(ctx, req)
+	})(config)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(interceptorOptions(config, newInterceptorSettings(config))...)
+	server.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "123")
+	header := metadata.MD{}
+	start := time.Now()
+	err = conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.Header(&header))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(t, []string{"123"}, header.Get("x-request-id"))
+	assert.Empty(t, header.Get("user-agent"))
+	assert.Equal(t, []string{benchFullMethod}, intercepted)
+}
+
+func TestLoadConfig_InterceptorsDelay(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) { config.Interceptors.Delay = "soon" }})
+	assert.Error(t, err)
+}
+
+func TestMetadataEcho_TrailersOnly(t *testing.T) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "error", Error: &stub.ErrorResponse{Code: 14, Message: "unavailable"}, TrailersOnly: true},
+	})
+	config := &Config{Interceptors: InterceptorsConfig{MetadataEcho: true}}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(interceptorOptions(config, newInterceptorSettings(config))...)
+	server.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "123")
+	header, trailer := metadata.MD{}, metadata.MD{}
+	err = conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.Header(&header), grpc.Trailer(&trailer))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Empty(t, header.Get("x-request-id"))
+	assert.Equal(t, []string{"123"}, trailer.Get("x-request-id"))
+
+	// Without trailers-only the headers are sent before the error
+	stubs, err := store.GetStubsForMethod(context.Background(), benchFullMethod)
+	assert.NoError(t, err)
+	stubs[0].Response.TrailersOnly = false
+	header, trailer = metadata.MD{}, metadata.MD{}
+	err = conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.Header(&header), grpc.Trailer(&trailer))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, []string{"123"}, header.Get("x-request-id"))
+	assert.Empty(t, trailer.Get("x-request-id"))
+}
+
+func TestPropagatedMetadata(t *testing.T) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello\"}"},
+	})
+	config := &Config{Interceptors: InterceptorsConfig{PropagatedMetadata: []string{"X-Request-ID", "traceparent"}}}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(interceptorOptions(config, newInterceptorSettings(config))...)
+	server.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "123", "traceparent", traceparent, "x-tenant", "acme")
+	header := metadata.MD{}
+	assert.NoError(t, conn.Invoke(ctx, benchFullMethod, &structpb.Struct{}, new(structpb.Struct), grpc.Header(&header)))
+	assert.Equal(t, []string{"123"}, header.Get("x-request-id"))
+	assert.Equal(t, []string{traceparent}, header.Get("traceparent"))
+	assert.Empty(t, header.Get("x-tenant"))
+}
+
+func TestInterceptorSettings_Apply(t *testing.T) {
+	config := &Config{Interceptors: InterceptorsConfig{
+		CircuitBreakers: []CircuitBreakerConfig{{Method: "/acme.Orders/*", Failures: 1, CoolDown: "1m"}},
+	}}
+	settings := newInterceptorSettings(config)
+	fail := errors.New("failed")
+	call := func(err error) (time.Duration, error) {
+		start := time.Now()
+		_, callErr := settings.unaryInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/acme.Orders/Get"},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return nil, err })
+		return time.Since(start), callErr
+	}
+
+	_, err := call(fail)
+	assert.Equal(t, fail, err)
+	_, err = call(nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// The breaker is kept open while its settings don't change
+	config.Interceptors.Delay = "50ms"
+	settings.apply(config)
+	elapsed, err := call(nil)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.True(t, elapsed < 50*time.Millisecond)
+
+	config.Interceptors.CircuitBreakers = nil
+	settings.apply(config)
+	elapsed, err = call(nil)
+	assert.NoError(t, err)
+	assert.True(t, elapsed >= 50*time.Millisecond)
+}
@@ -0,0 +1,66 @@
+package bootstrap
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// JournalConfig persists the journal of the calls, so it survives restarts and can be analysed later
+type JournalConfig struct {
+	// Dir is the directory where the calls are appended as NDJSON files. The journal is only kept in memory when
+	// empty.
+	Dir string `yaml:"dir"`
+	// MaxFileSizeMB is the size, in megabytes, after which the file is rotated. It isn't rotated by size when 0.
+	MaxFileSizeMB int64 `yaml:"maxFileSizeMB"`
+	// RotateInterval is the time after which the file is rotated, e.g. 1h. It isn't rotated by time when empty.
+	RotateInterval string `yaml:"rotateInterval"`
+	// MaxFiles is the number of rotated files kept. All are kept when 0.
+	MaxFiles int64 `yaml:"maxFiles"`
+	// Retention is how long the rotated files are kept, e.g. 168h. They are kept forever when empty.
+	Retention string `yaml:"retention"`
+}
+
+func (c JournalConfig) validate() error {
+	if c.MaxFileSizeMB < 0 || c.MaxFiles < 0 {
+		return fmt.Errorf("the journal max file size and max files can't be negative")
+	}
+	if _, err := parseJournalDuration("rotate interval", c.RotateInterval); err != nil {
+		return err
+	}
+	_, err := parseJournalDuration("retention", c.Retention)
+	return err
+}
+
+func (c JournalConfig) options() stub.FileJournalOptions {
+	rotateInterval, _ := parseJournalDuration("rotate interval", c.RotateInterval)
+	retention, _ := parseJournalDuration("retention", c.Retention)
+	return stub.FileJournalOptions{
+		MaxEntries:     journalSize,
+		MaxFileSize:    c.MaxFileSizeMB * 1024 * 1024,
+		RotateInterval: rotateInterval,
+		MaxFiles:       int(c.MaxFiles),
+		Retention:      retention,
+	}
+}
+
+func parseJournalDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid journal %s: %s", name, value)
+	}
+	return d, nil
+}
+
+// newJournal creates the journal of the calls, persisted in the directory of the config if any
+func newJournal(config JournalConfig) (stub.Journal, error) {
+	if config.Dir == "" {
+		return stub.NewInMemoryJournal(journalSize), nil
+	}
+	log.Infof("Persisting the journal in %s", config.Dir)
+	return stub.NewFileJournal(config.Dir, config.options())
+}
@@ -0,0 +1,376 @@
+package bootstrap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Directory where Kubernetes mounts the credentials of the service account of the pod
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// Time waited before listing or watching again after a failure
+	kubernetesRetryInterval = 5 * time.Second
+	// Actor of the stubs loaded from Kubernetes
+	kubernetesActor = "kubernetes"
+)
+
+// Kubernetes resources the stubs are loaded from
+const (
+	resourceConfigMaps = "configmaps"
+	resourceSecrets    = "secrets"
+)
+
+var errResourceVersionGone = errors.New("resource version too old")
+
+// KubernetesConfig loads the stubs from the ConfigMaps (and Secrets) selected by a label and keeps them in sync, so
+// that the stub sets managed with GitOps are rolled out without redeploying the mock. The mock must run in the cluster
+// with a service account allowed to list and watch them.
+type KubernetesConfig struct {
+	// LabelSelector selects the ConfigMaps with stubs, e.g. mock.acme.com/stubs=true. The stubs are not loaded from
+	// Kubernetes when empty.
+	LabelSelector string `yaml:"labelSelector"`
+	// Namespace of the ConfigMaps, the namespace of the pod when empty
+	Namespace string `yaml:"namespace"`
+	// Secrets loads the stubs of the Secrets selected too
+	Secrets bool `yaml:"secrets"`
+}
+
+func (c KubernetesConfig) validate() error {
+	if c.LabelSelector == "" {
+		if c.Namespace != "" || c.Secrets {
+			return fmt.Errorf("the Kubernetes label selector must be set")
+		}
+		return nil
+	}
+	for _, requirement := range strings.Split(c.LabelSelector, ",") {
+		if strings.TrimLeft(strings.TrimSpace(requirement), "!") == "" {
+			return fmt.Errorf("invalid Kubernetes label selector: %s", c.LabelSelector)
+		}
+	}
+	return nil
+}
+
+// kubernetesClient calls the API server with the credentials of the service account of the pod
+type kubernetesClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// newInClusterClient creates the client of the API server of the cluster the mock runs in
+func newInClusterClient() (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in Kubernetes: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the service account token: %w", err)
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid service account CA")
+	}
+	return &kubernetesClient{
+		baseURL: "https://" + net.JoinHostPort(host, port),
+		token:   strings.TrimSpace(string(token)),
+		client:  &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}, nil
+}
+
+// podNamespace is the namespace of the pod the mock runs in
+func podNamespace() (string, error) {
+	namespace, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return "", fmt.Errorf("could not read the namespace of the pod: %w", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+func (c *kubernetesClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	request, err := http.NewRequest(http.MethodGet, c.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request = request.WithContext(ctx)
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		if response.StatusCode == http.StatusGone {
+			return nil, errResourceVersionGone
+		}
+		return nil, fmt.Errorf("GET %s failed with status %d: %s", path, response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return response, nil
+}
+
+// kubernetesObject is a ConfigMap or a Secret
+type kubernetesObject struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type kubernetesList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []kubernetesObject `json:"items"`
+}
+
+type kubernetesEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubernetesStubsSource keeps the stubs of the ConfigMaps or Secrets selected in sync, like an informer: it lists them
+// and then watches their changes. The stubs of each object are a fixture named <kind>/<namespace>/<name>, which is
+// activated when the object is added or changed and deactivated when it is deleted.
+type kubernetesStubsSource struct {
+	client        *kubernetesClient
+	resource      string
+	namespace     string
+	labelSelector string
+	fixturesStore stub.FixturesStore
+	stubsStore    stub.StubsStore
+	service       grpchandler.MockService
+}
+
+// startKubernetesStubs loads the stubs from the ConfigMaps (and Secrets) of the config and keeps them in sync
+func startKubernetesStubs(config KubernetesConfig, fixturesStore stub.FixturesStore, stubsStore stub.StubsStore, service grpchandler.MockService) error {
+	client, err := newInClusterClient()
+	if err != nil {
+		return err
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		if namespace, err = podNamespace(); err != nil {
+			return err
+		}
+	}
+	resources := []string{resourceConfigMaps}
+	if config.Secrets {
+		resources = append(resources, resourceSecrets)
+	}
+	for _, resource := range resources {
+		source := &kubernetesStubsSource{
+			client:        client,
+			resource:      resource,
+			namespace:     namespace,
+			labelSelector: config.LabelSelector,
+			fixturesStore: fixturesStore,
+			stubsStore:    stubsStore,
+			service:       service,
+		}
+		log.Infof("Loading the stubs of the %s of %s selected by %s", resource, namespace, config.LabelSelector)
+		go source.run(make(chan struct{}))
+	}
+	return nil
+}
+
+// run lists and watches the objects until stop is closed. It watches again from the last version seen when the watch
+// ends, and lists again when that version is too old.
+func (s *kubernetesStubsSource) run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	resourceVersion := ""
+	for {
+		var err error
+		if resourceVersion == "" {
+			resourceVersion, err = s.list(ctx)
+		}
+		if err == nil {
+			resourceVersion, err = s.watch(ctx, resourceVersion)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, errResourceVersionGone) {
+			resourceVersion = ""
+		} else {
+			log.Warnf("Failed to sync the stubs of the %s: %s", s.resource, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kubernetesRetryInterval):
+		}
+	}
+}
+
+func (s *kubernetesStubsSource) path() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", s.namespace, s.resource)
+}
+
+// list syncs all the objects, removing the stubs of the ones deleted, and returns the version of the list
+func (s *kubernetesStubsSource) list(ctx context.Context) (string, error) {
+	response, err := s.client.get(ctx, s.path(), url.Values{"labelSelector": {s.labelSelector}})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	list := kubernetesList{}
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return "", err
+	}
+	listed := make(map[string]bool, len(list.Items))
+	for _, object := range list.Items {
+		s.sync(ctx, object)
+		listed[s.fixtureName(object.Metadata.Name)] = true
+	}
+	for _, fixture := range s.fixturesStore.GetAll() {
+		if strings.HasPrefix(fixture.Name, s.fixtureName("")) && !listed[fixture.Name] {
+			s.remove(ctx, fixture.Name)
+		}
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the changes after the version until the API server ends the watch, and returns the last version seen
+func (s *kubernetesStubsSource) watch(ctx context.Context, resourceVersion string) (string, error) {
+	response, err := s.client.get(ctx, s.path(), url.Values{
+		"labelSelector":       {s.labelSelector},
+		"watch":               {"true"},
+		"resourceVersion":     {resourceVersion},
+		"allowWatchBookmarks": {"true"},
+	})
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer response.Body.Close()
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		event := kubernetesEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return resourceVersion, err
+		}
+		if event.Type == "ERROR" {
+			status := struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}{}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return resourceVersion, errResourceVersionGone
+			}
+			return resourceVersion, fmt.Errorf("watch failed: %s", status.Message)
+		}
+		object := kubernetesObject{}
+		if err := json.Unmarshal(event.Object, &object); err != nil {
+			return resourceVersion, err
+		}
+		resourceVersion = object.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			s.sync(ctx, object)
+		case "DELETED":
+			s.remove(ctx, s.fixtureName(object.Metadata.Name))
+		}
+	}
+	return resourceVersion, scanner.Err()
+}
+
+// fixtureName is the name of the fixture of the stubs of the object, e.g. configmap/default/orders-stubs
+func (s *kubernetesStubsSource) fixtureName(name string) string {
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.resource, "s"), s.namespace, name)
+}
+
+// sync activates the stubs of the object, replacing the ones of its previous version. Each key of the object ending
+// with .json has a single stub or an array of stubs, like the stub files. The invalid stubs are skipped.
+func (s *kubernetesStubsSource) sync(ctx context.Context, object kubernetesObject) {
+	fixture := &stub.Fixture{Name: s.fixtureName(object.Metadata.Name), Stubs: make([]*stub.Stub, 0)}
+	keys := make([]string, 0, len(object.Data))
+	for key := range object.Data {
+		if strings.HasSuffix(key, ".json") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		data := []byte(object.Data[key])
+		if s.resource == resourceSecrets {
+			decoded, err := base64.StdEncoding.DecodeString(object.Data[key])
+			if err != nil {
+				log.Warnf("Skipping %s of %s: %s", key, fixture.Name, err.Error())
+				continue
+			}
+			data = decoded
+		}
+		stubs, err := stub.ParseStubs(data)
+		if err != nil {
+			log.Warnf("Skipping %s of %s: %s", key, fixture.Name, err.Error())
+			continue
+		}
+		fixture.Stubs = append(fixture.Stubs, stubs...)
+	}
+	existing, err := s.stubsStore.GetAllStubs(ctx)
+	if err == nil {
+		err = fixture.ResolveExtends(existing)
+	}
+	if err != nil {
+		log.Warnf("Skipping the stubs of %s: %s", fixture.Name, err.Error())
+		return
+	}
+	supportedMethods := getSupportedMethods(s.service)
+	valid := make([]*stub.Stub, 0, len(fixture.Stubs))
+	for _, e := range fixture.Stubs {
+		if isValidStub(e, supportedMethods, s.service) {
+			valid = append(valid, e)
+		}
+	}
+	fixture.Stubs = valid
+	s.fixturesStore.Save(fixture)
+	if _, err := fixture.Activate(ctx, s.stubsStore, kubernetesActor, false); err != nil {
+		log.Warnf("Failed to activate the stubs of %s: %s", fixture.Name, err.Error())
+		return
+	}
+	log.Infof("Synced %d stubs of %s", len(fixture.Stubs), fixture.Name)
+}
+
+// remove deactivates the stubs of the object deleted
+func (s *kubernetesStubsSource) remove(ctx context.Context, fixtureName string) {
+	if _, err := stub.DeactivateFixture(ctx, s.stubsStore, fixtureName); err != nil {
+		log.Warnf("Failed to remove the stubs of %s: %s", fixtureName, err.Error())
+		return
+	}
+	s.fixturesStore.Delete(fixtureName)
+	log.Infof("Removed the stubs of %s", fixtureName)
+}
@@ -0,0 +1,123 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// structMockService is a mock service with a single method whose request and response are google.protobuf.Struct
+type structMockService struct {
+	method string
+}
+
+func (m structMockService) Register(s *grpc.Server)                {}
+func (m structMockService) GetSupportedMethods() []string          { return []string{m.method} }
+func (m structMockService) GetPayloadExamples() []stub.Stub        { return nil }
+func (m structMockService) GetStubsValidator() stub.StubsValidator { return m }
+
+func (m structMockService) GetRequestInstance(methodName string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (m structMockService) GetResponseInstance(methodName string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (m structMockService) IsValid(s *stub.Stub) (bool, []string) {
+	return s.IsValid()
+}
+
+// waitFor waits up to a second for the condition to be true
+func waitFor(t *testing.T, condition func() bool) {
+	for deadline := time.Now().Add(time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+	}
+}
+
+func configMapStub(id string) string {
+	return fmt.Sprintf(`{"fullMethod":"/acme.Orders/Get","request":{"match":"exact","content":{"id":"%s"}},`+
+		`"response":{"type":"success","content":{"id":"%s"}}}`, id, id)
+}
+
+func TestKubernetesStubsSource_Sync(t *testing.T) {
+	events := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		assert.Equal(t, "/api/v1/namespaces/mocks/configmaps", request.URL.Path)
+		assert.Equal(t, "mock.acme.com/stubs=true", request.URL.Query().Get("labelSelector"))
+		if request.URL.Query().Get("watch") != "true" {
+			fmt.Fprintf(writer, `{"metadata":{"resourceVersion":"10"},"items":[`+
+				`{"metadata":{"name":"orders","resourceVersion":"9"},"data":{"orders.json":%q,"README":"ignored"}}]}`,
+				"["+configMapStub("1")+","+configMapStub("2")+"]")
+			return
+		}
+		assert.Equal(t, "10", request.URL.Query().Get("resourceVersion"))
+		writer.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-events:
+				fmt.Fprintln(writer, event)
+				writer.(http.Flusher).Flush()
+			case <-request.Context().Done():
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	fixturesStore := stub.NewInMemoryFixturesStore()
+	stubsStore := stub.NewInMemoryStubsStore()
+	fixturesStore.Save(&stub.Fixture{Name: "configmap/mocks/removed"})
+	source := &kubernetesStubsSource{
+		client:        &kubernetesClient{baseURL: server.URL, client: server.Client()},
+		resource:      resourceConfigMaps,
+		namespace:     "mocks",
+		labelSelector: "mock.acme.com/stubs=true",
+		fixturesStore: fixturesStore,
+		stubsStore:    stubsStore,
+		service:       structMockService{method: "/acme.Orders/Get"},
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go source.run(stop)
+
+	stubIDs := func() []string {
+		stubs, err := stubsStore.GetAllStubs(context.Background())
+		assert.NoError(t, err)
+		ids := make([]string, 0, len(stubs))
+		for _, s := range stubs {
+			assert.Equal(t, kubernetesActor, s.CreatedBy)
+			ids = append(ids, s.Fixture+" "+s.Response.Content.String())
+		}
+		return ids
+	}
+	waitFor(t, func() bool { return len(stubIDs()) == 2 })
+	assert.ElementsMatch(t, []string{`configmap/mocks/orders {"id":"1"}`, `configmap/mocks/orders {"id":"2"}`}, stubIDs())
+	assert.Nil(t, fixturesStore.Get("configmap/mocks/removed"))
+
+	events <- fmt.Sprintf(`{"type":"MODIFIED","object":{"metadata":{"name":"orders","resourceVersion":"11"},"data":{"orders.json":%q}}}`, configMapStub("3"))
+	waitFor(t, func() bool {
+		ids := stubIDs()
+		return len(ids) == 1 && ids[0] == `configmap/mocks/orders {"id":"3"}`
+	})
+
+	events <- `{"type":"DELETED","object":{"metadata":{"name":"orders","resourceVersion":"12"}}}`
+	waitFor(t, func() bool { return len(stubIDs()) == 0 })
+	assert.Nil(t, fixturesStore.Get("configmap/mocks/orders"))
+}
+
+func TestKubernetesConfig_Validate(t *testing.T) {
+	assert.NoError(t, KubernetesConfig{}.validate())
+	assert.NoError(t, KubernetesConfig{LabelSelector: "app=mock,!legacy", Secrets: true}.validate())
+	assert.EqualError(t, KubernetesConfig{Namespace: "mocks"}.validate(), "the Kubernetes label selector must be set")
+	assert.EqualError(t, KubernetesConfig{LabelSelector: "app=mock,"}.validate(), "invalid Kubernetes label selector: app=mock,")
+}
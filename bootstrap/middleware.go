@@ -0,0 +1,196 @@
+package bootstrap
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	headerAuthorization   = "Authorization"
+	headerOrigin          = "Origin"
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	encodingGzip          = "gzip"
+	bearerPrefix          = "Bearer "
+)
+
+// restSettings holds the settings of the REST server that can be changed at runtime
+type restSettings struct {
+	value atomic.Value
+}
+
+type restSettingsValues struct {
+	// Authorization headers accepted. Empty when no authentication is required.
+	credentials    []restCredential
+	allowAnyOrigin bool
+	allowedOrigins map[string]bool
+}
+
+func newRESTSettings(config *Config) *restSettings {
+	settings := new(restSettings)
+	settings.apply(config)
+	return settings
+}
+
+func (s *restSettings) apply(config *Config) {
+	values := restSettingsValues{
+		allowedOrigins: make(map[string]bool, len(config.CORS.AllowedOrigins)),
+	}
+	if config.Auth.Token != "" {
+		values.credentials = append(values.credentials, newRESTCredential(tokenPrincipal, config.Auth.Token))
+	}
+	for _, key := range config.Auth.APIKeys {
+		values.credentials = append(values.credentials, newRESTCredential(key.Name, key.Token))
+	}
+	for _, origin := range config.CORS.AllowedOrigins {
+		if origin == "*" {
+			values.allowAnyOrigin = true
+		}
+		values.allowedOrigins[origin] = true
+	}
+	s.value.Store(values)
+}
+
+func (s *restSettings) get() restSettingsValues {
+	return s.value.Load().(restSettingsValues)
+}
+
+// restCredential is an Authorization header accepted and the principal it authenticates
+type restCredential struct {
+	authorization []byte
+	principal     string
+}
+
+func newRESTCredential(principal, token string) restCredential {
+	return restCredential{authorization: []byte(bearerPrefix + token), principal: principal}
+}
+
+// authenticate returns the principal of the Authorization header, "" when it is not accepted. All the credentials are
+// compared so that the time taken doesn't tell which one matched.
+func (v restSettingsValues) authenticate(authorization []byte) string {
+	principal := ""
+	for _, credential := range v.credentials {
+		if subtle.ConstantTimeCompare(authorization, credential.authorization) == 1 {
+			principal = credential.principal
+		}
+	}
+	return principal
+}
+
+// corsHandler allows browsers on the allowed origins to call the REST API. Preflight requests are answered directly.
+func corsHandler(settings *restSettings, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		values := settings.get()
+		origin := request.Header.Get(headerOrigin)
+		if origin == "" || (!values.allowAnyOrigin && !values.allowedOrigins[origin]) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		header := writer.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", headerOrigin)
+		header.Set("Access-Control-Expose-Headers", "ETag")
+		if request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match")
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// authHandler rejects the requests without one of the configured tokens in the Authorization header, and passes the
+// principal authenticated to the controllers as the actor of the changes. The health probes don't require
+// authentication.
+func authHandler(settings *restSettings, next http.Handler) http.Handler {
+	public := make(map[string]bool, len(restcontrollers.HealthPaths))
+	for _, path := range restcontrollers.HealthPaths {
+		public[path] = true
+	}
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		values := settings.get()
+		if len(values.credentials) == 0 || public[request.URL.Path] {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		principal := values.authenticate([]byte(strings.TrimSpace(request.Header.Get(headerAuthorization))))
+		if principal == "" {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(writer, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(writer, restcontrollers.WithPrincipal(request, principal))
+	})
+}
+
+// gzipHandler compresses the responses for the clients accepting gzip
+func gzipHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Add("Vary", headerAcceptEncoding)
+		if !strings.Contains(request.Header.Get(headerAcceptEncoding), encodingGzip) {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		gzipWriter := &gzipResponseWriter{ResponseWriter: writer}
+		defer gzipWriter.close()
+		next.ServeHTTP(gzipWriter, request)
+	})
+}
+
+// gzipResponseWriter compresses the body of the response. Responses without body (e.g. 304 Not Modified) are sent as
+// they are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gzip        *gzip.Writer
+	wroteHeader bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.Header()
+	if code >= http.StatusOK && code != http.StatusNoContent && code != http.StatusNotModified &&
+		header.Get(headerContentEncoding) == "" {
+		header.Set(headerContentEncoding, encodingGzip)
+		header.Del("Content-Length")
+		w.gzip = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			// Detect the content type from the uncompressed data, as http.ResponseWriter would do
+			w.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gzip == nil {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.gzip.Write(data)
+}
+
+// Flush sends the data compressed so far, so the streamed responses are still streamed
+func (w *gzipResponseWriter) Flush() {
+	if w.gzip != nil {
+		w.gzip.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gzip != nil {
+		w.gzip.Close()
+	}
+}
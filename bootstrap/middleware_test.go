@@ -0,0 +1,128 @@
+package bootstrap
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var okHandler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+	writer.WriteHeader(http.StatusOK)
+})
+
+func TestAuthHandler(t *testing.T) {
+	handler := authHandler(newRESTSettings(&Config{Auth: AuthConfig{Token: "secret"}}), okHandler)
+
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAuthHandler_APIKeys(t *testing.T) {
+	settings := newRESTSettings(&Config{Auth: AuthConfig{APIKeys: []APIKeyConfig{{Name: "ci", Token: "ci-key"}, {Name: "qa", Token: "qa-key"}}}})
+	handler := authHandler(settings, okHandler)
+
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	request.Header.Set("Authorization", "Bearer qa-key")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	assert.Equal(t, "ci", settings.get().authenticate([]byte("Bearer ci-key")))
+	assert.Equal(t, "qa", settings.get().authenticate([]byte("Bearer qa-key")))
+	assert.Equal(t, "", settings.get().authenticate([]byte("Bearer ci")))
+}
+
+func TestLoadConfig_APIKeys(t *testing.T) {
+	_, err := loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.Auth.APIKeys = []APIKeyConfig{{Name: "ci", Token: "a"}, {Name: "ci", Token: "b"}}
+	}})
+	assert.Error(t, err)
+	_, err = loadConfig("/tmp", 1068, 10010, []Option{func(config *Config) {
+		config.Auth.APIKeys = []APIKeyConfig{{Name: "ci"}}
+	}})
+	assert.Error(t, err)
+}
+
+func TestCORSHandler(t *testing.T) {
+	handler := corsHandler(newRESTSettings(&Config{CORS: CORSConfig{AllowedOrigins: []string{"http://allowed.com"}}}), okHandler)
+
+	request := httptest.NewRequest(http.MethodOptions, "/stubs", nil)
+	request.Header.Set("Origin", "http://allowed.com")
+	request.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "http://allowed.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+
+	request = httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	request.Header.Set("Origin", "http://other.com")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "", recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestAuthHandler_NoToken(t *testing.T) {
+	handler := authHandler(newRESTSettings(&Config{}), okHandler)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stubs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestGzipHandler(t *testing.T) {
+	body := strings.Repeat("{\"fullMethod\":\"method1\"}", 100)
+	handler := gzipHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Header.Get("If-None-Match") != "" {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(body))
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	request.Header.Set("Accept-Encoding", "gzip, deflate")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, "gzip", recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+	assert.True(t, recorder.Body.Len() < len(body))
+	reader, err := gzip.NewReader(recorder.Body)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+
+	request.Header.Set("If-None-Match", "W/\"1\"")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, 0, recorder.Body.Len())
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stubs", nil))
+	assert.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, recorder.Body.String())
+}
@@ -0,0 +1,128 @@
+package bootstrap
+
+import (
+	log "github.com/sirupsen/logrus"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Interval between the checks for changes in the config file
+const configWatchInterval = 2 * time.Second
+
+// configReloader reloads the configuration and applies the settings that can be changed at runtime: logging, strict
+// mode, simulation, request validation, field mask trimming, deprecations, method aliases, JWT verification, the
+// script timeout, the interceptors of the gRPC server and the authentication and CORS settings of the REST API.
+// Changes to the other settings are only applied on restart.
+type configReloader struct {
+	mutex               sync.Mutex
+	load                func() (*Config, error)
+	config              *Config
+	restSettings        *restSettings
+	interceptorSettings *interceptorSettings
+}
+
+func newConfigReloader(config *Config, restSettings *restSettings, interceptorSettings *interceptorSettings,
+	load func() (*Config, error)) *configReloader {
+	return &configReloader{
+		load:                load,
+		config:              config,
+		restSettings:        restSettings,
+		interceptorSettings: interceptorSettings,
+	}
+}
+
+// Reload reads the configuration again. Nothing is changed if the configuration is invalid.
+func (r *configReloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	config, err := r.load()
+	if err != nil {
+		log.Errorf("Configuration not reloaded: %s", err.Error())
+		return err
+	}
+	// The keys are read first, as they can still fail after the validation (e.g. when the key file is removed)
+	if err := setupJWTVerification(config); err != nil {
+		log.Errorf("Configuration not reloaded: %s", err.Error())
+		return err
+	}
+	for _, setting := range restartRequiredChanges(r.config, config) {
+		log.Warnf("Configuration setting %s changed but it is only applied on restart", setting)
+	}
+	setupLogging(config)
+	setupStrictMode(config)
+	setupSimulation(config)
+	setupRequestValidation(config)
+	setupFieldMaskTrimming(config)
+	setupMethodDeprecations(config)
+	setupMethodAliases(config)
+	setupScripts(config)
+	r.restSettings.apply(config)
+	r.interceptorSettings.apply(config)
+	r.config = config
+	log.Info("Configuration reloaded")
+	return nil
+}
+
+// watch starts checking the file in the background and reloads the configuration whenever it is modified
+func (r *configReloader) watch(file string, interval time.Duration, stop <-chan struct{}) {
+	go r.poll(file, modificationTime(file), interval, stop)
+}
+
+func (r *configReloader) poll(file string, lastModified time.Time, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			modified := modificationTime(file)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			log.Infof("Config file %s changed", file)
+			r.Reload()
+		}
+	}
+}
+
+func modificationTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// restartRequiredChanges lists the settings changed that can't be applied at runtime
+func restartRequiredChanges(old, new *Config) []string {
+	changes := make([]string, 0)
+	check := func(name string, oldValue, newValue interface{}) {
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, name)
+		}
+	}
+	check("tmpPath", old.TmpPath, new.TmpPath)
+	check("restPort", old.RESTPort, new.RESTPort)
+	check("grpcPort", old.GRPCPort, new.GRPCPort)
+	check("singlePort", old.SinglePort, new.SinglePort)
+	check("profiling", old.Profiling, new.Profiling)
+	check("stubsDir", old.StubsDir, new.StubsDir)
+	check("fixturesDir", old.FixturesDir, new.FixturesDir)
+	check("store", old.Store, new.Store)
+	check("tls", old.TLS, new.TLS)
+	check("grpcAuth", old.GRPCAuth, new.GRPCAuth)
+	check("seed", old.Seed, new.Seed)
+	check("contract", old.Contract, new.Contract)
+	check("journal", old.Journal, new.Journal)
+	check("discovery", old.Discovery, new.Discovery)
+	check("kubernetes", old.Kubernetes, new.Kubernetes)
+	check("shadow", old.Shadow, new.Shadow)
+	check("golden", old.Golden, new.Golden)
+	check("descriptors", old.Descriptors, new.Descriptors)
+	return changes
+}
@@ -0,0 +1,108 @@
+package bootstrap
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestReloader(t *testing.T, file string) *configReloader {
+	load := func() (*Config, error) {
+		return loadConfig("/tmp", 1068, 10010, []Option{WithConfigFile(file)})
+	}
+	config, err := load()
+	assert.NoError(t, err)
+	return newConfigReloader(config, newRESTSettings(config), newInterceptorSettings(config), load)
+}
+
+func TestConfigReloader_Reload(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer util.ConfigurePayloadLogging(true, nil)
+
+	file := writeConfigFile(t, "logging:\n  level: info\n")
+	defer os.Remove(file)
+	reloader := newTestReloader(t, file)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("restPort: 9090\nauth:\n  token: secret\nlogging:\n  level: error\n  disablePayloads: true\n"), 0644))
+	assert.NoError(t, reloader.Reload())
+
+	assert.Equal(t, log.ErrorLevel, log.GetLevel())
+	assert.False(t, util.IsPayloadLoggingEnabled())
+	assert.Equal(t, tokenPrincipal, reloader.restSettings.get().authenticate([]byte("Bearer secret")))
+	assert.Equal(t, uint(9090), reloader.config.RESTPort)
+}
+
+func TestConfigReloader_Reload_InvalidConfig(t *testing.T) {
+	file := writeConfigFile(t, "logging:\n  level: info\n")
+	defer os.Remove(file)
+	reloader := newTestReloader(t, file)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("logging:\n  level: loud\n"), 0644))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "info", reloader.config.Logging.Level)
+}
+
+func TestConfigReloader_Watch(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer util.ConfigurePayloadLogging(true, nil)
+
+	file := writeConfigFile(t, "auth:\n  token: first\n")
+	defer os.Remove(file)
+	reloader := newTestReloader(t, file)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	reloader.watch(file, 10*time.Millisecond, stop)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("auth:\n  token: second\n"), 0644))
+	modified := time.Now().Add(time.Second)
+	assert.NoError(t, os.Chtimes(file, modified, modified))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && reloader.restSettings.get().authenticate([]byte("Bearer second")) == "" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, tokenPrincipal, reloader.restSettings.get().authenticate([]byte("Bearer second")))
+}
+
+func TestRestartRequiredChanges(t *testing.T) {
+	old := &Config{RESTPort: 1068, Logging: LoggingConfig{Level: "info"}}
+	new := &Config{RESTPort: 1069, Logging: LoggingConfig{Level: "debug"}, TLS: TLSConfig{CertFile: "a", KeyFile: "b"}}
+	assert.Equal(t, []string{"restPort", "tls"}, restartRequiredChanges(old, new))
+}
+
+func TestConfigReloader_Reload_InvalidJWTKeys(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	log.SetLevel(log.InfoLevel)
+	config, err := loadConfig("/tmp", 1068, 10010, nil)
+	assert.NoError(t, err)
+	reloader := newConfigReloader(config, newRESTSettings(config), newInterceptorSettings(config), func() (*Config, error) {
+		changed := *config
+		changed.Logging.Level = "error"
+		changed.JWT.PublicKeyFile = "/tmp/missing.pem"
+		return &changed, nil
+	})
+
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "", reloader.config.JWT.PublicKeyFile)
+	assert.Equal(t, log.InfoLevel, log.GetLevel())
+	assert.Error(t, setupJWTVerification(&Config{JWT: JWTConfig{PublicKeyFile: "/tmp/missing.pem"}}))
+}
+
+func TestConfigReloader_Reload_Interceptors(t *testing.T) {
+	file := writeConfigFile(t, "interceptors:\n  delay: 1s\n")
+	defer os.Remove(file)
+	reloader := newTestReloader(t, file)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("interceptors:\n  metadataEcho: true\n"), 0644))
+	assert.NoError(t, reloader.Reload())
+
+	values := reloader.interceptorSettings.get()
+	assert.True(t, values.config.MetadataEcho)
+	assert.Equal(t, "", values.config.Delay)
+	assert.Len(t, values.unary, 1)
+}
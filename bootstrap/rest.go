@@ -8,11 +8,35 @@ import (
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 )
 
+// Number of changes kept in the audit log
+const auditLogSize = 10000
+
+// Time the stubs created with an Idempotency-Key are returned to the retries
+const idempotencyKeyTTL = 24 * time.Hour
+
+// Number of calls kept in the journal
+const journalSize = 10000
+
 func StartRESTServer(port uint, controllers []restcontrollers.RESTController) {
-	log.Infof("REST Server listening on port: %d", port)
+	config := &Config{RESTPort: port}
+	startRESTServer(config, newRESTSettings(config), controllers)
+}
+
+func startRESTServer(config *Config, settings *restSettings, controllers []restcontrollers.RESTController) {
+	log.Infof("REST Server listening on port: %d", config.RESTPort)
+
+	handler := newRESTHandler(settings, controllers)
+	addr := fmt.Sprintf(":%d", config.RESTPort)
+	if config.TLS.Enabled() {
+		log.Fatal(http.ListenAndServeTLS(addr, config.TLS.CertFile, config.TLS.KeyFile, handler))
+	}
+	log.Fatal(http.ListenAndServe(addr, handler))
+}
 
+func newRESTHandler(settings *restSettings, controllers []restcontrollers.RESTController) http.Handler {
 	r := mux.NewRouter()
 	for _, controller := range controllers {
 		api := r.PathPrefix(controller.GetPath()).Subrouter()
@@ -20,20 +44,46 @@ func StartRESTServer(port uint, controllers []restcontrollers.RESTController) {
 			api.HandleFunc(handler.Path, handler.Handler).Methods(handler.Methods...)
 		}
 	}
-
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), r))
+	return corsHandler(settings, authHandler(settings, gzipHandler(r)))
 }
 
 func CreateRESTControllers(
 	stubExamples []stub.Stub,
 	stubsStore stub.StubsStore,
 	service grpchandler.MockService) []restcontrollers.RESTController {
+	return createRESTControllers(stubExamples, stubsStore, stub.NewInMemoryFixturesStore(),
+		stub.NewInMemoryTrash(StoreConfig{TrashRetention: defaultTrashRetention}.trashRetention()), service)
+}
+
+func createRESTControllers(
+	stubExamples []stub.Stub,
+	stubsStore stub.StubsStore,
+	fixturesStore stub.FixturesStore,
+	trash stub.Trash,
+	service grpchandler.MockService) []restcontrollers.RESTController {
+	auditLog := stub.NewInMemoryAuditLog(auditLogSize)
 	return []restcontrollers.RESTController{
 		restcontrollers.ExamplesController{StubExamples: stubExamples},
+		restcontrollers.SchemasController{Service: service},
 		restcontrollers.StubsController{
-			StubsStore:   stubsStore,
-			StubExamples: stubExamples,
-			Service:      service,
+			StubsStore:      stubsStore,
+			StubExamples:    stubExamples,
+			Service:         service,
+			AuditLog:        auditLog,
+			Trash:           trash,
+			IdempotencyKeys: restcontrollers.NewIdempotencyKeys(idempotencyKeyTTL),
+		},
+		restcontrollers.AuditController{AuditLog: auditLog},
+		restcontrollers.SnapshotsController{
+			StubsStore:     stubsStore,
+			SnapshotsStore: stub.NewInMemorySnapshotsStore(),
+			AuditLog:       auditLog,
+		},
+		restcontrollers.FixturesController{
+			StubsStore:    stubsStore,
+			FixturesStore: fixturesStore,
+			Service:       service,
+			AuditLog:      auditLog,
 		},
 	}
 }
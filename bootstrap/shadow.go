@@ -0,0 +1,159 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShadowQueueSize = 1000
+	defaultShadowTimeout   = 5 * time.Second
+)
+
+// Metadata of the copies of the calls sent to a gRPC shadowing sink
+const (
+	shadowStubIDMetadataKey   = "x-mock-shadow-stub-id"
+	shadowResponseMetadataKey = "x-mock-shadow-response-bin"
+	shadowStatusMetadataKey   = "x-mock-shadow-status"
+)
+
+// ShadowConfig sends a copy of every call matched by a stub, with the response of the mock, to a sink for offline
+// analysis (see grpchandler.Shadowing)
+type ShadowConfig struct {
+	// Target is the URL the copies are posted to as JSON (http:// or https://), or the address of a gRPC server the
+	// requests are sent to, to the same methods, e.g. analysis:9090. The calls are not copied when empty.
+	Target string `yaml:"target"`
+	// TLS connects to the gRPC server with TLS, verifying its certificate with the CAs of the system
+	TLS bool `yaml:"tls"`
+	// QueueSize is the number of copies waiting to be sent before new ones are dropped, 1000 when 0
+	QueueSize int64 `yaml:"queueSize"`
+	// Timeout of sending each copy, e.g. 5s, the default
+	Timeout string `yaml:"timeout"`
+}
+
+func (c ShadowConfig) validate() error {
+	if c.QueueSize < 0 {
+		return fmt.Errorf("invalid shadow queue size: %d", c.QueueSize)
+	}
+	if c.Timeout != "" {
+		if d, err := time.ParseDuration(c.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid shadow timeout: %s", c.Timeout)
+		}
+	}
+	if c.isHTTP() {
+		if _, err := url.ParseRequestURI(c.Target); err != nil {
+			return fmt.Errorf("invalid shadow target: %s", c.Target)
+		}
+	}
+	return nil
+}
+
+func (c ShadowConfig) isHTTP() bool {
+	return strings.HasPrefix(c.Target, "http://") || strings.HasPrefix(c.Target, "https://")
+}
+
+func (c ShadowConfig) queueSize() int {
+	if c.QueueSize == 0 {
+		return defaultShadowQueueSize
+	}
+	return int(c.QueueSize)
+}
+
+func (c ShadowConfig) timeout() time.Duration {
+	if timeout, err := time.ParseDuration(c.Timeout); err == nil {
+		return timeout
+	}
+	return defaultShadowTimeout
+}
+
+// sink creates the sink of the target, nil when there is no target
+func (c ShadowConfig) sink() (grpchandler.ShadowSink, error) {
+	switch {
+	case c.Target == "":
+		return nil, nil
+	case c.isHTTP():
+		return httpShadowSink(c.Target, c.timeout()), nil
+	default:
+		return grpcShadowSink(c.Target, c.TLS, c.timeout())
+	}
+}
+
+func setupShadowing(config *Config) {
+	sink, err := config.Shadow.sink()
+	if err != nil {
+		log.Fatalf("Invalid shadow target %s: %v", config.Shadow.Target, err)
+	}
+	if sink != nil {
+		log.Infof("Sending a copy of the calls matched to %s", config.Shadow.Target)
+	}
+	grpchandler.GetShadowing().Configure(sink, config.Shadow.queueSize())
+}
+
+// httpShadowSink posts the copies of the calls to the URL as JSON
+func httpShadowSink(target string, timeout time.Duration) grpchandler.ShadowSink {
+	client := &http.Client{Timeout: timeout}
+	return func(call grpchandler.ShadowedCall) error {
+		body, err := json.Marshal(call)
+		if err != nil {
+			return err
+		}
+		response, err := client.Post(target, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		ioutil.ReadAll(response.Body)
+		if response.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("POST %s failed with status %d", target, response.StatusCode)
+		}
+		return nil
+	}
+}
+
+// grpcShadowSink sends the requests of the calls to the same methods of a gRPC server, with their metadata. The ID of
+// the stub matched, the response of the mock (serialized) and its status code are sent in the metadata
+// x-mock-shadow-stub-id, x-mock-shadow-response-bin and x-mock-shadow-status. The response of the server is discarded.
+func grpcShadowSink(target string, useTLS bool, timeout time.Duration) (grpchandler.ShadowSink, error) {
+	conn, err := dialService(target, useTLS)
+	if err != nil {
+		return nil, err
+	}
+	return func(call grpchandler.ShadowedCall) error {
+		if call.RequestMessage == nil {
+			return nil
+		}
+		md := metadata.MD{}
+		for key, values := range call.Metadata {
+			if !strings.HasPrefix(key, ":") && !strings.HasPrefix(key, "grpc-") && !notEchoedMetadata[key] {
+				md[key] = values
+			}
+		}
+		md.Set(shadowStubIDMetadataKey, call.StubID)
+		code := 0
+		if call.Error != nil {
+			code = int(call.Error.Code)
+		}
+		md.Set(shadowStatusMetadataKey, strconv.Itoa(code))
+		if call.ResponseMessage != nil {
+			if response, err := proto.Marshal(call.ResponseMessage); err == nil {
+				md.Set(shadowResponseMetadataKey, string(response))
+			}
+		}
+		ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), timeout)
+		defer cancel()
+		return conn.Invoke(ctx, call.FullMethod, call.RequestMessage, new(empty.Empty))
+	}, nil
+}
@@ -0,0 +1,50 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPShadowSink(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		data, _ := ioutil.ReadAll(request.Body)
+		body := make(map[string]interface{})
+		json.Unmarshal(data, &body)
+		received <- body
+		if body["stubId"] == "rejected" {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	config := ShadowConfig{Target: server.URL + "/calls"}
+	assert.NoError(t, config.validate())
+	sink, err := config.sink()
+	assert.NoError(t, err)
+
+	assert.NoError(t, sink(grpchandler.ShadowedCall{FullMethod: "/acme.Orders/Get", StubID: "stub-1",
+		Request: json.RawMessage(`{"id":"1"}`), Response: json.RawMessage(`{"status":"SHIPPED"}`)}))
+	body := <-received
+	assert.Equal(t, "/acme.Orders/Get", body["fullMethod"])
+	assert.Equal(t, map[string]interface{}{"id": "1"}, body["request"])
+	assert.Equal(t, map[string]interface{}{"status": "SHIPPED"}, body["response"])
+
+	err = sink(grpchandler.ShadowedCall{StubID: "rejected", Request: json.RawMessage(`{}`)})
+	<-received
+	assert.EqualError(t, err, "POST "+server.URL+"/calls failed with status 503")
+}
+
+func TestShadowConfig_Validate(t *testing.T) {
+	assert.NoError(t, ShadowConfig{}.validate())
+	assert.NoError(t, ShadowConfig{Target: "analysis:9090", QueueSize: 10, Timeout: "1s"}.validate())
+	assert.EqualError(t, ShadowConfig{QueueSize: -1}.validate(), "invalid shadow queue size: -1")
+	assert.EqualError(t, ShadowConfig{Timeout: "0s"}.validate(), "invalid shadow timeout: 0s")
+	assert.Equal(t, defaultShadowTimeout, ShadowConfig{}.timeout())
+	assert.Equal(t, time.Second, ShadowConfig{Timeout: "1s"}.timeout())
+}
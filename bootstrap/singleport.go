@@ -0,0 +1,129 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	log "github.com/sirupsen/logrus"
+	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+const grpcContentType = "application/grpc"
+
+// startSinglePortServer serves the gRPC mock and the REST API on the REST port. With TLS, the connections are
+// terminated before telling the gRPC calls apart by their HTTP/2 content type.
+func startSinglePortServer(config *Config, settings *restSettings, interceptors *interceptorSettings,
+	controllers []restcontrollers.RESTController, service grpchandler.MockService, faults *connectionFaults) {
+	serverOptions := interceptorOptions(config, interceptors)
+
+	var err error
+	listener, err = net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", config.RESTPort))
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	muxListener := listener
+	if config.TLS.Enabled() {
+		tlsConfig, err := config.TLS.serverConfig()
+		if err != nil {
+			log.Fatalf("Failed to load TLS credentials: %v", err)
+		}
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+		muxListener = tls.NewListener(listener, tlsConfig)
+		serverOptions = append(serverOptions, grpc.Creds(terminatedTLSCredentials{}))
+	}
+	log.Infof("gRPC and REST Server listening on port: %d", config.RESTPort)
+
+	newServer := func(options ...grpc.ServerOption) *grpc.Server {
+		return newGRPCServer(service, append(append([]grpc.ServerOption(nil), serverOptions...), options...)...)
+	}
+	httpServer := serveSinglePort(muxListener, faults, newServer, newRESTHandler(settings, controllers))
+
+	AwaitTermination(func() {
+		httpServer.Close()
+		log.Warn("Shutting down the server")
+	})
+}
+
+// serveSinglePort serves the gRPC calls and the REST API on the listener given. The gRPC connections are accepted
+// through a faultListener so that the connection faults are injected in them as in the gRPC port. The http.Server
+// of the REST API is returned to be closed.
+func serveSinglePort(l net.Listener, faults *connectionFaults, newServer func(options ...grpc.ServerOption) *grpc.Server, rest http.Handler) *http.Server {
+	m := cmux.New(l)
+	grpcListener := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", grpcContentType))
+	restListener := m.Match(cmux.Any())
+
+	faultListener := newFaultListener(grpcListener, faults)
+	faults.enableGoAway(faultListener, newServer)
+	server = newServer()
+	atomic.StoreInt32(&grpcServing, 1)
+	go serv(server, faultListener.session())
+
+	// The TLS connections are already terminated, so HTTP/2 is accepted in clear text (h2c) in both cases
+	httpServer := &http.Server{Handler: h2c.NewHandler(rest, &http2.Server{})}
+	go func() {
+		if err := httpServer.Serve(restListener); err != nil && err != http.ErrServerClosed && err != cmux.ErrListenerClosed {
+			log.Errorf("failed to serve: %v", err)
+		}
+	}()
+	// Serve returns when the listener is closed on shutdown
+	go m.Serve()
+	return httpServer
+}
+
+// terminatedTLSCredentials are the transport credentials of the gRPC server when the TLS connections are terminated
+// before reaching it. The handshake is already done, it only reports the TLS state of the connection so that the
+// stubs can match the common name of the client certificate.
+type terminatedTLSCredentials struct{}
+
+func (terminatedTLSCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tlsConn := unwrapTLSConn(conn)
+	if tlsConn == nil {
+		return nil, nil, errors.New("not a TLS connection")
+	}
+	return conn, credentials.TLSInfo{
+		State:          tlsConn.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}, nil
+}
+
+func (terminatedTLSCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("terminated TLS credentials can't be used by clients")
+}
+
+func (terminatedTLSCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls", SecurityVersion: "1.2"}
+}
+
+func (c terminatedTLSCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (terminatedTLSCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// unwrapTLSConn finds the TLS connection wrapped by the connection faults and cmux
+func unwrapTLSConn(conn net.Conn) *tls.Conn {
+	for {
+		switch c := conn.(type) {
+		case *tls.Conn:
+			return c
+		case *faultConn:
+			conn = c.Conn
+		case *cmux.MuxConn:
+			conn = c.Conn
+		default:
+			return nil
+		}
+	}
+}
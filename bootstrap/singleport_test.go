@@ -0,0 +1,85 @@
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/carvalhorr/protoc-gen-mock/restcontrollers"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/soheilhy/cmux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestServeSinglePort(t *testing.T) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: benchFullMethod,
+		Request:    &stub.StubRequest{Match: "exact", Content: "{\"name\":\"John\"}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"greeting\":\"Hello, John\"}"},
+	})
+	newServer := func(options ...grpc.ServerOption) *grpc.Server {
+		s := grpc.NewServer(options...)
+		s.RegisterService(&benchServiceDesc, stub.NewStubsMatcher(store))
+		return s
+	}
+	rest := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte("REST"))
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	faults := newConnectionFaults(util.NewSeededRandom(0))
+	httpServer := serveSinglePort(l, faults, newServer, rest)
+	defer func() {
+		server.Stop()
+		httpServer.Close()
+		l.Close()
+	}()
+	addr := l.Addr().String()
+
+	getREST := func() string {
+		response, err := http.Get("http://" + addr + "/stubs")
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return string(body)
+	}
+	assert.Equal(t, "REST", getREST())
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	request := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"name": {Kind: &structpb.Value_StringValue{StringValue: "John"}},
+	}}
+	resp := new(structpb.Struct)
+	assert.NoError(t, conn.Invoke(context.Background(), benchFullMethod, request, resp))
+	assert.Equal(t, "Hello, John", resp.Fields["greeting"].GetStringValue())
+	assert.Equal(t, 1, faults.GetFaults().Connections)
+
+	// The faults are injected in the gRPC connections only
+	faults.SetFaults(restcontrollers.ConnectionFaults{DropConnectionsPercent: 100})
+	dropped, err := grpc.Dial(addr, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer dropped.Close()
+	assert.Error(t, invokeHello(dropped))
+	assert.Equal(t, "REST", getREST())
+}
+
+func TestUnwrapTLSConn(t *testing.T) {
+	client, serverConn := net.Pipe()
+	defer client.Close()
+	tlsConn := tls.Server(serverConn, &tls.Config{})
+
+	assert.True(t, tlsConn == unwrapTLSConn(&faultConn{Conn: &cmux.MuxConn{Conn: tlsConn}}))
+	assert.Nil(t, unwrapTLSConn(&faultConn{Conn: &cmux.MuxConn{Conn: serverConn}}))
+	_, _, err := terminatedTLSCredentials{}.ServerHandshake(serverConn)
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+const (
+	// Author of the stubs loaded from files
+	stubsDirActor = "stubs-dir"
+	// Author of the default stubs made of the examples in the proto files
+	protoExamplesActor = "proto-examples"
+)
+
+// loadStubs adds the stubs in the files of the directory to the store. Stubs for unsupported methods, invalid or
+// duplicated stubs are skipped. A stub can extend the stubs loaded before it.
+func loadStubs(dir string, stubsStore stub.StubsStore, service grpchandler.MockService) error {
+	stubs, err := stub.LoadStubsFromDir(dir)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	supportedMethods := getSupportedMethods(service)
+	// The stubs can extend the stubs already stored or the previous stubs of the directory
+	candidates, err := stubsStore.GetAllStubs(ctx)
+	if err != nil {
+		return err
+	}
+	valid := make([]*stub.Stub, 0, len(stubs))
+	for _, s := range stubs {
+		s, err := stub.ResolveExtends(s, candidates)
+		if err != nil {
+			log.Warnf("Skipping stub: %s", err.Error())
+			continue
+		}
+		if !isValidStub(s, supportedMethods, service) {
+			continue
+		}
+		s.CreatedBy = stubsDirActor
+		valid = append(valid, s)
+		candidates = append(candidates, s)
+	}
+	// The stubs are published at once rather than one by one
+	loaded := 0
+	for _, err := range stubsStore.AddAll(ctx, valid) {
+		if err != nil {
+			log.Warnf("Skipping stub: %s", err.Error())
+			continue
+		}
+		loaded++
+	}
+	log.Infof("Loaded %d stubs from %s", loaded, dir)
+	all, err := stubsStore.GetAllStubs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, group := range stub.FindDuplicates(all) {
+		log.Warnf("%d stubs of %s match the same requests (see GET /stubs/duplicates)", len(group.Stubs), group.FullMethod)
+	}
+	return nil
+}
+
+// loadDefaultStubs adds the default stubs of the mock service (see grpchandler.DefaultStubsProvider) to the store,
+// after the stubs loaded from files, which replace them: the default stubs that match the same requests as a stub
+// already loaded are skipped.
+func loadDefaultStubs(stubsStore stub.StubsStore, service grpchandler.MockService) {
+	ctx := context.Background()
+	supportedMethods := getSupportedMethods(service)
+	valid := make([]*stub.Stub, 0)
+	for _, defaultStub := range grpchandler.GetDefaultStubs(service) {
+		s := defaultStub
+		if !isValidStub(&s, supportedMethods, service) {
+			continue
+		}
+		s.CreatedBy = protoExamplesActor
+		valid = append(valid, &s)
+	}
+	loaded := 0
+	for i, err := range stubsStore.AddAll(ctx, valid) {
+		if err != nil {
+			log.Debugf("Skipping default stub of %s: %s", valid[i].FullMethod, err.Error())
+			continue
+		}
+		loaded++
+	}
+	if loaded > 0 {
+		log.Infof("Loaded %d default stubs from the examples of the proto files", loaded)
+	}
+}
+
+// loadFixtures adds the fixtures in the files of the directory to the store. Stubs for unsupported methods or invalid
+// stubs are skipped, as well as the fixtures with stubs extending stubs that don't exist.
+func loadFixtures(dir string, fixturesStore stub.FixturesStore, stubsStore stub.StubsStore, service grpchandler.MockService) error {
+	fixtures, err := stub.LoadFixturesFromDir(dir)
+	if err != nil {
+		return err
+	}
+	existing, err := stubsStore.GetAllStubs(context.Background())
+	if err != nil {
+		return err
+	}
+	supportedMethods := getSupportedMethods(service)
+	for _, fixture := range fixtures {
+		if err := fixture.ResolveExtends(existing); err != nil {
+			log.Warnf("Skipping fixture %s: %s", fixture.Name, err.Error())
+			continue
+		}
+		valid := make([]*stub.Stub, 0, len(fixture.Stubs))
+		for _, s := range fixture.Stubs {
+			if isValidStub(s, supportedMethods, service) {
+				valid = append(valid, s)
+			}
+		}
+		fixture.Stubs = valid
+		fixturesStore.Save(fixture)
+	}
+	log.Infof("Loaded %d fixtures from %s", len(fixtures), dir)
+	return nil
+}
+
+func getSupportedMethods(service grpchandler.MockService) map[string]bool {
+	supportedMethods := make(map[string]bool, 0)
+	for _, method := range service.GetSupportedMethods() {
+		supportedMethods[method] = true
+	}
+	return supportedMethods
+}
+
+// isValidStub checks if the stub is valid for the supported methods, once its content is normalized (see
+// grpchandler.NormalizeStubContent), logging why it is skipped otherwise
+func isValidStub(s *stub.Stub, supportedMethods map[string]bool, service grpchandler.MockService) bool {
+	if !supportedMethods[s.FullMethod] {
+		log.Warnf("Skipping stub for unsupported method %s", s.FullMethod)
+		return false
+	}
+	if err := grpchandler.NormalizeStubContent(service, s); err != nil {
+		log.Warnf("Skipping invalid stub for method %s: %s", s.FullMethod, err.Error())
+		return false
+	}
+	if isValid, errorMessages := service.GetStubsValidator().IsValid(s); !isValid {
+		log.Warnf("Skipping invalid stub for method %s: %s", s.FullMethod, strings.Join(errorMessages, ", "))
+		return false
+	}
+	return true
+}
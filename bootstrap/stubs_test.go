@@ -0,0 +1,47 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// defaultStubsMockService is a mock service generated with default stubs
+type defaultStubsMockService struct {
+	structMockService
+	defaultStubs []stub.Stub
+}
+
+func (m defaultStubsMockService) GetDefaultStubs() []stub.Stub {
+	return m.defaultStubs
+}
+
+func TestLoadDefaultStubs(t *testing.T) {
+	newStub := func(request, response string) stub.Stub {
+		return stub.Stub{
+			FullMethod: "/acme.Orders/Get",
+			Fallback:   true,
+			Request:    &stub.StubRequest{Match: "partial", Content: stub.JsonString(request)},
+			Response:   &stub.StubResponse{Type: "success", Content: stub.JsonString(response)},
+		}
+	}
+	service := grpchandler.NewCompositeMockService([]grpchandler.MockService{defaultStubsMockService{
+		structMockService: structMockService{method: "/acme.Orders/Get"},
+		defaultStubs:      []stub.Stub{newStub(`{}`, `{"status":"OPEN"}`), newStub(`{"id":"1"}`, `{"status":"SHIPPED"}`)},
+	}})
+	stubsStore := stub.NewInMemoryStubsStore()
+	loaded := newStub(`{}`, `{"status":"CANCELLED"}`)
+	loaded.Fallback = false
+	assert.NoError(t, stubsStore.Add(context.Background(), &loaded))
+
+	loadDefaultStubs(stubsStore, service)
+	stubs, err := stubsStore.GetStubsForMethod(context.Background(), "/acme.Orders/Get")
+	assert.NoError(t, err)
+	assert.Len(t, stubs, 2)
+	// The stub loaded before is kept and matched first
+	assert.Equal(t, stub.JsonString(`{"status":"CANCELLED"}`), stubs[0].Response.Content)
+	assert.Equal(t, stub.JsonString(`{"status":"SHIPPED"}`), stubs[1].Response.Content)
+	assert.Equal(t, protoExamplesActor, stubs[1].CreatedBy)
+}
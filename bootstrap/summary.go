@@ -0,0 +1,32 @@
+package bootstrap
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"google.golang.org/grpc"
+	"strings"
+)
+
+// The calls to the services of gRPC itself (health and reflection) are not counted in the summary
+const grpcServicesPrefix = "/grpc."
+
+// The summary interceptors are the first ones, so the latency of the calls includes the delays of the others
+func summaryUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if strings.HasPrefix(info.FullMethod, grpcServicesPrefix) {
+		return handler(ctx, req)
+	}
+	ctx, call := grpchandler.GetCallSummary().Start(ctx, info.FullMethod)
+	resp, err := handler(ctx, req)
+	call.End(err)
+	return resp, err
+}
+
+func summaryStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if strings.HasPrefix(info.FullMethod, grpcServicesPrefix) {
+		return handler(srv, stream)
+	}
+	ctx, call := grpchandler.GetCallSummary().Start(stream.Context(), info.FullMethod)
+	err := handler(srv, &contextStream{ServerStream: stream, ctx: ctx})
+	call.End(err)
+	return err
+}
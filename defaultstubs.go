@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"strconv"
+	"strings"
+)
+
+// exampleTag starts an example in the comments of the methods and messages
+const exampleTag = "@example"
+
+// methodExample is an example of a method, e.g.
+//
+//	// @example {"request": {"id": "1"}, "response": {"id": "1", "status": "OPEN"}}
+//	// @example {"request": {"id": "2"}, "error": {"code": "NOT_FOUND", "message": "order 2 not found"}}
+//	rpc GetOrder(GetOrderRequest) returns (Order);
+//
+// The request is a partial match of the calls, all the calls match when it is not set.
+type methodExample struct {
+	Request  json.RawMessage     `json:"request"`
+	Response json.RawMessage     `json:"response"`
+	Error    *stub.ErrorResponse `json:"error"`
+}
+
+// examplesIn returns the JSON examples in the comments: each JSON value after an @example tag or, without tags, the
+// whole comments when they are a JSON object
+func examplesIn(comments protogen.Comments) []json.RawMessage {
+	text := strings.TrimSpace(string(comments))
+	if strings.HasPrefix(text, "{") && json.Valid([]byte(text)) {
+		return []json.RawMessage{json.RawMessage(text)}
+	}
+	examples := make([]json.RawMessage, 0)
+	parts := strings.Split(text, exampleTag)
+	for _, part := range parts[1:] {
+		// Only the first JSON value is the example, the comments can go on after it
+		var example json.RawMessage
+		if json.NewDecoder(strings.NewReader(part)).Decode(&example) == nil {
+			examples = append(examples, example)
+		} else {
+			examples = append(examples, json.RawMessage(strings.TrimSpace(part)))
+		}
+	}
+	return examples
+}
+
+// defaultStubsOf returns the default stubs of the method made of its examples, or of the example of its response
+// message when it has none. The stubs are fallbacks, matched when no other stub matches the call.
+func defaultStubsOf(service *protogen.Service, method *protogen.Method) ([]stub.Stub, error) {
+	fullMethod := fmt.Sprintf("/%s/%s", service.Desc.FullName(), method.GoName)
+	newStub := func(request json.RawMessage) stub.Stub {
+		s := stub.Stub{
+			FullMethod:  fullMethod,
+			Description: fmt.Sprintf("Example of %s in %s", method.Desc.Name(), method.Desc.ParentFile().Path()),
+			Fallback:    true,
+			Request:     &stub.StubRequest{Match: "partial", Content: "{}"},
+			Response:    &stub.StubResponse{Type: "success"},
+		}
+		if request != nil {
+			s.Request.Content = compactJSON(request)
+		}
+		return s
+	}
+	setResponse := func(s *stub.Stub, response json.RawMessage) {
+		if method.Desc.IsStreamingServer() {
+			s.Response.Stream = []stub.JsonString{compactJSON(response)}
+		} else {
+			s.Response.Content = compactJSON(response)
+		}
+	}
+
+	stubs := make([]stub.Stub, 0)
+	catchAll := false
+	for i, data := range examplesIn(method.Comments.Leading) {
+		example := methodExample{}
+		if err := json.Unmarshal(data, &example); err != nil {
+			return nil, fmt.Errorf("invalid example %d of %s: %w", i+1, method.Desc.FullName(), err)
+		}
+		if example.Request != nil {
+			if err := checkExample(example.Request, method.Input.Desc); err != nil {
+				return nil, fmt.Errorf("invalid request of example %d of %s: %w", i+1, method.Desc.FullName(), err)
+			}
+		}
+		s := newStub(example.Request)
+		switch {
+		case example.Error != nil:
+			s.Response.Type = "error"
+			s.Response.Error = example.Error
+		case example.Response != nil:
+			if err := checkExample(example.Response, method.Output.Desc); err != nil {
+				return nil, fmt.Errorf("invalid response of example %d of %s: %w", i+1, method.Desc.FullName(), err)
+			}
+			setResponse(&s, example.Response)
+		default:
+			return nil, fmt.Errorf("invalid example %d of %s: it has neither a response nor an error", i+1, method.Desc.FullName())
+		}
+		catchAll = catchAll || s.Request.Content == "{}"
+		stubs = append(stubs, s)
+	}
+	if catchAll {
+		return stubs, nil
+	}
+	if examples := examplesIn(method.Output.Comments.Leading); len(examples) > 0 {
+		if err := checkExample(examples[0], method.Output.Desc); err != nil {
+			return nil, fmt.Errorf("invalid example of %s: %w", method.Output.Desc.FullName(), err)
+		}
+		s := newStub(nil)
+		setResponse(&s, examples[0])
+		stubs = append(stubs, s)
+	}
+	return stubs, nil
+}
+
+// checkExample checks that the example is a message in the JSON mapping of protobuf
+func checkExample(example json.RawMessage, message protoreflect.MessageDescriptor) error {
+	return protojson.Unmarshal(example, dynamicpb.NewMessage(message))
+}
+
+// jsonLiteral returns the Go literal of the JSON, in backquotes when possible
+func jsonLiteral(data string) string {
+	if strconv.CanBackquote(data) {
+		return "`" + data + "`"
+	}
+	return strconv.Quote(data)
+}
+
+func compactJSON(data json.RawMessage) stub.JsonString {
+	buffer := new(bytes.Buffer)
+	if err := json.Compact(buffer, data); err != nil {
+		return stub.JsonString(data)
+	}
+	return stub.JsonString(buffer.String())
+}
+
+// genGetDefaultStubsFunction generates GetDefaultStubs (see grpchandler.DefaultStubsProvider) with the default stubs of
+// the methods of the service. The generation fails when an example is not valid.
+func (m mockServicesGenerator) genGetDefaultStubsFunction(service *protogen.Service) {
+	m.g.P("func (mock *", unexport(m.getMockServiceName(service)), ") GetDefaultStubs() []", stubPackage.Ident("Stub"), "{")
+	m.g.P("return []", stubPackage.Ident("Stub"), "{")
+	for _, method := range service.Methods {
+		stubs, err := defaultStubsOf(service, method)
+		if err != nil {
+			m.gen.Error(err)
+			continue
+		}
+		for _, s := range stubs {
+			m.g.P("{")
+			m.g.P("FullMethod: ", strconv.Quote(s.FullMethod), ",")
+			m.g.P("Description: ", strconv.Quote(s.Description), ",")
+			m.g.P("Fallback: true,")
+			m.g.P("Request: &", stubPackage.Ident("StubRequest"), "{")
+			m.g.P("Match: ", strconv.Quote(s.Request.Match), ",")
+			m.g.P("Content: ", jsonLiteral(string(s.Request.Content)), ",")
+			m.g.P("},")
+			m.g.P("Response: &", stubPackage.Ident("StubResponse"), "{")
+			m.g.P("Type: ", strconv.Quote(s.Response.Type), ",")
+			if s.Response.Content != "" {
+				m.g.P("Content: ", jsonLiteral(string(s.Response.Content)), ",")
+			}
+			if len(s.Response.Stream) > 0 {
+				m.g.P("Stream: []", stubPackage.Ident("JsonString"), "{", jsonLiteral(string(s.Response.Stream[0])), "},")
+			}
+			if s.Response.Error != nil {
+				m.g.P("Error: &", stubPackage.Ident("ErrorResponse"), "{")
+				m.g.P("Code: ", int32(s.Response.Error.Code), ",")
+				m.g.P("Message: ", strconv.Quote(s.Response.Error.Message), ",")
+				if s.Response.Error.RetryDelay != "" {
+					m.g.P("RetryDelay: ", strconv.Quote(s.Response.Error.RetryDelay), ",")
+				}
+				m.g.P("},")
+			}
+			m.g.P("},")
+			m.g.P("},")
+		}
+	}
+	m.g.P("}")
+	m.g.P("}")
+	m.g.P("")
+}
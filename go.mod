@@ -1,12 +1,35 @@
 module github.com/carvalhorr/protoc-gen-mock
 
-go 1.13
+go 1.23.0
 
 require (
-	github.com/golang/protobuf v1.4.1
+	cloud.google.com/go/longrunning v0.6.7
+	github.com/golang/protobuf v1.5.4
+	github.com/google/cel-go v0.25.0
 	github.com/gorilla/mux v1.7.4
+	github.com/graphql-go/graphql v0.8.1
 	github.com/sirupsen/logrus v1.4.2
-	github.com/stretchr/testify v1.2.2
-	google.golang.org/grpc v1.29.1
-	google.golang.org/protobuf v1.22.0
+	github.com/soheilhy/cmux v0.1.5
+	github.com/stretchr/testify v1.8.4
+	github.com/stretchr/objx v0.5.2
+	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9
+	golang.org/x/net v0.40.0
+	google.golang.org/genproto v0.0.0-20250603155806-513f23925822
+	google.golang.org/genproto/googleapis/api v0.0.0-20250528174236-200df99c418a
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250528174236-200df99c418a
+	google.golang.org/grpc v1.72.1
+	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	cel.dev/expr v0.23.1 // indirect
+	github.com/antlr4-go/antlr/v4 v4.13.0 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stoewer/go-strcase v1.2.0 // indirect
+	golang.org/x/exp v0.0.0-20230515195305-f3d0a9c9a5cc // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.25.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
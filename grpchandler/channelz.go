@@ -0,0 +1,197 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Channelz reads a simplified view of the channelz data of the process (https://github.com/grpc/proposal/blob/master/A14-channelz.md)
+// through the channelz service: the gRPC servers with their connections and the channels to other services.
+type Channelz struct {
+	Client channelzpb.ChannelzClient
+	// HiddenAddress is the address of the listener and the target of the channel used to read the data, which are not
+	// reported
+	HiddenAddress string
+}
+
+// ChannelzCalls counts the calls of a server or a channel
+type ChannelzCalls struct {
+	Started     int64      `json:"started"`
+	Succeeded   int64      `json:"succeeded"`
+	Failed      int64      `json:"failed"`
+	LastStarted *time.Time `json:"lastStarted,omitempty"`
+}
+
+// ChannelzConnection is a connection of a client to a server, with the HTTP/2 streams (i.e. calls) it carried
+type ChannelzConnection struct {
+	ID                  int64      `json:"id"`
+	Local               string     `json:"local"`
+	Remote              string     `json:"remote"`
+	StreamsStarted      int64      `json:"streamsStarted"`
+	StreamsSucceeded    int64      `json:"streamsSucceeded"`
+	StreamsFailed       int64      `json:"streamsFailed"`
+	MessagesSent        int64      `json:"messagesSent"`
+	MessagesReceived    int64      `json:"messagesReceived"`
+	KeepAlivesSent      int64      `json:"keepAlivesSent"`
+	LastStreamCreated   *time.Time `json:"lastStreamCreated,omitempty"`
+	LastMessageSent     *time.Time `json:"lastMessageSent,omitempty"`
+	LastMessageReceived *time.Time `json:"lastMessageReceived,omitempty"`
+}
+
+type ChannelzServer struct {
+	ID          int64                 `json:"id"`
+	Listening   []string              `json:"listening"`
+	Calls       ChannelzCalls         `json:"calls"`
+	Connections []*ChannelzConnection `json:"connections"`
+}
+
+// ChannelzChannel is a channel of the process to another service, e.g. the upstream of the contract verification
+type ChannelzChannel struct {
+	ID     int64         `json:"id"`
+	Target string        `json:"target"`
+	State  string        `json:"state"`
+	Calls  ChannelzCalls `json:"calls"`
+}
+
+type ChannelzView struct {
+	Servers  []*ChannelzServer  `json:"servers"`
+	Channels []*ChannelzChannel `json:"channels"`
+}
+
+// GetView reads the servers, their connections and the channels
+func (c *Channelz) GetView(ctx context.Context) (*ChannelzView, error) {
+	view := &ChannelzView{Servers: make([]*ChannelzServer, 0), Channels: make([]*ChannelzChannel, 0)}
+	for start, end := int64(0), false; !end; {
+		response, err := c.Client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range response.Server {
+			start = server.Ref.ServerId + 1
+			if c.isHiddenServer(server) {
+				continue
+			}
+			s, err := c.getServer(ctx, server)
+			if err != nil {
+				return nil, err
+			}
+			view.Servers = append(view.Servers, s)
+		}
+		end = response.End || len(response.Server) == 0
+	}
+	for start, end := int64(0), false; !end; {
+		response, err := c.Client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, channel := range response.Channel {
+			start = channel.Ref.ChannelId + 1
+			if channel.Data.Target == c.HiddenAddress {
+				continue
+			}
+			view.Channels = append(view.Channels, &ChannelzChannel{
+				ID:     channel.Ref.ChannelId,
+				Target: channel.Data.Target,
+				State:  channel.Data.GetState().GetState().String(),
+				Calls:  channelzCalls(channel.Data.CallsStarted, channel.Data.CallsSucceeded, channel.Data.CallsFailed, channel.Data.LastCallStartedTimestamp),
+			})
+		}
+		end = response.End || len(response.Channel) == 0
+	}
+	return view, nil
+}
+
+func (c *Channelz) isHiddenServer(server *channelzpb.Server) bool {
+	for _, socket := range server.ListenSocket {
+		if socket.Name == c.HiddenAddress {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Channelz) getServer(ctx context.Context, server *channelzpb.Server) (*ChannelzServer, error) {
+	s := &ChannelzServer{
+		ID:          server.Ref.ServerId,
+		Listening:   make([]string, 0, len(server.ListenSocket)),
+		Calls:       channelzCalls(server.Data.CallsStarted, server.Data.CallsSucceeded, server.Data.CallsFailed, server.Data.LastCallStartedTimestamp),
+		Connections: make([]*ChannelzConnection, 0),
+	}
+	for _, socket := range server.ListenSocket {
+		s.Listening = append(s.Listening, socket.Name)
+	}
+	for start, end := int64(0), false; !end; {
+		response, err := c.Client.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: s.ID, StartSocketId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range response.SocketRef {
+			start = ref.SocketId + 1
+			socket, err := c.Client.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: ref.SocketId})
+			if err != nil {
+				// The connection was closed meanwhile
+				continue
+			}
+			s.Connections = append(s.Connections, channelzConnection(socket.Socket))
+		}
+		end = response.End || len(response.SocketRef) == 0
+	}
+	return s, nil
+}
+
+func channelzConnection(socket *channelzpb.Socket) *ChannelzConnection {
+	data := socket.Data
+	connection := &ChannelzConnection{
+		ID:                  socket.Ref.SocketId,
+		Local:               formatChannelzAddress(socket.Local),
+		Remote:              formatChannelzAddress(socket.Remote),
+		StreamsStarted:      data.StreamsStarted,
+		StreamsSucceeded:    data.StreamsSucceeded,
+		StreamsFailed:       data.StreamsFailed,
+		MessagesSent:        data.MessagesSent,
+		MessagesReceived:    data.MessagesReceived,
+		KeepAlivesSent:      data.KeepAlivesSent,
+		LastStreamCreated:   channelzTime(data.LastRemoteStreamCreatedTimestamp),
+		LastMessageSent:     channelzTime(data.LastMessageSentTimestamp),
+		LastMessageReceived: channelzTime(data.LastMessageReceivedTimestamp),
+	}
+	if local := channelzTime(data.LastLocalStreamCreatedTimestamp); local != nil &&
+		(connection.LastStreamCreated == nil || local.After(*connection.LastStreamCreated)) {
+		connection.LastStreamCreated = local
+	}
+	return connection
+}
+
+func channelzCalls(started, succeeded, failed int64, lastStarted *timestamp.Timestamp) ChannelzCalls {
+	return ChannelzCalls{Started: started, Succeeded: succeeded, Failed: failed, LastStarted: channelzTime(lastStarted)}
+}
+
+// channelzTime converts the timestamp, which is not set (or zero) when the event never happened
+func channelzTime(ts *timestamp.Timestamp) *time.Time {
+	if ts == nil || (ts.Seconds == 0 && ts.Nanos == 0) {
+		return nil
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+func formatChannelzAddress(address *channelzpb.Address) string {
+	switch {
+	case address.GetTcpipAddress() != nil:
+		tcp := address.GetTcpipAddress()
+		return net.JoinHostPort(net.IP(tcp.IpAddress).String(), strconv.Itoa(int(tcp.Port)))
+	case address.GetUdsAddress() != nil:
+		return address.GetUdsAddress().Filename
+	case address.GetOtherAddress() != nil:
+		return address.GetOtherAddress().Name
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelzservice "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"net"
+	"testing"
+)
+
+func TestChannelz_GetView(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	channelzservice.RegisterChannelzServiceToServer(server)
+	go server.Serve(listener)
+	defer server.Stop()
+	address := listener.Addr().String()
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.NoError(t, err)
+
+	channelz := &Channelz{Client: channelzpb.NewChannelzClient(conn), HiddenAddress: "hidden"}
+	view, err := channelz.GetView(context.Background())
+	assert.NoError(t, err)
+	var observed *ChannelzServer
+	for _, s := range view.Servers {
+		if len(s.Listening) == 1 && s.Listening[0] == address {
+			observed = s
+		}
+	}
+	if assert.NotNil(t, observed) {
+		assert.True(t, observed.Calls.Succeeded >= 1)
+		assert.NotNil(t, observed.Calls.LastStarted)
+		if assert.Len(t, observed.Connections, 1) {
+			assert.Equal(t, address, observed.Connections[0].Local)
+			assert.True(t, observed.Connections[0].StreamsSucceeded >= 1)
+		}
+	}
+	targets := make([]string, 0)
+	for _, channel := range view.Channels {
+		targets = append(targets, channel.Target)
+	}
+	assert.Contains(t, targets, address)
+
+	channelz.HiddenAddress = address
+	view, err = channelz.GetView(context.Background())
+	assert.NoError(t, err)
+	for _, s := range view.Servers {
+		assert.NotEqual(t, []string{address}, s.Listening)
+	}
+}
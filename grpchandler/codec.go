@@ -0,0 +1,50 @@
+package grpchandler
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/golang/protobuf/proto"
+)
+
+// RawFrame is a message sent as it is, without being marshalled, e.g. to send bytes that are not a valid message
+type RawFrame []byte
+
+// Codec is the codec of the protobuf messages that also sends the raw frames. The server must use it (see
+// grpc.CustomCodec) for the frame faults of the stubs, which fail with INTERNAL otherwise.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	if frame, isRaw := v.(RawFrame); isRaw {
+		return frame, nil
+	}
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	return proto.Marshal(message)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	return proto.Unmarshal(data, message)
+}
+
+func (Codec) Name() string {
+	return "proto"
+}
+
+func (c Codec) String() string {
+	return c.Name()
+}
+
+// withFrameFault returns the frame sent instead of the message with the index given when the stub has a frame fault
+// for it, the message otherwise
+func withFrameFault(s *stub.Stub, index int, message interface{}) interface{} {
+	if s == nil || s.Response == nil || s.Response.FrameFault == nil || s.Response.FrameFault.Message != index {
+		return message
+	}
+	return RawFrame(s.Response.FrameFault.Encode())
+}
@@ -0,0 +1,59 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func receiveNames(t *testing.T, frameFault *stub.FrameFault) ([]string, error) {
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: serverStreamMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response: &stub.StubResponse{
+			Type:       "success",
+			Stream:     []stub.JsonString{"{\"name\":\"first\"}", "{\"name\":\"second\"}"},
+			FrameFault: frameFault,
+		},
+	})
+	defer stop()
+
+	stream, err := conn.NewStream(context.Background(), &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+	received := make([]string, 0)
+	for {
+		message := new(structpb.Struct)
+		if err := stream.RecvMsg(message); err != nil {
+			return received, err
+		}
+		received = append(received, message.Fields["name"].GetStringValue())
+	}
+}
+
+func TestMockStreamHandler_FrameFault(t *testing.T) {
+	received, err := receiveNames(t, &stub.FrameFault{Type: stub.FrameFaultCorrupt, Message: 1})
+	assert.Equal(t, []string{"first"}, received)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	received, err = receiveNames(t, &stub.FrameFault{Type: stub.FrameFaultOversized})
+	assert.Empty(t, received)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestCodec_Marshal(t *testing.T) {
+	data, err := Codec{}.Marshal(RawFrame{0x0f})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0f}, data)
+
+	data, err = Codec{}.Marshal(newStruct("John"))
+	assert.NoError(t, err)
+	message := new(structpb.Struct)
+	assert.NoError(t, Codec{}.Unmarshal(data, message))
+	assert.Equal(t, "John", message.Fields["name"].GetStringValue())
+}
@@ -0,0 +1,189 @@
+package grpchandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ContractMatch   = "match"
+	ContractDrift   = "drift"
+	ContractSkipped = "skipped"
+	ContractError   = "error"
+)
+
+// Array indexes in the paths of the fields, e.g. [0] in response.content.items[0].id
+var arrayIndexPattern = regexp.MustCompile(`\[[0-9]*\*?\]`)
+
+// ContractOptions controls how the stubs are verified against the real service
+type ContractOptions struct {
+	// IgnoredFields are the paths of the fields that are not compared, e.g. response.content.updatedAt or
+	// response.error.message. The array indexes can be omitted to ignore the field in all the items, e.g.
+	// response.content.items.id.
+	IgnoredFields []string
+	// Timeout of each call to the real service. There is no timeout when it is 0.
+	Timeout time.Duration
+}
+
+// ContractResult is the comparison of the response of a stub with the response of the real service to its request
+type ContractResult struct {
+	StubID      string           `json:"stubId"`
+	FullMethod  string           `json:"fullMethod"`
+	Description string           `json:"description,omitempty"`
+	Status      string           `json:"status"`
+	Diffs       []stub.FieldDiff `json:"diffs,omitempty"`
+	// Reason explains why the stub was skipped or couldn't be verified
+	Reason string `json:"reason,omitempty"`
+}
+
+type ContractReport struct {
+	// Consistent is true when the responses of all the stubs verified match the real service
+	Consistent bool              `json:"consistent"`
+	Results    []*ContractResult `json:"results"`
+}
+
+// JUnit returns the report as a JUnit test suite with a test case per stub, failed when the stub drifted from the real
+// service or couldn't be verified
+func (r *ContractReport) JUnit() *util.JUnitTestSuite {
+	testCases := make([]util.JUnitTestCase, 0, len(r.Results))
+	for _, result := range r.Results {
+		name := result.StubID
+		if result.Description != "" {
+			name += " " + result.Description
+		}
+		testCase := util.JUnitTestCase{Name: name, ClassName: "contract." + result.FullMethod}
+		switch result.Status {
+		case ContractSkipped:
+			testCase.Skipped = &util.JUnitSkipped{Message: result.Reason}
+		case ContractError:
+			testCase.Failure = &util.JUnitFailure{Message: result.Reason, Text: result.Reason}
+		case ContractDrift:
+			diffs := make([]string, 0, len(result.Diffs))
+			for _, diff := range result.Diffs {
+				oldValue, _ := json.Marshal(diff.Old)
+				newValue, _ := json.Marshal(diff.New)
+				diffs = append(diffs, fmt.Sprintf("%s: %s != %s", diff.Path, oldValue, newValue))
+			}
+			testCase.Failure = &util.JUnitFailure{
+				Message: fmt.Sprintf("stub %s drifted from the real service", result.StubID),
+				Text:    strings.Join(diffs, "\n"),
+			}
+		}
+		testCases = append(testCases, testCase)
+	}
+	return util.NewJUnitTestSuite("contract", testCases)
+}
+
+// VerifyContracts calls the real service (through conn) with the request of each stub and compares the response, or
+// the error, with the one of the stub. The stubs of streaming and scripted responses are skipped. The results are
+// sorted by method and stub ID.
+func VerifyContracts(ctx context.Context, conn grpc.ClientConnInterface, service MockService, stubs []*stub.Stub,
+	options ContractOptions) *ContractReport {
+	report := &ContractReport{
+		Consistent: true,
+		Results:    make([]*ContractResult, 0, len(stubs)),
+	}
+	for _, s := range stubs {
+		result := verifyContract(ctx, conn, service, s, options)
+		report.Consistent = report.Consistent && result.Status != ContractDrift && result.Status != ContractError
+		report.Results = append(report.Results, result)
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		if report.Results[i].FullMethod != report.Results[j].FullMethod {
+			return report.Results[i].FullMethod < report.Results[j].FullMethod
+		}
+		return report.Results[i].StubID < report.Results[j].StubID
+	})
+	return report
+}
+
+func verifyContract(ctx context.Context, conn grpc.ClientConnInterface, service MockService, s *stub.Stub,
+	options ContractOptions) *ContractResult {
+	result := &ContractResult{StubID: s.ID, FullMethod: s.FullMethod, Description: s.Description, Status: ContractMatch}
+	switch {
+	case len(s.Response.Stream) > 0:
+		result.Status, result.Reason = ContractSkipped, "streaming responses are not verified"
+		return result
+	case s.Response.Type == stub.ResponseTypeScript:
+		result.Status, result.Reason = ContractSkipped, "scripted responses are not verified"
+		return result
+	}
+	request, _ := service.GetRequestInstance(s.FullMethod).(proto.Message)
+	if request == nil {
+		result.Status, result.Reason = ContractError, "the method is not supported"
+		return result
+	}
+	requestJson := s.Request.Content.WithoutUnsetFields().String()
+	if requestJson == "" {
+		requestJson = "{}"
+	}
+	if err := protojson.Unmarshal([]byte(requestJson), request); err != nil {
+		result.Status, result.Reason = ContractError, fmt.Sprintf("invalid request: %s", err.Error())
+		return result
+	}
+	md := metadata.MD(s.Request.Metadata)
+	expected, expectedErr := stub.GetResponse(stub.WithReadOnlyState(metadata.NewIncomingContext(ctx, md)), s, requestJson,
+		service.GetResponseInstance(s.FullMethod))
+	if _, isStatus := status.FromError(expectedErr); !isStatus {
+		result.Status, result.Reason = ContractError, fmt.Sprintf("invalid stub response: %s", expectedErr.Error())
+		return result
+	}
+	callCtx := metadata.NewOutgoingContext(ctx, md)
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(callCtx, options.Timeout)
+		defer cancel()
+	}
+	actual := service.GetResponseInstance(s.FullMethod)
+	actualErr := conn.Invoke(callCtx, s.FullMethod, request, actual)
+	for _, diff := range stub.DiffValues("response", contractResponse(expected, expectedErr), contractResponse(actual, actualErr)) {
+		if !isIgnoredField(diff.Path, options.IgnoredFields) {
+			result.Diffs = append(result.Diffs, diff)
+		}
+	}
+	if len(result.Diffs) > 0 {
+		result.Status = ContractDrift
+	}
+	return result
+}
+
+// contractResponse returns the response as a generic JSON value with the content or the error to be compared
+func contractResponse(response interface{}, err error) interface{} {
+	if err != nil {
+		st := status.Convert(err)
+		return map[string]interface{}{"error": map[string]interface{}{
+			"code":    stub.StatusCode(st.Code()).String(),
+			"message": st.Message(),
+		}}
+	}
+	var content interface{}
+	if message, ok := response.(proto.Message); ok {
+		data, _ := protojson.Marshal(message)
+		json.Unmarshal(data, &content)
+	}
+	return map[string]interface{}{"content": content}
+}
+
+func isIgnoredField(path string, ignoredFields []string) bool {
+	withoutIndexes := arrayIndexPattern.ReplaceAllString(path, "")
+	for _, ignored := range ignoredFields {
+		for _, p := range []string{path, withoutIndexes} {
+			if p == ignored || strings.HasPrefix(p, ignored+".") || strings.HasPrefix(p, ignored+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
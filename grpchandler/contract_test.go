@@ -0,0 +1,73 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+// upstreamConn answers the calls with the responses by request, in JSON, or NotFound
+type upstreamConn struct {
+	responses map[string]string
+}
+
+func (c upstreamConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	request, _ := protojson.Marshal(args.(proto.Message))
+	response, found := c.responses[string(request)]
+	if !found {
+		return status.Error(codes.NotFound, "not found")
+	}
+	return protojson.Unmarshal([]byte(response), reply.(proto.Message))
+}
+
+func (c upstreamConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "not implemented")
+}
+
+func TestVerifyContracts(t *testing.T) {
+	service := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }, valid: true}
+	conn := upstreamConn{responses: map[string]string{
+		"{\"id\":1}": "{\"id\":1,\"status\":\"OPEN\",\"updatedAt\":\"2020-01-01\"}",
+		"{\"id\":2}": "{\"id\":2,\"status\":\"CLOSED\",\"items\":[{\"sku\":\"a\"}]}",
+	}}
+	newStub := func(id, request string, response *stub.StubResponse) *stub.Stub {
+		return &stub.Stub{
+			ID:         id,
+			FullMethod: "/acme.v1.Orders/Get",
+			Request:    &stub.StubRequest{Match: "partial", Content: stub.JsonString(request)},
+			Response:   response,
+		}
+	}
+	stubs := []*stub.Stub{
+		newStub("1", "{\"id\":1,\"note\":\"${unset}\"}", &stub.StubResponse{Type: "success", Content: "{\"id\":\"${request.id}\",\"status\":\"OPEN\"}"}),
+		newStub("2", "{\"id\":2}", &stub.StubResponse{Type: "success", Content: "{\"id\":2,\"status\":\"OPEN\",\"items\":[{\"sku\":\"b\"}]}"}),
+		newStub("3", "{\"id\":3}", &stub.StubResponse{Type: "error", Error: &stub.ErrorResponse{Code: stub.StatusCode(codes.NotFound), Message: "order not found"}}),
+		newStub("4", "{\"id\":4}", &stub.StubResponse{Type: "success", Content: "{}", Stream: []stub.JsonString{"{}"}}),
+	}
+
+	report := VerifyContracts(context.Background(), conn, service, stubs, ContractOptions{
+		IgnoredFields: []string{"response.content.updatedAt", "response.error.message", "response.content.items.sku"},
+	})
+	assert.False(t, report.Consistent)
+	assert.Equal(t, ContractMatch, report.Results[0].Status)
+	assert.Equal(t, ContractDrift, report.Results[1].Status)
+	assert.Equal(t, []stub.FieldDiff{{Path: "response.content.status", Old: "OPEN", New: "CLOSED"}}, report.Results[1].Diffs)
+	assert.Equal(t, ContractMatch, report.Results[2].Status)
+	assert.Equal(t, ContractSkipped, report.Results[3].Status)
+	suite := report.JUnit()
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, `response.content.status: "OPEN" != "CLOSED"`, suite.TestCases[1].Failure.Text)
+
+	report = VerifyContracts(context.Background(), conn, service, stubs[2:3], ContractOptions{})
+	assert.False(t, report.Consistent)
+	assert.Equal(t, []stub.FieldDiff{{Path: "response.error.message", Old: "order not found", New: "not found"}}, report.Results[0].Diffs)
+}
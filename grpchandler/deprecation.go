@@ -0,0 +1,104 @@
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metadata of the response header of the calls to the deprecated methods, named after the HTTP headers Deprecation,
+// Sunset (RFC 8594) and Warning
+const (
+	DeprecationHeader = "deprecation"
+	SunsetHeader      = "sunset"
+	WarningHeader     = "warning"
+)
+
+// MethodDeprecation marks a method as deprecated, to test how the clients handle the sunset of an API: the calls get
+// the deprecation headers or, once the method is unavailable, fail with UNIMPLEMENTED, whatever the stubs.
+type MethodDeprecation struct {
+	// Method is a full method (/package.Service/Method) or all the methods of a service (/package.Service/*)
+	Method string `json:"method"`
+	// Unavailable makes the calls fail with UNIMPLEMENTED. They are served with the deprecation headers otherwise.
+	Unavailable bool `json:"unavailable,omitempty"`
+	// Message is the warning or the message of the error, a default one when empty
+	Message string `json:"message,omitempty"`
+	// Sunset is the date the method is removed, sent in the sunset header when set, e.g. Sat, 01 Mar 2025 00:00:00 GMT
+	Sunset string `json:"sunset,omitempty"`
+}
+
+func (d MethodDeprecation) Validate() error {
+	if !strings.HasPrefix(d.Method, "/") || strings.Count(d.Method, "/") != 2 {
+		return fmt.Errorf("invalid deprecated method '%s': expected /package.Service/Method or /package.Service/*", d.Method)
+	}
+	return nil
+}
+
+func (d MethodDeprecation) message(fullMethod string) string {
+	switch {
+	case d.Message != "":
+		return d.Message
+	case d.Unavailable:
+		return fmt.Sprintf("method %s is no longer available", fullMethod)
+	default:
+		return fmt.Sprintf("method %s is deprecated", fullMethod)
+	}
+}
+
+// MethodDeprecations keeps the methods deprecated. It is safe for concurrent use.
+type MethodDeprecations struct {
+	deprecations []MethodDeprecation
+	mutex        sync.RWMutex
+}
+
+var methodDeprecations = new(MethodDeprecations)
+
+// GetMethodDeprecations returns the method deprecations used by the mock handlers
+func GetMethodDeprecations() *MethodDeprecations {
+	return methodDeprecations
+}
+
+// Configure replaces the methods deprecated. The first deprecation that applies to a method is used.
+func (d *MethodDeprecations) Configure(deprecations []MethodDeprecation) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.deprecations = append([]MethodDeprecation(nil), deprecations...)
+}
+
+// GetAll returns the methods deprecated
+func (d *MethodDeprecations) GetAll() []MethodDeprecation {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return append(make([]MethodDeprecation, 0, len(d.deprecations)), d.deprecations...)
+}
+
+// check returns the context with the deprecation headers of the method, if deprecated, and the error of the calls to
+// it when it is unavailable
+func (d *MethodDeprecations) check(ctx context.Context, fullMethod string) (context.Context, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	for _, deprecation := range d.deprecations {
+		if !matchesMethod(deprecation.Method, fullMethod) {
+			continue
+		}
+		message := deprecation.message(fullMethod)
+		md := metadata.Pairs(DeprecationHeader, "true", WarningHeader, "299 - "+strconv.Quote(message))
+		if deprecation.Sunset != "" {
+			md.Set(SunsetHeader, deprecation.Sunset)
+		}
+		ctx = WithResponseHeader(ctx, md)
+		if deprecation.Unavailable {
+			return ctx, status.Error(codes.Unimplemented, message)
+		}
+		return ctx, nil
+	}
+	return ctx, nil
+}
@@ -0,0 +1,41 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestMethodDeprecations_Check(t *testing.T) {
+	deprecations := new(MethodDeprecations)
+	deprecations.Configure([]MethodDeprecation{
+		{Method: "/acme.v1.Orders/ListLegacy", Sunset: "Sat, 01 Mar 2025 00:00:00 GMT"},
+		{Method: "/acme.v1beta.Orders/*", Unavailable: true},
+		{Method: "/acme.v1.Orders/*", Message: "use acme.v2.Orders"},
+	})
+
+	ctx, err := deprecations.check(context.Background(), "/acme.v1.Orders/ListLegacy")
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.Pairs("deprecation", "true", "warning", `299 - "method /acme.v1.Orders/ListLegacy is deprecated"`,
+		"sunset", "Sat, 01 Mar 2025 00:00:00 GMT"), responseHeader(ctx))
+
+	ctx, err = deprecations.check(context.Background(), "/acme.v1.Orders/Get")
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.Pairs("deprecation", "true", "warning", `299 - "use acme.v2.Orders"`), responseHeader(ctx))
+
+	ctx, err = deprecations.check(context.Background(), "/acme.v1beta.Orders/Get")
+	assert.EqualError(t, err, "rpc error: code = Unimplemented desc = method /acme.v1beta.Orders/Get is no longer available")
+	assert.Equal(t, []string{"true"}, responseHeader(ctx).Get(DeprecationHeader))
+
+	ctx, err = deprecations.check(context.Background(), "/acme.v2.Orders/Get")
+	assert.NoError(t, err)
+	assert.Nil(t, responseHeader(ctx))
+}
+
+func TestMethodDeprecation_Validate(t *testing.T) {
+	assert.NoError(t, MethodDeprecation{Method: "/acme.v1.Orders/Get"}.Validate())
+	assert.NoError(t, MethodDeprecation{Method: "/acme.v1.Orders/*"}.Validate())
+	assert.EqualError(t, MethodDeprecation{Method: "acme.v1.Orders"}.Validate(),
+		"invalid deprecated method 'acme.v1.Orders': expected /package.Service/Method or /package.Service/*")
+}
@@ -0,0 +1,179 @@
+package grpchandler
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+	"sync/atomic"
+)
+
+// FieldMaskTrimming prunes the responses to the paths of the field mask of the request (e.g. read_mask), so that a
+// stub with the full resource answers the calls with any mask. The mask is any field of the request with a FieldMask
+// message, except update_mask which selects the fields to change. The paths apply to the response, or to each item of
+// its repeated fields with messages (e.g. the resources of a list call) when they are not fields of the response. The
+// responses are not changed when the mask is empty or has the path *. It is safe for concurrent use.
+type FieldMaskTrimming struct {
+	enabled int32
+}
+
+// fieldMaskTree has the fields selected by the paths of a mask. The fields without children are selected whole.
+type fieldMaskTree map[string]fieldMaskTree
+
+var fieldMaskTrimming = new(FieldMaskTrimming)
+
+// GetFieldMaskTrimming returns the field mask trimming used by the mock handlers
+func GetFieldMaskTrimming() *FieldMaskTrimming {
+	return fieldMaskTrimming
+}
+
+// Configure enables or disables the trimming of the responses
+func (f *FieldMaskTrimming) Configure(enabled bool) {
+	atomic.StoreInt32(&f.enabled, boolToInt32(enabled))
+}
+
+func (f *FieldMaskTrimming) IsEnabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+// trim prunes the response to the field mask of the request when the trimming is enabled
+func (f *FieldMaskTrimming) trim(req, resp interface{}) {
+	request, isMessage := req.(proto.Message)
+	response, isResponseMessage := resp.(proto.Message)
+	if !f.IsEnabled() || !isMessage || !isResponseMessage {
+		return
+	}
+	tree := newFieldMaskTree(readMaskPaths(request.ProtoReflect()))
+	if tree == nil {
+		return
+	}
+	message := response.ProtoReflect()
+	if tree.selects(message.Descriptor()) {
+		tree.prune(message)
+		return
+	}
+	fields := message.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if !field.IsList() || field.Kind() != protoreflect.MessageKind || !tree.selects(field.Message()) {
+			continue
+		}
+		list := message.Get(field).List()
+		for j := 0; j < list.Len(); j++ {
+			tree.prune(list.Get(j).Message())
+		}
+	}
+}
+
+// readMaskPaths returns the paths of the field masks of the request, other than update_mask
+func readMaskPaths(request protoreflect.Message) []string {
+	var paths []string
+	fields := request.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Name() != "update_mask" && field.Kind() == protoreflect.MessageKind && !field.IsList() &&
+			field.Message().Name() == "FieldMask" {
+			paths = append(paths, maskPaths(request, field)...)
+		}
+	}
+	return paths
+}
+
+// maskPaths returns the paths of the field mask in the field of the request
+func maskPaths(request protoreflect.Message, mask protoreflect.FieldDescriptor) []string {
+	if mask == nil || mask.Kind() != protoreflect.MessageKind || !request.Has(mask) {
+		return nil
+	}
+	pathsField := mask.Message().Fields().ByName("paths")
+	if pathsField == nil || !pathsField.IsList() || pathsField.Kind() != protoreflect.StringKind {
+		return nil
+	}
+	list := request.Get(mask).Message().Get(pathsField).List()
+	paths := make([]string, 0, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		paths = append(paths, list.Get(i).String())
+	}
+	return paths
+}
+
+// newFieldMaskTree returns the tree of the paths, or nil when they select everything
+func newFieldMaskTree(paths []string) fieldMaskTree {
+	if len(paths) == 0 {
+		return nil
+	}
+	tree := make(fieldMaskTree)
+	for _, path := range paths {
+		if path == "*" {
+			return nil
+		}
+		node := tree
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			child, exists := node[name]
+			if exists && child == nil {
+				// A parent of the field is already selected whole
+				break
+			}
+			if !exists {
+				child = make(fieldMaskTree)
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// selects checks if the top level paths are fields of the message
+func (t fieldMaskTree) selects(message protoreflect.MessageDescriptor) bool {
+	for name := range t {
+		if maskField(message, name) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// prune clears the fields of the message not selected by the tree
+func (t fieldMaskTree) prune(message protoreflect.Message) {
+	var cleared []protoreflect.FieldDescriptor
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		children, selected := t[string(field.Name())]
+		if !selected {
+			children, selected = t[field.JSONName()]
+		}
+		switch {
+		case !selected:
+			cleared = append(cleared, field)
+		case children == nil || field.Kind() != protoreflect.MessageKind:
+		case field.IsList():
+			for i := 0; i < value.List().Len(); i++ {
+				children.prune(value.List().Get(i).Message())
+			}
+		case field.IsMap():
+			if field.MapValue().Kind() == protoreflect.MessageKind {
+				value.Map().Range(func(_ protoreflect.MapKey, entry protoreflect.Value) bool {
+					children.prune(entry.Message())
+					return true
+				})
+			}
+		default:
+			children.prune(value.Message())
+		}
+		return true
+	})
+	for _, field := range cleared {
+		message.Clear(field)
+	}
+}
+
+// maskField finds the field of a path, by its name or its JSON name
+func maskField(message protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if field := message.Fields().ByName(protoreflect.Name(name)); field != nil {
+		return field
+	}
+	return message.Fields().ByJSONName(name)
+}
@@ -0,0 +1,75 @@
+package grpchandler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+)
+
+const fieldMaskProto = `{
+  "name": "acme/v1/fieldmask.proto",
+  "package": "acme.v1",
+  "syntax": "proto3",
+  "messageType": [
+    {"name": "Customer", "field": [
+      {"name": "id", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "id"},
+      {"name": "email", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "email"}]},
+    {"name": "Order", "field": [
+      {"name": "name", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "name"},
+      {"name": "total", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_INT64", "jsonName": "total"},
+      {"name": "customer", "number": 3, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Customer", "jsonName": "customer"},
+      {"name": "delivery_date", "number": 4, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "deliveryDate"}]},
+    {"name": "FieldMask", "field": [
+      {"name": "paths", "number": 1, "label": "LABEL_REPEATED", "type": "TYPE_STRING", "jsonName": "paths"}]},
+    {"name": "GetOrderRequest", "field": [
+      {"name": "name", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "name"},
+      {"name": "read_mask", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.FieldMask", "jsonName": "readMask"},
+      {"name": "update_mask", "number": 3, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.FieldMask", "jsonName": "updateMask"}]},
+    {"name": "ListOrdersResponse", "field": [
+      {"name": "orders", "number": 1, "label": "LABEL_REPEATED", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Order", "jsonName": "orders"},
+      {"name": "next_page_token", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "nextPageToken"}]}
+  ]
+}`
+
+func TestFieldMaskTrimming(t *testing.T) {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	assert.NoError(t, protojson.Unmarshal([]byte(fieldMaskProto), fdp))
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	newMessage := func(name, json string) *dynamicpb.Message {
+		message := dynamicpb.NewMessage(file.Messages().ByName(protoreflect.Name(name)))
+		assert.NoError(t, protojson.Unmarshal([]byte(json), message))
+		return message
+	}
+	order := `{"name": "orders/1", "total": "120", "customer": {"id": "c1", "email": "jane@example.com"}, "deliveryDate": "2020-05-17"}`
+	trim := func(trimming *FieldMaskTrimming, request, response, responseJson string) string {
+		resp := newMessage(response, responseJson)
+		trimming.trim(newMessage("GetOrderRequest", request), resp)
+		json, err := protojson.Marshal(resp)
+		assert.NoError(t, err)
+		return string(json)
+	}
+
+	trimming := new(FieldMaskTrimming)
+	assert.JSONEq(t, order, trim(trimming, `{"readMask": {"paths": ["name"]}}`, "Order", order))
+
+	trimming.Configure(true)
+	assert.JSONEq(t, `{"name": "orders/1", "customer": {"id": "c1"}}`,
+		trim(trimming, `{"readMask": {"paths": ["name", "customer.id"]}}`, "Order", order))
+	assert.JSONEq(t, `{"customer": {"id": "c1", "email": "jane@example.com"}, "deliveryDate": "2020-05-17"}`,
+		trim(trimming, `{"readMask": {"paths": ["customer.id", "customer", "deliveryDate"]}}`, "Order", order))
+	// The resources of the list
+	assert.JSONEq(t, `{"orders": [{"total": "120"}, {"total": "120"}], "nextPageToken": "2"}`,
+		trim(trimming, `{"readMask": {"paths": ["total"]}}`, "ListOrdersResponse", `{"orders": [`+order+`, `+order+`], "nextPageToken": "2"}`))
+
+	// Not trimmed
+	assert.JSONEq(t, order, trim(trimming, `{"readMask": {"paths": ["*"]}}`, "Order", order))
+	assert.JSONEq(t, order, trim(trimming, `{"readMask": {}}`, "Order", order))
+	assert.JSONEq(t, order, trim(trimming, `{"updateMask": {"paths": ["name"]}}`, "Order", order))
+	assert.JSONEq(t, order, trim(trimming, `{"readMask": {"paths": ["unknown"]}}`, "Order", order))
+}
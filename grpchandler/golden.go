@@ -0,0 +1,248 @@
+package grpchandler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GoldenResponse is the response served to a request, as kept in a golden file
+type GoldenResponse struct {
+	FullMethod string          `json:"fullMethod"`
+	Request    json.RawMessage `json:"request"`
+	StubID     string          `json:"stubId"`
+	// Response has the content of the response or the error the call failed with (see contractResponse)
+	Response interface{} `json:"response"`
+}
+
+// GoldenMismatch is a response served that differs from the golden one
+type GoldenMismatch struct {
+	File   string           `json:"file"`
+	Golden GoldenResponse   `json:"golden"`
+	Served GoldenResponse   `json:"served"`
+	Diffs  []stub.FieldDiff `json:"diffs"`
+}
+
+// GoldenReport describes the responses checked against the golden files since the last reset
+type GoldenReport struct {
+	Dir    string `json:"dir"`
+	Update bool   `json:"update"`
+	// Checked are the golden files checked, sorted, and Recorded the number of them written because they didn't exist
+	Checked    []string         `json:"checked"`
+	Recorded   int              `json:"recorded"`
+	Mismatches []GoldenMismatch `json:"mismatches"`
+}
+
+// JUnit returns the report as a JUnit test suite with a test case per golden file checked, failed when the response
+// served differs from the golden one
+func (r *GoldenReport) JUnit() *util.JUnitTestSuite {
+	mismatches := make(map[string]GoldenMismatch, len(r.Mismatches))
+	for _, mismatch := range r.Mismatches {
+		mismatches[mismatch.File] = mismatch
+	}
+	testCases := make([]util.JUnitTestCase, 0, len(r.Checked))
+	for _, file := range r.Checked {
+		testCase := util.JUnitTestCase{Name: file, ClassName: "golden"}
+		if mismatch, found := mismatches[file]; found {
+			testCase.ClassName += "." + mismatch.Served.FullMethod
+			diffs := make([]string, 0, len(mismatch.Diffs))
+			for _, diff := range mismatch.Diffs {
+				oldValue, _ := json.Marshal(diff.Old)
+				newValue, _ := json.Marshal(diff.New)
+				diffs = append(diffs, fmt.Sprintf("%s: %s != %s", diff.Path, oldValue, newValue))
+			}
+			testCase.Failure = &util.JUnitFailure{
+				Message: fmt.Sprintf("the response of stub %s differs from the golden file", mismatch.Served.StubID),
+				Text:    strings.Join(diffs, "\n"),
+			}
+		}
+		testCases = append(testCases, testCase)
+	}
+	return util.NewJUnitTestSuite("golden", testCases)
+}
+
+// GoldenFiles keeps the responses served by the stubs in a directory, a file per method and request, and checks the
+// responses served in the following runs against them, so that the unintended changes of shared stubs are noticed.
+// The files are recorded the first time a request is served, or every time in update mode. Only the unary calls are
+// checked. It is safe for concurrent use.
+type GoldenFiles struct {
+	dir        string
+	update     bool
+	responses  map[string]GoldenResponse
+	checked    map[string]bool
+	recorded   int
+	mismatches map[string]GoldenMismatch
+	mutex      sync.Mutex
+}
+
+var goldenFiles = new(GoldenFiles)
+
+// GetGoldenFiles returns the golden files used by the mock handlers
+func GetGoldenFiles() *GoldenFiles {
+	return goldenFiles
+}
+
+// Configure loads the golden files of the directory, which is created when it doesn't exist, and starts checking the
+// responses against them. In update mode, the files are rewritten with the responses served instead. The golden files
+// are disabled when dir is empty.
+func (g *GoldenFiles) Configure(dir string, update bool) error {
+	responses := make(map[string]GoldenResponse)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			response := GoldenResponse{}
+			if err := json.Unmarshal(data, &response); err != nil {
+				return fmt.Errorf("invalid golden file %s: %w", file, err)
+			}
+			responses[filepath.Base(file)] = response
+		}
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.dir, g.update, g.responses = dir, update, responses
+	g.reset()
+	return nil
+}
+
+func (g *GoldenFiles) IsEnabled() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.dir != ""
+}
+
+// Reset forgets the responses checked, e.g. at the start of a test run
+func (g *GoldenFiles) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.reset()
+}
+
+func (g *GoldenFiles) reset() {
+	g.checked = make(map[string]bool)
+	g.recorded = 0
+	g.mismatches = make(map[string]GoldenMismatch)
+}
+
+// Report describes the responses checked since the last reset, with the mismatches sorted by file
+func (g *GoldenFiles) Report() *GoldenReport {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	report := &GoldenReport{Dir: g.dir, Update: g.update, Checked: make([]string, 0, len(g.checked)),
+		Recorded: g.recorded, Mismatches: make([]GoldenMismatch, 0, len(g.mismatches))}
+	for _, mismatch := range g.mismatches {
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool { return report.Mismatches[i].File < report.Mismatches[j].File })
+	for file := range g.checked {
+		report.Checked = append(report.Checked, file)
+	}
+	sort.Strings(report.Checked)
+	return report
+}
+
+// Accept rewrites the golden files of the mismatches with the responses served, when the changes are intended, and
+// returns the number of files rewritten
+func (g *GoldenFiles) Accept() (int, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	accepted := 0
+	for file, mismatch := range g.mismatches {
+		if err := g.write(file, mismatch.Served); err != nil {
+			return accepted, err
+		}
+		delete(g.mismatches, file)
+		accepted++
+	}
+	return accepted, nil
+}
+
+// check compares the response served by the stub with the golden one. resp is ignored when the call failed.
+func (g *GoldenFiles) check(fullMethod string, matched *stub.Stub, paramsJson string, resp interface{}, err error) {
+	if matched == nil || !g.IsEnabled() {
+		return
+	}
+	request := new(bytes.Buffer)
+	if compactErr := json.Compact(request, []byte(paramsJson)); compactErr != nil {
+		return
+	}
+	served := GoldenResponse{FullMethod: fullMethod, Request: request.Bytes(), StubID: matched.ID}
+	// The response is decoded as it is read from the files, so that they can be compared
+	data, _ := json.Marshal(contractResponse(resp, err))
+	json.Unmarshal(data, &served.Response)
+	file := goldenFileName(fullMethod, request.Bytes())
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.dir == "" {
+		return
+	}
+	g.checked[file] = true
+	golden, found := g.responses[file]
+	switch {
+	case g.update || !found:
+		if writeErr := g.write(file, served); writeErr != nil {
+			log.Errorf("Failed to write the golden file %s: %s", file, writeErr.Error())
+			return
+		}
+		if !found {
+			g.recorded++
+		}
+	default:
+		diffs := stub.DiffValues("response", golden.Response, served.Response)
+		if len(diffs) == 0 {
+			delete(g.mismatches, file)
+			return
+		}
+		log.Warnf("The response of stub %s to %s differs from the golden file %s", matched.ID, fullMethod, file)
+		g.mismatches[file] = GoldenMismatch{File: file, Golden: golden, Served: served, Diffs: diffs}
+	}
+}
+
+func (g *GoldenFiles) write(file string, response GoldenResponse) error {
+	data, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(g.dir, file), data, 0644); err != nil {
+		return err
+	}
+	g.responses[file] = response
+	return nil
+}
+
+// goldenFileName names the golden file of a request after its method and the hash of the method and the request, e.g.
+// example.Orders.Get-3f9a2c1b7d4e8f60.json
+func goldenFileName(fullMethod string, request []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(fullMethod + "\n"))
+	hash.Write(request)
+	method := strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", ".")
+	return method + "-" + hex.EncodeToString(hash.Sum(nil)[:8]) + ".json"
+}
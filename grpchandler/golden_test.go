@@ -0,0 +1,60 @@
+package grpchandler
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGoldenFiles_Check(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	newResponse := func(status string) *structpb.Struct {
+		return &structpb.Struct{Fields: map[string]*structpb.Value{"status": {Kind: &structpb.Value_StringValue{StringValue: status}}}}
+	}
+	matched := &stub.Stub{ID: "stub-1"}
+
+	golden := new(GoldenFiles)
+	assert.NoError(t, golden.Configure(dir, false))
+	golden.check("/acme.Orders/Get", nil, `{"id":"1"}`, newResponse("OPEN"), nil)
+	golden.check("/acme.Orders/Get", matched, `{"id":"1"}`, newResponse("OPEN"), nil)
+	golden.check("/acme.Orders/Get", matched, `{"id": "2"}`, nil, status.Error(codes.NotFound, "not found"))
+	report := golden.Report()
+	assert.Len(t, report.Checked, 2)
+	assert.Equal(t, 2, report.Recorded)
+	assert.Empty(t, report.Mismatches)
+	files, _ := filepath.Glob(filepath.Join(dir, "acme.Orders.Get-*.json"))
+	assert.Len(t, files, 2)
+
+	// A new run, with the stubs changed
+	golden = new(GoldenFiles)
+	assert.NoError(t, golden.Configure(dir, false))
+	golden.check("/acme.Orders/Get", matched, `{"id":"1"}`, newResponse("SHIPPED"), nil)
+	golden.check("/acme.Orders/Get", matched, `{"id":"2"}`, nil, status.Error(codes.NotFound, "not found"))
+	report = golden.Report()
+	assert.Len(t, report.Checked, 2)
+	assert.Equal(t, 0, report.Recorded)
+	assert.Len(t, report.Mismatches, 1)
+	assert.Equal(t, []stub.FieldDiff{{Path: "response.content.status", Old: "OPEN", New: "SHIPPED"}}, report.Mismatches[0].Diffs)
+	assert.Equal(t, 1, report.JUnit().Failures)
+
+	accepted, err := golden.Accept()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accepted)
+	golden.Reset()
+	golden.check("/acme.Orders/Get", matched, `{"id":"1"}`, newResponse("SHIPPED"), nil)
+	assert.Empty(t, golden.Report().Mismatches)
+	assert.NoError(t, golden.Configure(dir, true))
+	golden.check("/acme.Orders/Get", matched, `{"id":"1"}`, newResponse("CANCELLED"), nil)
+	assert.Empty(t, golden.Report().Mismatches)
+	assert.NoError(t, golden.Configure(dir, false))
+	golden.check("/acme.Orders/Get", matched, `{"id":"1"}`, newResponse("CANCELLED"), nil)
+	assert.Empty(t, golden.Report().Mismatches)
+}
@@ -4,29 +4,85 @@ import (
 	"context"
 	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 )
 
-// MockInterceptor intercepts the gRPC calls for the registered services return canned responses previously loaded through the REST API.
+// MockHandler serves the unary calls of the mock services with the responses of the stubs they match.
 var MockHandler = func(ctx context.Context, stubsMatcher stub.StubsMatcher, fullMethod string, req interface{}, resp interface{}) (_ interface{}, err error) {
-	paramsJson, err := getRequestInJSON(req)
+	var s *stub.Stub
+	var paramsJson string
+	// The unavailable methods fail regardless of the stubs
+	ctx, deprecationErr := methodDeprecations.check(ctx, fullMethod)
+	// The headers and trailers of the stub are sent, the call is shadowed and the response is checked against the
+	// golden files whatever the outcome of the call
+	defer func() {
+		sendUnaryHeader(ctx, s, err)
+		shadowing.shadow(ctx, fullMethod, s, req, paramsJson, resp, err)
+		goldenFiles.check(fullMethod, s, paramsJson, resp, err)
+	}()
+	if deprecationErr != nil {
+		return nil, deprecationErr
+	}
+	// The hooks can change the request before it is validated and matched
+	ctx, err = registeredHooks.beforeMatch(ctx, fullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := requestValidation.validate(req); err != nil {
+		return nil, err
+	}
+	paramsJson, err = getRequestInJSON(req)
 	if err != nil {
 		logError(fullMethod, paramsJson, err)
 		return nil, err
 	}
-	s := stubsMatcher.Match(ctx, fullMethod, paramsJson)
+	// The matching expressions are evaluated on the typed request
+	message, _ := req.(proto.Message)
+	s = stubsMatcher.Match(stub.WithRequestMessage(ctx, message), fullMethod, paramsJson)
 	if s == nil {
-		log.Infof("NO mock response found for %s --> %s", fullMethod, paramsJson)
-		return nil, fmt.Errorf("no response found")
+		// The calls to the simulated services that don't match any stub are served by the simulation
+		simulated, handled, err := simulation.handle(fullMethod, req, resp)
+		if !handled {
+			return nil, strictMode.noStubFound(fullMethod, paramsJson)
+		}
+		markMatched(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp = simulated
+	} else {
+		markMatched(ctx)
+		if s, err = stub.RunScript(ctx, s, paramsJson); err != nil {
+			return nil, err
+		}
+		ctx, err = withStubMetadata(ctx, s, paramsJson, func(trailer metadata.MD) {
+			grpc.SetTrailer(ctx, trailer)
+		})
+		if err != nil {
+			return nil, err
+		}
+		resp, err = stub.GetResponse(ctx, s, paramsJson, resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The hooks see the response already trimmed to the field mask
+	fieldMaskTrimming.trim(req, resp)
+	if err := registeredHooks.beforeSend(ctx, fullMethod, req, resp); err != nil {
+		return nil, err
 	}
-	return stub.GetResponse(s, paramsJson, resp)
+	// A frame fault replaces the response sent, after the hooks
+	return withFrameFault(s, 0, resp), nil
 }
 
 func logError(fullMethod, paramsJSON string, err error) {
 	log.WithFields(log.Fields{"Error": err.Error()}).
-		Errorf("Error handling request %s --> %s", fullMethod, paramsJSON)
+		Errorf("Error handling request %s --> %s", fullMethod, util.LoggablePayload(paramsJSON))
 }
 
 func getRequestInJSON(req interface{}) (requestJSON string, err error) {
@@ -5,7 +5,7 @@ import (
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"math"
+	"google.golang.org/protobuf/types/known/structpb"
 	"testing"
 )
 
@@ -13,7 +13,7 @@ type MockStubsMatcher struct {
 	mock.Mock
 }
 
-func (m MockStubsMatcher) Match(method string, reqJSON string) *stub.Stub {
+func (m *MockStubsMatcher) Match(ctx context.Context, method string, reqJSON string) *stub.Stub {
 	args := m.Called(method, reqJSON)
 	if args.Get(0) == nil {
 		return nil
@@ -21,19 +21,10 @@ func (m MockStubsMatcher) Match(method string, reqJSON string) *stub.Stub {
 	return args.Get(0).(*stub.Stub)
 }
 
-type Response struct {
-	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-}
-
-func (*Response) ProtoMessage() {}
-
-func (x *Response) Reset() {}
+// The requests and responses of the tests are free-form messages, which accept any JSON object
+type Request = structpb.Struct
 
-func (*Response) String() string { return "" }
-
-type Request struct {
-	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-}
+type Response = structpb.Struct
 
 func TestMockHandler_Success_FoundResponse(t *testing.T) {
 	method := "grpc_method_1"
@@ -43,13 +34,13 @@ func TestMockHandler_Success_FoundResponse(t *testing.T) {
 	mockStubsMatcher.On("Match", mock.Anything, mock.Anything).
 		Return(&stub.Stub{
 			FullMethod: method,
-			Response: stub.StubResponse{
+			Response: &stub.StubResponse{
 				Content: "{\"name\":\"Rodrigo de Carvalho\"}",
 			},
 		})
 
 	foundStub, _ := MockHandler(context.Background(), mockStubsMatcher, method, new(Request), new(Response))
-	assert.Equal(t, "Rodrigo de Carvalho", foundStub.(*Response).Name)
+	assert.Equal(t, "Rodrigo de Carvalho", foundStub.(*Response).Fields["name"].GetStringValue())
 }
 
 func TestMockHandler_Success_FoundError(t *testing.T) {
@@ -60,15 +51,15 @@ func TestMockHandler_Success_FoundError(t *testing.T) {
 	mockStubsMatcher.On("Match", mock.Anything, mock.Anything).
 		Return(&stub.Stub{
 			FullMethod: method,
-			Response: stub.StubResponse{
+			Response: &stub.StubResponse{
 				Type:    "error",
 				Content: "",
-				Error:   "return an error",
+				Error:   &stub.ErrorResponse{Code: 2, Message: "return an error"},
 			},
 		})
 
 	_, err := MockHandler(context.Background(), mockStubsMatcher, method, new(Request), new(Response))
-	assert.EqualError(t, err, "return an error")
+	assert.EqualError(t, err, "rpc error: code = Unknown desc = return an error")
 }
 
 func TestMockHandler_Success_NoStubFound(t *testing.T) {
@@ -91,7 +82,7 @@ func TestMockHandler_ResponseJsonWrongFormat(t *testing.T) {
 	mockStubsMatcher.On("Match", mock.Anything, mock.Anything).
 		Return(&stub.Stub{
 			FullMethod: method,
-			Response: stub.StubResponse{
+			Response: &stub.StubResponse{
 				Content: "wrong_json",
 			},
 		})
@@ -106,6 +97,8 @@ func TestMockHandler_ErrorMarshalingRequest(t *testing.T) {
 	// Setup mock dependencies
 	mockStubsMatcher := new(MockStubsMatcher)
 
-	_, err := MockHandler(context.Background(), mockStubsMatcher, method, math.Inf(1), new(Response))
-	assert.EqualError(t, err, "could not marshal the request to JSON: json: unsupported value: +Inf")
+	request := &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: "\xff"}}
+	_, err := MockHandler(context.Background(), mockStubsMatcher, method, request, new(Response))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "could not marshal the request to JSON")
 }
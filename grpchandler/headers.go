@@ -0,0 +1,82 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type responseHeaderKey struct{}
+
+// WithResponseHeader returns a context with metadata for the mock handlers to send in the header of the response or,
+// when the response is trailers-only, in the trailer. The interceptors use it instead of grpc.SetHeader so that they
+// don't force the headers to be sent.
+func WithResponseHeader(ctx context.Context, md metadata.MD) context.Context {
+	if existing := responseHeader(ctx); existing.Len() > 0 {
+		md = metadata.Join(existing, md)
+	}
+	return context.WithValue(ctx, responseHeaderKey{}, md)
+}
+
+func responseHeader(ctx context.Context) metadata.MD {
+	md, _ := ctx.Value(responseHeaderKey{}).(metadata.MD)
+	return md
+}
+
+// withStubMetadata renders the headers and trailers of the response of the stub. The headers are added to the response
+// header of the context and the trailers are set with setTrailer.
+func withStubMetadata(ctx context.Context, s *stub.Stub, paramsJson string, setTrailer func(metadata.MD)) (context.Context, error) {
+	header, trailer, err := stub.GetResponseMetadata(ctx, s, paramsJson)
+	if err != nil {
+		return ctx, err
+	}
+	if header.Len() > 0 {
+		ctx = WithResponseHeader(ctx, header)
+	}
+	if trailer.Len() > 0 {
+		setTrailer(trailer)
+	}
+	return ctx, nil
+}
+
+func isTrailersOnly(s *stub.Stub) bool {
+	return s != nil && s.Response != nil && s.Response.TrailersOnly
+}
+
+// sendUnaryHeader sends the header of a unary call once its response is known. Errors are sent after the headers,
+// unless the response of the stub is trailers-only.
+func sendUnaryHeader(ctx context.Context, s *stub.Stub, err error) {
+	md := responseHeader(ctx)
+	switch {
+	case isTrailersOnly(s) && err != nil:
+		if md.Len() > 0 {
+			grpc.SetTrailer(ctx, md)
+		}
+	case err != nil:
+		grpc.SendHeader(ctx, md)
+	case md.Len() > 0:
+		grpc.SetHeader(ctx, md)
+	}
+}
+
+// setStreamHeader sets the header of a streaming call before its messages are sent
+func setStreamHeader(ctx context.Context, stream grpc.ServerStream, s *stub.Stub) {
+	md := responseHeader(ctx)
+	if md.Len() == 0 {
+		return
+	}
+	if isTrailersOnly(s) {
+		stream.SetTrailer(md)
+		return
+	}
+	stream.SetHeader(md)
+}
+
+// sendStreamErrorHeader sends the headers before the error that terminates a streaming call, unless they were already
+// sent with the messages or the response of the stub is trailers-only
+func sendStreamErrorHeader(stream grpc.ServerStream, s *stub.Stub, err error) {
+	if err != nil && !isTrailersOnly(s) {
+		stream.SendHeader(nil)
+	}
+}
@@ -0,0 +1,134 @@
+package grpchandler
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RequestHook inspects or changes the request before it is matched against the stubs, e.g. to inject a tenant ID.
+// The context returned, which can carry new incoming metadata, replaces the one of the call. The call fails with the
+// error returned, if any.
+type RequestHook func(ctx context.Context, fullMethod string, req interface{}) (context.Context, error)
+
+// ResponseHook inspects or changes a response message before it is sent, e.g. to compute a signature. It is called for
+// every message of the streaming methods. The call fails with the error returned, if any.
+type ResponseHook func(ctx context.Context, fullMethod string, req interface{}, resp interface{}) error
+
+// Hook is Go middleware that runs on the calls to the mocked methods
+type Hook struct {
+	// Name identifies the hook. Registering a hook with the same name replaces the previous one.
+	Name string
+	// Order defines when the hook runs in relation to the others, lowest first. Hooks with the same order run in the
+	// order they were registered.
+	Order int
+	// Methods the hook runs on: full methods (/package.Service/Method) or all the methods of a service
+	// (/package.Service/*). It runs on every method when empty.
+	Methods []string
+	// Request is called before matching. Optional.
+	Request RequestHook
+	// Response is called before sending each response message. Optional.
+	Response ResponseHook
+}
+
+func (h Hook) appliesTo(fullMethod string) bool {
+	if len(h.Methods) == 0 {
+		return true
+	}
+	for _, method := range h.Methods {
+		if matchesMethod(method, fullMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMethod checks if the full method is method or one of its methods when it is a service (/package.Service/*)
+func matchesMethod(method, fullMethod string) bool {
+	return method == fullMethod || (strings.HasSuffix(method, "/*") && strings.HasPrefix(fullMethod, strings.TrimSuffix(method, "*")))
+}
+
+type hooks struct {
+	mutex sync.RWMutex
+	// Sorted by order and then by registration
+	hooks []Hook
+}
+
+var registeredHooks = new(hooks)
+
+// RegisterHook adds the hook to the calls of the mocked methods. It is usually called before the servers are started.
+func RegisterHook(hook Hook) {
+	registeredHooks.register(hook)
+}
+
+// UnregisterHook removes the hook with the name given
+func UnregisterHook(name string) {
+	registeredHooks.unregister(name)
+}
+
+func (h *hooks) register(hook Hook) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hooks := h.withoutHook(hook.Name)
+	hooks = append(hooks, hook)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Order < hooks[j].Order
+	})
+	h.hooks = hooks
+}
+
+func (h *hooks) unregister(name string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.hooks = h.withoutHook(name)
+}
+
+// withoutHook returns a copy of the hooks without the one with the name given, so that the slices being iterated
+// by the calls in progress are never modified
+func (h *hooks) withoutHook(name string) []Hook {
+	hooks := make([]Hook, 0, len(h.hooks)+1)
+	for _, hook := range h.hooks {
+		if hook.Name != name {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+func (h *hooks) get() []Hook {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	return h.hooks
+}
+
+func (h *hooks) beforeMatch(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+	for _, hook := range h.get() {
+		if hook.Request == nil || !hook.appliesTo(fullMethod) {
+			continue
+		}
+		newCtx, err := hook.Request(ctx, fullMethod, req)
+		if err != nil {
+			return ctx, err
+		}
+		if newCtx != nil {
+			ctx = newCtx
+		}
+	}
+	return ctx, nil
+}
+
+func (h *hooks) beforeSend(ctx context.Context, fullMethod string, req interface{}, resp interface{}) error {
+	for _, hook := range h.get() {
+		if hook.Response == nil || !hook.appliesTo(fullMethod) {
+			continue
+		}
+		if err := hook.Response(ctx, fullMethod, req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
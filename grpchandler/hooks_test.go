@@ -0,0 +1,100 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestMockHandler_Hooks(t *testing.T) {
+	defer func() {
+		UnregisterHook("tenant")
+		UnregisterHook("signature")
+		UnregisterHook("other")
+	}()
+	store := stub.NewInMemoryStubsStore()
+	assert.NoError(t, store.Add(context.Background(), &stub.Stub{
+		FullMethod: "/test.Service/Method",
+		Request: &stub.StubRequest{
+			Match:    "exact",
+			Content:  "{\"name\":\"John\",\"tenant\":\"acme\"}",
+			Metadata: map[string][]string{"x-tenant": {"acme"}},
+		},
+		Response: &stub.StubResponse{Type: "success", Content: "{\"name\":\"Hello\"}"},
+	}))
+	matcher := stub.NewStubsMatcher(store)
+	order := make([]string, 0)
+	RegisterHook(Hook{
+		Name:  "signature",
+		Order: 2,
+		Response: func(ctx context.Context, fullMethod string, req interface{}, resp interface{}) error {
+			order = append(order, "signature")
+			name := resp.(*structpb.Struct).Fields["name"].GetStringValue()
+			resp.(*structpb.Struct).Fields["signature"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: name + "-signed"}}
+			return nil
+		},
+	})
+	RegisterHook(Hook{
+		Name:    "tenant",
+		Order:   1,
+		Methods: []string{"/test.Service/*"},
+		Request: func(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+			order = append(order, "tenant")
+			req.(*structpb.Struct).Fields["tenant"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: "acme"}}
+			return metadata.NewIncomingContext(ctx, metadata.Pairs("x-tenant", "acme")), nil
+		},
+	})
+	RegisterHook(Hook{
+		Name:    "other",
+		Methods: []string{"/test.Other/Method"},
+		Request: func(ctx context.Context, fullMethod string, req interface{}) (context.Context, error) {
+			return ctx, status.Error(codes.PermissionDenied, "denied")
+		},
+	})
+
+	resp, err := MockHandler(context.Background(), matcher, "/test.Service/Method", newStruct("John"), new(structpb.Struct))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello-signed", resp.(*structpb.Struct).Fields["signature"].GetStringValue())
+	assert.Equal(t, []string{"tenant", "signature"}, order)
+
+	_, err = MockHandler(context.Background(), matcher, "/test.Other/Method", newStruct("John"), new(structpb.Struct))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestMockStreamHandler_ResponseHook(t *testing.T) {
+	RegisterHook(Hook{
+		Name:    "counter",
+		Methods: []string{serverStreamMethod},
+		Response: func(ctx context.Context, fullMethod string, req interface{}, resp interface{}) error {
+			name := req.(*structpb.Struct).Fields["name"].GetStringValue()
+			resp.(*structpb.Struct).Fields["to"] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: name}}
+			return nil
+		},
+	})
+	defer UnregisterHook("counter")
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: serverStreamMethod,
+		Request:    &stub.StubRequest{Match: "exact", Content: "{\"name\":\"John\"}"},
+		Response: &stub.StubResponse{
+			Type:   "success",
+			Stream: []stub.JsonString{"{\"name\":\"first\"}", "{\"name\":\"second\"}"},
+		},
+	})
+	defer stop()
+
+	stream, err := conn.NewStream(context.Background(), &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+
+	for i := 0; i < 2; i++ {
+		message := new(structpb.Struct)
+		assert.NoError(t, stream.RecvMsg(message))
+		assert.Equal(t, "John", message.Fields["to"].GetStringValue())
+	}
+}
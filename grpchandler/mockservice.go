@@ -1,8 +1,11 @@
 package grpchandler
 
 import (
+	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"strings"
 )
 
 type MockService interface {
@@ -14,14 +17,71 @@ type MockService interface {
 	GetStubsValidator() stub.StubsValidator
 }
 
+// DefaultStubsProvider is implemented by the mock services generated with the default_stubs option, which have
+// default stubs made of the examples in the comments of the proto files
+type DefaultStubsProvider interface {
+	GetDefaultStubs() []stub.Stub
+}
+
+// GetDefaultStubs returns the default stubs of the mock service, none when it doesn't provide them
+func GetDefaultStubs(service MockService) []stub.Stub {
+	if provider, ok := service.(DefaultStubsProvider); ok {
+		return provider.GetDefaultStubs()
+	}
+	return nil
+}
+
+// NormalizeStubContent converts the contents of the stub in protobuf text format to JSON (see stub.ConvertTextContent)
+// and rewrites them in canonical form (see stub.NormalizeContent) with the messages of its method in the mock service
+func NormalizeStubContent(service MockService, s *stub.Stub) error {
+	newMessage := func(instance func(methodName string) interface{}) func() proto.Message {
+		return func() proto.Message {
+			message, _ := instance(s.FullMethod).(proto.Message)
+			return message
+		}
+	}
+	newRequest, newResponse := newMessage(service.GetRequestInstance), newMessage(service.GetResponseInstance)
+	if err := stub.ConvertTextContent(s, newRequest, newResponse); err != nil {
+		return err
+	}
+	stub.NormalizeContent(s, newRequest, newResponse)
+	return nil
+}
+
+// NewCompositeMockService serves all the mock services given. Different versions of a service (e.g. acme.v1.Orders and
+// acme.v1beta.Orders) can be served side by side as long as they are in different proto packages: the calls and
+// stubs are routed to the mock service of the service in their full method. It panics if a service is served by more
+// than one of the mock services, as gRPC can't register it twice.
 func NewCompositeMockService(services []MockService) MockService {
-	return compositeMockService{
+	composite := &compositeMockService{
 		mockServices: services,
+		byService:    make(map[string]MockService, 0),
+	}
+	for _, mockService := range services {
+		for _, method := range mockService.GetSupportedMethods() {
+			name := ServiceName(method)
+			if existing, found := composite.byService[name]; found && existing != mockService {
+				panic(fmt.Sprintf("the service %s is served by more than one mock service", name))
+			}
+			composite.byService[name] = mockService
+		}
 	}
+	return composite
 }
 
 type compositeMockService struct {
 	mockServices []MockService
+	// The mock service of each service, by its full name
+	byService map[string]MockService
+}
+
+// ServiceName returns the full name of the service of a full method, e.g. acme.v1.Orders for /acme.v1.Orders/Get
+func ServiceName(fullMethod string) string {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+	return name
 }
 
 func (c compositeMockService) Register(s *grpc.Server) {
@@ -46,30 +106,41 @@ func (c compositeMockService) GetPayloadExamples() []stub.Stub {
 	return examples
 }
 
-func (c compositeMockService) GetRequestInstance(methodName string) interface{} {
+func (c compositeMockService) GetDefaultStubs() []stub.Stub {
+	stubs := make([]stub.Stub, 0)
 	for _, mockService := range c.mockServices {
-		instance := mockService.GetRequestInstance(methodName)
-		if instance != nil {
-			return instance
-		}
+		stubs = append(stubs, GetDefaultStubs(mockService)...)
+	}
+	return stubs
+}
+
+func (c compositeMockService) GetRequestInstance(methodName string) interface{} {
+	if mockService, found := c.byService[ServiceName(methodName)]; found {
+		return mockService.GetRequestInstance(methodName)
 	}
 	return nil
 }
 
 func (c compositeMockService) GetResponseInstance(methodName string) interface{} {
-	for _, mockService := range c.mockServices {
-		instance := mockService.GetResponseInstance(methodName)
-		if instance != nil {
-			return instance
-		}
+	if mockService, found := c.byService[ServiceName(methodName)]; found {
+		return mockService.GetResponseInstance(methodName)
 	}
 	return nil
 }
 
 func (c compositeMockService) GetStubsValidator() stub.StubsValidator {
+	return c
+}
+
+// IsValid validates the stub with the mock service of its method. The stubs of the methods not served are validated
+// by all the mock services.
+func (c compositeMockService) IsValid(s *stub.Stub) (isValid bool, errorMessages []string) {
+	if mockService, found := c.byService[ServiceName(s.FullMethod)]; found {
+		return mockService.GetStubsValidator().IsValid(s)
+	}
 	validators := make([]stub.StubsValidator, 0)
 	for _, mockService := range c.mockServices {
-		validators = append(validators, mockService.(stub.StubsValidator))
+		validators = append(validators, mockService.GetStubsValidator())
 	}
-	return stub.NewCompositeStubsValidator(validators)
+	return stub.NewCompositeStubsValidator(validators).IsValid(s)
 }
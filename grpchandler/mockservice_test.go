@@ -0,0 +1,81 @@
+package grpchandler
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+// versionMockService is a mock service of a version of a service with a single method
+type versionMockService struct {
+	method   string
+	response func() interface{}
+	valid    bool
+}
+
+func (m *versionMockService) Register(s *grpc.Server)                {}
+func (m *versionMockService) GetSupportedMethods() []string          { return []string{m.method} }
+func (m *versionMockService) GetPayloadExamples() []stub.Stub        { return nil }
+func (m *versionMockService) GetStubsValidator() stub.StubsValidator { return m }
+
+func (m *versionMockService) GetRequestInstance(methodName string) interface{} {
+	return m.GetResponseInstance(methodName)
+}
+
+func (m *versionMockService) GetResponseInstance(methodName string) interface{} {
+	if methodName != m.method {
+		return nil
+	}
+	return m.response()
+}
+
+func (m *versionMockService) IsValid(s *stub.Stub) (bool, []string) {
+	if s.FullMethod != m.method || m.valid {
+		return true, nil
+	}
+	return false, []string{"invalid"}
+}
+
+func TestCompositeMockService_Versions(t *testing.T) {
+	v1 := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }, valid: true}
+	v1beta := &versionMockService{method: "/acme.v1beta.Orders/Get", response: func() interface{} { return new(wrapperspb.StringValue) }}
+	composite := NewCompositeMockService([]MockService{v1, v1beta})
+
+	assert.IsType(t, new(structpb.Struct), composite.GetResponseInstance("/acme.v1.Orders/Get"))
+	assert.IsType(t, new(wrapperspb.StringValue), composite.GetResponseInstance("/acme.v1beta.Orders/Get"))
+	assert.Nil(t, composite.GetRequestInstance("/acme.v2.Orders/Get"))
+	isValid, _ := composite.GetStubsValidator().IsValid(&stub.Stub{FullMethod: "/acme.v1.Orders/Get"})
+	assert.True(t, isValid)
+	isValid, _ = composite.GetStubsValidator().IsValid(&stub.Stub{FullMethod: "/acme.v1beta.Orders/Get"})
+	assert.False(t, isValid)
+
+	assert.Panics(t, func() {
+		NewCompositeMockService([]MockService{v1, &versionMockService{method: "/acme.v1.Orders/Get"}})
+	})
+}
+
+func TestServiceName(t *testing.T) {
+	assert.Equal(t, "acme.v1.Orders", ServiceName("/acme.v1.Orders/Get"))
+	assert.Equal(t, "acme.v1.Orders", ServiceName("acme.v1.Orders/Get"))
+}
+
+func TestNormalizeStubContent(t *testing.T) {
+	service := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }}
+	s := &stub.Stub{
+		FullMethod:    "/acme.v1.Orders/Get",
+		ContentFormat: stub.ContentFormatText,
+		Request:       &stub.StubRequest{Match: "exact", Content: `"fields { key: \"id\" value { string_value: \"1\" } }"`},
+		Response:      &stub.StubResponse{Type: "success", Content: `"fields { key: \"total\" value { number_value: 2 } }"`},
+	}
+
+	assert.NoError(t, NormalizeStubContent(service, s))
+	assert.Equal(t, `{"id":"1"}`, string(s.Request.Content))
+	assert.Equal(t, `{"total":2}`, string(s.Response.Content))
+
+	// The messages of the methods of other services are unknown
+	s.FullMethod, s.ContentFormat, s.Request.Content = "/acme.v2.Orders/Get", stub.ContentFormatText, `"fields {}"`
+	assert.EqualError(t, NormalizeStubContent(service, s), "request.content: the message of the method is unknown")
+}
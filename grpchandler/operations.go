@@ -0,0 +1,71 @@
+package grpchandler
+
+import (
+	longrunning "cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes/empty"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OperationsMethodPrefix is the prefix of the methods of the google.longrunning.Operations service
+const OperationsMethodPrefix = "/google.longrunning.Operations/"
+
+// OperationsService serves the google.longrunning.Operations service for the long-running operations started by the
+// stubs (see stub.OperationResponse), so that the clients can poll them. WaitOperation returns the current state of
+// the operation, like GetOperation, without waiting.
+type OperationsService struct {
+	Operations *stub.Operations
+}
+
+func (s OperationsService) GetOperation(ctx context.Context, request *longrunning.GetOperationRequest) (*longrunning.Operation, error) {
+	log.Infof("Received call to GetOperation for %s", request.Name)
+	operation, found := s.Operations.Poll(request.Name)
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "operation %s not found", request.Name)
+	}
+	return toOperation(operation)
+}
+
+func (s OperationsService) WaitOperation(ctx context.Context, request *longrunning.WaitOperationRequest) (*longrunning.Operation, error) {
+	return s.GetOperation(ctx, &longrunning.GetOperationRequest{Name: request.Name})
+}
+
+func (s OperationsService) ListOperations(ctx context.Context, request *longrunning.ListOperationsRequest) (*longrunning.ListOperationsResponse, error) {
+	response := &longrunning.ListOperationsResponse{}
+	for _, operation := range s.Operations.List(request.Name) {
+		op, err := toOperation(operation)
+		if err != nil {
+			return nil, err
+		}
+		response.Operations = append(response.Operations, op)
+	}
+	return response, nil
+}
+
+func (s OperationsService) CancelOperation(ctx context.Context, request *longrunning.CancelOperationRequest) (*empty.Empty, error) {
+	if !s.Operations.Cancel(request.Name) {
+		return nil, status.Errorf(codes.NotFound, "operation %s not found", request.Name)
+	}
+	return &empty.Empty{}, nil
+}
+
+func (s OperationsService) DeleteOperation(ctx context.Context, request *longrunning.DeleteOperationRequest) (*empty.Empty, error) {
+	if !s.Operations.Delete(request.Name) {
+		return nil, status.Errorf(codes.NotFound, "operation %s not found", request.Name)
+	}
+	return &empty.Empty{}, nil
+}
+
+// toOperation decodes the JSON of an operation. The types of the metadata and the response must be linked in.
+func toOperation(operation stub.JsonString) (*longrunning.Operation, error) {
+	op := new(longrunning.Operation)
+	if err := jsonpb.UnmarshalString(operation.String(), op); err != nil {
+		log.Errorf("Error decoding operation %s: %s", operation, err.Error())
+		return nil, status.Errorf(codes.Internal, "could not decode the operation: %s", err.Error())
+	}
+	return op, nil
+}
@@ -0,0 +1,45 @@
+package grpchandler
+
+import (
+	longrunning "cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestOperationsService(t *testing.T) {
+	operations := stub.GetOperations()
+	defer operations.Reset()
+	s := &stub.Stub{
+		FullMethod: "/acme.Orders/ExportOrders",
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response: &stub.StubResponse{Type: "success", Operation: &stub.OperationResponse{
+			DoneAfterPolls: 2,
+			Response:       `{"@type":"type.googleapis.com/google.protobuf.Empty","value":{}}`,
+		}},
+	}
+	_, err := stub.GetResponse(context.Background(), s, "{}", new(longrunning.Operation))
+	assert.NoError(t, err)
+	service := OperationsService{Operations: operations}
+
+	running, err := service.GetOperation(context.Background(), &longrunning.GetOperationRequest{Name: "operations/1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "operations/1", running.Name)
+	assert.False(t, running.Done)
+	done, err := service.WaitOperation(context.Background(), &longrunning.WaitOperationRequest{Name: "operations/1"})
+	assert.NoError(t, err)
+	assert.True(t, done.Done)
+	assert.Equal(t, "type.googleapis.com/google.protobuf.Empty", done.GetResponse().TypeUrl)
+
+	list, err := service.ListOperations(context.Background(), &longrunning.ListOperationsRequest{Name: "operations"})
+	assert.NoError(t, err)
+	assert.Len(t, list.Operations, 1)
+
+	_, err = service.DeleteOperation(context.Background(), &longrunning.DeleteOperationRequest{Name: "operations/1"})
+	assert.NoError(t, err)
+	_, err = service.GetOperation(context.Background(), &longrunning.GetOperationRequest{Name: "operations/1"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
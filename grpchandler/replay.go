@@ -0,0 +1,252 @@
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Any method can be called as a bidirectional stream: the request is sent as the only message of the client and the
+// messages of the server are read until it ends the call
+var replayStreamDesc = &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+
+// ReplayOptions controls how fast the calls of a replay are fired
+type ReplayOptions struct {
+	// Rate is the number of calls started per second. The calls are started at the pace they were recorded when it is
+	// 0.
+	Rate float64
+	// Concurrency is the maximum number of calls in flight. It is 1 when not set.
+	Concurrency int
+	// Iterations is the number of times the calls are replayed. They are replayed once when not set.
+	Iterations int
+	// Timeout of each call. There is no timeout when it is 0.
+	Timeout time.Duration
+}
+
+// LatencyStats summarises the latencies of the calls, in milliseconds
+type LatencyStats struct {
+	Min  float64 `json:"minMs"`
+	Mean float64 `json:"meanMs"`
+	P50  float64 `json:"p50Ms"`
+	P90  float64 `json:"p90Ms"`
+	P99  float64 `json:"p99Ms"`
+	Max  float64 `json:"maxMs"`
+}
+
+// ReplayMethodReport has the results of the calls to a method
+type ReplayMethodReport struct {
+	Calls   int          `json:"calls"`
+	Errors  int          `json:"errors"`
+	Latency LatencyStats `json:"latency"`
+
+	latencies []time.Duration
+}
+
+// ReplayReport has the results of a replay
+type ReplayReport struct {
+	Calls  int `json:"calls"`
+	Errors int `json:"errors"`
+	// DurationMs is the time from the first call started to the last one finished
+	DurationMs float64 `json:"durationMs"`
+	// Throughput is the number of calls finished per second
+	Throughput float64      `json:"throughput"`
+	Latency    LatencyStats `json:"latency"`
+	// Codes counts the calls by the status code they finished with
+	Codes   map[string]int                 `json:"codes"`
+	Methods map[string]*ReplayMethodReport `json:"methods"`
+
+	latencies []time.Duration
+	mutex     sync.Mutex
+}
+
+type replayCall struct {
+	fullMethod string
+	request    proto.Message
+	metadata   metadata.MD
+	// start is the time since the start of the replay when the call is fired
+	start time.Duration
+}
+
+// Replay fires the calls of the script against a service (through conn), for the iterations and at the rate and
+// concurrency of the options, and reports the latencies and status codes of the calls. It fails without firing any
+// call when the script calls methods that are not supported or has invalid requests. A replay stops early when ctx is
+// done.
+func Replay(ctx context.Context, conn grpc.ClientConnInterface, service MockService, script *stub.ReplayScript,
+	options ReplayOptions) (*ReplayReport, error) {
+	calls, err := scheduleReplay(service, script, options)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	report := &ReplayReport{
+		Codes:   make(map[string]int),
+		Methods: make(map[string]*ReplayMethodReport),
+	}
+	inFlight := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, call := range calls {
+		timer := time.NewTimer(time.Until(start.Add(call.start)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		inFlight <- struct{}{}
+		wg.Add(1)
+		go func(call replayCall) {
+			defer wg.Done()
+			latency, err := fireReplayCall(ctx, conn, service, call, options.Timeout)
+			report.add(call.fullMethod, latency, err)
+			<-inFlight
+		}(call)
+	}
+	wg.Wait()
+	report.finish(time.Since(start))
+	return report, nil
+}
+
+// scheduleReplay prepares the calls of every iteration with the time they are fired
+func scheduleReplay(service MockService, script *stub.ReplayScript, options ReplayOptions) ([]replayCall, error) {
+	iterations := options.Iterations
+	if iterations <= 0 {
+		iterations = 1
+	}
+	calls := make([]replayCall, 0, len(script.Calls)*iterations)
+	var iterationStart time.Duration
+	for iteration := 0; iteration < iterations; iteration++ {
+		var last time.Duration
+		for i, c := range script.Calls {
+			request, _ := service.GetRequestInstance(c.FullMethod).(proto.Message)
+			if request == nil {
+				return nil, fmt.Errorf("call %d: the method %s is not supported", i, c.FullMethod)
+			}
+			requestJson := c.Request.String()
+			if requestJson == "" {
+				requestJson = "{}"
+			}
+			if err := protojson.Unmarshal([]byte(requestJson), request); err != nil {
+				return nil, fmt.Errorf("call %d: invalid request: %w", i, err)
+			}
+			call := replayCall{fullMethod: c.FullMethod, request: request, metadata: metadata.MD(c.Metadata)}
+			if options.Rate > 0 {
+				call.start = time.Duration(float64(len(calls)) / options.Rate * float64(time.Second))
+			} else {
+				last = time.Duration(c.OffsetMs) * time.Millisecond
+				call.start = iterationStart + last
+			}
+			calls = append(calls, call)
+		}
+		iterationStart += last
+	}
+	return calls, nil
+}
+
+func fireReplayCall(ctx context.Context, conn grpc.ClientConnInterface, service MockService, call replayCall,
+	timeout time.Duration) (time.Duration, error) {
+	ctx = metadata.NewOutgoingContext(ctx, call.metadata)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	stream, err := conn.NewStream(ctx, replayStreamDesc, call.fullMethod)
+	if err != nil {
+		return time.Since(start), err
+	}
+	if err := stream.SendMsg(call.request); err != nil && err != io.EOF {
+		return time.Since(start), err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return time.Since(start), err
+	}
+	for {
+		response := service.GetResponseInstance(call.fullMethod)
+		if err := stream.RecvMsg(response); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return time.Since(start), err
+		}
+	}
+}
+
+func (r *ReplayReport) add(fullMethod string, latency time.Duration, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	method, ok := r.Methods[fullMethod]
+	if !ok {
+		method = &ReplayMethodReport{}
+		r.Methods[fullMethod] = method
+	}
+	r.Calls++
+	method.Calls++
+	if err != nil {
+		r.Errors++
+		method.Errors++
+	}
+	r.Codes[stub.StatusCode(status.Code(err)).String()]++
+	r.latencies = append(r.latencies, latency)
+	method.latencies = append(method.latencies, latency)
+}
+
+func (r *ReplayReport) finish(duration time.Duration) {
+	r.DurationMs = milliseconds(duration)
+	if duration > 0 {
+		r.Throughput = float64(r.Calls) / duration.Seconds()
+	}
+	r.Latency = newLatencyStats(r.latencies)
+	for _, method := range r.Methods {
+		method.Latency = newLatencyStats(method.latencies)
+	}
+}
+
+func newLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	return LatencyStats{
+		Min:  milliseconds(latencies[0]),
+		Mean: milliseconds(total / time.Duration(len(latencies))),
+		P50:  milliseconds(percentile(latencies, 50)),
+		P90:  milliseconds(percentile(latencies, 90)),
+		P99:  milliseconds(percentile(latencies, 99)),
+		Max:  milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
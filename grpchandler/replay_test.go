@@ -0,0 +1,108 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// replayConn answers every call with a single message after a delay, or fails the calls with the metadata fail
+type replayConn struct {
+	delay       time.Duration
+	mutex       sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *replayConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+	return status.Error(codes.Unimplemented, "not implemented")
+}
+
+func (c *replayConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if len(md.Get("fail")) > 0 {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	c.mutex.Lock()
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.mutex.Unlock()
+	return &replayClientStream{conn: c}, nil
+}
+
+type replayClientStream struct {
+	grpc.ClientStream
+	conn     *replayConn
+	received int
+}
+
+func (s *replayClientStream) SendMsg(m interface{}) error { return nil }
+func (s *replayClientStream) CloseSend() error            { return nil }
+
+func (s *replayClientStream) RecvMsg(m interface{}) error {
+	if s.received > 0 {
+		s.conn.mutex.Lock()
+		s.conn.inFlight--
+		s.conn.mutex.Unlock()
+		return io.EOF
+	}
+	time.Sleep(s.conn.delay)
+	s.received++
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	service := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }}
+	script := &stub.ReplayScript{Calls: []stub.ReplayCall{
+		{FullMethod: "/acme.v1.Orders/Get", Request: stub.JsonString(`{"id":1}`)},
+		{FullMethod: "/acme.v1.Orders/Get", Request: stub.JsonString(`{"id":2}`), OffsetMs: 10},
+		{FullMethod: "/acme.v1.Orders/Get", Metadata: map[string][]string{"fail": {"true"}}, OffsetMs: 20},
+	}}
+	conn := &replayConn{delay: 20 * time.Millisecond}
+
+	report, err := Replay(context.Background(), conn, service, script, ReplayOptions{Concurrency: 2, Iterations: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, report.Calls)
+	assert.Equal(t, 2, report.Errors)
+	assert.Equal(t, map[string]int{"OK": 4, "UNAVAILABLE": 2}, report.Codes)
+	assert.Equal(t, 6, report.Methods["/acme.v1.Orders/Get"].Calls)
+	assert.True(t, report.Latency.Max >= 20)
+	assert.True(t, report.Latency.Min <= report.Latency.P50 && report.Latency.P50 <= report.Latency.P99)
+	assert.Equal(t, 2, conn.maxInFlight)
+	// The second iteration starts after the offset of the last call of the first one
+	assert.True(t, report.DurationMs >= 40)
+}
+
+func TestReplay_Rate(t *testing.T) {
+	service := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }}
+	script := &stub.ReplayScript{Calls: []stub.ReplayCall{{FullMethod: "/acme.v1.Orders/Get", OffsetMs: 60000}}}
+
+	report, err := Replay(context.Background(), &replayConn{}, service, script, ReplayOptions{Rate: 100, Concurrency: 5, Iterations: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, report.Calls)
+	assert.True(t, report.DurationMs >= 40 && report.DurationMs < 1000)
+}
+
+func TestReplay_InvalidScript(t *testing.T) {
+	service := &versionMockService{method: "/acme.v1.Orders/Get", response: func() interface{} { return new(structpb.Struct) }}
+	_, err := Replay(context.Background(), &replayConn{}, service, &stub.ReplayScript{Calls: []stub.ReplayCall{
+		{FullMethod: "/acme.v1.Orders/List"},
+	}}, ReplayOptions{})
+	assert.EqualError(t, err, "call 0: the method /acme.v1.Orders/List is not supported")
+
+	_, err = Replay(context.Background(), &replayConn{}, service, &stub.ReplayScript{Calls: []stub.ReplayCall{
+		{FullMethod: "/acme.v1.Orders/Get", Request: stub.JsonString(`[]`)},
+	}}, ReplayOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package grpchandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sync"
+	"time"
+)
+
+// ShadowedCall is the copy of a call matched by a stub sent to the shadowing sink
+type ShadowedCall struct {
+	Timestamp  time.Time           `json:"timestamp"`
+	FullMethod string              `json:"fullMethod"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	StubID     string              `json:"stubId"`
+	Request    json.RawMessage     `json:"request"`
+	// Response is the response of the unary calls that succeeded. The messages of the server streaming calls are not
+	// copied.
+	Response json.RawMessage `json:"response,omitempty"`
+	// Error is the error the call failed with
+	Error *ShadowedError `json:"error,omitempty"`
+	// RequestMessage and ResponseMessage are the messages of Request and Response
+	RequestMessage  proto.Message `json:"-"`
+	ResponseMessage proto.Message `json:"-"`
+}
+
+// ShadowedError is the status of a call that failed
+type ShadowedError struct {
+	Code    stub.StatusCode `json:"code"`
+	Message string          `json:"message"`
+}
+
+// ShadowSink receives the copies of the calls, e.g. to store them for offline analysis
+type ShadowSink func(call ShadowedCall) error
+
+// Shadowing sends a copy of every call matched by a stub to a sink, along with the response of the mock. The copies
+// are queued and sent one at a time in the background, and dropped when the queue is full, so the latency of the
+// calls is never affected. It is safe for concurrent use.
+type Shadowing struct {
+	queue chan ShadowedCall
+	mutex sync.RWMutex
+}
+
+var shadowing = new(Shadowing)
+
+// GetShadowing returns the shadowing used by the mock handlers
+func GetShadowing() *Shadowing {
+	return shadowing
+}
+
+// Configure starts sending the copies of the calls to the sink, with a queue of queueSize calls. The copies queued for
+// the previous sink are still sent to it. The shadowing is disabled when the sink is nil.
+func (s *Shadowing) Configure(sink ShadowSink, queueSize int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queue != nil {
+		close(s.queue)
+		s.queue = nil
+	}
+	if sink != nil {
+		s.queue = make(chan ShadowedCall, queueSize)
+		go sendShadowedCalls(sink, s.queue)
+	}
+}
+
+func (s *Shadowing) IsEnabled() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.queue != nil
+}
+
+// shadow queues the copy of the call to the stub, unless the shadowing is disabled or its queue is full. resp is
+// ignored when the call failed.
+func (s *Shadowing) shadow(ctx context.Context, fullMethod string, matched *stub.Stub, req interface{}, paramsJson string, resp interface{}, err error) {
+	if matched == nil || !s.IsEnabled() {
+		return
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	call := ShadowedCall{
+		Timestamp:  time.Now(),
+		FullMethod: fullMethod,
+		Metadata:   md.Copy(),
+		StubID:     matched.ID,
+		Request:    json.RawMessage(paramsJson),
+	}
+	call.RequestMessage, _ = req.(proto.Message)
+	if err != nil {
+		st := status.Convert(err)
+		call.Error = &ShadowedError{Code: stub.StatusCode(st.Code()), Message: st.Message()}
+	} else {
+		call.ResponseMessage, _ = resp.(proto.Message)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.queue == nil {
+		return
+	}
+	select {
+	case s.queue <- call:
+	default:
+		log.Warnf("Dropped the shadow copy of a call to %s: the queue is full", fullMethod)
+	}
+}
+
+// sendShadowedCalls sends the calls queued to the sink until the queue is closed. The responses are converted to JSON
+// here, so that the calls don't wait for it.
+func sendShadowedCalls(sink ShadowSink, queue <-chan ShadowedCall) {
+	for call := range queue {
+		if call.ResponseMessage != nil {
+			if response, err := protojson.Marshal(call.ResponseMessage); err == nil {
+				call.Response = response
+			}
+		}
+		if err := sink(call); err != nil {
+			log.Warnf("Failed to send the shadow copy of a call to %s: %s", call.FullMethod, err.Error())
+		}
+	}
+}
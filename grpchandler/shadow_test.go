@@ -0,0 +1,75 @@
+package grpchandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+	"time"
+)
+
+func TestShadowing_Shadow(t *testing.T) {
+	shadowing := new(Shadowing)
+	calls := make(chan ShadowedCall, 10)
+	shadowing.Configure(func(call ShadowedCall) error {
+		calls <- call
+		return nil
+	}, 10)
+	defer shadowing.Configure(nil, 0)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "acme"))
+	matched := &stub.Stub{ID: "stub-1"}
+	req := &structpb.Struct{Fields: map[string]*structpb.Value{"id": {Kind: &structpb.Value_StringValue{StringValue: "1"}}}}
+	resp := &structpb.Struct{Fields: map[string]*structpb.Value{"status": {Kind: &structpb.Value_StringValue{StringValue: "SHIPPED"}}}}
+
+	shadowing.shadow(ctx, "/acme.Orders/Get", nil, req, `{"id":"1"}`, resp, nil)
+	shadowing.shadow(ctx, "/acme.Orders/Get", matched, req, `{"id":"1"}`, resp, nil)
+	shadowing.shadow(ctx, "/acme.Orders/Get", matched, req, `{"id":"1"}`, resp, status.Error(codes.NotFound, "not found"))
+
+	for _, expected := range []string{
+		`{"fullMethod":"/acme.Orders/Get","metadata":{"tenant":["acme"]},"stubId":"stub-1","request":{"id":"1"},"response":{"status":"SHIPPED"}}`,
+		`{"fullMethod":"/acme.Orders/Get","metadata":{"tenant":["acme"]},"stubId":"stub-1","request":{"id":"1"},"error":{"code":"NOT_FOUND","message":"not found"}}`,
+	} {
+		select {
+		case call := <-calls:
+			assert.Equal(t, req, call.RequestMessage)
+			assert.False(t, call.Timestamp.IsZero())
+			call.Timestamp = time.Time{}
+			data, err := json.Marshal(call)
+			assert.NoError(t, err)
+			assert.JSONEq(t, expected[:len(expected)-1]+`,"timestamp":"0001-01-01T00:00:00Z"}`, string(data))
+		case <-time.After(time.Second):
+			t.Fatal("call not shadowed")
+		}
+	}
+	assert.Empty(t, calls)
+}
+
+func TestShadowing_Shadow_QueueFull(t *testing.T) {
+	shadowing := new(Shadowing)
+	sent := make(chan string)
+	shadowing.Configure(func(call ShadowedCall) error {
+		sent <- call.StubID
+		return nil
+	}, 1)
+	defer shadowing.Configure(nil, 0)
+
+	for _, id := range []string{"stub-1", "stub-2", "stub-3"} {
+		shadowing.shadow(context.Background(), "/acme.Orders/Get", &stub.Stub{ID: id}, nil, "{}", nil, nil)
+		if id == "stub-1" {
+			// The first call is taken from the queue by the sink, which waits until it is read
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	assert.Equal(t, "stub-1", <-sent)
+	assert.Equal(t, "stub-2", <-sent)
+	select {
+	case id := <-sent:
+		t.Fatalf("%s not dropped", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,428 @@
+package grpchandler
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Simulation serves the calls to the resource-style methods of some services that don't match any stub from an
+// in-memory collection of resources, so that creating a resource and getting it back works without stubs. The methods
+// are recognised by their names and messages, following the standard methods of https://google.aip.dev:
+//   - Create<Resource> returns the resource, and has it in a field of the request. The ID of the resource is the first
+//     of its fields name, id and <resource>_id. It is set from the <resource>_id field of the request, or generated,
+//     when empty.
+//   - Get<Resource> and Delete<Resource> have the ID of the resource in a field of the request with the same name, or
+//     named name, id or <resource>_id. Get returns the resource and Delete returns the resource or an empty message.
+//   - Update<Resource> returns the resource, and has it in a field of the request. Only the top level fields in the
+//     paths of update_mask are changed when it is set.
+//   - List<Resources> returns the resources in a repeated field of the response, paginated with page_size and
+//     page_token (next_page_token in the response), and their number in total_size.
+//
+// It is safe for concurrent use.
+type Simulation struct {
+	services    map[string]bool
+	collections map[string]*simulatedCollection
+	mutex       sync.Mutex
+}
+
+// simulatedCollection has the resources of a type in a service, in the order they were created
+type simulatedCollection struct {
+	ids       []string
+	resources map[string]proto.Message
+	lastID    int64
+}
+
+// SimulationStatus describes the services simulated and the resources of each collection, by service and resource
+// type (e.g. acme.v1.Orders/acme.v1.Order)
+type SimulationStatus struct {
+	Services    []string                     `json:"services"`
+	Collections map[string][]json.RawMessage `json:"collections"`
+}
+
+var simulation = &Simulation{
+	services:    make(map[string]bool),
+	collections: make(map[string]*simulatedCollection),
+}
+
+// GetSimulation returns the simulation used by the mock handlers
+func GetSimulation() *Simulation {
+	return simulation
+}
+
+// Configure sets the services simulated (e.g. acme.v1.Orders). The resources of the services no longer simulated are
+// removed.
+func (s *Simulation) Configure(services []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.services = make(map[string]bool, len(services))
+	for _, service := range services {
+		s.services[service] = true
+	}
+	for key := range s.collections {
+		if !s.services[strings.SplitN(key, "/", 2)[0]] {
+			delete(s.collections, key)
+		}
+	}
+}
+
+func (s *Simulation) GetStatus() SimulationStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := SimulationStatus{
+		Services:    make([]string, 0, len(s.services)),
+		Collections: make(map[string][]json.RawMessage, len(s.collections)),
+	}
+	for service := range s.services {
+		result.Services = append(result.Services, service)
+	}
+	sort.Strings(result.Services)
+	for key, collection := range s.collections {
+		resources := make([]json.RawMessage, 0, len(collection.ids))
+		for _, id := range collection.ids {
+			data, err := protojson.Marshal(collection.resources[id])
+			if err != nil {
+				log.Errorf("Failed to encode the simulated resource %s of %s: %s", id, key, err.Error())
+				continue
+			}
+			resources = append(resources, data)
+		}
+		result.Collections[key] = resources
+	}
+	return result
+}
+
+// Reset removes all the resources
+func (s *Simulation) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.collections = make(map[string]*simulatedCollection)
+}
+
+// handle serves the call when the method is a standard method of a simulated service. handled is false when it isn't
+// and the call must be served as usual.
+func (s *Simulation) handle(fullMethod string, req, resp interface{}) (_ interface{}, handled bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	service := ServiceName(fullMethod)
+	if !s.services[service] {
+		return nil, false, nil
+	}
+	request, requestOk := req.(proto.Message)
+	response, responseOk := resp.(proto.Message)
+	if !requestOk || !responseOk {
+		return nil, false, nil
+	}
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	switch {
+	case strings.HasPrefix(method, "Create"):
+		return s.create(service, strings.TrimPrefix(method, "Create"), request.ProtoReflect(), response)
+	case strings.HasPrefix(method, "Get"):
+		return s.get(service, response.ProtoReflect().Descriptor(), request.ProtoReflect(), response, false)
+	case strings.HasPrefix(method, "Update"):
+		return s.update(service, strings.TrimPrefix(method, "Update"), request.ProtoReflect(), response)
+	case strings.HasPrefix(method, "Delete"):
+		return s.delete(service, strings.TrimPrefix(method, "Delete"), request.ProtoReflect(), response)
+	case strings.HasPrefix(method, "List"):
+		return s.list(service, request.ProtoReflect(), response)
+	}
+	return nil, false, nil
+}
+
+func (s *Simulation) create(service, resourceName string, request protoreflect.Message, response proto.Message) (interface{}, bool, error) {
+	resourceField := messageField(request.Descriptor(), response.ProtoReflect().Descriptor())
+	if resourceField == nil || string(response.ProtoReflect().Descriptor().Name()) != resourceName {
+		return nil, false, nil
+	}
+	resource := proto.Clone(request.Get(resourceField).Message().Interface())
+	idField := resourceIDField(resource.ProtoReflect().Descriptor())
+	if idField == nil {
+		return nil, false, nil
+	}
+	collection := s.collection(service, resource.ProtoReflect().Descriptor())
+	id := idString(resource.ProtoReflect(), idField)
+	if id == "" {
+		if requestID := request.Descriptor().Fields().ByName(protoreflect.Name(snakeCase(resourceName) + "_id")); requestID != nil &&
+			idString(request, requestID) != "" {
+			id = idString(request, requestID)
+		} else {
+			collection.lastID++
+			id = strconv.FormatInt(collection.lastID, 10)
+		}
+		if err := setID(resource.ProtoReflect(), idField, id); err != nil {
+			return nil, true, err
+		}
+	}
+	if _, exists := collection.resources[id]; exists {
+		return nil, true, status.Errorf(codes.AlreadyExists, "%s %s already exists", resourceName, id)
+	}
+	collection.ids = append(collection.ids, id)
+	collection.resources[id] = resource
+	log.Infof("SIMULATED create of %s %s in %s", resourceName, id, service)
+	proto.Merge(response, resource)
+	return response, true, nil
+}
+
+func (s *Simulation) get(service string, resourceDescriptor protoreflect.MessageDescriptor, request protoreflect.Message,
+	response proto.Message, remove bool) (interface{}, bool, error) {
+	idField := resourceIDField(resourceDescriptor)
+	if idField == nil {
+		return nil, false, nil
+	}
+	requestID := requestIDField(request.Descriptor(), resourceDescriptor, idField)
+	if requestID == nil {
+		return nil, false, nil
+	}
+	id := idString(request, requestID)
+	collection := s.collection(service, resourceDescriptor)
+	resource, found := collection.resources[id]
+	if !found {
+		return nil, true, status.Errorf(codes.NotFound, "%s %s not found", resourceDescriptor.Name(), id)
+	}
+	if remove {
+		delete(collection.resources, id)
+		for i, existing := range collection.ids {
+			if existing == id {
+				collection.ids = append(collection.ids[:i], collection.ids[i+1:]...)
+				break
+			}
+		}
+		log.Infof("SIMULATED delete of %s %s in %s", resourceDescriptor.Name(), id, service)
+	}
+	if response.ProtoReflect().Descriptor().FullName() == resourceDescriptor.FullName() {
+		proto.Merge(response, resource)
+	}
+	return response, true, nil
+}
+
+func (s *Simulation) delete(service, resourceName string, request protoreflect.Message, response proto.Message) (interface{}, bool, error) {
+	resourceDescriptor := response.ProtoReflect().Descriptor()
+	if string(resourceDescriptor.Name()) != resourceName {
+		// Usually an empty response: the resource is the one of the collection of the service with the name
+		resourceDescriptor = nil
+		for key, collection := range s.collections {
+			name := strings.TrimPrefix(key, service+"/")
+			if name != key && (name == resourceName || strings.HasSuffix(name, "."+resourceName)) && len(collection.ids) > 0 {
+				resourceDescriptor = collection.resources[collection.ids[0]].ProtoReflect().Descriptor()
+			}
+		}
+		if resourceDescriptor == nil {
+			return nil, true, status.Errorf(codes.NotFound, "%s not found", resourceName)
+		}
+	}
+	return s.get(service, resourceDescriptor, request, response, true)
+}
+
+func (s *Simulation) update(service, resourceName string, request protoreflect.Message, response proto.Message) (interface{}, bool, error) {
+	resourceField := messageField(request.Descriptor(), response.ProtoReflect().Descriptor())
+	if resourceField == nil || string(response.ProtoReflect().Descriptor().Name()) != resourceName {
+		return nil, false, nil
+	}
+	update := request.Get(resourceField).Message()
+	idField := resourceIDField(update.Descriptor())
+	if idField == nil {
+		return nil, false, nil
+	}
+	id := idString(update, idField)
+	collection := s.collection(service, update.Descriptor())
+	stored, found := collection.resources[id]
+	if !found {
+		return nil, true, status.Errorf(codes.NotFound, "%s %s not found", resourceName, id)
+	}
+	updated := proto.Clone(update.Interface())
+	if paths := updateMaskPaths(request); len(paths) > 0 {
+		updated = proto.Clone(stored)
+		fields := update.Descriptor().Fields()
+		for _, path := range paths {
+			field := fields.ByName(protoreflect.Name(strings.SplitN(path, ".", 2)[0]))
+			if field == nil {
+				return nil, true, status.Errorf(codes.InvalidArgument, "invalid update mask path %s", path)
+			}
+			if update.Has(field) {
+				updated.ProtoReflect().Set(field, update.Get(field))
+			} else {
+				updated.ProtoReflect().Clear(field)
+			}
+		}
+	}
+	collection.resources[id] = updated
+	log.Infof("SIMULATED update of %s %s in %s", resourceName, id, service)
+	proto.Merge(response, updated)
+	return response, true, nil
+}
+
+func (s *Simulation) list(service string, request protoreflect.Message, response proto.Message) (interface{}, bool, error) {
+	var listField protoreflect.FieldDescriptor
+	fields := response.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if field := fields.Get(i); field.IsList() && field.Kind() == protoreflect.MessageKind {
+			listField = field
+			break
+		}
+	}
+	if listField == nil || resourceIDField(listField.Message()) == nil {
+		return nil, false, nil
+	}
+	collection := s.collection(service, listField.Message())
+	start, end := 0, len(collection.ids)
+	if token := request.Descriptor().Fields().ByName("page_token"); token != nil && request.Get(token).String() != "" {
+		offset, err := strconv.Atoi(request.Get(token).String())
+		if err != nil || offset < 0 || offset > end {
+			return nil, true, status.Errorf(codes.InvalidArgument, "invalid page token %s", request.Get(token).String())
+		}
+		start = offset
+	}
+	if size := request.Descriptor().Fields().ByName("page_size"); size != nil && isIntegerKind(size.Kind()) {
+		if pageSize := int(request.Get(size).Int()); pageSize > 0 && start+pageSize < end {
+			end = start + pageSize
+		}
+	}
+	list := response.ProtoReflect().Mutable(listField).List()
+	for _, id := range collection.ids[start:end] {
+		list.Append(protoreflect.ValueOfMessage(proto.Clone(collection.resources[id]).ProtoReflect()))
+	}
+	responseFields := response.ProtoReflect().Descriptor().Fields()
+	if next := responseFields.ByName("next_page_token"); next != nil && next.Kind() == protoreflect.StringKind &&
+		end < len(collection.ids) {
+		response.ProtoReflect().Set(next, protoreflect.ValueOfString(strconv.Itoa(end)))
+	}
+	if total := responseFields.ByName("total_size"); total != nil && isIntegerKind(total.Kind()) {
+		setID(response.ProtoReflect(), total, strconv.Itoa(len(collection.ids)))
+	}
+	return response, true, nil
+}
+
+func (s *Simulation) collection(service string, resource protoreflect.MessageDescriptor) *simulatedCollection {
+	key := service + "/" + string(resource.FullName())
+	collection, found := s.collections[key]
+	if !found {
+		collection = &simulatedCollection{resources: make(map[string]proto.Message)}
+		s.collections[key] = collection
+	}
+	return collection
+}
+
+// messageField returns the field of the message with the type given
+func messageField(message, fieldType protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Kind() == protoreflect.MessageKind && !field.IsList() && !field.IsMap() &&
+			field.Message().FullName() == fieldType.FullName() {
+			return field
+		}
+	}
+	return nil
+}
+
+// resourceIDField returns the field with the ID of the resource: name, id or <resource>_id
+func resourceIDField(resource protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	for _, name := range []string{"name", "id", snakeCase(string(resource.Name())) + "_id"} {
+		if field := resource.Fields().ByName(protoreflect.Name(name)); isIDField(field) {
+			return field
+		}
+	}
+	return nil
+}
+
+// requestIDField returns the field of the request with the ID of the resource
+func requestIDField(request, resource protoreflect.MessageDescriptor, idField protoreflect.FieldDescriptor) protoreflect.FieldDescriptor {
+	for _, name := range []string{string(idField.Name()), "name", "id", snakeCase(string(resource.Name())) + "_id"} {
+		if field := request.Fields().ByName(protoreflect.Name(name)); isIDField(field) {
+			return field
+		}
+	}
+	return nil
+}
+
+func isIDField(field protoreflect.FieldDescriptor) bool {
+	return field != nil && !field.IsList() && !field.IsMap() &&
+		(field.Kind() == protoreflect.StringKind || isIntegerKind(field.Kind()))
+}
+
+func isIntegerKind(kind protoreflect.Kind) bool {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.Int64Kind,
+		protoreflect.Sint64Kind, protoreflect.Sfixed64Kind, protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
+// idString returns the ID in the field, empty when it is not set
+func idString(message protoreflect.Message, field protoreflect.FieldDescriptor) string {
+	if !message.Has(field) {
+		return ""
+	}
+	return fmt.Sprint(message.Get(field).Interface())
+}
+
+// setID sets the field to the ID, converting it into the type of the field
+func setID(message protoreflect.Message, field protoreflect.FieldDescriptor, id string) error {
+	var value protoreflect.Value
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		value = protoreflect.ValueOfString(id)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		number, err := strconv.ParseInt(id, 10, 32)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid ID %s", id)
+		}
+		value = protoreflect.ValueOfInt32(int32(number))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		number, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid ID %s", id)
+		}
+		value = protoreflect.ValueOfInt64(number)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		number, err := strconv.ParseUint(id, 10, 32)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid ID %s", id)
+		}
+		value = protoreflect.ValueOfUint32(uint32(number))
+	default:
+		number, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid ID %s", id)
+		}
+		value = protoreflect.ValueOfUint64(number)
+	}
+	message.Set(field, value)
+	return nil
+}
+
+// updateMaskPaths returns the paths of the field update_mask (a google.protobuf.FieldMask) of the request
+func updateMaskPaths(request protoreflect.Message) []string {
+	return maskPaths(request, request.Descriptor().Fields().ByName("update_mask"))
+}
+
+// snakeCase converts the name of a message into the snake case of the fields, e.g. OrderItem into order_item
+func snakeCase(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
@@ -0,0 +1,114 @@
+package grpchandler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+)
+
+const simulationProto = `{
+  "name": "acme/v1/orders.proto",
+  "package": "acme.v1",
+  "syntax": "proto3",
+  "messageType": [
+    {"name": "Order", "field": [
+      {"name": "name", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "name"},
+      {"name": "total", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_INT64", "jsonName": "total"},
+      {"name": "status", "number": 3, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "status"}]},
+    {"name": "FieldMask", "field": [
+      {"name": "paths", "number": 1, "label": "LABEL_REPEATED", "type": "TYPE_STRING", "jsonName": "paths"}]},
+    {"name": "CreateOrderRequest", "field": [
+      {"name": "order", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Order", "jsonName": "order"},
+      {"name": "order_id", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "orderId"}]},
+    {"name": "GetOrderRequest", "field": [
+      {"name": "name", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "name"}]},
+    {"name": "UpdateOrderRequest", "field": [
+      {"name": "order", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Order", "jsonName": "order"},
+      {"name": "update_mask", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.FieldMask", "jsonName": "updateMask"}]},
+    {"name": "ListOrdersRequest", "field": [
+      {"name": "page_size", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_INT32", "jsonName": "pageSize"},
+      {"name": "page_token", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "pageToken"}]},
+    {"name": "ListOrdersResponse", "field": [
+      {"name": "orders", "number": 1, "label": "LABEL_REPEATED", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Order", "jsonName": "orders"},
+      {"name": "next_page_token", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "nextPageToken"},
+      {"name": "total_size", "number": 3, "label": "LABEL_OPTIONAL", "type": "TYPE_INT32", "jsonName": "totalSize"}]},
+    {"name": "Empty"}
+  ]
+}`
+
+// simulationCall calls a method of the simulation with the request in JSON and returns the response in JSON
+type simulationCall func(method, request, response, requestJson string) (string, bool, error)
+
+func newSimulationCall(t *testing.T, s *Simulation) simulationCall {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	assert.NoError(t, protojson.Unmarshal([]byte(simulationProto), fdp))
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return func(method, request, response, requestJson string) (string, bool, error) {
+		req := dynamicpb.NewMessage(file.Messages().ByName(protoreflect.Name(request)))
+		assert.NoError(t, protojson.Unmarshal([]byte(requestJson), req))
+		resp, handled, err := s.handle("/acme.v1.Orders/"+method, req, dynamicpb.NewMessage(file.Messages().ByName(protoreflect.Name(response))))
+		if resp == nil {
+			return "", handled, err
+		}
+		data, _ := protojson.Marshal(resp.(proto.Message))
+		return string(data), handled, err
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	s := &Simulation{}
+	s.Configure([]string{"acme.v1.Orders"})
+	s.Reset()
+	call := newSimulationCall(t, s)
+
+	created, handled, err := call("CreateOrder", "CreateOrderRequest", "Order", `{"order":{"total":"10"}}`)
+	assert.True(t, handled)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"1","total":"10"}`, created)
+	created, _, _ = call("CreateOrder", "CreateOrderRequest", "Order", `{"order":{"total":"20"},"orderId":"A-2"}`)
+	assert.JSONEq(t, `{"name":"A-2","total":"20"}`, created)
+	_, _, err = call("CreateOrder", "CreateOrderRequest", "Order", `{"order":{"name":"A-2"}}`)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	got, _, err := call("GetOrder", "GetOrderRequest", "Order", `{"name":"A-2"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"A-2","total":"20"}`, got)
+	_, _, err = call("GetOrder", "GetOrderRequest", "Order", `{"name":"B-3"}`)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	updated, _, err := call("UpdateOrder", "UpdateOrderRequest", "Order", `{"order":{"name":"A-2","status":"PAID","total":"99"},"updateMask":{"paths":["status"]}}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"A-2","total":"20","status":"PAID"}`, updated)
+	updated, _, _ = call("UpdateOrder", "UpdateOrderRequest", "Order", `{"order":{"name":"1","total":"11"}}`)
+	assert.JSONEq(t, `{"name":"1","total":"11"}`, updated)
+
+	listed, _, err := call("ListOrders", "ListOrdersRequest", "ListOrdersResponse", `{"pageSize":1}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"orders":[{"name":"1","total":"11"}],"nextPageToken":"1","totalSize":2}`, listed)
+	listed, _, _ = call("ListOrders", "ListOrdersRequest", "ListOrdersResponse", `{"pageSize":1,"pageToken":"1"}`)
+	assert.JSONEq(t, `{"orders":[{"name":"A-2","total":"20","status":"PAID"}],"totalSize":2}`, listed)
+
+	deleted, _, err := call("DeleteOrder", "GetOrderRequest", "Empty", `{"name":"1"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, deleted)
+	_, _, err = call("DeleteOrder", "GetOrderRequest", "Empty", `{"name":"1"}`)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, 1, len(s.GetStatus().Collections["acme.v1.Orders/acme.v1.Order"]))
+
+	// Not a standard method, or not a simulated service
+	_, handled, _ = call("CancelOrder", "GetOrderRequest", "Order", `{"name":"A-2"}`)
+	assert.False(t, handled)
+	s.Configure(nil)
+	_, handled, _ = call("GetOrder", "GetOrderRequest", "Order", `{"name":"A-2"}`)
+	assert.False(t, handled)
+	assert.Empty(t, s.GetStatus().Collections)
+}
@@ -0,0 +1,101 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// MockStreamHandler handles the streaming calls of the registered services. The stub is matched against the first
+// message sent by the client. For client streaming methods, the other messages are read and discarded: before the
+// response is sent when the server doesn't stream, or concurrently with the response messages otherwise. The registered
+// hooks can change the first message before matching and each response message before it is sent. Only the first
+// message is validated when the validation is enabled. The methods deprecated and the headers and trailers of the stubs
+// are handled as in MockHandler.
+var MockStreamHandler = func(stubsMatcher stub.StubsMatcher, info *grpc.StreamServerInfo, stream grpc.ServerStream, req interface{}, newResp func() interface{}) error {
+	ctx, err := methodDeprecations.check(stream.Context(), info.FullMethod)
+	if err != nil {
+		setStreamHeader(ctx, stream, nil)
+		return err
+	}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	ctx, err = registeredHooks.beforeMatch(ctx, info.FullMethod, req)
+	if err != nil {
+		return err
+	}
+	if err := requestValidation.validate(req); err != nil {
+		return err
+	}
+	paramsJson, err := getRequestInJSON(req)
+	if err != nil {
+		logError(info.FullMethod, paramsJson, err)
+		return err
+	}
+	if info.IsClientStream {
+		// The first message is kept for the hooks
+		discarded := req.(proto.Message).ProtoReflect().New().Interface()
+		if info.IsServerStream {
+			go drainStream(stream, discarded)
+		} else {
+			drainStream(stream, discarded)
+		}
+	}
+	message, _ := req.(proto.Message)
+	s := stubsMatcher.Match(stub.WithRequestMessage(ctx, message), info.FullMethod, paramsJson)
+	if s != nil {
+		markMatched(ctx)
+		s, err = stub.RunScript(ctx, s, paramsJson)
+	}
+	if s != nil && err == nil {
+		ctx, err = withStubMetadata(ctx, s, paramsJson, stream.SetTrailer)
+	}
+	setStreamHeader(ctx, stream, s)
+	switch {
+	case s == nil && err == nil:
+		err = strictMode.noStubFound(info.FullMethod, paramsJson)
+	case err == nil:
+		err = sendStreamResponse(ctx, stream, info.FullMethod, s, req, paramsJson, newResp)
+	}
+	sendStreamErrorHeader(stream, s, err)
+	shadowing.shadow(ctx, info.FullMethod, s, req, paramsJson, nil, err)
+	return err
+}
+
+// sendStreamResponse sends the messages of the stub paced as configured. When the messages are repeated, they are
+// rendered again on every repetition so that the placeholders (e.g. ${now}) are updated. The message sent with the index
+// of the frame fault of the stub, if any, is replaced by a raw frame.
+func sendStreamResponse(ctx context.Context, stream grpc.ServerStream, fullMethod string, s *stub.Stub, req interface{}, paramsJson string, newResp func() interface{}) error {
+	pacing := s.Response.Pacing
+	sent := 0
+	for {
+		messages, responseErr := stub.GetStreamResponse(ctx, s, paramsJson, newResp)
+		for _, message := range messages {
+			if err := pacing.Wait(ctx, sent); err != nil {
+				return err
+			}
+			fieldMaskTrimming.trim(req, message)
+			if err := registeredHooks.beforeSend(ctx, fullMethod, req, message); err != nil {
+				return err
+			}
+			if err := stream.SendMsg(withFrameFault(s, sent, message)); err != nil {
+				return err
+			}
+			sent++
+		}
+		if responseErr != nil || len(messages) == 0 || pacing == nil || !pacing.Repeat {
+			return responseErr
+		}
+	}
+}
+
+// drainStream reads the messages sent by the client until the stream is closed
+func drainStream(stream grpc.ServerStream, req interface{}) {
+	for {
+		if err := stream.RecvMsg(req); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+const (
+	serverStreamMethod = "/test.Streams/ServerStream"
+	clientStreamMethod = "/test.Streams/ClientStream"
+)
+
+func newStreamHandler(fullMethod string, clientStreams, serverStreams bool) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		info := &grpc.StreamServerInfo{FullMethod: fullMethod, IsClientStream: clientStreams, IsServerStream: serverStreams}
+		newResp := func() interface{} { return new(structpb.Struct) }
+		return MockStreamHandler(srv.(stub.StubsMatcher), info, stream, new(structpb.Struct), newResp)
+	}
+}
+
+var streamsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Streams",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ServerStream", Handler: newStreamHandler(serverStreamMethod, false, true), ServerStreams: true},
+		{StreamName: "ClientStream", Handler: newStreamHandler(clientStreamMethod, true, false), ClientStreams: true},
+	},
+}
+
+func startStreamsServer(t *testing.T, stubs ...*stub.Stub) (*grpc.ClientConn, func()) {
+	store := stub.NewInMemoryStubsStore()
+	for _, s := range stubs {
+		assert.NoError(t, store.Add(context.Background(), s))
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.CustomCodec(Codec{}))
+	server.RegisterService(&streamsServiceDesc, stub.NewStubsMatcher(store))
+	go server.Serve(listener)
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	return conn, func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func newStruct(name string) *structpb.Struct {
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"name": {Kind: &structpb.Value_StringValue{StringValue: name}},
+	}}
+}
+
+func TestMockStreamHandler_PartialResponseThenError(t *testing.T) {
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: serverStreamMethod,
+		Request:    &stub.StubRequest{Match: "exact", Content: "{\"name\":\"John\"}"},
+		Response: &stub.StubResponse{
+			Type:   "error",
+			Stream: []stub.JsonString{"{\"name\":\"first\"}", "{\"name\":\"second\"}"},
+			Error:  &stub.ErrorResponse{Code: stub.StatusCode(codes.Unavailable), Message: "connection lost"},
+		},
+	})
+	defer stop()
+
+	stream, err := conn.NewStream(context.Background(), &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+
+	received := make([]string, 0)
+	for {
+		message := new(structpb.Struct)
+		err = stream.RecvMsg(message)
+		if err != nil {
+			break
+		}
+		received = append(received, message.Fields["name"].GetStringValue())
+	}
+	assert.Equal(t, []string{"first", "second"}, received)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "connection lost", status.Convert(err).Message())
+}
+
+func TestMockStreamHandler_ClientStream(t *testing.T) {
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: clientStreamMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{\"name\":\"John\"}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{\"name\":\"done\"}"},
+	})
+	defer stop()
+
+	stream, err := conn.NewStream(context.Background(), &streamsServiceDesc.Streams[1], clientStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.SendMsg(newStruct("Mary")))
+	assert.NoError(t, stream.CloseSend())
+
+	message := new(structpb.Struct)
+	assert.NoError(t, stream.RecvMsg(message))
+	assert.Equal(t, "done", message.Fields["name"].GetStringValue())
+	assert.Equal(t, io.EOF, stream.RecvMsg(message))
+}
+
+func TestMockStreamHandler_PacingRepeat(t *testing.T) {
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: serverStreamMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response: &stub.StubResponse{
+			Type:   "success",
+			Stream: []stub.JsonString{"{\"name\":\"heartbeat\"}"},
+			Pacing: &stub.StreamPacing{Delays: []string{"0s", "10ms"}, Repeat: true},
+		},
+	})
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		message := new(structpb.Struct)
+		assert.NoError(t, stream.RecvMsg(message))
+		assert.Equal(t, "heartbeat", message.Fields["name"].GetStringValue())
+	}
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(stream.RecvMsg(new(structpb.Struct))))
+}
+
+func TestMockStreamHandler_HeadersAndTrailers(t *testing.T) {
+	conn, stop := startStreamsServer(t, &stub.Stub{
+		FullMethod: serverStreamMethod,
+		Request:    &stub.StubRequest{Match: "partial", Content: "{}"},
+		Response: &stub.StubResponse{
+			Type:     "success",
+			Content:  "{\"name\":\"${metadata.accept-language}\"}",
+			Headers:  map[string]string{"x-correlation-id": "${metadata.x-correlation-id}", "x-tenant": "${metadata.x-tenant}"},
+			Trailers: map[string]string{"x-request-name": "${request.name}"},
+		},
+	})
+	defer stop()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-correlation-id", "c-1", "accept-language", "pt-BR")
+	stream, err := conn.NewStream(ctx, &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+	message := new(structpb.Struct)
+	assert.NoError(t, stream.RecvMsg(message))
+	assert.Equal(t, "pt-BR", message.Fields["name"].GetStringValue())
+	assert.Equal(t, io.EOF, stream.RecvMsg(message))
+
+	header, err := stream.Header()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c-1"}, header.Get("x-correlation-id"))
+	// The metadata not sent is left out
+	assert.Empty(t, header.Get("x-tenant"))
+	assert.Equal(t, []string{"John"}, stream.Trailer().Get("x-request-name"))
+}
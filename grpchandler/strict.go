@@ -0,0 +1,81 @@
+package grpchandler
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync/atomic"
+)
+
+// StrictModeCode is the status code returned for the calls that don't match any stub in strict mode
+const StrictModeCode = codes.Unimplemented
+
+// StrictMode makes the calls that don't match any stub fail with StrictModeCode and counts them. It is safe for
+// concurrent use.
+type StrictMode struct {
+	enabled         int32
+	failReadiness   int32
+	unexpectedCalls int64
+}
+
+// StrictModeStatus describes the strict mode settings and the unexpected calls received
+type StrictModeStatus struct {
+	Enabled         bool  `json:"enabled"`
+	FailReadiness   bool  `json:"failReadiness"`
+	UnexpectedCalls int64 `json:"unexpectedCalls"`
+}
+
+var strictMode = new(StrictMode)
+
+// GetStrictMode returns the strict mode used by the mock handlers
+func GetStrictMode() *StrictMode {
+	return strictMode
+}
+
+// Configure enables or disables the strict mode. When failReadiness is set, the server is reported as not ready once
+// an unexpected call is received.
+func (s *StrictMode) Configure(enabled, failReadiness bool) {
+	atomic.StoreInt32(&s.enabled, boolToInt32(enabled))
+	atomic.StoreInt32(&s.failReadiness, boolToInt32(failReadiness))
+}
+
+func (s *StrictMode) IsEnabled() bool {
+	return atomic.LoadInt32(&s.enabled) == 1
+}
+
+// IsHealthy is false when the strict mode must fail the readiness probe due to unexpected calls
+func (s *StrictMode) IsHealthy() bool {
+	return atomic.LoadInt32(&s.failReadiness) == 0 || atomic.LoadInt64(&s.unexpectedCalls) == 0
+}
+
+func (s *StrictMode) GetStatus() StrictModeStatus {
+	return StrictModeStatus{
+		Enabled:         s.IsEnabled(),
+		FailReadiness:   atomic.LoadInt32(&s.failReadiness) == 1,
+		UnexpectedCalls: atomic.LoadInt64(&s.unexpectedCalls),
+	}
+}
+
+// Reset clears the count of unexpected calls
+func (s *StrictMode) Reset() {
+	atomic.StoreInt64(&s.unexpectedCalls, 0)
+}
+
+// noStubFound creates the error returned for the calls that don't match any stub
+func (s *StrictMode) noStubFound(fullMethod, paramsJson string) error {
+	log.Infof("NO mock response found for %s --> %s", fullMethod, util.LoggablePayload(paramsJson))
+	if !s.IsEnabled() {
+		return fmt.Errorf("no response found")
+	}
+	atomic.AddInt64(&s.unexpectedCalls, 1)
+	return status.Errorf(StrictModeCode, "strict mode: unexpected call to %s", fullMethod)
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestMockHandler_StrictMode(t *testing.T) {
+	matcher := stub.NewStubsMatcher(stub.NewInMemoryStubsStore())
+	defer func() {
+		strictMode.Configure(false, false)
+		strictMode.Reset()
+	}()
+
+	_, err := MockHandler(context.Background(), matcher, "/test.Service/Method", newStruct("John"), new(structpb.Struct))
+	assert.Error(t, err)
+	assert.Equal(t, codes.Unknown, status.Code(err))
+	assert.Equal(t, int64(0), strictMode.GetStatus().UnexpectedCalls)
+
+	strictMode.Configure(true, false)
+	_, err = MockHandler(context.Background(), matcher, "/test.Service/Method", newStruct("John"), new(structpb.Struct))
+	assert.Equal(t, StrictModeCode, status.Code(err))
+	assert.Equal(t, int64(1), strictMode.GetStatus().UnexpectedCalls)
+	assert.True(t, strictMode.IsHealthy())
+
+	strictMode.Configure(true, true)
+	assert.False(t, strictMode.IsHealthy())
+	strictMode.Reset()
+	assert.True(t, strictMode.IsHealthy())
+}
+
+func TestMockStreamHandler_StrictMode(t *testing.T) {
+	strictMode.Configure(true, false)
+	defer func() {
+		strictMode.Configure(false, false)
+		strictMode.Reset()
+	}()
+	conn, stop := startStreamsServer(t)
+	defer stop()
+
+	stream, err := conn.NewStream(context.Background(), &streamsServiceDesc.Streams[0], serverStreamMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(newStruct("John")))
+	assert.NoError(t, stream.CloseSend())
+
+	err = stream.RecvMsg(new(structpb.Struct))
+	assert.Equal(t, StrictModeCode, status.Code(err))
+	assert.Equal(t, int64(1), strictMode.GetStatus().UnexpectedCalls)
+}
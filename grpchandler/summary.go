@@ -0,0 +1,158 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"time"
+)
+
+// maxLatencySamples is the number of latencies kept per method for the percentiles. The oldest are dropped.
+const maxLatencySamples = 10000
+
+// CallSummary totals the calls received since it was last reset (e.g. at the start of a test run): the calls and the
+// errors by method, how many matched a stub and the latency of the calls as seen by the server, which is the time
+// added by the delays. It is safe for concurrent use.
+type CallSummary struct {
+	since   time.Time
+	methods map[string]*methodSummary
+	mutex   sync.Mutex
+}
+
+type methodSummary struct {
+	calls     int
+	matched   int
+	errors    map[string]int
+	latencies []time.Duration
+}
+
+// SummaryCall is a call in progress counted by the summary
+type SummaryCall struct {
+	summary    *CallSummary
+	fullMethod string
+	start      time.Time
+	matched    bool
+}
+
+type summaryCallKey struct{}
+
+// MethodSummary totals the calls to a method
+type MethodSummary struct {
+	Calls   int `json:"calls"`
+	Matched int `json:"matched"`
+	// MatchRate is the fraction of the calls that matched a stub or were served by the simulation
+	MatchRate float64      `json:"matchRate"`
+	Latency   LatencyStats `json:"latency"`
+	// Errors counts the calls that failed by status code
+	Errors map[string]int `json:"errors"`
+}
+
+// SummaryReport totals the calls received since Since
+type SummaryReport struct {
+	Since time.Time `json:"since"`
+	MethodSummary
+	Methods map[string]*MethodSummary `json:"methods"`
+}
+
+var callSummary = NewCallSummary()
+
+func NewCallSummary() *CallSummary {
+	return &CallSummary{since: time.Now(), methods: make(map[string]*methodSummary)}
+}
+
+// GetCallSummary returns the summary of the calls to the mock handlers
+func GetCallSummary() *CallSummary {
+	return callSummary
+}
+
+// Start counts a call, which is finished with End. The context returned lets the mock handlers tell if it matched.
+func (s *CallSummary) Start(ctx context.Context, fullMethod string) (context.Context, *SummaryCall) {
+	call := &SummaryCall{summary: s, fullMethod: fullMethod, start: time.Now()}
+	return context.WithValue(ctx, summaryCallKey{}, call), call
+}
+
+// End adds the call to the summary with the error it finished with, if any
+func (c *SummaryCall) End(err error) {
+	c.summary.add(c.fullMethod, c.matched, time.Since(c.start), err)
+}
+
+// markMatched records that the call matched a stub or was served by the simulation
+func markMatched(ctx context.Context) {
+	if call, ok := ctx.Value(summaryCallKey{}).(*SummaryCall); ok {
+		call.matched = true
+	}
+}
+
+func (s *CallSummary) add(fullMethod string, matched bool, latency time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	method, ok := s.methods[fullMethod]
+	if !ok {
+		method = &methodSummary{errors: make(map[string]int)}
+		s.methods[fullMethod] = method
+	}
+	method.calls++
+	if matched {
+		method.matched++
+	}
+	if code := status.Code(err); code != codes.OK {
+		method.errors[stub.StatusCode(code).String()]++
+	}
+	method.latencies = append(method.latencies, latency)
+	if len(method.latencies) > maxLatencySamples {
+		method.latencies = method.latencies[len(method.latencies)-maxLatencySamples:]
+	}
+}
+
+// Report returns the totals of the calls, overall and by method
+func (s *CallSummary) Report() *SummaryReport {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	report := &SummaryReport{
+		Since:         s.since,
+		MethodSummary: MethodSummary{Errors: make(map[string]int)},
+		Methods:       make(map[string]*MethodSummary, len(s.methods)),
+	}
+	latencies := make([]time.Duration, 0)
+	for fullMethod, method := range s.methods {
+		methodLatencies := append([]time.Duration(nil), method.latencies...)
+		methodReport := &MethodSummary{
+			Calls:     method.calls,
+			Matched:   method.matched,
+			MatchRate: matchRate(method.matched, method.calls),
+			Latency:   newLatencyStats(methodLatencies),
+			Errors:    make(map[string]int, len(method.errors)),
+		}
+		for code, count := range method.errors {
+			methodReport.Errors[code] = count
+			report.Errors[code] += count
+		}
+		report.Methods[fullMethod] = methodReport
+		report.Calls += method.calls
+		report.Matched += method.matched
+		latencies = append(latencies, method.latencies...)
+	}
+	report.MatchRate = matchRate(report.Matched, report.Calls)
+	report.Latency = newLatencyStats(latencies)
+	return report
+}
+
+// Reset clears the totals, starting a new run
+func (s *CallSummary) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.since = time.Now()
+	s.methods = make(map[string]*methodSummary)
+}
+
+func matchRate(matched, calls int) float64 {
+	if calls == 0 {
+		return 0
+	}
+	return float64(matched) / float64(calls)
+}
@@ -0,0 +1,41 @@
+package grpchandler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestCallSummary(t *testing.T) {
+	summary := NewCallSummary()
+	call := func(fullMethod string, matched bool, err error) {
+		ctx, c := summary.Start(context.Background(), fullMethod)
+		if matched {
+			markMatched(ctx)
+		}
+		c.End(err)
+	}
+	call("/acme.Orders/Get", true, nil)
+	call("/acme.Orders/Get", true, status.Error(codes.NotFound, "not found"))
+	call("/acme.Orders/Get", false, status.Error(codes.Unimplemented, "unexpected call"))
+	call("/acme.Orders/List", true, nil)
+
+	report := summary.Report()
+	assert.Equal(t, 4, report.Calls)
+	assert.Equal(t, 3, report.Matched)
+	assert.Equal(t, 0.75, report.MatchRate)
+	assert.Equal(t, map[string]int{"NOT_FOUND": 1, "UNIMPLEMENTED": 1}, report.Errors)
+	assert.Len(t, report.Methods, 2)
+	get := report.Methods["/acme.Orders/Get"]
+	assert.Equal(t, 3, get.Calls)
+	assert.Equal(t, 2, get.Matched)
+	assert.True(t, get.Latency.P50 <= get.Latency.Max)
+	assert.Equal(t, map[string]int{}, report.Methods["/acme.Orders/List"].Errors)
+
+	summary.Reset()
+	report = summary.Report()
+	assert.Equal(t, 0, report.Calls)
+	assert.Empty(t, report.Methods)
+}
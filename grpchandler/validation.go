@@ -0,0 +1,833 @@
+package grpchandler
+
+import (
+	"fmt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// Numbers of the extensions of the descriptor options with the rules of protoc-gen-validate (validate.rules,
+// validate.required and validate.disabled) and protovalidate (buf.validate.field, buf.validate.oneof and
+// buf.validate.message)
+const (
+	pgvExtension           protowire.Number = 1071
+	protovalidateExtension protowire.Number = 1159
+)
+
+// Kinds of the values of the numeric rules, by their number in the rules of a field
+var numberRuleKinds = map[protowire.Number]protoreflect.Kind{
+	1:  protoreflect.FloatKind,
+	2:  protoreflect.DoubleKind,
+	3:  protoreflect.Int32Kind,
+	4:  protoreflect.Int64Kind,
+	5:  protoreflect.Uint32Kind,
+	6:  protoreflect.Uint64Kind,
+	7:  protoreflect.Sint32Kind,
+	8:  protoreflect.Sint64Kind,
+	9:  protoreflect.Fixed32Kind,
+	10: protoreflect.Fixed64Kind,
+	11: protoreflect.Sfixed32Kind,
+	12: protoreflect.Sfixed64Kind,
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+)
+
+// RequestValidation rejects the requests that break the rules of protoc-gen-validate
+// (https://github.com/envoyproxy/protoc-gen-validate) or protovalidate (https://github.com/bufbuild/protovalidate) set
+// in the options of their messages, before they are matched against the stubs, like a real server validating its
+// requests. The requests fail with INVALID_ARGUMENT and a BadRequest detail listing the violations. The rules are read
+// from the descriptors, so the packages of the rules don't need to be linked in. The rules of the durations,
+// timestamps and Any fields and the CEL expressions are not checked. It is safe for concurrent use.
+type RequestValidation struct {
+	enabled int32
+	// rules caches the *messageRules of the messages by their full name
+	rules sync.Map
+}
+
+// messageRules are the rules of the fields and oneofs of a message
+type messageRules struct {
+	disabled       bool
+	fields         map[protoreflect.FieldNumber]*fieldRules
+	requiredOneofs map[protoreflect.Name]bool
+}
+
+// fieldRules are the rules of a field, or of the items, keys or values of a repeated or map field
+type fieldRules struct {
+	required    bool
+	skip        bool
+	ignoreEmpty bool
+	number      *numberRules
+	text        *textRules
+	boolConst   *bool
+	definedOnly bool
+	collection  *collectionRules
+}
+
+type numberRules struct {
+	constant, lt, lte, gt, gte *float64
+	in, notIn                  []float64
+}
+
+// textRules are the rules of the strings and the bytes. The lengths in runes only apply to the strings.
+type textRules struct {
+	constant                              *string
+	length, minLength, maxLength          *uint64
+	lengthBytes, minBytes, maxBytes       *uint64
+	pattern                               *regexp.Regexp
+	prefix, suffix, contains, notContains *string
+	in, notIn                             []string
+	format                                string
+}
+
+// collectionRules are the rules of the repeated and map fields
+type collectionRules struct {
+	min, max            *uint64
+	unique              bool
+	items, keys, values *fieldRules
+}
+
+var requestValidation = new(RequestValidation)
+
+// GetRequestValidation returns the request validation used by the mock handlers
+func GetRequestValidation() *RequestValidation {
+	return requestValidation
+}
+
+// Configure enables or disables the validation of the requests
+func (v *RequestValidation) Configure(enabled bool) {
+	atomic.StoreInt32(&v.enabled, boolToInt32(enabled))
+}
+
+func (v *RequestValidation) IsEnabled() bool {
+	return atomic.LoadInt32(&v.enabled) == 1
+}
+
+// validate checks the request against the rules of its message when the validation is enabled
+func (v *RequestValidation) validate(req interface{}) error {
+	message, ok := req.(proto.Message)
+	if !ok || !v.IsEnabled() {
+		return nil
+	}
+	violations := v.validateMessage(message.ProtoReflect(), "", nil)
+	if len(violations) == 0 {
+		return nil
+	}
+	st := status.Newf(codes.InvalidArgument, "invalid %s.%s: %s", message.ProtoReflect().Descriptor().Name(),
+		violations[0].Field, violations[0].Description)
+	if withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func (v *RequestValidation) validateMessage(m protoreflect.Message, prefix string,
+	violations []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	rules := v.messageRules(m.Descriptor())
+	if rules.disabled {
+		return violations
+	}
+	oneofs := m.Descriptor().Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if rules.requiredOneofs[oneof.Name()] && m.WhichOneof(oneof) == nil {
+			violations = appendViolation(violations, prefix+string(oneof.Name()), "value is required")
+		}
+	}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		path := prefix + string(field.Name())
+		violations = v.validateField(m, field, rules.fields[field.Number()], path, violations)
+	}
+	return violations
+}
+
+func (v *RequestValidation) validateField(m protoreflect.Message, field protoreflect.FieldDescriptor, rules *fieldRules,
+	path string, violations []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	if rules == nil {
+		rules = &fieldRules{}
+	}
+	if rules.skip {
+		return violations
+	}
+	populated := m.Has(field)
+	if !populated && rules.required {
+		return appendViolation(violations, path, "value is required")
+	}
+	isMessage := field.Message() != nil && !field.IsList() && !field.IsMap()
+	if !populated && (rules.ignoreEmpty || isMessage) {
+		return violations
+	}
+	value := m.Get(field)
+	switch {
+	case field.IsList():
+		list := value.List()
+		violations = checkCollection(rules.collection, list.Len(), path, violations)
+		for i := 0; i < list.Len(); i++ {
+			violations = v.validateValue(field, list.Get(i), itemRules(rules.collection, false),
+				fmt.Sprintf("%s[%d]", path, i), violations)
+		}
+		if rules.collection != nil && rules.collection.unique && !uniqueItems(list) {
+			violations = appendViolation(violations, path, "repeated value must contain unique items")
+		}
+	case field.IsMap():
+		entries := value.Map()
+		violations = checkCollection(rules.collection, entries.Len(), path, violations)
+		entries.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			entryPath := fmt.Sprintf("%s[%v]", path, key.Interface())
+			violations = v.validateValue(field.MapKey(), key.Value(), itemRules(rules.collection, true), entryPath, violations)
+			violations = v.validateValue(field.MapValue(), value, valueRules(rules.collection), entryPath, violations)
+			return true
+		})
+	default:
+		violations = v.validateValue(field, value, rules, path, violations)
+	}
+	return violations
+}
+
+// validateValue checks a value of the field (the field itself, an item of a list or a key or value of a map)
+func (v *RequestValidation) validateValue(field protoreflect.FieldDescriptor, value protoreflect.Value, rules *fieldRules,
+	path string, violations []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	if field.Message() != nil {
+		if rules == nil || !rules.skip {
+			violations = v.validateMessage(value.Message(), path+".", violations)
+		}
+		return violations
+	}
+	if rules == nil || rules.skip {
+		return violations
+	}
+	for _, description := range rules.check(field, value) {
+		violations = appendViolation(violations, path, description)
+	}
+	return violations
+}
+
+func itemRules(collection *collectionRules, keys bool) *fieldRules {
+	switch {
+	case collection == nil:
+		return nil
+	case keys:
+		return collection.keys
+	}
+	return collection.items
+}
+
+func valueRules(collection *collectionRules) *fieldRules {
+	if collection == nil {
+		return nil
+	}
+	return collection.values
+}
+
+func checkCollection(rules *collectionRules, size int, path string,
+	violations []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	if rules == nil {
+		return violations
+	}
+	if rules.min != nil && uint64(size) < *rules.min {
+		violations = appendViolation(violations, path, fmt.Sprintf("value must contain at least %d item(s)", *rules.min))
+	}
+	if rules.max != nil && uint64(size) > *rules.max {
+		violations = appendViolation(violations, path, fmt.Sprintf("value must contain no more than %d item(s)", *rules.max))
+	}
+	return violations
+}
+
+func uniqueItems(list protoreflect.List) bool {
+	seen := make(map[interface{}]bool, list.Len())
+	for i := 0; i < list.Len(); i++ {
+		item := list.Get(i).Interface()
+		if bytes, ok := item.([]byte); ok {
+			item = string(bytes)
+		}
+		if _, ok := item.(protoreflect.Message); ok {
+			return true
+		}
+		if seen[item] {
+			return false
+		}
+		seen[item] = true
+	}
+	return true
+}
+
+func appendViolation(violations []*errdetails.BadRequest_FieldViolation, field,
+	description string) []*errdetails.BadRequest_FieldViolation {
+	return append(violations, &errdetails.BadRequest_FieldViolation{Field: field, Description: description})
+}
+
+// check returns the descriptions of the rules broken by a scalar value
+func (r *fieldRules) check(field protoreflect.FieldDescriptor, value protoreflect.Value) []string {
+	var broken []string
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		if r.boolConst != nil && value.Bool() != *r.boolConst {
+			broken = append(broken, fmt.Sprintf("value must equal %t", *r.boolConst))
+		}
+	case protoreflect.StringKind:
+		broken = r.text.check(value.String(), true)
+	case protoreflect.BytesKind:
+		broken = r.text.check(string(value.Bytes()), false)
+	case protoreflect.EnumKind:
+		if r.definedOnly && field.Enum().Values().ByNumber(value.Enum()) == nil {
+			broken = append(broken, "value must be one of the defined enum values")
+		}
+		broken = append(broken, r.number.check(float64(value.Enum()))...)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		broken = r.number.check(value.Float())
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+		broken = r.number.check(float64(value.Uint()))
+	default:
+		broken = r.number.check(float64(value.Int()))
+	}
+	return broken
+}
+
+func (r *numberRules) check(x float64) []string {
+	if r == nil {
+		return nil
+	}
+	var broken []string
+	if r.constant != nil && x != *r.constant {
+		broken = append(broken, "value must equal "+formatNumber(*r.constant))
+	}
+	lower, lowerText := r.gt, "greater than"
+	if r.gte != nil {
+		lower, lowerText = r.gte, "greater than or equal to"
+	}
+	upper, upperText := r.lt, "less than"
+	if r.lte != nil {
+		upper, upperText = r.lte, "less than or equal to"
+	}
+	aboveLower := lower == nil || x > *lower || (r.gte != nil && x == *lower)
+	belowUpper := upper == nil || x < *upper || (r.lte != nil && x == *upper)
+	switch {
+	case lower != nil && upper != nil && *lower > *upper:
+		// An exclusive range: the values between the bounds are not valid
+		if !aboveLower && !belowUpper {
+			broken = append(broken, fmt.Sprintf("value must be %s %s or %s %s", upperText, formatNumber(*upper),
+				lowerText, formatNumber(*lower)))
+		}
+	case !aboveLower:
+		broken = append(broken, fmt.Sprintf("value must be %s %s", lowerText, formatNumber(*lower)))
+	case !belowUpper:
+		broken = append(broken, fmt.Sprintf("value must be %s %s", upperText, formatNumber(*upper)))
+	}
+	if len(r.in) > 0 && !containsNumber(r.in, x) {
+		broken = append(broken, "value must be in list "+formatNumbers(r.in))
+	}
+	if containsNumber(r.notIn, x) {
+		broken = append(broken, "value must not be in list "+formatNumbers(r.notIn))
+	}
+	return broken
+}
+
+func (r *textRules) check(s string, isString bool) []string {
+	if r == nil {
+		return nil
+	}
+	var broken []string
+	unit := "bytes"
+	if isString {
+		unit = "runes"
+	}
+	if r.constant != nil && s != *r.constant {
+		broken = append(broken, fmt.Sprintf("value must equal %q", *r.constant))
+	}
+	runes := uint64(utf8.RuneCountInString(s))
+	size := uint64(len(s))
+	if !isString {
+		runes = size
+	}
+	broken = append(broken, checkLength(runes, r.length, r.minLength, r.maxLength, unit)...)
+	broken = append(broken, checkLength(size, r.lengthBytes, r.minBytes, r.maxBytes, "bytes")...)
+	if r.pattern != nil && !r.pattern.MatchString(s) {
+		broken = append(broken, fmt.Sprintf("value does not match regex pattern %q", r.pattern.String()))
+	}
+	if r.prefix != nil && !strings.HasPrefix(s, *r.prefix) {
+		broken = append(broken, fmt.Sprintf("value does not have prefix %q", *r.prefix))
+	}
+	if r.suffix != nil && !strings.HasSuffix(s, *r.suffix) {
+		broken = append(broken, fmt.Sprintf("value does not have suffix %q", *r.suffix))
+	}
+	if r.contains != nil && !strings.Contains(s, *r.contains) {
+		broken = append(broken, fmt.Sprintf("value does not contain substring %q", *r.contains))
+	}
+	if r.notContains != nil && strings.Contains(s, *r.notContains) {
+		broken = append(broken, fmt.Sprintf("value contains substring %q", *r.notContains))
+	}
+	if len(r.in) > 0 && !containsString(r.in, s) {
+		broken = append(broken, fmt.Sprintf("value must be in list %q", r.in))
+	}
+	if containsString(r.notIn, s) {
+		broken = append(broken, fmt.Sprintf("value must not be in list %q", r.notIn))
+	}
+	if r.format != "" && !validFormat(r.format, s) {
+		broken = append(broken, fmt.Sprintf("value must be a valid %s", r.format))
+	}
+	return broken
+}
+
+func checkLength(length uint64, exact, min, max *uint64, unit string) []string {
+	var broken []string
+	if exact != nil && length != *exact {
+		broken = append(broken, fmt.Sprintf("value length must be %d %s", *exact, unit))
+	}
+	if min != nil && length < *min {
+		broken = append(broken, fmt.Sprintf("value length must be at least %d %s", *min, unit))
+	}
+	if max != nil && length > *max {
+		broken = append(broken, fmt.Sprintf("value length must be at most %d %s", *max, unit))
+	}
+	return broken
+}
+
+// validFormat checks the well-known formats of the strings, named as in the messages of the violations
+func validFormat(format, s string) bool {
+	ip := net.ParseIP(s)
+	switch format {
+	case "email address":
+		address, err := mail.ParseAddress(s)
+		return err == nil && address.Address == s
+	case "hostname":
+		return len(s) <= 253 && hostnamePattern.MatchString(s)
+	case "IP address":
+		return ip != nil
+	case "IPv4 address":
+		return ip != nil && strings.Contains(s, ".")
+	case "IPv6 address":
+		return ip != nil && strings.Contains(s, ":")
+	case "URI":
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	case "URI reference":
+		_, err := url.Parse(s)
+		return err == nil
+	case "hostname or IP address":
+		return ip != nil || (len(s) <= 253 && hostnamePattern.MatchString(s))
+	case "UUID":
+		return uuidPattern.MatchString(s)
+	}
+	return true
+}
+
+func containsNumber(list []float64, x float64) bool {
+	for _, item := range list {
+		if item == x {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func formatNumber(x float64) string {
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+func formatNumbers(list []float64) string {
+	texts := make([]string, len(list))
+	for i, x := range list {
+		texts[i] = formatNumber(x)
+	}
+	return "[" + strings.Join(texts, ", ") + "]"
+}
+
+// messageRules returns the rules of the message, reading them from its descriptor the first time
+func (v *RequestValidation) messageRules(descriptor protoreflect.MessageDescriptor) *messageRules {
+	if rules, ok := v.rules.Load(descriptor.FullName()); ok {
+		return rules.(*messageRules)
+	}
+	rules := &messageRules{
+		fields:         make(map[protoreflect.FieldNumber]*fieldRules),
+		requiredOneofs: make(map[protoreflect.Name]bool),
+	}
+	forEachExtension(descriptor.Options(), func(extension protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case extension == pgvExtension && typ == protowire.VarintType:
+			rules.disabled = rules.disabled || decodeBool(value)
+		case extension == protovalidateExtension && typ == protowire.BytesType:
+			forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+				rules.disabled = rules.disabled || (num == 1 && decodeBool(value))
+			})
+		}
+	})
+	oneofs := descriptor.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		forEachExtension(oneof.Options(), func(extension protowire.Number, typ protowire.Type, value []byte) {
+			switch {
+			case extension == pgvExtension && typ == protowire.VarintType:
+				rules.requiredOneofs[oneof.Name()] = decodeBool(value)
+			case extension == protovalidateExtension && typ == protowire.BytesType:
+				forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+					if num == 1 {
+						rules.requiredOneofs[oneof.Name()] = decodeBool(value)
+					}
+				})
+			}
+		})
+	}
+	fields := descriptor.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		var encoded []byte
+		forEachExtension(field.Options(), func(extension protowire.Number, typ protowire.Type, value []byte) {
+			if (extension == pgvExtension || extension == protovalidateExtension) && typ == protowire.BytesType {
+				encoded = append(encoded, value...)
+			}
+		})
+		if len(encoded) > 0 {
+			rules.fields[field.Number()] = parseFieldRules(encoded)
+		}
+	}
+	v.rules.Store(descriptor.FullName(), rules)
+	return rules
+}
+
+// parseFieldRules decodes the FieldRules of protoc-gen-validate or the FieldConstraints of protovalidate, which
+// share the numbers of the rules of each type
+func parseFieldRules(encoded []byte) *fieldRules {
+	rules := &fieldRules{}
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if kind, ok := numberRuleKinds[num]; ok {
+			rules.number, rules.ignoreEmpty = parseNumberRules(kind, value)
+			return
+		}
+		switch num {
+		case 13:
+			forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+				if num == 1 {
+					constant := decodeBool(value)
+					rules.boolConst = &constant
+				}
+			})
+		case 14:
+			rules.text, rules.ignoreEmpty = parseStringRules(value)
+		case 15:
+			rules.text, rules.ignoreEmpty = parseBytesRules(value)
+		case 16:
+			rules.number, rules.definedOnly = parseEnumRules(value)
+		case 17:
+			// The message rules of protoc-gen-validate
+			forEachField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+				switch num {
+				case 1:
+					rules.skip = decodeBool(value)
+				case 2:
+					rules.required = decodeBool(value)
+				}
+			})
+		case 18, 19:
+			rules.collection, rules.ignoreEmpty = parseCollectionRules(num == 19, value)
+		case 24:
+			// skipped in the first versions of protovalidate
+			rules.skip = decodeBool(value)
+		case 25:
+			rules.required = decodeBool(value)
+		case 26:
+			rules.ignoreEmpty = decodeBool(value)
+		case 27:
+			// ignore of protovalidate: IGNORE_IF_UNPOPULATED, IGNORE_IF_DEFAULT_VALUE or IGNORE_ALWAYS
+			ignore, _ := protowire.ConsumeVarint(value)
+			rules.ignoreEmpty = ignore == 1 || ignore == 2
+			rules.skip = ignore == 3
+		}
+	})
+	return rules
+}
+
+func parseNumberRules(kind protoreflect.Kind, encoded []byte) (*numberRules, bool) {
+	rules := &numberRules{}
+	ignoreEmpty := false
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch num {
+		case 1:
+			rules.constant = decodeFirstNumber(kind, typ, value)
+		case 2:
+			rules.lt = decodeFirstNumber(kind, typ, value)
+		case 3:
+			rules.lte = decodeFirstNumber(kind, typ, value)
+		case 4:
+			rules.gt = decodeFirstNumber(kind, typ, value)
+		case 5:
+			rules.gte = decodeFirstNumber(kind, typ, value)
+		case 6:
+			rules.in = append(rules.in, decodeNumbers(kind, typ, value)...)
+		case 7:
+			rules.notIn = append(rules.notIn, decodeNumbers(kind, typ, value)...)
+		case 8:
+			ignoreEmpty = decodeBool(value)
+		}
+	})
+	return rules, ignoreEmpty
+}
+
+func parseEnumRules(encoded []byte) (*numberRules, bool) {
+	rules := &numberRules{}
+	definedOnly := false
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch num {
+		case 1:
+			rules.constant = decodeFirstNumber(protoreflect.EnumKind, typ, value)
+		case 2:
+			definedOnly = decodeBool(value)
+		case 3:
+			rules.in = append(rules.in, decodeNumbers(protoreflect.EnumKind, typ, value)...)
+		case 4:
+			rules.notIn = append(rules.notIn, decodeNumbers(protoreflect.EnumKind, typ, value)...)
+		}
+	})
+	return rules, definedOnly
+}
+
+func parseStringRules(encoded []byte) (*textRules, bool) {
+	rules := &textRules{}
+	ignoreEmpty := false
+	formats := map[protowire.Number]string{12: "email address", 13: "hostname", 14: "IP address", 15: "IPv4 address",
+		16: "IPv6 address", 17: "URI", 18: "URI reference", 21: "hostname or IP address", 22: "UUID"}
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if format, ok := formats[num]; ok {
+			if decodeBool(value) {
+				rules.format = format
+			}
+			return
+		}
+		switch num {
+		case 1:
+			rules.constant = decodeString(value)
+		case 2:
+			rules.minLength = decodeUint(value)
+		case 3:
+			rules.maxLength = decodeUint(value)
+		case 4:
+			rules.minBytes = decodeUint(value)
+		case 5:
+			rules.maxBytes = decodeUint(value)
+		case 6:
+			rules.pattern, _ = regexp.Compile(string(value))
+		case 7:
+			rules.prefix = decodeString(value)
+		case 8:
+			rules.suffix = decodeString(value)
+		case 9:
+			rules.contains = decodeString(value)
+		case 10:
+			rules.in = append(rules.in, string(value))
+		case 11:
+			rules.notIn = append(rules.notIn, string(value))
+		case 19:
+			rules.length = decodeUint(value)
+		case 20:
+			rules.lengthBytes = decodeUint(value)
+		case 23:
+			rules.notContains = decodeString(value)
+		case 26:
+			ignoreEmpty = decodeBool(value)
+		}
+	})
+	return rules, ignoreEmpty
+}
+
+func parseBytesRules(encoded []byte) (*textRules, bool) {
+	rules := &textRules{}
+	ignoreEmpty := false
+	formats := map[protowire.Number]string{10: "IP address", 11: "IPv4 address", 12: "IPv6 address"}
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if format, ok := formats[num]; ok {
+			if decodeBool(value) {
+				rules.format = format
+			}
+			return
+		}
+		switch num {
+		case 1:
+			rules.constant = decodeString(value)
+		case 2:
+			rules.minBytes = decodeUint(value)
+		case 3:
+			rules.maxBytes = decodeUint(value)
+		case 4:
+			rules.pattern, _ = regexp.Compile(string(value))
+		case 5:
+			rules.prefix = decodeString(value)
+		case 6:
+			rules.suffix = decodeString(value)
+		case 7:
+			rules.contains = decodeString(value)
+		case 8:
+			rules.in = append(rules.in, string(value))
+		case 9:
+			rules.notIn = append(rules.notIn, string(value))
+		case 13:
+			rules.lengthBytes = decodeUint(value)
+		case 14:
+			ignoreEmpty = decodeBool(value)
+		}
+	})
+	return rules, ignoreEmpty
+}
+
+// parseCollectionRules decodes the RepeatedRules or the MapRules
+func parseCollectionRules(isMap bool, encoded []byte) (*collectionRules, bool) {
+	rules := &collectionRules{}
+	ignoreEmpty := false
+	forEachField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		switch {
+		case num == 1:
+			rules.min = decodeUint(value)
+		case num == 2:
+			rules.max = decodeUint(value)
+		case num == 3 && !isMap:
+			rules.unique = decodeBool(value)
+		case num == 4 && !isMap:
+			rules.items = parseFieldRules(value)
+		case num == 4:
+			rules.keys = parseFieldRules(value)
+		case num == 5 && !isMap:
+			ignoreEmpty = decodeBool(value)
+		case num == 5:
+			rules.values = parseFieldRules(value)
+		case num == 6 && isMap:
+			ignoreEmpty = decodeBool(value)
+		}
+	})
+	return rules, ignoreEmpty
+}
+
+// forEachExtension calls f with the extensions set in the options, whether their types are linked in or not
+func forEachExtension(options protoreflect.ProtoMessage, f func(protowire.Number, protowire.Type, []byte)) {
+	if options == nil {
+		return
+	}
+	encoded, err := proto.Marshal(options)
+	if err != nil {
+		return
+	}
+	forEachField(encoded, f)
+}
+
+// forEachField calls f with the number, wire type and value of each field of the encoded message, where the value is
+// the content of the length-delimited fields and the encoded value of the others. It stops at the first malformed
+// field.
+func forEachField(encoded []byte, f func(protowire.Number, protowire.Type, []byte)) {
+	for len(encoded) > 0 {
+		num, typ, n := protowire.ConsumeTag(encoded)
+		if n < 0 {
+			return
+		}
+		encoded = encoded[n:]
+		n = protowire.ConsumeFieldValue(num, typ, encoded)
+		if n < 0 {
+			return
+		}
+		value := encoded[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		f(num, typ, value)
+		encoded = encoded[n:]
+	}
+}
+
+// decodeNumbers decodes the numbers of a field of the kind, packed or not
+func decodeNumbers(kind protoreflect.Kind, typ protowire.Type, value []byte) []float64 {
+	var numbers []float64
+	for len(value) > 0 {
+		x, n := decodeNumber(kind, value)
+		if n < 0 {
+			break
+		}
+		numbers = append(numbers, x)
+		value = value[n:]
+		if typ != protowire.BytesType {
+			break
+		}
+	}
+	return numbers
+}
+
+func decodeFirstNumber(kind protoreflect.Kind, typ protowire.Type, value []byte) *float64 {
+	numbers := decodeNumbers(kind, typ, value)
+	if len(numbers) == 0 {
+		return nil
+	}
+	return &numbers[0]
+}
+
+func decodeNumber(kind protoreflect.Kind, value []byte) (float64, int) {
+	switch kind {
+	case protoreflect.FloatKind, protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		x, n := protowire.ConsumeFixed32(value)
+		switch kind {
+		case protoreflect.FloatKind:
+			return float64(math.Float32frombits(x)), n
+		case protoreflect.Sfixed32Kind:
+			return float64(int32(x)), n
+		}
+		return float64(x), n
+	case protoreflect.DoubleKind, protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		x, n := protowire.ConsumeFixed64(value)
+		switch kind {
+		case protoreflect.DoubleKind:
+			return math.Float64frombits(x), n
+		case protoreflect.Sfixed64Kind:
+			return float64(int64(x)), n
+		}
+		return float64(x), n
+	}
+	x, n := protowire.ConsumeVarint(value)
+	switch kind {
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return float64(protowire.DecodeZigZag(x)), n
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		return float64(x), n
+	case protoreflect.Int32Kind, protoreflect.EnumKind:
+		return float64(int32(x)), n
+	}
+	return float64(int64(x)), n
+}
+
+func decodeBool(value []byte) bool {
+	x, n := protowire.ConsumeVarint(value)
+	return n > 0 && protowire.DecodeBool(x)
+}
+
+func decodeUint(value []byte) *uint64 {
+	x, n := protowire.ConsumeVarint(value)
+	if n < 0 {
+		return nil
+	}
+	return &x
+}
+
+func decodeString(value []byte) *string {
+	s := string(value)
+	return &s
+}
@@ -0,0 +1,170 @@
+package grpchandler
+
+import (
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"math"
+	"testing"
+)
+
+const validationProto = `{
+  "name": "acme/v1/validation.proto",
+  "package": "acme.v1",
+  "syntax": "proto3",
+  "messageType": [
+    {"name": "Item", "field": [
+      {"name": "sku", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "sku"},
+      {"name": "quantity", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_INT32", "jsonName": "quantity"}]},
+    {"name": "CreateOrderRequest", "field": [
+      {"name": "name", "number": 1, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "name"},
+      {"name": "email", "number": 2, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "email"},
+      {"name": "total", "number": 3, "label": "LABEL_OPTIONAL", "type": "TYPE_DOUBLE", "jsonName": "total"},
+      {"name": "items", "number": 4, "label": "LABEL_REPEATED", "type": "TYPE_MESSAGE", "typeName": ".acme.v1.Item", "jsonName": "items"},
+      {"name": "card", "number": 5, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "card", "oneofIndex": 0},
+      {"name": "voucher", "number": 6, "label": "LABEL_OPTIONAL", "type": "TYPE_STRING", "jsonName": "voucher", "oneofIndex": 0}],
+     "oneofDecl": [{"name": "payment"}]}
+  ]
+}`
+
+// encodedRules encodes the fields of a rules message, each with the number and the encoded value (a varint, or the
+// content of a length-delimited field)
+type encodedRules []struct {
+	num   protowire.Number
+	typ   protowire.Type
+	value []byte
+}
+
+func (r encodedRules) bytes() []byte {
+	var b []byte
+	for _, field := range r {
+		b = protowire.AppendTag(b, field.num, field.typ)
+		if field.typ == protowire.BytesType {
+			b = protowire.AppendBytes(b, field.value)
+		} else {
+			b = append(b, field.value...)
+		}
+	}
+	return b
+}
+
+func varint(v uint64) []byte {
+	return protowire.AppendVarint(nil, v)
+}
+
+func fixed64(v float64) []byte {
+	return protowire.AppendFixed64(nil, math.Float64bits(v))
+}
+
+func rules(fields ...encodedRules) encodedRules {
+	var all encodedRules
+	for _, f := range fields {
+		all = append(all, f...)
+	}
+	return all
+}
+
+func field(num protowire.Number, typ protowire.Type, value []byte) encodedRules {
+	return encodedRules{{num, typ, value}}
+}
+
+func newValidationRequest(t *testing.T, extension protowire.Number) *dynamicpb.Message {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	assert.NoError(t, protojson.Unmarshal([]byte(validationProto), fdp))
+	setRules := func(options proto.Message, rules []byte) {
+		options.ProtoReflect().SetUnknown(rules)
+	}
+	fieldRules := func(message, field int, r encodedRules) {
+		options := new(descriptorpb.FieldOptions)
+		setRules(options, protowire.AppendBytes(protowire.AppendTag(nil, extension, protowire.BytesType), r.bytes()))
+		fdp.MessageType[message].Field[field].Options = options
+	}
+	// sku: string.min_len = 3, string.pattern = ^[A-Z]
+	fieldRules(0, 0, field(14, protowire.BytesType, rules(field(2, protowire.VarintType, varint(3)),
+		field(6, protowire.BytesType, []byte("^[A-Z]"))).bytes()))
+	// quantity: int32.gt = 0
+	fieldRules(0, 1, field(3, protowire.BytesType, field(4, protowire.VarintType, varint(0)).bytes()))
+	// name: string.prefix = orders/
+	fieldRules(1, 0, field(14, protowire.BytesType, field(7, protowire.BytesType, []byte("orders/")).bytes()))
+	// email: string.email = true, string.ignore_empty = true
+	fieldRules(1, 1, field(14, protowire.BytesType, rules(field(12, protowire.VarintType, varint(1)),
+		field(26, protowire.VarintType, varint(1))).bytes()))
+	// total: double.gte = 0, double.lt = 1000
+	fieldRules(1, 2, field(2, protowire.BytesType, rules(field(5, protowire.Fixed64Type, fixed64(0)),
+		field(2, protowire.Fixed64Type, fixed64(1000))).bytes()))
+	// items: repeated.min_items = 1
+	fieldRules(1, 3, field(18, protowire.BytesType, field(1, protowire.VarintType, varint(1)).bytes()))
+	// payment: required
+	oneofOptions := new(descriptorpb.OneofOptions)
+	if extension == pgvExtension {
+		setRules(oneofOptions, protowire.AppendVarint(protowire.AppendTag(nil, extension, protowire.VarintType), 1))
+	} else {
+		setRules(oneofOptions, protowire.AppendBytes(protowire.AppendTag(nil, extension, protowire.BytesType),
+			field(1, protowire.VarintType, varint(1)).bytes()))
+	}
+	fdp.MessageType[1].OneofDecl[0].Options = oneofOptions
+
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return dynamicpb.NewMessage(file.Messages().ByName("CreateOrderRequest"))
+}
+
+func violations(t *testing.T, err error) []*errdetails.BadRequest_FieldViolation {
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, 1, len(st.Proto().Details))
+	badRequest := new(errdetails.BadRequest)
+	assert.NoError(t, ptypes.UnmarshalAny(st.Proto().Details[0], badRequest))
+	return badRequest.FieldViolations
+}
+
+func TestRequestValidation(t *testing.T) {
+	for _, extension := range []protowire.Number{pgvExtension, protovalidateExtension} {
+		validation := new(RequestValidation)
+		req := newValidationRequest(t, extension)
+		assert.NoError(t, protojson.Unmarshal([]byte(`{"name": "orders/1", "total": 10, "items": [{"sku": "ABC", "quantity": 1}], "card": "4111"}`), req))
+
+		// Disabled
+		assert.NoError(t, validation.validate(req))
+
+		validation.Configure(true)
+		assert.NoError(t, validation.validate(req))
+
+		invalid := newValidationRequest(t, extension)
+		assert.NoError(t, protojson.Unmarshal([]byte(`{"name": "1", "email": "not an email", "total": 1000, "items": [{"sku": "ABC", "quantity": 1}, {"sku": "ab", "quantity": 0}]}`), invalid))
+		err := validation.validate(invalid)
+		assert.EqualError(t, err, "rpc error: code = InvalidArgument desc = invalid CreateOrderRequest.payment: value is required")
+		assert.Equal(t, []*errdetails.BadRequest_FieldViolation{
+			{Field: "payment", Description: "value is required"},
+			{Field: "name", Description: `value does not have prefix "orders/"`},
+			{Field: "email", Description: "value must be a valid email address"},
+			{Field: "total", Description: "value must be less than 1000"},
+			{Field: "items[1].sku", Description: "value length must be at least 3 runes"},
+			{Field: "items[1].sku", Description: `value does not match regex pattern "^[A-Z]"`},
+			{Field: "items[1].quantity", Description: "value must be greater than 0"},
+		}, violations(t, err))
+
+		empty := newValidationRequest(t, extension)
+		assert.NoError(t, protojson.Unmarshal([]byte(`{"name": "orders/1", "voucher": "XMAS"}`), empty))
+		assert.Equal(t, []*errdetails.BadRequest_FieldViolation{
+			{Field: "items", Description: "value must contain at least 1 item(s)"},
+		}, violations(t, validation.validate(empty)))
+	}
+}
+
+func TestNumberRules_ExclusiveRange(t *testing.T) {
+	lt, gt := 10.0, 20.0
+	rules := &numberRules{lt: &lt, gt: &gt}
+	assert.Empty(t, rules.check(5))
+	assert.Empty(t, rules.check(25))
+	assert.Equal(t, []string{"value must be less than 10 or greater than 20"}, rules.check(15))
+}
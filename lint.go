@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const lintUsage = `Usage: protoc-gen-mock lint [-descriptor_set file] <stub files or directories>
+
+Checks the stub files before they are deployed. The stubs in the directories are
+loaded in the same order as the server does. With a descriptor set (protoc
+--include_imports -o file, or buf build -o file) the methods and the contents of
+the stubs are checked against the proto definitions too.
+
+Options:
+`
+
+// runLint runs the lint subcommand and returns the exit code: 0 when no issues are found, 1 when there are issues and
+// 2 when the stubs or the descriptor set can't be read
+func runLint(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(out)
+	descriptorSet := flags.String("descriptor_set", "", "file with the FileDescriptorSet of the services (with imports)")
+	flags.Usage = func() {
+		fmt.Fprint(out, lintUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	var files *protoregistry.Files
+	if *descriptorSet != "" {
+		var err error
+		if files, err = loadDescriptorSet(*descriptorSet); err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+	}
+	stubs := make([]*stub.Stub, 0)
+	sources := make([]string, 0)
+	for _, path := range flags.Args() {
+		pathStubs, err := loadStubs(path)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			return 2
+		}
+		for i := range pathStubs {
+			sources = append(sources, fmt.Sprintf("%s[%d]", path, i))
+		}
+		stubs = append(stubs, pathStubs...)
+	}
+	issues := stub.Lint(stubs, files)
+	for _, issue := range issues {
+		s := stubs[issue.Index]
+		fmt.Fprintf(out, "%s %s: %s\n", sources[issue.Index], s.FullMethod, issue.Message)
+	}
+	if len(issues) > 0 {
+		fmt.Fprintf(out, "%d issues found in %d stubs\n", len(issues), len(stubs))
+		return 1
+	}
+	return 0
+}
+
+func loadStubs(path string) ([]*stub.Stub, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return stub.LoadStubsFromDir(path)
+	}
+	return stub.LoadStubsFromFile(path)
+}
+
+func loadDescriptorSet(file string) (*protoregistry.Files, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read descriptor set %s: %w", file, err)
+	}
+	files, err := stub.ParseDescriptorSet(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return files, nil
+}
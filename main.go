@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"go/token"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 )
@@ -19,10 +23,19 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(runLint(os.Args[2:], os.Stdout))
+	}
+	// The parameters are named in snake_case, as the ones of protoc-gen-go (e.g. paths and annotate_code) that are
+	// handled by protogen
 	var (
 		flags flag.FlagSet
 		//plugins      = flags.String("plugins", "", "list of plugins to enable (supported values: grpc)")
 		importPrefix = flags.String("import_prefix", "", "prefix to prepend to import paths")
+		importPath   = flags.String("import_path", "", "Go import path of the package of the mocks")
+		packageName  = flags.String("package_name", "", "Go package name of the mocks")
+		layout       = flags.String("layout", layoutPerFile, "one file per proto file (file) or per service (service)")
+		defaultStubs = flags.Bool("default_stubs", false, "generate default stubs from the @example comments of the methods and messages")
 	)
 	importRewriteFunc := func(importPath protogen.GoImportPath) protogen.GoImportPath {
 		switch importPath {
@@ -38,42 +51,125 @@ func main() {
 		ParamFunc:         flags.Set,
 		ImportRewriteFunc: importRewriteFunc,
 	}.Run(func(gen *protogen.Plugin) error {
+		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+		options := generatorOptions{
+			importPath:   protogen.GoImportPath(*importPath),
+			packageName:  protogen.GoPackageName(*packageName),
+			layout:       *layout,
+			defaultStubs: *defaultStubs,
+		}
+		if err := options.validate(); err != nil {
+			return err
+		}
 		for _, f := range gen.Files {
-			GenerateFile(gen, f)
+			// The dependencies are in the request too, but their mocks are generated when they are generated
+			if f.Generate {
+				GenerateFiles(gen, f, options)
+			}
 		}
 		return nil
 	})
 }
 
-// GenerateFile generates a _grpc.pb.go file containing gRPC service definitions.
-func GenerateFile(gen *protogen.Plugin, file *protogen.File) *protogen.GeneratedFile {
+const (
+	layoutPerFile    = "file"
+	layoutPerService = "service"
+)
+
+// generatorOptions are the parameters that control where the mocks are generated
+type generatorOptions struct {
+	// importPath is the Go import path of the package of the mocks. It is the package of the Go code of the proto file
+	// when empty, or its subpackage named packageName when that is set.
+	importPath protogen.GoImportPath
+	// packageName is the Go package name of the mocks. It defaults to the last element of importPath or, when that is
+	// empty too, to the package of the Go code of the proto file.
+	packageName protogen.GoPackageName
+	// layout is layoutPerFile to generate a file with the mocks of all the services of a proto file, or
+	// layoutPerService to generate a file per service.
+	layout string
+	// defaultStubs generates the default stubs of the mock services (see grpchandler.DefaultStubsProvider) from the
+	// examples in the comments of the methods and messages
+	defaultStubs bool
+}
+
+func (o generatorOptions) validate() error {
+	if o.layout != layoutPerFile && o.layout != layoutPerService {
+		return fmt.Errorf("invalid layout %q: it must be %s or %s", o.layout, layoutPerFile, layoutPerService)
+	}
+	if o.packageName != "" && !token.IsIdentifier(string(o.packageName)) {
+		return fmt.Errorf("invalid package name %q", o.packageName)
+	}
+	return nil
+}
+
+// packageOf returns the import path and the package name of the mocks of the file, and the directory where they are
+// generated (relative to the output directory)
+func (o generatorOptions) packageOf(file *protogen.File) (protogen.GoImportPath, protogen.GoPackageName, string) {
+	dir := path.Dir(file.GeneratedFilenamePrefix)
+	switch {
+	case o.importPath == "" && o.packageName == "":
+		return file.GoImportPath, file.GoPackageName, dir
+	case o.importPath == "":
+		return protogen.GoImportPath(path.Join(string(file.GoImportPath), string(o.packageName))), o.packageName, path.Join(dir, string(o.packageName))
+	}
+	packageName := o.packageName
+	if packageName == "" {
+		packageName = protogen.GoPackageName(strings.NewReplacer("-", "_", ".", "_").Replace(path.Base(string(o.importPath))))
+	}
+	if rel := strings.TrimPrefix(string(o.importPath), string(file.GoImportPath)+"/"); rel != string(o.importPath) {
+		// Subpackage of the package of the proto file
+		return o.importPath, packageName, path.Join(dir, rel)
+	}
+	return o.importPath, packageName, string(o.importPath)
+}
+
+// GenerateFiles generates the .mock.pb.go files with the mock services of the file, in the layout and package of the
+// options.
+func GenerateFiles(gen *protogen.Plugin, file *protogen.File, options generatorOptions) []*protogen.GeneratedFile {
 	if len(file.Services) == 0 {
 		return nil
 	}
-	filename := file.GeneratedFilenamePrefix + ".mock.pb.go"
-	g := gen.NewGeneratedFile(filename, file.GoImportPath)
+	importPath, packageName, dir := options.packageOf(file)
+	baseName := path.Join(dir, path.Base(file.GeneratedFilenamePrefix))
+	if options.layout == layoutPerFile {
+		return []*protogen.GeneratedFile{
+			generateFile(gen, file, file.Services, baseName+".mock.pb.go", importPath, packageName, options),
+		}
+	}
+	files := make([]*protogen.GeneratedFile, 0, len(file.Services))
+	for _, service := range file.Services {
+		filename := baseName + "_" + strings.ToLower(service.GoName) + ".mock.pb.go"
+		files = append(files, generateFile(gen, file, []*protogen.Service{service}, filename, importPath, packageName, options))
+	}
+	return files
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File, services []*protogen.Service, filename string,
+	importPath protogen.GoImportPath, packageName protogen.GoPackageName, options generatorOptions) *protogen.GeneratedFile {
+	g := gen.NewGeneratedFile(filename, importPath)
 	mockGenerator := mockServicesGenerator{
-		gen:  gen,
-		file: file,
-		g:    g,
+		gen:          gen,
+		file:         file,
+		services:     services,
+		g:            g,
+		defaultStubs: options.defaultStubs,
 	}
-	mockGenerator.genHeader(string(file.GoPackageName))
+	mockGenerator.genHeader(string(packageName))
 	mockGenerator.GenerateFileContent()
 	return g
 }
 
 type mockServicesGenerator struct {
-	gen  *protogen.Plugin
-	file *protogen.File
-	g    *protogen.GeneratedFile
+	gen          *protogen.Plugin
+	file         *protogen.File
+	services     []*protogen.Service
+	g            *protogen.GeneratedFile
+	defaultStubs bool
 }
 
 // GenerateFileContent generates the gRPC service definitions, excluding the package statement.
 func (m mockServicesGenerator) GenerateFileContent() {
-	if len(m.file.Services) == 0 {
-		return
-	}
-	for _, service := range m.file.Services {
+	for _, service := range m.services {
 		m.genService(service)
 	}
 }
@@ -84,6 +180,9 @@ func (m mockServicesGenerator) genService(service *protogen.Service) {
 	m.genMockServiceRegistrationFunction(service)
 	m.genGetSupportedMethodsFunction(service)
 	m.genGetPayloadExamplesFunction(service)
+	if m.defaultStubs {
+		m.genGetDefaultStubsFunction(service)
+	}
 	m.genGetRequestInstance(service)
 	m.genGetResponseInstance(service)
 	m.genGetStubsValidator(service)
@@ -244,14 +343,25 @@ func (m mockServicesGenerator) genMockMethodHandler(service *protogen.Service, m
 		m.g.P("out := new(", method.Output.GoIdent, ")")
 		m.g.P("fullMethod := ", strconv.Quote(fmt.Sprintf("/%s/%s", service.Desc.FullName(), method.GoName)))
 		m.g.P("stubsMatcher := (srv).(*", unexport(m.getMockServiceName(service)), ").StubsMatcher")
-		m.g.P("return ", grpchandlerPackage.Ident("MockHandler"), "(ctx, stubsMatcher, fullMethod, in, out)")
+		m.g.P("if interceptor == nil { return ", grpchandlerPackage.Ident("MockHandler"), "(ctx, stubsMatcher, fullMethod, in, out) }")
+		m.g.P("info := &", grpcPackage.Ident("UnaryServerInfo"), "{Server: srv, FullMethod: fullMethod}")
+		m.g.P("handler := func(ctx ", contextPackage.Ident("Context"), ", req interface{}) (interface{}, error) {")
+		m.g.P("return ", grpchandlerPackage.Ident("MockHandler"), "(ctx, stubsMatcher, fullMethod, req, out)")
+		m.g.P("}")
+		m.g.P("return interceptor(ctx, in, info, handler)")
 		m.g.P("}")
 		m.g.P()
 		return
 	}
 	m.g.P("func ", hname, "(srv interface{}, stream ", grpcPackage.Ident("ServerStream"), ") error {")
-	m.g.P("// Mock not implemented for streaming")
-	m.g.P("return fmt.Errorf(\"mock not implemented for streaming\")")
+	m.g.P("info := &", grpcPackage.Ident("StreamServerInfo"), "{")
+	m.g.P("FullMethod: ", strconv.Quote(fmt.Sprintf("/%s/%s", service.Desc.FullName(), method.GoName)), ",")
+	m.g.P("IsClientStream: ", method.Desc.IsStreamingClient(), ",")
+	m.g.P("IsServerStream: ", method.Desc.IsStreamingServer(), ",")
+	m.g.P("}")
+	m.g.P("newResp := func() interface{} { return new(", method.Output.GoIdent, ") }")
+	m.g.P("stubsMatcher := (srv).(*", unexport(m.getMockServiceName(service)), ").StubsMatcher")
+	m.g.P("return ", grpchandlerPackage.Ident("MockStreamHandler"), "(stubsMatcher, info, stream, new(", method.Input.GoIdent, "), newResp)")
 	m.g.P("}")
 	m.g.P()
 }
@@ -282,8 +392,10 @@ func (m mockServicesGenerator) getMockServiceName(service *protogen.Service) str
 	return service.GoName + "MockService"
 }
 
-func (m mockServicesGenerator) getMockServerBaseInterfaceName(service *protogen.Service) string {
-	return service.GoName + "Server"
+// getMockServerBaseInterfaceName returns the server interface generated by protoc-gen-go, which is qualified when the
+// mocks are in another package
+func (m mockServicesGenerator) getMockServerBaseInterfaceName(service *protogen.Service) protogen.GoIdent {
+	return m.file.GoImportPath.Ident(service.GoName + "Server")
 }
 
 func (m mockServicesGenerator) getMockServiceDescriptorName(service *protogen.Service) string {
@@ -0,0 +1,80 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// AliasesController inspects and changes the aliases of the methods
+type AliasesController struct {
+	Aliases *stub.MethodAliases
+}
+
+func (c AliasesController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetAliases",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getAliasesHandler,
+		},
+		{
+			Name:    "SetAliases",
+			Path:    "",
+			Methods: []string{http.MethodPut},
+			Handler: c.setAliasesHandler,
+		},
+		{
+			Name:    "ResetAliases",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c AliasesController) GetPath() string {
+	return "/aliases"
+}
+
+func (c AliasesController) getAliasesHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the method aliases")
+
+	writeErr := writeResponse(writer, c.Aliases.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c AliasesController) setAliasesHandler(writer http.ResponseWriter, request *http.Request) {
+	aliases := make([]stub.MethodAlias, 0)
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &aliases)
+	}
+	for i := 0; err == nil && i < len(aliases); i++ {
+		err = aliases[i].Validate()
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set the method aliases failed with error: %s", err.Error()))
+		return
+	}
+	log.Infof("REST: received call to set %d method aliases", len(aliases))
+
+	c.Aliases.Configure(aliases)
+	writeErr := writeResponse(writer, c.Aliases.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c AliasesController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the method aliases")
+
+	c.Aliases.Configure(nil)
+	writeSuccessResponse(writer)
+}
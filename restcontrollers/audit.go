@@ -0,0 +1,62 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type AuditController struct {
+	AuditLog stub.AuditLog
+}
+
+func (c AuditController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetAuditLog",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getAuditLogHandler,
+		},
+	}
+}
+
+func (c AuditController) GetPath() string {
+	return "/audit"
+}
+
+func (c AuditController) getAuditLogHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the audit log")
+
+	writeErr := writeResponse(writer, c.AuditLog.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// recordReplace adds to the audit log the changes made by replacing the stubs in the store at once (e.g. restoring a
+// snapshot)
+func recordReplace(auditLog stub.AuditLog, actor string, previous, current []*stub.Stub) {
+	if auditLog == nil {
+		return
+	}
+	previousByID := make(map[string]*stub.Stub, len(previous))
+	for _, s := range previous {
+		previousByID[s.ID] = s
+	}
+	for _, s := range current {
+		before, found := previousByID[s.ID]
+		switch {
+		case !found:
+			auditLog.Record(actor, stub.ChangeTypeCreate, nil, s)
+		case len(stub.DiffStubs(before, s)) > 0:
+			auditLog.Record(actor, stub.ChangeTypeUpdate, before, s)
+		}
+		delete(previousByID, s.ID)
+	}
+	for _, s := range previous {
+		if _, notFound := previousByID[s.ID]; notFound {
+			auditLog.Record(actor, stub.ChangeTypeDelete, s, nil)
+		}
+	}
+}
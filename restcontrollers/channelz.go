@@ -0,0 +1,42 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// ChannelzController shows the connections to the gRPC server and the streams they carried, from the channelz data,
+// to diagnose connection issues
+type ChannelzController struct {
+	Channelz *grpchandler.Channelz
+}
+
+func (c ChannelzController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetChannelz",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getChannelzHandler,
+		},
+	}
+}
+
+func (c ChannelzController) GetPath() string {
+	return "/channelz"
+}
+
+func (c ChannelzController) getChannelzHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the channelz data")
+
+	view, err := c.Channelz.GetView(request.Context())
+	if err != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeErr := writeResponse(writer, view)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
@@ -1,10 +1,27 @@
 package restcontrollers
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	log "github.com/sirupsen/logrus"
+	"hash"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+	headerVary        = "Vary"
+	anyETag           = "*"
 )
 
 type RESTController interface {
@@ -27,9 +44,68 @@ func getQueryParam(request *http.Request, paramName string) string {
 	return values[0]
 }
 
+type principalKey struct{}
+
+// WithPrincipal returns the request with the principal authenticated, e.g. the name of the API key used, which is
+// recorded as the actor of the changes it makes
+func WithPrincipal(request *http.Request, principal string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), principalKey{}, principal))
+}
+
+// getActor identifies who is making the request: the principal authenticated (see WithPrincipal), or the address of
+// the client when the REST API doesn't require authentication.
+func getActor(request *http.Request) string {
+	if principal, ok := request.Context().Value(principalKey{}).(string); ok && principal != emptyString {
+		return principal
+	}
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+// formatETag creates the (strong) entity tag for a stub version.
+func formatETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseETag extracts the stub version from an entity tag. The wildcard tag "*" matches any version and is returned as 0.
+func parseETag(etag string) (int64, error) {
+	etag = strings.TrimSpace(etag)
+	if etag == anyETag {
+		return 0, nil
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	version, err := strconv.ParseInt(strings.Trim(etag, "\""), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid entity tag %s", etag)
+	}
+	return version, nil
+}
+
+// formatContentETag creates the weak entity tag of a listing from the hash of what identifies its content. It is weak as
+// the same content can be sent compressed or not.
+func formatContentETag(hash hash.Hash) string {
+	return "W/" + strconv.Quote(hex.EncodeToString(hash.Sum(nil)[:16]))
+}
+
+// writeNotModified sets the entity tag of the response and, when the client already has it (If-None-Match), responds
+// with 304 Not Modified. It returns true when the response is written.
+func writeNotModified(writer http.ResponseWriter, request *http.Request, etag string) bool {
+	writer.Header().Set(headerETag, etag)
+	for _, tag := range strings.Split(request.Header.Get(headerIfNoneMatch), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == anyETag || (tag != emptyString && strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/")) {
+			writer.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
 func writeResponse(writer http.ResponseWriter, respponse interface{}) error {
 	return writeResponseWithCode(writer, respponse, http.StatusOK)
-	return nil
 }
 
 func writeResponseWithCode(writer http.ResponseWriter, respponse interface{}, code int) error {
@@ -65,3 +141,37 @@ func writeErrorResponse(writer http.ResponseWriter, code int, message string) {
 		log.Errorf("Error writing http response: Error %s", writeErr.Error())
 	}
 }
+
+// writeStoreErrorResponse writes the error returned by the stubs store with the status code of its type
+func writeStoreErrorResponse(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, stub.ErrNotFound):
+		writeErrorResponse(writer, http.StatusNotFound, err.Error())
+	case errors.Is(err, stub.ErrConflict):
+		writeErrorResponse(writer, http.StatusConflict, err.Error())
+	case errors.Is(err, stub.ErrVersionMismatch):
+		writeErrorResponse(writer, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, stub.ErrLimitExceeded):
+		writeErrorResponse(writer, http.StatusInsufficientStorage, err.Error())
+	default:
+		log.Errorf("Stubs store failed: %s", err.Error())
+		writeErrorResponse(writer, http.StatusInternalServerError, "Failed to access the stubs.")
+	}
+}
+
+// writeReport writes the report in JSON or, with ?format=junit, as the JUnit test suite for the CI servers
+func writeReport(writer http.ResponseWriter, request *http.Request, report interface{}, junit func() *util.JUnitTestSuite) {
+	if getQueryParam(request, "format") != formatJUnit {
+		if writeErr := writeResponse(writer, report); writeErr != nil {
+			writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+		}
+		return
+	}
+	data, err := junit().Marshal()
+	if err != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writer.Header().Set(contentType, contentTypeApplicationXml)
+	writer.Write(data)
+}
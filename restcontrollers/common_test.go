@@ -0,0 +1,58 @@
+package restcontrollers
+
+import (
+	"crypto/sha256"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteNotModified(t *testing.T) {
+	hash := sha256.New()
+	hash.Write([]byte("content"))
+	etag := formatContentETag(hash)
+
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	response := httptest.NewRecorder()
+	assert.False(t, writeNotModified(response, request, etag))
+	assert.Equal(t, etag, response.Header().Get(headerETag))
+
+	request.Header.Set(headerIfNoneMatch, "W/\"other\", "+etag)
+	response = httptest.NewRecorder()
+	assert.True(t, writeNotModified(response, request, etag))
+	assert.Equal(t, http.StatusNotModified, response.Code)
+}
+
+func TestStubsETag(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	s := &stub.Stub{ID: "1", Version: 1}
+	page := &stub.StubsPage{Stubs: []*stub.Stub{s}, Total: 1}
+	etag := stubsETag(request, page)
+	assert.Equal(t, etag, stubsETag(request, page))
+
+	s.Version = 2
+	assert.NotEqual(t, etag, stubsETag(request, page))
+	request.Header.Set(headerAccept, contentTypeApplicationNDJson)
+	assert.NotEqual(t, stubsETag(httptest.NewRequest(http.MethodGet, "/stubs", nil), page), stubsETag(request, page))
+}
+
+func TestJournalETag(t *testing.T) {
+	now := time.Now()
+	entries := []stub.JournalEntry{{Seq: 1, Timestamp: now}}
+	etag := journalETag(entries)
+	assert.Equal(t, etag, journalETag([]stub.JournalEntry{{Seq: 1, Timestamp: now}}))
+	// Same sequence after a reset
+	assert.NotEqual(t, etag, journalETag([]stub.JournalEntry{{Seq: 1, Timestamp: now.Add(time.Second)}}))
+	assert.NotEqual(t, etag, journalETag(append(entries, stub.JournalEntry{Seq: 2, Timestamp: now})))
+}
+
+func TestGetActor(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/stubs", nil)
+	request.RemoteAddr = "10.0.0.1:5000"
+	request.Header.Set("X-Actor", "someone-else")
+	assert.Equal(t, "10.0.0.1", getActor(request))
+	assert.Equal(t, "ci", getActor(WithPrincipal(request, "ci")))
+}
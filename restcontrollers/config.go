@@ -0,0 +1,42 @@
+package restcontrollers
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// ConfigReloader applies the changes made to the configuration of the server at runtime
+type ConfigReloader interface {
+	Reload() error
+}
+
+type ConfigController struct {
+	Reloader ConfigReloader
+}
+
+func (c ConfigController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "ReloadConfig",
+			Path:    "/reload",
+			Methods: []string{http.MethodPost},
+			Handler: c.reloadConfigHandler,
+		},
+	}
+}
+
+func (c ConfigController) GetPath() string {
+	return "/config"
+}
+
+func (c ConfigController) reloadConfigHandler(writer http.ResponseWriter, request *http.Request) {
+	log.WithFields(log.Fields{"actor": getActor(request)}).
+		Info("REST: received call to reload the configuration")
+
+	if err := c.Reloader.Reload(); err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Failed to reload the configuration: %s", err.Error()))
+		return
+	}
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,104 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type ContractController struct {
+	Service    grpchandler.MockService
+	StubsStore stub.StubsStore
+	// Upstream is the address of the real service used when the request doesn't set one
+	Upstream string
+	Options  grpchandler.ContractOptions
+	// Dial connects to the real service
+	Dial func(upstream string) (*grpc.ClientConn, error)
+}
+
+type verifyContractsRequest struct {
+	// Upstream overrides the address of the real service
+	Upstream string `json:"upstream"`
+	// IgnoredFields are ignored in addition to the ones configured
+	IgnoredFields []string `json:"ignoredFields"`
+	// Methods limits the stubs verified to the ones of the methods (full method or only the name)
+	Methods []string `json:"methods"`
+}
+
+func (c ContractController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "VerifyContracts",
+			Path:    "/verify",
+			Methods: []string{http.MethodPost},
+			Handler: c.verifyHandler,
+		},
+	}
+}
+
+func (c ContractController) GetPath() string {
+	return "/contract"
+}
+
+func (c ContractController) verifyHandler(writer http.ResponseWriter, request *http.Request) {
+	verifyRequest := verifyContractsRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil && len(bodyData) > 0 {
+		err = json.Unmarshal(bodyData, &verifyRequest)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to verify the contracts failed with error: %s", err.Error()))
+		return
+	}
+	upstream := c.Upstream
+	if verifyRequest.Upstream != "" {
+		upstream = verifyRequest.Upstream
+	}
+	if upstream == "" {
+		writeErrorResponse(writer, http.StatusBadRequest, "the upstream of the real service is not set")
+		return
+	}
+	log.WithFields(log.Fields{"upstream": upstream}).Info("REST: received call to verify the contracts")
+
+	conn, err := c.Dial(upstream)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadGateway, fmt.Sprintf("could not connect to %s: %s", upstream, err.Error()))
+		return
+	}
+	defer conn.Close()
+	options := c.Options
+	options.IgnoredFields = append(append([]string(nil), c.Options.IgnoredFields...), verifyRequest.IgnoredFields...)
+	allStubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	stubs := make([]*stub.Stub, 0)
+	for _, s := range allStubs {
+		if matchesAnyMethod(s.FullMethod, verifyRequest.Methods) {
+			stubs = append(stubs, s)
+		}
+	}
+	report := grpchandler.VerifyContracts(request.Context(), conn, c.Service, stubs, options)
+	writeReport(writer, request, report, report.JUnit)
+}
+
+// matchesAnyMethod checks if the full method is one of the methods, given as full methods or only their names. Any
+// method matches when there are none.
+func matchesAnyMethod(fullMethod string, methods []string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, method := range methods {
+		if method == fullMethod || strings.HasSuffix(fullMethod, "/"+method) {
+			return true
+		}
+	}
+	return false
+}
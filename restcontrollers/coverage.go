@@ -0,0 +1,60 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+const (
+	formatJUnit               = "junit"
+	contentTypeApplicationXml = "application/xml"
+)
+
+type CoverageController struct {
+	Service     grpchandler.MockService
+	StubsStore  stub.StubsStore
+	MethodCalls stub.CallCounter
+}
+
+func (c CoverageController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetCoverageReport",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getReportHandler,
+		},
+		{
+			Name:    "ResetMethodCalls",
+			Path:    "/reset",
+			Methods: []string{http.MethodPost},
+			Handler: c.resetCallsHandler,
+		},
+	}
+}
+
+func (c CoverageController) GetPath() string {
+	return "/coverage"
+}
+
+// getReportHandler returns the coverage report in JSON or, with ?format=junit, in the JUnit XML format
+func (c CoverageController) getReportHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the coverage report")
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	report := stub.CheckCoverage(c.Service.GetSupportedMethods(), stubs, c.MethodCalls)
+	writeReport(writer, request, report, report.JUnit)
+}
+
+func (c CoverageController) resetCallsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the calls counted for the coverage")
+
+	c.MethodCalls.Reset()
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,80 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// DeprecationsController inspects and changes the methods deprecated
+type DeprecationsController struct {
+	Deprecations *grpchandler.MethodDeprecations
+}
+
+func (c DeprecationsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetDeprecations",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getDeprecationsHandler,
+		},
+		{
+			Name:    "SetDeprecations",
+			Path:    "",
+			Methods: []string{http.MethodPut},
+			Handler: c.setDeprecationsHandler,
+		},
+		{
+			Name:    "ResetDeprecations",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c DeprecationsController) GetPath() string {
+	return "/deprecations"
+}
+
+func (c DeprecationsController) getDeprecationsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the deprecated methods")
+
+	writeErr := writeResponse(writer, c.Deprecations.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c DeprecationsController) setDeprecationsHandler(writer http.ResponseWriter, request *http.Request) {
+	deprecations := make([]grpchandler.MethodDeprecation, 0)
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &deprecations)
+	}
+	for i := 0; err == nil && i < len(deprecations); i++ {
+		err = deprecations[i].Validate()
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set the deprecated methods failed with error: %s", err.Error()))
+		return
+	}
+	log.Infof("REST: received call to set %d deprecated methods", len(deprecations))
+
+	c.Deprecations.Configure(deprecations)
+	writeErr := writeResponse(writer, c.Deprecations.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c DeprecationsController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the deprecated methods")
+
+	c.Deprecations.Configure(nil)
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,62 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// DescriptorsController refreshes the descriptors of the services and checks the stubs against them
+type DescriptorsController struct {
+	Descriptors *stub.Descriptors
+	StubsStore  stub.StubsStore
+}
+
+func (c DescriptorsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetDescriptors",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getDescriptorsHandler,
+		},
+		{
+			Name:    "RefreshDescriptors",
+			Path:    "/refresh",
+			Methods: []string{http.MethodPost},
+			Handler: c.refreshDescriptorsHandler,
+		},
+	}
+}
+
+func (c DescriptorsController) GetPath() string {
+	return "/descriptors"
+}
+
+func (c DescriptorsController) getDescriptorsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the descriptors")
+
+	c.writeStatus(writer, request)
+}
+
+func (c DescriptorsController) refreshDescriptorsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to refresh the descriptors")
+
+	if err := c.Descriptors.Refresh(request.Context()); err != nil {
+		writeErrorResponse(writer, http.StatusBadGateway, err.Error())
+		return
+	}
+	c.writeStatus(writer, request)
+}
+
+func (c DescriptorsController) writeStatus(writer http.ResponseWriter, request *http.Request) {
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writeErr := writeResponse(writer, c.Descriptors.GetStatus(stubs))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
@@ -29,22 +29,21 @@ func TestExamplesController_getExamplesHandler(t *testing.T) {
 		StubExamples: []stub.Stub{
 			{
 				FullMethod: "method1",
-				Request: stub.StubRequest{
+				Request: &stub.StubRequest{
 					Match:    "exact",
-					Content:  "request1",
-					Metadata: map[string]interface{}{"key1": "value1", "key2": 2},
+					Content:  "{\"name\":\"request1\"}",
+					Metadata: map[string][]string{"key1": {"value1"}, "key2": {"value2"}},
 				},
-				Response: stub.StubResponse{
-					Type:    "sccess",
-					Content: "response1",
-					Error:   "error1",
+				Response: &stub.StubResponse{
+					Type:  "error",
+					Error: &stub.ErrorResponse{Code: 5, Message: "error1"},
 				},
 			},
 		},
 	}
 	response := httptest.NewRecorder()
 	ctrl.GetHandlers()[0].Handler(response, nil)
-	expectedBody := "[{\"fullMethod\":\"method1\",\"request\":{\"match\":\"exact\",\"content\":\"request1\",\"metadata\":{\"key1\":\"value1\",\"key2\":2}},\"response\":{\"type\":\"sccess\",\"content\":\"response1\",\"error\":\"error1\"}}]"
+	expectedBody := "[{\"fullMethod\":\"method1\",\"request\":{\"match\":\"exact\",\"content\":{\"name\":\"request1\"},\"metadata\":{\"key1\":[\"value1\"],\"key2\":[\"value2\"]}},\"response\":{\"type\":\"error\",\"content\":{},\"error\":{\"code\":\"NOT_FOUND\",\"message\":\"error1\",\"details\":null}}}]"
 	assert.Equal(t, expectedBody, response.Body.String())
 	assert.Equal(t, 200, response.Code)
 	assert.Equal(t, "application/json", strings.Join(response.Header().Values("Content-Type"), ""))
@@ -0,0 +1,53 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type ExpectationsController struct {
+	StubsStore  stub.StubsStore
+	CallCounter stub.CallCounter
+}
+
+func (c ExpectationsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetExpectationsReport",
+			Path:    "/report",
+			Methods: []string{http.MethodGet},
+			Handler: c.getReportHandler,
+		},
+		{
+			Name:    "ResetCalls",
+			Path:    "/reset",
+			Methods: []string{http.MethodPost},
+			Handler: c.resetCallsHandler,
+		},
+	}
+}
+
+func (c ExpectationsController) GetPath() string {
+	return "/expectations"
+}
+
+// getReportHandler returns the expectations report in JSON or, with ?format=junit, in the JUnit XML format
+func (c ExpectationsController) getReportHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the expectations report")
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	report := stub.CheckExpectations(stubs, c.CallCounter)
+	writeReport(writer, request, report, report.JUnit)
+}
+
+func (c ExpectationsController) resetCallsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the calls counted for the expectations")
+
+	c.CallCounter.Reset()
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,175 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ConnectionFaults are the faults injected in the new and existing connections to the gRPC server
+type ConnectionFaults struct {
+	// DropConnectionsPercent is the percentage (0-100) of new connections closed as soon as they are accepted
+	DropConnectionsPercent int `json:"dropConnectionsPercent"`
+	// StallConnections makes the server stop sending data on its connections, so that the keepalive pings of the
+	// clients time out. The connections are closed when they stop being stalled.
+	StallConnections bool `json:"stallConnections"`
+	// MaxConnectionIdle sends GOAWAY to the connections without calls in progress for the duration, e.g. 30s, to
+	// simulate the idle timeout of a server
+	MaxConnectionIdle string `json:"maxConnectionIdle,omitempty"`
+	// MaxConnectionAge sends GOAWAY to the connections open for the duration, e.g. 1m, so that the clients reconnect
+	// periodically. The calls in progress can finish within the grace period of the GOAWAYs.
+	MaxConnectionAge string `json:"maxConnectionAge,omitempty"`
+	// Bandwidth limits the bytes sent per second on each connection, e.g. 10KB/s, to simulate constrained networks
+	Bandwidth string `json:"bandwidth,omitempty"`
+	// SlowStart raises the bandwidth of the new connections gradually over the duration, e.g. 5s, from a tenth of it,
+	// as TCP slow start does
+	SlowStart string `json:"slowStart,omitempty"`
+}
+
+// bandwidthPattern matches the bandwidths, e.g. 10KB/s or 1.5MB/s
+var bandwidthPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)(B|KB|MB|GB)/s$`)
+
+var bandwidthUnits = map[string]float64{"B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30}
+
+// ParseBandwidth parses a bandwidth, e.g. 10KB/s, into bytes per second. The units are multiples of 1024.
+func ParseBandwidth(bandwidth string) (float64, error) {
+	match := bandwidthPattern.FindStringSubmatch(bandwidth)
+	if match == nil {
+		return 0, fmt.Errorf("invalid bandwidth '%s', e.g. 10KB/s", bandwidth)
+	}
+	value, _ := strconv.ParseFloat(match[1], 64)
+	if value <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth '%s', e.g. 10KB/s", bandwidth)
+	}
+	return value * bandwidthUnits[match[2]], nil
+}
+
+// Validate checks the values of the faults
+func (f ConnectionFaults) Validate() error {
+	if f.DropConnectionsPercent < 0 || f.DropConnectionsPercent > 100 {
+		return fmt.Errorf("dropConnectionsPercent must be between 0 and 100")
+	}
+	for name, value := range map[string]string{"maxConnectionIdle": f.MaxConnectionIdle, "maxConnectionAge": f.MaxConnectionAge, "slowStart": f.SlowStart} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration, e.g. 30s", name)
+		}
+	}
+	if f.Bandwidth != "" {
+		if _, err := ParseBandwidth(f.Bandwidth); err != nil {
+			return err
+		}
+	} else if f.SlowStart != "" {
+		return fmt.Errorf("slowStart requires a bandwidth")
+	}
+	return nil
+}
+
+type FaultsStatus struct {
+	ConnectionFaults
+	// Connections is the number of connections open
+	Connections int `json:"connections"`
+}
+
+// FaultInjector injects faults in the connections to the gRPC server
+type FaultInjector interface {
+	GetFaults() FaultsStatus
+	SetFaults(faults ConnectionFaults)
+	// GoAway sends GOAWAY to all the connections
+	GoAway() error
+}
+
+type setFaultsRequest struct {
+	ConnectionFaults
+	// GoAway sends GOAWAY to all the connections once
+	GoAway bool `json:"goAway"`
+}
+
+type FaultsController struct {
+	Injector FaultInjector
+}
+
+func (c FaultsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetFaults",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getFaultsHandler,
+		},
+		{
+			Name:    "SetFaults",
+			Path:    "",
+			Methods: []string{http.MethodPost},
+			Handler: c.setFaultsHandler,
+		},
+		{
+			Name:    "ClearFaults",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.clearFaultsHandler,
+		},
+	}
+}
+
+func (c FaultsController) GetPath() string {
+	return "/faults"
+}
+
+func (c FaultsController) getFaultsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the faults")
+
+	writeErr := writeResponse(writer, c.Injector.GetFaults())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// setFaultsHandler replaces the faults injected and sends GOAWAY if requested
+func (c FaultsController) setFaultsHandler(writer http.ResponseWriter, request *http.Request) {
+	setRequest := setFaultsRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &setRequest)
+	}
+	if err == nil {
+		err = setRequest.ConnectionFaults.Validate()
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set faults failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{
+		"goAway":                 setRequest.GoAway,
+		"dropConnectionsPercent": setRequest.DropConnectionsPercent,
+		"stallConnections":       setRequest.StallConnections,
+		"maxConnectionIdle":      setRequest.MaxConnectionIdle,
+		"maxConnectionAge":       setRequest.MaxConnectionAge,
+		"bandwidth":              setRequest.Bandwidth,
+		"slowStart":              setRequest.SlowStart,
+		"actor":                  getActor(request),
+	}).Info("REST: received call to set the faults")
+
+	c.Injector.SetFaults(setRequest.ConnectionFaults)
+	if setRequest.GoAway {
+		if err := c.Injector.GoAway(); err != nil {
+			writeErrorResponse(writer, http.StatusConflict, err.Error())
+			return
+		}
+	}
+	writeSuccessResponse(writer)
+}
+
+func (c FaultsController) clearFaultsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to clear the faults")
+
+	c.Injector.SetFaults(ConnectionFaults{})
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,237 @@
+package restcontrollers
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	queryParamExclusive = "exclusive"
+	queryParamDedupe    = "dedupe"
+)
+
+type FixturesController struct {
+	StubsStore    stub.StubsStore
+	FixturesStore stub.FixturesStore
+	Service       grpchandler.MockService
+	AuditLog      stub.AuditLog
+}
+
+func (c FixturesController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetFixtures",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getFixturesHandler,
+		},
+		{
+			Name:    "GetFixture",
+			Path:    "/{name}",
+			Methods: []string{http.MethodGet},
+			Handler: c.getFixtureHandler,
+		},
+		{
+			Name:    "SaveFixture",
+			Path:    "/{name}",
+			Methods: []string{http.MethodPut},
+			Handler: c.saveFixtureHandler,
+		},
+		{
+			Name:    "DeleteFixture",
+			Path:    "/{name}",
+			Methods: []string{http.MethodDelete},
+			Handler: c.deleteFixtureHandler,
+		},
+		{
+			Name:    "ActivateFixture",
+			Path:    "/{name}/activate",
+			Methods: []string{http.MethodPost},
+			Handler: c.activateFixtureHandler,
+		},
+		{
+			Name:    "DeactivateFixture",
+			Path:    "/{name}/deactivate",
+			Methods: []string{http.MethodPost},
+			Handler: c.deactivateFixtureHandler,
+		},
+	}
+}
+
+func (c FixturesController) GetPath() string {
+	return "/fixtures"
+}
+
+func (c FixturesController) getFixturesHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get fixtures")
+
+	active, err := stub.ActiveFixtures(request.Context(), c.StubsStore)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	summaries := make([]stub.FixtureSummary, 0)
+	for _, fixture := range c.FixturesStore.GetAll() {
+		summaries = append(summaries, fixture.Summary(active))
+	}
+	writeErr := writeResponse(writer, summaries)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c FixturesController) getFixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	log.Infof("REST: received call to get fixture %s", name)
+
+	fixture := c.FixturesStore.Get(name)
+	if fixture == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Fixture not found")
+		return
+	}
+	writeErr := writeResponse(writer, fixture)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// saveFixtureHandler creates or replaces a fixture with the stubs in the body (a single stub or an array of stubs).
+// Saving a fixture doesn't change the stubs of the fixture already active. With ?dedupe=true the stubs that match the
+// same requests with the same response are merged (see stub.Dedupe).
+func (c FixturesController) saveFixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	bodyData, err := ioutil.ReadAll(request.Body)
+	var stubs []*stub.Stub
+	if err == nil {
+		stubs, err = stub.ParseStubs(bodyData)
+	}
+	fixture := &stub.Fixture{Name: name, Stubs: stubs}
+	if err == nil {
+		var existing []*stub.Stub
+		if existing, err = c.StubsStore.GetAllStubs(request.Context()); err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+		err = fixture.ResolveExtends(existing)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to save fixture failed with error: %s", err.Error()))
+		return
+	}
+	dedupe := getQueryParam(request, queryParamDedupe) == "true"
+	log.WithFields(log.Fields{"stubs": len(stubs), "dedupe": dedupe}).
+		Infof("REST: received call to save fixture %s", name)
+
+	if errorMessages := c.validateStubs(fixture.Stubs); len(errorMessages) > 0 {
+		writeErrorResponse(writer, http.StatusBadRequest, strings.Join(errorMessages, ", "))
+		return
+	}
+	if dedupe {
+		var merged []*stub.Stub
+		fixture.Stubs, merged = stub.Dedupe(fixture.Stubs)
+		if len(merged) > 0 {
+			log.Infof("Merged %d duplicate stubs of fixture %s", len(merged), name)
+		}
+	}
+	c.FixturesStore.Save(fixture)
+	writeSuccessResponse(writer)
+}
+
+// deleteFixtureHandler deletes the fixture and removes its stubs from the store if it is active
+func (c FixturesController) deleteFixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	log.Infof("REST: received call to delete fixture %s", name)
+
+	if err := c.FixturesStore.Delete(name); err != nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Fixture not found")
+		return
+	}
+	c.deactivate(writer, request, name)
+}
+
+// activateFixtureHandler adds the stubs of the fixture to the store. With ?exclusive=true the stubs of the other
+// active fixtures are removed in the same operation.
+func (c FixturesController) activateFixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	exclusive := getQueryParam(request, queryParamExclusive) == "true"
+	log.WithFields(log.Fields{"exclusive": exclusive}).
+		Infof("REST: received call to activate fixture %s", name)
+
+	fixture := c.FixturesStore.Get(name)
+	if fixture == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Fixture not found")
+		return
+	}
+	actor := getActor(request)
+	previous, err := fixture.Activate(request.Context(), c.StubsStore, actor, exclusive)
+	var current []*stub.Stub
+	if err == nil {
+		current, err = c.StubsStore.GetAllStubs(request.Context())
+	}
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	recordReplace(c.AuditLog, actor, previous, current)
+	writeSuccessResponse(writer)
+}
+
+func (c FixturesController) deactivateFixtureHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	log.Infof("REST: received call to deactivate fixture %s", name)
+
+	if c.FixturesStore.Get(name) == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Fixture not found")
+		return
+	}
+	c.deactivate(writer, request, name)
+}
+
+// deactivate removes the stubs of the fixture from the store and records their deletion
+func (c FixturesController) deactivate(writer http.ResponseWriter, request *http.Request, name string) {
+	removed, err := stub.DeactivateFixture(request.Context(), c.StubsStore, name)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	c.recordDeactivation(request, removed)
+	writeSuccessResponse(writer)
+}
+
+func (c FixturesController) recordDeactivation(request *http.Request, removed []*stub.Stub) {
+	if c.AuditLog == nil {
+		return
+	}
+	for _, s := range removed {
+		c.AuditLog.Record(getActor(request), stub.ChangeTypeDelete, s, nil)
+	}
+}
+
+// validateStubs checks the stubs of a fixture the same way as the stubs loaded from files
+func (c FixturesController) validateStubs(stubs []*stub.Stub) []string {
+	supportedMethods := make(map[string]bool, 0)
+	for _, method := range c.Service.GetSupportedMethods() {
+		supportedMethods[method] = true
+	}
+	errorMessages := make([]string, 0)
+	for i, s := range stubs {
+		if !supportedMethods[s.FullMethod] {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: method %s is not supported", i, s.FullMethod))
+			continue
+		}
+		if err := grpchandler.NormalizeStubContent(c.Service, s); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: %s", i, err.Error()))
+			continue
+		}
+		if isValid, stubErrors := c.Service.GetStubsValidator().IsValid(s); !isValid {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: %s", i, strings.Join(stubErrors, ", ")))
+		}
+	}
+	return errorMessages
+}
@@ -0,0 +1,72 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// GoldenController reports the responses that differ from the golden files and accepts them when the changes are
+// intended
+type GoldenController struct {
+	Golden *grpchandler.GoldenFiles
+}
+
+type goldenAcceptResponse struct {
+	Accepted int `json:"accepted"`
+}
+
+func (c GoldenController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetGoldenReport",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getReportHandler,
+		},
+		{
+			Name:    "ResetGoldenReport",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+		{
+			Name:    "AcceptGoldenMismatches",
+			Path:    "/accept",
+			Methods: []string{http.MethodPost},
+			Handler: c.acceptHandler,
+		},
+	}
+}
+
+func (c GoldenController) GetPath() string {
+	return "/golden"
+}
+
+// getReportHandler returns the report in JSON or, with ?format=junit, in the JUnit XML format
+func (c GoldenController) getReportHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the golden files report")
+
+	report := c.Golden.Report()
+	writeReport(writer, request, report, report.JUnit)
+}
+
+func (c GoldenController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the golden files report")
+
+	c.Golden.Reset()
+	writeSuccessResponse(writer)
+}
+
+func (c GoldenController) acceptHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to accept the responses that differ from the golden files")
+
+	accepted, err := c.Golden.Accept()
+	if err != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if writeErr := writeResponse(writer, goldenAcceptResponse{Accepted: accepted}); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
@@ -0,0 +1,486 @@
+package restcontrollers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphQLController serves a GraphQL endpoint with a single schema over the stubs, the journal, the scenarios and the
+// verifications, for the queries the filters of the REST API can't express, e.g. the stubs of a method not matched in
+// the last hour:
+//
+//	{ stubs(method: "GetOrder", notHitWithin: "1h") { id description calls lastHitAt } }
+//
+// The endpoint is read-only: the changes are made through the REST API.
+type GraphQLController struct {
+	StubsStore     stub.StubsStore
+	Journal        stub.Journal
+	ScenariosStore stub.ScenariosStore
+	CallCounter    stub.CallCounter
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (c GraphQLController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GraphQL",
+			Path:    "",
+			Methods: []string{http.MethodGet, http.MethodPost},
+			Handler: c.queryHandler,
+		},
+	}
+}
+
+func (c GraphQLController) GetPath() string {
+	return "/graphql"
+}
+
+// queryHandler runs the query sent as JSON in the body of a POST, or in the parameters query, operationName and
+// variables of a GET. The response has the data and the errors of the query, as any GraphQL server.
+func (c GraphQLController) queryHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to run a GraphQL query")
+
+	query := graphQLRequest{Query: getQueryParam(request, "query"), OperationName: getQueryParam(request, "operationName")}
+	var err error
+	if variables := getQueryParam(request, "variables"); variables != emptyString {
+		err = json.Unmarshal([]byte(variables), &query.Variables)
+	}
+	if request.Method == http.MethodPost {
+		var bodyData []byte
+		bodyData, err = ioutil.ReadAll(request.Body)
+		if err == nil {
+			err = json.Unmarshal(bodyData, &query)
+		}
+	}
+	if err == nil && query.Query == "" {
+		err = fmt.Errorf("query is required")
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("GraphQL query failed with error: %s", err.Error()))
+		return
+	}
+	data := &graphQLData{controller: c, ctx: request.Context(), entries: c.Journal.GetAll()}
+	result := graphql.Do(graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  query.Query,
+		OperationName:  query.OperationName,
+		VariableValues: query.Variables,
+		Context:        context.WithValue(request.Context(), graphQLDataKey{}, data),
+	})
+	if writeErr := writeResponse(writer, result); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+type graphQLDataKey struct{}
+
+// graphQLData is what the resolvers of a query read. The journal and the stubs are read once per query, so that all
+// the fields see the same calls and stubs.
+type graphQLData struct {
+	controller GraphQLController
+	ctx        context.Context
+	entries    []stub.JournalEntry
+	stubs      []*stub.Stub
+	stubsErr   error
+	stubsOnce  sync.Once
+	hits       map[string][]stub.JournalEntry
+	hitsOnce   sync.Once
+}
+
+func getGraphQLData(p graphql.ResolveParams) *graphQLData {
+	return p.Context.Value(graphQLDataKey{}).(*graphQLData)
+}
+
+// getStubs returns all the stubs, sorted by method and ID
+func (d *graphQLData) getStubs() ([]*stub.Stub, error) {
+	d.stubsOnce.Do(func() {
+		page, err := d.controller.StubsStore.Query(d.ctx, stub.StubsQuery{})
+		if err != nil {
+			d.stubsErr = err
+			return
+		}
+		d.stubs = page.Stubs
+	})
+	return d.stubs, d.stubsErr
+}
+
+// getHits returns the calls of the journal matched by the stub, in order
+func (d *graphQLData) getHits(stubID string) []stub.JournalEntry {
+	d.hitsOnce.Do(func() {
+		d.hits = make(map[string][]stub.JournalEntry)
+		for _, entry := range d.entries {
+			if entry.StubID != "" {
+				d.hits[entry.StubID] = append(d.hits[entry.StubID], entry)
+			}
+		}
+	})
+	return d.hits[stubID]
+}
+
+// lastHit returns when the stub last matched a call of the journal, the zero time when it didn't
+func (d *graphQLData) lastHit(stubID string) time.Time {
+	hits := d.getHits(stubID)
+	if len(hits) == 0 {
+		return time.Time{}
+	}
+	return hits[len(hits)-1].Timestamp
+}
+
+// graphQLSince reads an argument with a duration, e.g. 1h, and returns the time that long ago. ok is false when the
+// argument is not set.
+func graphQLSince(p graphql.ResolveParams, name string) (since time.Time, ok bool, err error) {
+	value, ok := p.Args[name].(string)
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, false, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return time.Now().Add(-duration), true, nil
+}
+
+// graphQLStrings reads an argument with a list of strings
+func graphQLStrings(p graphql.ResolveParams, name string) []string {
+	values, _ := p.Args[name].([]interface{})
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+// graphQLJSON is a JSON value, e.g. the request of a stub or the labels
+var graphQLJSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:         "JSON",
+	Description:  "A JSON value",
+	Serialize:    func(value interface{}) interface{} { return value },
+	ParseValue:   func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} { return nil },
+})
+
+// jsonContent returns the content as a JSON value, which is encoded as a string otherwise
+func jsonContent(content stub.JsonString) interface{} {
+	if content == "" {
+		return nil
+	}
+	return json.RawMessage(content)
+}
+
+var graphQLSchema = newGraphQLSchema()
+
+func newGraphQLSchema() graphql.Schema {
+	scenarioRefType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "StubScenario",
+		Fields: graphql.Fields{
+			"name":          &graphql.Field{Type: graphql.String},
+			"requiredState": &graphql.Field{Type: graphql.String},
+			"newState":      &graphql.Field{Type: graphql.String},
+		},
+	})
+	journalEntryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "JournalEntry",
+		Description: "A call received, with the stub that matched it",
+		Fields: graphql.Fields{
+			"seq":        &graphql.Field{Type: graphql.Int},
+			"timestamp":  &graphql.Field{Type: graphql.DateTime},
+			"fullMethod": &graphql.Field{Type: graphql.String},
+			"request": &graphql.Field{Type: graphQLJSON, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return jsonContent(p.Source.(stub.JournalEntry).Request), nil
+			}},
+			"metadata": &graphql.Field{Type: graphQLJSON},
+			"stubId":   &graphql.Field{Type: graphql.String},
+		},
+	})
+	stubType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Stub",
+		Fields: graphql.Fields{
+			"id":            &graphql.Field{Type: graphql.String},
+			"fullMethod":    &graphql.Field{Type: graphql.String},
+			"description":   &graphql.Field{Type: graphql.String},
+			"name":          &graphql.Field{Type: graphql.String},
+			"extends":       &graphql.Field{Type: graphql.String},
+			"labels":        &graphql.Field{Type: graphQLJSON},
+			"set":           &graphql.Field{Type: graphql.String},
+			"fixture":       &graphql.Field{Type: graphql.String},
+			"createdBy":     &graphql.Field{Type: graphql.String},
+			"createdAt":     &graphql.Field{Type: graphql.DateTime},
+			"updatedAt":     &graphql.Field{Type: graphql.DateTime},
+			"version":       &graphql.Field{Type: graphql.Int},
+			"scenario":      &graphql.Field{Type: scenarioRefType},
+			"expectedCalls": &graphql.Field{Type: graphQLJSON},
+			"request":       &graphql.Field{Type: graphQLJSON},
+			"response":      &graphql.Field{Type: graphQLJSON},
+			"calls": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "The calls matched since the expectations were reset",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return getGraphQLData(p).controller.CallCounter.Get(p.Source.(*stub.Stub).ID), nil
+				},
+			},
+			"lastHitAt": &graphql.Field{
+				Type:        graphql.DateTime,
+				Description: "When the stub last matched a call of the journal",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if lastHit := getGraphQLData(p).lastHit(p.Source.(*stub.Stub).ID); !lastHit.IsZero() {
+						return lastHit, nil
+					}
+					return nil, nil
+				},
+			},
+			"hits": &graphql.Field{
+				Type:        graphql.NewList(journalEntryType),
+				Description: "The calls of the journal matched by the stub, within a duration (e.g. 1h) when given",
+				Args:        graphql.FieldConfigArgument{"within": &graphql.ArgumentConfig{Type: graphql.String}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					since, _, err := graphQLSince(p, "within")
+					if err != nil {
+						return nil, err
+					}
+					return stub.JournalFilter{Since: since}.Select(getGraphQLData(p).getHits(p.Source.(*stub.Stub).ID)), nil
+				},
+			},
+		},
+	})
+	findStub := func(p graphql.ResolveParams, id string) (interface{}, error) {
+		stubs, err := getGraphQLData(p).getStubs()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range stubs {
+			if s.ID == id {
+				return s, nil
+			}
+		}
+		return nil, nil
+	}
+	journalEntryType.AddFieldConfig("stub", &graphql.Field{
+		Type:        stubType,
+		Description: "The stub that matched the call, if it still exists",
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return findStub(p, p.Source.(stub.JournalEntry).StubID)
+		},
+	})
+	scenarioType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Scenario",
+		Fields: graphql.Fields{
+			"name":   &graphql.Field{Type: graphql.String},
+			"state":  &graphql.Field{Type: graphql.String},
+			"states": &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"stubs": &graphql.Field{Type: graphql.NewList(stubType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				stubs, err := getGraphQLData(p).getStubs()
+				selected := make([]*stub.Stub, 0)
+				for _, s := range stubs {
+					if s.Scenario != nil && s.Scenario.Name == p.Source.(*stub.Scenario).Name {
+						selected = append(selected, s)
+					}
+				}
+				return selected, err
+			}},
+		},
+	})
+	expectationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Expectation",
+		Fields: graphql.Fields{
+			"stubId":        &graphql.Field{Type: graphql.String},
+			"fullMethod":    &graphql.Field{Type: graphql.String},
+			"description":   &graphql.Field{Type: graphql.String},
+			"expectedCalls": &graphql.Field{Type: graphQLJSON},
+			"calls":         &graphql.Field{Type: graphql.Int},
+			"status":        &graphql.Field{Type: graphql.String},
+			"stub": &graphql.Field{Type: stubType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return findStub(p, p.Source.(*stub.ExpectationResult).StubID)
+			}},
+		},
+	})
+	expectationsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Expectations",
+		Fields: graphql.Fields{
+			"satisfied": &graphql.Field{Type: graphql.Boolean},
+			"results":   &graphql.Field{Type: graphql.NewList(expectationType)},
+		},
+	})
+	orderVerificationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "OrderVerification",
+		Fields: graphql.Fields{
+			"inOrder":  &graphql.Field{Type: graphql.Boolean},
+			"expected": &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"actual":   &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"diff":     &graphql.Field{Type: graphql.String},
+		},
+	})
+	stringList := graphql.NewList(graphql.NewNonNull(graphql.String))
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"stubs": &graphql.Field{
+				Type: graphql.NewList(stubType),
+				Description: "The stubs, sorted by method and ID, selected by method (full method or name), labels " +
+					"(name:value) and whether they matched a call of the journal within a duration, e.g. 1h",
+				Args: graphql.FieldConfigArgument{
+					"method":       &graphql.ArgumentConfig{Type: graphql.String},
+					"labels":       &graphql.ArgumentConfig{Type: stringList},
+					"hitWithin":    &graphql.ArgumentConfig{Type: graphql.String},
+					"notHitWithin": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveGraphQLStubs,
+			},
+			"stub": &graphql.Field{
+				Type: stubType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return findStub(p, p.Args["id"].(string))
+				},
+			},
+			"journal": &graphql.Field{
+				Type: graphql.NewList(journalEntryType),
+				Description: "The calls of the journal selected by methods (full method or name), sequence numbers, " +
+					"duration (e.g. 1h), stub, whether a stub matched them and JSONPath queries over the request",
+				Args: graphql.FieldConfigArgument{
+					"methods": &graphql.ArgumentConfig{Type: stringList},
+					"from":    &graphql.ArgumentConfig{Type: graphql.Int},
+					"to":      &graphql.ArgumentConfig{Type: graphql.Int},
+					"within":  &graphql.ArgumentConfig{Type: graphql.String},
+					"stubId":  &graphql.ArgumentConfig{Type: graphql.String},
+					"matched": &graphql.ArgumentConfig{Type: graphql.Boolean},
+					"queries": &graphql.ArgumentConfig{Type: stringList},
+				},
+				Resolve: resolveGraphQLJournal,
+			},
+			"scenarios": &graphql.Field{
+				Type: graphql.NewList(scenarioType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data := getGraphQLData(p)
+					stubs, err := data.getStubs()
+					if err != nil {
+						return nil, err
+					}
+					return stub.GetScenarios(stubs, data.controller.ScenariosStore), nil
+				},
+			},
+			"expectations": &graphql.Field{
+				Type: expectationsType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data := getGraphQLData(p)
+					stubs, err := data.getStubs()
+					if err != nil {
+						return nil, err
+					}
+					return stub.CheckExpectations(stubs, data.controller.CallCounter), nil
+				},
+			},
+			"verifyOrder": &graphql.Field{
+				Type:        orderVerificationType,
+				Description: "Checks that the calls to the methods (full method or name) of the journal happened in order",
+				Args: graphql.FieldConfigArgument{
+					"calls": &graphql.ArgumentConfig{Type: graphql.NewNonNull(stringList)},
+					"exact": &graphql.ArgumentConfig{Type: graphql.Boolean},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					exact, _ := p.Args["exact"].(bool)
+					return stub.VerifyOrder(getGraphQLData(p).entries, graphQLStrings(p, "calls"), exact), nil
+				},
+			},
+		},
+	})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func resolveGraphQLStubs(p graphql.ResolveParams) (interface{}, error) {
+	data := getGraphQLData(p)
+	query := stub.StubsQuery{}
+	for _, label := range graphQLStrings(p, "labels") {
+		parts := strings.SplitN(label, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid label %s, expected name:value", label)
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string)
+		}
+		query.Labels[parts[0]] = parts[1]
+	}
+	hitSince, hitWithin, err := graphQLSince(p, "hitWithin")
+	if err != nil {
+		return nil, err
+	}
+	notHitSince, notHitWithin, err := graphQLSince(p, "notHitWithin")
+	if err != nil {
+		return nil, err
+	}
+	stubs, err := data.getStubs()
+	if err != nil {
+		return nil, err
+	}
+	method, _ := p.Args["method"].(string)
+	selected := make([]*stub.Stub, 0)
+	for _, s := range stubs {
+		if (method != "" && !stub.MethodMatches(s.FullMethod, method)) || !query.Matches(s) {
+			continue
+		}
+		lastHit := data.lastHit(s.ID)
+		if hitWithin && (lastHit.IsZero() || lastHit.Before(hitSince)) {
+			continue
+		}
+		if notHitWithin && !lastHit.IsZero() && !lastHit.Before(notHitSince) {
+			continue
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+func resolveGraphQLJournal(p graphql.ResolveParams) (interface{}, error) {
+	data := getGraphQLData(p)
+	filter := stub.JournalFilter{Methods: graphQLStrings(p, "methods")}
+	filter.FromSeq = int64(intArg(p, "from"))
+	filter.ToSeq = int64(intArg(p, "to"))
+	since, _, err := graphQLSince(p, "within")
+	if err != nil {
+		return nil, err
+	}
+	filter.Since = since
+	for _, source := range graphQLStrings(p, "queries") {
+		query, err := stub.ParseJSONPathQuery(source)
+		if err != nil {
+			return nil, err
+		}
+		filter.Queries = append(filter.Queries, query)
+	}
+	stubID, _ := p.Args["stubId"].(string)
+	matched, filterMatched := p.Args["matched"].(bool)
+	selected := make([]stub.JournalEntry, 0)
+	for _, entry := range filter.Select(data.entries) {
+		if (stubID != "" && entry.StubID != stubID) || (filterMatched && matched != (entry.StubID != "")) {
+			continue
+		}
+		selected = append(selected, entry)
+	}
+	return selected, nil
+}
+
+func intArg(p graphql.ResolveParams, name string) int {
+	value, _ := p.Args[name].(int)
+	return value
+}
@@ -0,0 +1,75 @@
+package restcontrollers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQLController_queryHandler(t *testing.T) {
+	stubsStore := stub.NewInMemoryStubsStore()
+	journal := stub.NewInMemoryJournal(10)
+	ctrl := GraphQLController{StubsStore: stubsStore, Journal: journal, ScenariosStore: stub.NewInMemoryScenariosStore(),
+		CallCounter: stub.NewInMemoryCallCounter()}
+	newStub := func(method, id string) *stub.Stub {
+		return &stub.Stub{
+			FullMethod: method,
+			Request:    &stub.StubRequest{Match: "exact", Content: stub.JsonString(`{"id":"` + id + `"}`)},
+			Response:   &stub.StubResponse{Type: "success", Content: stub.JsonString(`{"id":"` + id + `"}`)},
+			Labels:     map[string]string{"team": "orders"},
+		}
+	}
+	hit, notHit, other := newStub("/acme.Orders/GetOrder", "1"), newStub("/acme.Orders/GetOrder", "2"), newStub("/acme.Orders/ListOrders", "3")
+	for _, s := range []*stub.Stub{hit, notHit, other} {
+		assert.NoError(t, stubsStore.Add(context.Background(), s))
+	}
+	journal.Record(stub.JournalEntry{Timestamp: time.Now().Add(-2 * time.Hour), FullMethod: "/acme.Orders/GetOrder", Request: `{"id":"2"}`, StubID: notHit.ID})
+	journal.Record(stub.JournalEntry{Timestamp: time.Now(), FullMethod: "/acme.Orders/GetOrder", Request: `{"id":"1"}`, StubID: hit.ID})
+	journal.Record(stub.JournalEntry{Timestamp: time.Now(), FullMethod: "/acme.Orders/GetOrder", Request: `{"id":"4"}`})
+
+	query := func(method string, body string) (int, map[string]interface{}) {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/graphql?query="+url.QueryEscape(body), nil)
+		if method == http.MethodPost {
+			request = httptest.NewRequest(method, "/graphql", strings.NewReader(body))
+		}
+		ctrl.queryHandler(response, request)
+		result := make(map[string]interface{})
+		json.Unmarshal(response.Body.Bytes(), &result)
+		return response.Code, result
+	}
+
+	code, result := query(http.MethodGet, `{ stubs(method: "GetOrder", notHitWithin: "1h") { id labels request createdAt lastHitAt hits { seq } } }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, result["errors"])
+	stubs := result["data"].(map[string]interface{})["stubs"].([]interface{})
+	assert.Len(t, stubs, 1)
+	assert.Equal(t, notHit.ID, stubs[0].(map[string]interface{})["id"])
+	assert.Equal(t, map[string]interface{}{"team": "orders"}, stubs[0].(map[string]interface{})["labels"])
+	assert.Equal(t, map[string]interface{}{"id": "2"}, stubs[0].(map[string]interface{})["request"].(map[string]interface{})["content"])
+	assert.NotNil(t, stubs[0].(map[string]interface{})["lastHitAt"])
+	assert.NotNil(t, stubs[0].(map[string]interface{})["createdAt"])
+	assert.Len(t, stubs[0].(map[string]interface{})["hits"], 1)
+
+	code, result = query(http.MethodPost, `{"query": "query Calls($method: String!) { journal(methods: [$method], matched: true, queries: [\"$.id == '1'\"]) { seq request stub { id } } }", "variables": {"method": "GetOrder"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, result["errors"])
+	entries := result["data"].(map[string]interface{})["journal"].([]interface{})
+	assert.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{"seq": float64(2), "request": map[string]interface{}{"id": "1"},
+		"stub": map[string]interface{}{"id": hit.ID}}, entries[0])
+
+	code, result = query(http.MethodGet, `{ stubs(notHitWithin: "an hour") { id } }`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotNil(t, result["errors"])
+
+	code, _ = query(http.MethodPost, `{"query": ""}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
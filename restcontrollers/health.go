@@ -0,0 +1,108 @@
+package restcontrollers
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"net/http"
+)
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusReady    = "ready"
+	healthStatusNotReady = "not ready"
+)
+
+// HealthPaths are the paths of the probes, which never require authentication
+var HealthPaths = []string{"/healthz", "/readyz"}
+
+type HealthStatus struct {
+	Status string `json:"status"`
+	// Result of each check: ok or the reason of the failure
+	Checks        map[string]string `json:"checks,omitempty"`
+	StubCount     int               `json:"stubCount"`
+	StubsByMethod map[string]int    `json:"stubsByMethod,omitempty"`
+}
+
+// HealthController serves the liveness (/healthz) and readiness (/readyz) probes
+type HealthController struct {
+	StubsStore stub.StubsStore
+	// GRPCServing reports if the gRPC server is accepting connections
+	GRPCServing func() bool
+	// StrictMode fails the readiness after unexpected calls when configured to do so
+	StrictMode *grpchandler.StrictMode
+}
+
+func (c HealthController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "Liveness",
+			Path:    HealthPaths[0],
+			Methods: []string{http.MethodGet},
+			Handler: c.livenessHandler,
+		},
+		{
+			Name:    "Readiness",
+			Path:    HealthPaths[1],
+			Methods: []string{http.MethodGet},
+			Handler: c.readinessHandler,
+		},
+	}
+}
+
+func (c HealthController) GetPath() string {
+	return ""
+}
+
+// livenessHandler reports that the process is able to serve requests
+func (c HealthController) livenessHandler(writer http.ResponseWriter, request *http.Request) {
+	writeResponse(writer, HealthStatus{Status: healthStatusOK})
+}
+
+// readinessHandler reports if the gRPC server is listening, the stubs store is reachable and, in strict mode, if no
+// unexpected call was received
+func (c HealthController) readinessHandler(writer http.ResponseWriter, request *http.Request) {
+	health := HealthStatus{
+		Status:        healthStatusReady,
+		Checks:        make(map[string]string, 0),
+		StubsByMethod: make(map[string]int, 0),
+	}
+
+	health.Checks["grpc"] = healthStatusOK
+	if c.GRPCServing != nil && !c.GRPCServing() {
+		health.Checks["grpc"] = "gRPC server is not listening"
+		health.Status = healthStatusNotReady
+	}
+
+	health.Checks["store"] = healthStatusOK
+	if checker, ok := c.StubsStore.(stub.StoreHealthChecker); ok {
+		if err := checker.CheckHealth(request.Context()); err != nil {
+			health.Checks["store"] = err.Error()
+			health.Status = healthStatusNotReady
+		}
+	}
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		health.Checks["store"] = err.Error()
+		health.Status = healthStatusNotReady
+	}
+
+	if c.StrictMode != nil && c.StrictMode.IsEnabled() {
+		health.Checks["strict"] = healthStatusOK
+		if !c.StrictMode.IsHealthy() {
+			health.Checks["strict"] = fmt.Sprintf("%d unexpected calls received", c.StrictMode.GetStatus().UnexpectedCalls)
+			health.Status = healthStatusNotReady
+		}
+	}
+
+	for _, s := range stubs {
+		health.StubCount++
+		health.StubsByMethod[s.FullMethod]++
+	}
+
+	code := http.StatusOK
+	if health.Status != healthStatusReady {
+		code = http.StatusServiceUnavailable
+	}
+	writeResponseWithCode(writer, health, code)
+}
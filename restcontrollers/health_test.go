@@ -0,0 +1,59 @@
+package restcontrollers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHealthController_Readiness(t *testing.T) {
+	store := stub.NewInMemoryStubsStore()
+	store.Add(context.Background(), &stub.Stub{
+		FullMethod: "method1",
+		Request:    &stub.StubRequest{Match: "exact", Content: "{}"},
+		Response:   &stub.StubResponse{Type: "success", Content: "{}"},
+	})
+	serving := false
+	controller := HealthController{StubsStore: store, GRPCServing: func() bool { return serving }}
+
+	recorder := httptest.NewRecorder()
+	controller.readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	serving = true
+	recorder = httptest.NewRecorder()
+	controller.readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	health := HealthStatus{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &health))
+	assert.Equal(t, "ready", health.Status)
+	assert.Equal(t, 1, health.StubCount)
+	assert.Equal(t, map[string]int{"method1": 1}, health.StubsByMethod)
+}
+
+func TestHealthController_ReadinessStrictMode(t *testing.T) {
+	strictMode := grpchandler.GetStrictMode()
+	strictMode.Configure(true, true)
+	defer strictMode.Configure(false, false)
+	controller := HealthController{StubsStore: stub.NewInMemoryStubsStore(), StrictMode: strictMode}
+
+	_, err := grpchandler.MockHandler(context.Background(), stub.NewStubsMatcher(stub.NewInMemoryStubsStore()), "method1", &structpb.Struct{}, &structpb.Struct{})
+	assert.Error(t, err)
+	recorder := httptest.NewRecorder()
+	controller.readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	health := HealthStatus{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &health))
+	assert.Equal(t, "1 unexpected calls received", health.Checks["strict"])
+
+	strictMode.Reset()
+	recorder = httptest.NewRecorder()
+	controller.readinessHandler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
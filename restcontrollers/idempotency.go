@@ -0,0 +1,53 @@
+package restcontrollers
+
+import (
+	"sync"
+	"time"
+)
+
+// Header with the key that makes the retries of a stub creation return the stub created by the first call
+const headerIdempotencyKey = "Idempotency-Key"
+
+// IdempotencyKeys keeps the stubs created with each Idempotency-Key for a period of time, so that the retries of a
+// creation, e.g. in flaky CI networks, don't fail because the stub exists already
+type IdempotencyKeys struct {
+	ttl      time.Duration
+	mutex    sync.Mutex
+	creation map[string]idempotentCreation
+}
+
+// idempotentCreation is the stub created with a key and the requests it matches
+type idempotentCreation struct {
+	fingerprint string
+	stubID      string
+	expiresAt   time.Time
+}
+
+func NewIdempotencyKeys(ttl time.Duration) *IdempotencyKeys {
+	return &IdempotencyKeys{ttl: ttl, creation: make(map[string]idempotentCreation)}
+}
+
+func (k *IdempotencyKeys) get(key string) (idempotentCreation, bool) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	creation, found := k.creation[key]
+	if found && time.Now().After(creation.expiresAt) {
+		delete(k.creation, key)
+		return idempotentCreation{}, false
+	}
+	return creation, found
+}
+
+func (k *IdempotencyKeys) put(key, fingerprint, stubID string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := time.Now()
+	for existing, creation := range k.creation {
+		if now.After(creation.expiresAt) {
+			delete(k.creation, existing)
+		}
+	}
+	k.creation[key] = idempotentCreation{fingerprint: fingerprint, stubID: stubID, expiresAt: now.Add(k.ttl)}
+}
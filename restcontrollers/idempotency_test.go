@@ -0,0 +1,79 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// structMockService is a mock service with a single method whose request and response are google.protobuf.Struct
+type structMockService struct {
+	method string
+}
+
+func (m structMockService) Register(s *grpc.Server)                {}
+func (m structMockService) GetSupportedMethods() []string          { return []string{m.method} }
+func (m structMockService) GetPayloadExamples() []stub.Stub        { return nil }
+func (m structMockService) GetStubsValidator() stub.StubsValidator { return m }
+
+func (m structMockService) GetRequestInstance(methodName string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (m structMockService) GetResponseInstance(methodName string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (m structMockService) IsValid(s *stub.Stub) (bool, []string) {
+	return s.IsValid()
+}
+
+func TestStubsController_addStubIdempotently(t *testing.T) {
+	ctrl := StubsController{
+		StubsStore:      stub.NewInMemoryStubsStore(),
+		Service:         structMockService{method: "/acme.Orders/Get"},
+		IdempotencyKeys: NewIdempotencyKeys(time.Hour),
+	}
+	addStub := func(payload, idempotencyKey string) (*httptest.ResponseRecorder, *stub.Stub) {
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/stubs", strings.NewReader(payload))
+		if idempotencyKey != "" {
+			request.Header.Set(headerIdempotencyKey, idempotencyKey)
+		}
+		ctrl.addStubsHandler(response, request)
+		added := new(stub.Stub)
+		json.Unmarshal(response.Body.Bytes(), added)
+		return response, added
+	}
+	payload := func(id, name string) string {
+		return `{"id":"` + id + `","fullMethod":"/acme.Orders/Get","request":{"match":"exact","content":{"name":"` + name +
+			`"}},"response":{"type":"success","content":{"total":1}}}`
+	}
+
+	response, first := addStub(payload("", "orders/1"), "key1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	response, retried := addStub(payload("", "orders/1"), "key1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, first.ID, retried.ID)
+	response, _ = addStub(payload("", "orders/1"), "")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	response, _ = addStub(payload("", "orders/2"), "key1")
+	assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+
+	// With the ID set by the client
+	response, first = addStub(payload("order-2", "orders/2"), "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "order-2", first.ID)
+	response, retried = addStub(payload("order-2", "orders/2"), "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "order-2", retried.ID)
+	response, _ = addStub(payload("order-2", "orders/3"), "")
+	assert.Equal(t, http.StatusConflict, response.Code)
+}
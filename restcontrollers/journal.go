@@ -0,0 +1,306 @@
+package restcontrollers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	exportFormatReplay  = "replay"
+	exportFormatGRPCurl = "grpcurl"
+	exportFormatGHZ     = "ghz"
+
+	contentTypeTextShellScript = "text/x-shellscript"
+
+	pathParamSeq = "seq"
+)
+
+type JournalController struct {
+	Journal stub.Journal
+	// Service and StubsMatcher replay the calls of the journal against the current stubs
+	Service      grpchandler.MockService
+	StubsMatcher stub.StubsMatcher
+}
+
+// journalReplay is the result of matching a call of the journal again against the current stubs
+type journalReplay struct {
+	Seq        int64  `json:"seq"`
+	FullMethod string `json:"fullMethod"`
+	// RecordedStubID is the stub that matched the call when it was received
+	RecordedStubID string `json:"recordedStubId,omitempty"`
+	// Stub is the stub that matches the call now, nil when none does
+	Stub     *stub.Stub        `json:"stub"`
+	Response json.RawMessage   `json:"response,omitempty"`
+	Stream   []json.RawMessage `json:"stream,omitempty"`
+	Headers  metadata.MD       `json:"headers,omitempty"`
+	Trailers metadata.MD       `json:"trailers,omitempty"`
+	Error    *replayedError    `json:"error,omitempty"`
+}
+
+type replayedError struct {
+	Code    stub.StatusCode `json:"code"`
+	Message string          `json:"message"`
+}
+
+type verifyOrderRequest struct {
+	// Calls are the methods (full method or only the name) expected, in order
+	Calls []string `json:"calls"`
+	// Exact requires the calls to be exactly the ones expected, without repetitions
+	Exact bool `json:"exact"`
+}
+
+func (c JournalController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetJournal",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getJournalHandler,
+		},
+		{
+			Name:    "ResetJournal",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetJournalHandler,
+		},
+		{
+			Name:    "ExportJournal",
+			Path:    "/export",
+			Methods: []string{http.MethodGet},
+			Handler: c.exportJournalHandler,
+		},
+		{
+			Name:    "VerifyOrder",
+			Path:    "/verify-order",
+			Methods: []string{http.MethodPost},
+			Handler: c.verifyOrderHandler,
+		},
+		{
+			Name:    "ReplayJournalEntry",
+			Path:    "/{seq}/replay",
+			Methods: []string{http.MethodPost},
+			Handler: c.replayEntryHandler,
+		},
+	}
+}
+
+func (c JournalController) GetPath() string {
+	return "/journal"
+}
+
+// getJournalHandler returns the calls selected with ?method= (repeatable), ?from= and ?to= (sequence numbers) and
+// ?query= (repeatable, see stub.JSONPathQuery), all of them by default
+func (c JournalController) getJournalHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the journal")
+
+	filter, err := getJournalFilter(request)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries := filter.Select(c.Journal.GetAll())
+	if writeNotModified(writer, request, journalETag(entries)) {
+		return
+	}
+	writeErr := writeResponse(writer, entries)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// journalETag identifies the entries by their number and the first and last of them. The entries are only appended or
+// dropped from the start, and their timestamps tell the entries recorded after a reset apart from the previous ones.
+func journalETag(entries []stub.JournalEntry) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n", len(entries))
+	if len(entries) > 0 {
+		first, last := entries[0], entries[len(entries)-1]
+		fmt.Fprintf(hash, "%d:%d\n%d:%d\n", first.Seq, first.Timestamp.UnixNano(), last.Seq, last.Timestamp.UnixNano())
+	}
+	return formatContentETag(hash)
+}
+
+func (c JournalController) resetJournalHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the journal")
+
+	c.Journal.Reset()
+	writeSuccessResponse(writer)
+}
+
+// exportJournalHandler exports the calls in the journal to replay them against a real service, as a replay script
+// (?format=replay, the default), a shell script with grpcurl commands (?format=grpcurl) or ghz configs (?format=ghz).
+// The calls are selected as in getJournalHandler. The grpcurl and ghz formats require the address of the service in
+// ?target= and connect to it without TLS unless ?tls=true.
+func (c JournalController) exportJournalHandler(writer http.ResponseWriter, request *http.Request) {
+	format := getQueryParam(request, "format")
+	if format == emptyString {
+		format = exportFormatReplay
+	}
+	log.WithFields(log.Fields{"format": format}).Info("REST: received call to export the journal")
+
+	filter, err := getJournalFilter(request)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	target := getQueryParam(request, "target")
+	if target == emptyString && format != exportFormatReplay {
+		writeErrorResponse(writer, http.StatusBadRequest, "target is required")
+		return
+	}
+	tls := getQueryParam(request, "tls") == "true"
+
+	script := stub.NewReplayScript(c.Journal.GetAll(), filter)
+	var response interface{}
+	switch format {
+	case exportFormatReplay:
+		response = script
+	case exportFormatGHZ:
+		response = script.GHZ(target, !tls)
+	case exportFormatGRPCurl:
+		writer.Header().Set(contentType, contentTypeTextShellScript)
+		writer.Write([]byte(script.GRPCurl(target, !tls)))
+		return
+	default:
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("format can only be '%s', '%s' or '%s'",
+			exportFormatReplay, exportFormatGRPCurl, exportFormatGHZ))
+		return
+	}
+	if writeErr := writeResponse(writer, response); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// getJournalFilter reads the filter of the journal entries from the query parameters method, from, to and query
+func getJournalFilter(request *http.Request) (stub.JournalFilter, error) {
+	filter := stub.JournalFilter{Methods: request.URL.Query()[requestParamMethod]}
+	for param, value := range map[string]*int64{"from": &filter.FromSeq, "to": &filter.ToSeq} {
+		if raw := getQueryParam(request, param); raw != emptyString {
+			seq, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || seq <= 0 {
+				return filter, fmt.Errorf("invalid %s: %s", param, raw)
+			}
+			*value = seq
+		}
+	}
+	for _, source := range request.URL.Query()["query"] {
+		query, err := stub.ParseJSONPathQuery(source)
+		if err != nil {
+			return filter, err
+		}
+		filter.Queries = append(filter.Queries, query)
+	}
+	return filter, nil
+}
+
+// verifyOrderHandler returns the verification in JSON or, with ?format=junit, in the JUnit XML format
+func (c JournalController) verifyOrderHandler(writer http.ResponseWriter, request *http.Request) {
+	verifyRequest := verifyOrderRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &verifyRequest)
+	}
+	if err == nil && len(verifyRequest.Calls) == 0 {
+		err = fmt.Errorf("calls are required")
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to verify order failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{"calls": strings.Join(verifyRequest.Calls, ", "), "exact": verifyRequest.Exact}).
+		Info("REST: received call to verify the order of the calls")
+
+	result := stub.VerifyOrder(c.Journal.GetAll(), verifyRequest.Calls, verifyRequest.Exact)
+	writeReport(writer, request, result, result.JUnit)
+}
+
+// replayEntryHandler matches a call of the journal, by its sequence number, against the current stubs and responds with
+// the stub and the response it would get, to check if new stubs handle the traffic received before. The call is a dry
+// run: the scenarios and the state are not changed, and the call is neither counted nor recorded in the journal.
+func (c JournalController) replayEntryHandler(writer http.ResponseWriter, request *http.Request) {
+	rawSeq := mux.Vars(request)[pathParamSeq]
+	log.WithFields(log.Fields{"seq": rawSeq}).Info("REST: received call to replay a call of the journal")
+
+	seq, err := strconv.ParseInt(rawSeq, 10, 64)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("invalid seq: %s", rawSeq))
+		return
+	}
+	var entry *stub.JournalEntry
+	for _, recorded := range c.Journal.GetAll() {
+		if recorded.Seq == seq {
+			entry = &recorded
+			break
+		}
+	}
+	if entry == nil {
+		writeErrorResponse(writer, http.StatusNotFound, fmt.Sprintf("call %d not found in the journal", seq))
+		return
+	}
+	replay, err := c.replayEntry(*entry)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if writeErr := writeResponse(writer, replay); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c JournalController) replayEntry(entry stub.JournalEntry) (*journalReplay, error) {
+	replay := &journalReplay{Seq: entry.Seq, FullMethod: entry.FullMethod, RecordedStubID: entry.StubID}
+	ctx := stub.WithReadOnlyState(metadata.NewIncomingContext(context.Background(), metadata.MD(entry.Metadata).Copy()))
+	requestJson := string(entry.Request)
+	replay.Stub = c.StubsMatcher.Match(ctx, entry.FullMethod, requestJson)
+	if replay.Stub == nil {
+		return replay, nil
+	}
+	var responseErr error
+	if len(replay.Stub.Response.Stream) > 0 {
+		var messages []interface{}
+		messages, responseErr = stub.GetStreamResponse(ctx, replay.Stub, requestJson, func() interface{} {
+			return c.Service.GetResponseInstance(entry.FullMethod)
+		})
+		for _, message := range messages {
+			data, err := protojson.Marshal(message.(proto.Message))
+			if err != nil {
+				return nil, err
+			}
+			replay.Stream = append(replay.Stream, data)
+		}
+	} else {
+		var response interface{}
+		response, responseErr = stub.GetResponse(ctx, replay.Stub, requestJson, c.Service.GetResponseInstance(entry.FullMethod))
+		if message, ok := response.(proto.Message); ok && responseErr == nil {
+			data, err := protojson.Marshal(message)
+			if err != nil {
+				return nil, err
+			}
+			replay.Response = data
+		}
+	}
+	if responseErr != nil {
+		st := status.Convert(responseErr)
+		replay.Error = &replayedError{Code: stub.StatusCode(st.Code()), Message: st.Message()}
+	}
+	header, trailer, err := stub.GetResponseMetadata(ctx, replay.Stub, requestJson)
+	if err != nil {
+		return nil, err
+	}
+	replay.Headers, replay.Trailers = header, trailer
+	return replay, nil
+}
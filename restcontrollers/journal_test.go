@@ -0,0 +1,55 @@
+package restcontrollers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJournalController_replayEntryHandler(t *testing.T) {
+	stubsStore := stub.NewInMemoryStubsStore()
+	journal := stub.NewInMemoryJournal(10)
+	matcher := stub.NewStubsMatcher(stubsStore, stub.WithJournal(journal))
+	ctrl := JournalController{Journal: journal, Service: structMockService{method: "/acme.Orders/Get"}, StubsMatcher: matcher}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "acme"))
+	matcher.Match(ctx, "/acme.Orders/Get", `{"id":"1"}`)
+
+	replay := func(seq string) (*httptest.ResponseRecorder, journalReplay) {
+		response := httptest.NewRecorder()
+		request := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/journal/"+seq+"/replay", nil), map[string]string{pathParamSeq: seq})
+		ctrl.replayEntryHandler(response, request)
+		result := journalReplay{}
+		json.Unmarshal(response.Body.Bytes(), &result)
+		return response, result
+	}
+	response, result := replay("1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Nil(t, result.Stub)
+	assert.Equal(t, "/acme.Orders/Get", result.FullMethod)
+
+	s := &stub.Stub{
+		FullMethod: "/acme.Orders/Get",
+		Request:    &stub.StubRequest{Match: "partial", Content: `{"id":"1"}`, Metadata: map[string][]string{"tenant": {"acme"}}},
+		Response: &stub.StubResponse{Type: "success", Content: `{"id":"1","total":3}`,
+			Headers: map[string]string{"x-tenant": "${metadata.tenant}"}},
+	}
+	assert.NoError(t, stubsStore.Add(context.Background(), s))
+	response, result = replay("1")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, s.ID, result.Stub.ID)
+	assert.JSONEq(t, `{"id":"1","total":3}`, string(result.Response))
+	assert.Equal(t, []string{"acme"}, result.Headers.Get("x-tenant"))
+	assert.Nil(t, result.Error)
+	assert.Len(t, journal.GetAll(), 1)
+
+	response, _ = replay("2")
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	response, _ = replay("first")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+}
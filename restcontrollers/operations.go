@@ -0,0 +1,49 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// OperationsController inspects and removes the long-running operations started by the stubs
+type OperationsController struct {
+	Operations *stub.Operations
+}
+
+func (c OperationsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetOperations",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getOperationsHandler,
+		},
+		{
+			Name:    "ResetOperations",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c OperationsController) GetPath() string {
+	return "/operations"
+}
+
+func (c OperationsController) getOperationsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the operations")
+
+	writeErr := writeResponse(writer, c.Operations.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c OperationsController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the operations")
+
+	c.Operations.Reset()
+	writeSuccessResponse(writer)
+}
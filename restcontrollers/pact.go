@@ -0,0 +1,73 @@
+package restcontrollers
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+const (
+	pactSourceStubs   = "stubs"
+	pactSourceJournal = "journal"
+
+	defaultPactConsumer = "consumer"
+	defaultPactProvider = "provider"
+)
+
+type PactController struct {
+	StubsStore stub.StubsStore
+	Journal    stub.Journal
+}
+
+func (c PactController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetPact",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getPactHandler,
+		},
+	}
+}
+
+func (c PactController) GetPath() string {
+	return "/pact"
+}
+
+// getPactHandler returns the Pact contract with the interactions of the stubs or, with ?source=journal, of the calls
+// recorded in the journal. The names of the participants are given by ?consumer= and ?provider=.
+func (c PactController) getPactHandler(writer http.ResponseWriter, request *http.Request) {
+	source := getQueryParam(request, "source")
+	if source == "" {
+		source = pactSourceStubs
+	}
+	log.WithFields(log.Fields{"source": source}).Info("REST: received call to get the pact")
+
+	consumer := getQueryParam(request, "consumer")
+	if consumer == "" {
+		consumer = defaultPactConsumer
+	}
+	provider := getQueryParam(request, "provider")
+	if provider == "" {
+		provider = defaultPactProvider
+	}
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	pact := stub.NewPact(consumer, provider)
+	switch source {
+	case pactSourceStubs:
+		pact.AddStubs(stubs)
+	case pactSourceJournal:
+		pact.AddJournal(c.Journal.GetAll(), stubs)
+	default:
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("source can only be either '%s' or '%s'", pactSourceStubs, pactSourceJournal))
+		return
+	}
+	if writeErr := writeResponse(writer, pact); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
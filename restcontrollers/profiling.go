@@ -0,0 +1,55 @@
+package restcontrollers
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// ProfilingController exposes the runtime profiling data in the format expected by the pprof visualization tool.
+type ProfilingController struct{}
+
+func (c ProfilingController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "ProfilingIndex",
+			Path:    "/",
+			Methods: []string{http.MethodGet},
+			Handler: pprof.Index,
+		},
+		{
+			Name:    "ProfilingCmdline",
+			Path:    "/cmdline",
+			Methods: []string{http.MethodGet},
+			Handler: pprof.Cmdline,
+		},
+		{
+			Name:    "ProfilingProfile",
+			Path:    "/profile",
+			Methods: []string{http.MethodGet},
+			Handler: pprof.Profile,
+		},
+		{
+			Name:    "ProfilingSymbol",
+			Path:    "/symbol",
+			Methods: []string{http.MethodGet, http.MethodPost},
+			Handler: pprof.Symbol,
+		},
+		{
+			Name:    "ProfilingTrace",
+			Path:    "/trace",
+			Methods: []string{http.MethodGet},
+			Handler: pprof.Trace,
+		},
+		{
+			// Named profiles (heap, goroutine, block, ...) are served by the index handler
+			Name:    "ProfilingNamedProfile",
+			Path:    "/{profile}",
+			Methods: []string{http.MethodGet},
+			Handler: pprof.Index,
+		},
+	}
+}
+
+func (c ProfilingController) GetPath() string {
+	return "/debug/pprof"
+}
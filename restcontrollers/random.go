@@ -0,0 +1,58 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// RandomController resets the random values of the responses and faults, so that they are the same as when the
+// server started
+type RandomController struct {
+	Random *util.SeededRandom
+}
+
+type RandomStatus struct {
+	Seed int64 `json:"seed"`
+}
+
+func (c RandomController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetRandomSeed",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getSeedHandler,
+		},
+		{
+			Name:    "ResetRandom",
+			Path:    "/reset",
+			Methods: []string{http.MethodPost},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c RandomController) GetPath() string {
+	return "/random"
+}
+
+func (c RandomController) getSeedHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the random seed")
+
+	c.writeSeed(writer)
+}
+
+func (c RandomController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the random values")
+
+	c.Random.Reset()
+	c.writeSeed(writer)
+}
+
+func (c RandomController) writeSeed(writer http.ResponseWriter) {
+	writeErr := writeResponse(writer, RandomStatus{Seed: c.Random.Seed()})
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
@@ -0,0 +1,102 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+type ReplayController struct {
+	Service grpchandler.MockService
+	Journal stub.Journal
+	// Dial connects to the service the calls are fired against
+	Dial func(target string, useTLS bool) (*grpc.ClientConn, error)
+}
+
+type replayRequest struct {
+	// Target is the address of the service the calls are fired against
+	Target string `json:"target"`
+	TLS    bool   `json:"tls"`
+	// Script has the calls to fire. The calls in the journal selected by Methods, From and To are fired when it is
+	// not given.
+	Script  *stub.ReplayScript `json:"script"`
+	Methods []string           `json:"methods"`
+	From    int64              `json:"from"`
+	To      int64              `json:"to"`
+	// Rate is the number of calls started per second, 0 to keep the pace of the script
+	Rate        float64 `json:"rate"`
+	Concurrency int     `json:"concurrency"`
+	Iterations  int     `json:"iterations"`
+	// Timeout of each call, e.g. 5s
+	Timeout string `json:"timeout"`
+}
+
+func (c ReplayController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "Replay",
+			Path:    "",
+			Methods: []string{http.MethodPost},
+			Handler: c.replayHandler,
+		},
+	}
+}
+
+func (c ReplayController) GetPath() string {
+	return "/replay"
+}
+
+// replayHandler fires the calls of a replay script, or recorded in the journal, against a service and responds with
+// the report of the latencies once all the calls are finished
+func (c ReplayController) replayHandler(writer http.ResponseWriter, request *http.Request) {
+	replay := replayRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &replay)
+	}
+	if err == nil && replay.Target == "" {
+		err = fmt.Errorf("target is required")
+	}
+	var timeout time.Duration
+	if err == nil && replay.Timeout != "" {
+		timeout, err = time.ParseDuration(replay.Timeout)
+	}
+	if err == nil && (replay.Rate < 0 || replay.Concurrency < 0 || replay.Iterations < 0 || timeout < 0) {
+		err = fmt.Errorf("rate, concurrency, iterations and timeout can't be negative")
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to replay failed with error: %s", err.Error()))
+		return
+	}
+	script := replay.Script
+	if script == nil {
+		script = stub.NewReplayScript(c.Journal.GetAll(), stub.JournalFilter{Methods: replay.Methods, FromSeq: replay.From, ToSeq: replay.To})
+	}
+	log.WithFields(log.Fields{"target": replay.Target, "calls": len(script.Calls)}).Info("REST: received call to replay")
+
+	conn, err := c.Dial(replay.Target, replay.TLS)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadGateway, fmt.Sprintf("could not connect to %s: %s", replay.Target, err.Error()))
+		return
+	}
+	defer conn.Close()
+	report, err := grpchandler.Replay(request.Context(), conn, c.Service, script, grpchandler.ReplayOptions{
+		Rate:        replay.Rate,
+		Concurrency: replay.Concurrency,
+		Iterations:  replay.Iterations,
+		Timeout:     timeout,
+	})
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to replay failed with error: %s", err.Error()))
+		return
+	}
+	if writeErr := writeResponse(writer, report); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package restcontrollers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+const pathParamName = "name"
+
+type ScenariosController struct {
+	StubsStore     stub.StubsStore
+	ScenariosStore stub.ScenariosStore
+}
+
+type setScenarioStateRequest struct {
+	State string `json:"state"`
+}
+
+func (c ScenariosController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetScenarios",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getScenariosHandler,
+		},
+		{
+			Name:    "GetScenario",
+			Path:    "/{name}",
+			Methods: []string{http.MethodGet},
+			Handler: c.getScenarioHandler,
+		},
+		{
+			Name:    "SetScenarioState",
+			Path:    "/{name}/state",
+			Methods: []string{http.MethodPut},
+			Handler: c.setScenarioStateHandler,
+		},
+	}
+}
+
+func (c ScenariosController) GetPath() string {
+	return "/scenarios"
+}
+
+func (c ScenariosController) getScenariosHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get scenarios")
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writeErr := writeResponse(writer, stub.GetScenarios(stubs, c.ScenariosStore))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c ScenariosController) getScenarioHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	log.Infof("REST: received call to get scenario %s", name)
+
+	scenario, err := c.findScenario(request.Context(), name)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	if scenario == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Scenario not found")
+		return
+	}
+	writeErr := writeResponse(writer, scenario)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c ScenariosController) setScenarioStateHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	stateRequest := setScenarioStateRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &stateRequest)
+	}
+	if err == nil && stateRequest.State == emptyString {
+		err = fmt.Errorf("state can't be empty")
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set scenario state failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{"state": stateRequest.State}).
+		Infof("REST: received call to set the state of scenario %s", name)
+
+	c.ScenariosStore.SetState(name, stateRequest.State)
+	scenario, err := c.findScenario(request.Context(), name)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writeErr := writeResponse(writer, scenario)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c ScenariosController) findScenario(ctx context.Context, name string) (*stub.Scenario, error) {
+	stubs, err := c.StubsStore.GetAllStubs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, scenario := range stub.GetScenarios(stubs, c.ScenariosStore) {
+		if scenario.Name == name {
+			return scenario, nil
+		}
+	}
+	return nil, nil
+}
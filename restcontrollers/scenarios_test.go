@@ -0,0 +1,53 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScenariosController_SetState(t *testing.T) {
+	controller := ScenariosController{
+		StubsStore:     stub.NewInMemoryStubsStore(),
+		ScenariosStore: stub.NewInMemoryScenariosStore(),
+	}
+
+	request := httptest.NewRequest(http.MethodPut, "/scenarios/checkout/state", strings.NewReader(`{"state":"paid"}`))
+	request = mux.SetURLVars(request, map[string]string{pathParamName: "checkout"})
+	recorder := httptest.NewRecorder()
+	controller.setScenarioStateHandler(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "paid", controller.ScenariosStore.GetState("checkout"))
+
+	request = httptest.NewRequest(http.MethodGet, "/scenarios/checkout", nil)
+	request = mux.SetURLVars(request, map[string]string{pathParamName: "checkout"})
+	recorder = httptest.NewRecorder()
+	controller.getScenarioHandler(recorder, request)
+	scenario := stub.Scenario{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &scenario))
+	assert.Equal(t, "paid", scenario.State)
+
+	request = httptest.NewRequest(http.MethodGet, "/scenarios/unknown", nil)
+	request = mux.SetURLVars(request, map[string]string{pathParamName: "unknown"})
+	recorder = httptest.NewRecorder()
+	controller.getScenarioHandler(recorder, request)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestScenariosController_SetState_Invalid(t *testing.T) {
+	controller := ScenariosController{
+		StubsStore:     stub.NewInMemoryStubsStore(),
+		ScenariosStore: stub.NewInMemoryScenariosStore(),
+	}
+
+	request := httptest.NewRequest(http.MethodPut, "/scenarios/checkout/state", strings.NewReader(`{}`))
+	request = mux.SetURLVars(request, map[string]string{pathParamName: "checkout"})
+	recorder := httptest.NewRecorder()
+	controller.setScenarioStateHandler(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
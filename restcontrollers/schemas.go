@@ -0,0 +1,51 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+)
+
+// SchemasController serves the JSON Schema of the stub files, so that the editors can autocomplete and validate the
+// stubs written in any language
+type SchemasController struct {
+	Service grpchandler.MockService
+}
+
+func (c SchemasController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetStubsSchema",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStubsSchemaHandler,
+		},
+	}
+}
+
+func (c SchemasController) GetPath() string {
+	return "/schemas"
+}
+
+// getStubsSchemaHandler returns the schema of the stub files, with the content of the stubs described by the messages
+// of the methods of the services
+func (c SchemasController) getStubsSchemaHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the schema of the stubs")
+
+	methods := make([]stub.MethodMessages, 0)
+	for _, fullMethod := range c.Service.GetSupportedMethods() {
+		method := stub.MethodMessages{FullMethod: fullMethod}
+		if requestMessage, ok := c.Service.GetRequestInstance(fullMethod).(proto.Message); ok {
+			method.Request = requestMessage.ProtoReflect().Descriptor()
+		}
+		if responseMessage, ok := c.Service.GetResponseInstance(fullMethod).(proto.Message); ok {
+			method.Response = responseMessage.ProtoReflect().Descriptor()
+		}
+		methods = append(methods, method)
+	}
+	if writeErr := writeResponse(writer, stub.NewStubsSchema(methods)); writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
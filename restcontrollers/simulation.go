@@ -0,0 +1,49 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// SimulationController inspects and resets the resources of the services simulated
+type SimulationController struct {
+	Simulation *grpchandler.Simulation
+}
+
+func (c SimulationController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetSimulation",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getSimulationHandler,
+		},
+		{
+			Name:    "ResetSimulation",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c SimulationController) GetPath() string {
+	return "/simulation"
+}
+
+func (c SimulationController) getSimulationHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the simulated resources")
+
+	writeErr := writeResponse(writer, c.Simulation.GetStatus())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c SimulationController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the simulated resources")
+
+	c.Simulation.Reset()
+	writeSuccessResponse(writer)
+}
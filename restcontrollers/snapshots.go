@@ -0,0 +1,146 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+type SnapshotsController struct {
+	StubsStore     stub.StubsStore
+	SnapshotsStore stub.SnapshotsStore
+	AuditLog       stub.AuditLog
+}
+
+type createSnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+func (c SnapshotsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetSnapshots",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getSnapshotsHandler,
+		},
+		{
+			Name:    "CreateSnapshot",
+			Path:    "",
+			Methods: []string{http.MethodPost},
+			Handler: c.createSnapshotHandler,
+		},
+		{
+			Name:    "GetSnapshot",
+			Path:    "/{id}",
+			Methods: []string{http.MethodGet},
+			Handler: c.getSnapshotHandler,
+		},
+		{
+			Name:    "DeleteSnapshot",
+			Path:    "/{id}",
+			Methods: []string{http.MethodDelete},
+			Handler: c.deleteSnapshotHandler,
+		},
+		{
+			Name:    "RestoreSnapshot",
+			Path:    "/{id}/restore",
+			Methods: []string{http.MethodPost},
+			Handler: c.restoreSnapshotHandler,
+		},
+	}
+}
+
+func (c SnapshotsController) GetPath() string {
+	return "/snapshots"
+}
+
+func (c SnapshotsController) getSnapshotsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get snapshots")
+
+	summaries := make([]stub.Snapshot, 0)
+	for _, snapshot := range c.SnapshotsStore.GetAll() {
+		summary := *snapshot
+		summary.Stubs = nil
+		summaries = append(summaries, summary)
+	}
+	writeErr := writeResponse(writer, summaries)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c SnapshotsController) createSnapshotHandler(writer http.ResponseWriter, request *http.Request) {
+	createRequest := createSnapshotRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil && len(bodyData) > 0 {
+		err = json.Unmarshal(bodyData, &createRequest)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to create snapshot failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{"name": createRequest.Name}).
+		Info("REST: received call to create snapshot")
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	snapshot := c.SnapshotsStore.Create(createRequest.Name, getActor(request), stubs)
+	summary := *snapshot
+	summary.Stubs = nil
+	writeErr := writeResponse(writer, summary)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c SnapshotsController) getSnapshotHandler(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[pathParamID]
+	log.Infof("REST: received call to get snapshot %s", id)
+
+	snapshot := c.SnapshotsStore.Get(id)
+	if snapshot == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+	writeErr := writeResponse(writer, snapshot)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c SnapshotsController) deleteSnapshotHandler(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[pathParamID]
+	log.Infof("REST: received call to delete snapshot %s", id)
+
+	if err := c.SnapshotsStore.Delete(id); err != nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+	writeSuccessResponse(writer)
+}
+
+func (c SnapshotsController) restoreSnapshotHandler(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[pathParamID]
+	log.Infof("REST: received call to restore snapshot %s", id)
+
+	snapshot := c.SnapshotsStore.Get(id)
+	if snapshot == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Snapshot not found")
+		return
+	}
+	previous, err := snapshot.Restore(request.Context(), c.StubsStore)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	recordReplace(c.AuditLog, getActor(request), previous, snapshot.Stubs)
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,116 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+const pathParamScope = "scope"
+
+// StateController inspects, seeds and resets the values shared by the responses
+type StateController struct {
+	StateStore stub.StateStore
+}
+
+func (c StateController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetState",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStateHandler,
+		},
+		{
+			Name:    "ResetState",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetStateHandler,
+		},
+		{
+			Name:    "GetStateScope",
+			Path:    "/{scope}",
+			Methods: []string{http.MethodGet},
+			Handler: c.getScopeHandler,
+		},
+		{
+			Name:    "SetStateScope",
+			Path:    "/{scope}",
+			Methods: []string{http.MethodPut},
+			Handler: c.setScopeHandler,
+		},
+		{
+			Name:    "ResetStateScope",
+			Path:    "/{scope}",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetScopeHandler,
+		},
+	}
+}
+
+func (c StateController) GetPath() string {
+	return "/state"
+}
+
+func (c StateController) getStateHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the state")
+
+	writeErr := writeResponse(writer, c.StateStore.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c StateController) resetStateHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the state")
+
+	c.StateStore.Reset()
+	writeSuccessResponse(writer)
+}
+
+func (c StateController) getScopeHandler(writer http.ResponseWriter, request *http.Request) {
+	scope := mux.Vars(request)[pathParamScope]
+	log.Infof("REST: received call to get the state of %s", scope)
+
+	c.writeScope(writer, scope)
+}
+
+// setScopeHandler sets the values of the object in the body, keeping the other values of the scope
+func (c StateController) setScopeHandler(writer http.ResponseWriter, request *http.Request) {
+	scope := mux.Vars(request)[pathParamScope]
+	values := make(map[string]interface{})
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &values)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set the state failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{"values": string(bodyData)}).
+		Infof("REST: received call to set the state of %s", scope)
+
+	for key, value := range values {
+		c.StateStore.Set(scope, key, value)
+	}
+	c.writeScope(writer, scope)
+}
+
+func (c StateController) resetScopeHandler(writer http.ResponseWriter, request *http.Request) {
+	scope := mux.Vars(request)[pathParamScope]
+	log.Infof("REST: received call to reset the state of %s", scope)
+
+	c.StateStore.ResetScope(scope)
+	writeSuccessResponse(writer)
+}
+
+func (c StateController) writeScope(writer http.ResponseWriter, scope string) {
+	writeErr := writeResponse(writer, c.StateStore.GetScope(scope))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
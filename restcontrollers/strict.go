@@ -0,0 +1,48 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+type StrictController struct {
+	StrictMode *grpchandler.StrictMode
+}
+
+func (c StrictController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetStrictMode",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStrictModeHandler,
+		},
+		{
+			Name:    "ResetUnexpectedCalls",
+			Path:    "/reset",
+			Methods: []string{http.MethodPost},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c StrictController) GetPath() string {
+	return "/strict"
+}
+
+func (c StrictController) getStrictModeHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the strict mode status")
+
+	writeErr := writeResponse(writer, c.StrictMode.GetStatus())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c StrictController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the unexpected calls of the strict mode")
+
+	c.StrictMode.Reset()
+	writeSuccessResponse(writer)
+}
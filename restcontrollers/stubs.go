@@ -1,30 +1,52 @@
 package restcontrollers
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 const (
 	contentType                = "Content-Type"
 	contentTypeApplicationJson = "application/json"
 	requestParamMethod         = "method"
+	pathParamID                = "id"
+	queryParamReplace          = "replace"
+	queryParamAll              = "all"
+	queryParamLabel            = "label"
+	queryParamOffset           = "offset"
+	queryParamLimit            = "limit"
+	headerTotalCount           = "X-Total-Count"
 	emptyString                = ""
 )
 
+// deleteStubsResponse has the number of stubs deleted, in total and by method
+type deleteStubsResponse struct {
+	Deleted int            `json:"deleted"`
+	Methods map[string]int `json:"methods"`
+}
+
 type StubsController struct {
 	StubsStore   stub.StubsStore
 	StubExamples []stub.Stub
 	Service      grpchandler.MockService
+	AuditLog     stub.AuditLog
+	Trash        stub.Trash
+	// IdempotencyKeys makes POST /stubs idempotent for the calls with an Idempotency-Key header, when set
+	IdempotencyKeys *IdempotencyKeys
 }
 
 func (c StubsController) GetHandlers() []RESTHandler {
@@ -53,6 +75,60 @@ func (c StubsController) GetHandlers() []RESTHandler {
 			Methods: []string{http.MethodDelete},
 			Handler: c.deleteStubsHandler,
 		},
+		{
+			Name:    "GetStubHistory",
+			Path:    "/{id}/history",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStubHistoryHandler,
+		},
+		{
+			Name:    "DiffStubs",
+			Path:    "/diff",
+			Methods: []string{http.MethodPost},
+			Handler: c.diffStubsHandler,
+		},
+		{
+			Name:    "GetDuplicateStubs",
+			Path:    "/duplicates",
+			Methods: []string{http.MethodGet},
+			Handler: c.getDuplicatesHandler,
+		},
+		{
+			Name:    "GetStubsStats",
+			Path:    "/stats",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStatsHandler,
+		},
+		{
+			Name:    "GetTrashedStubs",
+			Path:    "/trash",
+			Methods: []string{http.MethodGet},
+			Handler: c.getTrashHandler,
+		},
+		{
+			Name:    "EmptyTrash",
+			Path:    "/trash",
+			Methods: []string{http.MethodDelete},
+			Handler: c.emptyTrashHandler,
+		},
+		{
+			Name:    "RestoreTrashedStub",
+			Path:    "/trash/{id}/restore",
+			Methods: []string{http.MethodPost},
+			Handler: c.restoreTrashedStubHandler,
+		},
+		{
+			Name:    "ImportStubs",
+			Path:    "/import",
+			Methods: []string{http.MethodPost},
+			Handler: c.importStubsHandler,
+		},
+		{
+			Name:    "ImportOpenAPIStubs",
+			Path:    "/import/openapi",
+			Methods: []string{http.MethodPost},
+			Handler: c.importOpenAPIStubsHandler,
+		},
 	}
 }
 
@@ -69,65 +145,106 @@ func (c StubsController) getStubsHandler(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	stubs := c.getStubsFromStore(method)
-	writeErr := writeResponse(writer, stubs)
-	if writeErr != nil {
-		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	query, err := parseStubsQuery(request)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to get stubs failed with error: %s", err.Error()))
+		return
+	}
+	page, err := c.StubsStore.Query(request.Context(), query)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writer.Header().Set(headerTotalCount, strconv.Itoa(page.Total))
+	writer.Header().Set(headerVary, headerAccept)
+	if writeNotModified(writer, request, stubsETag(request, page)) {
+		return
+	}
+	writeStubsResponse(writer, request, page.Stubs)
+}
+
+// stubsETag identifies the listing by the query, the format requested and the id and version of the stubs in it, as
+// every change to a stub gives it a new version.
+func stubsETag(request *http.Request, page *stub.StubsPage) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%d\n", request.URL.RawQuery, request.Header.Get(headerAccept), page.Total)
+	for _, s := range page.Stubs {
+		fmt.Fprintf(hash, "%s:%d\n", s.ID, s.Version)
 	}
+	return formatContentETag(hash)
 }
 
 func (c StubsController) addStubsHandler(writer http.ResponseWriter, request *http.Request) {
 	s, err := readStubFromRequestBody(request)
+	if err == nil {
+		s, err = c.resolveExtends(request.Context(), s)
+	}
 	if err != nil {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to add stubs failed with error: %s", err.Error()))
 		return
 	}
-	log.WithFields(log.Fields{"stub": toJSON(s)}).
+	log.WithFields(log.Fields{"stub": loggableStub(s)}).
 		Info("REST: received call to add stub")
 
 	if !c.isMethodSupported(s.FullMethod) {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Method %s is not supported", s.FullMethod))
 		return
 	}
+	if err := grpchandler.NormalizeStubContent(c.Service, s); err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if c.StubsStore.Exists(s) {
+	// Retries of the creation get the stub created, identified by the Idempotency-Key or the ID set by the client
+	idempotencyKey := request.Header.Get(headerIdempotencyKey)
+	createdID := s.ID
+	if idempotencyKey != emptyString && c.IdempotencyKeys != nil {
+		if creation, found := c.IdempotencyKeys.get(idempotencyKey); found {
+			if creation.fingerprint != s.Fingerprint() {
+				writeErrorResponse(writer, http.StatusUnprocessableEntity,
+					fmt.Sprintf("Idempotency-Key %s was used to create another stub", idempotencyKey))
+				return
+			}
+			createdID = creation.stubID
+		}
+	}
+	if existing, err := c.StubsStore.Get(request.Context(), s); err == nil {
+		if createdID != emptyString && existing.ID == createdID {
+			writeStoredStubResponse(writer, existing)
+			return
+		}
 		writeErrorResponse(writer, http.StatusConflict, "Stub already exists")
 		return
+	} else if !errors.Is(err, stub.ErrNotFound) {
+		writeStoreErrorResponse(writer, err)
+		return
 	}
+	fingerprint := s.Fingerprint()
 
 	if !c.isValid(writer, s) {
 		return
 	}
 
-	addErr := c.StubsStore.Add(s)
+	s.CreatedBy = getActor(request)
+	addErr := c.StubsStore.Add(request.Context(), s)
+	if errors.Is(addErr, stub.ErrConflict) {
+		writeErrorResponse(writer, http.StatusConflict, addErr.Error())
+		return
+	}
+	if errors.Is(addErr, stub.ErrLimitExceeded) {
+		writeStoreErrorResponse(writer, addErr)
+		return
+	}
 	if addErr != nil {
-		log.Errorf("Failed to add stub %s -> %s. Error %s", s.FullMethod, s.Request.String(), addErr.Error())
+		log.Errorf("Failed to add stub %s -> %s. Error %s", s.FullMethod, util.LoggablePayload(s.Request.String()), addErr.Error())
 		writeErrorResponse(writer, http.StatusInternalServerError, "Failed to add stub.")
 		return
 	}
-	writeSuccessResponse(writer)
-}
-
-// 1. Make sure the request and response can be marshalled to the respective proto.Messages by unmarshalling it to the respective type
-// 2. Marshal it back to JSON to remove extra spaces or formatting so that we can use this cleaned up JSON for comparison to check if the stub already exists
-func (c StubsController) cleanRequestResponse(s *stub.Stub) error {
-	marshaledRequest, errReqClean := cleanJson(s.Request.Content, c.Service.GetRequestInstance(s.FullMethod))
-	marhsalledResponse, errRespClean := cleanJson(s.Response.Content, c.Service.GetResponseInstance(s.FullMethod))
-	if errReqClean != nil {
-		return errReqClean
-	}
-	if errRespClean != nil {
-		return errRespClean
+	if idempotencyKey != emptyString && c.IdempotencyKeys != nil {
+		c.IdempotencyKeys.put(idempotencyKey, fingerprint, s.ID)
 	}
-	s.Request.Content = marshaledRequest
-	s.Response.Content = marhsalledResponse
-	return nil
-}
-
-func cleanJson(originalJson stub.JsonString, instance interface{}) (stub.JsonString, error) {
-	err := protojson.Unmarshal([]byte(originalJson), instance.(proto.Message))
-	bytes, err := protojson.Marshal(instance.(proto.Message))
-	return stub.JsonString(bytes), err
+	c.recordChange(request, stub.ChangeTypeCreate, nil, s)
+	writeStoredStubResponse(writer, s)
 }
 
 func (c StubsController) findExampleForMethod(method string) *stub.Stub {
@@ -141,75 +258,470 @@ func (c StubsController) findExampleForMethod(method string) *stub.Stub {
 
 func (c StubsController) updateStubsHandler(writer http.ResponseWriter, request *http.Request) {
 	s, err := readStubFromRequestBody(request)
+	if err == nil {
+		s, err = c.resolveExtends(request.Context(), s)
+	}
 	if err != nil {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to update stub failed with error: %s", err.Error()))
 		return
 	}
-	log.WithFields(log.Fields{"stub": toJSON(s)}).
+	log.WithFields(log.Fields{"stub": loggableStub(s)}).
 		Info("REST: received call to update stub")
 
+	ifMatch := request.Header.Get(headerIfMatch)
+	if ifMatch == emptyString {
+		writeErrorResponse(writer, http.StatusPreconditionRequired, "If-Match header is required to update a stub")
+		return
+	}
+	version, err := parseETag(ifMatch)
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to update stub failed with error: %s", err.Error()))
+		return
+	}
+
 	if !c.isMethodSupported(s.FullMethod) {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Method %s is not supported", s.FullMethod))
 		return
 	}
+	if err := grpchandler.NormalizeStubContent(c.Service, s); err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if !c.StubsStore.Exists(s) {
+	existing, err := c.StubsStore.Get(request.Context(), s)
+	if errors.Is(err, stub.ErrNotFound) {
 		writeErrorResponse(writer, http.StatusNotFound, "Stub not found")
 		return
 	}
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
 
 	if !c.isValid(writer, s) {
 		return
 	}
 
-	updateErr := c.StubsStore.Update(s)
+	s.Version = version
+	updateErr := c.StubsStore.Update(request.Context(), s)
+	if errors.Is(updateErr, stub.ErrVersionMismatch) {
+		writeErrorResponse(writer, http.StatusPreconditionFailed, "Stub was modified by another request")
+		return
+	}
+	if errors.Is(updateErr, stub.ErrNotFound) {
+		writeErrorResponse(writer, http.StatusNotFound, "Stub not found")
+		return
+	}
 	if updateErr != nil {
-		log.Errorf("Failed to update stub %s -> %s. Error %s", s.FullMethod, s.Request.String(), updateErr.Error())
+		log.Errorf("Failed to update stub %s -> %s. Error %s", s.FullMethod, util.LoggablePayload(s.Request.String()), updateErr.Error())
 		writeErrorResponse(writer, http.StatusInternalServerError, "Failed to update stub.")
 		return
 	}
-	writeSuccessResponse(writer)
+	c.recordChange(request, stub.ChangeTypeUpdate, existing, s)
+	writeStoredStubResponse(writer, s)
+}
+
+// writeStoredStubResponse writes the stub as stored, with its ID, normalized content and timestamps, and its version
+// in the ETag header
+func writeStoredStubResponse(writer http.ResponseWriter, s *stub.Stub) {
+	writer.Header().Set(headerETag, formatETag(s.Version))
+	writeErr := writeResponse(writer, s)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
 }
 
 func (c StubsController) deleteStubsHandler(writer http.ResponseWriter, request *http.Request) {
 	method := getQueryParam(request, requestParamMethod)
 	if method != emptyString && !c.isMethodSupported(method) {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Can't delete stubs. Unsupported method: %s", method))
+		return
 	}
 
-	stub, err := readStubFromRequestBody(request)
+	s, err := readStubFromRequestBody(request)
 	if err != nil {
 		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to delete stub failed with error: %s", err.Error()))
 		return
 	}
-	log.WithFields(log.Fields{"stub": toJSON(stub), "method": method}).
+	log.WithFields(log.Fields{"stub": loggableStub(s), "method": method}).
 		Info("REST: received call to delete stubs")
 
+	ctx := request.Context()
+	var deleted []*stub.Stub
 	switch {
 	case method != emptyString:
-		c.StubsStore.DeleteAllForMethod(method)
-	case stub != nil:
-		if !c.isMethodSupported(stub.FullMethod) {
-			writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Method %s is not supported", stub.FullMethod))
+		deleted, err = c.StubsStore.GetStubsForMethod(ctx, method)
+		if err == nil {
+			err = c.StubsStore.DeleteAllForMethod(ctx, method)
+		}
+		if err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+		c.recordDeletes(request, deleted)
+	case s != nil:
+		if !c.isMethodSupported(s.FullMethod) {
+			writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("Method %s is not supported", s.FullMethod))
 			return
 		}
 
-		if !c.StubsStore.Exists(stub) {
+		existing, err := c.StubsStore.Get(ctx, s)
+		if errors.Is(err, stub.ErrNotFound) {
 			writeErrorResponse(writer, http.StatusNotFound, "Stub not found")
 			return
 		}
-		deleteErr := c.StubsStore.Delete(stub)
+		if err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+		deleteErr := c.StubsStore.Delete(ctx, s)
 		if deleteErr != nil {
-			log.Errorf("Failed to delete stub %s -> %s. Error %s", stub.FullMethod, stub.Request.String(), deleteErr.Error())
+			log.Errorf("Failed to delete stub %s -> %s. Error %s", s.FullMethod, util.LoggablePayload(s.Request.String()), deleteErr.Error())
 			writeErrorResponse(writer, http.StatusInternalServerError, "Failed to delete stub.")
+			return
 		}
+		deleted = []*stub.Stub{existing}
+		c.recordDeletes(request, deleted)
+	case getQueryParam(request, queryParamAll) != "true":
+		writeErrorResponse(writer, http.StatusBadRequest,
+			"Can't delete stubs. Set a stub in the body, the method with ?method= or ?all=true to delete all the stubs")
+		return
 	default:
-		c.StubsStore.DeleteAll()
+		deleted, err = c.StubsStore.GetAllStubs(ctx)
+		if err == nil {
+			err = c.StubsStore.DeleteAll(ctx)
+		}
+		if err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+		c.recordDeletes(request, deleted)
 	}
 
+	counts := deleteStubsResponse{Deleted: len(deleted), Methods: make(map[string]int)}
+	for _, e := range deleted {
+		counts.Methods[e.FullMethod]++
+	}
+	writeErr := writeResponse(writer, counts)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c StubsController) getStubHistoryHandler(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[pathParamID]
+	log.Infof("REST: received call to get history of stub %s", id)
+
+	if c.AuditLog == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Stub history is not available")
+		return
+	}
+	history := c.AuditLog.GetForStub(id)
+	if len(history) == 0 {
+		writeErrorResponse(writer, http.StatusNotFound, fmt.Sprintf("No history found for stub %s", id))
+		return
+	}
+	writeErr := writeResponse(writer, history)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// getStatsHandler returns the number of stubs and the ones evicted or rejected due to the limits of the store
+func (c StubsController) getStatsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the stubs stats")
+
+	reporter, ok := c.StubsStore.(stub.StoreStatsReporter)
+	if !ok {
+		writeErrorResponse(writer, http.StatusNotFound, "Stubs stats are not available")
+		return
+	}
+	writeErr := writeResponse(writer, reporter.GetStats(request.Context()))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c StubsController) getTrashHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the trashed stubs")
+
+	if c.Trash == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Stubs trash is not available")
+		return
+	}
+	writeErr := writeResponse(writer, c.Trash.GetAll())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c StubsController) emptyTrashHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to empty the stubs trash")
+
+	if c.Trash == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Stubs trash is not available")
+		return
+	}
+	c.Trash.Empty()
 	writeSuccessResponse(writer)
 }
 
+// restoreTrashedStubHandler adds a stub deleted back with its ID and removes it from the trash. It fails with 409 when
+// another stub was added for the same request in the meantime.
+func (c StubsController) restoreTrashedStubHandler(writer http.ResponseWriter, request *http.Request) {
+	id := mux.Vars(request)[pathParamID]
+	log.Infof("REST: received call to restore trashed stub %s", id)
+
+	if c.Trash == nil {
+		writeErrorResponse(writer, http.StatusNotFound, "Stubs trash is not available")
+		return
+	}
+	trashed := c.Trash.Get(id)
+	if trashed == nil {
+		writeErrorResponse(writer, http.StatusNotFound, fmt.Sprintf("Stub %s is not in the trash", id))
+		return
+	}
+	restored, err := trashed.Restore(request.Context(), c.StubsStore)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	c.Trash.Remove(id)
+	c.recordChange(request, stub.ChangeTypeCreate, nil, restored)
+	writeErr := writeResponse(writer, restored)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// importStubsHandler adds the stubs in the body (a single stub or an array of stubs), or in the files uploaded as
+// multipart/form-data (see readUploadedStubs), at once. All the stubs are validated first and none is added when any
+// of them is not valid. With ?replace=true the stubs that are not imported are removed. With ?dedupe=true the stubs
+// that match the same requests with the same response are merged before they are imported (see stub.Dedupe).
+func (c StubsController) importStubsHandler(writer http.ResponseWriter, request *http.Request) {
+	var stubs []*stub.Stub
+	var err error
+	if isMultipartUpload(request) {
+		stubs, err = readUploadedStubs(request)
+	} else {
+		var bodyData []byte
+		bodyData, err = ioutil.ReadAll(request.Body)
+		if err == nil {
+			stubs, err = stub.ParseStubs(bodyData)
+		}
+	}
+	var existing []*stub.Stub
+	if err == nil {
+		existing, err = c.StubsStore.GetAllStubs(request.Context())
+		if err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+		stubs, err = resolveStubSetWith(stubs, existing)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to import stubs failed with error: %s", err.Error()))
+		return
+	}
+	replace := getQueryParam(request, queryParamReplace) == "true"
+	dedupe := getQueryParam(request, queryParamDedupe) == "true"
+	log.WithFields(log.Fields{"stubs": len(stubs), "replace": replace, "dedupe": dedupe}).
+		Info("REST: received call to import stubs")
+
+	result := c.importStubs(writer, request, stubs, replace, dedupe)
+	if result == nil {
+		return
+	}
+	writeErr := writeResponse(writer, result)
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// openAPIImportResult is the result of the import of the examples of an OpenAPI document, with the examples that
+// couldn't be converted to stubs
+type openAPIImportResult struct {
+	*stub.ImportResult
+	Warnings []string `json:"warnings"`
+}
+
+// importOpenAPIStubsHandler adds the stubs made of the examples of the OpenAPI document (JSON or YAML) in the body,
+// for the methods mapped to the operations with the google.api.http option of grpc-gateway (see stub.OpenAPIStubs).
+// The stubs are imported at once as with importStubsHandler, including ?replace=true and ?dedupe=true.
+func (c StubsController) importOpenAPIStubsHandler(writer http.ResponseWriter, request *http.Request) {
+	var examples []stub.OpenAPIExample
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		examples, err = stub.ParseOpenAPIExamples(bodyData)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to import OpenAPI stubs failed with error: %s", err.Error()))
+		return
+	}
+	stubs, warnings := stub.OpenAPIStubs(examples, protoregistry.GlobalFiles, c.Service.GetSupportedMethods())
+	replace := getQueryParam(request, queryParamReplace) == "true"
+	dedupe := getQueryParam(request, queryParamDedupe) == "true"
+	log.WithFields(log.Fields{"examples": len(examples), "stubs": len(stubs), "replace": replace, "dedupe": dedupe}).
+		Info("REST: received call to import OpenAPI stubs")
+	for _, warning := range warnings {
+		log.Warnf("OpenAPI %s", warning)
+	}
+
+	result := c.importStubs(writer, request, stubs, replace, dedupe)
+	if result == nil {
+		return
+	}
+	writeErr := writeResponse(writer, openAPIImportResult{ImportResult: result, Warnings: warnings})
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// importStubs validates, dedupes if asked and imports the stubs. It writes the error response and returns nil when they
+// can't be imported.
+func (c StubsController) importStubs(writer http.ResponseWriter, request *http.Request, stubs []*stub.Stub, replace, dedupe bool) *stub.ImportResult {
+	if errorMessages := c.validateImport(stubs); len(errorMessages) > 0 {
+		writeErrorResponse(writer, http.StatusBadRequest, strings.Join(errorMessages, ", "))
+		return nil
+	}
+	var merged []*stub.Stub
+	if dedupe {
+		// After the validation, so that the contents are normalized when they are compared
+		stubs, merged = stub.Dedupe(stubs)
+		if len(merged) > 0 {
+			log.Infof("Merged %d duplicate stubs of the import", len(merged))
+		}
+	}
+	actor := getActor(request)
+	result, err := stub.Import(request.Context(), c.StubsStore, stubs, actor, replace)
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return nil
+	}
+	result.Merged = len(merged)
+	recordReplace(c.AuditLog, actor, result.Previous, result.Current)
+	return result
+}
+
+// validateImport checks the stubs to import the same way as the stubs added one by one and returns the problems of
+// all of them
+func (c StubsController) validateImport(stubs []*stub.Stub) []string {
+	errorMessages := make([]string, 0)
+	for i, s := range stubs {
+		if !c.isMethodSupported(s.FullMethod) {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: method %s is not supported", i, s.FullMethod))
+			continue
+		}
+		if err := grpchandler.NormalizeStubContent(c.Service, s); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: %s", i, err.Error()))
+			continue
+		}
+		if isValid, stubErrors := c.isStubValid(s); !isValid {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: %s", i, strings.Join(stubErrors, ", ")))
+			continue
+		}
+		if err := c.checkResponse(s); err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("stub %d: %s", i, err.Error()))
+		}
+	}
+	return errorMessages
+}
+
+// getDuplicatesHandler returns the groups of stubs in the store that match the same requests
+func (c StubsController) getDuplicatesHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get duplicate stubs")
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writeErr := writeResponse(writer, stub.FindDuplicates(stubs))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+type diffStubsRequest struct {
+	// From is the set of stubs compared. The stubs in the store are used when it is not provided.
+	From *[]*stub.Stub `json:"from"`
+	To   []*stub.Stub  `json:"to"`
+}
+
+// diffStubsHandler compares two sets of stubs, or the stubs in the store with a set, e.g. to find the differences
+// between the mocks of two environments
+func (c StubsController) diffStubsHandler(writer http.ResponseWriter, request *http.Request) {
+	diffRequest := diffStubsRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &diffRequest)
+	}
+	var from, to []*stub.Stub
+	if err == nil && diffRequest.From != nil {
+		from, err = resolveStubSet(*diffRequest.From)
+	}
+	if err == nil {
+		to, err = resolveStubSet(diffRequest.To)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to diff stubs failed with error: %s", err.Error()))
+		return
+	}
+	if diffRequest.From == nil {
+		if from, err = c.StubsStore.GetAllStubs(request.Context()); err != nil {
+			writeStoreErrorResponse(writer, err)
+			return
+		}
+	}
+	log.WithFields(log.Fields{"from": len(from), "to": len(to)}).Info("REST: received call to diff stubs")
+
+	writeErr := writeResponse(writer, stub.DiffStubSets(from, to))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// resolveStubSet resolves the stubs of a set that extend other stubs, which must come before them in the set
+func resolveStubSet(stubs []*stub.Stub) ([]*stub.Stub, error) {
+	return resolveStubSetWith(stubs, nil)
+}
+
+// resolveStubSetWith resolves the stubs of a set that extend other stubs, which can be the existing stubs or the
+// stubs that come before them in the set
+func resolveStubSetWith(stubs []*stub.Stub, existing []*stub.Stub) ([]*stub.Stub, error) {
+	candidates := append([]*stub.Stub(nil), existing...)
+	resolved := make([]*stub.Stub, 0, len(stubs))
+	for _, s := range stubs {
+		if s == nil {
+			return nil, errors.New("the stubs can't be null")
+		}
+		r, err := stub.ResolveExtends(s, candidates)
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, r)
+		candidates = append(candidates, r)
+	}
+	return resolved, nil
+}
+
+func (c StubsController) recordChange(request *http.Request, changeType string, before, after *stub.Stub) {
+	if c.AuditLog == nil {
+		return
+	}
+	c.AuditLog.Record(getActor(request), changeType, before, after)
+}
+
+// recordDeletes records the deletes in the audit log and moves the stubs deleted to the trash
+func (c StubsController) recordDeletes(request *http.Request, deleted []*stub.Stub) {
+	for _, s := range deleted {
+		c.recordChange(request, stub.ChangeTypeDelete, s, nil)
+	}
+	if c.Trash != nil && len(deleted) > 0 {
+		c.Trash.Put(getActor(request), deleted)
+	}
+}
+
 func (c StubsController) isMethodSupported(method string) bool {
 	for _, supportedMethod := range c.Service.GetSupportedMethods() {
 		if supportedMethod == method {
@@ -219,12 +731,41 @@ func (c StubsController) isMethodSupported(method string) bool {
 	return false
 }
 
-func (c StubsController) getStubsFromStore(method string) []*stub.Stub {
-	if method == emptyString {
-		return c.StubsStore.GetAllStubs()
+// parseStubsQuery reads the query of the stubs from the parameters of the request: ?method=, ?label=name:value (can be
+// repeated), ?offset= and ?limit=
+func parseStubsQuery(request *http.Request) (stub.StubsQuery, error) {
+	query := stub.StubsQuery{FullMethod: getQueryParam(request, requestParamMethod)}
+	for _, label := range request.URL.Query()[queryParamLabel] {
+		parts := strings.SplitN(label, ":", 2)
+		if len(parts) != 2 || parts[0] == emptyString {
+			return query, fmt.Errorf("invalid label %s, expected name:value", label)
+		}
+		if query.Labels == nil {
+			query.Labels = make(map[string]string, 0)
+		}
+		query.Labels[parts[0]] = parts[1]
 	}
+	var err error
+	for param, value := range map[string]*int{queryParamOffset: &query.Offset, queryParamLimit: &query.Limit} {
+		if raw := getQueryParam(request, param); raw != emptyString {
+			if *value, err = strconv.Atoi(raw); err != nil || *value < 0 {
+				return query, fmt.Errorf("invalid %s %s", param, raw)
+			}
+		}
+	}
+	return query, nil
+}
 
-	return c.StubsStore.GetStubsForMethod(method)
+// resolveExtends resolves the stub against the stubs in the store
+func (c StubsController) resolveExtends(ctx context.Context, s *stub.Stub) (*stub.Stub, error) {
+	if s == nil || s.Extends == emptyString {
+		return s, nil
+	}
+	stubs, err := c.StubsStore.GetAllStubs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return stub.ResolveExtends(s, stubs)
 }
 
 func (c StubsController) isStubValid(stub *stub.Stub) (isValid bool, errorMessages []string) {
@@ -261,6 +802,18 @@ func toJSON(p interface{}) string {
 	return string(str)
 }
 
+// loggableStub returns the stub as it must be written to the logs. Only the method is logged when payload logging
+// is disabled.
+func loggableStub(s *stub.Stub) string {
+	if s == nil {
+		return "null"
+	}
+	if !util.IsPayloadLoggingEnabled() {
+		return s.FullMethod
+	}
+	return util.LoggablePayload(toJSON(s))
+}
+
 func (c StubsController) isValid(writer http.ResponseWriter, s *stub.Stub) bool {
 	isValid, errorMessages := c.isStubValid(s)
 	if !isValid {
@@ -272,31 +825,37 @@ func (c StubsController) isValid(writer http.ResponseWriter, s *stub.Stub) bool
 		return false
 	}
 
-	errCleaning := c.cleanRequestResponse(s)
-	if errCleaning != nil {
-		log.Errorf("Error validating request / response", errCleaning)
-		writeErrorResponse(writer, http.StatusInternalServerError, "Failed to update stub.")
+	if err := c.checkResponse(s); err != nil {
+		log.Errorf("Error validating creation of response instance: %s", err)
+		writeErrorResponse(writer, http.StatusBadRequest, "Error validating creation of response instance.")
 		return false
 	}
 
-	instance, createResponseErr := stub.GetResponse(s, string(s.Request.Content), c.Service.GetResponseInstance(s.FullMethod))
-	fmt.Println(instance, createResponseErr)
+	return true
+}
+
+// checkResponse creates the response of the stub to check that it is the one expected: a response for the success
+// stubs or the error of the error stubs
+func (c StubsController) checkResponse(s *stub.Stub) error {
+	var instance interface{}
+	var createResponseErr error
+	ctx := stub.WithReadOnlyState(context.Background())
+	if len(s.Response.Stream) > 0 {
+		_, createResponseErr = stub.GetStreamResponse(ctx, s, string(s.Request.Content), func() interface{} {
+			return c.Service.GetResponseInstance(s.FullMethod)
+		})
+	} else {
+		instance, createResponseErr = stub.GetResponse(ctx, s, string(s.Request.Content), c.Service.GetResponseInstance(s.FullMethod))
+	}
 	switch s.Response.Type {
 	case "success":
-		if createResponseErr != nil {
-			log.Errorf("Error validating creation of response instance: %s", createResponseErr)
-			writeErrorResponse(writer, http.StatusBadRequest, "Error validating creation of response instance.")
-			return false
-		}
+		return createResponseErr
 	case "error":
 		st := status.Convert(createResponseErr)
-		fmt.Println(st.Code(), st.Message(), codes.Code(s.Response.Error.Code), s.Response.Error.Message)
-		if instance != nil || st.Code() != codes.Code(s.Response.Error.Code) || st.Message() != s.Response.Error.Message {
-			log.Errorf("Error validating creation of response instance: %s", createResponseErr)
-			writeErrorResponse(writer, http.StatusBadRequest, "Error validating creation of response instance.")
-			return false
+		messageMatches := st.Message() == s.Response.Error.Message || stub.HasPlaceholders(s.Response.Error.Message)
+		if instance != nil || st.Code() != s.Response.Error.Code.GRPCCode() || !messageMatches {
+			return fmt.Errorf("expected error %s '%s' but got %v", s.Response.Error.Code, s.Response.Error.Message, createResponseErr)
 		}
 	}
-
-	return true
+	return nil
 }
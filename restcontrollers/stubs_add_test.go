@@ -1,6 +1,7 @@
 package restcontrollers
 
 import (
+	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -12,8 +13,8 @@ import (
 func TestStubsController_addStubHandler(t *testing.T) {
 	stubsStore := stub.NewInMemoryStubsStore()
 	ctrl := StubsController{
-		StubsStore:       stubsStore,
-		SupportedMethods: []string{"method1"},
+		StubsStore: stubsStore,
+		Service:    testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	request := httptest.NewRequest(http.MethodPost, "/stubs", strings.NewReader(`{
@@ -24,37 +25,35 @@ func TestStubsController_addStubHandler(t *testing.T) {
     		"name":"Rodrigo"
     	},
     	"metadata": {
-    		"key1": "value1",
-    		"key2": "value2",
-    		"key3": 1
+    		"key1": ["value1"],
+    		"key2": ["value2", "value3"]
     	}
     },
     "response": {
     	"type": "success",
     	"content": {
     		"name":"Rodrigo de Carvalho"
-    	},
-    	"error": "an unfortunate error"
+    	}
     }
 }`))
 	findHandler(ctrl.GetHandlers(), "AddStub").Handler(response, request)
-	assert.Equal(t, 1, len(stubsStore.GetAllStubs()))
-	assert.Equal(t, "OK", response.Body.String())
+	assert.Equal(t, 1, len(allStubs(t, stubsStore)))
+	assert.Contains(t, response.Body.String(), fmt.Sprintf(`"id":"%s"`, allStubs(t, stubsStore)[0].ID))
 	assert.Equal(t, 200, response.Code)
 }
 
 func TestStubsController_addStubHandler_MethodNotSupportedError(t *testing.T) {
 	stubsStore := stub.NewInMemoryStubsStore()
 	ctrl := StubsController{
-		StubsStore:       stubsStore,
-		SupportedMethods: []string{"method1"},
+		StubsStore: stubsStore,
+		Service:    testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	request := httptest.NewRequest(http.MethodPost, "/stubs", strings.NewReader(`{
     "fullMethod": "NOT_SUPPORTED_METHOD"
 }`))
 	findHandler(ctrl.GetHandlers(), "AddStub").Handler(response, request)
-	assert.Equal(t, 0, len(stubsStore.GetAllStubs()))
+	assert.Equal(t, 0, len(allStubs(t, stubsStore)))
 	assert.Equal(t, "Method NOT_SUPPORTED_METHOD is not supported", response.Body.String())
 	assert.Equal(t, 400, response.Code)
 }
@@ -1,6 +1,7 @@
 package restcontrollers
 
 import (
+	"context"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -11,21 +12,20 @@ import (
 
 func TestStubsController_deleteStubHandler(t *testing.T) {
 	stubsStore := stub.NewInMemoryStubsStore()
-	stubsStore.Add(&stub.Stub{
+	stubsStore.Add(context.Background(), &stub.Stub{
 		FullMethod: "method1",
-		Request: stub.StubRequest{
+		Request: &stub.StubRequest{
 			Match:   "exact",
 			Content: "{\"name\":\"Rodrigo\"}",
 		},
-		Response: stub.StubResponse{
-			Type:    "sccess",
-			Content: "response1",
-			Error:   "error1",
+		Response: &stub.StubResponse{
+			Type:    "success",
+			Content: "{\"name\":\"Rodrigo de Carvalho\"}",
 		},
 	})
 	ctrl := StubsController{
-		StubsStore:       stubsStore,
-		SupportedMethods: []string{"method1"},
+		StubsStore: stubsStore,
+		Service:    testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	payload := `{
@@ -40,13 +40,12 @@ func TestStubsController_deleteStubHandler(t *testing.T) {
     	"type": "success",
     	"content": {
     		"name":"Rodrigo de Carvalho UPDATED"
-    	},
-    	"error": "an unfortunate error"
+    	}
     }
 }`
 	request := httptest.NewRequest(http.MethodDelete, "/stubs", strings.NewReader(payload))
 	findHandler(ctrl.GetHandlers(), "DeleteStub").Handler(response, request)
-	assert.Equal(t, 0, len(stubsStore.GetAllStubs()))
-	assert.Equal(t, "OK", response.Body.String())
+	assert.Equal(t, 0, len(allStubs(t, stubsStore)))
+	assert.JSONEq(t, `{"deleted":1,"methods":{"method1":1}}`, response.Body.String())
 	assert.Equal(t, 200, response.Code)
 }
@@ -0,0 +1,38 @@
+package restcontrollers
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStubsController_deleteAllStubs(t *testing.T) {
+	stubsStore := stub.NewInMemoryStubsStore()
+	stubsStore.Add(context.Background(), &stub.Stub{
+		FullMethod: "method1",
+		Request:    &stub.StubRequest{Match: "exact", Content: `{"name":"John"}`},
+		Response:   &stub.StubResponse{Type: "success", Content: "{}"},
+	})
+	ctrl := StubsController{StubsStore: stubsStore, Trash: stub.NewInMemoryTrash(time.Hour)}
+	deleteStubs := func(url string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		ctrl.deleteStubsHandler(response, httptest.NewRequest(http.MethodDelete, url, nil))
+		return response
+	}
+
+	response := deleteStubs("/stubs")
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	stubs, _ := stubsStore.GetAllStubs(context.Background())
+	assert.Equal(t, 1, len(stubs))
+
+	response = deleteStubs("/stubs?all=true")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"deleted":1,"methods":{"method1":1}}`, response.Body.String())
+	stubs, _ = stubsStore.GetAllStubs(context.Background())
+	assert.Empty(t, stubs)
+	assert.Equal(t, 1, len(ctrl.Trash.GetAll()))
+}
@@ -1,6 +1,8 @@
 package restcontrollers
 
 import (
+	"context"
+	"encoding/json"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -12,25 +14,24 @@ import (
 
 func TestStubsController_getStubsHandler(t *testing.T) {
 	stubsStore := stub.NewInMemoryStubsStore()
-	stubsStore.Add(&stub.Stub{
+	stubsStore.Add(context.Background(), &stub.Stub{
 		FullMethod: "method1",
-		Request: stub.StubRequest{
+		Request: &stub.StubRequest{
 			Match:   "exact",
-			Content: "request1",
-			Metadata: map[string]interface{}{
-				"key1": "value1",
-				"key2": 2,
+			Content: "{\"name\":\"Rodrigo\"}",
+			Metadata: map[string][]string{
+				"key1": {"value1"},
+				"key2": {"value2", "value3"},
 			},
 		},
-		Response: stub.StubResponse{
-			Type:    "sccess",
-			Content: "response1",
-			Error:   "error1",
+		Response: &stub.StubResponse{
+			Type:    "success",
+			Content: "{\"name\":\"Rodrigo de Carvalho\"}",
 		},
 	})
 	ctrl := StubsController{
-		StubsStore:       stubsStore,
-		SupportedMethods: []string{"method1"},
+		StubsStore: stubsStore,
+		Service:    testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	request := &http.Request{
@@ -38,15 +39,21 @@ func TestStubsController_getStubsHandler(t *testing.T) {
 		URL:    &url.URL{},
 	}
 	findHandler(ctrl.GetHandlers(), "GetStubs").Handler(response, request)
-	expectedBody := "[{\"fullMethod\":\"method1\",\"request\":{\"match\":\"exact\",\"content\":\"request1\",\"metadata\":{\"key1\":\"value1\",\"key2\":2}},\"response\":{\"type\":\"sccess\",\"content\":\"response1\",\"error\":\"error1\"}}]"
-	assert.Equal(t, expectedBody, response.Body.String())
+	var stubs []stub.Stub
+	assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &stubs))
+	assert.Equal(t, 1, len(stubs))
+	assert.Equal(t, "method1", stubs[0].FullMethod)
+	assert.Equal(t, "exact", stubs[0].Request.Match)
+	assert.Equal(t, `{"name":"Rodrigo"}`, string(stubs[0].Request.Content))
+	assert.Equal(t, map[string][]string{"key1": {"value1"}, "key2": {"value2", "value3"}}, stubs[0].Request.Metadata)
+	assert.Equal(t, `{"name":"Rodrigo de Carvalho"}`, string(stubs[0].Response.Content))
 	assert.Equal(t, 200, response.Code)
 	assert.Equal(t, "application/json", strings.Join(response.Header().Values("Content-Type"), ""))
 }
 
 func TestStubsController_getStubsHandler_MethodNotSupportedError(t *testing.T) {
 	ctrl := StubsController{
-		SupportedMethods: []string{"method1"},
+		Service: testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	request := &http.Request{
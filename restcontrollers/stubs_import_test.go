@@ -0,0 +1,39 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStubsController_importStubsHandler_Dedupe(t *testing.T) {
+	body := `[
+		{"fullMethod":"method1","request":{"match":"exact","content":{"name":"a"},"metadata":{"X-Tenant":["t1"]}},"response":{"type":"success","content":{"name":"b"}}},
+		{"fullMethod":"method1","description":"copy","request":{"match":"exact","content":{"name":"a"},"metadata":{"x-tenant":["t1"]}},"response":{"type":"success","content":{"name":"b"}}}
+	]`
+	importStubs := func(query string) (*httptest.ResponseRecorder, stub.StubsStore) {
+		stubsStore := stub.NewInMemoryStubsStore()
+		ctrl := StubsController{
+			StubsStore: stubsStore,
+			Service:    testMockService{methods: []string{"method1"}},
+		}
+		response := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/stubs/import"+query, strings.NewReader(body))
+		findHandler(ctrl.GetHandlers(), "ImportStubs").Handler(response, request)
+		return response, stubsStore
+	}
+
+	response, stubsStore := importStubs("")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Len(t, allStubs(t, stubsStore), 2)
+
+	response, stubsStore = importStubs("?dedupe=true")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.JSONEq(t, `{"added":1,"replaced":0,"removed":0,"merged":1}`, response.Body.String())
+	if stubs := allStubs(t, stubsStore); assert.Len(t, stubs, 1) {
+		assert.Equal(t, "", stubs[0].Description)
+	}
+}
@@ -1,12 +1,43 @@
 package restcontrollers
 
 import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
 	"net/http"
 	"strings"
 	"testing"
 )
 
+// testMockService is a mock service whose methods take and return free-form messages, which accept any JSON object
+type testMockService struct {
+	methods []string
+}
+
+func (s testMockService) Register(*grpc.Server) {}
+
+func (s testMockService) GetSupportedMethods() []string {
+	return s.methods
+}
+
+func (s testMockService) GetPayloadExamples() []stub.Stub {
+	return nil
+}
+
+func (s testMockService) GetRequestInstance(string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (s testMockService) GetResponseInstance(string) interface{} {
+	return new(structpb.Struct)
+}
+
+func (s testMockService) GetStubsValidator() stub.StubsValidator {
+	return stub.NewCompositeStubsValidator(nil)
+}
+
 func TestStubsController_GetPath_GetPath(t *testing.T) {
 	ctrl := StubsController{}
 
@@ -16,11 +47,20 @@ func TestStubsController_GetPath_GetPath(t *testing.T) {
 func TestStubsController_GetHandlers(t *testing.T) {
 	ctrl := StubsController{}
 
-	assert.Equal(t, 4, len(ctrl.GetHandlers()))
+	assert.Equal(t, 13, len(ctrl.GetHandlers()))
 	validateHandler(t, findHandler(ctrl.GetHandlers(), "GetStubs"), http.MethodGet)
 	validateHandler(t, findHandler(ctrl.GetHandlers(), "AddStub"), http.MethodPost)
 	validateHandler(t, findHandler(ctrl.GetHandlers(), "UpdateStub"), http.MethodPut)
 	validateHandler(t, findHandler(ctrl.GetHandlers(), "DeleteStub"), http.MethodDelete)
+	assert.Equal(t, "/{id}/history", findHandler(ctrl.GetHandlers(), "GetStubHistory").Path)
+	assert.Equal(t, "/diff", findHandler(ctrl.GetHandlers(), "DiffStubs").Path)
+	assert.Equal(t, "/duplicates", findHandler(ctrl.GetHandlers(), "GetDuplicateStubs").Path)
+	assert.Equal(t, "/import", findHandler(ctrl.GetHandlers(), "ImportStubs").Path)
+	assert.Equal(t, "/stats", findHandler(ctrl.GetHandlers(), "GetStubsStats").Path)
+	assert.Equal(t, "/trash", findHandler(ctrl.GetHandlers(), "GetTrashedStubs").Path)
+	assert.Equal(t, "/trash", findHandler(ctrl.GetHandlers(), "EmptyTrash").Path)
+	assert.Equal(t, "/trash/{id}/restore", findHandler(ctrl.GetHandlers(), "RestoreTrashedStub").Path)
+	assert.Equal(t, "/import/openapi", findHandler(ctrl.GetHandlers(), "ImportOpenAPIStubs").Path)
 }
 
 func validateHandler(t *testing.T, handler *RESTHandler, method string) {
@@ -38,3 +78,9 @@ func findHandler(handlers []RESTHandler, name string) *RESTHandler {
 	}
 	return nil
 }
+
+func allStubs(t *testing.T, store stub.StubsStore) []*stub.Stub {
+	stubs, err := store.GetAllStubs(context.Background())
+	assert.NoError(t, err)
+	return stubs
+}
@@ -1,6 +1,8 @@
 package restcontrollers
 
 import (
+	"context"
+	"fmt"
 	"github.com/carvalhorr/protoc-gen-mock/stub"
 	"github.com/stretchr/testify/assert"
 	"net/http"
@@ -11,21 +13,20 @@ import (
 
 func TestStubsController_updateStubHandler(t *testing.T) {
 	stubsStore := stub.NewInMemoryStubsStore()
-	stubsStore.Add(&stub.Stub{
+	stubsStore.Add(context.Background(), &stub.Stub{
 		FullMethod: "method1",
-		Request: stub.StubRequest{
+		Request: &stub.StubRequest{
 			Match:   "exact",
 			Content: "{\"name\":\"Rodrigo\"}",
 		},
-		Response: stub.StubResponse{
-			Type:    "sccess",
-			Content: "response1",
-			Error:   "error1",
+		Response: &stub.StubResponse{
+			Type:    "success",
+			Content: "{\"name\":\"Rodrigo de Carvalho\"}",
 		},
 	})
 	ctrl := StubsController{
-		StubsStore:       stubsStore,
-		SupportedMethods: []string{"method1"},
+		StubsStore: stubsStore,
+		Service:    testMockService{methods: []string{"method1"}},
 	}
 	response := httptest.NewRecorder()
 	payload := `{
@@ -40,14 +41,14 @@ func TestStubsController_updateStubHandler(t *testing.T) {
     	"type": "success",
     	"content": {
     		"name":"Rodrigo de Carvalho UPDATED"
-    	},
-    	"error": "an unfortunate error"
+    	}
     }
 }`
 	request := httptest.NewRequest(http.MethodPut, "/stubs", strings.NewReader(payload))
+	request.Header.Set("If-Match", "\"1\"")
 	findHandler(ctrl.GetHandlers(), "UpdateStub").Handler(response, request)
-	assert.Equal(t, 1, len(stubsStore.GetAllStubs()))
-	assert.Equal(t, "OK", response.Body.String())
+	assert.Equal(t, 1, len(allStubs(t, stubsStore)))
+	assert.Contains(t, response.Body.String(), fmt.Sprintf(`"id":"%s"`, allStubs(t, stubsStore)[0].ID))
 	assert.Equal(t, 200, response.Code)
-	assert.Equal(t, "{\"name\":\"Rodrigo de Carvalho UPDATED\"}", string(stubsStore.GetAllStubs()[0].Response.Content))
+	assert.Equal(t, "{\"name\":\"Rodrigo de Carvalho UPDATED\"}", string(allStubs(t, stubsStore)[0].Response.Content))
 }
@@ -0,0 +1,156 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+const queryParamSession = "session"
+
+// StubSetsController lists the stub sets and switches the one active for a session, or splits its calls between sets
+type StubSetsController struct {
+	StubsStore    stub.StubsStore
+	StubSetsStore stub.StubSetsStore
+}
+
+func (c StubSetsController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetStubSets",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getStubSetsHandler,
+		},
+		{
+			Name:    "ResetStubSets",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetStubSetsHandler,
+		},
+		{
+			Name:    "ActivateStubSet",
+			Path:    "/{name}/activate",
+			Methods: []string{http.MethodPost},
+			Handler: c.activateStubSetHandler,
+		},
+		{
+			Name:    "SplitStubSets",
+			Path:    "/split",
+			Methods: []string{http.MethodPut},
+			Handler: c.splitStubSetsHandler,
+		},
+		{
+			Name:    "DeactivateStubSet",
+			Path:    "/active",
+			Methods: []string{http.MethodDelete},
+			Handler: c.deactivateStubSetHandler,
+		},
+	}
+}
+
+func (c StubSetsController) GetPath() string {
+	return "/stubsets"
+}
+
+func (c StubSetsController) getStubSetsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get stub sets")
+
+	c.writeStubSets(writer, request)
+}
+
+func (c StubSetsController) resetStubSetsHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset stub sets")
+
+	c.StubSetsStore.Reset()
+	writeSuccessResponse(writer)
+}
+
+func (c StubSetsController) activateStubSetHandler(writer http.ResponseWriter, request *http.Request) {
+	name := mux.Vars(request)[pathParamName]
+	session := requestedSession(request)
+	log.Infof("REST: received call to activate stub set %s for session %s", name, session)
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	found := false
+	for _, e := range stubs {
+		found = found || e.Set == name
+	}
+	if !found {
+		writeErrorResponse(writer, http.StatusNotFound, "Stub set not found")
+		return
+	}
+	c.StubSetsStore.Activate(session, name)
+	c.writeStubSets(writer, request)
+}
+
+func (c StubSetsController) splitStubSetsHandler(writer http.ResponseWriter, request *http.Request) {
+	session := requestedSession(request)
+	split := stub.StubSetSplit{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &split)
+	}
+	if err == nil {
+		err = split.Validate()
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to split the stub sets failed with error: %s", err.Error()))
+		return
+	}
+	log.Infof("REST: received call to split the calls of session %s between %d stub sets", session, len(split.Sets))
+
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	for _, set := range split.Sets {
+		found := false
+		for _, e := range stubs {
+			found = found || e.Set == set.Name
+		}
+		if !found {
+			writeErrorResponse(writer, http.StatusNotFound, fmt.Sprintf("Stub set %s not found", set.Name))
+			return
+		}
+	}
+	c.StubSetsStore.Split(session, split)
+	c.writeStubSets(writer, request)
+}
+
+func (c StubSetsController) deactivateStubSetHandler(writer http.ResponseWriter, request *http.Request) {
+	session := requestedSession(request)
+	log.Infof("REST: received call to deactivate the stub set of session %s", session)
+
+	c.StubSetsStore.Activate(session, "")
+	c.writeStubSets(writer, request)
+}
+
+func (c StubSetsController) writeStubSets(writer http.ResponseWriter, request *http.Request) {
+	stubs, err := c.StubsStore.GetAllStubs(request.Context())
+	if err != nil {
+		writeStoreErrorResponse(writer, err)
+		return
+	}
+	writeErr := writeResponse(writer, stub.GetStubSets(stubs, c.StubSetsStore))
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+// requestedSession returns the session of the query, the global one when not set
+func requestedSession(request *http.Request) string {
+	if session := request.URL.Query().Get(queryParamSession); session != "" {
+		return session
+	}
+	return stub.GlobalStateScope
+}
@@ -0,0 +1,87 @@
+package restcontrollers
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+)
+
+const (
+	contentTypeMultipartFormData = "multipart/form-data"
+	// Fields of the multipart/form-data uploads with the stub files and the payload files they reference
+	formFieldStubs    = "stubs"
+	formFieldPayloads = "payloads"
+	// Label set to the name of the file of the stubs uploaded
+	labelFile = "file"
+	// Maximum size of the uploads kept in memory, the rest is stored in temporary files
+	uploadMaxMemory = 32 << 20
+)
+
+// isMultipartUpload tells if the request is a multipart/form-data upload of files
+func isMultipartUpload(request *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get(contentType))
+	return err == nil && mediaType == contentTypeMultipartFormData
+}
+
+// readUploadedStubs reads the stubs of the files in the stubs fields of a multipart/form-data upload. Each file has a
+// single stub or an array of stubs, labelled with the name of the file unless they have a file label already. The
+// contents in the stubs can reference the files in the payloads fields by name, e.g. {"$file": "order.json"}.
+func readUploadedStubs(request *http.Request) ([]*stub.Stub, error) {
+	if err := request.ParseMultipartForm(uploadMaxMemory); err != nil {
+		return nil, err
+	}
+	defer request.MultipartForm.RemoveAll()
+
+	payloads := make(map[string][]byte)
+	for _, header := range request.MultipartForm.File[formFieldPayloads] {
+		data, err := readUploadedFile(header)
+		if err != nil {
+			return nil, err
+		}
+		payloads[filepath.Base(header.Filename)] = data
+	}
+	stubFiles := request.MultipartForm.File[formFieldStubs]
+	if len(stubFiles) == 0 {
+		return nil, fmt.Errorf("no stub files uploaded in the %s field", formFieldStubs)
+	}
+	stubs := make([]*stub.Stub, 0)
+	for _, header := range stubFiles {
+		data, err := readUploadedFile(header)
+		if err != nil {
+			return nil, err
+		}
+		fileStubs, err := stub.ParseStubs(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stubs file %s: %w", header.Filename, err)
+		}
+		for _, s := range fileStubs {
+			if s == nil {
+				continue
+			}
+			if err := stub.ResolvePayloadFiles(s, payloads); err != nil {
+				return nil, fmt.Errorf("invalid stubs file %s: %w", header.Filename, err)
+			}
+			if s.Labels == nil {
+				s.Labels = make(map[string]string)
+			}
+			if _, found := s.Labels[labelFile]; !found {
+				s.Labels[labelFile] = filepath.Base(header.Filename)
+			}
+		}
+		stubs = append(stubs, fileStubs...)
+	}
+	return stubs, nil
+}
+
+func readUploadedFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
@@ -0,0 +1,42 @@
+package restcontrollers
+
+import (
+	"bytes"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadUploadedStubs(t *testing.T) {
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	files := []struct{ field, name, content string }{
+		{formFieldStubs, "orders.json", `[
+			{"fullMethod":"/acme.Orders/Get","request":{"match":"exact","content":{"$file":"request.json"}},"response":{"type":"success","content":{"$file":"order.json"}}},
+			{"fullMethod":"/acme.Orders/List","labels":{"file":"list"},"request":{"match":"partial","content":{}},"response":{"type":"success","content":{}}}]`},
+		{formFieldStubs, "ci/customers.json", `{"fullMethod":"/acme.Customers/Get","request":{"match":"partial","content":{}},"response":{"type":"success","content":{}}}`},
+		{formFieldPayloads, "request.json", `{"name": "orders/1"}`},
+		{formFieldPayloads, "order.json", `{"name": "orders/1", "total": 10}`},
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile(file.field, file.name)
+		assert.NoError(t, err)
+		part.Write([]byte(file.content))
+	}
+	assert.NoError(t, form.Close())
+	request := httptest.NewRequest(http.MethodPost, "/stubs/import", body)
+	request.Header.Set(contentType, form.FormDataContentType())
+
+	assert.True(t, isMultipartUpload(request))
+	stubs, err := readUploadedStubs(request)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(stubs))
+	assert.Equal(t, stub.JsonString(`{"name": "orders/1"}`), stubs[0].Request.Content)
+	assert.Equal(t, stub.JsonString(`{"name": "orders/1", "total": 10}`), stubs[0].Response.Content)
+	assert.Equal(t, map[string]string{"file": "orders.json"}, stubs[0].Labels)
+	assert.Equal(t, map[string]string{"file": "list"}, stubs[1].Labels)
+	assert.Equal(t, map[string]string{"file": "customers.json"}, stubs[2].Labels)
+}
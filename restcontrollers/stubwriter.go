@@ -1 +1,60 @@
 package restcontrollers
+
+import (
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentTypeApplicationNDJson = "application/x-ndjson"
+	headerAccept                 = "Accept"
+	// Number of stubs written between flushes of the response
+	stubsFlushInterval = 1000
+)
+
+// writeStubsResponse streams the stubs to the response, one at a time, instead of marshaling all of them in memory.
+// The stubs are written as a JSON array or, when the client accepts application/x-ndjson, as newline delimited JSON.
+// The status code is sent before the first stub, so a stub that can't be marshaled ends the response early and the
+// error is only logged.
+func writeStubsResponse(writer http.ResponseWriter, request *http.Request, stubs []*stub.Stub) {
+	ndjson := strings.Contains(request.Header.Get(headerAccept), contentTypeApplicationNDJson)
+	start, separator, end := "[", ",", "]"
+	writer.Header().Set(contentType, contentTypeApplicationJson)
+	if ndjson {
+		start, separator, end = "", "", ""
+		writer.Header().Set(contentType, contentTypeApplicationNDJson)
+	}
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+
+	if _, err := writer.Write([]byte(start)); err != nil {
+		log.Errorf("Error writing http response: Error %s", err.Error())
+		return
+	}
+	for i, s := range stubs {
+		data, err := json.Marshal(s)
+		if err != nil {
+			log.Errorf("Unexpected error while writing stub %s in JSON. Error %s", s.ID, err.Error())
+			return
+		}
+		if i > 0 {
+			data = append([]byte(separator), data...)
+		}
+		if ndjson {
+			data = append(data, '\n')
+		}
+		if _, err := writer.Write(data); err != nil {
+			log.Errorf("Error writing http response: Error %s", err.Error())
+			return
+		}
+		if flusher != nil && (i+1)%stubsFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+	if _, err := writer.Write([]byte(end)); err != nil {
+		log.Errorf("Error writing http response: Error %s", err.Error())
+	}
+}
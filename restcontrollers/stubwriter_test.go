@@ -0,0 +1,47 @@
+package restcontrollers
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/stub"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newWriterTestStubs(count int) []*stub.Stub {
+	stubs := make([]*stub.Stub, 0, count)
+	for i := 0; i < count; i++ {
+		stubs = append(stubs, &stub.Stub{ID: fmt.Sprintf("%d", i), FullMethod: "method1"})
+	}
+	return stubs
+}
+
+func TestWriteStubsResponse_JSONArray(t *testing.T) {
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	writeStubsResponse(response, request, newWriterTestStubs(2))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, contentTypeApplicationJson, response.Header().Get(contentType))
+	assert.Equal(t, "[{\"id\":\"0\",\"fullMethod\":\"method1\",\"request\":null,\"response\":null},"+
+		"{\"id\":\"1\",\"fullMethod\":\"method1\",\"request\":null,\"response\":null}]", response.Body.String())
+
+	response = httptest.NewRecorder()
+	writeStubsResponse(response, request, []*stub.Stub{})
+	assert.Equal(t, "[]", response.Body.String())
+}
+
+func TestWriteStubsResponse_NDJSON(t *testing.T) {
+	response := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/stubs", nil)
+	request.Header.Set(headerAccept, contentTypeApplicationNDJson)
+	writeStubsResponse(response, request, newWriterTestStubs(stubsFlushInterval+1))
+
+	assert.Equal(t, contentTypeApplicationNDJson, response.Header().Get(contentType))
+	assert.True(t, response.Flushed)
+	lines := strings.Split(strings.TrimSuffix(response.Body.String(), "\n"), "\n")
+	assert.Len(t, lines, stubsFlushInterval+1)
+	assert.Equal(t, "{\"id\":\"0\",\"fullMethod\":\"method1\",\"request\":null,\"response\":null}", lines[0])
+}
@@ -0,0 +1,50 @@
+package restcontrollers
+
+import (
+	"github.com/carvalhorr/protoc-gen-mock/grpchandler"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// SummaryController reports the totals of the calls received since the start of the run, e.g. to attach to the
+// artifacts of a CI job. Resetting the summary starts a new run.
+type SummaryController struct {
+	Summary *grpchandler.CallSummary
+}
+
+func (c SummaryController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetSummary",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getSummaryHandler,
+		},
+		{
+			Name:    "ResetSummary",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetHandler,
+		},
+	}
+}
+
+func (c SummaryController) GetPath() string {
+	return "/summary"
+}
+
+func (c SummaryController) getSummaryHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the summary")
+
+	writeErr := writeResponse(writer, c.Summary.Report())
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
+
+func (c SummaryController) resetHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the summary")
+
+	c.Summary.Reset()
+	writeSuccessResponse(writer)
+}
@@ -0,0 +1,109 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// TimeController controls the clock used to render the time in the responses
+type TimeController struct {
+	Clock *util.MockClock
+}
+
+type TimeStatus struct {
+	Time   time.Time `json:"time"`
+	Frozen bool      `json:"frozen"`
+}
+
+// setTimeRequest changes the clock. The changes are applied in the order: freeze, time and advance.
+type setTimeRequest struct {
+	// Time sets the current time
+	Time *time.Time `json:"time"`
+	// Freeze stops (true) or restarts (false) the clock
+	Freeze *bool `json:"freeze"`
+	// Advance moves the clock by a duration, e.g. 1h30m
+	Advance string `json:"advance"`
+}
+
+func (c TimeController) GetHandlers() []RESTHandler {
+	return []RESTHandler{
+		{
+			Name:    "GetTime",
+			Path:    "",
+			Methods: []string{http.MethodGet},
+			Handler: c.getTimeHandler,
+		},
+		{
+			Name:    "SetTime",
+			Path:    "",
+			Methods: []string{http.MethodPut},
+			Handler: c.setTimeHandler,
+		},
+		{
+			Name:    "ResetTime",
+			Path:    "",
+			Methods: []string{http.MethodDelete},
+			Handler: c.resetTimeHandler,
+		},
+	}
+}
+
+func (c TimeController) GetPath() string {
+	return "/time"
+}
+
+func (c TimeController) getTimeHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to get the time")
+
+	c.writeTime(writer)
+}
+
+func (c TimeController) setTimeHandler(writer http.ResponseWriter, request *http.Request) {
+	setRequest := setTimeRequest{}
+	bodyData, err := ioutil.ReadAll(request.Body)
+	if err == nil {
+		err = json.Unmarshal(bodyData, &setRequest)
+	}
+	var advance time.Duration
+	if err == nil && setRequest.Advance != emptyString {
+		advance, err = time.ParseDuration(setRequest.Advance)
+	}
+	if err != nil {
+		writeErrorResponse(writer, http.StatusBadRequest, fmt.Sprintf("call to set the time failed with error: %s", err.Error()))
+		return
+	}
+	log.WithFields(log.Fields{"request": string(bodyData)}).
+		Info("REST: received call to set the time")
+
+	if setRequest.Freeze != nil {
+		if *setRequest.Freeze {
+			c.Clock.Freeze()
+		} else {
+			c.Clock.Unfreeze()
+		}
+	}
+	if setRequest.Time != nil {
+		c.Clock.Set(*setRequest.Time)
+	}
+	c.Clock.Advance(advance)
+	c.writeTime(writer)
+}
+
+func (c TimeController) resetTimeHandler(writer http.ResponseWriter, request *http.Request) {
+	log.Info("REST: received call to reset the time")
+
+	c.Clock.Reset()
+	c.writeTime(writer)
+}
+
+func (c TimeController) writeTime(writer http.ResponseWriter) {
+	writeErr := writeResponse(writer, TimeStatus{Time: c.Clock.Now(), Frozen: c.Clock.IsFrozen()})
+	if writeErr != nil {
+		writeErrorResponse(writer, http.StatusInternalServerError, writeErr.Error())
+	}
+}
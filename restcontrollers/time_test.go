@@ -0,0 +1,40 @@
+package restcontrollers
+
+import (
+	"encoding/json"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeController_SetTime(t *testing.T) {
+	controller := TimeController{Clock: util.NewMockClock()}
+
+	body := `{"time":"2020-01-01T00:00:00Z","freeze":true,"advance":"90m"}`
+	recorder := httptest.NewRecorder()
+	controller.setTimeHandler(recorder, httptest.NewRequest(http.MethodPut, "/time", strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	status := TimeStatus{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.True(t, status.Frozen)
+	assert.True(t, time.Date(2020, 1, 1, 1, 30, 0, 0, time.UTC).Equal(status.Time))
+	assert.True(t, status.Time.Equal(controller.Clock.Now()))
+
+	recorder = httptest.NewRecorder()
+	controller.resetTimeHandler(recorder, httptest.NewRequest(http.MethodDelete, "/time", nil))
+	assert.False(t, controller.Clock.IsFrozen())
+	assert.WithinDuration(t, time.Now(), controller.Clock.Now(), time.Second)
+}
+
+func TestTimeController_SetTime_Invalid(t *testing.T) {
+	controller := TimeController{Clock: util.NewMockClock()}
+
+	recorder := httptest.NewRecorder()
+	controller.setTimeHandler(recorder, httptest.NewRequest(http.MethodPut, "/time", strings.NewReader(`{"advance":"soon"}`)))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
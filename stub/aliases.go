@@ -0,0 +1,107 @@
+package stub
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MethodAlias routes the calls to a method to the stubs of another one, e.g. to keep serving the stubs of a method
+// renamed by a refactoring of the protos until the stubs are updated. The stubs of the method called are tried first.
+type MethodAlias struct {
+	// Method is the full method called (/package.Service/Method) or all the methods of a service (/package.Service/*)
+	Method string `json:"method"`
+	// Target is the full method the stubs are registered under or, for the methods of the same name, a service
+	// (/package.Service/*), e.g. the service before a new version of its package
+	Target string `json:"target"`
+}
+
+func (a MethodAlias) Validate() error {
+	isMethod := func(method string) bool {
+		return strings.HasPrefix(method, "/") && strings.Count(method, "/") == 2 && !strings.HasSuffix(method, "/")
+	}
+	if !isMethod(a.Method) {
+		return fmt.Errorf("invalid aliased method '%s': expected /package.Service/Method or /package.Service/*", a.Method)
+	}
+	if !isMethod(a.Target) {
+		return fmt.Errorf("invalid alias target '%s': expected /package.Service/Method or /package.Service/*", a.Target)
+	}
+	if strings.HasSuffix(a.Method, "/*") && !strings.HasSuffix(a.Target, "/*") {
+		return fmt.Errorf("invalid alias target '%s' of '%s': the methods of a service can only be aliased to a service", a.Target, a.Method)
+	}
+	return nil
+}
+
+// target returns the method the calls to fullMethod are routed to, if the alias applies to it
+func (a MethodAlias) target(fullMethod string) (string, bool) {
+	if !strings.HasSuffix(a.Method, "/*") {
+		return a.Target, a.Method == fullMethod
+	}
+	if !strings.HasPrefix(fullMethod, strings.TrimSuffix(a.Method, "*")) {
+		return "", false
+	}
+	if !strings.HasSuffix(a.Target, "/*") {
+		return a.Target, true
+	}
+	return strings.TrimSuffix(a.Target, "*") + fullMethod[strings.LastIndex(fullMethod, "/")+1:], true
+}
+
+// MethodAliases keeps the aliases of the methods. It is safe for concurrent use.
+type MethodAliases struct {
+	aliases []MethodAlias
+	mutex   sync.RWMutex
+}
+
+var methodAliases = NewMethodAliases()
+
+func NewMethodAliases() *MethodAliases {
+	return new(MethodAliases)
+}
+
+// GetMethodAliases returns the method aliases used by the stubs matcher of the mock server
+func GetMethodAliases() *MethodAliases {
+	return methodAliases
+}
+
+// Configure replaces the aliases of the methods
+func (a *MethodAliases) Configure(aliases []MethodAlias) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.aliases = append([]MethodAlias(nil), aliases...)
+}
+
+// GetAll returns the aliases of the methods
+func (a *MethodAliases) GetAll() []MethodAlias {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	return append(make([]MethodAlias, 0, len(a.aliases)), a.aliases...)
+}
+
+// methodsOf returns the methods whose stubs are tried for the calls to fullMethod: the method itself and then the
+// targets of its aliases, in order
+func (a *MethodAliases) methodsOf(fullMethod string) []string {
+	methods := []string{fullMethod}
+	if a == nil {
+		return methods
+	}
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	for _, alias := range a.aliases {
+		if target, found := alias.target(fullMethod); found && !containsString(methods, target) {
+			methods = append(methods, target)
+		}
+	}
+	return methods
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
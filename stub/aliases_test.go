@@ -0,0 +1,52 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMethodAlias_Validate(t *testing.T) {
+	assert.NoError(t, MethodAlias{Method: "/acme.Orders/GetOrder", Target: "/acme.Orders/Get"}.Validate())
+	assert.NoError(t, MethodAlias{Method: "/acme.v2.Orders/*", Target: "/acme.v1.Orders/*"}.Validate())
+	assert.NoError(t, MethodAlias{Method: "/acme.v2.Orders/Get", Target: "/acme.v1.Orders/*"}.Validate())
+	assert.Error(t, MethodAlias{Method: "acme.Orders/Get", Target: "/acme.Orders/Get"}.Validate())
+	assert.Error(t, MethodAlias{Method: "/acme.Orders/GetOrder", Target: "/acme.Orders/"}.Validate())
+	assert.Error(t, MethodAlias{Method: "/acme.v2.Orders/*", Target: "/acme.v1.Orders/Get"}.Validate())
+}
+
+func TestMethodAliases_methodsOf(t *testing.T) {
+	aliases := NewMethodAliases()
+	aliases.Configure([]MethodAlias{
+		{Method: "/acme.v2.Orders/GetOrder", Target: "/acme.v1.Orders/Get"},
+		{Method: "/acme.v2.Orders/*", Target: "/acme.v1.Orders/*"},
+	})
+
+	assert.Equal(t, []string{"/acme.v2.Orders/GetOrder", "/acme.v1.Orders/Get", "/acme.v1.Orders/GetOrder"},
+		aliases.methodsOf("/acme.v2.Orders/GetOrder"))
+	assert.Equal(t, []string{"/acme.v2.Orders/List", "/acme.v1.Orders/List"}, aliases.methodsOf("/acme.v2.Orders/List"))
+	assert.Equal(t, []string{"/acme.v1.Orders/List"}, aliases.methodsOf("/acme.v1.Orders/List"))
+	assert.Equal(t, []string{"/acme.v1.Orders/List"}, (*MethodAliases)(nil).methodsOf("/acme.v1.Orders/List"))
+}
+
+func TestStubsMatcher_Match_MethodAliases(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	renamed := newTestStub("/acme.Orders/Get", "{\"id\":\"1\"}")
+	current := newTestStub("/acme.Orders/GetOrder", "{\"id\":\"2\"}")
+	store.Add(context.Background(), renamed)
+	store.Add(context.Background(), current)
+	aliases := NewMethodAliases()
+	aliases.Configure([]MethodAlias{{Method: "/acme.Orders/GetOrder", Target: "/acme.Orders/Get"}})
+	journal := NewInMemoryJournal(10)
+	matcher := NewStubsMatcher(store, WithMethodAliases(aliases), WithJournal(journal))
+
+	assert.Equal(t, current, matcher.Match(context.Background(), "/acme.Orders/GetOrder", "{\"id\":\"2\"}"))
+	assert.Equal(t, renamed, matcher.Match(context.Background(), "/acme.Orders/GetOrder", "{\"id\":\"1\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), "/acme.Orders/GetOrder", "{\"id\":\"3\"}"))
+	// The stubs of the method called are not used by the target
+	assert.Nil(t, matcher.Match(context.Background(), "/acme.Orders/Get", "{\"id\":\"2\"}"))
+
+	entries := journal.GetAll()
+	assert.Equal(t, "/acme.Orders/GetOrder", entries[1].FullMethod)
+	assert.Equal(t, renamed.ID, entries[1].StubID)
+}
@@ -0,0 +1,120 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var captureNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Captures extract values of the request into named variables when the stub matches, so that the responses use them
+// (e.g. ${capture.orderId}) without repeating where they are in the request
+type Captures map[string]*Capture
+
+// Capture extracts the value of a field of the request. In JSON it is either the path of the field or an object with
+// the path and a regular expression.
+type Capture struct {
+	// Path of the field, e.g. order.id or items.0.sku (names as in the JSON of the request)
+	Path string `json:"path"`
+	// Regex must match the value of the field, formatted as a string, for the stub to match. The value captured is the
+	// text of its first group, or of the whole match when it has no groups.
+	Regex string `json:"regex,omitempty"`
+
+	regex     *regexp.Regexp
+	regexOnce sync.Once
+}
+
+func (c *Capture) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		c.Path = path
+		return nil
+	}
+	type capture Capture
+	return json.Unmarshal(data, (*capture)(c))
+}
+
+// capture returns the value captured from the request, and false when the field is not set or doesn't match the
+// regular expression
+func (c *Capture) capture(request interface{}) (interface{}, bool) {
+	value := lookupPath(request, strings.Split(c.Path, "."))
+	if value == nil {
+		return nil, false
+	}
+	if c.Regex == "" {
+		return value, true
+	}
+	c.regexOnce.Do(func() {
+		c.regex, _ = regexp.Compile(c.Regex)
+	})
+	if c.regex == nil {
+		return nil, false
+	}
+	match := c.regex.FindStringSubmatch(formatValue(value))
+	switch {
+	case match == nil:
+		return nil, false
+	case len(match) > 1:
+		return match[1], true
+	default:
+		return match[0], true
+	}
+}
+
+// values returns the values captured from the request, and false when any of them can't be captured
+func (c Captures) values(request interface{}) (map[string]interface{}, bool) {
+	values := make(map[string]interface{}, len(c))
+	for name, capture := range c {
+		value, ok := capture.capture(request)
+		if !ok {
+			return nil, false
+		}
+		values[name] = value
+	}
+	return values, true
+}
+
+func (c Captures) matches(request map[string]interface{}) bool {
+	_, ok := c.values(request)
+	return ok
+}
+
+func (c Captures) equal(other Captures) bool {
+	if len(c) != len(other) {
+		return false
+	}
+	for name, capture := range c {
+		otherCapture, found := other[name]
+		if !found || (capture == nil) != (otherCapture == nil) ||
+			(capture != nil && (capture.Path != otherCapture.Path || capture.Regex != otherCapture.Regex)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Captures) validate() (errMsgs []string) {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		capture := c[name]
+		if !captureNamePattern.MatchString(name) {
+			errMsgs = append(errMsgs, fmt.Sprintf("Capture name '%s' is not valid, it must be an identifier.", name))
+		}
+		if capture == nil || capture.Path == "" {
+			errMsgs = append(errMsgs, fmt.Sprintf("Capture '%s' requires the path of a request field.", name))
+			continue
+		}
+		if _, err := regexp.Compile(capture.Regex); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Capture '%s' regex is not valid: %s", name, err.Error()))
+		}
+	}
+	return errMsgs
+}
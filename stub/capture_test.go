@@ -0,0 +1,47 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCaptures(t *testing.T) {
+	request := StubRequest{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"match":"partial","content":{},"capture":{"orderId":"order.id","region":{"path":"order.id","regex":"^([A-Z]+)-"}}}`), &request))
+	assert.Equal(t, "order.id", request.Capture["orderId"].Path)
+
+	values, ok := request.Capture.values(map[string]interface{}{"order": map[string]interface{}{"id": "EU-42"}})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"orderId": "EU-42", "region": "EU"}, values)
+	assert.False(t, request.Capture.matches(map[string]interface{}{"order": map[string]interface{}{"id": "42"}}))
+	assert.False(t, request.Capture.matches(map[string]interface{}{}))
+
+	assert.Equal(t, []string{
+		"Capture name '1st' is not valid, it must be an identifier.",
+		"Capture 'id' requires the path of a request field.",
+		"Capture 'sku' regex is not valid: error parsing regexp: missing closing ): `(`",
+	}, Captures{"1st": {Path: "id"}, "id": {}, "sku": {Path: "items.0.sku", Regex: "("}}.validate())
+}
+
+func TestGetResponse_Captures(t *testing.T) {
+	s := &Stub{
+		FullMethod: "/acme.Orders/Get",
+		Request: &StubRequest{Match: "partial", Content: "{}", Capture: Captures{
+			"orderId": {Path: "order.id"},
+			"sku":     {Path: "items.0.sku", Regex: "^SKU-(\\d+)$"},
+		}},
+		Response: &StubResponse{Type: "error", Error: &ErrorResponse{Code: 5, Message: "order ${capture.orderId} with ${capture.sku} (${int(capture.sku) + 1}) not found"}},
+	}
+	_, err := GetResponse(context.Background(), s, `{"order":{"id":12345678901},"items":[{"sku":"SKU-7"}]}`, nil)
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = order 12345678901 with 7 (8) not found")
+
+	scripted, err := RunScript(context.Background(), &Stub{
+		FullMethod: "/acme.Orders/Get",
+		Request:    &StubRequest{Match: "partial", Content: "{}", Capture: Captures{"orderId": {Path: "order.id"}}},
+		Response:   &StubResponse{Type: ResponseTypeScript, Script: `return {content = {id = capture.orderId}}`},
+	}, `{"order":{"id":"A-1"}}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"A-1"}`, scripted.Response.Content.String())
+}
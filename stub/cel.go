@@ -0,0 +1,174 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The matching expressions of the stubs (StubRequest.MatchExpr) are CEL expressions (https://github.com/google/cel-go)
+// with the variables:
+//   - request: the request message, typed with the input message of the method when it is registered (the messages of
+//     the generated code are), so that the expressions are type checked when the stub is added. The request is
+//     evaluated as the JSON of the request (dyn) for the methods of unknown messages.
+//   - metadata: map(string, list(string)), each key of the metadata with its values
+//   - method: string, the full method called
+//   - transport: map(string, string), the authority, contentType and compression of the request
+//
+// The string functions of the CEL extensions (e.g. lowerAscii, upperAscii, split or trim) are available too, and the
+// numbers of different types can be compared. The expression must result in a boolean, and the request doesn't match
+// when the evaluation fails.
+
+// celExpr is a compiled matching expression
+type celExpr struct {
+	program cel.Program
+	// request is the message of the request variable, nil when it is dyn
+	request protoreflect.MessageDescriptor
+}
+
+// The CEL environments by the full name of the request message, "" for the dyn request
+var celEnvs sync.Map
+
+func celEnv(request protoreflect.MessageDescriptor) (*cel.Env, error) {
+	name := ""
+	if request != nil {
+		name = string(request.FullName())
+	}
+	if env, ok := celEnvs.Load(name); ok {
+		return env.(*cel.Env), nil
+	}
+	options := []cel.EnvOption{
+		cel.Variable("metadata", cel.MapType(cel.StringType, cel.ListType(cel.StringType))),
+		cel.Variable("method", cel.StringType),
+		cel.Variable("transport", cel.MapType(cel.StringType, cel.StringType)),
+		ext.Strings(),
+		cel.CrossTypeNumericComparisons(true),
+	}
+	if request != nil {
+		options = append(options, cel.TypeDescs(request.ParentFile()), cel.Variable("request", cel.ObjectType(name)))
+	} else {
+		options = append(options, cel.Variable("request", cel.DynType))
+	}
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return nil, err
+	}
+	celEnvs.Store(name, env)
+	return env, nil
+}
+
+// compileCEL type checks the expression with the request message given (dyn when it is nil)
+func compileCEL(src string, request protoreflect.MessageDescriptor) (*celExpr, error) {
+	env, err := celEnv(request)
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(src)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if output := ast.OutputType(); !output.IsExactType(cel.BoolType) && !output.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("the expression must result in a boolean, got %s", output)
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &celExpr{program: program, request: request}, nil
+}
+
+// compileMatchExpr compiles the expression with the input message of the method, when it is registered
+func compileMatchExpr(src, fullMethod string) (*celExpr, error) {
+	return compileCEL(src, requestDescriptor(fullMethod))
+}
+
+// requestDescriptor returns the input message of the method, nil when it is not registered. The methods of the
+// generated mocks are named as in Go (e.g. GetUser for get_user).
+func requestDescriptor(fullMethod string) protoreflect.MessageDescriptor {
+	if method := findMethod(protoregistry.GlobalFiles, fullMethod); method != nil {
+		return method.Input()
+	}
+	serviceName, methodName := path.Split(strings.TrimPrefix(fullMethod, "/"))
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(strings.TrimSuffix(serviceName, "/")))
+	if err != nil {
+		return nil
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	for i := 0; i < service.Methods().Len(); i++ {
+		method := service.Methods().Get(i)
+		if strings.EqualFold(strings.ReplaceAll(string(method.Name()), "_", ""), methodName) {
+			return method.Input()
+		}
+	}
+	return nil
+}
+
+// matches evaluates the expression for the request, given decoded from JSON
+func (e *celExpr) matches(ctx context.Context, fullMethod string, request map[string]interface{}) (bool, error) {
+	var requestValue interface{} = request
+	if e.request != nil {
+		message, err := typedRequest(ctx, e.request, request)
+		if err != nil {
+			return false, err
+		}
+		requestValue = message
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if md == nil {
+		md = metadata.MD{}
+	}
+	value, _, err := e.program.Eval(map[string]interface{}{
+		"request":   requestValue,
+		"metadata":  map[string][]string(md),
+		"method":    fullMethod,
+		"transport": getTransportAttributes(ctx).toEnv(),
+	})
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("the expression must result in a boolean, got %s", value.Type())
+	}
+	return result, nil
+}
+
+type requestMessageKey struct{}
+
+// WithRequestMessage returns a context with the request message of the call, on which the matching expressions are
+// evaluated. Without it, the request is decoded from its JSON.
+func WithRequestMessage(ctx context.Context, request proto.Message) context.Context {
+	return context.WithValue(ctx, requestMessageKey{}, request)
+}
+
+// typedRequest returns the request message of the call when it is of the message given, and the request decoded from
+// JSON into the message otherwise
+func typedRequest(ctx context.Context, descriptor protoreflect.MessageDescriptor, request map[string]interface{}) (proto.Message, error) {
+	if message, ok := ctx.Value(requestMessageKey{}).(proto.Message); ok && message != nil &&
+		message.ProtoReflect().Descriptor().FullName() == descriptor.FullName() {
+		return message, nil
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
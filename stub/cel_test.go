@@ -0,0 +1,79 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestStubsMatcher_Match_Expr(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := &Stub{
+		FullMethod: "method1",
+		Request:    &StubRequest{MatchExpr: "request.amount > 100 && metadata['x-tenant'][0] == 'acme'"},
+		Response:   &StubResponse{Type: "success", Content: "{}"},
+	}
+	assert.NoError(t, store.Add(context.Background(), s))
+	matcher := NewStubsMatcher(store)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+
+	assert.Equal(t, s, matcher.Match(ctx, "method1", "{\"amount\":101}"))
+	assert.Nil(t, matcher.Match(ctx, "method1", "{\"amount\":100}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"amount\":101}"))
+
+	valid, _ := s.IsValid()
+	assert.True(t, valid)
+	s.Request.MatchExpr = "request.amount >"
+	valid, _ = s.IsValid()
+	assert.False(t, valid)
+}
+
+func TestStubsMatcher_Match_TypedExpr(t *testing.T) {
+	const fullMethod = "/grpc.health.v1.Health/Check"
+	store := NewInMemoryStubsStore()
+	s := &Stub{
+		FullMethod: fullMethod,
+		Request:    &StubRequest{MatchExpr: "request.service.startsWith('orders') && method.endsWith('/Check')"},
+		Response:   &StubResponse{Type: "success", Content: "{}"},
+	}
+	assert.NoError(t, store.Add(context.Background(), s))
+	assert.NotNil(t, s.Request.expr.request)
+	matcher := NewStubsMatcher(store)
+
+	typed := WithRequestMessage(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "orders.v1"})
+	assert.Equal(t, s, matcher.Match(typed, fullMethod, "{\"service\":\"orders.v1\"}"))
+	// The request is decoded from JSON when the message is not in the context
+	assert.Equal(t, s, matcher.Match(context.Background(), fullMethod, "{\"service\":\"orders.v2\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), fullMethod, "{\"service\":\"payments\"}"))
+}
+
+func TestCompileMatchExpr_TypeChecked(t *testing.T) {
+	const fullMethod = "/grpc.health.v1.Health/Check"
+	for _, expr := range []string{"request.missing == 'orders'", "request.service > 1", "request.service", "request.service.lowerAscii() == "} {
+		_, err := compileMatchExpr(expr, fullMethod)
+		assert.Error(t, err, expr)
+	}
+	_, err := compileMatchExpr("request.service.lowerAscii() == 'orders' && size(request.service) > 2.5", fullMethod)
+	assert.NoError(t, err)
+	// The fields are not known for the unregistered methods
+	_, err = compileMatchExpr("request.missing == 'orders'", "method1")
+	assert.NoError(t, err)
+
+	s := &Stub{
+		FullMethod: fullMethod,
+		Request:    &StubRequest{MatchExpr: "request.missing == 'orders'"},
+		Response:   &StubResponse{Type: "success", Content: "{}"},
+	}
+	valid, errs := s.IsValid()
+	assert.False(t, valid)
+	assert.Contains(t, errs[0], "undefined field 'missing'")
+}
+
+func TestRequestDescriptor(t *testing.T) {
+	assert.Equal(t, "grpc.health.v1.HealthCheckRequest", string(requestDescriptor("/grpc.health.v1.Health/Check").FullName()))
+	assert.Equal(t, "grpc.health.v1.HealthCheckRequest", string(requestDescriptor("/grpc.health.v1.Health/check").FullName()))
+	assert.Nil(t, requestDescriptor("/grpc.health.v1.Health/Unknown"))
+	assert.Nil(t, requestDescriptor("method1"))
+}
@@ -0,0 +1,137 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+	"strings"
+	"sync"
+	"time"
+)
+
+const bearerPrefix = "bearer "
+
+// Claims with a space separated list of values
+var scopeClaims = map[string]bool{"scope": true, "scp": true}
+
+var claimsVerification = struct {
+	sync.RWMutex
+	keys *util.JWKS
+}{}
+
+// SetClaimsVerificationKeys makes the claims matchers only match the JWTs signed with one of the keys and not expired.
+// The tokens are decoded without being verified when keys is nil.
+func SetClaimsVerificationKeys(keys *util.JWKS) {
+	claimsVerification.Lock()
+	defer claimsVerification.Unlock()
+
+	claimsVerification.keys = keys
+}
+
+func getClaimsVerificationKeys() *util.JWKS {
+	claimsVerification.RLock()
+	defer claimsVerification.RUnlock()
+
+	return claimsVerification.keys
+}
+
+// ClaimsMatcher matches the claims of the JWT sent as bearer token in the authorization metadata, e.g.
+// {"sub": "user-1", "tenant_id": "acme", "scope": "orders.read"}. The names can be paths to nested claims, e.g.
+// realm_access.roles. A claim with a list of values matches when it contains the value, and the scope and scp claims
+// when they contain all the scopes (space separated) of the value.
+type ClaimsMatcher map[string]string
+
+func (c ClaimsMatcher) matches(ctx context.Context) bool {
+	if len(c) == 0 {
+		return true
+	}
+	return c.MatchJWT(getJWT(ctx))
+}
+
+// MatchJWT checks if the token has all the claims
+func (c ClaimsMatcher) MatchJWT(jwt *util.JWT) bool {
+	if jwt == nil {
+		return false
+	}
+	for name, value := range c {
+		claim, found := getClaim(jwt.Claims, name)
+		if !found || !matchClaim(name, claim, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// getClaim returns the claim with the name given or, when there isn't one, the nested claim with it as path
+func getClaim(claims map[string]interface{}, name string) (interface{}, bool) {
+	if claim, found := claims[name]; found {
+		return claim, true
+	}
+	var current interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func matchClaim(name string, claim interface{}, value string) bool {
+	path := strings.Split(name, ".")
+	switch c := claim.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if fmt.Sprint(item) == value {
+				return true
+			}
+		}
+		return false
+	case string:
+		if !scopeClaims[path[len(path)-1]] {
+			return c == value
+		}
+		scopes := make(map[string]bool, 0)
+		for _, scope := range strings.Fields(c) {
+			scopes[scope] = true
+		}
+		for _, scope := range strings.Fields(value) {
+			if !scopes[scope] {
+				return false
+			}
+		}
+		return true
+	}
+	return fmt.Sprint(claim) == value
+}
+
+// getJWT decodes the bearer token in the authorization metadata, verifying it when there are keys to verify it with.
+// It returns nil if there isn't one, it isn't a JWT or it isn't valid.
+func getJWT(ctx context.Context) *util.JWT {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+			continue
+		}
+		jwt, err := util.ParseJWT(strings.TrimSpace(value[len(bearerPrefix):]))
+		if err != nil {
+			continue
+		}
+		if keys := getClaimsVerificationKeys(); keys != nil {
+			if err = jwt.Verify(keys); err == nil {
+				err = jwt.ValidateTime(time.Now())
+			}
+			if err != nil {
+				log.WithFields(log.Fields{"Error": err.Error()}).Debug("The JWT of the call is not valid")
+				continue
+			}
+		}
+		return jwt
+	}
+	return nil
+}
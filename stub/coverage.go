@@ -0,0 +1,78 @@
+package stub
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"sort"
+	"strings"
+)
+
+// MethodCoverage is the number of stubs and calls of a method
+type MethodCoverage struct {
+	FullMethod string `json:"fullMethod"`
+	Stubs      int    `json:"stubs"`
+	// Calls counts the calls made to the method, matched by a stub or not
+	Calls int `json:"calls"`
+}
+
+type CoverageReport struct {
+	// Covered is true when all the methods have stubs and were called
+	Covered bool              `json:"covered"`
+	Methods []*MethodCoverage `json:"methods"`
+	// WithoutStubs and WithoutCalls highlight the methods not covered
+	WithoutStubs []string `json:"withoutStubs"`
+	WithoutCalls []string `json:"withoutCalls"`
+}
+
+// CheckCoverage counts the stubs and calls of each of the methods, with the calls counted by method in methodCalls.
+// The methods are sorted by name.
+func CheckCoverage(methods []string, stubs []*Stub, methodCalls CallCounter) *CoverageReport {
+	stubsByMethod := make(map[string]int, len(methods))
+	for _, s := range stubs {
+		stubsByMethod[s.FullMethod]++
+	}
+	report := &CoverageReport{
+		Methods:      make([]*MethodCoverage, 0, len(methods)),
+		WithoutStubs: make([]string, 0),
+		WithoutCalls: make([]string, 0),
+	}
+	sorted := append([]string(nil), methods...)
+	sort.Strings(sorted)
+	for _, method := range sorted {
+		coverage := &MethodCoverage{
+			FullMethod: method,
+			Stubs:      stubsByMethod[method],
+			Calls:      methodCalls.Get(method),
+		}
+		if coverage.Stubs == 0 {
+			report.WithoutStubs = append(report.WithoutStubs, method)
+		}
+		if coverage.Calls == 0 {
+			report.WithoutCalls = append(report.WithoutCalls, method)
+		}
+		report.Methods = append(report.Methods, coverage)
+	}
+	report.Covered = len(report.WithoutStubs) == 0 && len(report.WithoutCalls) == 0
+	return report
+}
+
+// JUnit returns the report as a JUnit test suite with a test case per method, failed when it has no stubs or calls
+func (r *CoverageReport) JUnit() *util.JUnitTestSuite {
+	testCases := make([]util.JUnitTestCase, 0, len(r.Methods))
+	for _, method := range r.Methods {
+		testCase := util.JUnitTestCase{Name: method.FullMethod, ClassName: "coverage"}
+		problems := make([]string, 0)
+		if method.Stubs == 0 {
+			problems = append(problems, "no stubs")
+		}
+		if method.Calls == 0 {
+			problems = append(problems, "no calls")
+		}
+		if len(problems) > 0 {
+			message := fmt.Sprintf("%s has %s", method.FullMethod, strings.Join(problems, " and "))
+			testCase.Failure = &util.JUnitFailure{Message: message, Text: message}
+		}
+		testCases = append(testCases, testCase)
+	}
+	return util.NewJUnitTestSuite("coverage", testCases)
+}
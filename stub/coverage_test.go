@@ -0,0 +1,39 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCheckCoverage(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}"))
+	store.Add(context.Background(), newTestStub("method1", "{\"name\":\"Mary\"}"))
+	store.Add(context.Background(), newTestStub("method2", "{}"))
+	methodCalls := NewInMemoryCallCounter()
+	matcher := NewStubsMatcher(store, WithMethodCallCounter(methodCalls))
+	matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}")
+	matcher.Match(context.Background(), "method3", "{\"name\":\"John\"}")
+
+	report := CheckCoverage([]string{"method3", "method2", "method1"}, allStubs(t, store), methodCalls)
+	assert.False(t, report.Covered)
+	assert.Equal(t, []*MethodCoverage{
+		{FullMethod: "method1", Stubs: 2, Calls: 1},
+		{FullMethod: "method2", Stubs: 1, Calls: 0},
+		{FullMethod: "method3", Stubs: 0, Calls: 1},
+	}, report.Methods)
+	assert.Equal(t, []string{"method3"}, report.WithoutStubs)
+	assert.Equal(t, []string{"method2"}, report.WithoutCalls)
+
+	suite := report.JUnit()
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	data, err := suite.Marshal()
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), "<failure message=\"method2 has no calls\">method2 has no calls</failure>"))
+
+	report = CheckCoverage([]string{"method1"}, allStubs(t, store), methodCalls)
+	assert.True(t, report.Covered)
+}
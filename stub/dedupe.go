@@ -0,0 +1,179 @@
+package stub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// DuplicateGroup is a set of stubs that match exactly the same requests
+type DuplicateGroup struct {
+	Fingerprint string `json:"fingerprint"`
+	FullMethod  string `json:"fullMethod"`
+	// Conflicting is true when the stubs respond differently, so they can't be merged and the response to their
+	// requests depends on the stub tried first
+	Conflicting bool    `json:"conflicting"`
+	Stubs       []*Stub `json:"stubs"`
+}
+
+// Fingerprint identifies the requests the stub matches. Only the fields that decide which calls the stub matches are
+// taken into account, as they are compared with the calls: the contents regardless of how their JSON is formatted or
+// how their numbers are written and without the fields set to default values (which the calls never carry, see
+// NormalizeContent), and the metadata regardless of the case of its keys and the order of its values. Stubs with the
+// same fingerprint are tried for the same requests.
+func (s *Stub) Fingerprint() string {
+	data, _ := json.Marshal(matchingFields(s))
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// matchingFields returns the fields of the stub that decide which calls it matches, in canonical form
+func matchingFields(s *Stub) map[string]interface{} {
+	fields := map[string]interface{}{"fullMethod": s.FullMethod, "set": s.Set}
+	// The scenario only restricts the calls matched when the stub requires a state
+	if s.Scenario != nil && s.Scenario.RequiredState != "" {
+		fields["scenario"] = []string{s.Scenario.Name, s.Scenario.RequiredState}
+	}
+	if s.Request == nil {
+		return fields
+	}
+	request := s.Request
+	fields["match"] = request.Match
+	if request.Match != "" {
+		fields["content"] = canonicalMatchJSON(request.Content.toMap(), true)
+	}
+	metadata := make(map[string][]string, len(request.Metadata))
+	for key, values := range getStubMetadata(&Stub{Request: request}) {
+		key = strings.ToLower(key)
+		metadata[key] = append(metadata[key], values...)
+		sort.Strings(metadata[key])
+	}
+	fields["metadata"] = metadata
+	matchers := &StubRequest{Peer: request.Peer, Transport: request.Transport, Claims: request.Claims,
+		MatchExpr: request.MatchExpr, Capture: request.Capture}
+	data, _ := json.Marshal(matchers)
+	var generic interface{}
+	json.Unmarshal(data, &generic)
+	fields["matchers"] = canonicalMatchJSON(generic, false)
+	return fields
+}
+
+// canonicalMatchJSON returns the JSON value without the fields set to null, false, 0, empty strings or empty lists and
+// with the items of the lists sorted, as they are matched in any order. The empty objects are dropped too unless
+// keepEmptyObjects is set, as in the contents they are messages that are set.
+func canonicalMatchJSON(value interface{}, keepEmptyObjects bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, field := range v {
+			if field = canonicalMatchJSON(field, keepEmptyObjects); !isDefaultJSON(field, keepEmptyObjects) {
+				object[key] = field
+			}
+		}
+		return object
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			items = append(items, canonicalMatchJSON(item, keepEmptyObjects))
+		}
+		sort.Slice(items, func(i, j int) bool {
+			left, _ := json.Marshal(items[i])
+			right, _ := json.Marshal(items[j])
+			return string(left) < string(right)
+		})
+		return items
+	}
+	return value
+}
+
+func isDefaultJSON(value interface{}, keepEmptyObjects bool) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0 && !keepEmptyObjects
+	}
+	return false
+}
+
+// FindDuplicates groups the stubs with the same fingerprint. Only the groups with more than one stub are returned,
+// sorted by method and fingerprint, with their stubs in the order given.
+func FindDuplicates(stubs []*Stub) []*DuplicateGroup {
+	groups := make([]*DuplicateGroup, 0)
+	byFingerprint := make(map[string]*DuplicateGroup, len(stubs))
+	for _, s := range stubs {
+		fingerprint := s.Fingerprint()
+		group, found := byFingerprint[fingerprint]
+		if !found {
+			group = &DuplicateGroup{Fingerprint: fingerprint, FullMethod: s.FullMethod}
+			byFingerprint[fingerprint] = group
+			groups = append(groups, group)
+		}
+		if len(group.Stubs) > 0 && behaviourKey(group.Stubs[0]) != behaviourKey(s) {
+			group.Conflicting = true
+		}
+		group.Stubs = append(group.Stubs, s)
+	}
+	duplicates := make([]*DuplicateGroup, 0)
+	for _, group := range groups {
+		if len(group.Stubs) > 1 {
+			duplicates = append(duplicates, group)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].FullMethod != duplicates[j].FullMethod {
+			return duplicates[i].FullMethod < duplicates[j].FullMethod
+		}
+		return duplicates[i].Fingerprint < duplicates[j].Fingerprint
+	})
+	return duplicates
+}
+
+// Dedupe merges the stubs that match the same requests with the same response into the first of them, which keeps
+// its description and name. The conflicting stubs are all kept. It returns the stubs kept, in the order given, and
+// the ones merged into them.
+func Dedupe(stubs []*Stub) (kept []*Stub, merged []*Stub) {
+	mergeable := make(map[string]bool, 0)
+	for _, group := range FindDuplicates(stubs) {
+		if !group.Conflicting {
+			mergeable[group.Fingerprint] = true
+		}
+	}
+	kept = make([]*Stub, 0, len(stubs))
+	merged = make([]*Stub, 0)
+	seen := make(map[string]bool, len(mergeable))
+	for _, s := range stubs {
+		fingerprint := s.Fingerprint()
+		if mergeable[fingerprint] && seen[fingerprint] {
+			merged = append(merged, s)
+			continue
+		}
+		seen[fingerprint] = true
+		kept = append(kept, s)
+	}
+	return kept, merged
+}
+
+// behaviourKey identifies what the stub does when it matches a request: the response, the scenario state it moves to
+// and the seed of its random values
+func behaviourKey(s *Stub) string {
+	behaviour := map[string]interface{}{
+		"response": toGenericJSON(&Stub{Response: s.Response}),
+		"seed":     s.Seed,
+	}
+	if s.Scenario != nil {
+		behaviour["newState"] = s.Scenario.NewState
+	}
+	data, _ := json.Marshal(behaviour)
+	return string(data)
+}
@@ -0,0 +1,63 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	first := newLintStub("/test.Orders/Get", "exact", "{\"id\":1,\"name\":\"a\"}", "{\"id\":1}")
+	first.Description = "first"
+	same := newLintStub("/test.Orders/Get", "exact", "{\"name\": \"a\", \"id\": 1}", "{ \"id\": 1 }")
+	same.Description = "same response"
+	conflicting := newLintStub("/test.Orders/Get", "exact", "{\"id\":2}", "{\"id\":2}")
+	conflictingOther := newLintStub("/test.Orders/Get", "exact", "{\"id\":2}", "{\"id\":3}")
+	partial := newLintStub("/test.Orders/Get", "partial", "{\"id\":1,\"name\":\"a\"}", "{\"id\":1}")
+	stubs := []*Stub{first, conflicting, partial, same, conflictingOther}
+
+	assert.Equal(t, first.Fingerprint(), same.Fingerprint())
+	assert.NotEqual(t, first.Fingerprint(), partial.Fingerprint())
+	groups := FindDuplicates(stubs)
+	assert.Len(t, groups, 2)
+	for _, group := range groups {
+		switch group.Fingerprint {
+		case first.Fingerprint():
+			assert.False(t, group.Conflicting)
+			assert.Equal(t, []*Stub{first, same}, group.Stubs)
+		case conflicting.Fingerprint():
+			assert.True(t, group.Conflicting)
+			assert.Equal(t, []*Stub{conflicting, conflictingOther}, group.Stubs)
+		default:
+			t.Errorf("unexpected group %s", group.Fingerprint)
+		}
+	}
+
+	kept, merged := Dedupe(stubs)
+	assert.Equal(t, []*Stub{first, conflicting, partial, conflictingOther}, kept)
+	assert.Equal(t, []*Stub{same}, merged)
+}
+
+func TestFindDuplicates_ThroughTheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStubsStore()
+	first := newLintStub("/test.Orders/Get", "exact", "{\"id\":1}", "{\"id\":1}")
+	first.Request.Metadata = map[string][]string{"X-Tenant": {"a", " b"}}
+	first.Labels = map[string]string{"team": "orders"}
+	same := newLintStub("/test.Orders/Get", "exact", "{\"id\":1.0,\"name\":\"\",\"tags\":[]}", "{\"id\":1}")
+	same.Request.Metadata = map[string][]string{"x-tenant": {"b", "a"}}
+	same.Description = "same request"
+	other := newLintStub("/test.Orders/Get", "exact", "{\"id\":1}", "{\"id\":1}")
+	other.Request.Metadata = map[string][]string{"x-tenant": {"c"}}
+	for _, s := range []*Stub{first, same, other} {
+		assert.NoError(t, store.Add(ctx, s))
+	}
+
+	stubs, err := store.GetAllStubs(ctx)
+	assert.NoError(t, err)
+	groups := FindDuplicates(stubs)
+	if assert.Len(t, groups, 1) {
+		assert.False(t, groups[0].Conflicting)
+		assert.ElementsMatch(t, []string{first.ID, same.ID}, []string{groups[0].Stubs[0].ID, groups[0].Stubs[1].ID})
+	}
+}
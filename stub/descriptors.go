@@ -0,0 +1,116 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DescriptorsFetcher returns the serialized FileDescriptorSet (with imports) of the services, e.g. a Buf image
+type DescriptorsFetcher func(ctx context.Context) ([]byte, error)
+
+// DescriptorsStatus describes the descriptors of the services and the stubs that don't match them
+type DescriptorsStatus struct {
+	// RefreshedAt is when the descriptors were fetched, not set when they were never fetched
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	// Methods are the full methods of the services, sorted
+	Methods []string `json:"methods"`
+	// Issues are the problems of the stubs with the methods and messages of the descriptors
+	Issues []DescriptorIssue `json:"issues"`
+}
+
+// DescriptorIssue is a stub that doesn't match the descriptors of its service
+type DescriptorIssue struct {
+	StubID     string `json:"stubId"`
+	FullMethod string `json:"fullMethod"`
+	Message    string `json:"message"`
+}
+
+// Descriptors keeps the descriptors of the services, fetched on demand, so that the stubs can be checked against the
+// current version of the APIs without rebuilding the mock. It is safe for concurrent use.
+type Descriptors struct {
+	fetch       DescriptorsFetcher
+	files       *protoregistry.Files
+	refreshedAt *time.Time
+	mutex       sync.RWMutex
+}
+
+func NewDescriptors(fetch DescriptorsFetcher) *Descriptors {
+	return &Descriptors{fetch: fetch}
+}
+
+// Refresh fetches the descriptors again. The previous descriptors are kept when they can't be fetched or are not
+// valid.
+func (d *Descriptors) Refresh(ctx context.Context) error {
+	data, err := d.fetch(ctx)
+	if err != nil {
+		return fmt.Errorf("could not fetch the descriptors: %w", err)
+	}
+	files, err := ParseDescriptorSet(data)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.files = files
+	d.refreshedAt = &now
+	return nil
+}
+
+// Files returns the descriptors, nil when they were never fetched
+func (d *Descriptors) Files() *protoregistry.Files {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.files
+}
+
+// GetStatus describes the descriptors and checks the stubs against them
+func (d *Descriptors) GetStatus(stubs []*Stub) DescriptorsStatus {
+	d.mutex.RLock()
+	files, refreshedAt := d.files, d.refreshedAt
+	d.mutex.RUnlock()
+
+	status := DescriptorsStatus{RefreshedAt: refreshedAt, Methods: make([]string, 0), Issues: make([]DescriptorIssue, 0)}
+	if files == nil {
+		return status
+	}
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		for i := 0; i < file.Services().Len(); i++ {
+			service := file.Services().Get(i)
+			for j := 0; j < service.Methods().Len(); j++ {
+				status.Methods = append(status.Methods, fmt.Sprintf("/%s/%s", service.FullName(), service.Methods().Get(j).Name()))
+			}
+		}
+		return true
+	})
+	sort.Strings(status.Methods)
+	for _, s := range stubs {
+		for _, msg := range lintSchema(s, files) {
+			status.Issues = append(status.Issues, DescriptorIssue{StubID: s.ID, FullMethod: s.FullMethod, Message: msg})
+		}
+	}
+	return status
+}
+
+// ParseDescriptorSet reads a serialized FileDescriptorSet, which must have the imports of its files
+func ParseDescriptorSet(data []byte) (*protoregistry.Files, error) {
+	set := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(data, set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,50 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+)
+
+func TestDescriptors_Refresh(t *testing.T) {
+	set := new(descriptorpb.FileDescriptorSet)
+	newLintFiles(t).RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+		return true
+	})
+	data, err := proto.Marshal(set)
+	assert.NoError(t, err)
+	var fetchErr error
+	descriptors := NewDescriptors(func(ctx context.Context) ([]byte, error) {
+		return data, fetchErr
+	})
+	valid := newLintStub("/test.Orders/Get", "exact", "{\"id\":1}", "{\"id\":1}")
+	valid.ID = "1"
+	removed := newLintStub("/test.Orders/List", "exact", "{}", "{}")
+	removed.ID = "2"
+
+	status := descriptors.GetStatus([]*Stub{valid, removed})
+	assert.Nil(t, status.RefreshedAt)
+	assert.Empty(t, status.Issues)
+
+	assert.NoError(t, descriptors.Refresh(context.Background()))
+	status = descriptors.GetStatus([]*Stub{valid, removed})
+	assert.NotNil(t, status.RefreshedAt)
+	assert.Equal(t, []string{"/test.Orders/Get"}, status.Methods)
+	assert.Equal(t, []DescriptorIssue{
+		{StubID: "2", FullMethod: "/test.Orders/List", Message: "Method /test.Orders/List does not exist."},
+	}, status.Issues)
+
+	// The previous descriptors are kept when the new ones can't be fetched or are not valid
+	fetchErr = fmt.Errorf("unavailable")
+	assert.EqualError(t, descriptors.Refresh(context.Background()), "could not fetch the descriptors: unavailable")
+	fetchErr, data = nil, []byte("invalid")
+	assert.Error(t, descriptors.Refresh(context.Background()))
+	assert.NotNil(t, descriptors.Files())
+	assert.Equal(t, []string{"/test.Orders/Get"}, descriptors.GetStatus(nil).Methods)
+}
@@ -0,0 +1,184 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldDiff describes a single field that differs between two stubs. Path uses a dot notation, with array indexes
+// between brackets (e.g. "response.content.items[0].name").
+type FieldDiff struct {
+	Path string      `json:"path"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// DiffStubs returns the fields that differ between before and after. Either of them can be nil, in which case all
+// fields of the other stub are reported as added or removed.
+func DiffStubs(before, after *Stub) []FieldDiff {
+	return diffValues("", toGenericJSON(before), toGenericJSON(after), make([]FieldDiff, 0))
+}
+
+// DiffValues returns the fields that differ between two generic JSON values (as decoded by encoding/json), with their
+// paths under the path given
+func DiffValues(path string, old, new interface{}) []FieldDiff {
+	return diffValues(path, old, new, make([]FieldDiff, 0))
+}
+
+func toGenericJSON(s *Stub) interface{} {
+	if s == nil {
+		return nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil
+	}
+	var value interface{}
+	json.Unmarshal(data, &value)
+	return value
+}
+
+func diffValues(path string, old, new interface{}, diffs []FieldDiff) []FieldDiff {
+	oldMap, oldIsMap := old.(map[string]interface{})
+	newMap, newIsMap := new.(map[string]interface{})
+	if (oldIsMap || old == nil) && (newIsMap || new == nil) && (oldIsMap || newIsMap) {
+		for _, key := range unionKeys(oldMap, newMap) {
+			diffs = diffValues(joinPath(path, key), oldMap[key], newMap[key], diffs)
+		}
+		return diffs
+	}
+	oldSlice, oldIsSlice := old.([]interface{})
+	newSlice, newIsSlice := new.([]interface{})
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			var oldItem, newItem interface{}
+			if i < len(oldSlice) {
+				oldItem = oldSlice[i]
+			}
+			if i < len(newSlice) {
+				newItem = newSlice[i]
+			}
+			diffs = diffValues(fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, diffs)
+		}
+		return diffs
+	}
+	if !reflect.DeepEqual(old, new) {
+		diffs = append(diffs, FieldDiff{Path: path, Old: old, New: new})
+	}
+	return diffs
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, found := a[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Fields of the stubs maintained by the server, which differ between servers holding the same stubs
+var serverMaintainedFields = map[string]bool{
+	"id":        true,
+	"version":   true,
+	"createdBy": true,
+	"createdAt": true,
+	"updatedAt": true,
+}
+
+// StubChange is a stub that is in both sets compared with different fields
+type StubChange struct {
+	FullMethod string      `json:"fullMethod"`
+	Before     *Stub       `json:"before"`
+	After      *Stub       `json:"after"`
+	Diffs      []FieldDiff `json:"diffs"`
+}
+
+// StubSetDiff lists the differences between two sets of stubs
+type StubSetDiff struct {
+	// Identical is true when there are no stubs added, removed or changed
+	Identical bool          `json:"identical"`
+	Added     []*Stub       `json:"added"`
+	Removed   []*Stub       `json:"removed"`
+	Changed   []*StubChange `json:"changed"`
+}
+
+// DiffStubSets compares two sets of stubs. The stubs of both sets are paired by method and the requests they match
+// (including the scenario state), regardless of how their JSON is formatted, and the pairs are changed when any of
+// their other fields differ. The fields maintained by the server (ID, version and authorship) are not compared. The
+// stubs are sorted by method and request.
+func DiffStubSets(before, after []*Stub) *StubSetDiff {
+	diff := &StubSetDiff{
+		Added:   make([]*Stub, 0),
+		Removed: make([]*Stub, 0),
+		Changed: make([]*StubChange, 0),
+	}
+	beforeByKey := make(map[string]*Stub, len(before))
+	for _, s := range before {
+		beforeByKey[matcherKey(s)] = s
+	}
+	afterByKey := make(map[string]*Stub, len(after))
+	for _, s := range after {
+		key := matcherKey(s)
+		afterByKey[key] = s
+		b, found := beforeByKey[key]
+		if !found {
+			diff.Added = append(diff.Added, s)
+			continue
+		}
+		fieldDiffs := make([]FieldDiff, 0)
+		for _, d := range DiffStubs(b, s) {
+			if !serverMaintainedFields[d.Path] && !strings.HasPrefix(d.Path, "request.") {
+				fieldDiffs = append(fieldDiffs, d)
+			}
+		}
+		if len(fieldDiffs) > 0 {
+			diff.Changed = append(diff.Changed, &StubChange{FullMethod: s.FullMethod, Before: b, After: s, Diffs: fieldDiffs})
+		}
+	}
+	for _, s := range before {
+		if _, found := afterByKey[matcherKey(s)]; !found {
+			diff.Removed = append(diff.Removed, s)
+		}
+	}
+	sortStubs(diff.Added)
+	sortStubs(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return matcherKey(diff.Changed[i].After) < matcherKey(diff.Changed[j].After)
+	})
+	diff.Identical = len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+	return diff
+}
+
+// matcherKey identifies the requests a stub matches: its method, request matcher (regardless of how its JSON is
+// written, see Stub.key) and required scenario state
+func matcherKey(s *Stub) string {
+	request := StubRequest{}
+	if s.Request != nil {
+		request = StubRequest{Match: s.Request.Match, Content: s.Request.Content, Metadata: s.Request.Metadata,
+			Peer: s.Request.Peer, Transport: s.Request.Transport, Claims: s.Request.Claims, MatchExpr: s.Request.MatchExpr, Capture: s.Request.Capture}
+	}
+	stubWithRequest := Stub{Request: &request, Scenario: s.Scenario, Set: s.Set}
+	return s.FullMethod + "|" + stubWithRequest.key()
+}
+
+func sortStubs(stubs []*Stub) {
+	sort.Slice(stubs, func(i, j int) bool {
+		return matcherKey(stubs[i]) < matcherKey(stubs[j])
+	})
+}
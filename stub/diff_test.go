@@ -0,0 +1,33 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDiffStubSets(t *testing.T) {
+	unchanged := newLintStub("/test.Orders/Get", "exact", "{\"id\":1,\"name\":\"a\"}", "{\"id\":1}")
+	unchanged.ID, unchanged.Version = "staging-1", 3
+	changed := newLintStub("/test.Orders/Get", "exact", "{\"id\":2}", "{\"id\":2,\"status\":\"OPEN\"}")
+	removed := newLintStub("/test.Orders/Get", "exact", "{\"id\":3}", "{}")
+	from := []*Stub{unchanged, changed, removed}
+
+	// Same request formatted differently, with other server maintained fields
+	unchangedAfter := newLintStub("/test.Orders/Get", "exact", "{\"name\": \"a\", \"id\": 1}", "{\"id\":1}")
+	unchangedAfter.ID, unchangedAfter.CreatedBy = "ci-1", "ci"
+	changedAfter := newLintStub("/test.Orders/Get", "exact", "{\"id\":2}", "{\"id\":2,\"status\":\"CLOSED\"}")
+	added := newLintStub("/test.Orders/Get", "partial", "{\"id\":3}", "{}")
+	to := []*Stub{added, changedAfter, unchangedAfter}
+
+	diff := DiffStubSets(from, to)
+	assert.False(t, diff.Identical)
+	assert.Equal(t, []*Stub{added}, diff.Added)
+	assert.Equal(t, []*Stub{removed}, diff.Removed)
+	assert.Len(t, diff.Changed, 1)
+	assert.Equal(t, changed, diff.Changed[0].Before)
+	assert.Equal(t, changedAfter, diff.Changed[0].After)
+	assert.Equal(t, []FieldDiff{{Path: "response.content.status", Old: "OPEN", New: "CLOSED"}}, diff.Changed[0].Diffs)
+
+	diff = DiffStubSets(from, from)
+	assert.True(t, diff.Identical)
+}
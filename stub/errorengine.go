@@ -10,7 +10,9 @@ import (
 	"os"
 	"os/exec"
 	"plugin"
+	"reflect"
 	"strings"
+	"sync"
 )
 
 func NewCustomErrorEngine(path string) (CustomErrorEngine, error) {
@@ -33,9 +35,15 @@ type customError struct {
 type customErrorEngine struct {
 	BasePath       string
 	errorTypeCache map[string]customError
+	// Serializes the access to the cache. It also guarantees that the same plugin is not compiled concurrently when
+	// several requests need the same error type at the same time.
+	mutex sync.Mutex
 }
 
 func (e *customErrorEngine) GetNewInstance(spec *ErrorDetailsSpec) (interface{}, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
 	if !e.exists(spec) {
 		errorType, err := e.createErrorType(spec)
 		if err != nil {
@@ -43,7 +51,9 @@ func (e *customErrorEngine) GetNewInstance(spec *ErrorDetailsSpec) (interface{},
 		}
 		e.errorTypeCache[getKey(spec)] = *errorType
 	}
-	return e.errorTypeCache[getKey(spec)].ErrorType, nil
+	// The cached instance is only used as a prototype, every caller gets its own instance to fill in.
+	prototype := e.errorTypeCache[getKey(spec)].ErrorType
+	return reflect.New(reflect.TypeOf(prototype).Elem()).Interface(), nil
 }
 
 func (e *customErrorEngine) exists(spec *ErrorDetailsSpec) bool {
@@ -0,0 +1,146 @@
+package stub
+
+import (
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	ExpectationSatisfied   = "satisfied"
+	ExpectationUnderCalled = "under-called"
+	ExpectationOverCalled  = "over-called"
+)
+
+// ExpectedCalls is the number of times a stub is expected to be matched. There is no upper limit when Max is nil.
+type ExpectedCalls struct {
+	Min int  `json:"min"`
+	Max *int `json:"max,omitempty"`
+}
+
+// CallCounter counts the times each stub was matched. Implementations must be safe for concurrent use.
+type CallCounter interface {
+	Increment(stubID string)
+	Get(stubID string) int
+	Reset()
+}
+
+func NewInMemoryCallCounter() CallCounter {
+	return new(inMemoryCallCounter)
+}
+
+// inMemoryCallCounter is incremented on every call matched, so it avoids locks: the counters are created once per stub
+// and incremented atomically.
+type inMemoryCallCounter struct {
+	// *int64 counters by stub ID
+	calls sync.Map
+}
+
+func (c *inMemoryCallCounter) Increment(stubID string) {
+	counter, ok := c.calls.Load(stubID)
+	if !ok {
+		counter, _ = c.calls.LoadOrStore(stubID, new(int64))
+	}
+	atomic.AddInt64(counter.(*int64), 1)
+}
+
+func (c *inMemoryCallCounter) Get(stubID string) int {
+	counter, ok := c.calls.Load(stubID)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt64(counter.(*int64)))
+}
+
+func (c *inMemoryCallCounter) Reset() {
+	c.calls.Range(func(stubID, counter interface{}) bool {
+		atomic.StoreInt64(counter.(*int64), 0)
+		return true
+	})
+}
+
+// ExpectationResult compares the calls made to a stub with the calls expected
+type ExpectationResult struct {
+	StubID        string         `json:"stubId"`
+	FullMethod    string         `json:"fullMethod"`
+	Description   string         `json:"description,omitempty"`
+	ExpectedCalls *ExpectedCalls `json:"expectedCalls"`
+	Calls         int            `json:"calls"`
+	Status        string         `json:"status"`
+}
+
+type ExpectationsReport struct {
+	// Satisfied is true when all the stubs were called the expected number of times
+	Satisfied bool                 `json:"satisfied"`
+	Results   []*ExpectationResult `json:"results"`
+}
+
+// CheckExpectations checks the calls made to the stubs with expectations, sorted by method and stub ID
+func CheckExpectations(stubs []*Stub, counter CallCounter) *ExpectationsReport {
+	report := &ExpectationsReport{
+		Satisfied: true,
+		Results:   make([]*ExpectationResult, 0),
+	}
+	for _, e := range stubs {
+		if e.ExpectedCalls == nil {
+			continue
+		}
+		result := &ExpectationResult{
+			StubID:        e.ID,
+			FullMethod:    e.FullMethod,
+			Description:   e.Description,
+			ExpectedCalls: e.ExpectedCalls,
+			Calls:         counter.Get(e.ID),
+			Status:        ExpectationSatisfied,
+		}
+		switch {
+		case result.Calls < e.ExpectedCalls.Min:
+			result.Status = ExpectationUnderCalled
+		case e.ExpectedCalls.Max != nil && result.Calls > *e.ExpectedCalls.Max:
+			result.Status = ExpectationOverCalled
+		}
+		report.Satisfied = report.Satisfied && result.Status == ExpectationSatisfied
+		report.Results = append(report.Results, result)
+	}
+	sort.Slice(report.Results, func(i, j int) bool {
+		if report.Results[i].FullMethod != report.Results[j].FullMethod {
+			return report.Results[i].FullMethod < report.Results[j].FullMethod
+		}
+		return report.Results[i].StubID < report.Results[j].StubID
+	})
+	return report
+}
+
+// JUnit returns the report as a JUnit test suite with a test case per stub, failed when the stub wasn't called the
+// number of times expected
+func (r *ExpectationsReport) JUnit() *util.JUnitTestSuite {
+	testCases := make([]util.JUnitTestCase, 0, len(r.Results))
+	for _, result := range r.Results {
+		name := result.StubID
+		if result.Description != "" {
+			name += " " + result.Description
+		}
+		testCase := util.JUnitTestCase{Name: name, ClassName: "expectations." + result.FullMethod}
+		if result.Status != ExpectationSatisfied {
+			message := fmt.Sprintf("stub %s is %s: called %d times, expected %s", result.StubID, result.Status,
+				result.Calls, result.ExpectedCalls)
+			testCase.Failure = &util.JUnitFailure{Message: message, Text: message}
+		}
+		testCases = append(testCases, testCase)
+	}
+	return util.NewJUnitTestSuite("expectations", testCases)
+}
+
+// String describes the calls expected, e.g. at least 1 or between 1 and 3
+func (e *ExpectedCalls) String() string {
+	switch {
+	case e.Max == nil:
+		return fmt.Sprintf("at least %d", e.Min)
+	case *e.Max == e.Min:
+		return fmt.Sprintf("exactly %d", e.Min)
+	default:
+		return fmt.Sprintf("between %d and %d", e.Min, *e.Max)
+	}
+}
@@ -0,0 +1,45 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckExpectations(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	max := 1
+	once := newTestStub("method1", "{\"name\":\"John\"}")
+	once.ExpectedCalls = &ExpectedCalls{Min: 1, Max: &max}
+	atLeastOnce := newTestStub("method2", "{\"name\":\"John\"}")
+	atLeastOnce.ExpectedCalls = &ExpectedCalls{Min: 1}
+	store.Add(context.Background(), once)
+	store.Add(context.Background(), atLeastOnce)
+	store.Add(context.Background(), newTestStub("method3", "{}"))
+	counter := NewInMemoryCallCounter()
+	matcher := NewStubsMatcher(store, WithCallCounter(counter))
+
+	report := CheckExpectations(allStubs(t, store), counter)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, 2, len(report.Results))
+	assert.Equal(t, ExpectationUnderCalled, report.Results[0].Status)
+
+	matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}")
+	matcher.Match(context.Background(), "method2", "{\"name\":\"John\"}")
+	matcher.Match(context.Background(), "method2", "{\"name\":\"John\"}")
+	report = CheckExpectations(allStubs(t, store), counter)
+	assert.True(t, report.Satisfied)
+	assert.Equal(t, 2, report.Results[1].Calls)
+
+	matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}")
+	report = CheckExpectations(allStubs(t, store), counter)
+	assert.False(t, report.Satisfied)
+	assert.Equal(t, ExpectationOverCalled, report.Results[0].Status)
+	suite := report.JUnit()
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, "stub "+once.ID+" is over-called: called 2 times, expected exactly 1", suite.TestCases[0].Failure.Message)
+
+	counter.Reset()
+	assert.Equal(t, 0, counter.Get(once.ID))
+}
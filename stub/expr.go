@@ -0,0 +1,1069 @@
+package stub
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The expressions of the response templates (see template.go) are written in a small expression language of the mock
+// server, evaluated over the JSON of the request. Its syntax is close to the one of CEL, but it is not CEL (unlike the
+// matching expressions, see cel.go): the expressions are not type checked, the values are the JSON ones and there are
+// no integer, bytes, timestamp or duration types. It supports exactly:
+//   - literals: numbers (decimal, with an optional fraction and exponent, and a u suffix that is ignored), strings
+//     ('...' or "...", with the escapes \n, \t, \r and a backslash before any other character for the character
+//     itself), true, false, null, lists [...] and maps {...} with string keys
+//   - variables: request (the request as encoded by protojson), metadata (each key with a list of values), capture,
+//     now and state
+//   - field selection (request.customer.name), indexes (request.items[0], metadata['x-tenant']) and has(request.field),
+//     which is false for the fields missing from the JSON
+//   - operators, by increasing precedence: ?:, ||, &&, == != < <= > >= in, + -, * / %, and the unary ! and -
+//   - functions, called as f(x, y) or as methods x.f(y): size, int, double, string, contains, startsWith, endsWith,
+//     matches, lowerAscii, upperAscii, sha256, sha1, md5, base64Encode, base64Decode, capitalize, camelCase, snakeCase,
+//     kebabCase, round(number, places), floor, ceil, abs, min, max, sum(list), addYears, addMonths, addDays, addHours,
+//     addMinutes and addSeconds(date, n), and in the response templates get(key), set(key, value) and incr(key) of the
+//     variable state
+//   - macros on lists and the keys of maps: all, exists, exists_one, filter and map
+//
+// The values are the ones of JSON: null, booleans, doubles, strings, lists and maps. The fields are named by their JSON
+// names, the enums by their names, the 64 bit integers are strings and the fields with default values are missing, as
+// protojson encodes them, so selecting them is an error. All the numbers are doubles (int only truncates them), and the
+// strings compared with numbers, or added to a number on their left, are converted into numbers. == and != compare
+// numerically when a side is a number and deeply otherwise, < <= > >= compare two strings lexicographically and
+// anything else as numbers, + adds numbers and concatenates strings and lists and % is the remainder of the division of
+// doubles. An error on one side of && or || is ignored when the other side decides the result. The errors are only
+// found when the expression is evaluated (e.g. a missing field, a value of the wrong type or an unknown function).
+
+// templateExpr is a compiled template expression
+type templateExpr struct {
+	root exprNode
+}
+
+type exprEnv map[string]interface{}
+
+type exprNode interface {
+	eval(env exprEnv) (interface{}, error)
+}
+
+// compileExpr parses the expression
+func compileExpr(src string) (*templateExpr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos)
+	}
+	return &templateExpr{root: root}, nil
+}
+
+// Tokenizer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  tokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "*", "/", "%", "?", ":", ".", ",", "(", ")", "[", "]", "{", "}"}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	tokens := make([]exprToken, 0)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: src[start:i], pos: start})
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == 'e' || src[i] == 'E' ||
+				((src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E'))) {
+				i++
+			}
+			number, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", src[start:i], start)
+			}
+			// Unsigned integers (e.g. 1u) are numbers too
+			if i < len(src) && (src[i] == 'u' || src[i] == 'U') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: src[start:i], value: number, pos: start})
+		case c == '\'' || c == '"':
+			value, end, err := readExprString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: src[i:end], value: value, pos: i})
+			i = end
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// readExprString reads the quoted string starting at start and returns its value and the position after it
+func readExprString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var value strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == quote:
+			return value.String(), i + 1, nil
+		case c == '\\' && i+1 < len(src):
+			i++
+			switch src[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			default:
+				value.WriteByte(src[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at position %d", start)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// Parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the operator or keyword given
+func (p *exprParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokenOperator || t.kind == tokenIdent) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		t := p.peek()
+		if t.kind == tokenEOF {
+			return fmt.Errorf("expected '%s' at the end of the expression", text)
+		}
+		return fmt.Errorf("expected '%s' at position %d, got '%s'", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	condition, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("?") {
+		return condition, nil
+	}
+	ifTrue, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	ifFalse, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return conditionalNode{condition: condition, ifTrue: ifTrue, ifFalse: ifFalse}, nil
+}
+
+// Binary operators by precedence, lowest first
+var exprPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(exprPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range exprPrecedence[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	for _, op := range []string{"!", "-"} {
+		if p.accept(op) {
+			operand, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return unaryNode{op: op, operand: operand}, nil
+		}
+	}
+	return p.parseMember()
+}
+
+func (p *exprParser) parseMember() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			t := p.next()
+			if t.kind != tokenIdent {
+				return nil, fmt.Errorf("expected a field name at position %d", t.pos)
+			}
+			if !p.accept("(") {
+				node = selectNode{operand: node, field: t.text}
+				continue
+			}
+			if macro, isMacro := exprMacros[t.text]; isMacro {
+				node, err = p.parseMacro(node, t.text, macro)
+			} else {
+				var args []exprNode
+				args, err = p.parseArgs(")")
+				node = callNode{target: node, function: t.text, args: args}
+			}
+			if err != nil {
+				return nil, err
+			}
+		case p.accept("["):
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = indexNode{operand: node, index: index}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *exprParser) parseMacro(target exprNode, name string, macro comprehensionKind) (exprNode, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, fmt.Errorf("expected a variable name in %s at position %d", name, t.pos)
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	body, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return comprehensionNode{kind: macro, target: target, variable: t.text, body: body}, nil
+}
+
+func (p *exprParser) parseArgs(closing string) ([]exprNode, error) {
+	args := make([]exprNode, 0)
+	if p.accept(closing) {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.accept(closing) {
+			return args, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber, tokenString:
+		return literalNode{value: t.value}, nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		if !p.accept("(") {
+			return identNode{name: t.text}, nil
+		}
+		if t.text == "has" {
+			return p.parseHas()
+		}
+		args, err := p.parseArgs(")")
+		if err != nil {
+			return nil, err
+		}
+		return callNode{function: t.text, args: args}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			node, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return listNode{items: items}, nil
+		case "{":
+			return p.parseMap()
+		}
+	case tokenEOF:
+		return nil, fmt.Errorf("unexpected end of the expression")
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos)
+}
+
+func (p *exprParser) parseHas() (exprNode, error) {
+	arg, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	field, ok := arg.(selectNode)
+	if !ok {
+		return nil, fmt.Errorf("the argument of has must be a field selection, e.g. has(request.name)")
+	}
+	return hasNode{field: field}, nil
+}
+
+func (p *exprParser) parseMap() (exprNode, error) {
+	node := mapNode{}
+	if p.accept("}") {
+		return node, nil
+	}
+	for {
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		node.keys = append(node.keys, key)
+		node.values = append(node.values, value)
+		if p.accept("}") {
+			return node, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Evaluation
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type identNode struct {
+	name string
+}
+
+func (n identNode) eval(env exprEnv) (interface{}, error) {
+	value, found := env[n.name]
+	if !found {
+		return nil, fmt.Errorf("undeclared reference to '%s'", n.name)
+	}
+	return value, nil
+}
+
+type selectNode struct {
+	operand exprNode
+	field   string
+}
+
+func (n selectNode) eval(env exprEnv) (interface{}, error) {
+	operand, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := operand.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("can't select field '%s' of %s", n.field, exprTypeName(operand))
+	}
+	value, found := object[n.field]
+	if !found {
+		return nil, fmt.Errorf("no such field '%s'", n.field)
+	}
+	return value, nil
+}
+
+type hasNode struct {
+	field selectNode
+}
+
+func (n hasNode) eval(env exprEnv) (interface{}, error) {
+	operand, err := n.field.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := operand.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("can't select field '%s' of %s", n.field.field, exprTypeName(operand))
+	}
+	_, found := object[n.field.field]
+	return found, nil
+}
+
+type indexNode struct {
+	operand exprNode
+	index   exprNode
+}
+
+func (n indexNode) eval(env exprEnv) (interface{}, error) {
+	operand, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := n.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch o := operand.(type) {
+	case []interface{}:
+		i, ok := toExprNumber(index)
+		if !ok || i != math.Trunc(i) || i < 0 || int(i) >= len(o) {
+			return nil, fmt.Errorf("invalid list index %v", index)
+		}
+		return o[int(i)], nil
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid map key %v", index)
+		}
+		value, found := o[key]
+		if !found {
+			return nil, fmt.Errorf("no such key '%s'", key)
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("can't index %s", exprTypeName(operand))
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n listNode) eval(env exprEnv) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+type mapNode struct {
+	keys   []exprNode
+	values []exprNode
+}
+
+func (n mapNode) eval(env exprEnv) (interface{}, error) {
+	object := make(map[string]interface{}, len(n.keys))
+	for i := range n.keys {
+		key, err := n.keys[i].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		keyString, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be strings, got %s", exprTypeName(key))
+		}
+		value, err := n.values[i].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		object[keyString] = value
+	}
+	return object, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n unaryNode) eval(env exprEnv) (interface{}, error) {
+	operand, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := operand.(bool)
+		if !ok {
+			return nil, fmt.Errorf("can't negate %s", exprTypeName(operand))
+		}
+		return !b, nil
+	}
+	number, ok := toExprNumber(operand)
+	if !ok {
+		return nil, fmt.Errorf("can't negate %s", exprTypeName(operand))
+	}
+	return -number, nil
+}
+
+type conditionalNode struct {
+	condition exprNode
+	ifTrue    exprNode
+	ifFalse   exprNode
+}
+
+func (n conditionalNode) eval(env exprEnv) (interface{}, error) {
+	condition, err := n.condition.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := condition.(bool)
+	if !ok {
+		return nil, fmt.Errorf("the condition must be a boolean, got %s", exprTypeName(condition))
+	}
+	if b {
+		return n.ifTrue.eval(env)
+	}
+	return n.ifFalse.eval(env)
+}
+
+type binaryNode struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+func (n binaryNode) eval(env exprEnv) (interface{}, error) {
+	if n.op == "&&" || n.op == "||" {
+		return n.evalLogical(env)
+	}
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return exprEquals(left, right), nil
+	case "!=":
+		return !exprEquals(left, right), nil
+	case "<", "<=", ">", ">=":
+		return exprCompare(n.op, left, right)
+	case "in":
+		return exprIn(left, right)
+	case "+":
+		return exprAdd(left, right)
+	}
+	l, lok := toExprNumber(left)
+	r, rok := toExprNumber(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("can't apply '%s' to %s and %s", n.op, exprTypeName(left), exprTypeName(right))
+	}
+	switch n.op {
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	default:
+		if r == 0 {
+			return nil, fmt.Errorf("modulus by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+}
+
+// evalLogical evaluates && and || regardless of the order of their sides: an error on one side is ignored when the
+// other side decides the result
+func (n binaryNode) evalLogical(env exprEnv) (interface{}, error) {
+	decisive := n.op == "||"
+	left, leftErr := evalBool(n.left, env)
+	if leftErr == nil && left == decisive {
+		return decisive, nil
+	}
+	right, rightErr := evalBool(n.right, env)
+	if rightErr == nil && right == decisive {
+		return decisive, nil
+	}
+	if leftErr != nil {
+		return nil, leftErr
+	}
+	if rightErr != nil {
+		return nil, rightErr
+	}
+	return !decisive, nil
+}
+
+func evalBool(node exprNode, env exprEnv) (bool, error) {
+	value, err := node.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %s", exprTypeName(value))
+	}
+	return b, nil
+}
+
+type callNode struct {
+	// target is the receiver of the methods and nil for global functions
+	target   exprNode
+	function string
+	args     []exprNode
+}
+
+func (n callNode) eval(env exprEnv) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args)+1)
+	if n.target != nil {
+		target, err := n.target.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, target)
+	}
+	for _, arg := range n.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	function, found := exprFunctions[n.function]
+	if !found {
+		return nil, fmt.Errorf("unknown function '%s'", n.function)
+	}
+	if len(args) != function.args {
+		return nil, fmt.Errorf("function '%s' expects %d arguments, got %d", n.function, function.args, len(args))
+	}
+	return function.call(args)
+}
+
+type exprFunction struct {
+	// args is the number of arguments, including the receiver of the methods
+	args int
+	call func(args []interface{}) (interface{}, error)
+}
+
+var exprFunctions = map[string]exprFunction{
+	"size":         {1, exprSize},
+	"int":          {1, exprInt},
+	"double":       {1, exprDouble},
+	"string":       {1, exprString},
+	"contains":     {2, stringFunction(func(s, arg string) interface{} { return strings.Contains(s, arg) })},
+	"startsWith":   {2, stringFunction(func(s, arg string) interface{} { return strings.HasPrefix(s, arg) })},
+	"endsWith":     {2, stringFunction(func(s, arg string) interface{} { return strings.HasSuffix(s, arg) })},
+	"matches":      {2, exprMatches},
+	"lowerAscii":   {1, func(args []interface{}) (interface{}, error) { return exprStringCase(args[0], strings.ToLower) }},
+	"upperAscii":   {1, func(args []interface{}) (interface{}, error) { return exprStringCase(args[0], strings.ToUpper) }},
+	"sha256":       {1, exprSHA256},
+	"sha1":         {1, exprSHA1},
+	"md5":          {1, exprMD5},
+	"base64Encode": {1, exprBase64Encode},
+	"base64Decode": {1, exprBase64Decode},
+	"capitalize":   {1, exprCapitalize},
+	"camelCase":    {1, exprCamelCase},
+	"snakeCase":    {1, exprSnakeCase},
+	"kebabCase":    {1, exprKebabCase},
+	"round":        {2, exprRound},
+	"floor":        {1, exprFloor},
+	"ceil":         {1, exprCeil},
+	"abs":          {1, exprAbs},
+	"min":          {2, exprMin},
+	"max":          {2, exprMax},
+	"sum":          {1, exprSum},
+	"addYears":     {2, exprAddYears},
+	"addMonths":    {2, exprAddMonths},
+	"addDays":      {2, exprAddDays},
+	"addHours":     {2, exprAddHours},
+	"addMinutes":   {2, exprAddMinutes},
+	"addSeconds":   {2, exprAddSeconds},
+	"get":          {2, exprStateGet},
+	"set":          {3, exprStateSet},
+	"incr":         {2, exprStateIncr},
+}
+
+func stringFunction(f func(s, arg string) interface{}) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, sok := args[0].(string)
+		arg, argok := args[1].(string)
+		if !sok || !argok {
+			return nil, fmt.Errorf("expected strings, got %s and %s", exprTypeName(args[0]), exprTypeName(args[1]))
+		}
+		return f(s, arg), nil
+	}
+}
+
+func exprSize(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("can't get the size of %s", exprTypeName(args[0]))
+}
+
+func exprInt(args []interface{}) (interface{}, error) {
+	number, ok := toExprNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("can't convert %s to int", exprTypeName(args[0]))
+	}
+	return math.Trunc(number), nil
+}
+
+func exprDouble(args []interface{}) (interface{}, error) {
+	number, ok := toExprNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("can't convert %s to double", exprTypeName(args[0]))
+	}
+	return number, nil
+}
+
+func exprString(args []interface{}) (interface{}, error) {
+	switch v := args[0].(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return nil, fmt.Errorf("can't convert %s to string", exprTypeName(args[0]))
+}
+
+func exprMatches(args []interface{}) (interface{}, error) {
+	s, sok := args[0].(string)
+	pattern, pok := args[1].(string)
+	if !sok || !pok {
+		return nil, fmt.Errorf("expected strings, got %s and %s", exprTypeName(args[0]), exprTypeName(args[1]))
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+func exprStringCase(value interface{}, f func(string) string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %s", exprTypeName(value))
+	}
+	return f(s), nil
+}
+
+type comprehensionKind int
+
+const (
+	comprehensionAll comprehensionKind = iota
+	comprehensionExists
+	comprehensionExistsOne
+	comprehensionFilter
+	comprehensionMap
+)
+
+var exprMacros = map[string]comprehensionKind{
+	"all":        comprehensionAll,
+	"exists":     comprehensionExists,
+	"exists_one": comprehensionExistsOne,
+	"filter":     comprehensionFilter,
+	"map":        comprehensionMap,
+}
+
+// comprehensionNode evaluates the macros on the items of a list or the keys of a map
+type comprehensionNode struct {
+	kind     comprehensionKind
+	target   exprNode
+	variable string
+	body     exprNode
+}
+
+func (n comprehensionNode) eval(env exprEnv) (interface{}, error) {
+	target, err := n.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	var items []interface{}
+	switch t := target.(type) {
+	case []interface{}:
+		items = t
+	case map[string]interface{}:
+		for key := range t {
+			items = append(items, key)
+		}
+	default:
+		return nil, fmt.Errorf("can't iterate over %s", exprTypeName(target))
+	}
+	scope := make(exprEnv, len(env)+1)
+	for key, value := range env {
+		scope[key] = value
+	}
+	matched := 0
+	results := make([]interface{}, 0)
+	for _, item := range items {
+		scope[n.variable] = item
+		if n.kind == comprehensionMap {
+			value, err := n.body.eval(scope)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, value)
+			continue
+		}
+		b, err := evalBool(n.body, scope)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case n.kind == comprehensionAll && !b:
+			return false, nil
+		case n.kind == comprehensionExists && b:
+			return true, nil
+		case b:
+			matched++
+			results = append(results, item)
+		}
+	}
+	switch n.kind {
+	case comprehensionAll:
+		return true, nil
+	case comprehensionExists:
+		return false, nil
+	case comprehensionExistsOne:
+		return matched == 1, nil
+	}
+	return results, nil
+}
+
+// Values
+
+// toExprNumber converts the numbers and the strings with numbers (e.g. the 64 bit integers in JSON) into doubles
+func toExprNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func exprEquals(left, right interface{}) bool {
+	_, leftIsNumber := left.(float64)
+	_, rightIsNumber := right.(float64)
+	if leftIsNumber || rightIsNumber {
+		l, lok := toExprNumber(left)
+		r, rok := toExprNumber(right)
+		return lok && rok && l == r
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func exprCompare(op string, left, right interface{}) (interface{}, error) {
+	var comparison int
+	ls, lIsString := left.(string)
+	rs, rIsString := right.(string)
+	if lIsString && rIsString {
+		comparison = strings.Compare(ls, rs)
+	} else {
+		l, lok := toExprNumber(left)
+		r, rok := toExprNumber(right)
+		if !lok || !rok {
+			return nil, fmt.Errorf("can't compare %s and %s", exprTypeName(left), exprTypeName(right))
+		}
+		switch {
+		case l < r:
+			comparison = -1
+		case l > r:
+			comparison = 1
+		}
+	}
+	switch op {
+	case "<":
+		return comparison < 0, nil
+	case "<=":
+		return comparison <= 0, nil
+	case ">":
+		return comparison > 0, nil
+	default:
+		return comparison >= 0, nil
+	}
+}
+
+func exprIn(value, container interface{}) (interface{}, error) {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, item := range c {
+			if exprEquals(value, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+		_, found := c[key]
+		return found, nil
+	}
+	return nil, fmt.Errorf("can't check if a value is in %s", exprTypeName(container))
+}
+
+func exprAdd(left, right interface{}) (interface{}, error) {
+	switch l := left.(type) {
+	case string:
+		if r, ok := right.(string); ok {
+			return l + r, nil
+		}
+	case []interface{}:
+		if r, ok := right.([]interface{}); ok {
+			return append(append(make([]interface{}, 0, len(l)+len(r)), l...), r...), nil
+		}
+	case float64:
+		if r, ok := toExprNumber(right); ok {
+			return l + r, nil
+		}
+	}
+	return nil, fmt.Errorf("can't add %s and %s", exprTypeName(left), exprTypeName(right))
+}
+
+func exprTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,61 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTemplateExpr(t *testing.T) {
+	env := exprEnv{
+		"request": (JsonString)(`{"amount":150,"currency":"EUR","id":"9007199254740993","customer":{"name":"John","tags":["vip","new"]},
+			"items":[{"sku":"a","qty":1},{"sku":"b","qty":3}]}`).toMap(),
+		"metadata": map[string]interface{}{"x-tenant": []interface{}{"acme"}},
+		"capture":  map[string]interface{}{"method": "/test.Service/Method"},
+	}
+	tests := []struct {
+		expr    string
+		matches bool
+	}{
+		{"request.amount > 100 && request.currency == 'EUR'", true},
+		{"request.amount > 100 && request.currency == \"USD\"", false},
+		{"request.amount >= 150.0 || request.missing == 1", true},
+		{"request.missing == 1 || request.amount < 100", false},
+		{"request.id == 9007199254740993 && request.id > 1", true},
+		{"request.customer.name.startsWith('Jo') && request.customer.name.matches('^J.*n$')", true},
+		{"'vip' in request.customer.tags && !('old' in request.customer.tags)", true},
+		{"size(request.items) == 2 && request.items[1].qty * 2 == 6", true},
+		{"request.items.exists(i, i.sku == 'b' && i.qty > 2)", true},
+		{"request.items.all(i, i.qty > 1)", false},
+		{"request.items.filter(i, i.qty > 1).size() == 1", true},
+		{"request.items.map(i, i.sku) == ['a', 'b']", true},
+		{"has(request.customer.name) && !has(request.customer.age)", true},
+		{"metadata['x-tenant'][0] == 'acme' && capture.method.endsWith('/Method')", true},
+		{"'customer' in request ? request.customer.name.lowerAscii() == 'john' : false", true},
+		{"{'a': 1}.a + -1 == 0 && (7 % 4) / 2 == 1.5 && string(request.amount) + 'x' == '150x'", true},
+	}
+	for _, test := range tests {
+		e, err := compileExpr(test.expr)
+		if !assert.NoError(t, err, test.expr) {
+			continue
+		}
+		value, _ := e.root.eval(env)
+		assert.Equal(t, test.matches, value == true, test.expr)
+	}
+}
+
+func TestTemplateExpr_Errors(t *testing.T) {
+	for _, expr := range []string{"", "request.amount >", "request.(", "'unterminated", "has(request)", "a ? b", "request # 1"} {
+		_, err := compileExpr(expr)
+		assert.Error(t, err, expr)
+	}
+
+	e, err := compileExpr("request.amount + 1")
+	assert.NoError(t, err)
+	_, err = e.root.eval(exprEnv{"request": map[string]interface{}{}})
+	assert.Error(t, err)
+
+	e, err = compileExpr("unknown(request)")
+	assert.NoError(t, err)
+	_, err = e.root.eval(exprEnv{"request": map[string]interface{}{}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,262 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ResolveExtends returns the stub that results from overriding the stub that s extends (found among stubs by ID or
+// name) with the fields set in s. The JSON contents are merged so that s only needs the fields that differ from its
+// base. s is returned as it is when it doesn't extend any stub.
+func ResolveExtends(s *Stub, stubs []*Stub) (*Stub, error) {
+	if s == nil || s.Extends == "" {
+		return s, nil
+	}
+	base, err := findStub(stubs, s.Extends)
+	if err != nil {
+		return nil, err
+	}
+	resolved := base.Clone()
+	// The fields maintained by the server, the name and whether it is a fallback are not inherited
+	resolved.ID = s.ID
+	resolved.Name = s.Name
+	resolved.Extends = s.Extends
+	resolved.Fallback = s.Fallback
+	resolved.CreatedBy = ""
+	resolved.CreatedAt = nil
+	resolved.UpdatedAt = nil
+	resolved.Version = 0
+	resolved.Fixture = ""
+	if s.FullMethod != "" {
+		resolved.FullMethod = s.FullMethod
+	}
+	if s.Description != "" {
+		resolved.Description = s.Description
+	}
+	if s.Request != nil {
+		resolved.Request = overrideRequest(resolved.Request, s.Request)
+	}
+	if s.Response != nil {
+		resolved.Response = overrideResponse(resolved.Response, s.Response)
+	}
+	if s.Labels != nil {
+		resolved.Labels = s.Labels
+	}
+	if s.Scenario != nil {
+		resolved.Scenario = s.Scenario
+	}
+	if s.ExpectedCalls != nil {
+		resolved.ExpectedCalls = s.ExpectedCalls
+	}
+	if s.Seed != 0 {
+		resolved.Seed = s.Seed
+	}
+	if s.Tests != nil {
+		resolved.Tests = s.Tests
+	}
+	return resolved, nil
+}
+
+// findStub finds the stub with the ID or, otherwise, the name given
+func findStub(stubs []*Stub, ref string) (*Stub, error) {
+	var found *Stub
+	for _, s := range stubs {
+		if s.ID == ref {
+			return s, nil
+		}
+		if s.Name == ref {
+			if found != nil {
+				return nil, fmt.Errorf("more than one stub is named %s", ref)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("stub to extend not found: %s", ref)
+	}
+	return found, nil
+}
+
+func overrideRequest(base, override *StubRequest) *StubRequest {
+	if base == nil {
+		return override
+	}
+	request := &StubRequest{
+		Match:     base.Match,
+		Content:   mergeJSON(base.Content, override.Content),
+		Metadata:  base.Metadata,
+		Peer:      base.Peer,
+		Transport: base.Transport,
+		Claims:    base.Claims,
+		MatchExpr: base.MatchExpr,
+	}
+	if override.Peer != nil {
+		request.Peer = override.Peer
+	}
+	if override.Transport != nil {
+		request.Transport = override.Transport
+	}
+	if len(override.Claims) > 0 {
+		request.Claims = override.Claims
+	}
+	if override.MatchExpr != "" {
+		request.MatchExpr = override.MatchExpr
+	}
+	if len(base.Capture) > 0 || len(override.Capture) > 0 {
+		request.Capture = make(Captures, len(base.Capture)+len(override.Capture))
+		for name, capture := range base.Capture {
+			request.Capture[name] = capture
+		}
+		for name, capture := range override.Capture {
+			request.Capture[name] = capture
+		}
+	}
+	if override.Match != "" {
+		request.Match = override.Match
+	}
+	if len(override.Metadata) > 0 {
+		request.Metadata = make(map[string][]string, len(base.Metadata)+len(override.Metadata))
+		for key, values := range base.Metadata {
+			request.Metadata[key] = values
+		}
+		for key, values := range override.Metadata {
+			request.Metadata[key] = values
+		}
+	}
+	return request
+}
+
+func overrideResponse(base, override *StubResponse) *StubResponse {
+	if base == nil {
+		return override
+	}
+	response := &StubResponse{
+		Type:            base.Type,
+		Content:         mergeJSON(base.Content, override.Content),
+		Stream:          base.Stream,
+		Pacing:          base.Pacing,
+		StreamFaults:    base.StreamFaults,
+		FrameFault:      base.FrameFault,
+		Pages:           base.Pages,
+		Operation:       base.Operation,
+		FailThenSucceed: base.FailThenSucceed,
+		Error:           base.Error,
+		Script:          base.Script,
+		TrailersOnly:    base.TrailersOnly || override.TrailersOnly,
+		Headers:         mergeStrings(base.Headers, override.Headers),
+		Trailers:        mergeStrings(base.Trailers, override.Trailers),
+	}
+	if override.Type != "" {
+		response.Type = override.Type
+	}
+	if override.Stream != nil {
+		response.Stream = override.Stream
+	}
+	if override.Pacing != nil {
+		response.Pacing = override.Pacing
+	}
+	if override.StreamFaults != nil {
+		response.StreamFaults = override.StreamFaults
+	}
+	if override.FrameFault != nil {
+		response.FrameFault = override.FrameFault
+	}
+	if override.Pages != nil {
+		response.Pages = override.Pages
+	}
+	if override.Operation != nil {
+		response.Operation = override.Operation
+	}
+	if override.FailThenSucceed != nil {
+		response.FailThenSucceed = override.FailThenSucceed
+	}
+	if override.Script != "" {
+		response.Script = override.Script
+	}
+	if override.Error != nil {
+		response.Error = overrideError(base.Error, override.Error)
+	}
+	return response
+}
+
+func overrideError(base, override *ErrorResponse) *ErrorResponse {
+	if base == nil {
+		return override
+	}
+	errorResponse := *base
+	if override.Code != 0 {
+		errorResponse.Code = override.Code
+	}
+	if override.Message != "" {
+		errorResponse.Message = override.Message
+	}
+	if override.Details != nil {
+		errorResponse.Details = override.Details
+	}
+	if override.RetryDelay != "" {
+		errorResponse.RetryDelay = override.RetryDelay
+	}
+	return &errorResponse
+}
+
+// mergeJSON merges the JSON objects recursively, with the values in override replacing the ones in base. Arrays and
+// other values are replaced as a whole. override is returned as it is if any of them isn't a valid JSON object.
+func mergeJSON(base, override JsonString) JsonString {
+	if override == "" {
+		return base
+	}
+	baseObject, baseOk := decodeJSONObject(base)
+	overrideObject, overrideOk := decodeJSONObject(override)
+	if !baseOk || !overrideOk {
+		return override
+	}
+	merged, err := json.Marshal(mergeObjects(baseObject, overrideObject))
+	if err != nil {
+		return override
+	}
+	return JsonString(merged)
+}
+
+func decodeJSONObject(j JsonString) (map[string]interface{}, bool) {
+	object := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader([]byte(j)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, false
+	}
+	return object, true
+}
+
+func mergeObjects(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseObject, baseIsObject := merged[key].(map[string]interface{})
+		overrideObject, overrideIsObject := value.(map[string]interface{})
+		if baseIsObject && overrideIsObject {
+			merged[key] = mergeObjects(baseObject, overrideObject)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// mergeStrings merges the maps, with the values in override replacing the ones in base. nil is returned when both are
+// empty.
+func mergeStrings(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
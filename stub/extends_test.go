@@ -0,0 +1,49 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResolveExtends(t *testing.T) {
+	base := &Stub{
+		ID:         "1",
+		Name:       "order",
+		FullMethod: "/test.Orders/Get",
+		Request: &StubRequest{
+			Match:    "exact",
+			Content:  `{"id":1}`,
+			Metadata: map[string][]string{"tenant": {"a"}},
+		},
+		Response: &StubResponse{Type: "success", Content: `{"id":1,"customer":{"name":"John","age":30},"items":[1,2]}`},
+		Version:  3,
+	}
+	s := &Stub{
+		Extends:  "order",
+		Request:  &StubRequest{Content: `{"id":2}`},
+		Response: &StubResponse{Content: `{"id":2,"customer":{"age":40},"items":[3]}`},
+	}
+
+	resolved, err := ResolveExtends(s, []*Stub{base})
+	assert.NoError(t, err)
+	assert.Equal(t, "/test.Orders/Get", resolved.FullMethod)
+	assert.Equal(t, "", resolved.Name)
+	assert.Equal(t, "order", resolved.Extends)
+	assert.Equal(t, int64(0), resolved.Version)
+	assert.Equal(t, "exact", resolved.Request.Match)
+	assert.Equal(t, JsonString(`{"id":2}`), resolved.Request.Content)
+	assert.Equal(t, map[string][]string{"tenant": {"a"}}, resolved.Request.Metadata)
+	assert.Equal(t, JsonString(`{"customer":{"age":40,"name":"John"},"id":2,"items":[3]}`), resolved.Response.Content)
+	assert.Equal(t, JsonString(`{"id":1,"customer":{"name":"John","age":30},"items":[1,2]}`), base.Response.Content)
+
+	s.Extends = "1"
+	s.Response = &StubResponse{Type: "error", Error: &ErrorResponse{Code: 5, Message: "not found"}}
+	resolved, err = ResolveExtends(s, []*Stub{base})
+	assert.NoError(t, err)
+	assert.Equal(t, "error", resolved.Response.Type)
+	assert.Equal(t, StatusCode(5), resolved.Response.Error.Code)
+
+	s.Extends = "missing"
+	_, err = ResolveExtends(s, []*Stub{base})
+	assert.EqualError(t, err, "stub to extend not found: missing")
+}
@@ -0,0 +1,206 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fixture is a named set of stubs (e.g. happy-path or payment-declined) that are activated and deactivated together
+type Fixture struct {
+	Name  string  `json:"name"`
+	Stubs []*Stub `json:"stubs"`
+}
+
+// FixtureSummary describes a fixture without its stubs
+type FixtureSummary struct {
+	Name      string `json:"name"`
+	StubCount int    `json:"stubCount"`
+	// Active is true when the stubs of the fixture are in the StubsStore
+	Active bool `json:"active"`
+}
+
+// FixturesStore keeps the fixtures available to be activated
+type FixturesStore interface {
+	// Save adds the fixture or replaces the one with the same name
+	Save(fixture *Fixture)
+	Get(name string) *Fixture
+	// GetAll returns the fixtures sorted by name
+	GetAll() []*Fixture
+	Delete(name string) error
+}
+
+func NewInMemoryFixturesStore() FixturesStore {
+	return &inMemoryFixturesStore{
+		fixtures: make(map[string]*Fixture, 0),
+	}
+}
+
+type inMemoryFixturesStore struct {
+	fixtures map[string]*Fixture
+	mutex    sync.RWMutex
+}
+
+func (s *inMemoryFixturesStore) Save(fixture *Fixture) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.fixtures[fixture.Name] = fixture
+}
+
+func (s *inMemoryFixturesStore) Get(name string) *Fixture {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.fixtures[name]
+}
+
+func (s *inMemoryFixturesStore) GetAll() []*Fixture {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	fixtures := make([]*Fixture, 0, len(s.fixtures))
+	for _, fixture := range s.fixtures {
+		fixtures = append(fixtures, fixture)
+	}
+	sort.Slice(fixtures, func(i, j int) bool {
+		return fixtures[i].Name < fixtures[j].Name
+	})
+	return fixtures
+}
+
+func (s *inMemoryFixturesStore) Delete(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.fixtures[name]; !found {
+		return fmt.Errorf("fixture does not exist: %s", name)
+	}
+	delete(s.fixtures, name)
+	return nil
+}
+
+// LoadFixturesFromDir reads the fixtures in the JSON files (*.json) of the directory. Each file is a fixture named
+// after the file (without the extension) and contains a single stub or an array of stubs.
+func LoadFixturesFromDir(dir string) ([]*Fixture, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	fixtures := make([]*Fixture, 0, len(files))
+	for _, file := range files {
+		stubs, err := LoadStubsFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		fixtures = append(fixtures, &Fixture{Name: name, Stubs: stubs})
+	}
+	return fixtures, nil
+}
+
+// ResolveExtends resolves the stubs of the fixture that extend other stubs, which can be the previous stubs of the
+// fixture or the existing stubs given.
+func (fixture *Fixture) ResolveExtends(existing []*Stub) error {
+	resolved := make([]*Stub, 0, len(fixture.Stubs))
+	for _, e := range fixture.Stubs {
+		if e.Extends == "" {
+			resolved = append(resolved, e)
+			continue
+		}
+		candidates := append(append(make([]*Stub, 0, len(resolved)+len(existing)), resolved...), existing...)
+		r, err := ResolveExtends(e, candidates)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, r)
+	}
+	fixture.Stubs = resolved
+	return nil
+}
+
+// Summary describes the fixture. active are the names of the active fixtures (see ActiveFixtures).
+func (fixture *Fixture) Summary(active map[string]bool) FixtureSummary {
+	return FixtureSummary{
+		Name:      fixture.Name,
+		StubCount: len(fixture.Stubs),
+		Active:    active[fixture.Name],
+	}
+}
+
+// ActiveFixtures returns the names of the fixtures with stubs in the store
+func ActiveFixtures(ctx context.Context, store StubsStore) (map[string]bool, error) {
+	stubs, err := store.GetAllStubs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool, 0)
+	for _, e := range stubs {
+		if e.Fixture != "" {
+			active[e.Fixture] = true
+		}
+	}
+	return active, nil
+}
+
+// Activate adds a copy of the stubs of the fixture to the store, replacing the stubs for the same requests. When
+// exclusive is true, the stubs of the other active fixtures are removed. The store is changed at once, so the calls
+// never see a partially activated fixture. It returns the stubs that were in the store before the activation.
+func (fixture *Fixture) Activate(ctx context.Context, store StubsStore, actor string, exclusive bool) (previous []*Stub, err error) {
+	err = store.Transaction(ctx, func(current []*Stub) ([]*Stub, error) {
+		previous = current
+		return fixture.activate(current, actor, exclusive), nil
+	})
+	return previous, err
+}
+
+func (fixture *Fixture) activate(previous []*Stub, actor string, exclusive bool) []*Stub {
+	byKey := make(map[string]*Stub, len(previous)+len(fixture.Stubs))
+	add := func(e *Stub) {
+		byKey[e.FullMethod+" "+e.key()] = e
+	}
+	for _, e := range previous {
+		if e.Fixture == fixture.Name || (exclusive && e.Fixture != "") {
+			continue
+		}
+		add(e)
+	}
+	now := time.Now()
+	for _, e := range fixture.Stubs {
+		activated := e.Clone()
+		activated.ID = newID()
+		activated.Fixture = fixture.Name
+		activated.CreatedBy = actor
+		activated.CreatedAt = &now
+		activated.UpdatedAt = &now
+		activated.Version = 1
+		add(activated)
+	}
+	stubs := make([]*Stub, 0, len(byKey))
+	for _, e := range byKey {
+		stubs = append(stubs, e)
+	}
+	return stubs
+}
+
+// DeactivateFixture removes the stubs of the fixture from the store at once. It returns the stubs removed.
+func DeactivateFixture(ctx context.Context, store StubsStore, name string) (removed []*Stub, err error) {
+	err = store.Transaction(ctx, func(current []*Stub) ([]*Stub, error) {
+		removed = make([]*Stub, 0)
+		stubs := make([]*Stub, 0, len(current))
+		for _, e := range current {
+			if e.Fixture == name {
+				removed = append(removed, e)
+				continue
+			}
+			stubs = append(stubs, e)
+		}
+		return stubs, nil
+	})
+	return removed, err
+}
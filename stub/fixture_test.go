@@ -0,0 +1,60 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixture_Activate(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}"))
+	happyPath := &Fixture{Name: "happy-path", Stubs: []*Stub{
+		newTestStub("method1", "{\"name\":\"John\"}"),
+		newTestStub("method2", "{}"),
+	}}
+	declined := &Fixture{Name: "declined", Stubs: []*Stub{newTestStub("method3", "{}")}}
+
+	previous, err := happyPath.Activate(context.Background(), store, "tester", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(previous))
+	stubs := allStubs(t, store)
+	assert.Equal(t, 2, len(stubs))
+	for _, s := range stubs {
+		assert.Equal(t, "happy-path", s.Fixture)
+		assert.Equal(t, "tester", s.CreatedBy)
+		assert.NotEqual(t, "", s.ID)
+	}
+	assert.Equal(t, "", happyPath.Stubs[0].Fixture)
+
+	declined.Activate(context.Background(), store, "tester", false)
+	active, err := ActiveFixtures(context.Background(), store)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"happy-path": true, "declined": true}, active)
+
+	declined.Activate(context.Background(), store, "tester", true)
+	active, _ = ActiveFixtures(context.Background(), store)
+	assert.Equal(t, map[string]bool{"declined": true}, active)
+
+	removed, err := DeactivateFixture(context.Background(), store, "declined")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(removed))
+	assert.Equal(t, 0, len(allStubs(t, store)))
+}
+
+func TestLoadFixturesFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stub := "{\"fullMethod\":\"method1\",\"request\":{\"match\":\"exact\",\"content\":{}},\"response\":{\"type\":\"success\",\"content\":{}}}"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "happy-path.json"), []byte("["+stub+","+stub+"]"), 0644))
+
+	fixtures, err := LoadFixturesFromDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(fixtures))
+	assert.Equal(t, "happy-path", fixtures[0].Name)
+	assert.Equal(t, 2, len(fixtures[0].Stubs))
+}
@@ -0,0 +1,63 @@
+package stub
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Types of frame faults
+const (
+	FrameFaultCorrupt   = "corrupt"
+	FrameFaultOversized = "oversized"
+)
+
+// DefaultOversizedFrameSize is one byte over the maximum size of the messages received by the gRPC clients by default
+const DefaultOversizedFrameSize = 4*1024*1024 + 1
+
+// FrameFault sends a message that the clients can't decode instead of the response, to test how they handle bad
+// frames. It replaces the response of unary methods and one of the messages of server streaming methods.
+type FrameFault struct {
+	// Type is corrupt, for bytes that are not a valid message, or oversized, for a message bigger than the clients
+	// accept
+	Type string `json:"type"`
+	// Size is the number of bytes of the oversized message, DefaultOversizedFrameSize when 0
+	Size int `json:"size,omitempty"`
+	// Message is the index of the message of the stream replaced, from 0
+	Message int `json:"message,omitempty"`
+}
+
+// Encode returns the bytes sent instead of the message. The oversized message only has an unknown field, so the
+// clients that accept its size can still decode it.
+func (f *FrameFault) Encode() []byte {
+	if f.Type == FrameFaultCorrupt {
+		// The tag of the field 1 with the wire type 7, which doesn't exist
+		return []byte{0x0f, 0xff, 0xff, 0xff}
+	}
+	size := f.Size
+	if size == 0 {
+		size = DefaultOversizedFrameSize
+	}
+	frame := protowire.AppendTag(nil, protowire.MaxValidNumber, protowire.BytesType)
+	length := size - len(frame) - protowire.SizeVarint(uint64(size))
+	if length < 0 {
+		length = 0
+	}
+	frame = protowire.AppendVarint(frame, uint64(length))
+	return append(frame, make([]byte, length)...)
+}
+
+func (f *FrameFault) validate(responseType string) (errMsgs []string) {
+	if f.Type != FrameFaultCorrupt && f.Type != FrameFaultOversized {
+		errMsgs = append(errMsgs, fmt.Sprintf("Frame fault type '%s' is not valid. Expected corrupt or oversized.", f.Type))
+	}
+	if f.Size < 0 {
+		errMsgs = append(errMsgs, "Frame fault size can't be negative.")
+	}
+	if f.Message < 0 {
+		errMsgs = append(errMsgs, "Frame fault message can't be negative.")
+	}
+	if responseType == "error" {
+		errMsgs = append(errMsgs, "Frame faults can't be used with error responses.")
+	}
+	return errMsgs
+}
@@ -0,0 +1,26 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestFrameFault_Encode(t *testing.T) {
+	assert.Error(t, proto.Unmarshal((&FrameFault{Type: FrameFaultCorrupt}).Encode(), new(structpb.Struct)))
+
+	assert.Len(t, (&FrameFault{Type: FrameFaultOversized}).Encode(), DefaultOversizedFrameSize)
+	oversized := (&FrameFault{Type: FrameFaultOversized, Size: 100}).Encode()
+	assert.Len(t, oversized, 100)
+	assert.NoError(t, proto.Unmarshal(oversized, new(structpb.Struct)))
+}
+
+func TestFrameFault_Validate(t *testing.T) {
+	assert.Empty(t, (&FrameFault{Type: FrameFaultOversized, Size: 1024}).validate("success"))
+	assert.Equal(t, []string{
+		"Frame fault type 'garbled' is not valid. Expected corrupt or oversized.",
+		"Frame fault message can't be negative.",
+		"Frame faults can't be used with error responses.",
+	}, (&FrameFault{Type: "garbled", Message: -1}).validate("error"))
+}
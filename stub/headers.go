@@ -0,0 +1,58 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// metadataKeyPattern matches the valid keys of the metadata
+var metadataKeyPattern = regexp.MustCompile(`^[0-9a-z_.-]+$`)
+
+// GetResponseMetadata renders the headers and trailers of the response of the stub. The values rendered empty, e.g.
+// the metadata of the call that was not sent, are left out.
+func GetResponseMetadata(ctx context.Context, stub *Stub, requestJson string) (header, trailer metadata.MD, err error) {
+	if stub == nil || stub.Response == nil || (len(stub.Response.Headers) == 0 && len(stub.Response.Trailers) == 0) {
+		return nil, nil, nil
+	}
+	data := newTemplateData(ctx, stub, requestJson)
+	if header, err = data.renderMetadata(stub.Response.Headers); err == nil {
+		trailer, err = data.renderMetadata(stub.Response.Trailers)
+	}
+	if err != nil {
+		logRenderError(stub, requestJson, err)
+		return nil, nil, fmt.Errorf("could not render response metadata")
+	}
+	return header, trailer, nil
+}
+
+func (d *templateData) renderMetadata(values map[string]string) (metadata.MD, error) {
+	md := metadata.MD{}
+	for key, value := range values {
+		rendered, err := d.renderText(value)
+		if err != nil {
+			return nil, err
+		}
+		if rendered != "" {
+			md.Set(key, rendered)
+		}
+	}
+	return md, nil
+}
+
+func validateResponseMetadata(kind string, values map[string]string) (errMsgs []string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !metadataKeyPattern.MatchString(key) || strings.HasPrefix(key, "grpc-") {
+			errMsgs = append(errMsgs, fmt.Sprintf("Response %s key '%s' is not valid. Expected lowercase letters, digits, _, . or - and no grpc- prefix.", kind, key))
+		}
+	}
+	return errMsgs
+}
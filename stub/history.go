@@ -0,0 +1,93 @@
+package stub
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	ChangeTypeCreate = "create"
+	ChangeTypeUpdate = "update"
+	ChangeTypeDelete = "delete"
+)
+
+// Change is an entry of the audit log describing a modification made to a stub.
+type Change struct {
+	Seq        int64       `json:"seq"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Actor      string      `json:"actor"`
+	Type       string      `json:"type"`
+	StubID     string      `json:"stubId"`
+	FullMethod string      `json:"fullMethod"`
+	Diff       []FieldDiff `json:"diff"`
+}
+
+// AuditLog records every change made to the stubs.
+type AuditLog interface {
+	// Record adds a change to the log. before is nil for created stubs and after is nil for deleted stubs.
+	Record(actor, changeType string, before, after *Stub)
+	GetAll() []Change
+	GetForStub(id string) []Change
+}
+
+// NewInMemoryAuditLog creates an audit log that keeps the last maxEntries changes in memory.
+func NewInMemoryAuditLog(maxEntries int) AuditLog {
+	return &inMemoryAuditLog{
+		maxEntries: maxEntries,
+		changes:    make([]Change, 0),
+	}
+}
+
+type inMemoryAuditLog struct {
+	maxEntries int
+	seq        int64
+	changes    []Change
+	mutex      sync.RWMutex
+}
+
+func (l *inMemoryAuditLog) Record(actor, changeType string, before, after *Stub) {
+	change := Change{
+		Timestamp: time.Now(),
+		Actor:     actor,
+		Type:      changeType,
+		Diff:      DiffStubs(before, after),
+	}
+	for _, s := range []*Stub{before, after} {
+		if s != nil {
+			change.StubID = s.ID
+			change.FullMethod = s.FullMethod
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.seq++
+	change.Seq = l.seq
+	l.changes = append(l.changes, change)
+	if l.maxEntries > 0 && len(l.changes) > l.maxEntries {
+		l.changes = l.changes[len(l.changes)-l.maxEntries:]
+	}
+}
+
+func (l *inMemoryAuditLog) GetAll() []Change {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	changes := make([]Change, len(l.changes))
+	copy(changes, l.changes)
+	return changes
+}
+
+func (l *inMemoryAuditLog) GetForStub(id string) []Change {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	changes := make([]Change, 0)
+	for _, change := range l.changes {
+		if change.StubID == id {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,38 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInMemoryAuditLog_Record(t *testing.T) {
+	auditLog := NewInMemoryAuditLog(10)
+	before := newTestStub("method1", "{\"name\":\"John\"}")
+	before.ID = "id1"
+	after := newTestStub("method1", "{\"name\":\"John\"}")
+	after.ID = "id1"
+	after.Response.Content = JsonString("{\"greeting\":\"Hello\"}")
+
+	auditLog.Record("tester", ChangeTypeCreate, nil, before)
+	auditLog.Record("tester", ChangeTypeUpdate, before, after)
+	auditLog.Record("tester", ChangeTypeDelete, after, nil)
+
+	history := auditLog.GetForStub("id1")
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, ChangeTypeUpdate, history[1].Type)
+	assert.Equal(t, []FieldDiff{{Path: "response.content.greeting", New: "Hello"}}, history[1].Diff)
+	assert.Equal(t, "method1", history[2].FullMethod)
+	assert.Equal(t, 0, len(auditLog.GetForStub("id2")))
+}
+
+func TestInMemoryAuditLog_Record_KeepsLastEntries(t *testing.T) {
+	auditLog := NewInMemoryAuditLog(2)
+	s := newTestStub("method1", "{}")
+	for i := 0; i < 5; i++ {
+		auditLog.Record("tester", ChangeTypeUpdate, s, s)
+	}
+
+	changes := auditLog.GetAll()
+	assert.Equal(t, 2, len(changes))
+	assert.Equal(t, int64(5), changes[1].Seq)
+}
@@ -0,0 +1,91 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ImportResult summarizes the changes made to the store by Import
+type ImportResult struct {
+	Added    int `json:"added"`
+	Replaced int `json:"replaced"`
+	Removed  int `json:"removed"`
+	// Merged is the number of stubs merged into others before the import, when it is deduped (see Dedupe)
+	Merged int `json:"merged,omitempty"`
+	// Previous and Current are all the stubs in the store before and after the import
+	Previous []*Stub `json:"-"`
+	Current  []*Stub `json:"-"`
+}
+
+// Import adds the stubs (already validated) to the store in a single transaction, so that the calls see either none
+// or all of them. The stubs for the same requests as existing stubs replace them as updates, keeping their ID and
+// authorship. The new stubs keep the ID set by the client, if any. With replace, the existing stubs that are not
+// replaced are removed. Nothing is changed, and ErrConflict is returned, when two of the stubs match the same requests
+// or the ID of a new stub is taken by another stub.
+func Import(ctx context.Context, store StubsStore, stubs []*Stub, actor string, replace bool) (*ImportResult, error) {
+	byKey := make(map[string]int, len(stubs))
+	for i, e := range stubs {
+		key := e.FullMethod + " " + e.key()
+		if j, found := byKey[key]; found {
+			return nil, fmt.Errorf("%w: stubs %d and %d match the same requests", ErrConflict, j, i)
+		}
+		byKey[key] = i
+	}
+	result := &ImportResult{}
+	err := store.Transaction(ctx, func(current []*Stub) ([]*Stub, error) {
+		result.Previous = current
+		existing := make(map[string]*Stub, len(current))
+		for _, e := range current {
+			existing[e.FullMethod+" "+e.key()] = e
+		}
+		now := time.Now()
+		imported := make([]*Stub, 0, len(current)+len(stubs))
+		for _, e := range stubs {
+			key := e.FullMethod + " " + e.key()
+			if previous, found := existing[key]; found {
+				e.ID = previous.ID
+				e.CreatedBy = previous.CreatedBy
+				e.CreatedAt = previous.CreatedAt
+				e.Fixture = previous.Fixture
+				e.Version = previous.Version + 1
+				delete(existing, key)
+				result.Replaced++
+			} else {
+				if e.ID == "" {
+					e.ID = newID()
+				}
+				e.CreatedBy = actor
+				e.CreatedAt = &now
+				e.Fixture = ""
+				e.Version = 1
+				result.Added++
+			}
+			e.UpdatedAt = &now
+			imported = append(imported, e)
+		}
+		for _, e := range current {
+			if _, notReplaced := existing[e.FullMethod+" "+e.key()]; !notReplaced {
+				continue
+			}
+			if replace {
+				result.Removed++
+				continue
+			}
+			imported = append(imported, e)
+		}
+		ids := make(map[string]bool, len(imported))
+		for _, e := range imported {
+			if ids[e.ID] {
+				return nil, fmt.Errorf("%w: id %s is taken", ErrConflict, e.ID)
+			}
+			ids[e.ID] = true
+		}
+		result.Current = imported
+		return imported, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
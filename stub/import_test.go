@@ -0,0 +1,139 @@
+package stub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	existing := newTestStub("method1", "{\"id\":1}")
+	existing.CreatedBy = "tester"
+	store.Add(context.Background(), existing)
+	store.Add(context.Background(), newTestStub("method1", "{\"id\":2}"))
+
+	replacing := newTestStub("method1", "{\"id\":1}")
+	replacing.Description = "imported"
+	result, err := Import(context.Background(), store, []*Stub{replacing, newTestStub("method2", "{}")}, "importer", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Added)
+	assert.Equal(t, 1, result.Replaced)
+	assert.Equal(t, 0, result.Removed)
+	assert.Len(t, result.Previous, 2)
+	assert.Len(t, allStubs(t, store), 3)
+	stored, err := store.Get(context.Background(), replacing)
+	assert.NoError(t, err)
+	assert.Equal(t, "imported", stored.Description)
+	assert.Equal(t, existing.ID, stored.ID)
+	assert.Equal(t, "tester", stored.CreatedBy)
+	assert.Equal(t, int64(2), stored.Version)
+	assert.Equal(t, "importer", stubsForMethod(t, store, "method2")[0].CreatedBy)
+
+	result, err = Import(context.Background(), store, []*Stub{newTestStub("method3", "{}")}, "importer", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Removed)
+	assert.Len(t, allStubs(t, store), 1)
+
+	// Nothing is imported when two stubs match the same requests
+	_, err = Import(context.Background(), store, []*Stub{newTestStub("method4", "{}"), newTestStub("method4", "{}")}, "importer", true)
+	assert.EqualError(t, err, "stub already exists: stubs 0 and 1 match the same requests")
+	assert.Len(t, stubsForMethod(t, store, "method3"), 1)
+	assert.Len(t, stubsForMethod(t, store, "method4"), 0)
+}
+
+// The readers see either all the stubs of an import or none of them
+func TestImport_Atomic(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	stubs := make([]*Stub, 0)
+	for i := 0; i < 100; i++ {
+		stubs = append(stubs, newTestStub(fmt.Sprintf("method%d", i%10), fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			Import(context.Background(), store, stubs, "importer", true)
+			store.DeleteAll(context.Background())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			count := len(allStubs(t, store))
+			assert.True(t, count == 0 || count == len(stubs), "partial import seen: %d stubs", count)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestImport_Limits(t *testing.T) {
+	ctx := context.Background()
+	imported := func() []*Stub {
+		return []*Stub{newTestStub("method1", "{\"id\":1}"), newTestStub("method1", "{\"id\":2}"),
+			newTestStub("method2", "{\"id\":1}")}
+	}
+
+	rejecting := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubsPerMethod: 1}))
+	rejecting.Add(ctx, newTestStub("method3", "{}"))
+	_, err := Import(ctx, rejecting, imported(), "importer", false)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.Len(t, allStubs(t, rejecting), 1)
+	assert.Equal(t, int64(1), rejecting.(StoreStatsReporter).GetStats(ctx).Rejections)
+
+	total := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubs: 3}))
+	total.Add(ctx, newTestStub("method3", "{}"))
+	_, err = Import(ctx, total, imported(), "importer", false)
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	_, err = Import(ctx, total, imported(), "importer", true)
+	assert.NoError(t, err)
+	assert.Len(t, allStubs(t, total), 3)
+
+	evicting := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubs: 2, Eviction: EvictionOldest}))
+	evicting.Add(ctx, newTestStub("method3", "{}"))
+	_, err = Import(ctx, evicting, imported(), "importer", false)
+	assert.NoError(t, err)
+	assert.Len(t, allStubs(t, evicting), 2)
+	assert.Len(t, stubsForMethod(t, evicting, "method3"), 0)
+	assert.Equal(t, int64(2), evicting.(StoreStatsReporter).GetStats(ctx).Evictions)
+}
+
+func TestImport_ClientIDs(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStubsStore()
+	existing := newTestStub("method1", "{\"id\":1}")
+	existing.ID = "existing"
+	store.Add(ctx, existing)
+
+	added := newTestStub("method1", "{\"id\":2}")
+	added.ID = "client-id"
+	_, err := Import(ctx, store, []*Stub{added}, "importer", false)
+	assert.NoError(t, err)
+	stored, err := store.Get(ctx, added)
+	assert.NoError(t, err)
+	assert.Equal(t, "client-id", stored.ID)
+
+	taken := newTestStub("method2", "{}")
+	taken.ID = "existing"
+	_, err = Import(ctx, store, []*Stub{taken}, "importer", false)
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Len(t, stubsForMethod(t, store, "method2"), 0)
+
+	first, second := newTestStub("method2", "{\"id\":1}"), newTestStub("method2", "{\"id\":2}")
+	first.ID, second.ID = "same", "same"
+	_, err = Import(ctx, store, []*Stub{first, second}, "importer", false)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	// The ID of a stub removed by the import can be reused
+	moved := newTestStub("method2", "{}")
+	moved.ID = "existing"
+	_, err = Import(ctx, store, []*Stub{moved}, "importer", true)
+	assert.NoError(t, err)
+	stored, err = store.Get(ctx, moved)
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", stored.ID)
+}
@@ -0,0 +1,223 @@
+package stub
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"google.golang.org/grpc/metadata"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalEntry is a call received by the mock server
+type JournalEntry struct {
+	// Seq is the position of the call in the journal, starting at 1
+	Seq        int64               `json:"seq"`
+	Timestamp  time.Time           `json:"timestamp"`
+	FullMethod string              `json:"fullMethod"`
+	Request    JsonString          `json:"request"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	// StubID is the stub that matched the call. It is empty when no stub matched.
+	StubID string `json:"stubId,omitempty"`
+}
+
+// Journal records the calls received in the order they arrive. Implementations must be safe for concurrent use.
+type Journal interface {
+	Record(entry JournalEntry)
+	GetAll() []JournalEntry
+	Reset()
+}
+
+// NewInMemoryJournal creates a journal that keeps the last maxEntries calls in memory.
+func NewInMemoryJournal(maxEntries int) Journal {
+	return &inMemoryJournal{
+		maxEntries: maxEntries,
+		entries:    make([]JournalEntry, 0),
+	}
+}
+
+type inMemoryJournal struct {
+	maxEntries int
+	seq        int64
+	entries    []JournalEntry
+	mutex      sync.RWMutex
+}
+
+func (j *inMemoryJournal) Record(entry JournalEntry) {
+	j.record(entry)
+}
+
+// record adds the entry with the next sequence number and returns it
+func (j *inMemoryJournal) record(entry JournalEntry) JournalEntry {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.seq++
+	entry.Seq = j.seq
+	j.append(entry)
+	return entry
+}
+
+// restore adds entries already sequenced, e.g. the ones persisted before a restart
+func (j *inMemoryJournal) restore(entries []JournalEntry) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, entry := range entries {
+		j.seq = entry.Seq
+		j.append(entry)
+	}
+}
+
+func (j *inMemoryJournal) append(entry JournalEntry) {
+	j.entries = append(j.entries, entry)
+	if j.maxEntries > 0 && len(j.entries) > j.maxEntries {
+		j.entries = j.entries[len(j.entries)-j.maxEntries:]
+	}
+}
+
+func (j *inMemoryJournal) GetAll() []JournalEntry {
+	j.mutex.RLock()
+	defer j.mutex.RUnlock()
+
+	entries := make([]JournalEntry, len(j.entries))
+	copy(entries, j.entries)
+	return entries
+}
+
+func (j *inMemoryJournal) Reset() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.seq = 0
+	j.entries = make([]JournalEntry, 0)
+}
+
+// newJournalEntry creates the entry for a call. The request is redacted as the journal keeps it.
+func newJournalEntry(ctx context.Context, fullMethod, requestJson string, stub *Stub) JournalEntry {
+	entry := JournalEntry{
+		Timestamp:  time.Now(),
+		FullMethod: fullMethod,
+		Request:    JsonString(util.PayloadRedactor().RedactJSON(requestJson)),
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md) > 0 {
+		entry.Metadata = util.PayloadRedactor().RedactMetadata(md)
+	}
+	if stub != nil {
+		entry.StubID = stub.ID
+	}
+	return entry
+}
+
+const (
+	orderDiffSame       = "  "
+	orderDiffMissing    = "- "
+	orderDiffUnexpected = "+ "
+)
+
+// OrderVerification is the result of checking the order of the calls in the journal
+type OrderVerification struct {
+	// InOrder is true when the calls happened in the order expected
+	InOrder  bool     `json:"inOrder"`
+	Expected []string `json:"expected"`
+	// Actual are the calls to the methods expected, in the order they were received
+	Actual []string `json:"actual"`
+	// Diff compares the calls expected with the actual ones, one call per line: lines starting with "- " are
+	// expected calls that are missing and lines starting with "+ " are calls received but not expected.
+	Diff string `json:"diff"`
+}
+
+// JUnit returns the verification as a JUnit test suite with a single test case, failed with the diff when the calls
+// are not in order
+func (v *OrderVerification) JUnit() *util.JUnitTestSuite {
+	testCase := util.JUnitTestCase{Name: strings.Join(v.Expected, ", "), ClassName: "order"}
+	if !v.InOrder {
+		testCase.Failure = &util.JUnitFailure{Message: "the calls are not in the order expected", Text: v.Diff}
+	}
+	return util.NewJUnitTestSuite("order", []util.JUnitTestCase{testCase})
+}
+
+// VerifyOrder checks that the calls to the methods expected happened in the order given. A method can be either the
+// full method (/package.Service/Method) or only its name (Method). The calls to methods not in the list are ignored.
+// When exact is false, extra calls to the methods expected (e.g. retries) are allowed as long as the expected calls
+// happened in order; when true, the calls must be exactly the ones expected.
+func VerifyOrder(entries []JournalEntry, expected []string, exact bool) *OrderVerification {
+	actual := make([]string, 0)
+	for _, entry := range entries {
+		for _, method := range expected {
+			if MethodMatches(entry.FullMethod, method) {
+				actual = append(actual, method)
+				break
+			}
+		}
+	}
+	diff := diffCalls(expected, actual)
+	inOrder := true
+	lines := make([]string, 0, len(diff))
+	for _, line := range diff {
+		if line.prefix == orderDiffMissing || (exact && line.prefix == orderDiffUnexpected) {
+			inOrder = false
+		}
+		lines = append(lines, line.prefix+line.call)
+	}
+	return &OrderVerification{
+		InOrder:  inOrder,
+		Expected: expected,
+		Actual:   actual,
+		Diff:     strings.Join(lines, "\n"),
+	}
+}
+
+// MethodMatches checks if the full method is the method given, which can be the full method or only its name
+func MethodMatches(fullMethod, method string) bool {
+	return fullMethod == method || strings.HasSuffix(fullMethod, "/"+method)
+}
+
+type diffLine struct {
+	prefix string
+	call   string
+}
+
+// diffCalls computes the difference between the expected and actual calls from their longest common subsequence
+func diffCalls(expected, actual []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of expected[i:] and actual[j:]
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			switch {
+			case expected[i] == actual[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	diff := make([]diffLine, 0, len(expected)+len(actual))
+	i, j := 0, 0
+	for i < len(expected) && j < len(actual) {
+		switch {
+		case expected[i] == actual[j]:
+			diff = append(diff, diffLine{orderDiffSame, expected[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, diffLine{orderDiffMissing, expected[i]})
+			i++
+		default:
+			diff = append(diff, diffLine{orderDiffUnexpected, actual[j]})
+			j++
+		}
+	}
+	for ; i < len(expected); i++ {
+		diff = append(diff, diffLine{orderDiffMissing, expected[i]})
+	}
+	for ; j < len(actual); j++ {
+		diff = append(diff, diffLine{orderDiffUnexpected, actual[j]})
+	}
+	return diff
+}
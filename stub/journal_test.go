@@ -0,0 +1,71 @@
+package stub
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestStubsMatcher_Match_Journal(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	matched := newTestStub("/test.Service/Reserve", "{\"name\":\"John\"}")
+	store.Add(context.Background(), matched)
+	journal := NewInMemoryJournal(2)
+	matcher := NewStubsMatcher(store, WithJournal(journal))
+
+	matcher.Match(context.Background(), "/test.Service/Reserve", "{\"name\":\"John\"}")
+	matcher.Match(context.Background(), "/test.Service/Charge", "{}")
+	entries := journal.GetAll()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, int64(1), entries[0].Seq)
+	assert.Equal(t, matched.ID, entries[0].StubID)
+	assert.Equal(t, "", entries[1].StubID)
+
+	matcher.Match(context.Background(), "/test.Service/Charge", "{}")
+	entries = journal.GetAll()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, int64(3), entries[1].Seq)
+
+	journal.Reset()
+	assert.Equal(t, 0, len(journal.GetAll()))
+}
+
+func TestVerifyOrder(t *testing.T) {
+	entries := []JournalEntry{
+		{FullMethod: "/test.Service/Reserve"},
+		{FullMethod: "/test.Service/Lookup"},
+		{FullMethod: "/test.Service/Charge"},
+		{FullMethod: "/test.Service/Charge"},
+	}
+
+	result := VerifyOrder(entries, []string{"Reserve", "/test.Service/Charge"}, false)
+	assert.True(t, result.InOrder)
+	assert.Equal(t, []string{"Reserve", "/test.Service/Charge", "/test.Service/Charge"}, result.Actual)
+
+	result = VerifyOrder(entries, []string{"Reserve", "Charge"}, true)
+	assert.False(t, result.InOrder)
+	assert.Equal(t, "  Reserve\n  Charge\n+ Charge", result.Diff)
+
+	result = VerifyOrder(entries, []string{"Charge", "Reserve"}, false)
+	assert.False(t, result.InOrder)
+	assert.Equal(t, "- Charge\n  Reserve\n+ Charge\n+ Charge", result.Diff)
+	suite := result.JUnit()
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, result.Diff, suite.TestCases[0].Failure.Text)
+}
+
+func TestStubsMatcher_Match_JournalRedactsMetadata(t *testing.T) {
+	defer util.ConfigurePayloadLogging(true, nil)
+	util.ConfigurePayloadLogging(true, []string{"authorization", "password"})
+	journal := NewInMemoryJournal(1)
+	matcher := NewStubsMatcher(NewInMemoryStubsStore(), WithJournal(journal))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret", "x-tenant", "acme"))
+	matcher.Match(ctx, "/test.Service/Login", "{\"password\":\"secret\"}")
+	entries := journal.GetAll()
+	assert.Equal(t, []string{util.RedactedValue}, entries[0].Metadata["authorization"])
+	assert.Equal(t, []string{"acme"}, entries[0].Metadata["x-tenant"])
+	assert.Equal(t, JsonString("{\"password\":\"[REDACTED]\"}"), entries[0].Request)
+}
@@ -0,0 +1,253 @@
+package stub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// journalFileName is the file the calls are appended to. The rotated files are named journal-<time>.ndjson, and
+	// journal-<time>-reset.ndjson when they are rotated by a reset of the journal.
+	journalFileName    = "journal.ndjson"
+	journalFilePrefix  = "journal-"
+	journalFileExt     = ".ndjson"
+	journalResetSuffix = "-reset"
+	// Fixed width, so the rotated files sort by name in the order they were rotated
+	journalTimeFormat = "20060102T150405.000000000"
+)
+
+// FileJournalOptions sets how many calls the journal keeps and how its files are rotated and retained
+type FileJournalOptions struct {
+	// MaxEntries is the number of calls kept in memory, and reloaded on restart. All are kept when 0.
+	MaxEntries int
+	// MaxFileSize is the size in bytes after which the file is rotated. It isn't rotated by size when 0.
+	MaxFileSize int64
+	// RotateInterval is the time after which the file is rotated. It isn't rotated by time when 0.
+	RotateInterval time.Duration
+	// MaxFiles is the number of rotated files kept. All are kept when 0.
+	MaxFiles int
+	// Retention is how long the rotated files are kept. They are kept forever when 0.
+	Retention time.Duration
+}
+
+// NewFileJournal creates a journal that, besides keeping the last calls in memory, appends every call to a file in the
+// directory as a line of JSON (NDJSON). The calls in the files are reloaded when the journal is created, so the journal
+// survives restarts. The calls before the last reset of the journal are not reloaded, but stay in the rotated files
+// for as long as they are retained.
+func NewFileJournal(dir string, options FileJournalOptions) (Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	j := &fileJournal{
+		dir:     dir,
+		options: options,
+		memory:  NewInMemoryJournal(options.MaxEntries).(*inMemoryJournal),
+		now:     time.Now,
+	}
+	j.removeExpired()
+	entries, err := j.load()
+	if err != nil {
+		return nil, err
+	}
+	j.memory.restore(entries)
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+type fileJournal struct {
+	dir     string
+	options FileJournalOptions
+	memory  *inMemoryJournal
+	now     func() time.Time
+	// file is the file being written, with its size and when it was opened
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+// Record keeps the call in memory and appends it to the file. The call is still kept in memory when it can't be
+// written to the file.
+func (j *fileJournal) Record(entry JournalEntry) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	entry = j.memory.record(entry)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("Failed to write call %d to the journal file: %s", entry.Seq, err.Error())
+		return
+	}
+	data = append(data, '\n')
+	if j.shouldRotate(int64(len(data))) {
+		j.rotate("")
+	}
+	if j.file == nil {
+		return
+	}
+	written, err := j.file.Write(data)
+	j.size += int64(written)
+	if err != nil {
+		log.Errorf("Failed to write call %d to the journal file: %s", entry.Seq, err.Error())
+	}
+}
+
+func (j *fileJournal) GetAll() []JournalEntry {
+	return j.memory.GetAll()
+}
+
+// Reset clears the calls in memory and rotates the file, so they aren't reloaded on restart
+func (j *fileJournal) Reset() {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.memory.Reset()
+	j.rotate(journalResetSuffix)
+}
+
+func (j *fileJournal) shouldRotate(next int64) bool {
+	if j.size == 0 {
+		return false
+	}
+	return (j.options.MaxFileSize > 0 && j.size+next > j.options.MaxFileSize) ||
+		(j.options.RotateInterval > 0 && j.now().Sub(j.openedAt) >= j.options.RotateInterval)
+}
+
+// rotate renames the file being written, adding the time to its name, and starts a new one. The files rotated more
+// than the retention ago are removed.
+func (j *fileJournal) rotate(suffix string) {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	active := filepath.Join(j.dir, journalFileName)
+	rotated := filepath.Join(j.dir, journalFilePrefix+j.now().UTC().Format(journalTimeFormat)+suffix+journalFileExt)
+	if err := os.Rename(active, rotated); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to rotate the journal file: %s", err.Error())
+	}
+	if err := j.open(); err != nil {
+		log.Errorf("Failed to open the journal file: %s", err.Error())
+	}
+	j.removeExpired()
+}
+
+func (j *fileJournal) open() error {
+	file, err := os.OpenFile(filepath.Join(j.dir, journalFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file, j.size, j.openedAt = file, info.Size(), j.now()
+	return nil
+}
+
+// rotatedFiles returns the rotated files, oldest first
+func (j *fileJournal) rotatedFiles() ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	rotated := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasPrefix(info.Name(), journalFilePrefix) && strings.HasSuffix(info.Name(), journalFileExt) {
+			rotated = append(rotated, info)
+		}
+	}
+	return rotated, nil
+}
+
+// load reads the calls recorded since the last reset, newest files first until there are enough calls to fill the
+// journal in memory
+func (j *fileJournal) load() ([]JournalEntry, error) {
+	rotated, err := j.rotatedFiles()
+	if err != nil {
+		return nil, err
+	}
+	files := []string{journalFileName}
+	for i := len(rotated) - 1; i >= 0; i-- {
+		name := rotated[i].Name()
+		if strings.HasSuffix(name, journalResetSuffix+journalFileExt) {
+			break
+		}
+		files = append(files, name)
+	}
+	entries := make([]JournalEntry, 0)
+	for _, name := range files {
+		fileEntries, err := readJournalFile(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(fileEntries, entries...)
+		if j.options.MaxEntries > 0 && len(entries) >= j.options.MaxEntries {
+			return entries[len(entries)-j.options.MaxEntries:], nil
+		}
+	}
+	return entries, nil
+}
+
+// removeExpired removes the oldest rotated files beyond the maximum number of files, and the ones rotated more than
+// the retention ago
+func (j *fileJournal) removeExpired() {
+	rotated, err := j.rotatedFiles()
+	if err != nil {
+		log.Errorf("Failed to list the journal files: %s", err.Error())
+		return
+	}
+	for i, info := range rotated {
+		expired := j.options.Retention > 0 && j.now().Sub(info.ModTime()) > j.options.Retention
+		if !expired && (j.options.MaxFiles <= 0 || len(rotated)-i <= j.options.MaxFiles) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(j.dir, info.Name())); err != nil {
+			log.Errorf("Failed to remove the journal file %s: %s", info.Name(), err.Error())
+		}
+	}
+}
+
+// readJournalFile reads the calls in the file. Lines that are not valid, e.g. the last line when the server stopped
+// while writing it, are skipped.
+func readJournalFile(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]JournalEntry, 0)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			entry := JournalEntry{}
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				log.Warnf("Skipping invalid line in the journal file %s: %s", path, jsonErr.Error())
+			} else {
+				entries = append(entries, entry)
+			}
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
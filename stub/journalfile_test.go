@@ -0,0 +1,113 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func journalFiles(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
+
+func TestFileJournal_ReloadsAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	journal, err := NewFileJournal(dir, FileJournalOptions{MaxEntries: 2})
+	assert.NoError(t, err)
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Reserve"})
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Charge"})
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Ship"})
+
+	// A call cut short when the server stopped
+	file, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	file.Write([]byte("{\"seq\":4,\"fullM"))
+	file.Close()
+
+	restarted, err := NewFileJournal(dir, FileJournalOptions{MaxEntries: 2})
+	assert.NoError(t, err)
+	entries := restarted.GetAll()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "/test.Service/Charge", entries[0].FullMethod)
+	assert.Equal(t, int64(3), entries[1].Seq)
+	restarted.Record(JournalEntry{FullMethod: "/test.Service/Notify"})
+	assert.Equal(t, int64(4), restarted.GetAll()[1].Seq)
+
+	// The calls before a reset are kept in the files but not reloaded
+	restarted.Reset()
+	restarted.Record(JournalEntry{FullMethod: "/test.Service/Refund"})
+	restarted, err = NewFileJournal(dir, FileJournalOptions{MaxEntries: 2})
+	assert.NoError(t, err)
+	entries = restarted.GetAll()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "/test.Service/Refund", entries[0].FullMethod)
+	assert.Equal(t, int64(1), entries[0].Seq)
+	assert.Equal(t, 2, len(journalFiles(t, dir)))
+}
+
+func TestFileJournal_Rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	journal, err := NewFileJournal(dir, FileJournalOptions{MaxFileSize: 100, RotateInterval: time.Hour, MaxFiles: 2})
+	assert.NoError(t, err)
+	now := time.Now()
+	journal.(*fileJournal).now = func() time.Time { return now }
+
+	// Each call is around 80 bytes, so every call after the first one rotates the file
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Reserve"})
+	now = now.Add(time.Second)
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Charge"})
+	assert.Equal(t, 2, len(journalFiles(t, dir)))
+	now = now.Add(time.Second)
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Ship"})
+	now = now.Add(time.Second)
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Notify"})
+	files := journalFiles(t, dir)
+	assert.Equal(t, 3, len(files))
+	assert.Equal(t, journalFileName, files[2])
+
+	// The calls in the files kept are reloaded
+	restarted, err := NewFileJournal(dir, FileJournalOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(restarted.GetAll()))
+	assert.Equal(t, "/test.Service/Charge", restarted.GetAll()[0].FullMethod)
+
+	// Rotated by time
+	journal, err = NewFileJournal(dir, FileJournalOptions{RotateInterval: time.Hour})
+	assert.NoError(t, err)
+	journal.(*fileJournal).now = func() time.Time { return now.Add(time.Hour) }
+	journal.Record(JournalEntry{FullMethod: "/test.Service/Refund"})
+	assert.Equal(t, 4, len(journalFiles(t, dir)))
+}
+
+func TestFileJournal_Retention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	old := filepath.Join(dir, "journal-20200101T000000.000000000.ndjson")
+	assert.NoError(t, ioutil.WriteFile(old, []byte("{\"seq\":1}\n"), 0644))
+	assert.NoError(t, os.Chtimes(old, time.Now().Add(-48*time.Hour), time.Now().Add(-48*time.Hour)))
+	recent := filepath.Join(dir, "journal-20200102T000000.000000000.ndjson")
+	assert.NoError(t, ioutil.WriteFile(recent, []byte("{\"seq\":2}\n"), 0644))
+
+	journal, err := NewFileJournal(dir, FileJournalOptions{Retention: 24 * time.Hour})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"journal-20200102T000000.000000000.ndjson", journalFileName}, journalFiles(t, dir))
+	assert.Equal(t, 1, len(journal.GetAll()))
+	assert.Equal(t, int64(2), journal.GetAll()[0].Seq)
+}
@@ -0,0 +1,246 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// JSONPathQuery is a predicate over the requests of the journal written as a JSONPath and an optional comparison, e.g.
+// $.order.id == "123", $.items[*].sku =~ "^ABC" or $.customer.email (the field is set). The paths support the fields
+// (.name or ['name']), the indexes of the lists ([0]) and the wildcard (.* or [*]), which selects all the items. The
+// operators are == != < <= > >= and =~ (matches a regular expression), and the values are JSON literals, with the
+// strings in double or single quotes. The query is true when any of the values selected by the path satisfies it. The
+// strings with numbers, as protojson encodes the 64 bit integers, are compared as numbers.
+type JSONPathQuery struct {
+	source   string
+	path     []jsonPathSegment
+	operator string
+	value    interface{}
+	regex    *regexp.Regexp
+}
+
+// jsonPathSegment selects a field, an item of a list or, when wildcard is set, all the fields or items
+type jsonPathSegment struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+var jsonPathFieldPattern = regexp.MustCompile(`^[\w-]+`)
+
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+// ParseJSONPathQuery parses a query
+func ParseJSONPathQuery(source string) (*JSONPathQuery, error) {
+	query := &JSONPathQuery{source: source}
+	rest := strings.TrimSpace(source)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, fmt.Errorf("invalid query '%s': the path must start with $", source)
+	}
+	rest = rest[1:]
+	for rest != "" && (rest[0] == '.' || rest[0] == '[') {
+		segment, remaining, err := parseJSONPathSegment(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query '%s': %w", source, err)
+		}
+		query.path = append(query.path, segment)
+		rest = remaining
+	}
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return query, nil
+	}
+	for _, operator := range jsonPathOperators {
+		if strings.HasPrefix(rest, operator) {
+			query.operator = operator
+			break
+		}
+	}
+	if query.operator == "" {
+		return nil, fmt.Errorf("invalid query '%s': unexpected '%s'", source, rest)
+	}
+	literal := strings.TrimSpace(rest[len(query.operator):])
+	if strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") && len(literal) > 1 {
+		query.value = strings.ReplaceAll(literal[1:len(literal)-1], `\'`, "'")
+	} else {
+		decoder := json.NewDecoder(strings.NewReader(literal))
+		decoder.UseNumber()
+		if err := decoder.Decode(&query.value); err != nil || decoder.More() {
+			return nil, fmt.Errorf("invalid query '%s': '%s' is not a valid value", source, literal)
+		}
+	}
+	if query.operator == "=~" {
+		pattern, isString := query.value.(string)
+		if !isString {
+			return nil, fmt.Errorf("invalid query '%s': =~ requires a regular expression in a string", source)
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query '%s': %w", source, err)
+		}
+		query.regex = regex
+	}
+	return query, nil
+}
+
+// parseJSONPathSegment parses the segment at the start of s, returning the rest of s
+func parseJSONPathSegment(s string) (jsonPathSegment, string, error) {
+	if s[0] == '.' {
+		if strings.HasPrefix(s, ".*") {
+			return jsonPathSegment{wildcard: true}, s[2:], nil
+		}
+		field := jsonPathFieldPattern.FindString(s[1:])
+		if field == "" {
+			return jsonPathSegment{}, "", fmt.Errorf("expected a field name after '.'")
+		}
+		return jsonPathSegment{field: field}, s[1+len(field):], nil
+	}
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return jsonPathSegment{}, "", fmt.Errorf("missing ']'")
+	}
+	inner := strings.TrimSpace(s[1:end])
+	rest := s[end+1:]
+	switch {
+	case inner == "*":
+		return jsonPathSegment{wildcard: true}, rest, nil
+	case len(inner) > 1 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+		return jsonPathSegment{field: inner[1 : len(inner)-1]}, rest, nil
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil || index < 0 {
+		return jsonPathSegment{}, "", fmt.Errorf("invalid index '%s'", inner)
+	}
+	return jsonPathSegment{index: index, isIndex: true}, rest, nil
+}
+
+func (q *JSONPathQuery) String() string {
+	return q.source
+}
+
+// Matches evaluates the query on a JSON payload. Payloads that are not valid JSON don't match.
+func (q *JSONPathQuery) Matches(payload JsonString) bool {
+	var root interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return false
+	}
+	for _, value := range q.selectValues(root) {
+		if q.satisfies(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectValues returns the values selected by the path
+func (q *JSONPathQuery) selectValues(root interface{}) []interface{} {
+	values := []interface{}{root}
+	for _, segment := range q.path {
+		selected := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			switch typedValue := value.(type) {
+			case map[string]interface{}:
+				if segment.wildcard {
+					for _, item := range typedValue {
+						selected = append(selected, item)
+					}
+				} else if item, found := typedValue[segment.field]; found && !segment.isIndex {
+					selected = append(selected, item)
+				}
+			case []interface{}:
+				if segment.wildcard {
+					selected = append(selected, typedValue...)
+				} else if segment.isIndex && segment.index < len(typedValue) {
+					selected = append(selected, typedValue[segment.index])
+				}
+			}
+		}
+		values = selected
+	}
+	return values
+}
+
+func (q *JSONPathQuery) satisfies(value interface{}) bool {
+	switch q.operator {
+	case "":
+		return value != nil
+	case "=~":
+		text, isString := value.(string)
+		if number, isNumber := value.(json.Number); isNumber {
+			text, isString = number.String(), true
+		}
+		return isString && q.regex.MatchString(text)
+	case "==":
+		return jsonPathEqual(value, q.value)
+	case "!=":
+		return !jsonPathEqual(value, q.value)
+	}
+	comparison, comparable := jsonPathCompare(value, q.value)
+	if !comparable {
+		return false
+	}
+	switch q.operator {
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	case ">":
+		return comparison > 0
+	}
+	return comparison >= 0
+}
+
+// jsonPathNumber converts the numbers and the strings with numbers into float64
+func jsonPathNumber(value interface{}) (float64, bool) {
+	switch typedValue := value.(type) {
+	case json.Number:
+		number, err := typedValue.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(typedValue, 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+func jsonPathEqual(value, expected interface{}) bool {
+	if number, isNumber := jsonPathNumber(value); isNumber {
+		if expectedNumber, isExpectedNumber := jsonPathNumber(expected); isExpectedNumber {
+			return number == expectedNumber
+		}
+	}
+	switch typedValue := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(typedValue)
+		expectedData, _ := json.Marshal(expected)
+		return string(data) == string(expectedData)
+	}
+	return value == expected
+}
+
+// jsonPathCompare compares numbers or strings, returning -1, 0 or 1
+func jsonPathCompare(value, expected interface{}) (int, bool) {
+	number, isNumber := jsonPathNumber(value)
+	expectedNumber, isExpectedNumber := jsonPathNumber(expected)
+	if isNumber && isExpectedNumber {
+		switch {
+		case number < expectedNumber:
+			return -1, true
+		case number > expectedNumber:
+			return 1, true
+		}
+		return 0, true
+	}
+	text, isString := value.(string)
+	expectedText, isExpectedString := expected.(string)
+	if !isString || !isExpectedString {
+		return 0, false
+	}
+	return strings.Compare(text, expectedText), true
+}
@@ -0,0 +1,48 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJSONPathQuery_Matches(t *testing.T) {
+	payload := JsonString(`{"order":{"id":"123","total":42.5,"customer":{"email":"ann@acme.com"}},"items":[{"sku":"ABC-1","quantity":2},{"sku":"XYZ-9","quantity":"7"}],"tags":[]}`)
+	for query, expected := range map[string]bool{
+		`$.order.id == "123"`:                          true,
+		`$.order.id == 123`:                            true,
+		`$.order.id != '123'`:                          false,
+		`$['order']["customer"].email`:                 true,
+		`$.order.customer.phone`:                       false,
+		`$.order.total > 40`:                           true,
+		`$.order.total <= 40`:                          false,
+		`$.items[1].sku == "XYZ-9"`:                    true,
+		`$.items[2].sku`:                               false,
+		`$.items[*].sku =~ "^ABC"`:                     true,
+		`$.items.*.quantity >= 7`:                      true,
+		`$.items[*].quantity > 7`:                      false,
+		`$.order.customer.email < "b"`:                 true,
+		`$.tags == []`:                                 true,
+		`$.order.customer == {"email":"ann@acme.com"}`: true,
+	} {
+		parsed, err := ParseJSONPathQuery(query)
+		assert.NoError(t, err, query)
+		assert.Equal(t, expected, parsed.Matches(payload), query)
+	}
+	parsed, _ := ParseJSONPathQuery(`$.order.id`)
+	assert.False(t, parsed.Matches("not json"))
+}
+
+func TestParseJSONPathQuery_Errors(t *testing.T) {
+	for query, message := range map[string]string{
+		`order.id == 1`:        "invalid query 'order.id == 1': the path must start with $",
+		`$.order[id]`:          "invalid query '$.order[id]': invalid index 'id'",
+		`$.order. == 1`:        "invalid query '$.order. == 1': expected a field name after '.'",
+		`$.order.id = 1`:       "invalid query '$.order.id = 1': unexpected '= 1'",
+		`$.order.id == 1 2`:    "invalid query '$.order.id == 1 2': '1 2' is not a valid value",
+		`$.order.id =~ 1`:      "invalid query '$.order.id =~ 1': =~ requires a regular expression in a string",
+		`$.order.id =~ "(abc"`: "invalid query '$.order.id =~ \"(abc\"': error parsing regexp: missing closing ): `(abc`",
+	} {
+		_, err := ParseJSONPathQuery(query)
+		assert.EqualError(t, err, message, query)
+	}
+}
@@ -0,0 +1,262 @@
+package stub
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema (draft-07), used by the editors to autocomplete and validate the stub files whatever the
+// language of the team writing them
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is the name of a type or a list of names
+	Type       interface{}            `json:"type,omitempty"`
+	Format     string                 `json:"format,omitempty"`
+	Pattern    string                 `json:"pattern,omitempty"`
+	Enum       []interface{}          `json:"enum,omitempty"`
+	Const      interface{}            `json:"const,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	// AdditionalProperties is a bool or the schema of the additional properties
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	If                   *JSONSchema            `json:"if,omitempty"`
+	Then                 *JSONSchema            `json:"then,omitempty"`
+	Definitions          map[string]*JSONSchema `json:"definitions,omitempty"`
+}
+
+// MethodMessages are the request and response messages of a method
+type MethodMessages struct {
+	FullMethod string
+	Request    protoreflect.MessageDescriptor
+	Response   protoreflect.MessageDescriptor
+}
+
+// NewStubsSchema returns the schema of the stub files, with a stub, an array of stubs or a StubsFile. The content of
+// the requests and responses of the stubs of the methods given is described by their messages, as in the JSON mapping
+// of protobuf, can reference a payload file (see ResolvePayloadFiles) or be in protobuf text format (see
+// ContentFormatText).
+func NewStubsSchema(methods []MethodMessages) *JSONSchema {
+	definitions := make(map[string]*JSONSchema)
+	stubRef := goTypeSchema(reflect.TypeOf(Stub{}), definitions)
+	stubsFileRef := goTypeSchema(reflect.TypeOf(StubsFile{}), definitions)
+	definitions["PayloadFile"] = &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{"$file": {Type: "string"}},
+		Required:             []string{"$file"},
+		AdditionalProperties: false,
+	}
+	textPayload := &JSONSchema{Type: "string", Description: "The message in protobuf text format, with contentFormat prototext"}
+	payload := func(message protoreflect.MessageDescriptor) *JSONSchema {
+		return &JSONSchema{AnyOf: []*JSONSchema{
+			messageSchema(message, definitions), {Ref: "#/definitions/PayloadFile"}, textPayload,
+		}}
+	}
+
+	sort.Slice(methods, func(i, j int) bool { return methods[i].FullMethod < methods[j].FullMethod })
+	stubSchema := definitions["Stub"]
+	// A file with a single stub can have its schema too
+	stubSchema.Properties["$schema"] = &JSONSchema{Type: "string"}
+	stubSchema.Properties["contentFormat"] = &JSONSchema{Type: "string", Enum: []interface{}{ContentFormatJSON, ContentFormatText}}
+	fullMethods := make([]interface{}, 0, len(methods))
+	for _, method := range methods {
+		fullMethods = append(fullMethods, method.FullMethod)
+		if method.Request == nil || method.Response == nil {
+			continue
+		}
+		stubSchema.AllOf = append(stubSchema.AllOf, &JSONSchema{
+			If: &JSONSchema{
+				Properties: map[string]*JSONSchema{"fullMethod": {Const: method.FullMethod}},
+				Required:   []string{"fullMethod"},
+			},
+			Then: &JSONSchema{Properties: map[string]*JSONSchema{
+				"request": {Properties: map[string]*JSONSchema{"content": payload(method.Request)}},
+				"response": {Properties: map[string]*JSONSchema{
+					"content": payload(method.Response),
+					"stream":  {Items: payload(method.Response)},
+				}},
+			}},
+		})
+	}
+	if len(fullMethods) > 0 {
+		stubSchema.Properties["fullMethod"] = &JSONSchema{Type: "string", Enum: fullMethods}
+	}
+	return &JSONSchema{
+		Schema:      jsonSchemaDraft,
+		Title:       "Stubs",
+		AnyOf:       []*JSONSchema{stubRef, {Type: "array", Items: stubRef}, stubsFileRef},
+		Definitions: definitions,
+	}
+}
+
+var (
+	jsonStringType = reflect.TypeOf(JsonString(""))
+	statusCodeType = reflect.TypeOf(StatusCode(0))
+	captureType    = reflect.TypeOf(Capture{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// goTypeSchema returns the schema of the JSON encoding of a type of the stubs. The structs are added to the definitions,
+// by name, and referenced.
+func goTypeSchema(t reflect.Type, definitions map[string]*JSONSchema) *JSONSchema {
+	switch t {
+	case jsonStringType:
+		return &JSONSchema{}
+	case statusCodeType:
+		names := make([]interface{}, 0, len(statusCodeNames))
+		for _, name := range statusCodeNames {
+			names = append(names, name)
+		}
+		return &JSONSchema{AnyOf: []*JSONSchema{{Type: "string", Enum: names}, {Type: "integer"}}}
+	case timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return goTypeSchema(t.Elem(), definitions)
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: goTypeSchema(t.Elem(), definitions)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: goTypeSchema(t.Elem(), definitions)}
+	case reflect.Struct:
+		ref := &JSONSchema{Ref: "#/definitions/" + t.Name()}
+		if _, found := definitions[t.Name()]; found {
+			return ref
+		}
+		schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+		definitions[t.Name()] = schema
+		addStructFields(schema, t, definitions)
+		if t == captureType {
+			// A capture can be only the path of the field
+			definitions[t.Name()] = &JSONSchema{AnyOf: []*JSONSchema{{Type: "string"}, schema}}
+		}
+		return ref
+	}
+	return &JSONSchema{}
+}
+
+// addStructFields adds the exported fields of the struct to the properties of the schema, named as in JSON
+func addStructFields(schema *JSONSchema, t reflect.Type, definitions map[string]*JSONSchema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			addStructFields(schema, field.Type, definitions)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = goTypeSchema(field.Type, definitions)
+	}
+}
+
+// messageSchema returns the schema of the JSON mapping of a message. The messages are added to the definitions, by full
+// name, and referenced.
+func messageSchema(message protoreflect.MessageDescriptor, definitions map[string]*JSONSchema) *JSONSchema {
+	name := string(message.FullName())
+	ref := &JSONSchema{Ref: "#/definitions/" + name}
+	if _, found := definitions[name]; found {
+		return ref
+	}
+	if schema, found := wellKnownTypeSchema(message); found {
+		definitions[name] = schema
+		return ref
+	}
+	schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema), AdditionalProperties: false}
+	definitions[name] = schema
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		var fieldSchema *JSONSchema
+		switch {
+		case field.IsMap():
+			fieldSchema = &JSONSchema{Type: "object", AdditionalProperties: fieldValueSchema(field.MapValue(), definitions)}
+		case field.IsList():
+			fieldSchema = &JSONSchema{Type: "array", Items: fieldValueSchema(field, definitions)}
+		default:
+			fieldSchema = fieldValueSchema(field, definitions)
+		}
+		// The fields can be named as in the proto files too
+		schema.Properties[field.JSONName()] = fieldSchema
+		schema.Properties[string(field.Name())] = fieldSchema
+	}
+	return ref
+}
+
+// fieldValueSchema returns the schema of a value of the field, ignoring whether it is repeated. The numbers can be given
+// as strings, as the 64 bits integers are encoded.
+func fieldValueSchema(field protoreflect.FieldDescriptor, definitions map[string]*JSONSchema) *JSONSchema {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return &JSONSchema{Type: "boolean"}
+	case protoreflect.StringKind:
+		return &JSONSchema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &JSONSchema{Type: "string", Description: "base64 encoded"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return &JSONSchema{Type: []string{"number", "string"}}
+	case protoreflect.EnumKind:
+		if field.Enum().FullName() == "google.protobuf.NullValue" {
+			return &JSONSchema{Type: "null"}
+		}
+		values := field.Enum().Values()
+		names := make([]interface{}, 0, values.Len())
+		for i := 0; i < values.Len(); i++ {
+			names = append(names, string(values.Get(i).Name()))
+		}
+		return &JSONSchema{AnyOf: []*JSONSchema{{Type: "string", Enum: names}, {Type: "integer"}}}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchema(field.Message(), definitions)
+	}
+	return &JSONSchema{Type: []string{"integer", "string"}}
+}
+
+// wellKnownTypeSchema returns the schema of the messages of google.protobuf that have a special JSON mapping
+func wellKnownTypeSchema(message protoreflect.MessageDescriptor) (*JSONSchema, bool) {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		return &JSONSchema{Type: "string", Format: "date-time"}, true
+	case "google.protobuf.Duration":
+		return &JSONSchema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]+)?s$`}, true
+	case "google.protobuf.FieldMask":
+		return &JSONSchema{Type: "string"}, true
+	case "google.protobuf.Struct":
+		return &JSONSchema{Type: "object"}, true
+	case "google.protobuf.ListValue":
+		return &JSONSchema{Type: "array"}, true
+	case "google.protobuf.Value":
+		return &JSONSchema{}, true
+	case "google.protobuf.Any":
+		return &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{"@type": {Type: "string"}},
+			Required: []string{"@type"}}, true
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue", "google.protobuf.Int64Value",
+		"google.protobuf.UInt64Value", "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return fieldValueSchema(message.Fields().ByName("value"), nil), true
+	}
+	return nil, false
+}
@@ -0,0 +1,48 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestNewStubsSchema(t *testing.T) {
+	request := (&descriptorpb.FieldDescriptorProto{}).ProtoReflect().Descriptor()
+	response := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	schema := NewStubsSchema([]MethodMessages{
+		{FullMethod: "/acme.Fields/Get", Request: request, Response: response},
+		{FullMethod: "/acme.Fields/Delete"},
+	})
+
+	assert.Equal(t, jsonSchemaDraft, schema.Schema)
+	assert.Equal(t, "#/definitions/Stub", schema.AnyOf[0].Ref)
+	assert.Equal(t, "#/definitions/Stub", schema.AnyOf[1].Items.Ref)
+	assert.Equal(t, "#/definitions/StubsFile", schema.AnyOf[2].Ref)
+	assert.Equal(t, "#/definitions/Stub", schema.Definitions["StubsFile"].Properties["stubs"].Items.Ref)
+	stubSchema := schema.Definitions["Stub"]
+	assert.Equal(t, false, stubSchema.AdditionalProperties)
+	assert.Equal(t, []interface{}{"/acme.Fields/Delete", "/acme.Fields/Get"}, stubSchema.Properties["fullMethod"].Enum)
+	assert.Equal(t, "#/definitions/StubRequest", stubSchema.Properties["request"].Ref)
+	assert.Equal(t, "string", stubSchema.Properties["labels"].AdditionalProperties.(*JSONSchema).Type)
+	assert.Equal(t, "date-time", stubSchema.Properties["createdAt"].Format)
+	assert.Equal(t, "string", schema.Definitions["Capture"].AnyOf[0].Type)
+	assert.Contains(t, schema.Definitions["ErrorResponse"].Properties["code"].AnyOf[0].Enum, "NOT_FOUND")
+
+	assert.Len(t, stubSchema.AllOf, 1)
+	assert.Equal(t, "/acme.Fields/Get", stubSchema.AllOf[0].If.Properties["fullMethod"].Const)
+	then := stubSchema.AllOf[0].Then
+	assert.Equal(t, "#/definitions/google.protobuf.FieldDescriptorProto", then.Properties["request"].Properties["content"].AnyOf[0].Ref)
+	assert.Equal(t, "#/definitions/PayloadFile", then.Properties["request"].Properties["content"].AnyOf[1].Ref)
+	assert.Equal(t, "string", then.Properties["request"].Properties["content"].AnyOf[2].Type)
+	assert.Equal(t, "#/definitions/google.protobuf.Struct", then.Properties["response"].Properties["stream"].Items.AnyOf[0].Ref)
+
+	field := schema.Definitions["google.protobuf.FieldDescriptorProto"]
+	assert.Equal(t, false, field.AdditionalProperties)
+	assert.Equal(t, "string", field.Properties["jsonName"].Type)
+	assert.Equal(t, field.Properties["jsonName"], field.Properties["json_name"])
+	assert.Equal(t, []string{"integer", "string"}, field.Properties["number"].Type)
+	assert.Contains(t, field.Properties["type"].AnyOf[0].Enum, "TYPE_STRING")
+	assert.Equal(t, "#/definitions/google.protobuf.FieldOptions", field.Properties["options"].Ref)
+	assert.Equal(t, "object", schema.Definitions["google.protobuf.Struct"].Type)
+}
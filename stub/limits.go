@@ -0,0 +1,155 @@
+package stub
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Eviction policies of the StubLimits
+const (
+	EvictionReject = "reject"
+	EvictionLRU    = "lru"
+	EvictionOldest = "oldest"
+)
+
+// StubLimits caps the number of stubs of a store, e.g. to protect a shared server from growing unbounded. A stub added
+// over a limit is rejected with ErrLimitExceeded or makes room by evicting another stub, depending on Eviction. When the
+// stubs are replaced altogether (e.g. by an import, a fixture or a snapshot), a new set over a limit is rejected as a
+// whole or has its stubs evicted in the same way until it fits.
+type StubLimits struct {
+	// MaxStubs is the number of stubs of the store. There is no limit when it is 0.
+	MaxStubs int `json:"maxStubs,omitempty"`
+	// MaxStubsPerMethod is the number of stubs of each method. There is no limit when it is 0.
+	MaxStubsPerMethod int `json:"maxStubsPerMethod,omitempty"`
+	// Eviction is the policy applied when a limit is reached: reject (the default) the stub added, evict the stub
+	// matched least recently (lru, the stubs never matched first) or the oldest stub (oldest)
+	Eviction string `json:"eviction,omitempty"`
+}
+
+// StoreStats describes the stubs of a store and the ones evicted or rejected due to its limits
+type StoreStats struct {
+	Stubs      int        `json:"stubs"`
+	Limits     StubLimits `json:"limits"`
+	Evictions  int64      `json:"evictions"`
+	Rejections int64      `json:"rejections"`
+}
+
+// ValidateEviction checks that the eviction policy is known
+func ValidateEviction(eviction string) error {
+	switch eviction {
+	case "", EvictionReject, EvictionLRU, EvictionOldest:
+		return nil
+	}
+	return fmt.Errorf("unknown eviction policy %s: it can only be '%s', '%s' or '%s'", eviction, EvictionReject,
+		EvictionLRU, EvictionOldest)
+}
+
+func (l StubLimits) eviction() string {
+	if l.Eviction == "" {
+		return EvictionReject
+	}
+	return l.Eviction
+}
+
+// storedStubs gives the stubs of a store to the limits, so that they are only listed when some must be evicted
+type storedStubs interface {
+	total() int
+	countOf(method string) int
+	stubsOf(method string) []*Stub
+	all() []*Stub
+}
+
+// evicted returns the stubs to evict so that a stub of the method can be added to the stored stubs, or
+// ErrLimitExceeded when the stub must be rejected. lastHit returns when a stub was last matched.
+func (l StubLimits) evicted(stored storedStubs, method string, lastHit func(stubID string) int64) ([]*Stub, error) {
+	evicted := make([]*Stub, 0)
+	if count := stored.countOf(method); l.MaxStubsPerMethod > 0 && count >= l.MaxStubsPerMethod {
+		if l.eviction() == EvictionReject {
+			return nil, fmt.Errorf("%w: %s already has %d stubs", ErrLimitExceeded, method, count)
+		}
+		evicted = append(evicted, l.victims(stored.stubsOf(method), count-l.MaxStubsPerMethod+1, lastHit)...)
+	}
+	if total := stored.total(); l.MaxStubs > 0 && total-len(evicted) >= l.MaxStubs {
+		if l.eviction() == EvictionReject {
+			return nil, fmt.Errorf("%w: the store already has %d stubs", ErrLimitExceeded, total)
+		}
+		candidates := withoutStubs(stored.all(), evicted)
+		evicted = append(evicted, l.victims(candidates, total-len(evicted)-l.MaxStubs+1, lastHit)...)
+	}
+	return evicted, nil
+}
+
+// fitted returns the stubs of the set that fit within the limits and the ones evicted to make them fit, or
+// ErrLimitExceeded when the set must be rejected. lastHit returns when a stub was last matched.
+func (l StubLimits) fitted(stubs []*Stub, lastHit func(stubID string) int64) (kept []*Stub, evicted []*Stub, err error) {
+	evicted = make([]*Stub, 0)
+	if l.MaxStubsPerMethod > 0 {
+		byMethod := make(map[string][]*Stub, 0)
+		methods := make([]string, 0)
+		for _, e := range stubs {
+			if _, found := byMethod[e.FullMethod]; !found {
+				methods = append(methods, e.FullMethod)
+			}
+			byMethod[e.FullMethod] = append(byMethod[e.FullMethod], e)
+		}
+		for _, method := range methods {
+			if count := len(byMethod[method]); count > l.MaxStubsPerMethod {
+				if l.eviction() == EvictionReject {
+					return nil, nil, fmt.Errorf("%w: %s would have %d stubs", ErrLimitExceeded, method, count)
+				}
+				evicted = append(evicted, l.victims(byMethod[method], count-l.MaxStubsPerMethod, lastHit)...)
+			}
+		}
+	}
+	kept = withoutStubs(stubs, evicted)
+	if l.MaxStubs > 0 && len(kept) > l.MaxStubs {
+		if l.eviction() == EvictionReject {
+			return nil, nil, fmt.Errorf("%w: the store would have %d stubs", ErrLimitExceeded, len(kept))
+		}
+		victims := l.victims(kept, len(kept)-l.MaxStubs, lastHit)
+		evicted = append(evicted, victims...)
+		kept = withoutStubs(kept, victims)
+	}
+	return kept, evicted, nil
+}
+
+// victims returns the first count stubs in the order of eviction
+func (l StubLimits) victims(stubs []*Stub, count int, lastHit func(stubID string) int64) []*Stub {
+	sorted := append([]*Stub(nil), stubs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if l.eviction() == EvictionLRU {
+			if hitI, hitJ := lastHit(sorted[i].ID), lastHit(sorted[j].ID); hitI != hitJ {
+				return hitI < hitJ
+			}
+		}
+		return isOlder(sorted[i], sorted[j])
+	})
+	if count > len(sorted) {
+		count = len(sorted)
+	}
+	return sorted[:count]
+}
+
+func isOlder(e, other *Stub) bool {
+	switch {
+	case e.CreatedAt == nil || other.CreatedAt == nil || e.CreatedAt.Equal(*other.CreatedAt):
+		return e.ID < other.ID
+	default:
+		return e.CreatedAt.Before(*other.CreatedAt)
+	}
+}
+
+// withoutStubs returns the stubs that are not removed, in the order given
+func withoutStubs(stubs []*Stub, removed []*Stub) []*Stub {
+	isRemoved := make(map[*Stub]bool, len(removed))
+	for _, e := range removed {
+		isRemoved[e] = true
+	}
+	kept := make([]*Stub, 0, len(stubs))
+	for _, e := range stubs {
+		if !isRemoved[e] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,333 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LintIssue is a problem found in the stubs before they are deployed
+type LintIssue struct {
+	// Index is the position of the stub with the problem in the stubs linted
+	Index int
+	// Other is the position of the other stub involved in duplicate and overlapping stubs, or -1
+	Other   int
+	Message string
+}
+
+// Lint checks the stubs statically: the stubs that are not valid or can't be resolved, the methods that don't exist
+// and the contents that don't match the messages of the method in files (these two are skipped when files is nil),
+// and the stubs that match the same requests as others. As the order in which the stubs of a method are tried is not
+// defined, the response to the requests matched by more than one stub can't be predicted. The stubs tried in a defined
+// order (see competes) are not reported.
+func Lint(stubs []*Stub, files *protoregistry.Files) []LintIssue {
+	issues := make([]LintIssue, 0)
+	resolved := make([]*Stub, len(stubs))
+	for i, s := range stubs {
+		r, err := ResolveExtends(s, stubs[:i])
+		if err != nil {
+			issues = append(issues, LintIssue{Index: i, Other: -1, Message: err.Error()})
+			continue
+		}
+		if isValid, errMsgs := r.IsValid(); !isValid {
+			for _, msg := range errMsgs {
+				issues = append(issues, LintIssue{Index: i, Other: -1, Message: msg})
+			}
+			continue
+		}
+		if r.ContentFormat == ContentFormatText {
+			// The contents in protobuf text format can only be read with the messages of the method
+			method := findMethod(files, r.FullMethod)
+			if method == nil {
+				if files != nil {
+					issues = append(issues, LintIssue{Index: i, Other: -1, Message: fmt.Sprintf("Method %s does not exist.", r.FullMethod)})
+				}
+				continue
+			}
+			r = r.Clone()
+			newMessage := func(message protoreflect.MessageDescriptor) func() proto.Message {
+				return func() proto.Message { return dynamicpb.NewMessage(message) }
+			}
+			if err := ConvertTextContent(r, newMessage(method.Input()), newMessage(method.Output())); err != nil {
+				issues = append(issues, LintIssue{Index: i, Other: -1, Message: err.Error()})
+				continue
+			}
+		}
+		resolved[i] = r
+		if files == nil {
+			continue
+		}
+		for _, msg := range lintSchema(r, files) {
+			issues = append(issues, LintIssue{Index: i, Other: -1, Message: msg})
+		}
+	}
+	for i, s := range resolved {
+		for j := i + 1; j < len(resolved); j++ {
+			other := resolved[j]
+			if s == nil || other == nil || s.FullMethod != other.FullMethod || !competes(s, other) {
+				continue
+			}
+			covers, covered := s.coversRequests(other), other.coversRequests(s)
+			switch {
+			case covers && covered:
+				issues = append(issues, LintIssue{Index: j, Other: i,
+					Message: fmt.Sprintf("Duplicate of stub %d: both match the same requests.", i)})
+			case covers:
+				issues = append(issues, LintIssue{Index: j, Other: i,
+					Message: fmt.Sprintf("Overlaps stub %d: the requests it matches are matched by stub %d too.", i, i)})
+			case covered:
+				issues = append(issues, LintIssue{Index: i, Other: j,
+					Message: fmt.Sprintf("Overlaps stub %d: the requests it matches are matched by stub %d too.", j, j)})
+			}
+		}
+	}
+	return issues
+}
+
+// lintSchema checks that the method of the stub exists and that its contents match the messages of the method
+func lintSchema(s *Stub, files *protoregistry.Files) []string {
+	method := findMethod(files, s.FullMethod)
+	if method == nil {
+		return []string{fmt.Sprintf("Method %s does not exist.", s.FullMethod)}
+	}
+	errMsgs := make([]string, 0)
+	if s.Request.Content != "" {
+		errMsgs = append(errMsgs, validateJSONMessage(method.Input(), s.Request.Content, "request.content")...)
+	}
+	if s.Response.Type == "success" && s.Response.Content != "" {
+		errMsgs = append(errMsgs, validateJSONMessage(method.Output(), s.Response.Content, "response.content")...)
+	}
+	for i, message := range s.Response.Stream {
+		errMsgs = append(errMsgs, validateJSONMessage(method.Output(), message, fmt.Sprintf("response.stream[%d]", i))...)
+	}
+	if pages := s.Response.Pages; pages != nil {
+		field := method.Output().Fields().ByJSONName(pages.Field)
+		if field == nil || !field.IsList() || field.Message() == nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Field '%s' of response.pages is not a repeated message field.", pages.Field))
+		} else {
+			for i, item := range pages.Items {
+				errMsgs = append(errMsgs, validateJSONMessage(field.Message(), item, fmt.Sprintf("response.pages.items[%d]", i))...)
+			}
+		}
+	}
+	return errMsgs
+}
+
+func findMethod(files *protoregistry.Files, fullMethod string) protoreflect.MethodDescriptor {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 {
+		return nil
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(parts[0]))
+	if err != nil {
+		return nil
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	return service.Methods().ByName(protoreflect.Name(parts[1]))
+}
+
+func validateJSONMessage(message protoreflect.MessageDescriptor, content JsonString, baseName string) []string {
+	object := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(content), &object); err != nil {
+		return []string{fmt.Sprintf("Field '%s' is not a valid JSON object.", baseName)}
+	}
+	return validateJSONObject(message, object, baseName)
+}
+
+// validateJSONObject checks the JSON object against the message in the JSON mapping of protobuf. Fields can be named
+// by their JSON or proto names.
+func validateJSONObject(message protoreflect.MessageDescriptor, object map[string]interface{}, baseName string) []string {
+	errMsgs := make([]string, 0)
+	fields := message.Fields()
+	for name, value := range object {
+		field := fields.ByJSONName(name)
+		if field == nil {
+			field = fields.ByName(protoreflect.Name(name))
+		}
+		if field == nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Field '%s.%s' does not exist", baseName, name))
+			continue
+		}
+		fieldName := baseName + "." + name
+		switch {
+		case field.IsList():
+			items, ok := value.([]interface{})
+			if !ok {
+				if value != nil && value != UnsetMarker {
+					errMsgs = append(errMsgs, fmt.Sprintf("Field '%s' is expected to be an array.", fieldName))
+				}
+				continue
+			}
+			for i, item := range items {
+				errMsgs = append(errMsgs, validateJSONValue(field, item, fmt.Sprintf("%s[%d]", fieldName, i))...)
+			}
+		case field.IsMap():
+			entries, ok := value.(map[string]interface{})
+			if !ok {
+				if value != nil && value != UnsetMarker {
+					errMsgs = append(errMsgs, fmt.Sprintf("Field '%s' is expected to be an object.", fieldName))
+				}
+				continue
+			}
+			for key, entry := range entries {
+				errMsgs = append(errMsgs, validateJSONValue(field.MapValue(), entry, fieldName+"."+key)...)
+			}
+		default:
+			errMsgs = append(errMsgs, validateJSONValue(field, value, fieldName)...)
+		}
+	}
+	return errMsgs
+}
+
+func validateJSONValue(field protoreflect.FieldDescriptor, value interface{}, name string) []string {
+	if value == nil || value == UnsetMarker {
+		return nil
+	}
+	if s, ok := value.(string); ok && HasPlaceholders(s) {
+		// Rendered when the response is sent
+		return nil
+	}
+	expected := ""
+	switch field.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if strings.HasPrefix(string(field.Message().FullName()), "google.protobuf.") {
+			// The well known types have their own JSON representations
+			return nil
+		}
+		object, ok := value.(map[string]interface{})
+		if ok {
+			return validateJSONObject(field.Message(), object, name)
+		}
+		expected = "an object"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		if _, ok := value.(string); !ok {
+			expected = "a string"
+		}
+	case protoreflect.BoolKind:
+		if _, ok := value.(bool); !ok {
+			expected = "a boolean"
+		}
+	case protoreflect.EnumKind:
+		switch v := value.(type) {
+		case float64:
+		case string:
+			if field.Enum().Values().ByName(protoreflect.Name(v)) == nil {
+				return []string{fmt.Sprintf("Field '%s' is expected to be one of the values of %s.", name, field.Enum().FullName())}
+			}
+		default:
+			expected = "an enum value"
+		}
+	default:
+		// Numbers. The 64 bits integers and the special floating point values can be strings too.
+		switch value.(type) {
+		case float64, string:
+		default:
+			expected = "a number"
+		}
+	}
+	if expected != "" {
+		return []string{fmt.Sprintf("Field '%s' is expected to be %s.", name, expected)}
+	}
+	return nil
+}
+
+// competes checks if the stubs can be tried for the same calls in an undefined order. The stubs of different matching
+// ranks are tried in order (see matchingRank), e.g. the fallback stubs after the others, and the stubs of different
+// fixtures are alternatives, e.g. happy-path and payment-declined, that are not meant to be active at the same time.
+func competes(s, other *Stub) bool {
+	return matchingRank(s) == matchingRank(other) && (s.Fixture == "" || other.Fixture == "" || s.Fixture == other.Fixture)
+}
+
+// coversRequests checks if all the requests matched by other are matched by s too
+func (s *Stub) coversRequests(other *Stub) bool {
+	if !s.Scenario.coversStates(other.Scenario) {
+		return false
+	}
+	// The stubs of a set only match the calls of the sessions it is active for
+	if s.Set != "" && s.Set != other.Set {
+		return false
+	}
+	request, otherRequest := s.Request, other.Request
+	if request.MatchExpr != "" && request.MatchExpr != otherRequest.MatchExpr {
+		return false
+	}
+	if len(request.Capture) > 0 && !request.Capture.equal(otherRequest.Capture) {
+		return false
+	}
+	if request.Peer != nil && !reflect.DeepEqual(request.Peer, otherRequest.Peer) {
+		return false
+	}
+	if request.Transport != nil && !reflect.DeepEqual(request.Transport, otherRequest.Transport) {
+		return false
+	}
+	otherMetadata := lintMetadata(other)
+	for key, values := range lintMetadata(s) {
+		if !reflect.DeepEqual(values, otherMetadata[key]) {
+			return false
+		}
+	}
+	for name, value := range request.Claims {
+		if otherValue, found := otherRequest.Claims[name]; !found || otherValue != value {
+			return false
+		}
+	}
+	switch {
+	case request.Match == "":
+		return true
+	case otherRequest.Match == "":
+		return request.Match == "partial" && len(request.parsedContent()) == 0
+	case request.Match == "exact":
+		return otherRequest.Match == "exact" && reflect.DeepEqual(request.parsedContent(), otherRequest.parsedContent())
+	}
+	return contentCovers(request.parsedContent(), otherRequest.parsedContent(), otherRequest.Match == "exact")
+}
+
+// contentCovers checks if all the requests matched by the content other are matched by the partial content too
+func contentCovers(content, other map[string]interface{}, otherIsExact bool) bool {
+	for key, value := range content {
+		otherValue, found := other[key]
+		if value == UnsetMarker {
+			if !(otherValue == UnsetMarker || otherIsExact && !found) {
+				return false
+			}
+			continue
+		}
+		if !found || otherValue == UnsetMarker || !jsonValueMatches(value, otherValue, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// coversStates checks if the stub with the scenario s can match in all the states the stub with other can
+func (s *StubScenario) coversStates(other *StubScenario) bool {
+	if s == nil || s.RequiredState == "" {
+		return true
+	}
+	return other != nil && other.Name == s.Name && other.RequiredState == s.RequiredState
+}
+
+// lintMetadata returns the metadata matched by the stub with the keys in lowercase, as they are looked up in the
+// metadata of the calls, and the values sorted
+func lintMetadata(s *Stub) map[string][]string {
+	md := make(map[string][]string, len(s.Request.Metadata))
+	for key, values := range getStubMetadata(s) {
+		md[strings.ToLower(key)] = sortedStrings(values)
+	}
+	return md
+}
+
+func sortedStrings(values []string) []string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return sorted
+}
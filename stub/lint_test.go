@@ -0,0 +1,147 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+)
+
+func newLintFiles(t *testing.T) *protoregistry.Files {
+	field := func(name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     fieldType.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+	status := field("status", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM)
+	status.TypeName = proto.String(".test.Status")
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name:  proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{{Name: proto.String("OPEN"), Number: proto.Int32(0)}},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Request"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			}},
+			{Name: proto.String("Response"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				status,
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Orders"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Get"),
+				InputType:  proto.String(".test.Request"),
+				OutputType: proto.String(".test.Response"),
+			}},
+		}},
+	}}})
+	assert.NoError(t, err)
+	return files
+}
+
+func newLintStub(fullMethod, match string, request, response JsonString) *Stub {
+	return &Stub{
+		FullMethod: fullMethod,
+		Request:    &StubRequest{Match: match, Content: request},
+		Response:   &StubResponse{Type: "success", Content: response},
+	}
+}
+
+func TestLint_Schema(t *testing.T) {
+	stubs := []*Stub{
+		newLintStub("/test.Orders/Get", "exact", "{\"id\":1}", "{\"id\":1,\"status\":\"OPEN\"}"),
+		newLintStub("/test.Orders/List", "exact", "{\"id\":1}", "{}"),
+		newLintStub("/test.Orders/Get", "exact", "{\"id\":\"${unset}\",\"name\":2,\"age\":3}",
+			"{\"id\":\"${request.id}\",\"status\":\"CLOSED\"}"),
+		{FullMethod: "/test.Orders/Get", Request: &StubRequest{Match: "fuzzy", Content: "{}"}, Response: &StubResponse{Type: "success", Content: "{}"}},
+	}
+	issues := Lint(stubs, newLintFiles(t))
+	assert.ElementsMatch(t, []LintIssue{
+		{Index: 1, Other: -1, Message: "Method /test.Orders/List does not exist."},
+		{Index: 2, Other: -1, Message: "Field 'request.content.name' is expected to be a string."},
+		{Index: 2, Other: -1, Message: "Field 'request.content.age' does not exist"},
+		{Index: 2, Other: -1, Message: "Field 'response.content.status' is expected to be one of the values of test.Status."},
+		{Index: 3, Other: -1, Message: "Request matching type can only be either 'exact' or 'partial'."},
+	}, issues)
+
+	// Without descriptors only the stubs themselves are checked
+	issues = Lint(stubs, nil)
+	assert.Equal(t, []LintIssue{{Index: 3, Other: -1, Message: "Request matching type can only be either 'exact' or 'partial'."}}, issues)
+}
+
+func TestLint_Overlaps(t *testing.T) {
+	stubs := []*Stub{
+		newLintStub("/test.Orders/Get", "exact", "{\"id\":1,\"name\":\"a\"}", "{}"),
+		newLintStub("/test.Orders/Get", "partial", "{\"id\":1}", "{}"),
+		newLintStub("/test.Orders/Get", "exact", "{\"name\":\"a\",\"id\":1}", "{}"),
+		newLintStub("/test.Orders/Get", "partial", "{\"id\":2}", "{}"),
+		newLintStub("/test.Orders/Get", "exact", "{\"id\":2,\"name\":\"b\"}", "{}"),
+		{Name: "b", Extends: "4", Scenario: &StubScenario{Name: "s", RequiredState: "started"}},
+	}
+	stubs[4].Name = "4"
+	stubs[4].Request.Metadata = map[string][]string{"tenant": {"acme"}}
+	issues := Lint(stubs, nil)
+	assert.ElementsMatch(t, []LintIssue{
+		{Index: 0, Other: 1, Message: "Overlaps stub 1: the requests it matches are matched by stub 1 too."},
+		{Index: 2, Other: 0, Message: "Duplicate of stub 0: both match the same requests."},
+		{Index: 2, Other: 1, Message: "Overlaps stub 1: the requests it matches are matched by stub 1 too."},
+		{Index: 4, Other: 3, Message: "Overlaps stub 3: the requests it matches are matched by stub 3 too."},
+		{Index: 5, Other: 3, Message: "Overlaps stub 3: the requests it matches are matched by stub 3 too."},
+		{Index: 5, Other: 4, Message: "Overlaps stub 4: the requests it matches are matched by stub 4 too."},
+	}, issues)
+}
+
+func TestLint_Overlaps_MatchingDimensions(t *testing.T) {
+	overlap := []LintIssue{{Index: 1, Other: 0, Message: "Overlaps stub 0: the requests it matches are matched by stub 0 too."}}
+	tests := []struct {
+		name   string
+		change func(first, second *Stub)
+		issues []LintIssue
+	}{
+		{"same set", func(first, second *Stub) { first.Set, second.Set = "blue", "blue" }, overlap},
+		{"set of the covering stub not active", func(first, second *Stub) { first.Set = "blue" }, []LintIssue{}},
+		{"set of the covered stub", func(first, second *Stub) { second.Set = "blue" }, overlap},
+		{"different sets", func(first, second *Stub) { first.Set, second.Set = "blue", "green" }, []LintIssue{}},
+		{"fallback tried after the others", func(first, second *Stub) { first.Fallback = true }, []LintIssue{}},
+		{"both fallback", func(first, second *Stub) { first.Fallback, second.Fallback = true, true }, overlap},
+		{"same fixture", func(first, second *Stub) { first.Fixture, second.Fixture = "happy-path", "happy-path" }, overlap},
+		{"different fixtures", func(first, second *Stub) { first.Fixture, second.Fixture = "happy-path", "declined" }, []LintIssue{}},
+		{"fixture and added stub", func(first, second *Stub) { second.Fixture = "declined" }, overlap},
+		{"metadata keys in any case", func(first, second *Stub) {
+			first.Request.Metadata = map[string][]string{"Tenant": {"acme"}}
+			second.Request.Metadata = map[string][]string{"tenant": {"acme"}}
+		}, overlap},
+		{"different metadata", func(first, second *Stub) {
+			first.Request.Metadata = map[string][]string{"tenant": {"acme"}}
+			second.Request.Metadata = map[string][]string{"tenant": {"other"}}
+		}, []LintIssue{}},
+		{"same expression", func(first, second *Stub) {
+			first.Request.MatchExpr, second.Request.MatchExpr = "request.id > 0", "request.id > 0"
+		}, overlap},
+		{"expression of the covered stub", func(first, second *Stub) { second.Request.MatchExpr = "request.id > 0" }, overlap},
+		{"different expressions", func(first, second *Stub) {
+			first.Request.MatchExpr, second.Request.MatchExpr = "request.id > 0", "request.id > 1"
+		}, []LintIssue{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			first := newLintStub("/test.Orders/Get", "partial", "{\"id\":1}", "{}")
+			second := newLintStub("/test.Orders/Get", "exact", "{\"id\":1,\"name\":\"a\"}", "{}")
+			test.change(first, second)
+			assert.Equal(t, test.issues, Lint([]*Stub{first, second}, nil))
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envPattern matches the environment variables ${env:NAME} or ${env:NAME:-default} interpolated in the stub files.
+// $${env:NAME} is kept as a literal.
+var envPattern = regexp.MustCompile(`\$?\$\{env:([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// LoadStubsFromDir reads the stubs in the JSON files (*.json) of the directory (see LoadStubsFromFile). The files are
+// read in lexical order.
+func LoadStubsFromDir(dir string) ([]*Stub, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	stubs := make([]*Stub, 0)
+	for _, file := range files {
+		fileStubs, err := LoadStubsFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		stubs = append(stubs, fileStubs...)
+	}
+	return stubs, nil
+}
+
+// StubsFile is a stub file with the schema of the file, e.g. the one served at /schemas, so that the editors validate
+// and autocomplete it, and the stub files it includes
+type StubsFile struct {
+	Schema string `json:"$schema,omitempty"`
+	// Include are the stub files loaded before the stubs of the file, relative to its directory. They can be glob
+	// patterns, e.g. common/*.json.
+	Include []string `json:"include,omitempty"`
+	// Authority scopes the stubs of the file without transport authority to a virtual host (see
+	// TransportMatcher.Authority), e.g. one file per host impersonated. The stubs included are not scoped.
+	Authority string  `json:"authority,omitempty"`
+	Stubs     []*Stub `json:"stubs,omitempty"`
+}
+
+// LoadStubsFromFile reads the stubs in a JSON file containing a single stub, an array of stubs or a StubsFile. The
+// environment variables ${env:NAME} in the file are replaced by their values and the contents that reference a file,
+// e.g. {"$file": "order.json"}, are read from the file, relative to the directory of the stub file.
+func LoadStubsFromFile(file string) ([]*Stub, error) {
+	return loadStubsFile(file, make(map[string]bool))
+}
+
+// loadStubsFile reads the stubs of the file and the files it includes. loading are the files being loaded, to detect
+// the files that include themselves.
+func loadStubsFile(file string, loading map[string]bool) ([]*Stub, error) {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read stubs file %s: %w", file, err)
+	}
+	if loading[path] {
+		return nil, fmt.Errorf("invalid stubs file %s: it includes itself", file)
+	}
+	loading[path] = true
+	defer delete(loading, path)
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read stubs file %s: %w", file, err)
+	}
+	data, err = interpolateEnv(data, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stubs file %s: %w", file, err)
+	}
+	stubsFile, err := parseStubsFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stubs file %s: %w", file, err)
+	}
+	dir := filepath.Dir(file)
+	stubs := make([]*Stub, 0, len(stubsFile.Stubs))
+	for _, include := range stubsFile.Include {
+		files, err := filepath.Glob(filepath.Join(dir, include))
+		if err == nil && len(files) == 0 {
+			err = fmt.Errorf("no file found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid stubs file %s: include %s: %w", file, include, err)
+		}
+		sort.Strings(files)
+		for _, included := range files {
+			includedStubs, err := loadStubsFile(included, loading)
+			if err != nil {
+				return nil, err
+			}
+			stubs = append(stubs, includedStubs...)
+		}
+	}
+	readPayload := func(name string) ([]byte, bool) {
+		payload, err := ioutil.ReadFile(filepath.Join(dir, name))
+		return payload, err == nil
+	}
+	for _, s := range stubsFile.Stubs {
+		if err := resolvePayloadFiles(s, readPayload); err != nil {
+			return nil, fmt.Errorf("invalid stubs file %s: %w", file, err)
+		}
+	}
+	return append(stubs, stubsFile.Stubs...), nil
+}
+
+// ParseStubs decodes a single stub, an array of stubs or a StubsFile in JSON format. The StubsFile can't include other
+// files.
+func ParseStubs(data []byte) ([]*Stub, error) {
+	stubsFile, err := parseStubsFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(stubsFile.Include) > 0 {
+		return nil, fmt.Errorf("the stubs can only include other files when they are loaded from a file")
+	}
+	return stubsFile.Stubs, nil
+}
+
+func parseStubsFile(data []byte) (*StubsFile, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		stubs := make([]*Stub, 0)
+		if err := json.Unmarshal(data, &stubs); err != nil {
+			return nil, err
+		}
+		return &StubsFile{Stubs: stubs}, nil
+	}
+	// A stub file is told from a stub by its fields, as a stub has neither stubs nor include
+	fields := make(map[string]json.RawMessage)
+	if json.Unmarshal(data, &fields) == nil && (fields["stubs"] != nil || fields["include"] != nil) {
+		stubsFile := new(StubsFile)
+		if err := json.Unmarshal(data, stubsFile); err != nil {
+			return nil, err
+		}
+		stubsFile.scopeToAuthority()
+		return stubsFile, nil
+	}
+	s := new(Stub)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return &StubsFile{Stubs: []*Stub{s}}, nil
+}
+
+func (f *StubsFile) scopeToAuthority() {
+	if f.Authority == "" {
+		return
+	}
+	for _, s := range f.Stubs {
+		if s == nil || s.Request == nil {
+			continue
+		}
+		if s.Request.Transport == nil {
+			s.Request.Transport = new(TransportMatcher)
+		}
+		if s.Request.Transport.Authority == "" {
+			s.Request.Transport.Authority = f.Authority
+		}
+	}
+}
+
+// interpolateEnv replaces the environment variables in the JSON data. As they can only be in JSON strings, the values
+// are escaped. Variables that are not set and have no default are an error.
+func interpolateEnv(data []byte, lookup func(name string) (string, bool)) ([]byte, error) {
+	var err error
+	interpolated := envPattern.ReplaceAllFunc(data, func(placeholder []byte) []byte {
+		if strings.HasPrefix(string(placeholder), "$$") {
+			return placeholder
+		}
+		groups := envPattern.FindSubmatch(placeholder)
+		value, found := lookup(string(groups[1]))
+		if !found {
+			if len(groups[2]) == 0 {
+				if err == nil {
+					err = fmt.Errorf("environment variable %s is not set", groups[1])
+				}
+				return placeholder
+			}
+			value = strings.TrimPrefix(string(groups[2]), ":-")
+		}
+		escaped, _ := json.Marshal(value)
+		return escaped[1 : len(escaped)-1]
+	})
+	return interpolated, err
+}
+
+// ResolvePayloadFiles replaces the request content, the response content and the stream messages of the stub that
+// reference a file, e.g. {"$file": "order.json"}, with the content of the file, found in files by name. The files of
+// the stubs in protobuf text format (see ContentFormatText) are in text format too, e.g. order.textproto.
+func ResolvePayloadFiles(s *Stub, files map[string][]byte) error {
+	return resolvePayloadFiles(s, func(name string) ([]byte, bool) {
+		payload, found := files[name]
+		return payload, found
+	})
+}
+
+// resolvePayloadFiles replaces the contents that reference a file with the content read by readFile
+func resolvePayloadFiles(s *Stub, readFile func(name string) ([]byte, bool)) error {
+	resolve := func(content JsonString) (JsonString, error) {
+		data := bytes.TrimSpace([]byte(content))
+		if !bytes.Contains(data, []byte(`"$file"`)) {
+			return content, nil
+		}
+		reference := make(map[string]string)
+		if json.Unmarshal(data, &reference) != nil || len(reference) != 1 || reference["$file"] == "" {
+			return content, nil
+		}
+		payload, found := readFile(reference["$file"])
+		if !found {
+			return "", fmt.Errorf("payload file %s not found", reference["$file"])
+		}
+		if s.ContentFormat == ContentFormatText {
+			text, _ := json.Marshal(string(payload))
+			return JsonString(text), nil
+		}
+		if !json.Valid(payload) {
+			return "", fmt.Errorf("payload file %s is not valid JSON", reference["$file"])
+		}
+		return JsonString(bytes.TrimSpace(payload)), nil
+	}
+	var err error
+	if s.Request != nil {
+		if s.Request.Content, err = resolve(s.Request.Content); err != nil {
+			return err
+		}
+	}
+	if s.Response == nil {
+		return nil
+	}
+	if s.Response.Content, err = resolve(s.Response.Content); err != nil {
+		return err
+	}
+	for i, message := range s.Response.Stream {
+		if s.Response.Stream[i], err = resolve(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStubsFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stubs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	single := `{"fullMethod":"method1","request":{"match":"exact","content":{"name":"John"}},"response":{"type":"success","content":{}}}`
+	list := `[
+		{"fullMethod":"method2","request":{"match":"exact","content":{}},"response":{"type":"success","content":{}}},
+		{"fullMethod":"method3","request":{"match":"partial","content":{}},"response":{"type":"success","content":{}}}
+	]`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte(single), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.json"), []byte(list), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not a stub"), 0644))
+
+	stubs, err := LoadStubsFromDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(stubs))
+	assert.Equal(t, "method1", stubs[0].FullMethod)
+	assert.Equal(t, JsonString(`{"name":"John"}`), stubs[0].Request.Content)
+	assert.Equal(t, "method3", stubs[2].FullMethod)
+}
+
+func TestLoadStubsFromDir_InvalidFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stubs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.json"), []byte("{"), 0644))
+
+	_, err = LoadStubsFromDir(dir)
+	assert.Error(t, err)
+}
+
+func TestLoadStubsFromFile_StubsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stubs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "common", "payloads"), 0755))
+
+	common := `{"$schema":"http://localhost:1068/schemas","fullMethod":"method1","request":{"match":"exact","content":{}},` +
+		`"response":{"type":"success","content":{"$file":"payloads/order.json"}}}`
+	file := `{
+		"$schema": "http://localhost:1068/schemas",
+		"include": ["common/*.json"],
+		"stubs": [{"fullMethod":"method2","request":{"match":"exact","content":{"$file":"common/payloads/order.json"}},"response":{"type":"success","content":{}}}]
+	}`
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "common", "order.json"), []byte(common), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "common", "payloads", "order.json"), []byte(`{"id": "1"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "orders.json"), []byte(file), 0644))
+
+	stubs, err := LoadStubsFromFile(filepath.Join(dir, "orders.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stubs))
+	assert.Equal(t, "method1", stubs[0].FullMethod)
+	assert.Equal(t, JsonString(`{"id": "1"}`), stubs[0].Response.Content)
+	assert.Equal(t, "method2", stubs[1].FullMethod)
+	assert.Equal(t, JsonString(`{"id": "1"}`), stubs[1].Request.Content)
+
+	// The stubs sent to the REST API can't include files
+	_, err = ParseStubs([]byte(file))
+	assert.Error(t, err)
+
+	stubs, err = ParseStubs([]byte(`{"authority": "orders.eu.acme.com", "stubs": [` +
+		`{"fullMethod":"method1","request":{"match":"exact","content":{}},"response":{"type":"success","content":{}}},` +
+		`{"fullMethod":"method1","request":{"match":"exact","content":{},"transport":{"authority":"orders.us.acme.com"}},"response":{"type":"success","content":{}}}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "orders.eu.acme.com", stubs[0].Request.Transport.Authority)
+	assert.Equal(t, "orders.us.acme.com", stubs[1].Request.Transport.Authority)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "common", "order.json"), []byte(`{"include": ["../orders.json"]}`), 0644))
+	_, err = LoadStubsFromFile(filepath.Join(dir, "orders.json"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "it includes itself")
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	env := map[string]string{"HOST": "api.example.com", "QUOTE": "say \"hi\""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	data, err := interpolateEnv([]byte(`{"url":"https://${env:HOST}/v1","text":"${env:QUOTE}","id":"${env:ID:-42}","literal":"$${env:HOST}"}`), lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"url":"https://api.example.com/v1","text":"say \"hi\"","id":"42","literal":"$${env:HOST}"}`, string(data))
+
+	_, err = interpolateEnv([]byte(`{"id":"${env:ID}"}`), lookup)
+	assert.EqualError(t, err, "environment variable ID is not set")
+}
@@ -2,6 +2,8 @@ package stub
 
 import (
 	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc/metadata"
 	"sort"
 	"strings"
@@ -12,38 +14,169 @@ type StubsMatcher interface {
 	Match(ctx context.Context, fullMethod, requestJson string) *Stub
 }
 
+// MatcherOption changes how the stubs are matched
+type MatcherOption func(matcher *stubsMatcher)
+
+// WithScenarios uses the scenarios store provided to keep the state of the scenarios
+func WithScenarios(scenarios ScenariosStore) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.Scenarios = scenarios
+	}
+}
+
+// WithStubSets uses the stub sets store provided to find the stub set active for each call
+func WithStubSets(sets StubSetsStore) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.StubSets = sets
+	}
+}
+
+// WithCallCounter uses the counter provided to count the calls matched to each stub
+func WithCallCounter(counter CallCounter) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.Calls = counter
+	}
+}
+
+// WithMethodCallCounter uses the counter provided to count the calls made to each method, keyed by full method,
+// whether they are matched or not
+func WithMethodCallCounter(counter CallCounter) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.MethodCalls = counter
+	}
+}
+
+// WithJournal records every call matched (or not) in the journal provided
+func WithJournal(journal Journal) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.Journal = journal
+	}
+}
+
+// WithMethodAliases routes the calls to the aliased methods to the stubs of their targets, when none of the stubs of the
+// method called matches
+func WithMethodAliases(aliases *MethodAliases) MatcherOption {
+	return func(matcher *stubsMatcher) {
+		matcher.Aliases = aliases
+	}
+}
+
 // Creates new stubs matcher
-func NewStubsMatcher(store StubsStore) StubsMatcher {
-	return &stubsMatcher{
+func NewStubsMatcher(store StubsStore, options ...MatcherOption) StubsMatcher {
+	matcher := &stubsMatcher{
 		StubsStore: store,
+		Scenarios:  NewInMemoryScenariosStore(),
+		StubSets:   NewInMemoryStubSetsStore(),
+		Calls:      NewInMemoryCallCounter(),
+	}
+	for _, option := range options {
+		option(matcher)
 	}
+	return matcher
 }
 
 type stubsMatcher struct {
 	StubsStore StubsStore
+	Scenarios  ScenariosStore
+	StubSets   StubSetsStore
+	Calls      CallCounter
+	// MethodCalls, Journal and Aliases are optional
+	MethodCalls CallCounter
+	Journal     Journal
+	Aliases     *MethodAliases
 }
 
-// Returns the Stub in the StubsStore that matches the method and requestJSON provided OR nil if no stub is found
+// Returns the Stub in the StubsStore that matches the method and requestJSON provided OR nil if no stub is found.
+// With a read-only state (see WithReadOnlyState) the call is a dry run: the scenarios are not moved, and the call is
+// neither counted nor recorded in the journal.
 func (m *stubsMatcher) Match(ctx context.Context, fullMethod, requestJson string) *Stub {
-	stubsForMethod := m.StubsStore.GetStubsMapForMethod(fullMethod)
-	if stubsForMethod == nil {
-		return nil
-	}
-	for _, stub := range stubsForMethod {
-		switch stub.Request.Match {
-		case "exact":
-			if stub.Request.Content.Equals(JsonString(requestJson)) && matchMetadata(ctx, stub) {
-				return stub
-			}
-		case "partial":
-			if stub.Request.Content.Matches(JsonString(requestJson)) && matchMetadata(ctx, stub) {
-				return stub
+	stub := m.match(ctx, fullMethod, requestJson)
+	if isStateReadOnly(ctx) {
+		return stub
+	}
+	if m.MethodCalls != nil {
+		m.MethodCalls.Increment(fullMethod)
+	}
+	if m.Journal != nil {
+		m.Journal.Record(newJournalEntry(ctx, fullMethod, requestJson, stub))
+	}
+	return stub
+}
+
+func (m *stubsMatcher) match(ctx context.Context, fullMethod, requestJson string) *Stub {
+	var request map[string]interface{}
+	var activeSet string
+	for _, method := range m.Aliases.methodsOf(fullMethod) {
+		stubsForMethod, err := m.StubsStore.GetStubsForMethod(ctx, method)
+		if err != nil {
+			log.Errorf("Failed to get the stubs of %s: %s", method, err.Error())
+			return nil
+		}
+		if len(stubsForMethod) == 0 {
+			continue
+		}
+		// The request is decoded only once and compared against the pre-decoded content of each stub
+		if request == nil {
+			request = make(map[string]interface{})
+			json.Unmarshal([]byte(requestJson), &request)
+			activeSet = m.activeSet(ctx)
+		}
+		if stub := m.matchStubs(ctx, fullMethod, request, activeSet, stubsForMethod); stub != nil {
+			return stub
+		}
+	}
+	return nil
+}
+
+// matchStubs returns the first of the stubs that matches the call to fullMethod with the stub set active given
+func (m *stubsMatcher) matchStubs(ctx context.Context, fullMethod string, request map[string]interface{}, activeSet string, stubs []*Stub) *Stub {
+	for _, stub := range stubs {
+		if (stub.Set == "" || stub.Set == activeSet) && stub.Request.matchesContent(request) && matchMetadata(ctx, stub) && stub.Request.Peer.matches(ctx) &&
+			stub.Request.Transport.matches(ctx) && stub.Request.Claims.matches(ctx) && stub.Request.Capture.matches(request) &&
+			stub.Request.matchesExpr(ctx, fullMethod, request) && m.matchScenario(ctx, stub) {
+			if !isStateReadOnly(ctx) {
+				m.Calls.Increment(stub.ID)
+				if recorder, ok := m.StubsStore.(StubHitRecorder); ok {
+					recorder.RecordHit(stub.ID)
+				}
 			}
+			return m.failThenSucceed(ctx, stub)
 		}
 	}
 	return nil
 }
 
+// activeSet returns the stub set of the call: the one active for its session or, when the calls of the session are
+// split between sets, the one chosen for the call
+func (m *stubsMatcher) activeSet(ctx context.Context) string {
+	session := callSession(ctx)
+	if split := m.StubSets.GetSplit(session); split != nil {
+		return split.choose(ctx)
+	}
+	return m.StubSets.GetActive(session)
+}
+
+// matchScenario checks if the scenario of the stub is in the required state and moves it to the new state. It must
+// be the last check as the state of the scenario is changed when it matches, unless the state is read-only.
+func (m *stubsMatcher) matchScenario(ctx context.Context, stub *Stub) bool {
+	scenario := stub.Scenario
+	switch {
+	case scenario == nil:
+		return true
+	case scenario.RequiredState == "" && scenario.NewState == "":
+		return true
+	case isStateReadOnly(ctx):
+		return scenario.RequiredState == "" || m.Scenarios.GetState(scenario.Name) == scenario.RequiredState
+	case scenario.RequiredState == "":
+		m.Scenarios.SetState(scenario.Name, scenario.NewState)
+		return true
+	case scenario.NewState == "":
+		return m.Scenarios.GetState(scenario.Name) == scenario.RequiredState
+	default:
+		return m.Scenarios.Transition(scenario.Name, scenario.RequiredState, scenario.NewState)
+	}
+}
+
 func matchMetadata(ctx context.Context, stub *Stub) bool {
 	if len(stub.Request.Metadata) == 0 {
 		return true
@@ -66,6 +199,21 @@ func matchMetadata(ctx context.Context, stub *Stub) bool {
 	return true
 }
 
+// incomingMetadata returns the metadata of the call as a JSON like value, each key with a list of values, for the
+// expressions and scripts
+func incomingMetadata(ctx context.Context) map[string]interface{} {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := make(map[string]interface{}, len(md))
+	for key, mdValues := range md {
+		list := make([]interface{}, 0, len(mdValues))
+		for _, value := range mdValues {
+			list = append(list, value)
+		}
+		values[key] = list
+	}
+	return values
+}
+
 func getStubMetadata(stub *Stub) (stubMetadata map[string][]string) {
 	stubMetadata = make(map[string][]string, 0)
 	for key, values := range stub.Request.Metadata {
@@ -0,0 +1,258 @@
+package stub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"testing"
+)
+
+func TestStubsMatcher_Match(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	exact := newTestStub("method1", "{\"name\":\"John\",\"age\":30}")
+	partial := newTestStub("method1", "{\"name\":\"Mary\"}")
+	partial.Request.Match = "partial"
+	store.Add(context.Background(), exact)
+	store.Add(context.Background(), partial)
+	matcher := NewStubsMatcher(store)
+
+	assert.Equal(t, exact, matcher.Match(context.Background(), "method1", "{\"name\":\"John\",\"age\":30}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, partial, matcher.Match(context.Background(), "method1", "{\"name\":\"Mary\",\"age\":30}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method2", "{\"name\":\"Mary\"}"))
+}
+
+func TestStubsMatcher_Match_Metadata(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.Request.Metadata = map[string][]string{"tenant": {"acme"}}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "acme"))
+	assert.Equal(t, s, matcher.Match(ctx, "method1", "{\"name\":\"John\"}"))
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("tenant", "other"))
+	assert.Nil(t, matcher.Match(ctx, "method1", "{\"name\":\"John\"}"))
+}
+
+func TestStubsMatcher_Match_Captures(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{}")
+	s.Request.Match = "partial"
+	s.Request.Capture = Captures{"region": {Path: "id", Regex: "^(EU|US)-"}}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+
+	assert.Equal(t, s, matcher.Match(context.Background(), "method1", "{\"id\":\"EU-1\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"id\":\"APAC-1\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{}"))
+}
+
+func TestStubsMatcher_Match_Scenario(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	first := newTestStub("method1", "{\"name\":\"John\"}")
+	first.Scenario = &StubScenario{Name: "retry", RequiredState: ScenarioStateStarted, NewState: "failed once"}
+	second := newTestStub("method1", "{\"name\":\"John\"}")
+	second.Scenario = &StubScenario{Name: "retry", RequiredState: "failed once"}
+	assert.NoError(t, store.Add(context.Background(), first))
+	assert.NoError(t, store.Add(context.Background(), second))
+	scenarios := NewInMemoryScenariosStore()
+	matcher := NewStubsMatcher(store, WithScenarios(scenarios))
+
+	assert.Equal(t, first, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, "failed once", scenarios.GetState("retry"))
+	assert.Equal(t, second, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, second, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+
+	scenarios.SetState("retry", "other")
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+}
+
+func TestStubsMatcher_Match_ReadOnlyState(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	first := newTestStub("method1", "{\"name\":\"John\"}")
+	first.Scenario = &StubScenario{Name: "retry", RequiredState: ScenarioStateStarted, NewState: "failed once"}
+	second := newTestStub("method1", "{\"name\":\"Mary\"}")
+	second.Response.FailThenSucceed = &FailThenSucceed{Failures: 1}
+	assert.NoError(t, store.Add(context.Background(), first))
+	assert.NoError(t, store.Add(context.Background(), second))
+	scenarios := NewInMemoryScenariosStore()
+	calls := NewInMemoryCallCounter()
+	journal := NewInMemoryJournal(10)
+	matcher := NewStubsMatcher(store, WithScenarios(scenarios), WithCallCounter(calls), WithJournal(journal))
+
+	ctx := WithReadOnlyState(context.Background())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, first, matcher.Match(ctx, "method1", "{\"name\":\"John\"}"))
+		assert.Equal(t, "error", matcher.Match(ctx, "method1", "{\"name\":\"Mary\"}").Response.Type)
+	}
+	assert.Equal(t, ScenarioStateStarted, scenarios.GetState("retry"))
+	assert.Equal(t, 0, calls.Get(first.ID))
+	assert.Empty(t, journal.GetAll())
+
+	assert.Equal(t, "error", matcher.Match(context.Background(), "method1", "{\"name\":\"Mary\"}").Response.Type)
+	assert.Equal(t, second, matcher.Match(ctx, "method1", "{\"name\":\"Mary\"}"))
+}
+
+func benchmarkMatch(b *testing.B, match string, stubsCount int) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < stubsCount; i++ {
+		s := newTestStub("method1", fmt.Sprintf("{\"id\":%d,\"name\":\"John\",\"tags\":[\"a\",\"b\"]}", i))
+		s.Request.Match = match
+		store.Add(context.Background(), s)
+	}
+	matcher := NewStubsMatcher(store)
+	request := fmt.Sprintf("{\"id\":%d,\"name\":\"John\",\"tags\":[\"a\",\"b\"]}", stubsCount-1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if matcher.Match(context.Background(), "method1", request) == nil {
+			b.Fatal("stub not found")
+		}
+	}
+}
+
+func BenchmarkStubsMatcher_Match_Exact10(b *testing.B)     { benchmarkMatch(b, "exact", 10) }
+func BenchmarkStubsMatcher_Match_Exact1000(b *testing.B)   { benchmarkMatch(b, "exact", 1000) }
+func BenchmarkStubsMatcher_Match_Partial10(b *testing.B)   { benchmarkMatch(b, "partial", 10) }
+func BenchmarkStubsMatcher_Match_Partial1000(b *testing.B) { benchmarkMatch(b, "partial", 1000) }
+
+func TestStubsMatcher_Match_Claims(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.Request.Claims = ClaimsMatcher{"sub": "user-1", "admin": "true"}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+	newContext := func(claims string) context.Context {
+		token := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + "."
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	assert.Equal(t, s, matcher.Match(newContext(`{"sub":"user-1","admin":true}`), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext(`{"sub":"user-2","admin":true}`), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext(`{"sub":"user-1"}`), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+}
+
+func TestStubsMatcher_Match_ClaimsPathsAndLists(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{}")
+	s.Request.Claims = ClaimsMatcher{"realm_access.roles": "admin", "scope": "orders.read orders.write", "tenant_id": "1"}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+	newContext := func(claims string) context.Context {
+		token := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + "."
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	assert.Equal(t, s, matcher.Match(newContext(`{"realm_access":{"roles":["user","admin"]},"scope":"orders.write profile orders.read","tenant_id":1}`), "method1", "{}"))
+	assert.Nil(t, matcher.Match(newContext(`{"realm_access":{"roles":["user"]},"scope":"orders.write orders.read","tenant_id":1}`), "method1", "{}"))
+	assert.Nil(t, matcher.Match(newContext(`{"realm_access":{"roles":["admin"]},"scope":"orders.read","tenant_id":1}`), "method1", "{}"))
+}
+
+func TestStubsMatcher_Match_ClaimsVerified(t *testing.T) {
+	SetClaimsVerificationKeys(util.NewSecretJWKS([]byte("secret")))
+	defer SetClaimsVerificationKeys(nil)
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{}")
+	s.Request.Claims = ClaimsMatcher{"sub": "user-1"}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+	newContext := func(secret string) context.Context {
+		signingInput := "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signingInput))
+		token := signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	assert.Equal(t, s, matcher.Match(newContext("secret"), "method1", "{}"))
+	assert.Nil(t, matcher.Match(newContext("other"), "method1", "{}"))
+}
+
+func TestStubsMatcher_Match_Peer(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.Request.Peer = &PeerMatcher{Addresses: []string{"10.0.0.0/8", "192.168.1.1"}, UserAgent: "grpc-java"}
+	store.Add(context.Background(), s)
+	matcher := NewStubsMatcher(store)
+	newContext := func(ip, userAgent string) context.Context {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", userAgent))
+		return peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000}})
+	}
+
+	assert.Equal(t, s, matcher.Match(newContext("10.1.2.3", "orders grpc-java/1.30"), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, s, matcher.Match(newContext("192.168.1.1", "grpc-java/1.30"), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext("192.168.1.2", "grpc-java/1.30"), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext("10.1.2.3", "grpc-go/1.29"), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+}
+
+// compressedStream is the transport stream of a call whose messages are compressed
+type compressedStream struct {
+	grpc.ServerTransportStream
+	compression string
+}
+
+func (s compressedStream) RecvCompress() string {
+	return s.compression
+}
+
+func TestStubsMatcher_Match_Transport(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.Request.Transport = &TransportMatcher{Authority: "orders.internal", ContentType: "application/grpc", Compression: "gzip"}
+	store.Add(context.Background(), s)
+	expr := newTestStub("method1", "{}")
+	expr.Request.Match = "partial"
+	expr.Request.MatchExpr = "transport.authority.startsWith('edge') && transport.compression == 'identity'"
+	store.Add(context.Background(), expr)
+	matcher := NewStubsMatcher(store)
+	newContext := func(authority, compression string) context.Context {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(":authority", authority, "content-type", "application/grpc"))
+		return grpc.NewContextWithServerTransportStream(ctx, compressedStream{compression: compression})
+	}
+
+	assert.Equal(t, s, matcher.Match(newContext("orders.internal:8443", "gzip"), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, s, matcher.Match(newContext("ORDERS.internal", "gzip"), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext("orders.internal:8443", ""), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext("orders.public:443", "gzip"), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, expr, matcher.Match(newContext("edge.acme.com", ""), "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, matcher.Match(newContext("edge.acme.com", "gzip"), "method1", "{\"name\":\"John\"}"))
+
+	assert.False(t, (&TransportMatcher{Authority: "orders.internal:443"}).matches(newContext("orders.internal:8443", "")))
+}
+
+func TestStubsMatcher_Match_VirtualHosts(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	eu := newTestStub("method1", "{}")
+	eu.Request.Match = "partial"
+	eu.Request.Transport = &TransportMatcher{Authority: "*.eu.acme.com"}
+	us := newTestStub("method1", "{}")
+	us.Request.Match = "partial"
+	us.Request.Transport = &TransportMatcher{Authority: "orders.us.acme.com:443"}
+	// The stubs of any host are only tried after the ones of the host called
+	anyHost := newTestStub("method1", "{}")
+	anyHost.Request.Match = "partial"
+	store.Add(context.Background(), anyHost)
+	store.Add(context.Background(), eu)
+	store.Add(context.Background(), us)
+	matcher := NewStubsMatcher(store)
+	newContext := func(pairs ...string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+	}
+
+	assert.Equal(t, eu, matcher.Match(newContext(":authority", "orders.eu.acme.com:443"), "method1", "{}"))
+	assert.Equal(t, us, matcher.Match(newContext(":authority", "orders.us.acme.com:443"), "method1", "{}"))
+	assert.Equal(t, anyHost, matcher.Match(newContext(":authority", "eu.acme.com"), "method1", "{}"))
+	assert.Equal(t, anyHost, matcher.Match(newContext(":authority", "orders.us.acme.com:8443"), "method1", "{}"))
+	assert.Equal(t, us, matcher.Match(newContext(":authority", "localhost:10010", AuthorityOverrideHeader, "orders.us.acme.com:443"), "method1", "{}"))
+}
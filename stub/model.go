@@ -2,11 +2,14 @@ package stub
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"reflect"
+	"strings"
+	"time"
 )
 
 type JsonString string
@@ -21,32 +24,114 @@ func isEnum(t reflect.Type) bool {
 }
 
 type Stub struct {
-	FullMethod string        `json:"fullMethod"`
-	Request    *StubRequest  `json:"request"`
-	Response   *StubResponse `json:"response"`
+	// ID is assigned by the server when the stub is added, unless the client sets it
+	ID          string        `json:"id,omitempty"`
+	FullMethod  string        `json:"fullMethod"`
+	Description string        `json:"description,omitempty"`
+	Request     *StubRequest  `json:"request"`
+	Response    *StubResponse `json:"response"`
+	// ContentFormat is the encoding of the request and response contents, the stream messages and the requests of the
+	// tests: json (the default) or prototext, where they are strings in protobuf text format converted to JSON when the
+	// stub is added (see ConvertTextContent)
+	ContentFormat string `json:"contentFormat,omitempty"`
+	// Name identifies the stub so that other stubs can extend it
+	Name string `json:"name,omitempty"`
+	// Extends is the ID or name of the stub this stub is based on. The stub only needs the fields that differ from
+	// its base and is resolved (see ResolveExtends) when it is added.
+	Extends string `json:"extends,omitempty"`
+	// Labels organize the stubs (e.g. by team or test suite) so that they can be queried. They don't change how the
+	// stub matches or responds.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Scenario makes the stub match only in a given state of a stateful scenario
+	Scenario *StubScenario `json:"scenario,omitempty"`
+	// Set is the stub set of the stub, e.g. blue or green. The stub only matches the calls of the sessions the set is
+	// active for (see StubSetsStore).
+	Set string `json:"set,omitempty"`
+	// ExpectedCalls is the number of times the stub is expected to be called, checked by the expectations report
+	ExpectedCalls *ExpectedCalls `json:"expectedCalls,omitempty"`
+	// Seed makes the random values of the responses of the stub reproducible (see Random)
+	Seed int64 `json:"seed,omitempty"`
+	// Tests are sample calls the stub must match or not, checked when it is added (see StubTest)
+	Tests []StubTest `json:"tests,omitempty"`
+	// Fallback stubs only match the calls that no other stub of the method matches, e.g. the default stubs made of the
+	// examples in the proto files
+	Fallback bool `json:"fallback,omitempty"`
+	// Authorship metadata. These fields are maintained by the server and any value provided by the client is ignored.
+	CreatedBy string     `json:"createdBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// Fixture is the name of the fixture that added the stub, if any
+	Fixture string `json:"fixture,omitempty"`
+	// Version is incremented every time the stub is updated and is used for optimistic concurrency control.
+	Version int64 `json:"version,omitempty"`
 }
 
 type StubRequest struct {
 	Match    string              `json:"match"`
 	Content  JsonString          `json:"content"`
 	Metadata map[string][]string `json:"metadata"`
+	// Peer matches the client making the call
+	Peer *PeerMatcher `json:"peer,omitempty"`
+	// Transport matches the attributes of the HTTP/2 request, e.g. its :authority
+	Transport *TransportMatcher `json:"transport,omitempty"`
+	// Claims matches the claims of the JWT sent as bearer token
+	Claims ClaimsMatcher `json:"claims,omitempty"`
+	// MatchExpr is a CEL expression (see cel.go) that must be true for the request to match, e.g.
+	// request.amount > 100 && request.currency == 'EUR'. Match and Content can be omitted when it is set.
+	MatchExpr string `json:"matchExpr,omitempty"`
+	// Capture extracts values of the request into named variables for the response. The request only matches when
+	// all of them are captured.
+	Capture Captures `json:"capture,omitempty"`
+
+	// The content decoded from JSON and the compiled expression, set by the store when the stub is added or updated
+	// (see Stub.prepare) so that they are not decoded again for every request matched
+	content map[string]interface{}
+	expr    *celExpr
 }
 
 func (s StubRequest) String() string {
-	data, _ := json.Marshal(s)
+	// Marshalled through a pointer so that the contents are written as JSON (see JsonString.MarshalJSON)
+	data, _ := json.Marshal(&s)
 	return string(data)
 }
 
 type StubResponse struct {
-	Type    string         `json:"type"`
-	Content JsonString     `json:"content"`
-	Error   *ErrorResponse `json:"error"`
+	Type    string     `json:"type"`
+	Content JsonString `json:"content"`
+	// Stream are the messages sent by server streaming methods, in order. When the response type is error, the
+	// messages are sent before the stream is terminated with the error.
+	Stream []JsonString `json:"stream,omitempty"`
+	// Pacing controls when the messages of server streaming methods are sent. They are sent at once by default.
+	Pacing *StreamPacing `json:"pacing,omitempty"`
+	// StreamFaults duplicates, drops or reorders messages of server streaming methods
+	StreamFaults *StreamFaults `json:"streamFaults,omitempty"`
+	// FrameFault sends a message that the clients can't decode instead of the response
+	FrameFault *FrameFault `json:"frameFault,omitempty"`
+	// Pages serves a list of items across the pages of the calls to a List method, in the content of the response
+	Pages *PagedResponse `json:"pages,omitempty"`
+	// Operation starts a long-running operation, returned as the response
+	Operation *OperationResponse `json:"operation,omitempty"`
+	// FailThenSucceed makes the first calls fail with a retryable error before the response is returned
+	FailThenSucceed *FailThenSucceed `json:"failThenSucceed,omitempty"`
+	Error           *ErrorResponse   `json:"error"`
+	// Script is the Lua script that produces the response when the response type is script (see RunScript)
+	Script string `json:"script,omitempty"`
+	// TrailersOnly sends the error without headers, with the status in a single trailers frame, as some servers do
+	// for the calls that fail fast. The errors are sent after the headers otherwise.
+	TrailersOnly bool `json:"trailersOnly,omitempty"`
+	// Headers and Trailers are the metadata sent in the header and the trailer of the response. The values can have
+	// placeholders, e.g. ${metadata.x-correlation-id} to echo the metadata of the call.
+	Headers  map[string]string `json:"headers,omitempty"`
+	Trailers map[string]string `json:"trailers,omitempty"`
 }
 
 type ErrorResponse struct {
-	Code    int32         `json:"code"`
+	// Code is the gRPC status code, given as number or name (e.g. 5 or NOT_FOUND)
+	Code    StatusCode    `json:"code"`
 	Message string        `json:"message"`
 	Details *ErrorDetails `json:"details"`
+	// RetryDelay adds a google.rpc.RetryInfo detail telling the clients to retry after the delay, e.g. 1s
+	RetryDelay string `json:"retryDelay,omitempty"`
 }
 
 type ErrorDetails struct {
@@ -64,21 +149,66 @@ type ErrorDetailsSpec struct {
 	Type   string `json:"type"`
 }
 
+// key identifies the stub among the stubs of the same method. Stubs with the same request are different if they are
+// used in different states of a scenario. The requests are compared regardless of the order of the keys of their JSON.
+func (s *Stub) key() string {
+	key := s.Request.String()
+	if sorted, err := sortedJSON([]byte(key)); err == nil {
+		key = sorted
+	}
+	if s.Scenario != nil {
+		key += "|" + s.Scenario.Name + "|" + s.Scenario.RequiredState
+	}
+	if s.Set != "" {
+		key += "|set:" + s.Set
+	}
+	return key
+}
+
+// Clone creates a deep copy of the stub
+func (s *Stub) Clone() *Stub {
+	data, _ := json.Marshal(s)
+	clone := new(Stub)
+	json.Unmarshal(data, clone)
+	return clone
+}
+
 func (j JsonString) String() string {
 	return string(j)
 }
 
 func (j *JsonString) UnmarshalJSON(data []byte) error {
-	buffer := new(bytes.Buffer)
+	// Payloads sent by programs are usually already compact, in which case they are used as they are
+	if isCompactJSON(data) {
+		*j = JsonString(data)
+		return nil
+	}
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)))
 	err := json.Compact(buffer, data)
 	if err != nil {
-		log.Errorf("error compacting json: %s", string(data))
+		log.Errorf("error compacting json: %s", util.LoggablePayload(string(data)))
 	}
 	result := JsonString(buffer.String())
 	*j = result
 	return nil
 }
 
+// isCompactJSON checks if there is any insignificant white space in the (valid) JSON data
+func isCompactJSON(data []byte) bool {
+	inString := false
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			return false
+		}
+	}
+	return true
+}
+
 func (j *JsonString) MarshalJSON() ([]byte, error) {
 	val := string(*j)
 	if val == "" {
@@ -88,78 +218,164 @@ func (j *JsonString) MarshalJSON() ([]byte, error) {
 }
 
 func (j *JsonString) Matches(other JsonString) bool {
-	jsonMap := new(map[string]interface{})
-	otherJsonMap := new(map[string]interface{})
-	json.Unmarshal([]byte(*j), jsonMap)
-	json.Unmarshal([]byte(other), otherJsonMap)
-	return jsonStringMatches(*jsonMap, *otherJsonMap, false)
+	return jsonStringMatches(j.toMap(), other.toMap(), false)
 }
 
 func (j *JsonString) Equals(other JsonString) bool {
-	jsonMap := new(map[string]interface{})
-	otherJsonMap := new(map[string]interface{})
-	json.Unmarshal([]byte(*j), jsonMap)
-	json.Unmarshal([]byte(other), otherJsonMap)
-	return jsonStringMatches(*jsonMap, *otherJsonMap, true)
+	return jsonStringMatches(j.toMap(), other.toMap(), true)
 }
 
-func jsonStringMatches(jsonMap, otherJsonMap map[string]interface{}, mustBeEqual bool) bool {
-	if mustBeEqual && len(jsonMap) != len(otherJsonMap) {
+func (j JsonString) toMap() map[string]interface{} {
+	jsonMap := make(map[string]interface{})
+	json.Unmarshal([]byte(j), &jsonMap)
+	return jsonMap
+}
+
+// prepare decodes the request content and compiles the expression of the stub, once it is complete, so that the
+// requests are matched without decoding them again. The stores call it before storing the stub.
+func (s *Stub) prepare() {
+	if s.Request == nil {
+		return
+	}
+	s.Request.content = s.Request.Content.toMap()
+	s.Request.expr = nil
+	if s.Request.MatchExpr != "" {
+		s.Request.expr, _ = compileMatchExpr(s.Request.MatchExpr, s.FullMethod)
+	}
+}
+
+// isPrepared checks if prepare was called, e.g. because the stub is already stored
+func (s *Stub) isPrepared() bool {
+	return s.Request == nil || s.Request.content != nil
+}
+
+// parsedContent returns the request content decoded from JSON, decoding it when the stub was not prepared
+func (s *StubRequest) parsedContent() map[string]interface{} {
+	if s.content != nil {
+		return s.content
+	}
+	return s.Content.toMap()
+}
+
+// matchesContent checks the request (already decoded from JSON) against the content of the stub
+func (s *StubRequest) matchesContent(request map[string]interface{}) bool {
+	switch s.Match {
+	case "exact":
+		return jsonStringMatches(s.parsedContent(), request, true)
+	case "partial":
+		return jsonStringMatches(s.parsedContent(), request, false)
+	case "":
+		// Matched only by the expression
+		return s.MatchExpr != ""
+	}
+	return false
+}
+
+// matchesExpr evaluates the matching expression, if any, on the request of the call (see cel.go). The request doesn't
+// match when the evaluation fails.
+func (s *StubRequest) matchesExpr(ctx context.Context, fullMethod string, request map[string]interface{}) bool {
+	if s.MatchExpr == "" {
+		return true
+	}
+	expr := s.expr
+	if expr == nil {
+		expr, _ = compileMatchExpr(s.MatchExpr, fullMethod)
+	}
+	if expr == nil {
 		return false
 	}
+	matches, err := expr.matches(ctx, fullMethod, request)
+	if err != nil {
+		log.WithFields(log.Fields{"Error": err.Error()}).Debugf("Error evaluating the expression %s", s.MatchExpr)
+	}
+	return matches
+}
+
+// UnsetMarker is the value of the fields that must not be set in the request. As fields with presence (e.g. proto3
+// optional) are only in the JSON of the request when they are set, it distinguishes them being unset from being set to
+// their zero value.
+const UnsetMarker = "${unset}"
+
+// WithoutUnsetFields returns the content without the fields required to be unset, e.g. to send it as a request
+func (j JsonString) WithoutUnsetFields() JsonString {
+	if !strings.Contains(string(j), UnsetMarker) {
+		return j
+	}
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(j)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return j
+	}
+	data, _ := json.Marshal(removeUnsetFields(value))
+	return JsonString(data)
+}
+
+func removeUnsetFields(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == UnsetMarker {
+				delete(v, key)
+				continue
+			}
+			v[key] = removeUnsetFields(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = removeUnsetFields(item)
+		}
+	}
+	return value
+}
+
+func jsonStringMatches(jsonMap, otherJsonMap map[string]interface{}, mustBeEqual bool) bool {
+	unset := 0
 	for key, value := range jsonMap {
 		otherValue, found := otherJsonMap[key]
-		if !found {
-			return false
+		if value == UnsetMarker {
+			if found {
+				return false
+			}
+			unset++
+			continue
 		}
-		valueType := fmt.Sprintf("%T", value)
-		otherValueType := fmt.Sprintf("%T", otherValue)
-		if valueType != otherValueType {
+		if !found || !jsonValueMatches(value, otherValue, mustBeEqual) {
 			return false
 		}
-		switch valueType {
-		case "map[string]interface {}": // object
-			if !jsonStringMatches(jsonMap[key].(map[string]interface{}), otherJsonMap[key].(map[string]interface{}), mustBeEqual) {
-				return false
-			}
-		case "[]interface {}": // repeated object
-			// naive implementation of comparison of repeated messages.
-			// TODO investigate a more performant way to compare
-			items := jsonMap[key].([]interface{})
-			otherItems := otherJsonMap[key].([]interface{})
-			if len(items) != len(otherItems) {
-				return false
-			}
-			for _, item := range items {
-				var found = false
-				for _, otherItem := range otherItems {
-					itemType := fmt.Sprintf("%T", item)
-					otherItemType := fmt.Sprintf("%T", otherItem)
-					if itemType != otherItemType {
-						// Not sure if they can be different
-						continue
-					}
-					switch itemType {
-					case "map[string]interface {}":
-						if jsonStringMatches(item.(map[string]interface{}), otherItem.(map[string]interface{}), mustBeEqual) {
-							found = true
-							break
-						}
-					default:
-						if item == otherItem {
-							found = true
-							break
-						}
-					}
-
-				}
-				if !found {
-					return false
-				}
+	}
+	return !mustBeEqual || len(jsonMap)-unset == len(otherJsonMap)
+}
+
+func jsonValueMatches(value, otherValue interface{}, mustBeEqual bool) bool {
+	switch typedValue := value.(type) {
+	case map[string]interface{}: // object
+		otherMap, ok := otherValue.(map[string]interface{})
+		return ok && jsonStringMatches(typedValue, otherMap, mustBeEqual)
+	case []interface{}: // repeated field
+		otherItems, ok := otherValue.([]interface{})
+		return ok && jsonArrayMatches(typedValue, otherItems, mustBeEqual)
+	default:
+		return value == otherValue
+	}
+}
+
+// jsonArrayMatches checks that both arrays have the same size and that every item has a matching item in the
+// other array, regardless of the order.
+// TODO investigate a more performant way to compare repeated messages
+func jsonArrayMatches(items, otherItems []interface{}, mustBeEqual bool) bool {
+	if len(items) != len(otherItems) {
+		return false
+	}
+	for _, item := range items {
+		found := false
+		for _, otherItem := range otherItems {
+			if jsonValueMatches(item, otherItem, mustBeEqual) {
+				found = true
+				break
 			}
-			continue
 		}
-		if value != otherValue {
+		if !found {
 			return false
 		}
 	}
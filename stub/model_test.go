@@ -1,7 +1,12 @@
 package stub
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"reflect"
 	"testing"
 )
 
@@ -40,3 +45,139 @@ func TestJsonString_Equals_RightJsonStringContainsAllFieldsOfLeftJsonString(t *t
 	str2 := JsonString("{\"field1\":{\"subfieldd1\":\"value1\", \"subfield2\": 2}}")
 	assert.False(t, str1.Equals(str2))
 }
+
+func TestJsonString_Matches_RepeatedObjectsWithNestedObjects(t *testing.T) {
+	str1 := JsonString("{\"items\":[{\"name\":\"a\",\"owner\":{\"id\":1}}]}")
+	str2 := JsonString("{\"items\":[{\"name\":\"a\",\"owner\":{\"id\":1,\"team\":\"x\"}}]}")
+	str3 := JsonString("{\"items\":[{\"name\":\"a\",\"owner\":{\"id\":2}}]}")
+	assert.True(t, str1.Matches(str2))
+	assert.False(t, str1.Matches(str3))
+}
+
+func TestJsonString_Matches_NestedObjectsAndArrays(t *testing.T) {
+	str1 := JsonString("{\"order\":{\"id\":\"1\"},\"items\":[{\"sku\":\"a\"},[1,2]]}")
+	str2 := JsonString("{\"order\":{\"id\":\"1\",\"total\":10},\"items\":[[1,2],{\"sku\":\"a\"}]}")
+	assert.True(t, str1.Matches(str2))
+	assert.False(t, str1.Equals(str2))
+}
+
+func TestJsonString_Matches_UnsetFields(t *testing.T) {
+	str1 := JsonString("{\"name\":\"John\",\"age\":\"${unset}\"}")
+	assert.True(t, str1.Matches(JsonString("{\"name\":\"John\"}")))
+	assert.True(t, str1.Equals(JsonString("{\"name\":\"John\"}")))
+	assert.False(t, str1.Matches(JsonString("{\"name\":\"John\",\"age\":0}")))
+	assert.False(t, str1.Equals(JsonString("{\"name\":\"John\",\"nickname\":\"J\"}")))
+
+	str2 := JsonString("{\"name\":\"John\",\"age\":0}")
+	assert.True(t, str2.Matches(JsonString("{\"name\":\"John\",\"age\":0}")))
+	assert.False(t, str2.Matches(JsonString("{\"name\":\"John\"}")))
+}
+
+type optionalFields struct {
+	Name string  `json:"name,omitempty"`
+	Age  *int32  `json:"age,omitempty"`
+	Nick *string `json:"nick,omitempty"`
+}
+
+func TestJsonString_isJsonValid_OptionalFields(t *testing.T) {
+	optionalType := reflect.TypeOf(optionalFields{})
+	isValid, _ := JsonString("{\"name\":\"John\",\"age\":0,\"nick\":\"${unset}\"}").isJsonValid(optionalType, "request.content")
+	assert.True(t, isValid)
+	isValid, errMsgs := JsonString("{\"nick\":1}").isJsonValid(optionalType, "request.content")
+	assert.False(t, isValid)
+	assert.Equal(t, []string{"Field 'request.content.nick' is expected to be a string."}, errMsgs)
+}
+
+func TestJsonString_UnmarshalJSON(t *testing.T) {
+	var compact, indented JsonString
+	assert.Nil(t, json.Unmarshal([]byte("{\"name\":\"John Smith\"}"), &compact))
+	assert.Nil(t, json.Unmarshal([]byte("{\n  \"name\": \"John Smith\",\n  \"quote\": \"a \\\" b\"\n}"), &indented))
+	assert.Equal(t, JsonString("{\"name\":\"John Smith\"}"), compact)
+	assert.Equal(t, JsonString("{\"name\":\"John Smith\",\"quote\":\"a \\\" b\"}"), indented)
+}
+
+func largeJSONPayload() []byte {
+	buffer := bytes.NewBufferString("{\"items\":[")
+	for i := 0; buffer.Len() < 1024*1024; i++ {
+		if i > 0 {
+			buffer.WriteString(",")
+		}
+		buffer.WriteString(fmt.Sprintf("{\"id\":%d,\"name\":\"item %d\"}", i, i))
+	}
+	buffer.WriteString("]}")
+	return buffer.Bytes()
+}
+
+func BenchmarkJsonString_UnmarshalJSON_1MB(b *testing.B) {
+	data := largeJSONPayload()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var content JsonString
+		content.UnmarshalJSON(data)
+	}
+}
+
+func BenchmarkStubsMatcher_Match_1MB(b *testing.B) {
+	data := largeJSONPayload()
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 10; i++ {
+		s := newTestStub("method1", fmt.Sprintf("{\"items\":[{\"id\":%d}]}", i))
+		s.Request.Match = "partial"
+		store.Add(context.Background(), s)
+	}
+	matcher := NewStubsMatcher(store)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		matcher.Match(context.Background(), "method1", string(data))
+	}
+}
+
+func TestErrorResponse_StatusCodeNames(t *testing.T) {
+	errorResponse := ErrorResponse{}
+	assert.NoError(t, json.Unmarshal([]byte("{\"code\":\"NOT_FOUND\",\"message\":\"not found\"}"), &errorResponse))
+	assert.Equal(t, StatusCode(5), errorResponse.Code)
+	assert.NoError(t, json.Unmarshal([]byte("{\"code\":14}"), &errorResponse))
+	assert.Equal(t, StatusCode(14), errorResponse.Code)
+	assert.Error(t, json.Unmarshal([]byte("{\"code\":\"NOT_FUND\"}"), &errorResponse))
+
+	data, err := json.Marshal(ErrorResponse{Code: 14, Message: "unavailable"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, "{\"code\":\"UNAVAILABLE\",\"message\":\"unavailable\",\"details\":null}", string(data))
+}
+
+func TestStub_IsValid_UnknownStatusCode(t *testing.T) {
+	s := &Stub{
+		FullMethod: "/test.Service/Method",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: "error", Error: &ErrorResponse{Code: 99, Message: "unknown"}},
+	}
+	isValid, errMsgs := s.IsValid()
+	assert.False(t, isValid)
+	assert.Contains(t, errMsgs, "Response error code 99 is not a gRPC status code.")
+}
+
+func TestStubRequest_String(t *testing.T) {
+	request := StubRequest{Match: "exact", Content: "{\"name\":\"John\"}"}
+	assert.Equal(t, "{\"match\":\"exact\",\"content\":{\"name\":\"John\"},\"metadata\":null}", fmt.Sprintf("%v", request))
+	assert.Equal(t, request.String(), fmt.Sprintf("%s", &request))
+}
+
+func TestStub_Prepare(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	assert.False(t, s.isPrepared())
+	assert.Nil(t, store.Add(context.Background(), s))
+	assert.Equal(t, map[string]interface{}{"name": "John"}, s.Request.content)
+
+	updated := newTestStub("method1", "{\"name\":\"John\"}")
+	updated.Response.Content = "{\"greeting\":\"Hello\"}"
+	assert.Nil(t, store.Update(context.Background(), updated))
+	assert.True(t, updated.isPrepared())
+
+	withExpr := newTestStub("method2", "{}")
+	withExpr.Request.MatchExpr = "request.name == 'John'"
+	assert.Nil(t, store.Add(context.Background(), withExpr))
+	assert.NotNil(t, withExpr.Request.expr)
+}
@@ -0,0 +1,70 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// NormalizeContent rewrites the contents of the stub in canonical form, so that the stubs that only differ in how
+// their JSON is written are stored and compared as the same stub. The request contents (of the request and the tests)
+// are decoded into the messages returned by newRequest and the response contents (of the response and the stream
+// messages) into the ones returned by newResponse, and encoded back in the JSON mapping of protobuf: the fields are
+// named by their JSON names, the fields with default values are dropped and the values have their canonical encoding,
+// e.g. the enums by name. The keys of the objects are then sorted. The contents that can't be decoded into the
+// messages, e.g. with placeholders in fields that are not strings, only have their keys sorted.
+func NormalizeContent(s *Stub, newRequest, newResponse func() proto.Message) {
+	if s.Request != nil {
+		s.Request.Content = canonicalContent(s.Request.Content, newRequest)
+	}
+	for i := range s.Tests {
+		s.Tests[i].Request = canonicalContent(s.Tests[i].Request, newRequest)
+	}
+	if s.Response == nil {
+		return
+	}
+	s.Response.Content = canonicalContent(s.Response.Content, newResponse)
+	for i, message := range s.Response.Stream {
+		s.Response.Stream[i] = canonicalContent(message, newResponse)
+	}
+}
+
+// canonicalContent returns the content in canonical form (see NormalizeContent), or as it is when it is not JSON
+func canonicalContent(content JsonString, newMessage func() proto.Message) JsonString {
+	if content == "" {
+		return content
+	}
+	data := []byte(content)
+	if message := newMessage(); message != nil && protojson.Unmarshal(data, message) == nil {
+		if encoded, err := protojson.Marshal(message); err == nil {
+			data = encoded
+		}
+	}
+	sorted, err := sortedJSON(data)
+	if err != nil {
+		return content
+	}
+	return JsonString(sorted)
+}
+
+// sortedJSON returns the compact JSON with the keys of the objects sorted. The numbers are kept as they are written.
+func sortedJSON(data []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	if decoder.More() {
+		return "", fmt.Errorf("unexpected data after the JSON value")
+	}
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))), nil
+}
@@ -0,0 +1,48 @@
+package stub
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	method := findMethod(newLintFiles(t), "/test.Orders/Get")
+	newRequest := func() proto.Message { return dynamicpb.NewMessage(method.Input()) }
+	newResponse := func() proto.Message { return dynamicpb.NewMessage(method.Output()) }
+	s := &Stub{
+		FullMethod: "/test.Orders/Get",
+		Request:    &StubRequest{Match: "exact", Content: `{"name": "a<b", "id": "2"}`},
+		Response: &StubResponse{Type: "success", Content: `{"status":"OPEN","id":1}`,
+			Stream: []JsonString{`{"id":"${request.id}","status":0}`}},
+		Tests: []StubTest{{Request: `{"id":0}`}},
+	}
+
+	NormalizeContent(s, newRequest, newResponse)
+
+	assert.Equal(t, `{"id":2,"name":"a<b"}`, string(s.Request.Content))
+	// The fields with default values are dropped
+	assert.Equal(t, `{"id":1}`, string(s.Response.Content))
+	assert.Equal(t, `{}`, string(s.Tests[0].Request))
+	// The contents that are not messages only have their keys sorted
+	assert.Equal(t, `{"id":"${request.id}","status":0}`, string(s.Response.Stream[0]))
+
+	// The contents that are not JSON are left as they are
+	s.Response.Content = `{"id": ${request.id}}`
+	NormalizeContent(s, newRequest, newResponse)
+	assert.Equal(t, `{"id": ${request.id}}`, string(s.Response.Content))
+}
+
+func TestInMemoryStubsStore_Get_JSONFormatting(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	assert.NoError(t, store.Add(context.Background(), newTestStub("/test.Orders/Get", `{"id":1,"name":"a"}`)))
+
+	found, err := store.Get(context.Background(), newTestStub("/test.Orders/Get", `{ "name": "a", "id": 1 }`))
+	assert.NoError(t, err)
+	assert.Equal(t, JsonString(`{"id":1,"name":"a"}`), found.Request.Content)
+	err = store.Add(context.Background(), newTestStub("/test.Orders/Get", `{"name":"a","id":1}`))
+	assert.True(t, errors.Is(err, ErrConflict))
+}
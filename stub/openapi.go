@@ -0,0 +1,571 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OpenAPIExample is an example of an operation of an OpenAPI document: a request and the response to it
+type OpenAPIExample struct {
+	// Name is the name of the example, empty for the examples without name
+	Name string
+	// Method is the HTTP method of the operation, in upper case
+	Method string
+	// Path is the path template of the operation, with the base path of the document, e.g. /v1/orders/{id}
+	Path        string
+	PathParams  map[string]interface{}
+	QueryParams map[string]interface{}
+	// Body is the body of the request, nil without body
+	Body     interface{}
+	Status   int
+	Response interface{}
+}
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch"}
+
+// ParseOpenAPIExamples returns the examples of the operations of an OpenAPI 3 or Swagger 2 document, in JSON or YAML.
+// Each example of a response is paired with the example of the request with the same name (OpenAPI 3 named examples)
+// or, without one, with the example without name. The examples are those of the parameters (example, examples or
+// x-example), of the bodies (example, examples or the example of their schema) and of the responses (examples or
+// the example of their schema) of application/json.
+func ParseOpenAPIExamples(data []byte) ([]OpenAPIExample, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		var yamlDocument interface{}
+		if yamlErr := yaml.Unmarshal(data, &yamlDocument); yamlErr != nil {
+			return nil, fmt.Errorf("invalid OpenAPI document: %w", yamlErr)
+		}
+		document = fromYAML(yamlDocument)
+	}
+	root, ok := document.(map[string]interface{})
+	if !ok || (root["openapi"] == nil && root["swagger"] == nil) {
+		return nil, fmt.Errorf("invalid OpenAPI document: neither openapi nor swagger is set")
+	}
+	doc := openAPIDocument{root: root}
+	basePath, _ := root["basePath"].(string)
+	paths, _ := root["paths"].(map[string]interface{})
+	examples := make([]OpenAPIExample, 0)
+	for _, path := range sortedKeys(paths) {
+		pathItem := doc.object(paths[path])
+		for _, method := range openAPIMethods {
+			operation := doc.object(pathItem[method])
+			if operation == nil {
+				continue
+			}
+			examples = append(examples, doc.operationExamples(strings.TrimSuffix(basePath, "/")+path,
+				strings.ToUpper(method), pathItem, operation)...)
+		}
+	}
+	return examples, nil
+}
+
+type openAPIDocument struct {
+	root map[string]interface{}
+}
+
+// namedValues are the values of the examples by name, "" for the example without name
+type namedValues map[string]interface{}
+
+func (d openAPIDocument) operationExamples(path, method string, pathItem, operation map[string]interface{}) []OpenAPIExample {
+	pathParams := make(map[string]namedValues)
+	queryParams := make(map[string]namedValues)
+	bodies := make(namedValues)
+	parameters := append(d.array(pathItem["parameters"]), d.array(operation["parameters"])...)
+	for _, parameter := range parameters {
+		parameter := d.object(parameter)
+		name, _ := parameter["name"].(string)
+		switch parameter["in"] {
+		case "path":
+			pathParams[name] = d.parameterExamples(parameter)
+		case "query":
+			queryParams[name] = d.parameterExamples(parameter)
+		case "body":
+			bodies = d.schemaExample(parameter["schema"])
+		}
+	}
+	if requestBody := d.object(operation["requestBody"]); requestBody != nil {
+		bodies = d.contentExamples(requestBody)
+	}
+
+	examples := make([]OpenAPIExample, 0)
+	responses := d.object(operation["responses"])
+	for _, statusKey := range sortedKeys(responses) {
+		status, err := strconv.Atoi(statusKey)
+		if err != nil {
+			continue
+		}
+		response := d.object(responses[statusKey])
+		var responseExamples namedValues
+		if response["content"] != nil {
+			responseExamples = d.contentExamples(response)
+		} else {
+			responseExamples = d.swaggerResponseExamples(response)
+		}
+		for _, name := range sortedKeys(responseExamples) {
+			example := OpenAPIExample{
+				Name:        name,
+				Method:      method,
+				Path:        path,
+				PathParams:  namedExamples(pathParams, name),
+				QueryParams: namedExamples(queryParams, name),
+				Body:        namedExample(bodies, name),
+				Status:      status,
+				Response:    responseExamples[name],
+			}
+			examples = append(examples, example)
+		}
+	}
+	return examples
+}
+
+// namedExample returns the example with the name or, without it, the one without name
+func namedExample(values namedValues, name string) interface{} {
+	if value, found := values[name]; found {
+		return value
+	}
+	return values[""]
+}
+
+func namedExamples(params map[string]namedValues, name string) map[string]interface{} {
+	values := make(map[string]interface{})
+	for param, examples := range params {
+		if value := namedExample(examples, name); value != nil {
+			values[param] = value
+		}
+	}
+	return values
+}
+
+func (d openAPIDocument) parameterExamples(parameter map[string]interface{}) namedValues {
+	values := d.examples(parameter)
+	if value, found := parameter["x-example"]; found {
+		values[""] = value
+	}
+	if len(values) == 0 {
+		return d.schemaExample(parameter["schema"])
+	}
+	return values
+}
+
+// contentExamples returns the examples of the application/json content of a request body or a response (OpenAPI 3)
+func (d openAPIDocument) contentExamples(node map[string]interface{}) namedValues {
+	content := d.object(node["content"])
+	for _, mediaType := range sortedKeys(content) {
+		if !strings.Contains(mediaType, "json") {
+			continue
+		}
+		media := d.object(content[mediaType])
+		if values := d.examples(media); len(values) > 0 {
+			return values
+		}
+		return d.schemaExample(media["schema"])
+	}
+	return namedValues{}
+}
+
+// swaggerResponseExamples returns the example of a response of a Swagger 2 document
+func (d openAPIDocument) swaggerResponseExamples(response map[string]interface{}) namedValues {
+	examples := d.object(response["examples"])
+	for _, mediaType := range sortedKeys(examples) {
+		if strings.Contains(mediaType, "json") {
+			return namedValues{"": examples[mediaType]}
+		}
+	}
+	return d.schemaExample(response["schema"])
+}
+
+// examples returns the example and the named examples of a node
+func (d openAPIDocument) examples(node map[string]interface{}) namedValues {
+	values := make(namedValues)
+	if value, found := node["example"]; found {
+		values[""] = value
+	}
+	named := d.object(node["examples"])
+	for _, name := range sortedKeys(named) {
+		if example := d.object(named[name]); example != nil {
+			if value, found := example["value"]; found {
+				values[name] = value
+			}
+		}
+	}
+	return values
+}
+
+func (d openAPIDocument) schemaExample(schema interface{}) namedValues {
+	if value, found := d.object(schema)["example"]; found {
+		return namedValues{"": value}
+	}
+	return namedValues{}
+}
+
+// object returns the node as an object, following its reference ($ref) to the document, if any
+func (d openAPIDocument) object(node interface{}) map[string]interface{} {
+	object, _ := node.(map[string]interface{})
+	for i := 0; i < 10 && object != nil; i++ {
+		ref, isRef := object["$ref"].(string)
+		if !isRef {
+			break
+		}
+		object, _ = d.resolve(ref).(map[string]interface{})
+	}
+	return object
+}
+
+func (d openAPIDocument) array(node interface{}) []interface{} {
+	array, _ := node.([]interface{})
+	return array
+}
+
+// resolve returns the node of a local reference, e.g. #/components/examples/order
+func (d openAPIDocument) resolve(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	var node interface{} = d.root
+	for _, name := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+		node = object[name]
+	}
+	return node
+}
+
+func sortedKeys(values interface{}) []string {
+	keys := make([]string, 0)
+	switch m := values.(type) {
+	case map[string]interface{}:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	case namedValues:
+		for key := range m {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fromYAML converts the maps decoded from YAML, with keys of any type, to maps with string keys as decoded from JSON
+func fromYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = fromYAML(item)
+		}
+		return object
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromYAML(item)
+		}
+		return v
+	}
+	return value
+}
+
+// HTTPRule is a mapping of a method to HTTP, as set with the google.api.http option for grpc-gateway
+type HTTPRule struct {
+	// Method is the HTTP method, in upper case, or the kind of a custom rule
+	Method string
+	// Path is the path template, e.g. /v1/{name=orders/*}
+	Path string
+	// Body is the field of the request in the body, * for the whole request and empty without body
+	Body string
+	// ResponseBody is the field of the response in the body, empty for the whole response
+	ResponseBody string
+}
+
+// Field numbers of the google.api.http option and of google.api.HttpRule
+const (
+	httpRuleExtension         protowire.Number = 72295728
+	httpRuleGet               protowire.Number = 2
+	httpRulePut               protowire.Number = 3
+	httpRulePost              protowire.Number = 4
+	httpRuleDelete            protowire.Number = 5
+	httpRulePatch             protowire.Number = 6
+	httpRuleBody              protowire.Number = 7
+	httpRuleCustom            protowire.Number = 8
+	httpRuleAdditionalBinding protowire.Number = 11
+	httpRuleResponseBody      protowire.Number = 12
+)
+
+var httpRuleMethods = map[protowire.Number]string{
+	httpRuleGet:    http.MethodGet,
+	httpRulePut:    http.MethodPut,
+	httpRulePost:   http.MethodPost,
+	httpRuleDelete: http.MethodDelete,
+	httpRulePatch:  http.MethodPatch,
+}
+
+// MethodHTTPRules returns the HTTP mappings of the method, with their additional bindings. The google.api.http
+// option is decoded from the options of the method, whether google/api/annotations.proto is linked in or not.
+func MethodHTTPRules(method protoreflect.MethodDescriptor) []HTTPRule {
+	options := method.Options()
+	if options == nil {
+		return nil
+	}
+	encoded, err := proto.Marshal(options)
+	if err != nil {
+		return nil
+	}
+	rules := make([]HTTPRule, 0)
+	forEachEncodedField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if num == httpRuleExtension && typ == protowire.BytesType {
+			rules = append(rules, parseHTTPRule(value)...)
+		}
+	})
+	return rules
+}
+
+// parseHTTPRule returns the rule encoded followed by its additional bindings
+func parseHTTPRule(encoded []byte) []HTTPRule {
+	var rule HTTPRule
+	bindings := make([]HTTPRule, 0)
+	forEachEncodedField(encoded, func(num protowire.Number, typ protowire.Type, value []byte) {
+		if typ != protowire.BytesType {
+			return
+		}
+		switch num {
+		case httpRuleGet, httpRulePut, httpRulePost, httpRuleDelete, httpRulePatch:
+			rule.Method, rule.Path = httpRuleMethods[num], string(value)
+		case httpRuleCustom:
+			forEachEncodedField(value, func(num protowire.Number, typ protowire.Type, value []byte) {
+				if num == 1 && typ == protowire.BytesType {
+					rule.Method = strings.ToUpper(string(value))
+				} else if num == 2 && typ == protowire.BytesType {
+					rule.Path = string(value)
+				}
+			})
+		case httpRuleBody:
+			rule.Body = string(value)
+		case httpRuleResponseBody:
+			rule.ResponseBody = string(value)
+		case httpRuleAdditionalBinding:
+			bindings = append(bindings, parseHTTPRule(value)...)
+		}
+	})
+	if rule.Path == "" {
+		return bindings
+	}
+	return append([]HTTPRule{rule}, bindings...)
+}
+
+// forEachEncodedField calls f with the number, wire type and value of each field of the encoded message, where the
+// value is the content of the length-delimited fields. It stops at the first malformed field.
+func forEachEncodedField(encoded []byte, f func(protowire.Number, protowire.Type, []byte)) {
+	for len(encoded) > 0 {
+		num, typ, n := protowire.ConsumeTag(encoded)
+		if n < 0 {
+			return
+		}
+		encoded = encoded[n:]
+		n = protowire.ConsumeFieldValue(num, typ, encoded)
+		if n < 0 {
+			return
+		}
+		value := encoded[:n]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		f(num, typ, value)
+		encoded = encoded[n:]
+	}
+}
+
+// pathVariable matches the variables of path templates, e.g. {name=orders/*}
+var pathVariable = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+// normalizePath removes the patterns of the variables of a path template, as OpenAPI paths don't have them
+func normalizePath(path string) string {
+	return pathVariable.ReplaceAllString(path, "{$1}")
+}
+
+// httpStatusCodes are the gRPC status codes of the HTTP statuses of the errors, as mapped by grpc-gateway
+var httpStatusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.AlreadyExists,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	499:                            codes.Canceled,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// OpenAPIStubs converts the examples of an OpenAPI document to stubs of the methods mapped to their operations with
+// the google.api.http option (grpc-gateway). The request of a stub is made of the body, path and query parameters of
+// the example, mapped to the fields of the request as grpc-gateway does, and matches the calls partially. The
+// examples of the responses with an error status become error stubs, with the code and message of the error body of
+// grpc-gateway or the code of the status. The examples that can't be converted, e.g. because no method is mapped to
+// their operation, are skipped and reported in the warnings, as the second of stubs for the same request.
+func OpenAPIStubs(examples []OpenAPIExample, files *protoregistry.Files, methods []string) ([]*Stub, []string) {
+	type binding struct {
+		fullMethod string
+		method     protoreflect.MethodDescriptor
+		rule       HTTPRule
+	}
+	// The operations are bound to the first method mapped to them
+	bindings := make(map[string]binding)
+	for _, fullMethod := range methods {
+		method := findMethod(files, fullMethod)
+		if method == nil {
+			continue
+		}
+		for _, rule := range MethodHTTPRules(method) {
+			operation := rule.Method + " " + normalizePath(rule.Path)
+			if _, found := bindings[operation]; !found {
+				bindings[operation] = binding{fullMethod: fullMethod, method: method, rule: rule}
+			}
+		}
+	}
+
+	stubs := make([]*Stub, 0)
+	warnings := make([]string, 0)
+	keys := make(map[string]bool)
+	for _, example := range examples {
+		operation := example.Method + " " + normalizePath(example.Path)
+		name := fmt.Sprintf("example of %s (%d)", operation, example.Status)
+		if example.Name != "" {
+			name = fmt.Sprintf("example '%s' of %s (%d)", example.Name, operation, example.Status)
+		}
+		b, found := bindings[operation]
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("%s: no method is mapped to the operation", name))
+			continue
+		}
+		s, err := openAPIStub(example, b.fullMethod, b.method, b.rule)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", name, err.Error()))
+			continue
+		}
+		s.Description = "OpenAPI " + name
+		key := s.FullMethod + " " + string(s.Request.Content)
+		if keys[key] {
+			warnings = append(warnings, fmt.Sprintf("%s: another example has the same request", name))
+			continue
+		}
+		keys[key] = true
+		stubs = append(stubs, s)
+	}
+	return stubs, warnings
+}
+
+func openAPIStub(example OpenAPIExample, fullMethod string, method protoreflect.MethodDescriptor, rule HTTPRule) (*Stub, error) {
+	request := make(map[string]interface{})
+	switch {
+	case rule.Body == "*":
+		if body, isObject := example.Body.(map[string]interface{}); isObject {
+			request = body
+		} else if example.Body != nil {
+			return nil, fmt.Errorf("the body is not an object")
+		}
+	case rule.Body != "" && example.Body != nil:
+		setFieldPath(request, rule.Body, example.Body)
+	}
+	for param, value := range example.QueryParams {
+		setFieldPath(request, param, value)
+	}
+	for param, value := range example.PathParams {
+		setFieldPath(request, param, value)
+	}
+	requestContent, err := normalizeJSONMessage(method.Input(), request)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	s := &Stub{
+		FullMethod: fullMethod,
+		Request:    &StubRequest{Match: "partial", Content: requestContent},
+	}
+
+	if example.Status >= http.StatusBadRequest {
+		s.Response = &StubResponse{Type: "error", Error: openAPIError(example.Status, example.Response)}
+		return s, nil
+	}
+	if example.Status < http.StatusOK || example.Status >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("the status is neither a success nor an error")
+	}
+	response := example.Response
+	if rule.ResponseBody != "" {
+		wrapped := make(map[string]interface{})
+		setFieldPath(wrapped, rule.ResponseBody, response)
+		response = wrapped
+	}
+	responseContent, err := normalizeJSONMessage(method.Output(), response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	s.Response = &StubResponse{Type: "success", Content: responseContent}
+	return s, nil
+}
+
+// openAPIError returns the error of the response of an example, from its body when it has the code (number) of the
+// errors of grpc-gateway or from the HTTP status
+func openAPIError(status int, response interface{}) *ErrorResponse {
+	body, _ := response.(map[string]interface{})
+	code, found := httpStatusCodes[status]
+	if !found {
+		code = codes.Unknown
+	}
+	// The numbers are decoded as float64 from JSON and as int from YAML
+	number := -1
+	switch n := body["code"].(type) {
+	case float64:
+		number = int(n)
+	case int:
+		number = n
+	}
+	if number > 0 && number < len(statusCodeNames) {
+		code = codes.Code(number)
+	}
+	message, _ := body["message"].(string)
+	return &ErrorResponse{Code: StatusCode(code), Message: message}
+}
+
+// setFieldPath sets the value of a field, or of a nested field given by its dotted path, e.g. order.id
+func setFieldPath(object map[string]interface{}, path string, value interface{}) {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		nested, isObject := object[name].(map[string]interface{})
+		if !isObject {
+			nested = make(map[string]interface{})
+			object[name] = nested
+		}
+		object = nested
+	}
+	object[names[len(names)-1]] = value
+}
+
+// normalizeJSONMessage checks the value against the message in the JSON mapping of protobuf and returns it with the
+// JSON names of the fields
+func normalizeJSONMessage(descriptor protoreflect.MessageDescriptor, value interface{}) (JsonString, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := protojson.Unmarshal(data, message); err != nil {
+		return "", err
+	}
+	return marshalJSONMessage(message)
+}
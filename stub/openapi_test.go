@@ -0,0 +1,204 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+)
+
+const openAPI3Document = `
+openapi: 3.0.0
+paths:
+  /v1/orders/{order_id}:
+    get:
+      parameters:
+        - name: order_id
+          in: path
+          examples:
+            found: {value: "1"}
+            missing: {value: "2"}
+        - name: view
+          in: query
+          example: FULL
+      responses:
+        "200":
+          content:
+            application/json:
+              examples:
+                found: {$ref: "#/components/examples/order"}
+        "404":
+          content:
+            application/json:
+              examples:
+                missing: {value: {code: 5, message: order 2 not found}}
+  /v1/orders:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              example: {customer: jane}
+      responses:
+        "201":
+          content:
+            application/json:
+              schema:
+                example: {id: "3", customer: jane}
+components:
+  examples:
+    order:
+      value: {id: "1", customer: john}
+`
+
+const swagger2Document = `{
+  "swagger": "2.0",
+  "basePath": "/api/",
+  "paths": {
+    "/v1/orders/{order_id}": {
+      "get": {
+        "parameters": [{"name": "order_id", "in": "path", "x-example": "1"}],
+        "responses": {"200": {"examples": {"application/json": {"id": "1"}}}}
+      }
+    }
+  }
+}`
+
+func TestParseOpenAPIExamples(t *testing.T) {
+	examples, err := ParseOpenAPIExamples([]byte(openAPI3Document))
+	assert.NoError(t, err)
+	assert.Equal(t, []OpenAPIExample{
+		{Method: "POST", Path: "/v1/orders", PathParams: map[string]interface{}{}, QueryParams: map[string]interface{}{},
+			Body: map[string]interface{}{"customer": "jane"}, Status: 201,
+			Response: map[string]interface{}{"id": "3", "customer": "jane"}},
+		{Name: "found", Method: "GET", Path: "/v1/orders/{order_id}",
+			PathParams: map[string]interface{}{"order_id": "1"}, QueryParams: map[string]interface{}{"view": "FULL"},
+			Status: 200, Response: map[string]interface{}{"id": "1", "customer": "john"}},
+		{Name: "missing", Method: "GET", Path: "/v1/orders/{order_id}",
+			PathParams: map[string]interface{}{"order_id": "2"}, QueryParams: map[string]interface{}{"view": "FULL"},
+			Status: 404, Response: map[string]interface{}{"code": 5, "message": "order 2 not found"}},
+	}, examples)
+
+	examples, err = ParseOpenAPIExamples([]byte(swagger2Document))
+	assert.NoError(t, err)
+	assert.Equal(t, []OpenAPIExample{{Method: "GET", Path: "/api/v1/orders/{order_id}",
+		PathParams: map[string]interface{}{"order_id": "1"}, QueryParams: map[string]interface{}{},
+		Status: 200, Response: map[string]interface{}{"id": "1"}}}, examples)
+
+	_, err = ParseOpenAPIExamples([]byte("paths: {}"))
+	assert.Error(t, err)
+}
+
+// newHTTPRuleFiles returns the files of a service whose methods are mapped to HTTP with the google.api.http option,
+// encoded as unknown fields of the options as when google/api/annotations.proto is not linked in
+func newHTTPRuleFiles(t *testing.T) *protoregistry.Files {
+	httpRule := func(rule ...[]byte) *descriptorpb.MethodOptions {
+		options := new(descriptorpb.MethodOptions)
+		var encoded []byte
+		for _, field := range rule {
+			encoded = append(encoded, field...)
+		}
+		unknown := protowire.AppendTag(nil, httpRuleExtension, protowire.BytesType)
+		options.ProtoReflect().SetUnknown(protowire.AppendBytes(unknown, encoded))
+		return options
+	}
+	stringField := func(num protowire.Number, value string) []byte {
+		return protowire.AppendString(protowire.AppendTag(nil, num, protowire.BytesType), value)
+	}
+	field := func(name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   fieldType.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("acme/orders.proto"),
+		Package: proto.String("acme"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Order"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("customer", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			}},
+			{Name: proto.String("GetOrderRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("order_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("view", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			}},
+			{Name: proto.String("CreateOrderRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("order", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".acme.Order"),
+			}},
+			{Name: proto.String("CreateOrderResponse"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("order", 1, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".acme.Order"),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Orders"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("GetOrder"), InputType: proto.String(".acme.GetOrderRequest"),
+					OutputType: proto.String(".acme.Order"),
+					Options:    httpRule(stringField(httpRuleGet, "/v1/orders/{order_id=*}"))},
+				{Name: proto.String("CreateOrder"), InputType: proto.String(".acme.CreateOrderRequest"),
+					OutputType: proto.String(".acme.CreateOrderResponse"),
+					Options: httpRule(stringField(httpRulePost, "/v1/orders"), stringField(httpRuleBody, "order"),
+						stringField(httpRuleResponseBody, "order"),
+						protowire.AppendBytes(protowire.AppendTag(nil, httpRuleAdditionalBinding, protowire.BytesType),
+							append(stringField(httpRulePost, "/v2/orders"), stringField(httpRuleBody, "*")...)))},
+			},
+		}},
+	}
+	files := new(protoregistry.Files)
+	file, err := protodesc.NewFile(fdp, files)
+	assert.NoError(t, err)
+	assert.NoError(t, files.RegisterFile(file))
+	return files
+}
+
+func TestMethodHTTPRules(t *testing.T) {
+	files := newHTTPRuleFiles(t)
+
+	assert.Equal(t, []HTTPRule{{Method: "GET", Path: "/v1/orders/{order_id=*}"}},
+		MethodHTTPRules(findMethod(files, "/acme.Orders/GetOrder")))
+	assert.Equal(t, []HTTPRule{
+		{Method: "POST", Path: "/v1/orders", Body: "order", ResponseBody: "order"},
+		{Method: "POST", Path: "/v2/orders", Body: "*"},
+	}, MethodHTTPRules(findMethod(files, "/acme.Orders/CreateOrder")))
+}
+
+func TestOpenAPIStubs(t *testing.T) {
+	files := newHTTPRuleFiles(t)
+	examples, err := ParseOpenAPIExamples([]byte(openAPI3Document))
+	assert.NoError(t, err)
+	examples = append(examples, OpenAPIExample{Method: "DELETE", Path: "/v1/orders/{order_id}", Status: 200})
+
+	stubs, warnings := OpenAPIStubs(examples, files, []string{"/acme.Orders/GetOrder", "/acme.Orders/CreateOrder"})
+
+	assert.Equal(t, 3, len(stubs))
+	assert.Equal(t, "/acme.Orders/CreateOrder", stubs[0].FullMethod)
+	assert.Equal(t, `{"order":{"customer":"jane"}}`, string(stubs[0].Request.Content))
+	assert.Equal(t, &StubResponse{Type: "success", Content: `{"order":{"id":"3","customer":"jane"}}`}, stubs[0].Response)
+	assert.Equal(t, "/acme.Orders/GetOrder", stubs[1].FullMethod)
+	assert.Equal(t, "partial", stubs[1].Request.Match)
+	assert.Equal(t, `{"orderId":"1","view":"FULL"}`, string(stubs[1].Request.Content))
+	assert.Equal(t, &StubResponse{Type: "success", Content: `{"id":"1","customer":"john"}`}, stubs[1].Response)
+	assert.Equal(t, "OpenAPI example 'found' of GET /v1/orders/{order_id} (200)", stubs[1].Description)
+	assert.Equal(t, `{"orderId":"2","view":"FULL"}`, string(stubs[2].Request.Content))
+	assert.Equal(t, &StubResponse{Type: "error", Error: &ErrorResponse{Code: 5, Message: "order 2 not found"}}, stubs[2].Response)
+	assert.Equal(t, []string{"example of DELETE /v1/orders/{order_id} (200): no method is mapped to the operation"}, warnings)
+}
+
+func TestOpenAPIError(t *testing.T) {
+	assert.Equal(t, &ErrorResponse{Code: 7}, openAPIError(403, nil))
+	assert.Equal(t, &ErrorResponse{Code: 2, Message: "teapot"}, openAPIError(418, map[string]interface{}{"message": "teapot"}))
+	assert.Equal(t, &ErrorResponse{Code: 9, Message: "no stock"},
+		openAPIError(400, map[string]interface{}{"code": float64(9), "message": "no stock"}))
+	assert.Equal(t, &ErrorResponse{Code: 10}, openAPIError(409, map[string]interface{}{"code": 10}))
+}
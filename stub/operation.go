@@ -0,0 +1,265 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CancelledOperationMessage is the message of the error of the operations cancelled
+const CancelledOperationMessage = "operation cancelled"
+
+// OperationResponse makes the stub start a long-running operation (https://google.aip.dev/151): the response is a
+// google.longrunning.Operation that is running until the delay passes or it is polled a number of times, and done with
+// the response or the error after that. It is done at once when neither is set.
+type OperationResponse struct {
+	// Name of the operation, operations/<n> when not set. It can have placeholders (see renderText).
+	Name string `json:"name,omitempty"`
+	// DoneAfter is the time the operation runs for, e.g. 2s
+	DoneAfter string `json:"doneAfter,omitempty"`
+	// DoneAfterPolls is the number of the call to GetOperation that finds the operation done, e.g. 3 for the third
+	DoneAfterPolls int `json:"doneAfterPolls,omitempty"`
+	// Metadata, Response and Error are the fields of the operation, the first two in the JSON of an Any (with @type).
+	// They can have placeholders (see renderJSON).
+	Metadata JsonString `json:"metadata,omitempty"`
+	Response JsonString `json:"response,omitempty"`
+	// Error is the error of the operation when it is done, without details
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+func (o *OperationResponse) validate() []string {
+	errMsgs := make([]string, 0)
+	if o.DoneAfter != "" {
+		if d, err := time.ParseDuration(o.DoneAfter); err != nil || d < 0 {
+			errMsgs = append(errMsgs, fmt.Sprintf("Operation doneAfter '%s' is not a valid duration.", o.DoneAfter))
+		}
+	}
+	if o.DoneAfterPolls < 0 {
+		errMsgs = append(errMsgs, "Operation doneAfterPolls can't be negative.")
+	}
+	if o.Response != "" && o.Error != nil {
+		errMsgs = append(errMsgs, "Operation can't have both a response and an error.")
+	}
+	if o.Error != nil && !o.Error.Code.isKnown() {
+		errMsgs = append(errMsgs, fmt.Sprintf("Operation error code %s is not a gRPC status code.", o.Error.Code))
+	}
+	for name, content := range map[string]JsonString{"metadata": o.Metadata, "response": o.Response} {
+		object := make(map[string]interface{})
+		if content != "" && json.Unmarshal([]byte(content), &object) != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Operation %s is not a valid JSON object.", name))
+		}
+	}
+	sort.Strings(errMsgs)
+	return errMsgs
+}
+
+// Operation is a long-running operation started by a stub
+type Operation struct {
+	Name      string    `json:"name"`
+	Done      bool      `json:"done"`
+	Polls     int       `json:"polls"`
+	StartedAt time.Time `json:"startedAt"`
+
+	doneAt         time.Time
+	doneAfterPolls int
+	// running and done are the JSON of the google.longrunning.Operation in each state
+	running JsonString
+	done    JsonString
+}
+
+// Operations keeps the long-running operations started by the stubs. It is safe for concurrent use.
+type Operations struct {
+	operations map[string]*Operation
+	// names are the names of the operations in the order they were started
+	names  []string
+	lastID int64
+	mutex  sync.Mutex
+}
+
+var operations = NewOperations()
+
+func NewOperations() *Operations {
+	return &Operations{operations: make(map[string]*Operation)}
+}
+
+// GetOperations returns the operations started by the stubs
+func GetOperations() *Operations {
+	return operations
+}
+
+// start renders the operation of the stub and returns its JSON. It is only kept when the state is not read-only, so
+// that checking a stub doesn't start operations.
+func (o *Operations) start(response *OperationResponse, data *templateData) (JsonString, error) {
+	name, err := data.renderText(response.Name)
+	if err != nil {
+		return "", err
+	}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if name == "" {
+		name = "operations/" + strconv.FormatInt(o.lastID+1, 10)
+	}
+	fields := []string{fmt.Sprintf(`"name":%s`, jsonText(name))}
+	if response.Metadata != "" {
+		metadata, err := data.renderJSON(response.Metadata)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, `"metadata":`+string(metadata))
+	}
+	operation := &Operation{
+		Name:           name,
+		StartedAt:      data.now,
+		doneAfterPolls: response.DoneAfterPolls,
+		running:        JsonString("{" + strings.Join(fields, ",") + "}"),
+	}
+	if response.DoneAfter != "" {
+		doneAfter, _ := time.ParseDuration(response.DoneAfter)
+		operation.doneAt = data.now.Add(doneAfter)
+	}
+	fields = append(fields, `"done":true`)
+	switch {
+	case response.Error != nil:
+		message, err := data.renderText(response.Error.Message)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, fmt.Sprintf(`"error":{"code":%d,"message":%s}`, int32(response.Error.Code), jsonText(message)))
+	case response.Response != "":
+		result, err := data.renderJSON(response.Response)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, `"response":`+string(result))
+	}
+	operation.done = JsonString("{" + strings.Join(fields, ",") + "}")
+	operation.Done = operation.isDone(data.now)
+	if !data.stateReadOnly {
+		if response.Name == "" {
+			o.lastID++
+		}
+		if _, exists := o.operations[name]; !exists {
+			o.names = append(o.names, name)
+		}
+		o.operations[name] = operation
+	}
+	return operation.current(), nil
+}
+
+func (op *Operation) isDone(now time.Time) bool {
+	if op.doneAt.IsZero() && op.doneAfterPolls == 0 {
+		return true
+	}
+	return (!op.doneAt.IsZero() && !now.Before(op.doneAt)) || (op.doneAfterPolls > 0 && op.Polls >= op.doneAfterPolls)
+}
+
+// current returns the JSON of the operation in its current state
+func (op *Operation) current() JsonString {
+	if op.Done {
+		return op.done
+	}
+	return op.running
+}
+
+// Poll returns the JSON of the google.longrunning.Operation with the name, counting the call towards the polls after
+// which it is done
+func (o *Operations) Poll(name string) (JsonString, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	operation, found := o.operations[name]
+	if !found {
+		return "", false
+	}
+	operation.Polls++
+	operation.Done = operation.Done || operation.isDone(clock.Now())
+	return operation.current(), true
+}
+
+// List returns the JSON of the operations whose names start with the prefix, in the order they were started
+func (o *Operations) List(prefix string) []JsonString {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	now := clock.Now()
+	list := make([]JsonString, 0, len(o.names))
+	for _, name := range o.names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		operation := o.operations[name]
+		operation.Done = operation.Done || operation.isDone(now)
+		list = append(list, operation.current())
+	}
+	return list
+}
+
+// Cancel makes the operation done with a CANCELLED error, unless it is done already
+func (o *Operations) Cancel(name string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	operation, found := o.operations[name]
+	if !found {
+		return false
+	}
+	if operation.Done = operation.Done || operation.isDone(clock.Now()); !operation.Done {
+		operation.Done = true
+		operation.done = JsonString(strings.TrimSuffix(string(operation.running), "}") +
+			fmt.Sprintf(`,"done":true,"error":{"code":1,"message":%s}}`, jsonText(CancelledOperationMessage)))
+	}
+	return true
+}
+
+// Delete removes the operation
+func (o *Operations) Delete(name string) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, found := o.operations[name]; !found {
+		return false
+	}
+	delete(o.operations, name)
+	for i, existing := range o.names {
+		if existing == name {
+			o.names = append(o.names[:i], o.names[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// GetAll returns the operations, in the order they were started
+func (o *Operations) GetAll() []Operation {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	now := clock.Now()
+	all := make([]Operation, 0, len(o.names))
+	for _, name := range o.names {
+		operation := o.operations[name]
+		operation.Done = operation.Done || operation.isDone(now)
+		all = append(all, *operation)
+	}
+	return all
+}
+
+// Reset removes all the operations
+func (o *Operations) Reset() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.operations = make(map[string]*Operation)
+	o.names = nil
+	o.lastID = 0
+}
+
+func jsonText(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,90 @@
+package stub
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+	"time"
+)
+
+func TestGetResponse_Operation(t *testing.T) {
+	clock := util.NewMockClock()
+	clock.Freeze()
+	clock.Set(time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(util.SystemClock{})
+	defer operations.Reset()
+
+	start := func(operation *OperationResponse) string {
+		s := &Stub{
+			FullMethod: "/acme.Orders/ExportOrders",
+			Request:    &StubRequest{Match: "partial", Content: "{}"},
+			Response:   &StubResponse{Type: "success", Operation: operation},
+		}
+		assert.Empty(t, operation.validate())
+		resp, err := GetResponse(context.Background(), s, `{"parent":"shops/1"}`, new(structpb.Struct))
+		assert.NoError(t, err)
+		json, err := protojson.Marshal(resp.(*structpb.Struct))
+		assert.NoError(t, err)
+		return string(json)
+	}
+
+	started := start(&OperationResponse{
+		DoneAfterPolls: 2,
+		Metadata:       `{"@type":"type.googleapis.com/acme.ExportMetadata","parent":"${request.parent}"}`,
+		Response:       `{"@type":"type.googleapis.com/acme.ExportResponse","url":"https://example.com/export"}`,
+	})
+	assert.JSONEq(t, `{"name":"operations/1","metadata":{"@type":"type.googleapis.com/acme.ExportMetadata","parent":"shops/1"}}`, started)
+	running, found := operations.Poll("operations/1")
+	assert.True(t, found)
+	assert.JSONEq(t, started, running.String())
+	done, _ := operations.Poll("operations/1")
+	assert.JSONEq(t, `{"name":"operations/1","done":true,`+
+		`"metadata":{"@type":"type.googleapis.com/acme.ExportMetadata","parent":"shops/1"},`+
+		`"response":{"@type":"type.googleapis.com/acme.ExportResponse","url":"https://example.com/export"}}`, done.String())
+
+	assert.JSONEq(t, `{"name":"exports/shops/1"}`, start(&OperationResponse{
+		Name:      "exports/${request.parent}",
+		DoneAfter: "1m",
+		Error:     &ErrorResponse{Code: 8, Message: "quota exceeded"},
+	}))
+	clock.Set(clock.Now().Add(time.Minute))
+	failed, _ := operations.Poll("exports/shops/1")
+	assert.JSONEq(t, `{"name":"exports/shops/1","done":true,"error":{"code":8,"message":"quota exceeded"}}`, failed.String())
+
+	assert.JSONEq(t, `{"name":"operations/2","done":true}`, start(&OperationResponse{}))
+	assert.Len(t, operations.List("operations/"), 2)
+	assert.True(t, operations.Delete("operations/2"))
+	assert.False(t, operations.Delete("operations/2"))
+	assert.Len(t, operations.GetAll(), 2)
+}
+
+func TestOperations_Cancel(t *testing.T) {
+	ops := NewOperations()
+	_, err := ops.start(&OperationResponse{DoneAfterPolls: 5}, &templateData{now: time.Now()})
+	assert.NoError(t, err)
+
+	assert.True(t, ops.Cancel("operations/1"))
+	assert.False(t, ops.Cancel("operations/2"))
+	cancelled, _ := ops.Poll("operations/1")
+	assert.JSONEq(t, `{"name":"operations/1","done":true,"error":{"code":1,"message":"operation cancelled"}}`, cancelled.String())
+}
+
+func TestOperationResponse_Validate(t *testing.T) {
+	operation := &OperationResponse{
+		DoneAfter:      "soon",
+		DoneAfterPolls: -1,
+		Response:       `[]`,
+		Error:          &ErrorResponse{Code: 99},
+	}
+	assert.Equal(t, []string{
+		"Operation can't have both a response and an error.",
+		"Operation doneAfter 'soon' is not a valid duration.",
+		"Operation doneAfterPolls can't be negative.",
+		"Operation error code 99 is not a gRPC status code.",
+		"Operation response is not a valid JSON object.",
+	}, operation.validate())
+}
@@ -0,0 +1,75 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StreamPacing controls the time between the messages of a stream. The durations use the Go format, e.g. 500ms or 5s.
+type StreamPacing struct {
+	// Delays are the waits before each message. The last one applies to all the messages after it.
+	Delays []string `json:"delays,omitempty"`
+	// MessagesPerSecond sends the messages at a constant rate, the first one without waiting
+	MessagesPerSecond float64 `json:"messagesPerSecond,omitempty"`
+	// Repeat sends the messages again, from the first one, until the client cancels the call. It simulates
+	// subscriptions, e.g. a heartbeat every 5s.
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// Delay returns the wait before sending the message with the index given, counting the messages sent in previous
+// repetitions.
+func (p *StreamPacing) Delay(index int) time.Duration {
+	switch {
+	case p == nil:
+		return 0
+	case len(p.Delays) > 0:
+		if index >= len(p.Delays) {
+			index = len(p.Delays) - 1
+		}
+		delay, _ := time.ParseDuration(p.Delays[index])
+		return delay
+	case p.MessagesPerSecond > 0 && index > 0:
+		return time.Duration(float64(time.Second) / p.MessagesPerSecond)
+	}
+	return 0
+}
+
+// Wait waits before sending the message with the index given. It returns the error of the context if it is done
+// before the time to send the message.
+func (p *StreamPacing) Wait(ctx context.Context, index int) error {
+	delay := p.Delay(index)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *StreamPacing) validate(responseType string) (errMsgs []string) {
+	for i, delay := range p.Delays {
+		if d, err := time.ParseDuration(delay); err != nil || d < 0 {
+			errMsgs = append(errMsgs, fmt.Sprintf("Pacing delay %d is not a valid duration: '%s'.", i, delay))
+		}
+	}
+	if p.MessagesPerSecond < 0 {
+		errMsgs = append(errMsgs, "Pacing messages per second can't be negative.")
+	}
+	if len(p.Delays) > 0 && p.MessagesPerSecond > 0 {
+		errMsgs = append(errMsgs, "Pacing delays and messages per second can't be used together.")
+	}
+	if p.Repeat && responseType == "error" {
+		errMsgs = append(errMsgs, "Pacing can't repeat the messages of an error response.")
+	}
+	// Without a delay after the first messages, repeating would flood the client
+	if p.Repeat && len(errMsgs) == 0 && p.Delay(len(p.Delays)+1) == 0 {
+		errMsgs = append(errMsgs, "Pacing requires a delay between the messages to repeat them.")
+	}
+	return errMsgs
+}
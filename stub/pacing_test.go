@@ -0,0 +1,28 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStreamPacing_Delay(t *testing.T) {
+	var noPacing *StreamPacing
+	assert.Equal(t, time.Duration(0), noPacing.Delay(1))
+
+	delays := &StreamPacing{Delays: []string{"0s", "5s"}}
+	assert.Equal(t, time.Duration(0), delays.Delay(0))
+	assert.Equal(t, 5*time.Second, delays.Delay(1))
+	assert.Equal(t, 5*time.Second, delays.Delay(10))
+
+	rate := &StreamPacing{MessagesPerSecond: 4}
+	assert.Equal(t, time.Duration(0), rate.Delay(0))
+	assert.Equal(t, 250*time.Millisecond, rate.Delay(1))
+}
+
+func TestStreamPacing_Validate(t *testing.T) {
+	assert.Empty(t, (&StreamPacing{Delays: []string{"1s"}, Repeat: true}).validate("success"))
+	assert.Equal(t, []string{"Pacing delay 0 is not a valid duration: 'soon'."}, (&StreamPacing{Delays: []string{"soon"}}).validate("success"))
+	assert.Equal(t, []string{"Pacing requires a delay between the messages to repeat them."}, (&StreamPacing{Delays: []string{"1s", "0s"}, Repeat: true}).validate("success"))
+	assert.Equal(t, []string{"Pacing can't repeat the messages of an error response."}, (&StreamPacing{MessagesPerSecond: 1, Repeat: true}).validate("error"))
+}
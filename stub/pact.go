@@ -0,0 +1,173 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"strings"
+)
+
+const (
+	pactSpecificationVersion = "4.0"
+	pactInteractionType      = "Synchronous/Messages"
+	pactContentType          = "application/json"
+)
+
+// Pact is a contract between a consumer and a provider in the Pact specification V4, with a synchronous message
+// interaction per gRPC call. The messages are in their JSON representation.
+type Pact struct {
+	Consumer     PactParticipant        `json:"consumer"`
+	Provider     PactParticipant        `json:"provider"`
+	Interactions []*PactInteraction     `json:"interactions"`
+	Metadata     map[string]interface{} `json:"metadata"`
+}
+
+type PactParticipant struct {
+	Name string `json:"name"`
+}
+
+type PactInteraction struct {
+	Type           string              `json:"type"`
+	Key            string              `json:"key,omitempty"`
+	Description    string              `json:"description"`
+	ProviderStates []PactProviderState `json:"providerStates,omitempty"`
+	Transport      string              `json:"transport"`
+	Request        PactMessage         `json:"request"`
+	// Response has the message of unary calls or the messages of server streaming calls
+	Response []PactMessage `json:"response"`
+	// PluginConfiguration identifies the gRPC method as the Pact protobuf plugin does
+	PluginConfiguration map[string]interface{} `json:"pluginConfiguration"`
+}
+
+type PactProviderState struct {
+	Name string `json:"name"`
+}
+
+// PactMessage is a message with its metadata. The status of the errors is in the grpc-status and grpc-message
+// metadata.
+type PactMessage struct {
+	Contents PactContents           `json:"contents"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type PactContents struct {
+	Content     json.RawMessage `json:"content,omitempty"`
+	ContentType string          `json:"contentType"`
+	Encoded     bool            `json:"encoded"`
+}
+
+// NewPact creates an empty contract between the consumer and the provider
+func NewPact(consumer, provider string) *Pact {
+	return &Pact{
+		Consumer:     PactParticipant{Name: consumer},
+		Provider:     PactParticipant{Name: provider},
+		Interactions: make([]*PactInteraction, 0),
+		Metadata: map[string]interface{}{
+			"pactSpecification": map[string]interface{}{"version": pactSpecificationVersion},
+		},
+	}
+}
+
+// AddStubs adds an interaction per stub with its request and response. The scenario state required by a stub is the
+// provider state of its interaction. The stubs with scripted responses are skipped, as their responses are only known
+// when they are called.
+func (p *Pact) AddStubs(stubs []*Stub) {
+	for _, s := range stubs {
+		if s.Response.Type == ResponseTypeScript {
+			continue
+		}
+		request := s.Request.Content.WithoutUnsetFields()
+		description := s.Description
+		if description == "" {
+			description = fmt.Sprintf("%s with %s", s.FullMethod, defaultContent(request))
+		}
+		interaction := newPactInteraction(s.ID, description, s, request, s.Request.Metadata)
+		if s.Scenario != nil && s.Scenario.RequiredState != "" {
+			interaction.ProviderStates = []PactProviderState{
+				{Name: fmt.Sprintf("%s is %s", s.Scenario.Name, s.Scenario.RequiredState)},
+			}
+		}
+		p.Interactions = append(p.Interactions, interaction)
+	}
+}
+
+// AddJournal adds an interaction per call in the journal that was matched by one of the stubs, with the response
+// served. Repeated calls (same method, request, metadata and stub) are added once.
+func (p *Pact) AddJournal(entries []JournalEntry, stubs []*Stub) {
+	stubsByID := make(map[string]*Stub, len(stubs))
+	for _, s := range stubs {
+		stubsByID[s.ID] = s
+	}
+	added := make(map[string]bool, 0)
+	for _, entry := range entries {
+		s, found := stubsByID[entry.StubID]
+		if !found || s.Response.Type == ResponseTypeScript {
+			continue
+		}
+		metadataJSON, _ := json.Marshal(entry.Metadata)
+		key := strings.Join([]string{entry.FullMethod, entry.Request.String(), string(metadataJSON), entry.StubID}, "|")
+		if added[key] {
+			continue
+		}
+		added[key] = true
+		description := fmt.Sprintf("%s with %s (call %d)", entry.FullMethod, defaultContent(entry.Request), entry.Seq)
+		p.Interactions = append(p.Interactions,
+			newPactInteraction(fmt.Sprintf("call-%d", entry.Seq), description, s, entry.Request, entry.Metadata))
+	}
+}
+
+// newPactInteraction creates the interaction of a call with the request given to the stub. The templates of the
+// response are rendered with the request and metadata.
+func newPactInteraction(key, description string, s *Stub, request JsonString, md map[string][]string) *PactInteraction {
+	interaction := &PactInteraction{
+		Type:        pactInteractionType,
+		Key:         key,
+		Description: description,
+		Transport:   "grpc",
+		Request:     PactMessage{Contents: newPactContents(defaultContent(request))},
+		Response:    make([]PactMessage, 0),
+		PluginConfiguration: map[string]interface{}{
+			"protobuf": map[string]interface{}{"service": strings.TrimPrefix(s.FullMethod, "/")},
+		},
+	}
+	if len(md) > 0 {
+		interaction.Request.Metadata = make(map[string]interface{}, len(md))
+		for name, values := range md {
+			interaction.Request.Metadata[name] = strings.Join(values, ",")
+		}
+	}
+	data := newTemplateData(WithReadOnlyState(metadata.NewIncomingContext(context.Background(), md)), s, request.String())
+	contents := s.Response.Stream
+	if len(contents) == 0 && s.Response.Type != "error" {
+		contents = []JsonString{s.Response.Content}
+	}
+	for _, content := range contents {
+		if rendered, err := data.renderJSON(content); err == nil {
+			content = rendered
+		}
+		interaction.Response = append(interaction.Response, PactMessage{Contents: newPactContents(content)})
+	}
+	if s.Response.Type == "error" && s.Response.Error != nil {
+		message, err := data.renderText(s.Response.Error.Message)
+		if err != nil {
+			message = s.Response.Error.Message
+		}
+		interaction.Response = append(interaction.Response, PactMessage{
+			Contents: PactContents{ContentType: pactContentType},
+			Metadata: map[string]interface{}{"grpc-status": s.Response.Error.Code.String(), "grpc-message": message},
+		})
+	}
+	return interaction
+}
+
+func newPactContents(content JsonString) PactContents {
+	return PactContents{Content: json.RawMessage(content), ContentType: pactContentType}
+}
+
+func defaultContent(content JsonString) JsonString {
+	if content == "" {
+		return "{}"
+	}
+	return content
+}
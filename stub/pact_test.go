@@ -0,0 +1,85 @@
+package stub
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"testing"
+)
+
+func TestPact_AddStubs(t *testing.T) {
+	stubs := []*Stub{
+		{
+			ID:         "1",
+			FullMethod: "/test.Orders/Get",
+			Request:    &StubRequest{Match: "partial", Content: "{\"id\":1,\"note\":\"${unset}\"}"},
+			Response:   &StubResponse{Type: "success", Content: "{\"id\":\"${request.id}\"}"},
+			Scenario:   &StubScenario{Name: "checkout", RequiredState: "paid"},
+		},
+		{
+			ID:          "2",
+			Description: "order not found",
+			FullMethod:  "/test.Orders/Get",
+			Request:     &StubRequest{Match: "exact", Content: "{\"id\":2}"},
+			Response: &StubResponse{Type: "error", Error: &ErrorResponse{
+				Code: StatusCode(codes.NotFound), Message: "order ${request.id} not found"}},
+		},
+		{
+			ID:         "3",
+			FullMethod: "/test.Orders/Script",
+			Request:    &StubRequest{Match: "exact", Content: "{}"},
+			Response:   &StubResponse{Type: ResponseTypeScript, Script: "return {}"},
+		},
+	}
+	pact := NewPact("web", "orders")
+	pact.AddStubs(stubs)
+	assert.Len(t, pact.Interactions, 2)
+
+	interaction := pact.Interactions[0]
+	assert.Equal(t, "1", interaction.Key)
+	assert.Equal(t, "/test.Orders/Get with {\"id\":1}", interaction.Description)
+	assert.Equal(t, []PactProviderState{{Name: "checkout is paid"}}, interaction.ProviderStates)
+	assert.Equal(t, "{\"id\":1}", string(interaction.Request.Contents.Content))
+	assert.Len(t, interaction.Response, 1)
+	assert.Equal(t, "{\"id\":1}", string(interaction.Response[0].Contents.Content))
+
+	interaction = pact.Interactions[1]
+	assert.Equal(t, "order not found", interaction.Description)
+	assert.Len(t, interaction.Response, 1)
+	assert.Nil(t, interaction.Response[0].Contents.Content)
+	assert.Equal(t, map[string]interface{}{"grpc-status": "NOT_FOUND", "grpc-message": "order 2 not found"},
+		interaction.Response[0].Metadata)
+
+	data, err := json.Marshal(pact)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "\"pactSpecification\":{\"version\":\"4.0\"}")
+	assert.Contains(t, string(data), "\"pluginConfiguration\":{\"protobuf\":{\"service\":\"test.Orders/Get\"}}")
+}
+
+func TestPact_AddJournal(t *testing.T) {
+	stubs := []*Stub{{
+		ID:         "1",
+		FullMethod: "/test.Orders/Get",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: "success", Stream: []JsonString{"{\"id\":\"${request.id}\"}", "{\"id\":0}"}},
+	}}
+	entries := []JournalEntry{
+		{Seq: 1, FullMethod: "/test.Orders/Get", Request: "{\"id\":7}", StubID: "1"},
+		{Seq: 2, FullMethod: "/test.Orders/Get", Request: "{\"id\":7}", StubID: "1"},
+		{Seq: 3, FullMethod: "/test.Orders/Get", Request: "{\"id\":8}"},
+		{Seq: 4, FullMethod: "/test.Orders/Get", Request: "{\"id\":9}", StubID: "deleted"},
+		{Seq: 5, FullMethod: "/test.Orders/Get", Request: "{\"id\":7}", StubID: "1",
+			Metadata: map[string][]string{"tenant": {"acme"}}},
+	}
+	pact := NewPact("web", "orders")
+	pact.AddJournal(entries, stubs)
+	assert.Len(t, pact.Interactions, 2)
+	assert.Equal(t, "call-1", pact.Interactions[0].Key)
+	assert.Equal(t, "call-5", pact.Interactions[1].Key)
+	assert.Equal(t, map[string]interface{}{"tenant": "acme"}, pact.Interactions[1].Request.Metadata)
+	for _, interaction := range pact.Interactions {
+		assert.Len(t, interaction.Response, 2)
+		assert.Equal(t, "{\"id\":7}", string(interaction.Response[0].Contents.Content))
+		assert.Equal(t, "{\"id\":0}", string(interaction.Response[1].Contents.Content))
+	}
+}
@@ -0,0 +1,132 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strconv"
+)
+
+// DefaultPageSize is the number of items of the pages of a PagedResponse when neither the request nor the stub set it
+const DefaultPageSize = 50
+
+// Fields of the requests and responses of the List methods, as named in their JSON
+const (
+	pageSizeField      = "pageSize"
+	pageTokenField     = "pageToken"
+	nextPageTokenField = "nextPageToken"
+)
+
+// PagedResponse serves a list of items across the pages of the calls to a List method, as in
+// https://google.aip.dev/158: the page_size of the request is the maximum number of items returned and the
+// next_page_token of the response is the page_token of the request for the next page, empty in the last page. The
+// other fields of the response are the ones of the content of the stub.
+type PagedResponse struct {
+	// Field is the repeated field of the response with the items of the page, e.g. orders
+	Field string `json:"field"`
+	// Items are the items of all the pages, in order. They can have placeholders (see renderJSON).
+	Items []JsonString `json:"items"`
+	// PageSize is the number of items of the pages when the request has no page size. DefaultPageSize is used when it
+	// is 0.
+	PageSize int `json:"pageSize,omitempty"`
+	// MaxPageSize caps the page size of the requests. There is no limit when it is 0.
+	MaxPageSize int `json:"maxPageSize,omitempty"`
+	// TotalSizeField is the field of the response set to the number of items, e.g. totalSize. It is not set when
+	// empty.
+	TotalSizeField string `json:"totalSizeField,omitempty"`
+}
+
+func (p *PagedResponse) validate() []string {
+	errMsgs := make([]string, 0)
+	if p.Field == "" {
+		errMsgs = append(errMsgs, "Pages field can't be empty.")
+	}
+	if p.PageSize < 0 || p.MaxPageSize < 0 {
+		errMsgs = append(errMsgs, "Pages sizes can't be negative.")
+	}
+	for i, item := range p.Items {
+		object := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(item), &object); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Pages item %d is not a valid JSON object.", i))
+		}
+	}
+	return errMsgs
+}
+
+// page renders the page requested into the content of the response. The requests with an invalid page size or token
+// fail with INVALID_ARGUMENT.
+func (p *PagedResponse) page(data *templateData, content JsonString) (JsonString, error) {
+	size, offset, err := p.requestedPage(data.request)
+	if err != nil {
+		return "", err
+	}
+	response := make(map[string]interface{})
+	if content != "" {
+		decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&response); err != nil {
+			return "", err
+		}
+	}
+	end := offset + size
+	if end > len(p.Items) {
+		end = len(p.Items)
+	}
+	items := make([]json.RawMessage, 0, end-offset)
+	for _, item := range p.Items[offset:end] {
+		rendered, err := data.renderJSON(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, json.RawMessage(rendered))
+	}
+	response[p.Field] = items
+	delete(response, nextPageTokenField)
+	if end < len(p.Items) {
+		response[nextPageTokenField] = pageToken(end)
+	}
+	if p.TotalSizeField != "" {
+		response[p.TotalSizeField] = len(p.Items)
+	}
+	page, err := json.Marshal(response)
+	return JsonString(page), err
+}
+
+// requestedPage returns the size and the offset of the first item of the page requested
+func (p *PagedResponse) requestedPage(request interface{}) (size, offset int, err error) {
+	size = p.PageSize
+	if size == 0 {
+		size = DefaultPageSize
+	}
+	if value := lookupPath(request, []string{pageSizeField}); value != nil {
+		requested, err := strconv.Atoi(formatValue(value))
+		if err != nil || requested < 0 {
+			return 0, 0, status.Errorf(codes.InvalidArgument, "invalid page size %s", formatValue(value))
+		}
+		if requested > 0 {
+			size = requested
+		}
+	}
+	if p.MaxPageSize > 0 && size > p.MaxPageSize {
+		size = p.MaxPageSize
+	}
+	if value := lookupPath(request, []string{pageTokenField}); value != nil && value != "" {
+		token := formatValue(value)
+		decoded, err := base64.RawURLEncoding.DecodeString(token)
+		if err == nil {
+			offset, err = strconv.Atoi(string(decoded))
+		}
+		if err != nil || offset <= 0 || offset > len(p.Items) {
+			return 0, 0, status.Errorf(codes.InvalidArgument, "invalid page token %s", token)
+		}
+	}
+	return size, offset, nil
+}
+
+// pageToken is the opaque token of the page starting at the offset
+func pageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
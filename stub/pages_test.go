@@ -0,0 +1,63 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+func TestGetResponse_Pages(t *testing.T) {
+	s := &Stub{
+		FullMethod: "/acme.Orders/ListOrders",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response: &StubResponse{Type: "success", Content: `{"unreachable":[]}`, Pages: &PagedResponse{
+			Field:          "orders",
+			Items:          []JsonString{`{"id":"1"}`, `{"id":"2"}`, `{"id":"3","parent":"${request.parent}"}`},
+			PageSize:       2,
+			MaxPageSize:    2,
+			TotalSizeField: "totalSize",
+		}},
+	}
+	assert.Empty(t, s.Response.Pages.validate())
+	page := func(request string) (string, error) {
+		resp, err := GetResponse(context.Background(), s, request, new(structpb.Struct))
+		if err != nil {
+			return "", err
+		}
+		json, err := protojson.Marshal(resp.(*structpb.Struct))
+		assert.NoError(t, err)
+		return string(json), nil
+	}
+
+	first, err := page(`{"parent":"shops/1"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"unreachable":[],"orders":[{"id":"1"},{"id":"2"}],"nextPageToken":"Mg","totalSize":3}`, first)
+	last, err := page(`{"parent":"shops/1","pageToken":"Mg","pageSize":5}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"unreachable":[],"orders":[{"id":"3","parent":"shops/1"}],"totalSize":3}`, last)
+	single, err := page(`{"pageSize":1,"pageToken":"MQ"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"unreachable":[],"orders":[{"id":"2"}],"nextPageToken":"Mg","totalSize":3}`, single)
+
+	_, err = page(`{"pageToken":"invalid"}`)
+	assert.EqualError(t, err, "rpc error: code = InvalidArgument desc = invalid page token invalid")
+	_, err = page(`{"pageSize":-1}`)
+	assert.EqualError(t, err, "rpc error: code = InvalidArgument desc = invalid page size -1")
+}
+
+func TestPagedResponse_Validate(t *testing.T) {
+	s := &Stub{
+		FullMethod: "/acme.Orders/ListOrders",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: "success", Pages: &PagedResponse{Items: []JsonString{`[]`}, PageSize: -1}},
+	}
+	valid, errMsgs := s.IsValid()
+	assert.False(t, valid)
+	assert.Equal(t, []string{
+		"Pages field can't be empty.",
+		"Pages sizes can't be negative.",
+		"Pages item 0 is not a valid JSON object.",
+	}, errMsgs)
+}
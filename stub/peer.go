@@ -0,0 +1,88 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"net"
+	"strings"
+)
+
+// PeerMatcher matches the client making the call. All the attributes set must match.
+type PeerMatcher struct {
+	// Addresses are the IPs (e.g. 10.0.0.1) or networks in CIDR notation (e.g. 10.0.0.0/8) the client can call from
+	Addresses []string `json:"addresses,omitempty"`
+	// CommonName is the common name of the client certificate. It requires the clients to authenticate with TLS
+	// certificates.
+	CommonName string `json:"commonName,omitempty"`
+	// UserAgent is a text contained in the user agent of the client, e.g. grpc-java
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+func (p *PeerMatcher) matches(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+	clientPeer, _ := peer.FromContext(ctx)
+	if len(p.Addresses) > 0 && (clientPeer == nil || !p.matchesAddress(clientPeer.Addr)) {
+		return false
+	}
+	if p.CommonName != "" && (clientPeer == nil || getCommonName(clientPeer.AuthInfo) != p.CommonName) {
+		return false
+	}
+	if p.UserAgent != "" && !strings.Contains(getUserAgent(ctx), p.UserAgent) {
+		return false
+	}
+	return true
+}
+
+func (p *PeerMatcher) matchesAddress(addr net.Addr) bool {
+	if addr == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, address := range p.Addresses {
+		if _, network, err := net.ParseCIDR(address); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(address)) {
+			return true
+		}
+	}
+	return false
+}
+
+func getCommonName(authInfo credentials.AuthInfo) string {
+	tlsInfo, ok := authInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 {
+		return ""
+	}
+	return tlsInfo.State.PeerCertificates[0].Subject.CommonName
+}
+
+func getUserAgent(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	return strings.Join(md.Get("user-agent"), " ")
+}
+
+func (p *PeerMatcher) validate() (errMsgs []string) {
+	for _, address := range p.Addresses {
+		if _, _, err := net.ParseCIDR(address); err != nil && net.ParseIP(address) == nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Peer address '%s' is not a valid IP or CIDR.", address))
+		}
+	}
+	return errMsgs
+}
@@ -0,0 +1,92 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// Formats of the contents of the stubs (see Stub.ContentFormat)
+const (
+	ContentFormatJSON = "json"
+	ContentFormatText = "prototext"
+)
+
+// ConvertTextContent converts the contents of a stub in protobuf text format (ContentFormatText) to JSON, so that the
+// stub is matched and stored as the stubs in JSON. The request contents (of the request and the tests) are decoded
+// into the messages returned by newRequest and the response contents (of the response and the stream messages) into
+// the ones returned by newResponse. The stubs in JSON are left as they are.
+func ConvertTextContent(s *Stub, newRequest, newResponse func() proto.Message) error {
+	switch s.ContentFormat {
+	case "", ContentFormatJSON:
+		return nil
+	case ContentFormatText:
+	default:
+		return fmt.Errorf("content format can only be either '%s' or '%s'", ContentFormatJSON, ContentFormatText)
+	}
+	var err error
+	if s.Request != nil {
+		if s.Request.Content, err = textToJSON(s.Request.Content, newRequest, "request.content"); err != nil {
+			return err
+		}
+	}
+	for i := range s.Tests {
+		name := fmt.Sprintf("tests[%d].request", i)
+		if s.Tests[i].Request, err = textToJSON(s.Tests[i].Request, newRequest, name); err != nil {
+			return err
+		}
+	}
+	if s.Response != nil {
+		if s.Response.Content, err = textToJSON(s.Response.Content, newResponse, "response.content"); err != nil {
+			return err
+		}
+		for i, message := range s.Response.Stream {
+			name := fmt.Sprintf("response.stream[%d]", i)
+			if s.Response.Stream[i], err = textToJSON(message, newResponse, name); err != nil {
+				return err
+			}
+		}
+	}
+	s.ContentFormat = ""
+	return nil
+}
+
+// textToJSON converts a content in protobuf text format, which is a JSON string, to the JSON of the message
+func textToJSON(content JsonString, newMessage func() proto.Message, name string) (JsonString, error) {
+	if content == "" {
+		return content, nil
+	}
+	var text string
+	if err := json.Unmarshal([]byte(content), &text); err != nil {
+		return "", fmt.Errorf("%s: the content in protobuf text format must be a string", name)
+	}
+	message := newMessage()
+	if message == nil {
+		return "", fmt.Errorf("%s: the message of the method is unknown", name)
+	}
+	if err := prototext.Unmarshal([]byte(text), message); err != nil {
+		return "", fmt.Errorf("%s: invalid protobuf text format: %w", name, err)
+	}
+	converted, err := marshalJSONMessage(message)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return converted, nil
+}
+
+// marshalJSONMessage returns the compact JSON of the message in the JSON mapping of protobuf
+func marshalJSONMessage(message proto.Message) (JsonString, error) {
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	// protojson adds random white space to its output
+	compact := bytes.NewBuffer(make([]byte, 0, len(data)))
+	if err := json.Compact(compact, data); err != nil {
+		return "", err
+	}
+	return JsonString(compact.String()), nil
+}
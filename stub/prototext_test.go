@@ -0,0 +1,71 @@
+package stub
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"testing"
+)
+
+func TestConvertTextContent(t *testing.T) {
+	s := new(Stub)
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"fullMethod": "/test.Fields/Get",
+		"contentFormat": "prototext",
+		"request": {"match": "exact", "content": "name: \"id\""},
+		"response": {"type": "success", "content": "name: \"id\" number: 1", "stream": ["number: 2"]},
+		"tests": [{"request": "name: \"id\""}]
+	}`), s))
+	newRequest := func() proto.Message { return new(descriptorpb.FieldDescriptorProto) }
+	newResponse := func() proto.Message { return new(descriptorpb.FieldDescriptorProto) }
+
+	assert.NoError(t, ConvertTextContent(s, newRequest, newResponse))
+	assert.Equal(t, "", s.ContentFormat)
+	assert.Equal(t, `{"name":"id"}`, string(s.Request.Content))
+	assert.Equal(t, `{"name":"id","number":1}`, string(s.Response.Content))
+	assert.Equal(t, `{"number":2}`, string(s.Response.Stream[0]))
+	assert.Equal(t, `{"name":"id"}`, string(s.Tests[0].Request))
+	valid, _ := s.IsValid()
+	assert.True(t, valid)
+
+	// The stubs in JSON are left as they are
+	assert.NoError(t, ConvertTextContent(s, newRequest, newResponse))
+	assert.Equal(t, `{"name":"id"}`, string(s.Request.Content))
+
+	s = &Stub{ContentFormat: ContentFormatText, Request: &StubRequest{Content: `"size: 1"`}}
+	err := ConvertTextContent(s, newRequest, newResponse)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "request.content: invalid protobuf text format")
+	assert.Contains(t, err.Error(), "unknown field: size")
+	s = &Stub{ContentFormat: ContentFormatText, Request: &StubRequest{Content: `{"name":"id"}`}}
+	assert.EqualError(t, ConvertTextContent(s, newRequest, newResponse),
+		"request.content: the content in protobuf text format must be a string")
+	s = &Stub{ContentFormat: "yaml"}
+	assert.Error(t, ConvertTextContent(s, newRequest, newResponse))
+}
+
+func TestResolvePayloadFiles_Text(t *testing.T) {
+	s := &Stub{ContentFormat: ContentFormatText, Request: &StubRequest{Content: `{"$file":"id.textproto"}`}}
+	assert.NoError(t, ResolvePayloadFiles(s, map[string][]byte{"id.textproto": []byte("# The id field\nname: \"id\"\n")}))
+	assert.Equal(t, `"# The id field\nname: \"id\"\n"`, string(s.Request.Content))
+}
+
+func TestLint_Text(t *testing.T) {
+	stubs := []*Stub{
+		newLintStub("/test.Orders/Get", "exact", `"id: 1"`, `"id: 1 status: OPEN"`),
+		newLintStub("/test.Orders/Get", "exact", `"id: 1"`, `"id: 2"`),
+		newLintStub("/test.Orders/Get", "exact", `"age: 3"`, `"id: 1"`),
+	}
+	for _, s := range stubs {
+		s.ContentFormat = ContentFormatText
+	}
+	issues := Lint(stubs, newLintFiles(t))
+
+	assert.Equal(t, 2, len(issues))
+	assert.Equal(t, LintIssue{Index: 2, Other: -1, Message: issues[0].Message}, issues[0])
+	assert.Contains(t, issues[0].Message, "request.content: invalid protobuf text format")
+	assert.Equal(t, LintIssue{Index: 1, Other: 0, Message: "Duplicate of stub 0: both match the same requests."}, issues[1])
+	// The stubs linted are not changed
+	assert.Equal(t, ContentFormatText, stubs[0].ContentFormat)
+}
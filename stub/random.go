@@ -0,0 +1,19 @@
+package stub
+
+import "github.com/carvalhorr/protoc-gen-mock/util"
+
+var random = util.NewSeededRandom(0)
+
+// SetRandom sets the generator of the random values of the responses
+func SetRandom(r *util.SeededRandom) {
+	random = r
+}
+
+// Random returns the generator of the random values of the stub: its own sequence when it has a seed, which is the
+// same on every run regardless of the other calls, and the global sequence otherwise
+func (s *Stub) Random() util.Random {
+	if s.Seed != 0 {
+		return random.Keyed(s.ID, s.Seed)
+	}
+	return random
+}
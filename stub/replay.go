@@ -0,0 +1,197 @@
+package stub
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metadata that describes the call itself and is set again by the client replaying it
+var transportMetadata = map[string]bool{
+	":authority":   true,
+	"content-type": true,
+	"user-agent":   true,
+	"te":           true,
+}
+
+// ReplayScript is a sequence of calls to fire against a service, e.g. the calls recorded in the journal
+type ReplayScript struct {
+	Calls []ReplayCall `json:"calls"`
+}
+
+// ReplayCall is a call of a replay script
+type ReplayCall struct {
+	FullMethod string              `json:"fullMethod"`
+	Request    JsonString          `json:"request"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	// OffsetMs is the time since the first call of the script, in milliseconds, to replay the calls at their
+	// original pace
+	OffsetMs int64 `json:"offsetMs"`
+}
+
+// JournalFilter selects entries of the journal
+type JournalFilter struct {
+	// Methods are the methods (full method or only the name) selected. All are selected when empty.
+	Methods []string
+	// FromSeq and ToSeq are the first and last entries selected. There is no limit when 0.
+	FromSeq int64
+	ToSeq   int64
+	// Queries select the entries whose request satisfies all of them
+	Queries []*JSONPathQuery
+	// Since selects the entries recorded at or after it. There is no limit when zero.
+	Since time.Time
+}
+
+// Matches checks if the entry is selected by the filter
+func (f JournalFilter) Matches(entry JournalEntry) bool {
+	if (f.FromSeq > 0 && entry.Seq < f.FromSeq) || (f.ToSeq > 0 && entry.Seq > f.ToSeq) {
+		return false
+	}
+	if entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	for _, query := range f.Queries {
+		if !query.Matches(entry.Request) {
+			return false
+		}
+	}
+	if len(f.Methods) == 0 {
+		return true
+	}
+	for _, method := range f.Methods {
+		if MethodMatches(entry.FullMethod, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the entries selected by the filter
+func (f JournalFilter) Select(entries []JournalEntry) []JournalEntry {
+	selected := make([]JournalEntry, 0, len(entries))
+	for _, entry := range entries {
+		if f.Matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
+
+// NewReplayScript creates the script replaying the entries of the journal selected by the filter, in the order they
+// were received
+func NewReplayScript(entries []JournalEntry, filter JournalFilter) *ReplayScript {
+	script := &ReplayScript{Calls: make([]ReplayCall, 0, len(entries))}
+	var first time.Time
+	for _, entry := range entries {
+		if !filter.Matches(entry) {
+			continue
+		}
+		if len(script.Calls) == 0 {
+			first = entry.Timestamp
+		}
+		call := ReplayCall{
+			FullMethod: entry.FullMethod,
+			Request:    entry.Request,
+			OffsetMs:   entry.Timestamp.Sub(first).Milliseconds(),
+		}
+		for name, values := range entry.Metadata {
+			if transportMetadata[name] {
+				continue
+			}
+			if call.Metadata == nil {
+				call.Metadata = make(map[string][]string)
+			}
+			call.Metadata[name] = values
+		}
+		script.Calls = append(script.Calls, call)
+	}
+	return script
+}
+
+// GRPCurl renders the script as a shell script with a grpcurl command per call. The service must have server
+// reflection enabled, or the proto files must be added to the commands with -proto.
+func (s *ReplayScript) GRPCurl(target string, plaintext bool) string {
+	lines := []string{"#!/bin/sh", "set -e"}
+	for _, call := range s.Calls {
+		args := []string{"grpcurl"}
+		if plaintext {
+			args = append(args, "-plaintext")
+		}
+		for _, name := range sortedMetadataNames(call.Metadata) {
+			for _, value := range call.Metadata[name] {
+				args = append(args, "-H", shellQuote(name+": "+value))
+			}
+		}
+		args = append(args, "-d", shellQuote(requestJSON(call.Request)), shellQuote(target),
+			shellQuote(strings.TrimPrefix(call.FullMethod, "/")))
+		lines = append(lines, strings.Join(args, " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// GHZConfig is the config of a ghz (https://ghz.sh) run
+type GHZConfig struct {
+	Call     string       `json:"call"`
+	Host     string       `json:"host"`
+	Insecure bool         `json:"insecure,omitempty"`
+	Total    int          `json:"total"`
+	Data     []JsonString `json:"data"`
+	// Metadata has the metadata of each message in Data
+	Metadata []map[string]string `json:"metadata,omitempty"`
+}
+
+// GHZ renders the script as ghz configs, one per method as ghz calls a single method in each run. ghz sends the
+// messages of the calls to the method in a round-robin, once each.
+func (s *ReplayScript) GHZ(target string, insecure bool) []GHZConfig {
+	configs := make([]GHZConfig, 0)
+	byMethod := make(map[string]int)
+	hasMetadata := make(map[string]bool)
+	for _, call := range s.Calls {
+		i, ok := byMethod[call.FullMethod]
+		if !ok {
+			i = len(configs)
+			byMethod[call.FullMethod] = i
+			configs = append(configs, GHZConfig{
+				Call:     strings.Replace(strings.TrimPrefix(call.FullMethod, "/"), "/", ".", 1),
+				Host:     target,
+				Insecure: insecure,
+				Data:     make([]JsonString, 0),
+			})
+		}
+		metadata := make(map[string]string, len(call.Metadata))
+		for name, values := range call.Metadata {
+			metadata[name] = strings.Join(values, ",")
+		}
+		hasMetadata[call.FullMethod] = hasMetadata[call.FullMethod] || len(metadata) > 0
+		configs[i].Total++
+		configs[i].Data = append(configs[i].Data, JsonString(requestJSON(call.Request)))
+		configs[i].Metadata = append(configs[i].Metadata, metadata)
+	}
+	for method, i := range byMethod {
+		if !hasMetadata[method] {
+			configs[i].Metadata = nil
+		}
+	}
+	return configs
+}
+
+func requestJSON(request JsonString) string {
+	if request == "" {
+		return "{}"
+	}
+	return string(request)
+}
+
+func sortedMetadataNames(metadata map[string][]string) []string {
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// shellQuote quotes the value for a POSIX shell
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
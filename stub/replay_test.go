@@ -0,0 +1,49 @@
+package stub
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newReplayTestEntries() []JournalEntry {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	return []JournalEntry{
+		{Seq: 1, Timestamp: start, FullMethod: "/test.Payments/Reserve", Request: JsonString(`{"amount":10}`),
+			Metadata: map[string][]string{"content-type": {"application/grpc"}, "x-tenant": {"acme"}}},
+		{Seq: 2, Timestamp: start.Add(150 * time.Millisecond), FullMethod: "/test.Payments/Lookup", Request: JsonString(`{}`)},
+		{Seq: 3, Timestamp: start.Add(time.Second), FullMethod: "/test.Payments/Reserve", Request: JsonString(`{"note":"it's"}`)},
+	}
+}
+
+func TestNewReplayScript(t *testing.T) {
+	script := NewReplayScript(newReplayTestEntries(), JournalFilter{})
+	assert.Len(t, script.Calls, 3)
+	assert.Equal(t, map[string][]string{"x-tenant": {"acme"}}, script.Calls[0].Metadata)
+	assert.Equal(t, int64(150), script.Calls[1].OffsetMs)
+
+	script = NewReplayScript(newReplayTestEntries(), JournalFilter{Methods: []string{"Reserve"}, FromSeq: 2})
+	assert.Len(t, script.Calls, 1)
+	assert.Equal(t, int64(0), script.Calls[0].OffsetMs)
+	assert.Equal(t, JsonString(`{"note":"it's"}`), script.Calls[0].Request)
+}
+
+func TestReplayScript_GRPCurl(t *testing.T) {
+	script := NewReplayScript(newReplayTestEntries(), JournalFilter{Methods: []string{"Reserve"}})
+	expected := "#!/bin/sh\nset -e\n" +
+		"grpcurl -plaintext -H 'x-tenant: acme' -d '{\"amount\":10}' 'localhost:9000' 'test.Payments/Reserve'\n" +
+		"grpcurl -plaintext -d '{\"note\":\"it'\\''s\"}' 'localhost:9000' 'test.Payments/Reserve'\n"
+	assert.Equal(t, expected, script.GRPCurl("localhost:9000", true))
+}
+
+func TestReplayScript_GHZ(t *testing.T) {
+	configs := NewReplayScript(newReplayTestEntries(), JournalFilter{}).GHZ("localhost:9000", false)
+	data, err := json.Marshal(configs)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"call": "test.Payments.Reserve", "host": "localhost:9000", "total": 2, "data": [{"amount":10}, {"note":"it's"}],
+		 "metadata": [{"x-tenant": "acme"}, {}]},
+		{"call": "test.Payments.Lookup", "host": "localhost:9000", "total": 1, "data": [{}]}
+	]`, string(data))
+}
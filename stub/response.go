@@ -1,16 +1,21 @@
 package stub
 
 import (
+	"context"
 	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
 	"github.com/golang/protobuf/jsonpb"
 	githubproto "github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	protojson22 "google.golang.org/protobuf/encoding/protojson"
 	proto22 "google.golang.org/protobuf/proto"
 	protoreflect22 "google.golang.org/protobuf/reflect/protoreflect"
 	"strings"
+	"time"
 )
 
 var errorEngine CustomErrorEngine
@@ -19,27 +24,91 @@ func SetErrorEngine(engine CustomErrorEngine) {
 	errorEngine = engine
 }
 
-func GetResponse(stub *Stub, requestJson string, resp interface{}) (interface{}, error) {
+func GetResponse(ctx context.Context, stub *Stub, requestJson string, resp interface{}) (interface{}, error) {
 	if stub == nil {
 		return nil, nil
 	}
+	data := newTemplateData(ctx, stub, requestJson)
 	if stub.Response.Type == "error" {
-		return createErrorResponse(errorEngine, stub.Response.Error)
+		return createErrorResponse(errorEngine, stub.Response.Error, data)
 	}
-	resp, transformErr := jsonToResponse(stub.Response.Content.String(), resp)
+	var content JsonString
+	var renderErr error
+	if stub.Response.Operation != nil {
+		content, renderErr = operations.start(stub.Response.Operation, data)
+	} else {
+		content, renderErr = data.renderJSON(stub.Response.Content)
+	}
+	if renderErr == nil && stub.Response.Pages != nil {
+		content, renderErr = stub.Response.Pages.page(data, content)
+		if _, isStatus := status.FromError(renderErr); renderErr != nil && isStatus {
+			// An invalid page size or token
+			return nil, renderErr
+		}
+	}
+	if renderErr != nil {
+		logRenderError(stub, requestJson, renderErr)
+		return nil, fmt.Errorf("could not render response")
+	}
+	resp, transformErr := jsonToResponse(content.String(), resp)
 	if transformErr != nil {
 		log.WithFields(log.Fields{"Error": transformErr.Error()}).
-			Errorf("Error handling request %s --> %s", stub.FullMethod, requestJson)
+			Errorf("Error handling request %s --> %s", stub.FullMethod, util.LoggablePayload(requestJson))
 
 		return nil, fmt.Errorf("could not unmarshal response")
 	}
-	log.WithFields(log.Fields{"response": resp}).
-		Infof("Found MOCK response for %s --> %s", stub.FullMethod, requestJson)
+	log.WithFields(log.Fields{"response": util.LoggablePayload(content.String())}).
+		Infof("Found MOCK response for %s --> %s", stub.FullMethod, util.LoggablePayload(requestJson))
 	return resp, nil
 }
 
-func createErrorResponse(errorEngine CustomErrorEngine, stubError *ErrorResponse) (interface{}, error) {
-	st := status.New(codes.Code(uint32(stubError.Code)), stubError.Message)
+func logRenderError(stub *Stub, requestJson string, err error) {
+	log.WithFields(log.Fields{"Error": err.Error()}).
+		Errorf("Error rendering response for request %s --> %s", stub.FullMethod, util.LoggablePayload(requestJson))
+}
+
+// GetStreamResponse creates the messages sent by a streaming method and the error that terminates the stream, if any.
+// The messages are the ones in the stream of the stub response or its content when there is no stream, with the stream
+// faults applied.
+func GetStreamResponse(ctx context.Context, stub *Stub, requestJson string, newResponse func() interface{}) ([]interface{}, error) {
+	contents := stub.Response.Stream
+	if len(contents) == 0 && stub.Response.Type != "error" {
+		contents = []JsonString{stub.Response.Content}
+	}
+	data := newTemplateData(ctx, stub, requestJson)
+	messages := make([]interface{}, 0, len(contents))
+	for _, content := range contents {
+		content, renderErr := data.renderJSON(content)
+		if renderErr != nil {
+			logRenderError(stub, requestJson, renderErr)
+			return nil, fmt.Errorf("could not render response")
+		}
+		message, transformErr := jsonToResponse(content.String(), newResponse())
+		if transformErr != nil {
+			log.WithFields(log.Fields{"Error": transformErr.Error()}).
+				Errorf("Error handling request %s --> %s", stub.FullMethod, util.LoggablePayload(requestJson))
+			return nil, fmt.Errorf("could not unmarshal response")
+		}
+		messages = append(messages, message)
+	}
+	messages = stub.Response.StreamFaults.apply(messages)
+	log.WithFields(log.Fields{"messages": len(messages)}).
+		Infof("Found MOCK stream response for %s --> %s", stub.FullMethod, util.LoggablePayload(requestJson))
+	if stub.Response.Type == "error" {
+		_, err := createErrorResponse(errorEngine, stub.Response.Error, data)
+		return messages, err
+	}
+	return messages, nil
+}
+
+func createErrorResponse(errorEngine CustomErrorEngine, stubError *ErrorResponse, data *templateData) (interface{}, error) {
+	message, err := data.renderText(stubError.Message)
+	if err != nil {
+		log.Errorf("Rendering of error message failed: %s", err.Error())
+		return nil, status.New(codes.Internal, "Rendering of error message failed").Err()
+	}
+	st := status.New(stubError.Code.GRPCCode(), message)
+	detailsMessages := make([]githubproto.Message, 0)
 	if stubError.Details != nil {
 		log.Debugf("Creating instance of base error from spec /%s/%s", stubError.Details.Spec.Import, stubError.Details.Spec.Type)
 		baseErrorType, err := errorEngine.GetNewInstance(stubError.Details.Spec)
@@ -47,7 +116,6 @@ func createErrorResponse(errorEngine CustomErrorEngine, stubError *ErrorResponse
 			log.Errorf("Expansion of error response failed: %s", err.Error())
 			return nil, status.New(codes.Internal, "Expansion of error response failed").Err()
 		}
-		detailsMessages := make([]githubproto.Message, 0)
 		for _, errDetailValue := range stubError.Details.Values {
 			errorType := baseErrorType
 			if errDetailValue.SpecOverride != nil && errDetailValue.SpecOverride.Import != "" {
@@ -58,14 +126,25 @@ func createErrorResponse(errorEngine CustomErrorEngine, stubError *ErrorResponse
 					return nil, status.New(codes.Internal, "Expansion of error response failed").Err()
 				}
 			}
-			log.Debugf("Loading JSON into error: %s", errDetailValue.Value.String())
-			detailMessage, err := jsonToResponse(errDetailValue.Value.String(), errorType)
+			value, err := data.renderJSON(errDetailValue.Value)
+			if err != nil {
+				log.Errorf("Expansion of error response failed: %s", err.Error())
+				return nil, status.New(codes.Internal, "Expansion of error response failed").Err()
+			}
+			log.Debugf("Loading JSON into error: %s", util.LoggablePayload(value.String()))
+			detailMessage, err := jsonToResponse(value.String(), errorType)
 			if err != nil {
 				log.Errorf("Expansion of error response failed: %s", err.Error())
 				return nil, status.New(codes.Internal, "Expansion of error response failed").Err()
 			}
 			detailsMessages = append(detailsMessages, detailMessage.(githubproto.Message))
 		}
+	}
+	if stubError.RetryDelay != "" {
+		delay, _ := time.ParseDuration(stubError.RetryDelay)
+		detailsMessages = append(detailsMessages, &errdetails.RetryInfo{RetryDelay: ptypes.DurationProto(delay)})
+	}
+	if len(detailsMessages) > 0 {
 		st, err = st.WithDetails(detailsMessages...)
 		if err != nil {
 			log.Errorf("Error creating error details: %s", err.Error())
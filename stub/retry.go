@@ -0,0 +1,101 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"strconv"
+	"time"
+)
+
+// retryScenarioPrefix is the prefix of the scenarios that count the failed attempts of the stubs with FailThenSucceed
+const retryScenarioPrefix = "failThenSucceed:"
+
+// FailThenSucceed makes the first calls matched by the stub fail with a retryable error, so that the retry policies of
+// the clients can be tested without a sequence of stubs. The calls after the failures get the response of the stub.
+// The failed attempts are counted in a scenario named failThenSucceed:<stub ID>, so moving it back to
+// ScenarioStateStarted starts the failures again.
+type FailThenSucceed struct {
+	// Failures is the number of calls that fail
+	Failures int `json:"failures"`
+	// Code is the status code of the failures, UNAVAILABLE when not set
+	Code StatusCode `json:"code,omitempty"`
+	// Message is the message of the failures. It can have placeholders (see renderText).
+	Message string `json:"message,omitempty"`
+	// RetryDelay is sent in a google.rpc.RetryInfo detail of the failures, e.g. 1s
+	RetryDelay string `json:"retryDelay,omitempty"`
+}
+
+func (f *FailThenSucceed) validate() []string {
+	errMsgs := make([]string, 0)
+	if f.Failures <= 0 {
+		errMsgs = append(errMsgs, "FailThenSucceed failures must be greater than 0.")
+	}
+	if !f.Code.isKnown() {
+		errMsgs = append(errMsgs, fmt.Sprintf("FailThenSucceed code %s is not a gRPC status code.", f.Code))
+	}
+	if f.RetryDelay != "" && !isValidRetryDelay(f.RetryDelay) {
+		errMsgs = append(errMsgs, fmt.Sprintf("FailThenSucceed retryDelay '%s' is not a valid duration.", f.RetryDelay))
+	}
+	return errMsgs
+}
+
+// errorResponse is the error of the failed attempts
+func (f *FailThenSucceed) errorResponse(attempt int) *ErrorResponse {
+	failure := &ErrorResponse{Code: f.Code, Message: f.Message, RetryDelay: f.RetryDelay}
+	if failure.Code == 0 {
+		failure.Code = StatusCode(codes.Unavailable)
+	}
+	if failure.Message == "" {
+		failure.Message = fmt.Sprintf("attempt %d of %d failed, please retry", attempt, f.Failures+1)
+	}
+	return failure
+}
+
+// failThenSucceed returns the stub with an error response while the stub has failures left, and the stub itself
+// otherwise. The attempt is not counted when the state is read-only.
+func (m *stubsMatcher) failThenSucceed(ctx context.Context, stub *Stub) *Stub {
+	retry := stub.Response.FailThenSucceed
+	if retry == nil {
+		return stub
+	}
+	var attempt int
+	if isStateReadOnly(ctx) {
+		failed, _ := strconv.Atoi(m.Scenarios.GetState(retryScenarioPrefix + stub.ID))
+		attempt = failed + 1
+	} else {
+		attempt = m.nextAttempt(retryScenarioPrefix+stub.ID, retry.Failures)
+	}
+	if attempt > retry.Failures {
+		return stub
+	}
+	failed := *stub
+	failed.Response = &StubResponse{
+		Type:         "error",
+		Error:        retry.errorResponse(attempt),
+		TrailersOnly: stub.Response.TrailersOnly,
+		Headers:      stub.Response.Headers,
+		Trailers:     stub.Response.Trailers,
+	}
+	return &failed
+}
+
+// nextAttempt counts an attempt in the scenario, whose state is the number of failed attempts, and returns its
+// number. The count stops once the failures are over.
+func (m *stubsMatcher) nextAttempt(scenario string, failures int) int {
+	for {
+		state := m.Scenarios.GetState(scenario)
+		failed, _ := strconv.Atoi(state)
+		if failed >= failures {
+			return failed + 1
+		}
+		if m.Scenarios.Transition(scenario, state, strconv.Itoa(failed+1)) {
+			return failed + 1
+		}
+	}
+}
+
+func isValidRetryDelay(delay string) bool {
+	d, err := time.ParseDuration(delay)
+	return err == nil && d >= 0
+}
@@ -0,0 +1,49 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestStubsMatcher_Match_FailThenSucceed(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.Response.FailThenSucceed = &FailThenSucceed{Failures: 2, RetryDelay: "1s"}
+	assert.NoError(t, store.Add(context.Background(), s))
+	scenarios := NewInMemoryScenariosStore()
+	matcher := NewStubsMatcher(store, WithScenarios(scenarios))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		failed := matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}")
+		assert.Equal(t, s.ID, failed.ID)
+		_, err := GetResponse(context.Background(), failed, "{\"name\":\"John\"}", nil)
+		st := status.Convert(err)
+		assert.Equal(t, codes.Unavailable, st.Code())
+		assert.Equal(t, fmt.Sprintf("attempt %d of 3 failed, please retry", attempt), st.Message())
+		assert.Len(t, st.Details(), 1)
+		retryInfo := st.Details()[0].(*errdetails.RetryInfo)
+		delay, _ := ptypes.Duration(retryInfo.RetryDelay)
+		assert.Equal(t, time.Second, delay)
+	}
+	assert.Equal(t, s, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, s, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+
+	scenarios.Reset()
+	assert.Equal(t, "error", matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}").Response.Type)
+}
+
+func TestFailThenSucceed_Validate(t *testing.T) {
+	retry := &FailThenSucceed{Code: 20, RetryDelay: "later"}
+	assert.Equal(t, []string{
+		"FailThenSucceed failures must be greater than 0.",
+		"FailThenSucceed code 20 is not a gRPC status code.",
+		"FailThenSucceed retryDelay 'later' is not a valid duration.",
+	}, retry.validate())
+}
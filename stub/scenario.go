@@ -0,0 +1,139 @@
+package stub
+
+import (
+	"sort"
+	"sync"
+)
+
+// ScenarioStateStarted is the state of every scenario until it is changed
+const ScenarioStateStarted = "Started"
+
+// StubScenario makes a stub part of a stateful scenario. The stub only matches when the scenario is in RequiredState
+// (any state when empty) and, once matched, moves the scenario to NewState (when not empty).
+type StubScenario struct {
+	Name          string `json:"name"`
+	RequiredState string `json:"requiredState,omitempty"`
+	NewState      string `json:"newState,omitempty"`
+}
+
+// Scenario describes the current state of a scenario and the states referenced by its stubs
+type Scenario struct {
+	Name   string   `json:"name"`
+	State  string   `json:"state"`
+	States []string `json:"states,omitempty"`
+}
+
+// ScenariosStore keeps the current state of the scenarios. Implementations must be safe for concurrent use.
+type ScenariosStore interface {
+	// GetState returns the current state of the scenario, ScenarioStateStarted if it was never changed
+	GetState(name string) string
+	SetState(name, state string)
+	// Transition atomically moves the scenario to the state to if it is in the state from
+	Transition(name, from, to string) bool
+	// GetAllStates returns the states of the scenarios that were changed
+	GetAllStates() map[string]string
+	// Reset moves all the scenarios back to ScenarioStateStarted
+	Reset()
+}
+
+func NewInMemoryScenariosStore() ScenariosStore {
+	return &inMemoryScenariosStore{
+		states: make(map[string]string, 0),
+	}
+}
+
+type inMemoryScenariosStore struct {
+	states map[string]string
+	mutex  sync.RWMutex
+}
+
+func (s *inMemoryScenariosStore) GetState(name string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.getState(name)
+}
+
+func (s *inMemoryScenariosStore) getState(name string) string {
+	if state, ok := s.states[name]; ok {
+		return state
+	}
+	return ScenarioStateStarted
+}
+
+func (s *inMemoryScenariosStore) SetState(name, state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.states[name] = state
+}
+
+func (s *inMemoryScenariosStore) Transition(name, from, to string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getState(name) != from {
+		return false
+	}
+	s.states[name] = to
+	return true
+}
+
+func (s *inMemoryScenariosStore) GetAllStates() map[string]string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	states := make(map[string]string, len(s.states))
+	for name, state := range s.states {
+		states[name] = state
+	}
+	return states
+}
+
+func (s *inMemoryScenariosStore) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.states = make(map[string]string, 0)
+}
+
+// GetScenarios lists the scenarios referenced by the stubs or whose state was changed, sorted by name
+func GetScenarios(stubs []*Stub, scenarios ScenariosStore) []*Scenario {
+	states := make(map[string]map[string]bool, 0)
+	addState := func(name, state string) {
+		if _, ok := states[name]; !ok {
+			states[name] = map[string]bool{ScenarioStateStarted: true}
+		}
+		if state != "" {
+			states[name][state] = true
+		}
+	}
+	for _, e := range stubs {
+		if e.Scenario == nil {
+			continue
+		}
+		addState(e.Scenario.Name, e.Scenario.RequiredState)
+		addState(e.Scenario.Name, e.Scenario.NewState)
+	}
+	for name, state := range scenarios.GetAllStates() {
+		addState(name, state)
+	}
+
+	result := make([]*Scenario, 0, len(states))
+	for name, scenarioStates := range states {
+		scenario := &Scenario{
+			Name:   name,
+			State:  scenarios.GetState(name),
+			States: make([]string, 0, len(scenarioStates)),
+		}
+		for state := range scenarioStates {
+			scenario.States = append(scenario.States, state)
+		}
+		sort.Strings(scenario.States)
+		result = append(result, scenario)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,31 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestInMemoryScenariosStore_Transition(t *testing.T) {
+	scenarios := NewInMemoryScenariosStore()
+	assert.Equal(t, ScenarioStateStarted, scenarios.GetState("checkout"))
+
+	assert.True(t, scenarios.Transition("checkout", ScenarioStateStarted, "paid"))
+	assert.False(t, scenarios.Transition("checkout", ScenarioStateStarted, "cancelled"))
+	assert.Equal(t, "paid", scenarios.GetState("checkout"))
+
+	scenarios.Reset()
+	assert.Equal(t, ScenarioStateStarted, scenarios.GetState("checkout"))
+}
+
+func TestGetScenarios(t *testing.T) {
+	s := newTestStub("method1", "{}")
+	s.Scenario = &StubScenario{Name: "checkout", RequiredState: "cart", NewState: "paid"}
+	scenarios := NewInMemoryScenariosStore()
+	scenarios.SetState("login", "logged in")
+
+	result := GetScenarios([]*Stub{s, newTestStub("method2", "{}")}, scenarios)
+	assert.Equal(t, []*Scenario{
+		{Name: "checkout", State: ScenarioStateStarted, States: []string{ScenarioStateStarted, "cart", "paid"}},
+		{Name: "login", State: "logged in", States: []string{ScenarioStateStarted, "logged in"}},
+	}, result)
+}
@@ -0,0 +1,296 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponseTypeScript is the type of the responses produced by a Lua script (see RunScript)
+const ResponseTypeScript = "script"
+
+// Libraries available to the scripts. The ones that access the file system or the OS are not available.
+var scriptLibs = []struct {
+	name string
+	open lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// scriptResult is the table returned by a script
+type scriptResult struct {
+	Content JsonString     `json:"content"`
+	Stream  []JsonString   `json:"stream"`
+	Error   *ErrorResponse `json:"error"`
+	Delay   string         `json:"delay"`
+}
+
+// RunScript runs the Lua script of a stub with the response type script and returns a copy of the stub with the
+// response it produced, after waiting for the delay it returned. The script has the globals request (the request
+// message), metadata (the incoming metadata, each key with a list of values), capture (the values captured from the
+// request), method and state (see setScriptState), and returns a table with content or stream (the response
+// messages) or error ({code, message}), and optionally a delay (e.g. "100ms").
+func RunScript(ctx context.Context, s *Stub, requestJson string) (*Stub, error) {
+	if s == nil || s.Response.Type != ResponseTypeScript {
+		return s, nil
+	}
+	result, err := runScript(ctx, s, requestJson)
+	if err != nil {
+		log.WithFields(log.Fields{"Error": err.Error()}).
+			Errorf("Error running the response script for request %s --> %s", s.FullMethod, util.LoggablePayload(requestJson))
+		return nil, fmt.Errorf("could not run the response script")
+	}
+	scripted := *s
+	scripted.Response = &StubResponse{
+		Type:         "success",
+		Content:      result.Content,
+		Stream:       result.Stream,
+		Pacing:       s.Response.Pacing,
+		StreamFaults: s.Response.StreamFaults,
+		FrameFault:   s.Response.FrameFault,
+		Error:        result.Error,
+		TrailersOnly: s.Response.TrailersOnly,
+		Headers:      s.Response.Headers,
+		Trailers:     s.Response.Trailers,
+	}
+	if result.Error != nil {
+		scripted.Response.Type = "error"
+	}
+	if delay, _ := time.ParseDuration(result.Delay); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return &scripted, nil
+}
+
+// DefaultScriptTimeout is how long the scripts can run unless another timeout is set with SetScriptTimeout
+const DefaultScriptTimeout = time.Second
+
+var scriptTimeout = struct {
+	sync.RWMutex
+	timeout time.Duration
+}{timeout: DefaultScriptTimeout}
+
+// SetScriptTimeout sets how long the scripts can run before they are stopped and the calls fail, e.g. because of an
+// endless loop. DefaultScriptTimeout is used when timeout is 0.
+func SetScriptTimeout(timeout time.Duration) {
+	scriptTimeout.Lock()
+	defer scriptTimeout.Unlock()
+
+	if timeout <= 0 {
+		timeout = DefaultScriptTimeout
+	}
+	scriptTimeout.timeout = timeout
+}
+
+func getScriptTimeout() time.Duration {
+	scriptTimeout.RLock()
+	defer scriptTimeout.RUnlock()
+
+	return scriptTimeout.timeout
+}
+
+func runScript(ctx context.Context, s *Stub, requestJson string) (*scriptResult, error) {
+	L := newScriptState()
+	defer L.Close()
+	ctx, cancel := context.WithTimeout(ctx, getScriptTimeout())
+	defer cancel()
+	L.SetContext(ctx)
+
+	var request interface{}
+	if err := json.Unmarshal([]byte(requestJson), &request); err != nil {
+		return nil, err
+	}
+	L.SetGlobal("request", toLuaValue(L, request))
+	L.SetGlobal("metadata", toLuaValue(L, incomingMetadata(ctx)))
+	captures, _ := s.Request.Capture.values(request)
+	L.SetGlobal("capture", toLuaValue(L, captures))
+	L.SetGlobal("method", lua.LString(s.FullMethod))
+	setScriptRandom(L, s.Random())
+	setScriptState(L, stateScope(ctx, s), isStateReadOnly(ctx))
+
+	if err := L.DoString(s.Response.Script); err != nil {
+		return nil, err
+	}
+	returned := L.Get(-1)
+	if returned.Type() != lua.LTTable {
+		return nil, fmt.Errorf("the script must return a table, got %s", returned.Type())
+	}
+	data, err := json.Marshal(fromLuaValue(returned))
+	if err != nil {
+		return nil, err
+	}
+	result := new(scriptResult)
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("invalid table returned by the script: %w", err)
+	}
+	if result.Content == "" && len(result.Stream) == 0 && result.Error == nil {
+		return nil, fmt.Errorf("the script must return content, stream or error")
+	}
+	if _, err := time.ParseDuration(result.Delay); result.Delay != "" && err != nil {
+		return nil, fmt.Errorf("invalid delay returned by the script: %s", result.Delay)
+	}
+	return result, nil
+}
+
+func newScriptState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range scriptLibs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+	return L
+}
+
+// setScriptRandom replaces the functions of the math library that use the global generator of Go with the
+// generator of the stub, so that the scripts are reproducible with a seed
+func setScriptRandom(L *lua.LState, r util.Random) {
+	math := L.GetGlobal(lua.MathLibName).(*lua.LTable)
+	math.RawSetString("random", L.NewFunction(func(L *lua.LState) int {
+		switch L.GetTop() {
+		case 0:
+			L.Push(lua.LNumber(r.Float64()))
+		case 1:
+			max := L.CheckInt(1)
+			if max < 1 {
+				L.ArgError(1, "interval is empty")
+			}
+			L.Push(lua.LNumber(r.Intn(max) + 1))
+		default:
+			min, max := L.CheckInt(1), L.CheckInt(2)
+			if max < min {
+				L.ArgError(2, "interval is empty")
+			}
+			L.Push(lua.LNumber(r.Intn(max-min+1) + min))
+		}
+		return 1
+	}))
+	// The seeds are set in the configuration and the stubs
+	math.RawSetString("randomseed", L.NewFunction(func(L *lua.LState) int { return 0 }))
+}
+
+// setScriptState adds the table state with the functions get(key), set(key, value) and incr(key[, delta]) to access
+// the values of the scope of the state
+func setScriptState(L *lua.LState, scope string, readOnly bool) {
+	table := L.NewTable()
+	table.RawSetString("get", L.NewFunction(func(L *lua.LState) int {
+		L.Push(toLuaValue(L, state.Get(scope, L.CheckString(1))))
+		return 1
+	}))
+	table.RawSetString("set", L.NewFunction(func(L *lua.LState) int {
+		key, value := L.CheckString(1), L.Get(2)
+		if !readOnly {
+			state.Set(scope, key, fromLuaValue(value))
+		}
+		L.Push(value)
+		return 1
+	}))
+	table.RawSetString("incr", L.NewFunction(func(L *lua.LState) int {
+		key, delta := L.CheckString(1), float64(L.OptNumber(2, 1))
+		if readOnly {
+			number, _ := toExprNumber(state.Get(scope, key))
+			L.Push(lua.LNumber(number + delta))
+			return 1
+		}
+		number, err := state.Incr(scope, key, delta)
+		if err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		L.Push(lua.LNumber(number))
+		return 1
+	}))
+	L.SetGlobal("state", table)
+}
+
+// toLuaValue converts a value decoded from JSON into a Lua value. Objects and arrays become tables.
+func toLuaValue(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		table := L.NewTable()
+		for _, e := range v {
+			table.Append(toLuaValue(L, e))
+		}
+		return table
+	case map[string]interface{}:
+		table := L.NewTable()
+		for key, e := range v {
+			table.RawSetString(key, toLuaValue(L, e))
+		}
+		return table
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// fromLuaValue converts a Lua value into a value that can be encoded as JSON. The tables with only the keys 1..n are
+// converted into arrays and the other ones (including the empty tables) into objects.
+func fromLuaValue(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == v.Len() && countKeys(v) == n {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, fromLuaValue(v.RawGetInt(i)))
+			}
+			return list
+		}
+		object := make(map[string]interface{}, 0)
+		v.ForEach(func(key lua.LValue, e lua.LValue) {
+			object[key.String()] = fromLuaValue(e)
+		})
+		return object
+	default:
+		return nil
+	}
+}
+
+func countKeys(table *lua.LTable) int {
+	count := 0
+	table.ForEach(func(lua.LValue, lua.LValue) {
+		count++
+	})
+	return count
+}
+
+// validateScript checks the syntax of the script
+func validateScript(script string) (errMsgs []string) {
+	if strings.TrimSpace(script) == "" {
+		return []string{"Response script is mandatory when the response type is 'script'."}
+	}
+	if _, err := parse.Parse(strings.NewReader(script), "script"); err != nil {
+		errMsgs = append(errMsgs, fmt.Sprintf("Response script is not valid: %s", err.Error()))
+	}
+	return errMsgs
+}
@@ -0,0 +1,106 @@
+package stub
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+	"time"
+)
+
+func newScriptStub(script string) *Stub {
+	return &Stub{
+		FullMethod: "/test.Service/Method",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: ResponseTypeScript, Script: script},
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	s := newScriptStub(`
+local total = 0
+for _, item in ipairs(request.items) do
+  total = total + item.price
+end
+return {content = {total = total, tenant = metadata["x-tenant"][1], method = method}}`)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+
+	scripted, err := RunScript(ctx, s, "{\"items\":[{\"price\":10},{\"price\":2.5}]}")
+	assert.NoError(t, err)
+	assert.Equal(t, "success", scripted.Response.Type)
+	assert.JSONEq(t, "{\"total\":12.5,\"tenant\":\"acme\",\"method\":\"/test.Service/Method\"}", scripted.Response.Content.String())
+	assert.Equal(t, ResponseTypeScript, s.Response.Type)
+}
+
+func TestRunScript_ErrorAndDelay(t *testing.T) {
+	s := newScriptStub(`
+if request.id > 100 then
+  return {error = {code = 5, message = "order " .. request.id .. " not found"}, delay = "50ms"}
+end
+return {stream = {{id = request.id}, {id = request.id + 1}}}`)
+
+	start := time.Now()
+	scripted, err := RunScript(context.Background(), s, "{\"id\":101}")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+	assert.Equal(t, "error", scripted.Response.Type)
+	assert.Equal(t, &ErrorResponse{Code: 5, Message: "order 101 not found"}, scripted.Response.Error)
+
+	scripted, err = RunScript(context.Background(), s, "{\"id\":1}")
+	assert.NoError(t, err)
+	assert.Equal(t, []JsonString{"{\"id\":1}", "{\"id\":2}"}, scripted.Response.Stream)
+}
+
+func TestRunScript_Seed(t *testing.T) {
+	s := newScriptStub(`return {content = {a = math.random(1000), b = math.random(5, 10), c = math.random()}}`)
+	s.ID = "seeded"
+	s.Seed = 42
+	run := func() string {
+		scripted, err := RunScript(context.Background(), s, "{}")
+		assert.NoError(t, err)
+		return scripted.Response.Content.String()
+	}
+	defer SetRandom(random)
+	SetRandom(util.NewSeededRandom(1))
+	first := run()
+	assert.NotEqual(t, first, run())
+
+	SetRandom(util.NewSeededRandom(2))
+	assert.Equal(t, first, run())
+}
+
+func TestRunScript_Failures(t *testing.T) {
+	_, err := RunScript(context.Background(), newScriptStub("return 1"), "{}")
+	assert.Error(t, err)
+
+	_, err = RunScript(context.Background(), newScriptStub("return {}"), "{}")
+	assert.Error(t, err)
+
+	_, err = RunScript(context.Background(), newScriptStub("dofile('/etc/passwd')"), "{}")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = RunScript(ctx, newScriptStub("while true do end"), "{}")
+	assert.Error(t, err)
+}
+
+func TestRunScript_Timeout(t *testing.T) {
+	defer SetScriptTimeout(0)
+	SetScriptTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	_, err := RunScript(context.Background(), newScriptStub("while true do end"), "{}")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	SetScriptTimeout(0)
+	assert.Equal(t, DefaultScriptTimeout, getScriptTimeout())
+}
+
+func TestValidateScript(t *testing.T) {
+	assert.Empty(t, validateScript("return {content = {}}"))
+	assert.Len(t, validateScript(""), 1)
+	assert.Len(t, validateScript("return {"), 1)
+}
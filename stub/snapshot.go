@@ -0,0 +1,105 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Snapshot is a copy of all the stubs in the StubsStore at a given point in time
+type Snapshot struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	StubCount int       `json:"stubCount"`
+	Stubs     []*Stub   `json:"stubs,omitempty"`
+}
+
+// SnapshotsStore keeps the snapshots taken from the StubsStore
+type SnapshotsStore interface {
+	// Create stores a deep copy of stubs as a new snapshot
+	Create(name, actor string, stubs []*Stub) *Snapshot
+	Get(id string) *Snapshot
+	GetAll() []*Snapshot
+	Delete(id string) error
+}
+
+func NewInMemorySnapshotsStore() SnapshotsStore {
+	return &inMemorySnapshotsStore{
+		snapshots: make(map[string]*Snapshot, 0),
+	}
+}
+
+type inMemorySnapshotsStore struct {
+	snapshots map[string]*Snapshot
+	mutex     sync.RWMutex
+}
+
+func (s *inMemorySnapshotsStore) Create(name, actor string, stubs []*Stub) *Snapshot {
+	snapshot := &Snapshot{
+		ID:        newID(),
+		Name:      name,
+		CreatedBy: actor,
+		CreatedAt: time.Now(),
+		StubCount: len(stubs),
+		Stubs:     make([]*Stub, 0, len(stubs)),
+	}
+	for _, e := range stubs {
+		snapshot.Stubs = append(snapshot.Stubs, e.Clone())
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshots[snapshot.ID] = snapshot
+	return snapshot
+}
+
+func (s *inMemorySnapshotsStore) Get(id string) *Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.snapshots[id]
+}
+
+func (s *inMemorySnapshotsStore) GetAll() []*Snapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	snapshots := make([]*Snapshot, 0, len(s.snapshots))
+	for _, snapshot := range s.snapshots {
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots
+}
+
+func (s *inMemorySnapshotsStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found := s.snapshots[id]; !found {
+		return fmt.Errorf("snapshot does not exist: %s", id)
+	}
+	delete(s.snapshots, id)
+	return nil
+}
+
+// Restore replaces all the stubs in the store with a copy of the stubs in the snapshot. It returns the stubs that were
+// in the store before the restore.
+func (snapshot *Snapshot) Restore(ctx context.Context, store StubsStore) (previous []*Stub, err error) {
+	stubs := make([]*Stub, 0, len(snapshot.Stubs))
+	for _, e := range snapshot.Stubs {
+		stubs = append(stubs, e.Clone())
+	}
+	err = store.Transaction(ctx, func(current []*Stub) ([]*Stub, error) {
+		previous = current
+		return stubs, nil
+	})
+	return previous, err
+}
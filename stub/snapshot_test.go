@@ -0,0 +1,27 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSnapshot_Restore(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}"))
+	snapshots := NewInMemorySnapshotsStore()
+	snapshot := snapshots.Create("baseline", "tester", allStubs(t, store))
+
+	store.DeleteAll(context.Background())
+	store.Add(context.Background(), newTestStub("method2", "{\"name\":\"Mary\"}"))
+	previous, err := snapshot.Restore(context.Background(), store)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(previous))
+	assert.Equal(t, "method2", previous[0].FullMethod)
+	stubs := allStubs(t, store)
+	assert.Equal(t, 1, len(stubs))
+	assert.Equal(t, "method1", stubs[0].FullMethod)
+	assert.Equal(t, snapshot.Stubs[0].ID, stubs[0].ID)
+	assert.False(t, snapshot.Stubs[0] == stubs[0])
+}
@@ -0,0 +1,224 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"sync"
+)
+
+const (
+	// StateSessionMetadataKey is the metadata key of the session the calls belong to. The calls of a session share
+	// their own state, so that tests running in parallel don't see each other's values.
+	StateSessionMetadataKey = "x-mock-session"
+	// GlobalStateScope is the scope of the state of the calls without a session to stubs without a scenario
+	GlobalStateScope = "global"
+)
+
+// StateStore keeps the values shared by the responses, e.g. the ID of an order created by a call to return it in
+// later calls. The values are kept in scopes. Implementations must be safe for concurrent use.
+type StateStore interface {
+	// Get returns the value of the key, nil if it is not set
+	Get(scope, key string) interface{}
+	Set(scope, key string, value interface{})
+	// Incr atomically adds delta to the number of the key (0 when not set) and returns the result
+	Incr(scope, key string, delta float64) (float64, error)
+	// GetScope returns the values of a scope
+	GetScope(scope string) map[string]interface{}
+	// GetAll returns the values of all the scopes
+	GetAll() map[string]map[string]interface{}
+	// ResetScope removes the values of a scope and Reset the values of all the scopes
+	ResetScope(scope string)
+	Reset()
+}
+
+func NewInMemoryStateStore() StateStore {
+	return &inMemoryStateStore{
+		scopes: make(map[string]map[string]interface{}),
+	}
+}
+
+type inMemoryStateStore struct {
+	scopes map[string]map[string]interface{}
+	mutex  sync.RWMutex
+}
+
+func (s *inMemoryStateStore) Get(scope, key string) interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.scopes[scope][key]
+}
+
+func (s *inMemoryStateStore) Set(scope, key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.set(scope, key, value)
+}
+
+func (s *inMemoryStateStore) set(scope, key string, value interface{}) {
+	values, ok := s.scopes[scope]
+	if !ok {
+		values = make(map[string]interface{})
+		s.scopes[scope] = values
+	}
+	values[key] = value
+}
+
+func (s *inMemoryStateStore) Incr(scope, key string, delta float64) (float64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var number float64
+	if value := s.scopes[scope][key]; value != nil {
+		var ok bool
+		if number, ok = toExprNumber(value); !ok {
+			return 0, fmt.Errorf("can't increment %s, it is a %s", key, exprTypeName(value))
+		}
+	}
+	number += delta
+	s.set(scope, key, number)
+	return number, nil
+}
+
+func (s *inMemoryStateStore) GetScope(scope string) map[string]interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	values := make(map[string]interface{}, len(s.scopes[scope]))
+	for key, value := range s.scopes[scope] {
+		values[key] = value
+	}
+	return values
+}
+
+func (s *inMemoryStateStore) GetAll() map[string]map[string]interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	scopes := make(map[string]map[string]interface{}, len(s.scopes))
+	for scope, scopeValues := range s.scopes {
+		values := make(map[string]interface{}, len(scopeValues))
+		for key, value := range scopeValues {
+			values[key] = value
+		}
+		scopes[scope] = values
+	}
+	return scopes
+}
+
+func (s *inMemoryStateStore) ResetScope(scope string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.scopes, scope)
+}
+
+func (s *inMemoryStateStore) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scopes = make(map[string]map[string]interface{})
+}
+
+var state = NewInMemoryStateStore()
+
+// SetStateStore sets the store of the values shared by the responses
+func SetStateStore(store StateStore) {
+	state = store
+}
+
+type readOnlyStateKey struct{}
+
+// WithReadOnlyState returns a context where the responses read the state without changing it, e.g. to check the
+// response of a stub without serving it
+func WithReadOnlyState(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyStateKey{}, true)
+}
+
+func isStateReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyStateKey{}).(bool)
+	return readOnly
+}
+
+// stateScope returns the scope of the state of a call to the stub: the session of the call, the scenario of the stub
+// or the global scope
+func stateScope(ctx context.Context, s *Stub) string {
+	if session := callSession(ctx); session != "" {
+		return session
+	}
+	if s != nil && s.Scenario != nil && s.Scenario.Name != "" {
+		return s.Scenario.Name
+	}
+	return GlobalStateScope
+}
+
+// callSession returns the session of the call, empty when it has none
+func callSession(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if session := md.Get(StateSessionMetadataKey); len(session) > 0 {
+		return session[0]
+	}
+	return ""
+}
+
+// stateVar is the value of the variable state of the response templates, whose methods get, set and incr access the
+// values of the scope. When it is read only set and incr return the value they would set.
+type stateVar struct {
+	scope    string
+	readOnly bool
+}
+
+func toStateVar(value interface{}) (stateVar, error) {
+	v, ok := value.(stateVar)
+	if !ok {
+		return stateVar{}, fmt.Errorf("expected the state, got %s", exprTypeName(value))
+	}
+	return v, nil
+}
+
+func exprStateGet(args []interface{}) (interface{}, error) {
+	v, err := toStateVar(args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := exprText(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return state.Get(v.scope, key), nil
+}
+
+// exprStateSet sets the value of the key and returns it
+func exprStateSet(args []interface{}) (interface{}, error) {
+	v, err := toStateVar(args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := exprText(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if !v.readOnly {
+		state.Set(v.scope, key, args[2])
+	}
+	return args[2], nil
+}
+
+// exprStateIncr adds 1 to the number of the key and returns the result
+func exprStateIncr(args []interface{}) (interface{}, error) {
+	v, err := toStateVar(args[0])
+	if err != nil {
+		return nil, err
+	}
+	key, err := exprText(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if v.readOnly {
+		number, _ := toExprNumber(state.Get(v.scope, key))
+		return number + 1, nil
+	}
+	return state.Incr(v.scope, key, 1)
+}
@@ -0,0 +1,60 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestInMemoryStateStore(t *testing.T) {
+	store := NewInMemoryStateStore()
+	store.Set("checkout", "orderId", "A-1")
+	number, err := store.Incr("checkout", "count", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), number)
+	_, err = store.Incr("checkout", "orderId", 1)
+	assert.Error(t, err)
+	assert.Nil(t, store.Get(GlobalStateScope, "orderId"))
+	assert.Equal(t, map[string]interface{}{"orderId": "A-1", "count": float64(2)}, store.GetScope("checkout"))
+
+	store.Set(GlobalStateScope, "orderId", "B-2")
+	store.ResetScope("checkout")
+	assert.Equal(t, map[string]map[string]interface{}{GlobalStateScope: {"orderId": "B-2"}}, store.GetAll())
+	store.Reset()
+	assert.Empty(t, store.GetAll())
+}
+
+func TestGetResponse_State(t *testing.T) {
+	SetStateStore(NewInMemoryStateStore())
+	defer SetStateStore(NewInMemoryStateStore())
+
+	create := &Stub{
+		FullMethod: "/acme.Orders/Create",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: ResponseTypeScript, Script: `return {content = {id = state.set("orderId", "order-" .. state.incr("orderCount"))}}`},
+		Scenario:   &StubScenario{Name: "checkout"},
+	}
+	get := &Stub{
+		FullMethod: "/acme.Orders/Get",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response:   &StubResponse{Type: "error", Error: &ErrorResponse{Code: 5, Message: "order ${state.get('orderId')} of ${state.incr('orderCount')} not found"}},
+		Scenario:   &StubScenario{Name: "checkout"},
+	}
+	session := metadata.NewIncomingContext(context.Background(), metadata.Pairs(StateSessionMetadataKey, "test-1"))
+
+	scripted, err := RunScript(context.Background(), create, "{}")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"order-1"}`, scripted.Response.Content.String())
+	_, err = GetResponse(context.Background(), get, "{}", nil)
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = order order-1 of 2 not found")
+
+	// The calls of a session have their own state
+	_, err = GetResponse(session, get, "{}", nil)
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = order  of 1 not found")
+
+	// Checking a response doesn't change the state
+	_, err = GetResponse(WithReadOnlyState(context.Background()), get, "{}", nil)
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = order order-1 of 3 not found")
+	assert.Equal(t, map[string]interface{}{"orderId": "order-1", "orderCount": float64(2)}, state.GetScope("checkout"))
+}
@@ -0,0 +1,85 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/codes"
+	"strings"
+)
+
+// Canonical names of the gRPC status codes, indexed by code
+var statusCodeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// StatusCode is a gRPC status code. In JSON it is either the number or the canonical name (e.g. NOT_FOUND), and it
+// is written with the name.
+type StatusCode int32
+
+// ParseStatusCode returns the status code with the canonical name given, ignoring the case
+func ParseStatusCode(name string) (StatusCode, error) {
+	for code, codeName := range statusCodeNames {
+		if strings.EqualFold(name, codeName) {
+			return StatusCode(code), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gRPC status code: %s", name)
+}
+
+func (c StatusCode) isKnown() bool {
+	return c >= 0 && int(c) < len(statusCodeNames)
+}
+
+// GRPCCode returns the code as used by the gRPC library
+func (c StatusCode) GRPCCode() codes.Code {
+	return codes.Code(uint32(c))
+}
+
+// String returns the canonical name of the code, or the number if it isn't a known code
+func (c StatusCode) String() string {
+	if !c.isKnown() {
+		return fmt.Sprint(int32(c))
+	}
+	return statusCodeNames[c]
+}
+
+func (c StatusCode) MarshalJSON() ([]byte, error) {
+	if !c.isKnown() {
+		return json.Marshal(int32(c))
+	}
+	return json.Marshal(c.String())
+}
+
+func (c *StatusCode) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		code, err := ParseStatusCode(name)
+		if err != nil {
+			return err
+		}
+		*c = code
+		return nil
+	}
+	var number int32
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("invalid gRPC status code: %s", string(data))
+	}
+	*c = StatusCode(number)
+	return nil
+}
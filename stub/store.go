@@ -1,155 +1,615 @@
 package stub
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	log "github.com/sirupsen/logrus"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func NewInMemoryStubsStore() StubsStore {
-	return &inMemoryStubsStore{
-		Stubs: make(map[string]map[string]*Stub, 0),
+// The errors returned by the stores are (or wrap) these errors, so that callers can check them with errors.Is
+var (
+	// ErrNotFound is returned when the stub to get, update or delete doesn't exist
+	ErrNotFound = errors.New("stub not found")
+	// ErrConflict is returned when adding a stub for the same method and request as an existing stub
+	ErrConflict = errors.New("stub already exists")
+	// ErrVersionMismatch is returned when updating a stub whose version differs from the one expected by the caller.
+	ErrVersionMismatch = errors.New("stub version mismatch")
+	// ErrLimitExceeded is returned when adding a stub over the limits of the store (see StubLimits)
+	ErrLimitExceeded = errors.New("stub limit exceeded")
+)
+
+// StoreOption changes how the stubs are stored
+type StoreOption func(store *inMemoryStubsStore)
+
+// WithStubLimits caps the number of stubs of the store
+func WithStubLimits(limits StubLimits) StoreOption {
+	return func(store *inMemoryStubsStore) {
+		store.limits = limits
+	}
+}
+
+func NewInMemoryStubsStore(options ...StoreOption) StubsStore {
+	store := &inMemoryStubsStore{
+		byKey: make(map[string]map[string]*Stub, 0),
+		byID:  make(map[string]*Stub, 0),
 	}
+	store.index.Store(make(stubsIndex, 0))
+	for _, option := range options {
+		option(store)
+	}
+	return store
 }
 
+// StubsStore keeps the registered stubs. Implementations must be safe for concurrent use as the stubs are read by
+// the gRPC handlers while being modified through the REST API. Implementations backed by other systems (e.g. a
+// database) should honour the cancellation of the context and return the errors of the system, and only need to
+// load the stubs queried.
 type StubsStore interface {
-	Add(e *Stub) error
-	GetStubsMapForMethod(method string) map[string]*Stub
-	GetStubsForMethod(method string) []*Stub
-	GetAllStubs() []*Stub
-	Update(e *Stub) error
-	DeleteAllForMethod(method string)
-	DeleteAll()
-	Delete(e *Stub) error
-	Exists(e *Stub) bool
+	// Add stores a new stub. It returns ErrConflict if there is a stub with the same method and request.
+	Add(ctx context.Context, e *Stub) error
+	// AddAll adds the stubs as Add does and publishes them at once, e.g. to load many stubs. It returns the error of
+	// each stub (nil for the ones added) in the order given.
+	AddAll(ctx context.Context, stubs []*Stub) []error
+	// Get returns the stored stub with the same method and request as e or ErrNotFound if it doesn't exist.
+	Get(ctx context.Context, e *Stub) (*Stub, error)
+	// GetStubsForMethod returns the stubs for the method, the ones scoped to an authority first and the fallback stubs
+	// last. The slice returned is shared and must not be modified.
+	GetStubsForMethod(ctx context.Context, method string) ([]*Stub, error)
+	GetAllStubs(ctx context.Context) ([]*Stub, error)
+	// Query returns the page of the stubs that match the query
+	Query(ctx context.Context, query StubsQuery) (*StubsPage, error)
+	// Update replaces an existing stub or returns ErrNotFound. If e.Version is set, the update only succeeds when it
+	// matches the version currently stored, otherwise ErrVersionMismatch is returned.
+	Update(ctx context.Context, e *Stub) error
+	// Delete removes the stub with the same method and request as e or returns ErrNotFound.
+	Delete(ctx context.Context, e *Stub) error
+	DeleteAllForMethod(ctx context.Context, method string) error
+	DeleteAll(ctx context.Context) error
+	// ReplaceAll atomically replaces all the stubs in the store with the ones provided, within the limits of the
+	// store (see StubLimits).
+	ReplaceAll(ctx context.Context, stubs []*Stub) error
+	// Transaction atomically replaces all the stubs in the store with the ones returned by change, which receives the
+	// current stubs. Other changes wait until it completes, so none is lost in between, and the stubs are kept as
+	// they are when change returns an error or the new stubs are rejected by the limits of the store.
+	Transaction(ctx context.Context, change func(current []*Stub) ([]*Stub, error)) error
+}
+
+// StubsQuery selects the stubs returned by StubsStore.Query. The empty query selects all the stubs.
+type StubsQuery struct {
+	// FullMethod selects the stubs of the method
+	FullMethod string
+	// Labels selects the stubs that have all these labels with the same values
+	Labels map[string]string
+	// Offset is the number of stubs skipped and Limit the maximum number of stubs returned (all when it is 0). The
+	// stubs are sorted by method and ID so that the pages are stable.
+	Offset int
+	Limit  int
+}
+
+// StubsPage is a page of the stubs that match a query
+type StubsPage struct {
+	Stubs []*Stub `json:"stubs"`
+	// Total is the number of stubs that match the query in all the pages
+	Total int `json:"total"`
+}
+
+// Matches checks if the stub is selected by the query, regardless of the page
+func (q StubsQuery) Matches(e *Stub) bool {
+	if q.FullMethod != "" && e.FullMethod != q.FullMethod {
+		return false
+	}
+	for name, value := range q.Labels {
+		if actual, found := e.Labels[name]; !found || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// StoreHealthChecker is implemented by the stores that depend on other systems to report if they are reachable
+type StoreHealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// StoreStatsReporter is implemented by the stores that report the stubs they hold and evict
+type StoreStatsReporter interface {
+	GetStats(ctx context.Context) StoreStats
+}
+
+// StubHitRecorder is implemented by the stores that keep when each stub was last matched, e.g. to evict the least
+// recently used stubs
+type StubHitRecorder interface {
+	RecordHit(stubID string)
 }
 
+// inMemoryStubsStore keeps the stubs in an immutable index that is replaced (copy-on-write) on every change. The
+// reads made by the gRPC handlers when matching requests never take a lock. The writers keep their own indexes of the
+// stubs by key and ID so that the changes don't need to scan the stubs.
 type inMemoryStubsStore struct {
-	// Stores the stubs registered.
-	// First map's key is a full method name
-	// Second map's key is a gRPC request payload in JSON format
-	// The data stub here would look like:
-	// /carvalhorr.proto.test.TestProtobuf/GetProtoTest ->
-	//               {\"customerId\":1593510,\"siteId\":10153291} -> stub1
-	//               {\"customerId\":1545,\"siteId\":10153291} -> stub2
-	// /full method name 2 ->
-	//               request 1 -> stub3
-	//               request 2 -> stub4
-	Stubs map[string]map[string]*Stub
-	mutex sync.RWMutex
-}
-
-func (s *inMemoryStubsStore) Add(e *Stub) error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	// Holds the current stubsIndex
+	index atomic.Value
+	// Serializes the changes to the index and guards byKey, byID and count
+	mutex sync.Mutex
+	// The stubs of the index by method and key (see Stub.key) and by ID
+	byKey  map[string]map[string]*Stub
+	byID   map[string]*Stub
+	count  int
+	limits StubLimits
+	// lastHits has the time (in Unix nanoseconds) each stub was last matched, by stub ID, for the LRU eviction
+	lastHits   sync.Map
+	evictions  int64
+	rejections int64
+}
+
+// stubsIndex stores the stubs registered per full method name, e.g.
+// /carvalhorr.proto.test.TestProtobuf/GetProtoTest -> [stub1, stub2].
+// It must not be modified after being published.
+type stubsIndex map[string]*methodStubs
+
+// The number of matching ranks (see matchingRank)
+const matchingRanks = 3
+
+type methodStubs struct {
+	// The stubs of the method by matching rank. The stubs added are appended, so the lists share their arrays with
+	// the previous indexes, which only see the stubs up to their own length.
+	ranks [matchingRanks][]*Stub
+	// The stubs of all the ranks in a list that can be returned without copying, joined when first read
+	listOnce sync.Once
+	list     []*Stub
+}
+
+// getList returns the stubs of the method with the fallback stubs last so that they are tried after the others
+func (m *methodStubs) getList() []*Stub {
+	m.listOnce.Do(func() {
+		for _, stubs := range m.ranks {
+			switch {
+			case len(stubs) == 0:
+			case m.list == nil:
+				// The capacity is capped so that appending to the list returned doesn't write in the shared array
+				m.list = stubs[:len(stubs):len(stubs)]
+			default:
+				m.list = append(append(make([]*Stub, 0, len(m.list)+len(stubs)), m.list...), stubs...)
+			}
+		}
+	})
+	return m.list
+}
+
+func (m *methodStubs) count() int {
+	count := 0
+	for _, stubs := range m.ranks {
+		count += len(stubs)
+	}
+	return count
+}
+
+// matchingRank orders the stubs of a method: the stubs scoped to a virtual host (an authority) are tried before the
+// others, so that the hosts impersonated keep their own behavior, and the fallback stubs are tried last
+func matchingRank(s *Stub) int {
+	switch {
+	case s.Fallback:
+		return 2
+	case s.Request == nil || s.Request.Transport == nil || s.Request.Transport.Authority == "":
+		return 1
+	}
+	return 0
+}
+
+func (s *inMemoryStubsStore) getIndex() stubsIndex {
+	return s.index.Load().(stubsIndex)
+}
+
+// indexChange stages changes to the stubs of the store so that they are published in a single index. Only the lists
+// of the methods changed are copied. It must be used holding s.mutex.
+type indexChange struct {
+	store *inMemoryStubsStore
+	base  stubsIndex
+	// The new stubs of the methods changed by matching rank
+	methods map[string]*[matchingRanks][]*Stub
+}
+
+func (s *inMemoryStubsStore) newChange(base stubsIndex) *indexChange {
+	return &indexChange{store: s, base: base, methods: make(map[string]*[matchingRanks][]*Stub, 0)}
+}
 
-	_, ok := s.Stubs[e.FullMethod]
+// ranksOf returns the stubs of the method to be changed
+func (c *indexChange) ranksOf(method string) *[matchingRanks][]*Stub {
+	ranks, ok := c.methods[method]
 	if !ok {
-		s.Stubs[e.FullMethod] = make(map[string]*Stub, 0)
+		ranks = new([matchingRanks][]*Stub)
+		if existing, found := c.base[method]; found {
+			*ranks = existing.ranks
+		}
+		c.methods[method] = ranks
+	}
+	return ranks
+}
+
+func (c *indexChange) add(e *Stub, key string) {
+	ranks := c.ranksOf(e.FullMethod)
+	rank := matchingRank(e)
+	ranks[rank] = append(ranks[rank], e)
+	s := c.store
+	if s.byKey[e.FullMethod] == nil {
+		s.byKey[e.FullMethod] = make(map[string]*Stub, 0)
+	}
+	s.byKey[e.FullMethod][key] = e
+	if e.ID != "" {
+		s.byID[e.ID] = e
+	}
+	s.count++
+}
+
+func (c *indexChange) remove(e *Stub, key string) {
+	ranks := c.ranksOf(e.FullMethod)
+	rank := matchingRank(e)
+	ranks[rank] = withoutStubs(ranks[rank], []*Stub{e})
+	s := c.store
+	delete(s.byKey[e.FullMethod], key)
+	if len(s.byKey[e.FullMethod]) == 0 {
+		delete(s.byKey, e.FullMethod)
+	}
+	if s.byID[e.ID] == e {
+		delete(s.byID, e.ID)
 	}
+	s.count--
+}
+
+// swap replaces the stored stub existing with e, which has the same key
+func (c *indexChange) swap(existing, e *Stub, key string) {
+	rank := matchingRank(e)
+	if matchingRank(existing) != rank {
+		c.remove(existing, key)
+		c.add(e, key)
+		return
+	}
+	ranks := c.ranksOf(e.FullMethod)
+	stubs := append([]*Stub(nil), ranks[rank]...)
+	for i, stub := range stubs {
+		if stub == existing {
+			stubs[i] = e
+		}
+	}
+	ranks[rank] = stubs
+	c.store.byKey[e.FullMethod][key] = e
+	if c.store.byID[existing.ID] == existing {
+		delete(c.store.byID, existing.ID)
+	}
+	if e.ID != "" {
+		c.store.byID[e.ID] = e
+	}
+}
 
-	if s.exists(e) {
-		return fmt.Errorf("stub already exist: %s -> %s", e.FullMethod, e.Request.String())
+// publish stores the index with the changes staged
+func (c *indexChange) publish() {
+	index := make(stubsIndex, len(c.base)+len(c.methods))
+	for method, stubs := range c.base {
+		index[method] = stubs
+	}
+	for method, ranks := range c.methods {
+		stubs := &methodStubs{ranks: *ranks}
+		if stubs.count() == 0 {
+			delete(index, method)
+			continue
+		}
+		index[method] = stubs
 	}
+	c.store.index.Store(index)
+}
+
+// The stubs of the change for the limits of the store
+func (c *indexChange) total() int {
+	return c.store.count
+}
 
-	s.Stubs[e.FullMethod][e.Request.String()] = e
+func (c *indexChange) countOf(method string) int {
+	return len(c.store.byKey[method])
+}
 
+func (c *indexChange) stubsOf(method string) []*Stub {
+	stubs := make([]*Stub, 0, c.countOf(method))
+	for _, e := range c.store.byKey[method] {
+		stubs = append(stubs, e)
+	}
+	return stubs
+}
+
+func (c *indexChange) all() []*Stub {
+	stubs := make([]*Stub, 0, c.total())
+	for _, byKey := range c.store.byKey {
+		for _, e := range byKey {
+			stubs = append(stubs, e)
+		}
+	}
+	return stubs
+}
+
+func (s *inMemoryStubsStore) Add(ctx context.Context, e *Stub) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	change := s.newChange(s.getIndex())
+	if err := s.add(change, e); err != nil {
+		return err
+	}
+	change.publish()
 	return nil
 }
 
-func (s *inMemoryStubsStore) GetStubsMapForMethod(method string) (stubs map[string]*Stub) {
+func (s *inMemoryStubsStore) AddAll(ctx context.Context, stubs []*Stub) []error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return s.getStubsMapForMethod(method)
+	change := s.newChange(s.getIndex())
+	errs := make([]error, len(stubs))
+	for i, e := range stubs {
+		errs[i] = s.add(change, e)
+	}
+	change.publish()
+	return errs
+}
+
+// add stages the new stub in the change, evicting the stubs that make room for it. It must be called holding s.mutex.
+func (s *inMemoryStubsStore) add(change *indexChange, e *Stub) error {
+	key := e.key()
+	if s.byKey[e.FullMethod][key] != nil {
+		return fmt.Errorf("%w: %s -> %s", ErrConflict, e.FullMethod, util.LoggablePayload(e.Request.String()))
+	}
+	if e.ID != "" && s.byID[e.ID] != nil {
+		return fmt.Errorf("%w: id %s is taken", ErrConflict, e.ID)
+	}
+	evicted, err := s.limits.evicted(change, e.FullMethod, s.lastHit)
+	if err != nil {
+		atomic.AddInt64(&s.rejections, 1)
+		return err
+	}
+	for _, victim := range evicted {
+		change.remove(victim, victim.key())
+		s.evicted(victim)
+	}
+	now := time.Now()
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	e.Fixture = ""
+	e.CreatedAt = &now
+	e.UpdatedAt = &now
+	e.Version = 1
+	e.prepare()
+	change.add(e, key)
+	return nil
 }
 
-func (s *inMemoryStubsStore) getStubsMapForMethod(method string) (stubs map[string]*Stub) {
-	return s.Stubs[method]
+func (s *inMemoryStubsStore) evicted(victim *Stub) {
+	atomic.AddInt64(&s.evictions, 1)
+	s.lastHits.Delete(victim.ID)
+	log.WithFields(log.Fields{"id": victim.ID, "policy": s.limits.eviction()}).
+		Infof("Evicted stub for %s to stay within the limits of the store", victim.FullMethod)
 }
 
-func (s *inMemoryStubsStore) GetStubsForMethod(method string) []*Stub {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// RecordHit keeps when the stub was matched, only when the least recently used stubs are evicted
+func (s *inMemoryStubsStore) RecordHit(stubID string) {
+	if s.limits.eviction() != EvictionLRU {
+		return
+	}
+	s.lastHits.Store(stubID, time.Now().UnixNano())
+}
 
-	return s.getStubssForMethod(method)
+// lastHit returns when the stub was last matched, 0 when it never was
+func (s *inMemoryStubsStore) lastHit(stubID string) int64 {
+	if hit, ok := s.lastHits.Load(stubID); ok {
+		return hit.(int64)
+	}
+	return 0
 }
 
-func (s *inMemoryStubsStore) getStubssForMethod(method string) []*Stub {
-	stubs := make([]*Stub, 0)
-	stubsForMethod := s.getStubsMapForMethod(method)
-	for _, e := range stubsForMethod {
-		stubs = append(stubs, e)
+func (s *inMemoryStubsStore) GetStats(ctx context.Context) StoreStats {
+	stats := StoreStats{
+		Limits:     s.limits,
+		Evictions:  atomic.LoadInt64(&s.evictions),
+		Rejections: atomic.LoadInt64(&s.rejections),
 	}
-	return stubs
+	for _, stubs := range s.getIndex() {
+		stats.Stubs += stubs.count()
+	}
+	return stats
 }
 
-func (s *inMemoryStubsStore) GetAllStubs() []*Stub {
+func (s *inMemoryStubsStore) Get(ctx context.Context, e *Stub) (*Stub, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	allStubs := make([]*Stub, 0)
-	for methodName := range s.Stubs {
-		allStubs = append(allStubs, s.getStubssForMethod(methodName)...)
+	existing := s.byKey[e.FullMethod][e.key()]
+	if existing == nil {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrNotFound, e.FullMethod, util.LoggablePayload(e.Request.String()))
+	}
+	return existing, nil
+}
+
+func (s *inMemoryStubsStore) GetStubsForMethod(ctx context.Context, method string) ([]*Stub, error) {
+	stubs, ok := s.getIndex()[method]
+	if !ok {
+		return make([]*Stub, 0), nil
 	}
+	return stubs.getList(), nil
+}
 
+func (s *inMemoryStubsStore) GetAllStubs(ctx context.Context) ([]*Stub, error) {
+	return s.getAllStubs(), nil
+}
+
+func (s *inMemoryStubsStore) getAllStubs() []*Stub {
+	allStubs := make([]*Stub, 0)
+	for _, stubs := range s.getIndex() {
+		allStubs = append(allStubs, stubs.getList()...)
+	}
 	return allStubs
 }
 
-func (s *inMemoryStubsStore) Update(e *Stub) error {
+func (s *inMemoryStubsStore) Query(ctx context.Context, query StubsQuery) (*StubsPage, error) {
+	candidates := s.getAllStubs()
+	if query.FullMethod != "" {
+		candidates, _ = s.GetStubsForMethod(ctx, query.FullMethod)
+	}
+	selected := make([]*Stub, 0, len(candidates))
+	for _, e := range candidates {
+		if query.Matches(e) {
+			selected = append(selected, e)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].FullMethod != selected[j].FullMethod {
+			return selected[i].FullMethod < selected[j].FullMethod
+		}
+		return selected[i].ID < selected[j].ID
+	})
+	page := &StubsPage{Total: len(selected)}
+	if query.Offset < len(selected) {
+		selected = selected[query.Offset:]
+	} else {
+		selected = selected[:0]
+	}
+	if query.Limit > 0 && query.Limit < len(selected) {
+		selected = selected[:query.Limit]
+	}
+	page.Stubs = selected
+	return page, nil
+}
+
+func (s *inMemoryStubsStore) Update(ctx context.Context, e *Stub) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if !s.exists(e) {
-		return fmt.Errorf("stub does not exist: %s -> %s", e.FullMethod, e.Request.String())
+	key := e.key()
+	existing := s.byKey[e.FullMethod][key]
+	if existing == nil {
+		return fmt.Errorf("%w: %s -> %s", ErrNotFound, e.FullMethod, util.LoggablePayload(e.Request.String()))
 	}
-
-	s.Stubs[e.FullMethod][e.Request.String()] = e
-
+	if e.Version != 0 && e.Version != existing.Version {
+		return fmt.Errorf("%w: expected %d but found %d", ErrVersionMismatch, e.Version, existing.Version)
+	}
+	// Authorship of the original stub is preserved on updates
+	now := time.Now()
+	e.ID = existing.ID
+	e.CreatedBy = existing.CreatedBy
+	e.CreatedAt = existing.CreatedAt
+	e.Fixture = existing.Fixture
+	e.UpdatedAt = &now
+	e.Version = existing.Version + 1
+	e.prepare()
+	change := s.newChange(s.getIndex())
+	change.swap(existing, e, key)
+	change.publish()
 	return nil
 }
 
-func (s *inMemoryStubsStore) Delete(e *Stub) error {
+func (s *inMemoryStubsStore) Delete(ctx context.Context, e *Stub) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if !s.exists(e) {
-		return fmt.Errorf("stub does not exist: %s -> %s", e.FullMethod, e.Request.String())
+	key := e.key()
+	existing := s.byKey[e.FullMethod][key]
+	if existing == nil {
+		return fmt.Errorf("%w: %s -> %s", ErrNotFound, e.FullMethod, util.LoggablePayload(e.Request.String()))
 	}
+	change := s.newChange(s.getIndex())
+	change.remove(existing, key)
+	change.publish()
+	return nil
+}
 
-	delete(s.Stubs[e.FullMethod], e.Request.String())
+func (s *inMemoryStubsStore) DeleteAllForMethod(ctx context.Context, method string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
+	for _, e := range s.byKey[method] {
+		if s.byID[e.ID] == e {
+			delete(s.byID, e.ID)
+		}
+	}
+	s.count -= len(s.byKey[method])
+	delete(s.byKey, method)
+	change := s.newChange(s.getIndex())
+	change.methods[method] = new([matchingRanks][]*Stub)
+	change.publish()
 	return nil
 }
 
-func (s *inMemoryStubsStore) Exists(e *Stub) bool {
+func (s *inMemoryStubsStore) DeleteAll(ctx context.Context) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	return s.exists(e)
+	s.replace(make([]*Stub, 0))
+	return nil
 }
 
-func (s *inMemoryStubsStore) exists(e *Stub) bool {
-	stubsPerMethod := s.Stubs[e.FullMethod]
-	foundStub := stubsPerMethod[e.Request.String()]
-	return foundStub != nil
+func (s *inMemoryStubsStore) ReplaceAll(ctx context.Context, stubs []*Stub) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.replaceWithinLimits(stubs)
 }
 
-func (s *inMemoryStubsStore) DeleteAllForMethod(method string) {
+func (s *inMemoryStubsStore) Transaction(ctx context.Context, change func(current []*Stub) ([]*Stub, error)) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	s.deleteAllForMethod(method)
+	stubs, err := change(s.getAllStubs())
+	if err != nil {
+		return err
+	}
+	return s.replaceWithinLimits(stubs)
 }
 
-func (s *inMemoryStubsStore) deleteAllForMethod(method string) {
-	s.Stubs[method] = make(map[string]*Stub)
+// replaceWithinLimits stores the new set of stubs within the limits of the store. It must be called holding s.mutex.
+func (s *inMemoryStubsStore) replaceWithinLimits(stubs []*Stub) error {
+	kept, evicted, err := s.limits.fitted(stubs, s.lastHit)
+	if err != nil {
+		atomic.AddInt64(&s.rejections, 1)
+		return err
+	}
+	for _, victim := range evicted {
+		s.evicted(victim)
+	}
+	for _, e := range kept {
+		// The stubs already stored are read concurrently and must not be modified
+		if !e.isPrepared() {
+			e.prepare()
+		}
+	}
+	s.replace(kept)
+	return nil
 }
 
-func (s *inMemoryStubsStore) DeleteAll() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+// replace publishes an index with the stubs given only. When several stubs have the same key, the last one is kept.
+// It must be called holding s.mutex.
+func (s *inMemoryStubsStore) replace(stubs []*Stub) {
+	s.byKey = make(map[string]map[string]*Stub, 0)
+	s.byID = make(map[string]*Stub, 0)
+	s.count = 0
+	change := s.newChange(make(stubsIndex, 0))
+	for _, e := range stubs {
+		key := e.key()
+		if previous := s.byKey[e.FullMethod][key]; previous != nil {
+			change.remove(previous, key)
+		}
+		change.add(e, key)
+	}
+	change.publish()
+}
 
-	for method := range s.Stubs {
-		s.deleteAllForMethod(method)
+func newID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
 	}
+	return hex.EncodeToString(id)
 }
@@ -0,0 +1,403 @@
+package stub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func newTestStub(method, request string) *Stub {
+	return &Stub{
+		FullMethod: method,
+		Request: &StubRequest{
+			Match:   "exact",
+			Content: JsonString(request),
+		},
+		Response: &StubResponse{
+			Type:    "success",
+			Content: JsonString("{}"),
+		},
+	}
+}
+
+func allStubs(t *testing.T, store StubsStore) []*Stub {
+	stubs, err := store.GetAllStubs(context.Background())
+	assert.NoError(t, err)
+	return stubs
+}
+
+func stubsForMethod(t *testing.T, store StubsStore, method string) []*Stub {
+	stubs, err := store.GetStubsForMethod(context.Background(), method)
+	assert.NoError(t, err)
+	return stubs
+}
+
+func TestInMemoryStubsStore_Add_SetsTimestamps(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.CreatedBy = "tester"
+
+	assert.Nil(t, store.Add(context.Background(), s))
+	assert.NotNil(t, s.CreatedAt)
+	assert.Equal(t, s.CreatedAt, s.UpdatedAt)
+	assert.Equal(t, "tester", allStubs(t, store)[0].CreatedBy)
+}
+
+func TestInMemoryStubsStore_GetStubsForMethod_FallbackLast(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	fallback := newTestStub("method1", `{}`)
+	fallback.Request.Match = "partial"
+	fallback.Fallback = true
+	assert.NoError(t, store.Add(context.Background(), fallback))
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, store.Add(context.Background(), newTestStub("method1", fmt.Sprintf(`{"id":%d}`, i))))
+	}
+
+	stubs := stubsForMethod(t, store, "method1")
+	assert.Len(t, stubs, 11)
+	assert.Equal(t, fallback.ID, stubs[10].ID)
+}
+
+func TestInMemoryStubsStore_AddAll(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	existing := newTestStub("method1", "{\"id\":1}")
+	existing.ID = "existing"
+	assert.NoError(t, store.Add(context.Background(), existing))
+
+	taken := newTestStub("method2", "{\"id\":2}")
+	taken.ID = "existing"
+	fallback := newTestStub("method1", "{\"id\":3}")
+	fallback.Fallback = true
+	errs := store.AddAll(context.Background(), []*Stub{
+		newTestStub("method1", "{\"id\":1}"),
+		taken,
+		fallback,
+		newTestStub("method1", "{\"id\":2}"),
+	})
+	assert.Len(t, errs, 4)
+	assert.True(t, errors.Is(errs[0], ErrConflict))
+	assert.True(t, errors.Is(errs[1], ErrConflict))
+	assert.NoError(t, errs[2])
+	assert.NoError(t, errs[3])
+
+	stubs, _ := store.GetStubsForMethod(context.Background(), "method1")
+	assert.Len(t, stubs, 3)
+	assert.True(t, stubs[2] == fallback)
+	found, err := store.Get(context.Background(), newTestStub("method1", "{\"id\":2}"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), found.Version)
+	assert.Equal(t, 3, store.(StoreStatsReporter).GetStats(context.Background()).Stubs)
+}
+
+func TestInMemoryStubsStore_AppendsDontChangePreviousReads(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, store.Add(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i))))
+	}
+	read, _ := store.GetStubsForMethod(context.Background(), "method1")
+	first := read[0]
+	assert.NoError(t, store.Delete(context.Background(), newTestStub("method1", "{\"id\":0}")))
+	assert.NoError(t, store.Add(context.Background(), newTestStub("method1", "{\"id\":3}")))
+	assert.NoError(t, store.Add(context.Background(), newTestStub("method1", "{\"id\":4}")))
+	_ = append(read, newTestStub("method1", "{\"id\":5}"))
+
+	assert.Len(t, read, 3)
+	assert.True(t, read[0] == first)
+	stubs, _ := store.GetStubsForMethod(context.Background(), "method1")
+	assert.Len(t, stubs, 4)
+	for _, e := range stubs {
+		assert.NotEqual(t, JsonString("{\"id\":5}"), e.Request.Content)
+	}
+}
+
+func TestInMemoryStubsStore_Update_PreservesAuthorship(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	original := newTestStub("method1", "{\"name\":\"John\"}")
+	original.CreatedBy = "tester"
+	store.Add(context.Background(), original)
+
+	updated := newTestStub("method1", "{\"name\":\"John\"}")
+	updated.CreatedBy = "someone else"
+	updated.Description = "updated"
+	assert.Nil(t, store.Update(context.Background(), updated))
+
+	stored := allStubs(t, store)[0]
+	assert.Equal(t, "tester", stored.CreatedBy)
+	assert.Equal(t, original.CreatedAt, stored.CreatedAt)
+	assert.NotNil(t, stored.UpdatedAt)
+	assert.Equal(t, "updated", stored.Description)
+}
+
+func TestInMemoryStubsStore_Update_VersionMismatch(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}"))
+
+	first := newTestStub("method1", "{\"name\":\"John\"}")
+	first.Version = 1
+	assert.Nil(t, store.Update(context.Background(), first))
+	assert.Equal(t, int64(2), first.Version)
+
+	stale := newTestStub("method1", "{\"name\":\"John\"}")
+	stale.Version = 1
+	assert.True(t, errors.Is(store.Update(context.Background(), stale), ErrVersionMismatch))
+}
+
+func TestInMemoryStubsStore_TypedErrors(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	assert.NoError(t, store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}")))
+
+	missing := newTestStub("method1", "{\"name\":\"Mary\"}")
+	assert.True(t, errors.Is(store.Add(context.Background(), newTestStub("method1", "{\"name\":\"John\"}")), ErrConflict))
+	_, err := store.Get(context.Background(), missing)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(store.Update(context.Background(), missing), ErrNotFound))
+	assert.True(t, errors.Is(store.Delete(context.Background(), missing), ErrNotFound))
+}
+
+func TestInMemoryStubsStore_Query(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 5; i++ {
+		s := newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i))
+		s.Labels = map[string]string{"team": "payments", "suite": fmt.Sprintf("suite%d", i%2)}
+		store.Add(context.Background(), s)
+	}
+	store.Add(context.Background(), newTestStub("method2", "{}"))
+
+	page, err := store.Query(context.Background(), StubsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, 6, page.Total)
+	assert.Len(t, page.Stubs, 6)
+	assert.Equal(t, "method2", page.Stubs[5].FullMethod)
+
+	page, _ = store.Query(context.Background(), StubsQuery{Labels: map[string]string{"team": "payments", "suite": "suite0"}})
+	assert.Equal(t, 3, page.Total)
+
+	first, _ := store.Query(context.Background(), StubsQuery{FullMethod: "method1", Offset: 0, Limit: 3})
+	second, _ := store.Query(context.Background(), StubsQuery{FullMethod: "method1", Offset: 3, Limit: 3})
+	assert.Equal(t, 5, first.Total)
+	assert.Len(t, first.Stubs, 3)
+	assert.Len(t, second.Stubs, 2)
+	assert.True(t, first.Stubs[2].ID < second.Stubs[0].ID)
+
+	page, _ = store.Query(context.Background(), StubsQuery{Offset: 10})
+	assert.Equal(t, 6, page.Total)
+	assert.Len(t, page.Stubs, 0)
+}
+
+// Run with -race to detect unsynchronized access to the store
+func TestInMemoryStubsStore_ConcurrentAccess(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	matcher := NewStubsMatcher(store)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s := newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i*1000+j))
+				store.Add(context.Background(), s)
+				store.Update(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i*1000+j)))
+				if j%10 == 0 {
+					store.DeleteAllForMethod(context.Background(), "method1")
+				}
+				if j%50 == 0 {
+					store.DeleteAll(context.Background())
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				matcher.Match(context.Background(), "method1", fmt.Sprintf("{\"id\":%d}", i*1000+j))
+				allStubs(t, store)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkInMemoryStubsStore_AddUpdateDelete(b *testing.B) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 100; i++ {
+		store.Add(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.Add(context.Background(), newTestStub("method2", "{\"id\":1}"))
+		store.Update(context.Background(), newTestStub("method2", "{\"id\":1}"))
+		store.Delete(context.Background(), newTestStub("method2", "{\"id\":1}"))
+	}
+}
+
+// The stubs are added to a single method, which used to copy and sort all its stubs on every add
+func BenchmarkInMemoryStubsStore_AddToMethod(b *testing.B) {
+	for _, count := range []int{10000, 20000} {
+		b.Run(fmt.Sprintf("%d stubs", count), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				store := NewInMemoryStubsStore()
+				for j := 0; j < count; j++ {
+					store.Add(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", j)))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInMemoryStubsStore_AddAllToMethod(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stubs := make([]*Stub, 0, 20000)
+		for j := 0; j < 20000; j++ {
+			stubs = append(stubs, newTestStub("method1", fmt.Sprintf("{\"id\":%d}", j)))
+		}
+		NewInMemoryStubsStore().AddAll(context.Background(), stubs)
+	}
+}
+
+// rwMutexStubs reproduces the previous design of the store, where reads copied the stubs of the method holding a
+// read lock, to compare it with the copy-on-write index.
+type rwMutexStubs struct {
+	stubs map[string]*Stub
+	mutex sync.RWMutex
+}
+
+func (r *rwMutexStubs) getStubs() []*Stub {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stubs := make([]*Stub, 0, len(r.stubs))
+	for _, e := range r.stubs {
+		stubs = append(stubs, e)
+	}
+	return stubs
+}
+
+func (r *rwMutexStubs) add(e *Stub) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stubs[e.Request.String()] = e
+}
+
+func BenchmarkStubsRead_CopyOnWrite(b *testing.B) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 100; i++ {
+		store.Add(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			store.GetStubsForMethod(context.Background(), "method1")
+		}
+	})
+}
+
+func BenchmarkStubsRead_RWMutex(b *testing.B) {
+	stubs := &rwMutexStubs{stubs: make(map[string]*Stub)}
+	for i := 0; i < 100; i++ {
+		stubs.add(newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stubs.getStubs()
+		}
+	})
+}
+
+func BenchmarkStubsReadWhileWriting_CopyOnWrite(b *testing.B) {
+	store := NewInMemoryStubsStore()
+	for i := 0; i < 100; i++ {
+		store.Add(context.Background(), newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				store.Add(context.Background(), newTestStub("method2", fmt.Sprintf("{\"id\":%d}", i)))
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			store.GetStubsForMethod(context.Background(), "method1")
+		}
+	})
+}
+
+func BenchmarkStubsReadWhileWriting_RWMutex(b *testing.B) {
+	stubs := &rwMutexStubs{stubs: make(map[string]*Stub)}
+	for i := 0; i < 100; i++ {
+		stubs.add(newTestStub("method1", fmt.Sprintf("{\"id\":%d}", i)))
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				stubs.add(newTestStub("method2", fmt.Sprintf("{\"id\":%d}", i)))
+			}
+		}
+	}()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stubs.getStubs()
+		}
+	})
+}
+
+func TestInMemoryStubsStore_Add_Limits(t *testing.T) {
+	ctx := context.Background()
+	add := func(store StubsStore, method, request string) error {
+		return store.Add(ctx, newTestStub(method, request))
+	}
+	requests := func(store StubsStore) []string {
+		list := make([]string, 0)
+		for _, s := range allStubs(t, store) {
+			list = append(list, s.FullMethod+" "+s.Request.Content.String())
+		}
+		sort.Strings(list)
+		return list
+	}
+
+	rejecting := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubs: 2, MaxStubsPerMethod: 1}))
+	assert.NoError(t, add(rejecting, "method1", `{"id":1}`))
+	assert.True(t, errors.Is(add(rejecting, "method1", `{"id":2}`), ErrLimitExceeded))
+	assert.NoError(t, add(rejecting, "method2", `{"id":1}`))
+	assert.True(t, errors.Is(add(rejecting, "method3", `{"id":1}`), ErrLimitExceeded))
+	assert.Equal(t, StoreStats{Stubs: 2, Limits: StubLimits{MaxStubs: 2, MaxStubsPerMethod: 1}, Rejections: 2},
+		rejecting.(StoreStatsReporter).GetStats(ctx))
+
+	oldest := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubs: 3, MaxStubsPerMethod: 2, Eviction: EvictionOldest}))
+	for _, request := range []string{`{"id":1}`, `{"id":2}`, `{"id":3}`} {
+		assert.NoError(t, add(oldest, "method1", request))
+	}
+	assert.Equal(t, []string{`method1 {"id":2}`, `method1 {"id":3}`}, requests(oldest))
+	assert.NoError(t, add(oldest, "method2", `{"id":1}`))
+	assert.NoError(t, add(oldest, "method2", `{"id":2}`))
+	assert.Equal(t, []string{`method1 {"id":3}`, `method2 {"id":1}`, `method2 {"id":2}`}, requests(oldest))
+	assert.Equal(t, int64(2), oldest.(StoreStatsReporter).GetStats(ctx).Evictions)
+
+	lru := NewInMemoryStubsStore(WithStubLimits(StubLimits{MaxStubs: 2, Eviction: EvictionLRU}))
+	assert.NoError(t, add(lru, "method1", `{"id":1}`))
+	assert.NoError(t, add(lru, "method1", `{"id":2}`))
+	lru.(StubHitRecorder).RecordHit(stubsForMethod(t, lru, "method1")[0].ID)
+	hit := stubsForMethod(t, lru, "method1")[0].Request.Content.String()
+	assert.NoError(t, add(lru, "method2", `{"id":1}`))
+	assert.Equal(t, []string{"method1 " + hit, `method2 {"id":1}`}, requests(lru))
+}
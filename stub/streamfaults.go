@@ -0,0 +1,83 @@
+package stub
+
+import "fmt"
+
+// StreamFaults changes the messages of a stream as an unreliable server or network would, to test the assumptions of
+// the clients about their delivery. The messages are identified by their index in the stream of the stub, from 0.
+type StreamFaults struct {
+	// Duplicate sends the messages twice in a row
+	Duplicate []int `json:"duplicate,omitempty"`
+	// Drop doesn't send the messages
+	Drop []int `json:"drop,omitempty"`
+	// Swap exchanges the positions of pairs of messages, e.g. [[1, 2]] sends the third message before the second one
+	Swap [][]int `json:"swap,omitempty"`
+}
+
+// apply returns the messages in the order they are sent, with the faults applied. The swaps are applied first, so a
+// message swapped is still dropped or duplicated. The indexes out of range are ignored.
+func (f *StreamFaults) apply(messages []interface{}) []interface{} {
+	if f == nil {
+		return messages
+	}
+	order := make([]int, len(messages))
+	for i := range order {
+		order[i] = i
+	}
+	for _, pair := range f.Swap {
+		if len(pair) == 2 && inRange(pair[0], len(order)) && inRange(pair[1], len(order)) {
+			order[pair[0]], order[pair[1]] = order[pair[1]], order[pair[0]]
+		}
+	}
+	faulted := make([]interface{}, 0, len(messages)+len(f.Duplicate))
+	for _, index := range order {
+		if containsIndex(f.Drop, index) {
+			continue
+		}
+		faulted = append(faulted, messages[index])
+		if containsIndex(f.Duplicate, index) {
+			faulted = append(faulted, messages[index])
+		}
+	}
+	return faulted
+}
+
+// validate checks the indexes against the number of messages of the stream, unknown (-1) when they are produced by a
+// script
+func (f *StreamFaults) validate(messages int) (errMsgs []string) {
+	checkIndex := func(fault string, index int) {
+		if index < 0 || (messages >= 0 && index >= messages) {
+			errMsgs = append(errMsgs, fmt.Sprintf("Stream faults %s message %d doesn't exist.", fault, index))
+		}
+	}
+	for _, index := range f.Duplicate {
+		checkIndex("duplicate", index)
+		if containsIndex(f.Drop, index) {
+			errMsgs = append(errMsgs, fmt.Sprintf("Stream faults can't both drop and duplicate message %d.", index))
+		}
+	}
+	for _, index := range f.Drop {
+		checkIndex("drop", index)
+	}
+	for _, pair := range f.Swap {
+		if len(pair) != 2 {
+			errMsgs = append(errMsgs, fmt.Sprintf("Stream faults swap %v must be a pair of messages.", pair))
+			continue
+		}
+		checkIndex("swap", pair[0])
+		checkIndex("swap", pair[1])
+	}
+	return errMsgs
+}
+
+func inRange(index, length int) bool {
+	return index >= 0 && index < length
+}
+
+func containsIndex(indexes []int, index int) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStreamFaults_Apply(t *testing.T) {
+	messages := []interface{}{"a", "b", "c", "d"}
+	var noFaults *StreamFaults
+	assert.Equal(t, messages, noFaults.apply(messages))
+
+	faults := &StreamFaults{Duplicate: []int{3}, Drop: []int{0}, Swap: [][]int{{1, 2}, {3, 9}}}
+	assert.Equal(t, []interface{}{"c", "b", "d", "d"}, faults.apply(messages))
+}
+
+func TestStreamFaults_Validate(t *testing.T) {
+	assert.Empty(t, (&StreamFaults{Duplicate: []int{0}, Swap: [][]int{{0, 1}}}).validate(2))
+	assert.Empty(t, (&StreamFaults{Drop: []int{5}}).validate(-1))
+	assert.Equal(t, []string{
+		"Stream faults duplicate message 2 doesn't exist.",
+		"Stream faults can't both drop and duplicate message 2.",
+		"Stream faults drop message 2 doesn't exist.",
+		"Stream faults swap [0] must be a pair of messages.",
+		"Stream faults swap message -1 doesn't exist.",
+	}, (&StreamFaults{Duplicate: []int{2}, Drop: []int{2}, Swap: [][]int{{0}, {-1, 1}}}).validate(2))
+}
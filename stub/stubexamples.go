@@ -2,73 +2,286 @@ package stub
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/json"
 	"google.golang.org/protobuf/proto"
-	"reflect"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"strings"
+	"sync"
 )
 
+// ExampleValueProvider gives the values of the fields in the examples of the stubs (see CreateStubExample), e.g. to
+// give the IDs of a domain their format. The value is encoded in JSON as it is, and is a single element for the
+// repeated fields and a single value for the maps. found is false when the provider has no value for the field.
+type ExampleValueProvider interface {
+	ExampleValue(field protoreflect.FieldDescriptor) (value interface{}, found bool)
+}
+
+// ExampleValueProviderFunc is a function used as ExampleValueProvider
+type ExampleValueProviderFunc func(field protoreflect.FieldDescriptor) (interface{}, bool)
+
+func (f ExampleValueProviderFunc) ExampleValue(field protoreflect.FieldDescriptor) (interface{}, bool) {
+	return f(field)
+}
+
+var exampleValueProviders struct {
+	providers []ExampleValueProvider
+	mutex     sync.RWMutex
+}
+
+// RegisterExampleValueProvider adds a provider of the values of the examples, tried before the providers registered
+// before it. The fields it has no value for get the default values, made from their names and types.
+func RegisterExampleValueProvider(provider ExampleValueProvider) {
+	exampleValueProviders.mutex.Lock()
+	defer exampleValueProviders.mutex.Unlock()
+
+	exampleValueProviders.providers = append([]ExampleValueProvider{provider}, exampleValueProviders.providers...)
+}
+
+// CreateStubExample returns an example of the message in JSON, with sensible values for the fields given their names
+// and types, e.g. an email address for email or a date for the timestamps. Only the first field of each oneof is set
+// and the recursive fields are left out.
 func CreateStubExample(req proto.Message) string {
-	// TODO make marshal work with child structs
-	return generateJSONForType(reflect.TypeOf(req).Elem(), &bytes.Buffer{}).String()
+	exampleValueProviders.mutex.RLock()
+	providers := exampleValueProviders.providers
+	exampleValueProviders.mutex.RUnlock()
+
+	example := exampleGenerator{providers: providers, visiting: make(map[protoreflect.FullName]bool)}
+	data, _ := json.Marshal(example.message(req.ProtoReflect().Descriptor()))
+	return string(data)
 }
 
-func generateJSONForType(t reflect.Type, writer *bytes.Buffer) *bytes.Buffer {
-	if t.Kind() != reflect.Struct || t.NumField() == 0 {
-		return writer
-	}
-	writer.WriteString("{")
-	first := true
-	for i := 0; i < t.NumField(); i++ {
-		json, ok := t.Field(i).Tag.Lookup("json")
-		if !ok {
-			continue
+type exampleGenerator struct {
+	providers []ExampleValueProvider
+	// visiting are the messages being generated, to leave out the recursive fields
+	visiting map[protoreflect.FullName]bool
+}
+
+// exampleObject is a JSON object that keeps the order of the fields
+type exampleObject struct {
+	names  []string
+	values map[string]interface{}
+}
+
+func (o *exampleObject) set(name string, value interface{}) {
+	o.names = append(o.names, name)
+	o.values[name] = value
+}
+
+func (o *exampleObject) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString("{")
+	for i, name := range o.names {
+		if i > 0 {
+			buffer.WriteString(",")
 		}
-		if json == "-" {
-			continue
+		key, _ := json.Marshal(name)
+		value, err := json.Marshal(o.values[name])
+		if err != nil {
+			return nil, err
 		}
-		json = strings.Replace(json, ",omitempty", "", 1)
-		if !first {
-			writer.WriteString(", ")
+		buffer.Write(key)
+		buffer.WriteString(":")
+		buffer.Write(value)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+func (g exampleGenerator) message(message protoreflect.MessageDescriptor) interface{} {
+	if value, found := wellKnownTypeExample(message); found {
+		return value
+	}
+	g.visiting[message.FullName()] = true
+	defer delete(g.visiting, message.FullName())
+
+	object := &exampleObject{values: make(map[string]interface{})}
+	oneofs := make(map[protoreflect.FullName]bool)
+	fields := message.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			if oneofs[oneof.FullName()] {
+				continue
+			}
+			oneofs[oneof.FullName()] = true
 		}
-		first = false
-		switch t.Field(i).Type.Kind() {
-		case reflect.Ptr:
-			writer.WriteString(fmt.Sprintf("\"%s\": ", json))
-			generateJSONForType(t.Field(i).Type.Elem(), writer)
-		case reflect.Struct:
-			writer.WriteString(fmt.Sprintf("\"%s\": ", json))
-			generateJSONForType(t.Field(i).Type, writer)
-		case reflect.String:
-			writer.WriteString(fmt.Sprintf("\"%s\": \"\"", json))
-		case reflect.Array:
-			writer.WriteString(fmt.Sprintf("\"%s\": [ARRAY]", json)) // Should not happen, leaving ARRAY to indicate to the consumer that it may need work
-			generateJSONForType(t.Field(i).Type, writer)
-		case reflect.Slice:
-			writer.WriteString(fmt.Sprintf("\"%s\": [", json))
-			switch t.Field(i).Type.Elem().Kind() {
-			case reflect.Struct:
-				generateJSONForType(t.Field(i).Type.Elem(), writer)
-			case reflect.Ptr:
-				generateJSONForType(t.Field(i).Type.Elem().Elem(), writer)
+		switch {
+		case field.IsMap():
+			if g.isRecursive(field.MapValue()) {
+				object.set(field.JSONName(), map[string]interface{}{})
+				continue
+			}
+			key := g.value(field.MapKey())
+			object.set(field.JSONName(), map[string]interface{}{mapKeyExample(key): g.value(field.MapValue())})
+		case field.IsList():
+			if g.isRecursive(field) {
+				object.set(field.JSONName(), []interface{}{})
+				continue
 			}
-			writer.WriteString("]")
-		case reflect.Map:
-			writer.WriteString(fmt.Sprintf("\"%s\": MAP", json)) // Should not happen, leaving MAP to indicate to the consumer that it may need work
-		case reflect.Bool:
-			writer.WriteString(fmt.Sprintf("\"%s\": true", json))
+			object.set(field.JSONName(), []interface{}{g.value(field)})
 		default:
-			if isEnum(t.Field(i).Type) {
-				val := reflect.New(t.Field(i).Type).Interface()
-				values := getEnumValues(val.(EnumType))
-				writer.WriteString(fmt.Sprintf("\"%s\": \"%s\"", json, strings.Join(values, " | ")))
+			if g.isRecursive(field) {
 				continue
 			}
-			writer.WriteString(fmt.Sprintf("\"%s\": 0", json))
+			object.set(field.JSONName(), g.value(field))
 		}
 	}
-	writer.WriteString("}")
-	return writer
+	return object
+}
+
+func (g exampleGenerator) isRecursive(field protoreflect.FieldDescriptor) bool {
+	return field.Message() != nil && g.visiting[field.Message().FullName()]
+}
+
+// value returns a value of the field, given by the providers or, otherwise, made from its name and type
+func (g exampleGenerator) value(field protoreflect.FieldDescriptor) interface{} {
+	for _, provider := range g.providers {
+		if value, found := provider.ExampleValue(field); found {
+			return value
+		}
+	}
+	if field.Message() != nil {
+		if wrapped := wrappedField(field.Message()); wrapped != nil {
+			return scalarExample(string(field.Name()), wrapped.Kind(), nil)
+		}
+		return g.message(field.Message())
+	}
+	return scalarExample(string(field.Name()), field.Kind(), field.Enum())
+}
+
+// wrappedField returns the value field of the wrapper messages of google.protobuf, e.g. StringValue
+func wrappedField(message protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	if message.ParentFile() == nil || message.ParentFile().Path() != "google/protobuf/wrappers.proto" {
+		return nil
+	}
+	return message.Fields().ByName("value")
+}
+
+func wellKnownTypeExample(message protoreflect.MessageDescriptor) (interface{}, bool) {
+	switch message.FullName() {
+	case "google.protobuf.Timestamp":
+		return exampleTimestamp, true
+	case "google.protobuf.Duration":
+		return "1.5s", true
+	case "google.protobuf.FieldMask":
+		return "", true
+	case "google.protobuf.Struct", "google.protobuf.Empty":
+		return map[string]interface{}{}, true
+	case "google.protobuf.ListValue":
+		return []interface{}{}, true
+	case "google.protobuf.Value":
+		return nil, true
+	case "google.protobuf.Any":
+		return map[string]interface{}{"@type": "type.googleapis.com/google.protobuf.Empty"}, true
+	}
+	return nil, false
+}
+
+// mapKeyExample returns the key of a map in JSON, where the keys are always strings
+func mapKeyExample(key interface{}) string {
+	if str, ok := key.(string); ok {
+		return str
+	}
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+const (
+	exampleTimestamp = "2024-01-15T09:30:00Z"
+	exampleDate      = "2024-01-15"
+	exampleUUID      = "3f2b8c1e-6a4d-4e1b-9c7a-2d5e8f0a1b3c"
+)
+
+// stringExamples are the examples of the string fields whose names end with the suffix, tried in order
+var stringExamples = []struct {
+	suffixes []string
+	example  string
+}{
+	{[]string{"email", "email_address"}, "jane.doe@example.com"},
+	{[]string{"url", "uri", "link", "website"}, "https://example.com"},
+	{[]string{"phone", "phone_number", "mobile"}, "+14155550100"},
+	{[]string{"uuid", "id"}, exampleUUID},
+	{[]string{"first_name", "given_name"}, "Jane"},
+	{[]string{"last_name", "surname", "family_name"}, "Doe"},
+	{[]string{"username", "user_name", "login"}, "jdoe"},
+	{[]string{"name"}, "Jane Doe"},
+	{[]string{"country", "country_code"}, "US"},
+	{[]string{"currency", "currency_code"}, "USD"},
+	{[]string{"language", "language_code", "locale"}, "en-US"},
+	{[]string{"city"}, "San Francisco"},
+	{[]string{"street", "address", "address_line"}, "1 Market St"},
+	{[]string{"zip", "zip_code", "postal_code", "postcode"}, "94105"},
+	{[]string{"ip", "ip_address"}, "192.0.2.1"},
+	{[]string{"date", "birthday"}, exampleDate},
+	{[]string{"time", "timestamp", "_at"}, exampleTimestamp},
+	{[]string{"timezone", "time_zone"}, "America/Los_Angeles"},
+	{[]string{"color", "colour"}, "#1e90ff"},
+	{[]string{"token", "password", "secret", "api_key"}, "s3cr3t"},
+	{[]string{"description", "comment", "note", "notes", "message", "text"}, "Lorem ipsum dolor sit amet"},
+	{[]string{"title", "subject"}, "Example title"},
+}
+
+// scalarExample returns an example of a value of a field with the name and kind given
+func scalarExample(name string, kind protoreflect.Kind, enum protoreflect.EnumDescriptor) interface{} {
+	name = strings.ToLower(name)
+	hasSuffix := func(suffixes ...string) bool {
+		for _, suffix := range suffixes {
+			if name == suffix || strings.HasSuffix(name, "_"+suffix) || (strings.HasPrefix(suffix, "_") && strings.HasSuffix(name, suffix)) {
+				return true
+			}
+		}
+		return false
+	}
+	switch kind {
+	case protoreflect.StringKind:
+		for _, examples := range stringExamples {
+			if hasSuffix(examples.suffixes...) {
+				return examples.example
+			}
+		}
+		return name
+	case protoreflect.BytesKind:
+		return "ZXhhbXBsZQ=="
+	case protoreflect.BoolKind:
+		return true
+	case protoreflect.EnumKind:
+		// The zero value is usually the unspecified one
+		values := enum.Values()
+		for i := 0; i < values.Len(); i++ {
+			if values.Get(i).Number() != 0 {
+				return string(values.Get(i).Name())
+			}
+		}
+		return string(values.Get(0).Name())
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		switch {
+		case hasSuffix("latitude", "lat"):
+			return 37.7749
+		case hasSuffix("longitude", "lng", "lon"):
+			return -122.4194
+		case hasSuffix("price", "amount", "cost", "total", "balance"):
+			return 9.99
+		case hasSuffix("rate", "ratio", "percentage", "score"):
+			return 0.5
+		}
+		return 1.5
+	}
+	switch {
+	case hasSuffix("age"):
+		return 30
+	case hasSuffix("year"):
+		return 2024
+	case hasSuffix("month"):
+		return 1
+	case hasSuffix("port"):
+		return 8080
+	case hasSuffix("page_size", "limit", "max_results"):
+		return 10
+	case hasSuffix("offset", "skip"):
+		return 0
+	case hasSuffix("seconds", "timestamp", "time"):
+		return 1705311000
+	}
+	return 1
 }
 
 func getEnumValues(enum EnumType) []string {
@@ -0,0 +1,106 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func newExampleMessage(t *testing.T) proto.Message {
+	field := func(name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   fieldType.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+	inOneof := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.OneofIndex = proto.Int32(0)
+		return f
+	}
+	user := &descriptorpb.DescriptorProto{
+		Name: proto.String("User"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			field("user_id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("email", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			field("age", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, ""),
+			field("status", 4, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".acme.Status"),
+			field("created_at", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+			field("nickname", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.StringValue"),
+			repeated(field("friends", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".acme.User")),
+			repeated(field("attributes", 8, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".acme.User.AttributesEntry")),
+			inOneof(field("phone", 9, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")),
+			inOneof(field("website_url", 10, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")),
+			field("balance", 11, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, ""),
+		},
+		NestedType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("AttributesEntry"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+			},
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+		}},
+		OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("contact")}},
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("acme/user.proto"),
+		Package:    proto.String("acme"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("STATUS_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{user},
+	}
+	file, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	assert.NoError(t, err)
+	return dynamicpb.NewMessage(file.Messages().ByName("User"))
+}
+
+func TestCreateStubExample(t *testing.T) {
+	message := newExampleMessage(t)
+	example := CreateStubExample(message)
+
+	assert.Equal(t, `{"userId":"3f2b8c1e-6a4d-4e1b-9c7a-2d5e8f0a1b3c","email":"jane.doe@example.com","age":30,`+
+		`"status":"ACTIVE","createdAt":"2024-01-15T09:30:00Z","nickname":"nickname","friends":[],`+
+		`"attributes":{"key":1},"phone":"+14155550100","balance":9.99}`, example)
+	// The example is valid in the JSON mapping of protobuf
+	assert.NoError(t, protojson.Unmarshal([]byte(example), message))
+}
+
+func TestRegisterExampleValueProvider(t *testing.T) {
+	defer func(providers []ExampleValueProvider) { exampleValueProviders.providers = providers }(exampleValueProviders.providers)
+	RegisterExampleValueProvider(ExampleValueProviderFunc(func(field protoreflect.FieldDescriptor) (interface{}, bool) {
+		if field.Name() == "user_id" {
+			return "usr_123", true
+		}
+		return nil, false
+	}))
+
+	example := CreateStubExample(newExampleMessage(t))
+
+	assert.Contains(t, example, `"userId":"usr_123"`)
+	assert.Contains(t, example, `"email":"jane.doe@example.com"`)
+}
@@ -0,0 +1,234 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// StubSet describes a stub set: its number of stubs and the sessions it is active for
+type StubSet struct {
+	Name  string `json:"name"`
+	Stubs int    `json:"stubs"`
+	// Sessions are the sessions the set is active for, GlobalStateScope for the calls of every session without a set
+	// of its own
+	Sessions []string `json:"sessions,omitempty"`
+	// Split is the percentage of the calls of each session that use the set, for the sessions split between sets
+	Split map[string]int `json:"split,omitempty"`
+}
+
+// StubSetSplit splits the calls of a session between stub sets by percentage, e.g. 90% for stable and 10% for
+// canary, to simulate a canaried upstream whose responses differ between versions
+type StubSetSplit struct {
+	// Sets are the sets and their percentages of the calls, which add up to 100
+	Sets []WeightedStubSet `json:"sets"`
+	// StickyMetadata is the metadata key (e.g. x-user-id) whose value sends the calls to the same set every time, as
+	// the routers of the canaries do. The set of each call is random otherwise.
+	StickyMetadata string `json:"stickyMetadata,omitempty"`
+}
+
+type WeightedStubSet struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+func (s StubSetSplit) Validate() error {
+	if len(s.Sets) < 2 {
+		return fmt.Errorf("invalid stub set split: at least two sets are required")
+	}
+	total := 0
+	names := make(map[string]bool, len(s.Sets))
+	for _, set := range s.Sets {
+		if set.Name == "" || names[set.Name] {
+			return fmt.Errorf("invalid stub set split: the sets must have distinct names")
+		}
+		if set.Weight < 0 {
+			return fmt.Errorf("invalid stub set split: the weight of %s is negative", set.Name)
+		}
+		names[set.Name] = true
+		total += set.Weight
+	}
+	if total != 100 {
+		return fmt.Errorf("invalid stub set split: the weights add up to %d instead of 100", total)
+	}
+	return nil
+}
+
+// choose returns the set of the call: the one of the value of the sticky metadata, when the call has it, or a random
+// one
+func (s *StubSetSplit) choose(ctx context.Context) string {
+	var point int
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(s.StickyMetadata); s.StickyMetadata != "" && len(values) > 0 {
+		hash := fnv.New32a()
+		hash.Write([]byte(values[0]))
+		point = int(hash.Sum32() % 100)
+	} else {
+		point = random.Intn(100)
+	}
+	for _, set := range s.Sets {
+		if point < set.Weight {
+			return set.Name
+		}
+		point -= set.Weight
+	}
+	return ""
+}
+
+// StubSetsStore keeps the stub set active for each session (see StateSessionMetadataKey), so that two or more
+// versions of the stubs (e.g. blue and green) can be loaded at once and the tests switch between them instantly. The
+// stubs of a set only match the calls of the sessions it is active for, and the calls of the sessions without a set
+// of their own use the set active for GlobalStateScope. Implementations must be safe for concurrent use.
+type StubSetsStore interface {
+	// GetActive returns the set active for the session, the global one when none was activated for it and empty
+	// when none is active or the calls are split between sets
+	GetActive(session string) string
+	// Activate makes the set the active one of the session, replacing the previous one (or split) at once. Activating
+	// an empty set deactivates the set of the session.
+	Activate(session, set string)
+	// GetAllActive returns the set active for each session
+	GetAllActive() map[string]string
+	// Split splits the calls of the session between the sets of the split, replacing the set active for it
+	Split(session string, split StubSetSplit)
+	// GetSplit returns the split of the calls of the session, the global one when the session has neither a set nor a
+	// split of its own, and nil when there is none
+	GetSplit(session string) *StubSetSplit
+	// GetAllSplits returns the split of the calls of each session
+	GetAllSplits() map[string]StubSetSplit
+	// Reset deactivates the sets and the splits of all the sessions
+	Reset()
+}
+
+func NewInMemoryStubSetsStore() StubSetsStore {
+	return &inMemoryStubSetsStore{
+		active: make(map[string]string, 0),
+		splits: make(map[string]StubSetSplit, 0),
+	}
+}
+
+type inMemoryStubSetsStore struct {
+	active map[string]string
+	splits map[string]StubSetSplit
+	mutex  sync.RWMutex
+}
+
+func (s *inMemoryStubSetsStore) GetActive(session string) string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if set, ok := s.active[session]; ok {
+		return set
+	}
+	if _, ok := s.splits[session]; ok {
+		return ""
+	}
+	return s.active[GlobalStateScope]
+}
+
+func (s *inMemoryStubSetsStore) Activate(session, set string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.splits, session)
+	if set == "" {
+		delete(s.active, session)
+		return
+	}
+	s.active[session] = set
+}
+
+func (s *inMemoryStubSetsStore) Split(session string, split StubSetSplit) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.active, session)
+	split.Sets = append([]WeightedStubSet(nil), split.Sets...)
+	s.splits[session] = split
+}
+
+func (s *inMemoryStubSetsStore) GetSplit(session string) *StubSetSplit {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	split, ok := s.splits[session]
+	if !ok {
+		if _, active := s.active[session]; active {
+			return nil
+		}
+		if split, ok = s.splits[GlobalStateScope]; !ok {
+			return nil
+		}
+	}
+	return &split
+}
+
+func (s *inMemoryStubSetsStore) GetAllSplits() map[string]StubSetSplit {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	splits := make(map[string]StubSetSplit, len(s.splits))
+	for session, split := range s.splits {
+		splits[session] = split
+	}
+	return splits
+}
+
+func (s *inMemoryStubSetsStore) GetAllActive() map[string]string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	active := make(map[string]string, len(s.active))
+	for session, set := range s.active {
+		active[session] = set
+	}
+	return active
+}
+
+func (s *inMemoryStubSetsStore) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.active = make(map[string]string, 0)
+	s.splits = make(map[string]StubSetSplit, 0)
+}
+
+// GetStubSets lists the sets of the stubs and the ones active for a session, sorted by name
+func GetStubSets(stubs []*Stub, sets StubSetsStore) []*StubSet {
+	byName := make(map[string]*StubSet, 0)
+	get := func(name string) *StubSet {
+		if _, ok := byName[name]; !ok {
+			byName[name] = &StubSet{Name: name}
+		}
+		return byName[name]
+	}
+	for _, e := range stubs {
+		if e.Set != "" {
+			get(e.Set).Stubs++
+		}
+	}
+	for session, name := range sets.GetAllActive() {
+		set := get(name)
+		set.Sessions = append(set.Sessions, session)
+	}
+	for session, split := range sets.GetAllSplits() {
+		for _, weighted := range split.Sets {
+			set := get(weighted.Name)
+			if set.Split == nil {
+				set.Split = make(map[string]int)
+			}
+			set.Split[session] = weighted.Weight
+		}
+	}
+	result := make([]*StubSet, 0, len(byName))
+	for _, set := range byName {
+		sort.Strings(set.Sessions)
+		result = append(result, set)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
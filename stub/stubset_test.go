@@ -0,0 +1,97 @@
+package stub
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+)
+
+func TestStubsMatcher_Match_StubSets(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	blue := newTestStub("method1", "{\"name\":\"John\"}")
+	blue.Set = "blue"
+	green := newTestStub("method1", "{\"name\":\"John\"}")
+	green.Set = "green"
+	assert.NoError(t, store.Add(context.Background(), blue))
+	assert.NoError(t, store.Add(context.Background(), green))
+	sets := NewInMemoryStubSetsStore()
+	matcher := NewStubsMatcher(store, WithStubSets(sets))
+	session := metadata.NewIncomingContext(context.Background(), metadata.Pairs(StateSessionMetadataKey, "test-1"))
+
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	sets.Activate(GlobalStateScope, "blue")
+	assert.Equal(t, blue, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, blue, matcher.Match(session, "method1", "{\"name\":\"John\"}"))
+
+	sets.Activate("test-1", "green")
+	assert.Equal(t, blue, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+	assert.Equal(t, green, matcher.Match(session, "method1", "{\"name\":\"John\"}"))
+
+	sets.Activate("test-1", "")
+	assert.Equal(t, blue, matcher.Match(session, "method1", "{\"name\":\"John\"}"))
+}
+
+func TestGetStubSets(t *testing.T) {
+	blue := newTestStub("method1", "{}")
+	blue.Set = "blue"
+	sets := NewInMemoryStubSetsStore()
+	sets.Activate(GlobalStateScope, "blue")
+	sets.Activate("test-1", "green")
+	sets.Activate("test-2", "blue")
+
+	assert.Equal(t, []*StubSet{
+		{Name: "blue", Stubs: 1, Sessions: []string{GlobalStateScope, "test-2"}},
+		{Name: "green", Sessions: []string{"test-1"}},
+	}, GetStubSets([]*Stub{blue, newTestStub("method2", "{}")}, sets))
+
+	sets.Reset()
+	assert.Equal(t, []*StubSet{{Name: "blue", Stubs: 1}}, GetStubSets([]*Stub{blue}, sets))
+}
+
+func TestStubsMatcher_Match_StubSetSplit(t *testing.T) {
+	store := NewInMemoryStubsStore()
+	stable := newTestStub("method1", "{\"name\":\"John\"}")
+	stable.Set = "stable"
+	canary := newTestStub("method1", "{\"name\":\"John\"}")
+	canary.Set = "canary"
+	assert.NoError(t, store.Add(context.Background(), stable))
+	assert.NoError(t, store.Add(context.Background(), canary))
+	sets := NewInMemoryStubSetsStore()
+	matcher := NewStubsMatcher(store, WithStubSets(sets))
+	session := metadata.NewIncomingContext(context.Background(), metadata.Pairs(StateSessionMetadataKey, "test-1"))
+
+	split := StubSetSplit{Sets: []WeightedStubSet{{Name: "stable", Weight: 80}, {Name: "canary", Weight: 20}}}
+	assert.NoError(t, split.Validate())
+	sets.Split("test-1", split)
+	matched := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		matched[matcher.Match(session, "method1", "{\"name\":\"John\"}").Set]++
+	}
+	assert.InDelta(t, 800, matched["stable"], 80)
+	assert.InDelta(t, 200, matched["canary"], 80)
+	// The other sessions are not split
+	assert.Nil(t, matcher.Match(context.Background(), "method1", "{\"name\":\"John\"}"))
+
+	// The calls with the same value of the sticky metadata always use the same set
+	split.StickyMetadata = "x-user-id"
+	sets.Split(GlobalStateScope, split)
+	user := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user-id", "user-42"))
+	first := matcher.Match(user, "method1", "{\"name\":\"John\"}")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, matcher.Match(user, "method1", "{\"name\":\"John\"}"))
+	}
+
+	// Activating a set replaces the split
+	sets.Activate("test-1", "canary")
+	assert.Equal(t, canary, matcher.Match(session, "method1", "{\"name\":\"John\"}"))
+	assert.Nil(t, sets.GetSplit("test-1"))
+	assert.Equal(t, map[string]int{GlobalStateScope: 20}, GetStubSets([]*Stub{stable, canary}, sets)[0].Split)
+}
+
+func TestStubSetSplit_Validate(t *testing.T) {
+	assert.Error(t, StubSetSplit{Sets: []WeightedStubSet{{Name: "stable", Weight: 100}}}.Validate())
+	assert.Error(t, StubSetSplit{Sets: []WeightedStubSet{{Name: "stable", Weight: 50}, {Name: "canary", Weight: 40}}}.Validate())
+	assert.Error(t, StubSetSplit{Sets: []WeightedStubSet{{Name: "stable", Weight: 50}, {Name: "stable", Weight: 50}}}.Validate())
+	assert.Error(t, StubSetSplit{Sets: []WeightedStubSet{{Name: "stable", Weight: 110}, {Name: "canary", Weight: -10}}}.Validate())
+}
@@ -0,0 +1,60 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/grpc/metadata"
+)
+
+// StubTest is a sample call the stub must match, or must not match when NoMatch is set. The tests are run when the
+// stub is added or loaded, and the stub is rejected when any of them fails, so that the stubs carry their own
+// regression checks. The tests check the request, the metadata, the claims, the captures and the matching expression
+// of the stub. The peer, the transport, the scenario and the stub set are not checked.
+type StubTest struct {
+	Name     string              `json:"name,omitempty"`
+	Request  JsonString          `json:"request"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+	NoMatch  bool                `json:"noMatch,omitempty"`
+}
+
+// runTests runs the tests of the stub and returns the messages of the ones that fail
+func (stub *Stub) runTests() (errMsgs []string) {
+	for i, test := range stub.Tests {
+		name := fmt.Sprintf("Test %d", i)
+		if test.Name != "" {
+			name = fmt.Sprintf("Test '%s'", test.Name)
+		}
+		request := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(test.Request), &request); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("%s: the request is not a valid JSON object.", name))
+			continue
+		}
+		md := metadata.MD{}
+		for key, values := range test.Metadata {
+			md.Append(key, values...)
+		}
+		matches := stub.matchesTest(metadata.NewIncomingContext(context.Background(), md), request)
+		switch {
+		case matches && test.NoMatch:
+			errMsgs = append(errMsgs, fmt.Sprintf("%s failed: the stub matches the request %s.", name, test.Request))
+		case !matches && !test.NoMatch:
+			errMsgs = append(errMsgs, fmt.Sprintf("%s failed: the stub doesn't match the request %s.", name, test.Request))
+		}
+	}
+	return errMsgs
+}
+
+// matchesTest checks the request of a test against the stub. The content of the stub is decoded again rather than
+// with parsedContent, as it can still be normalized after the stub is validated.
+func (stub *Stub) matchesTest(ctx context.Context, request map[string]interface{}) bool {
+	contentMatches := false
+	switch stub.Request.Match {
+	case "exact", "partial":
+		contentMatches = jsonStringMatches(stub.Request.Content.toMap(), request, stub.Request.Match == "exact")
+	case "":
+		contentMatches = stub.Request.MatchExpr != ""
+	}
+	return contentMatches && matchMetadata(ctx, stub) && stub.Request.Claims.matches(ctx) &&
+		stub.Request.Capture.matches(request) && stub.Request.matchesExpr(ctx, stub.FullMethod, request)
+}
@@ -0,0 +1,33 @@
+package stub
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestStub_IsValid_Tests(t *testing.T) {
+	s := newTestStub("method1", `{"name":"John"}`)
+	s.Request.Match = "partial"
+	s.Request.Metadata = map[string][]string{"tenant": {"acme"}}
+	s.Tests = []StubTest{
+		{Name: "extra fields", Request: `{"name":"John","age":30}`, Metadata: map[string][]string{"Tenant": {"acme"}}},
+		{Request: `{"name":"Mary"}`, Metadata: map[string][]string{"tenant": {"acme"}}, NoMatch: true},
+		{Request: `{"name":"John"}`, NoMatch: true},
+	}
+	isValid, errMsgs := s.IsValid()
+	assert.True(t, isValid)
+	assert.Empty(t, errMsgs)
+
+	s.Tests = []StubTest{
+		{Name: "other tenant", Request: `{"name":"John"}`, Metadata: map[string][]string{"tenant": {"other"}}},
+		{Request: `{"name":"John"}`, Metadata: map[string][]string{"tenant": {"acme"}}, NoMatch: true},
+		{Request: `[]`},
+	}
+	isValid, errMsgs = s.IsValid()
+	assert.False(t, isValid)
+	assert.Equal(t, []string{
+		`Test 'other tenant' failed: the stub doesn't match the request {"name":"John"}.`,
+		`Test 1 failed: the stub matches the request {"name":"John"}.`,
+		"Test 2: the request is not a valid JSON object.",
+	}, errMsgs)
+}
@@ -0,0 +1,261 @@
+package stub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"google.golang.org/grpc/metadata"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The responses can contain placeholders ${expression} in the string values of their JSON content and in the error
+// messages. A string that is a single placeholder is replaced by the value of the expression with its own type (e.g. a
+// number). Otherwise the values are formatted into the string. $${ is rendered as a literal ${.
+// The expressions that are not a field of the request or the metadata are evaluated in the expression language of the
+// templates (see compileExpr), e.g. ${request.price * request.quantity} or ${addDays(request.start_date, 3)}.
+
+var placeholderPattern = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+var fieldPathPattern = regexp.MustCompile(`^(request|metadata|capture)(\.[\w-]+)+$`)
+
+// The expressions compiled, by their source
+var templateExprs sync.Map
+
+var clock util.Clock = util.SystemClock{}
+
+// SetClock sets the clock used to render the time in the responses
+func SetClock(c util.Clock) {
+	clock = c
+}
+
+// templateData holds the values available to the expressions of a response
+type templateData struct {
+	now      time.Time
+	request  interface{}
+	metadata metadata.MD
+	// captures are the values captured from the request by the stub (see Captures)
+	captures map[string]interface{}
+	// stateScope is the scope of the values of the state (see StateStore)
+	stateScope    string
+	stateReadOnly bool
+}
+
+func newTemplateData(ctx context.Context, s *Stub, requestJson string) *templateData {
+	data := &templateData{
+		now:           clock.Now(),
+		stateScope:    stateScope(ctx, s),
+		stateReadOnly: isStateReadOnly(ctx),
+	}
+	decoder := json.NewDecoder(strings.NewReader(requestJson))
+	decoder.UseNumber()
+	decoder.Decode(&data.request)
+	data.metadata, _ = metadata.FromIncomingContext(ctx)
+	if s != nil && s.Request != nil {
+		data.captures, _ = s.Request.Capture.values(data.request)
+	}
+	return data
+}
+
+// evaluate returns the value of an expression
+func (d *templateData) evaluate(expression string) (interface{}, error) {
+	switch expression {
+	case "now":
+		return d.now.UTC().Format(time.RFC3339Nano), nil
+	case "now.unix":
+		return d.now.Unix(), nil
+	case "now.unixMillis":
+		return d.now.UnixNano() / int64(time.Millisecond), nil
+	}
+	// The fields of the request and the metadata that are not set have no value
+	if fieldPathPattern.MatchString(expression) {
+		if strings.HasPrefix(expression, "request.") {
+			return lookupPath(d.request, strings.Split(strings.TrimPrefix(expression, "request."), ".")), nil
+		}
+		if strings.HasPrefix(expression, "capture.") {
+			return d.captures[strings.TrimPrefix(expression, "capture.")], nil
+		}
+		if values := d.metadata.Get(strings.TrimPrefix(expression, "metadata.")); len(values) > 0 {
+			return values[0], nil
+		}
+		return nil, nil
+	}
+	return d.evaluateExpr(expression)
+}
+
+// evaluateExpr evaluates the expression with the variables request, metadata (each key with a list of values),
+// capture, now and state
+func (d *templateData) evaluateExpr(expression string) (interface{}, error) {
+	compiled, found := templateExprs.Load(expression)
+	if !found {
+		e, err := compileExpr(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template expression %s: %w", expression, err)
+		}
+		compiled, _ = templateExprs.LoadOrStore(expression, e)
+	}
+	md := make(map[string]interface{}, len(d.metadata))
+	for key, values := range d.metadata {
+		list := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			list = append(list, value)
+		}
+		md[key] = list
+	}
+	value, err := compiled.(*templateExpr).root.eval(exprEnv{
+		"request":  exprValue(d.request),
+		"metadata": md,
+		"capture":  exprValue(d.captures),
+		"now":      d.now.UTC().Format(time.RFC3339Nano),
+		"state":    stateVar{scope: d.stateScope, readOnly: d.stateReadOnly},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate the template expression %s: %w", expression, err)
+	}
+	return value, nil
+}
+
+// exprValue converts the numbers of the request decoded from JSON into the doubles of the expressions
+func exprValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case json.Number:
+		number, _ := typedValue.Float64()
+		return number
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(typedValue))
+		for key, item := range typedValue {
+			converted[key] = exprValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, 0, len(typedValue))
+		for _, item := range typedValue {
+			converted = append(converted, exprValue(item))
+		}
+		return converted
+	}
+	return value
+}
+
+// lookupPath returns the value of a field of a decoded JSON value, e.g. customer.addresses.0.city, or nil if it is
+// not set
+func lookupPath(value interface{}, path []string) interface{} {
+	for _, key := range path {
+		switch typedValue := value.(type) {
+		case map[string]interface{}:
+			value = typedValue[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(typedValue) {
+				return nil
+			}
+			value = typedValue[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// formatValue formats a value into a text. Values that are not set are formatted as empty strings.
+func formatValue(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(typedValue)
+		return string(data)
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// HasPlaceholders checks if the text contains template placeholders
+func HasPlaceholders(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+// renderJSON replaces the placeholders in the string values of the JSON content
+func (d *templateData) renderJSON(content JsonString) (JsonString, error) {
+	if !HasPlaceholders(string(content)) {
+		return content, nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(content)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", err
+	}
+	rendered, err := d.renderValue(value)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return "", err
+	}
+	return JsonString(data), nil
+}
+
+func (d *templateData) renderValue(value interface{}) (interface{}, error) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typedValue {
+			rendered, err := d.renderValue(item)
+			if err != nil {
+				return nil, err
+			}
+			typedValue[key] = rendered
+		}
+	case []interface{}:
+		for i, item := range typedValue {
+			rendered, err := d.renderValue(item)
+			if err != nil {
+				return nil, err
+			}
+			typedValue[i] = rendered
+		}
+	case string:
+		return d.renderString(typedValue)
+	}
+	return value, nil
+}
+
+// renderString replaces the placeholders in s. The value of the expression is returned as it is when s is a single
+// placeholder.
+func (d *templateData) renderString(s string) (interface{}, error) {
+	if !HasPlaceholders(s) {
+		return s, nil
+	}
+	matches := placeholderPattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) && s[1] != '$' {
+		return d.evaluate(strings.TrimSpace(s[matches[0][2]:matches[0][3]]))
+	}
+	var renderErr error
+	rendered := placeholderPattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if strings.HasPrefix(placeholder, "$$") {
+			return placeholder[1:]
+		}
+		value, err := d.evaluate(strings.TrimSpace(placeholder[2 : len(placeholder)-1]))
+		if err != nil {
+			renderErr = err
+			return placeholder
+		}
+		return formatValue(value)
+	})
+	return rendered, renderErr
+}
+
+// renderText replaces the placeholders in a text that is not JSON, e.g. an error message
+func (d *templateData) renderText(s string) (string, error) {
+	rendered, err := d.renderString(s)
+	if err != nil {
+		return "", err
+	}
+	return formatValue(rendered), nil
+}
@@ -0,0 +1,118 @@
+package stub
+
+import (
+	"context"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"testing"
+	"time"
+)
+
+func TestTemplateData_RenderJSON(t *testing.T) {
+	data := &templateData{now: time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)}
+
+	rendered, err := data.renderJSON(`{"createdAt":"${now}","epoch":"${now.unix}","text":"at ${ now.unix }","literal":"$${now}","id":12345678901234567890,"items":[{"at":"${now}"}]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, JsonString(`{"createdAt":"2020-05-17T10:30:00Z","epoch":1589711400,"id":12345678901234567890,"items":[{"at":"2020-05-17T10:30:00Z"}],"literal":"${now}","text":"at 1589711400"}`), rendered)
+}
+
+func TestTemplateData_RenderJSON_NoPlaceholders(t *testing.T) {
+	content := JsonString(`{ "name": "John" }`)
+	rendered, err := new(templateData).renderJSON(content)
+	assert.NoError(t, err)
+	assert.Equal(t, content, rendered)
+}
+
+func TestTemplateData_RenderJSON_UnknownExpression(t *testing.T) {
+	_, err := new(templateData).renderJSON(`{"name":"${unknown}"}`)
+	assert.Error(t, err)
+}
+
+func TestGetResponse_Clock(t *testing.T) {
+	clock := util.NewMockClock()
+	clock.Freeze()
+	clock.Set(time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(util.SystemClock{})
+
+	s := &Stub{
+		FullMethod: "method1",
+		Request:    &StubRequest{Match: "exact", Content: "{}"},
+		Response:   &StubResponse{Type: "error", Error: &ErrorResponse{Code: 14, Message: "unavailable until ${now.unix}"}},
+	}
+	_, err := GetResponse(context.Background(), s, "{}", nil)
+	assert.EqualError(t, err, "rpc error: code = Unavailable desc = unavailable until 1589711400")
+}
+
+func TestGetResponse_RequestAndMetadata(t *testing.T) {
+	s := &Stub{
+		FullMethod: "method1",
+		Request:    &StubRequest{Match: "partial", Content: "{}"},
+		Response: &StubResponse{Type: "error", Error: &ErrorResponse{
+			Code:    5,
+			Message: "order ${request.order.id} of ${request.items.0.sku} not found for tenant ${metadata.x-tenant}${request.missing}",
+		}},
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant", "acme"))
+	_, err := GetResponse(ctx, s, `{"order":{"id":12345678901},"items":[{"sku":"A-1"}]}`, nil)
+	assert.EqualError(t, err, "rpc error: code = NotFound desc = order 12345678901 of A-1 not found for tenant acme")
+}
+
+func TestTemplateData_RenderJSON_Request(t *testing.T) {
+	data := newTemplateData(context.Background(), nil, `{"id":7,"tags":["a","b"]}`)
+	rendered, err := data.renderJSON(`{"id":"${request.id}","tags":"${request.tags}","text":"tags ${request.tags}","missing":"${request.name}"}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":7,"tags":["a","b"],"text":"tags [\"a\",\"b\"]","missing":null}`, rendered.String())
+}
+
+func TestTemplateData_RenderJSON_Functions(t *testing.T) {
+	data := newTemplateData(context.Background(), nil, `{"start_date":"2020-02-27","at":"2020-05-17T10:30:00Z","name":"order_line item","items":[{"price":2.5,"quantity":3},{"price":"10","quantity":1}]}`)
+	data.now = time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+
+	rendered, err := data.renderJSON(`{
+		"end":"${addDays(request.start_date, 3)}",
+		"expires":"${addHours(now, 1.5)}",
+		"total":"${round(sum(request.items.map(i, i.price * i.quantity)) * 1.21, 2)}",
+		"text":"total ${sum(request.items.map(i, i.price * i.quantity))}",
+		"checksum":"${sha256(request.name)}",
+		"token":"${base64Encode(request.name)}",
+		"decoded":"${base64Decode('b3JkZXI=')}",
+		"camel":"${camelCase(request.name)}",
+		"kebab":"${kebabCase('orderLineID')}",
+		"title":"${capitalize(request.name)}",
+		"previous":"${addMonths(request.at, -1)}"
+	}`)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"end":"2020-03-01",
+		"expires":"2020-05-17T12:00:00Z",
+		"total":21.18,
+		"text":"total 17.5",
+		"checksum":"9242803462298aeca8bc31ae3d60f35c80e39ffa6d3d85ca5d1e8515a7ca4f7a",
+		"token":"b3JkZXJfbGluZSBpdGVt",
+		"decoded":"order",
+		"camel":"orderLineItem",
+		"kebab":"order-line-id",
+		"title":"Order_line item",
+		"previous":"2020-04-17T10:30:00Z"
+	}`, rendered.String())
+
+	_, err = data.renderJSON(`{"end":"${addDays(request.name, 3)}"}`)
+	assert.EqualError(t, err, "failed to evaluate the template expression addDays(request.name, 3): invalid date: order_line item")
+}
+
+func TestGetResponseMetadata(t *testing.T) {
+	s := &Stub{Response: &StubResponse{
+		Headers:  map[string]string{"x-correlation-id": "${metadata.x-correlation-id}", "x-tenant": "${metadata.x-tenant}"},
+		Trailers: map[string]string{"x-order": "order-${request.id}"},
+	}}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-correlation-id", "c-1"))
+	header, trailer, err := GetResponseMetadata(ctx, s, "{\"id\":7}")
+	assert.NoError(t, err)
+	assert.Equal(t, metadata.Pairs("x-correlation-id", "c-1"), header)
+	assert.Equal(t, metadata.Pairs("x-order", "order-7"), trailer)
+
+	assert.Equal(t, []string{"Response header key 'X-Tenant' is not valid. Expected lowercase letters, digits, _, . or - and no grpc- prefix."},
+		validateResponseMetadata("header", map[string]string{"X-Tenant": "acme", "x-ok": "1"}))
+}
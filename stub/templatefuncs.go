@@ -0,0 +1,227 @@
+package stub
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The functions that derive values in the responses, e.g. checksums, totals and dates relative to the request, in the
+// expressions of the templates.
+
+func hashFunction(newHash func() hash.Hash) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, err := exprText(args[0])
+		if err != nil {
+			return nil, err
+		}
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+}
+
+var (
+	exprSHA256 = hashFunction(sha256.New)
+	exprSHA1   = hashFunction(sha1.New)
+	exprMD5    = hashFunction(md5.New)
+)
+
+func exprBase64Encode(args []interface{}) (interface{}, error) {
+	s, err := exprText(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func exprBase64Decode(args []interface{}) (interface{}, error) {
+	s, err := exprText(args[0])
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		// protojson encodes the bytes fields with the standard encoding, but accepts the URL safe one too
+		if data, err = base64.URLEncoding.DecodeString(s); err != nil {
+			return nil, fmt.Errorf("invalid base64 text: %s", s)
+		}
+	}
+	return string(data), nil
+}
+
+// exprText converts the strings, numbers and booleans into strings
+func exprText(value interface{}) (string, error) {
+	text, err := exprString([]interface{}{value})
+	if err != nil {
+		return "", err
+	}
+	return text.(string), nil
+}
+
+func caseFunction(f func(words []string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a string, got %s", exprTypeName(args[0]))
+		}
+		return f(splitWords(s)), nil
+	}
+}
+
+var (
+	exprCamelCase = caseFunction(func(words []string) string {
+		for i, word := range words {
+			word = strings.ToLower(word)
+			if i > 0 {
+				word = capitalize(word)
+			}
+			words[i] = word
+		}
+		return strings.Join(words, "")
+	})
+	exprSnakeCase = caseFunction(func(words []string) string {
+		return strings.ToLower(strings.Join(words, "_"))
+	})
+	exprKebabCase = caseFunction(func(words []string) string {
+		return strings.ToLower(strings.Join(words, "-"))
+	})
+)
+
+func exprCapitalize(args []interface{}) (interface{}, error) {
+	return exprStringCase(args[0], capitalize)
+}
+
+func capitalize(s string) string {
+	for i, r := range s {
+		return string(unicode.ToUpper(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
+
+// splitWords splits the text into words at the characters that are not letters or digits and where a lower case
+// letter is followed by an upper case one, e.g. orderId, order_id and order-id are all split into order and id
+func splitWords(s string) []string {
+	words := make([]string, 0)
+	var word []rune
+	var previous rune
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = nil
+		case unicode.IsUpper(r) && len(word) > 0 && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			words = append(words, string(word))
+			word = []rune{r}
+		default:
+			word = append(word, r)
+		}
+		previous = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+func numberFunction(f func(float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		number, ok := toExprNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %s", exprTypeName(args[0]))
+		}
+		return f(number), nil
+	}
+}
+
+var (
+	exprFloor = numberFunction(math.Floor)
+	exprCeil  = numberFunction(math.Ceil)
+	exprAbs   = numberFunction(math.Abs)
+)
+
+func numbersFunction(f func(a, b float64) float64) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		a, aok := toExprNumber(args[0])
+		b, bok := toExprNumber(args[1])
+		if !aok || !bok {
+			return nil, fmt.Errorf("expected numbers, got %s and %s", exprTypeName(args[0]), exprTypeName(args[1]))
+		}
+		return f(a, b), nil
+	}
+}
+
+var (
+	exprMin = numbersFunction(math.Min)
+	exprMax = numbersFunction(math.Max)
+	// exprRound rounds the number to a number of decimal places, e.g. round(request.amount * 1.21, 2)
+	exprRound = numbersFunction(func(number, places float64) float64 {
+		scale := math.Pow(10, math.Trunc(places))
+		return math.Round(number*scale) / scale
+	})
+)
+
+// exprSum adds the numbers of a list, e.g. sum(request.items.map(i, i.price * i.quantity))
+func exprSum(args []interface{}) (interface{}, error) {
+	list, ok := args[0].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %s", exprTypeName(args[0]))
+	}
+	var total float64
+	for _, item := range list {
+		number, ok := toExprNumber(item)
+		if !ok {
+			return nil, fmt.Errorf("can't add %s", exprTypeName(item))
+		}
+		total += number
+	}
+	return total, nil
+}
+
+// The dates are RFC 3339 timestamps (protojson encodes google.protobuf.Timestamp as RFC 3339 in UTC) or dates
+// (2006-01-02), and are formatted back in the same layout
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02"}
+
+func dateFunction(add func(t time.Time, n float64) time.Time) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("expected a date, got %s", exprTypeName(args[0]))
+		}
+		n, ok := toExprNumber(args[1])
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %s", exprTypeName(args[1]))
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return add(t, n).Format(layout), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date: %s", s)
+	}
+}
+
+func durationFunction(unit time.Duration) func(args []interface{}) (interface{}, error) {
+	return dateFunction(func(t time.Time, n float64) time.Time {
+		return t.Add(time.Duration(n * float64(unit)))
+	})
+}
+
+var (
+	exprAddYears   = dateFunction(func(t time.Time, n float64) time.Time { return t.AddDate(int(n), 0, 0) })
+	exprAddMonths  = dateFunction(func(t time.Time, n float64) time.Time { return t.AddDate(0, int(n), 0) })
+	exprAddDays    = dateFunction(func(t time.Time, n float64) time.Time { return t.AddDate(0, 0, int(n)) })
+	exprAddHours   = durationFunction(time.Hour)
+	exprAddMinutes = durationFunction(time.Minute)
+	exprAddSeconds = durationFunction(time.Second)
+)
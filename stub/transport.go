@@ -0,0 +1,105 @@
+package stub
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"net"
+	"strings"
+)
+
+// identityCompression is the compression of the messages that are not compressed
+const identityCompression = "identity"
+
+// AuthorityOverrideHeader is the metadata that replaces the :authority of the calls, for the clients that reach all
+// the hosts the mock server impersonates through the same address and can't set the :authority of their calls
+const AuthorityOverrideHeader = "x-mock-authority"
+
+// TransportMatcher matches the attributes of the HTTP/2 request of the call, which tell apart the clients calling
+// through different proxies or gateways. All the attributes set must match.
+type TransportMatcher struct {
+	// Authority is the :authority of the call, e.g. orders.internal:8443, i.e. the virtual host the stub is scoped to.
+	// Without port, it matches the host with any port. It can start with a wildcard, e.g. *.orders.internal.
+	Authority string `json:"authority,omitempty"`
+	// ContentType is the content-type of the call, e.g. application/grpc+proto
+	ContentType string `json:"contentType,omitempty"`
+	// Compression is the compression of the messages of the client, e.g. gzip, or identity when they are not
+	// compressed
+	Compression string `json:"compression,omitempty"`
+}
+
+func (t *TransportMatcher) matches(ctx context.Context) bool {
+	if t == nil {
+		return true
+	}
+	attributes := getTransportAttributes(ctx)
+	if t.Authority != "" && !authorityMatches(t.Authority, attributes.authority) {
+		return false
+	}
+	if t.ContentType != "" && !strings.EqualFold(t.ContentType, attributes.contentType) {
+		return false
+	}
+	if t.Compression != "" && !strings.EqualFold(t.Compression, attributes.compression) {
+		return false
+	}
+	return true
+}
+
+func authorityMatches(expected, authority string) bool {
+	if strings.EqualFold(expected, authority) {
+		return true
+	}
+	host, port := splitAuthority(authority)
+	expectedHost, expectedPort := splitAuthority(expected)
+	if expectedPort != "" && expectedPort != port {
+		return false
+	}
+	if strings.HasPrefix(expectedHost, "*.") {
+		// The subdomains only, e.g. *.orders.internal matches eu.orders.internal but not orders.internal
+		return strings.HasSuffix(strings.ToLower(host), strings.ToLower(expectedHost[1:]))
+	}
+	return strings.EqualFold(expectedHost, host)
+}
+
+// splitAuthority returns the host and the port, if any, of the authority
+func splitAuthority(authority string) (host, port string) {
+	host, port, err := net.SplitHostPort(authority)
+	if err != nil {
+		return authority, ""
+	}
+	return host, port
+}
+
+type transportAttributes struct {
+	authority   string
+	contentType string
+	compression string
+}
+
+// getTransportAttributes reads the attributes of the request of the call. The compression is only known on the server
+// side of the calls. The authority is the one of AuthorityOverrideHeader, when the call has it.
+func getTransportAttributes(ctx context.Context) transportAttributes {
+	md, _ := metadata.FromIncomingContext(ctx)
+	attributes := transportAttributes{
+		authority:   strings.Join(md.Get(":authority"), ","),
+		contentType: strings.Join(md.Get("content-type"), ","),
+		compression: identityCompression,
+	}
+	if override := md.Get(AuthorityOverrideHeader); len(override) > 0 {
+		attributes.authority = override[0]
+	}
+	// The grpc-encoding header is not in the metadata, but the transport streams of the server have it
+	if stream, ok := grpc.ServerTransportStreamFromContext(ctx).(interface{ RecvCompress() string }); ok && stream.RecvCompress() != "" {
+		attributes.compression = stream.RecvCompress()
+	}
+	return attributes
+}
+
+// toEnv returns the attributes for the transport variable of the matching expressions
+func (a transportAttributes) toEnv() map[string]string {
+	return map[string]string{
+		"authority":   a.authority,
+		"contentType": a.contentType,
+		"compression": a.compression,
+	}
+}
@@ -0,0 +1,127 @@
+package stub
+
+import (
+	"context"
+	"fmt"
+	"github.com/carvalhorr/protoc-gen-mock/util"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TrashedStub is a stub deleted from the StubsStore that can still be restored
+type TrashedStub struct {
+	Stub      *Stub     `json:"stub"`
+	DeletedBy string    `json:"deletedBy,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// Trash keeps the stubs deleted from the StubsStore for a retention period, so that they can be restored
+type Trash interface {
+	// Put adds a copy of the stubs deleted by the actor
+	Put(actor string, stubs []*Stub)
+	// Get returns the trashed stub with the ID of the stub deleted
+	Get(id string) *TrashedStub
+	// GetAll returns the trashed stubs, the ones deleted last first
+	GetAll() []*TrashedStub
+	Remove(id string) error
+	Empty()
+}
+
+// NewInMemoryTrash creates a trash that keeps the stubs deleted for the retention period, forever when it is 0
+func NewInMemoryTrash(retention time.Duration) Trash {
+	return &inMemoryTrash{
+		retention: retention,
+		stubs:     make(map[string]*TrashedStub),
+	}
+}
+
+type inMemoryTrash struct {
+	retention time.Duration
+	stubs     map[string]*TrashedStub
+	mutex     sync.Mutex
+}
+
+func (t *inMemoryTrash) Put(actor string, stubs []*Stub) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for _, s := range stubs {
+		t.stubs[s.ID] = &TrashedStub{Stub: s.Clone(), DeletedBy: actor, DeletedAt: now}
+	}
+	t.purge(now)
+}
+
+func (t *inMemoryTrash) Get(id string) *TrashedStub {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.purge(time.Now())
+	return t.stubs[id]
+}
+
+func (t *inMemoryTrash) GetAll() []*TrashedStub {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.purge(time.Now())
+	all := make([]*TrashedStub, 0, len(t.stubs))
+	for _, trashed := range t.stubs {
+		all = append(all, trashed)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].DeletedAt.Equal(all[j].DeletedAt) {
+			return all[i].DeletedAt.After(all[j].DeletedAt)
+		}
+		return all[i].Stub.ID < all[j].Stub.ID
+	})
+	return all
+}
+
+func (t *inMemoryTrash) Remove(id string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, found := t.stubs[id]; !found {
+		return fmt.Errorf("%w: stub %s is not in the trash", ErrNotFound, id)
+	}
+	delete(t.stubs, id)
+	return nil
+}
+
+func (t *inMemoryTrash) Empty() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.stubs = make(map[string]*TrashedStub)
+}
+
+// purge removes the stubs deleted before the retention period. It must be called holding t.mutex.
+func (t *inMemoryTrash) purge(now time.Time) {
+	if t.retention == 0 {
+		return
+	}
+	for id, trashed := range t.stubs {
+		if now.Sub(trashed.DeletedAt) > t.retention {
+			delete(t.stubs, id)
+		}
+	}
+}
+
+// Restore adds the trashed stub back to the store with its ID, unless there is another stub for the same request
+func (t *TrashedStub) Restore(ctx context.Context, store StubsStore) (*Stub, error) {
+	restored := t.Stub.Clone()
+	err := store.Transaction(ctx, func(current []*Stub) ([]*Stub, error) {
+		for _, e := range current {
+			if e.FullMethod == restored.FullMethod && e.key() == restored.key() {
+				return nil, fmt.Errorf("%w: %s -> %s", ErrConflict, restored.FullMethod, util.LoggablePayload(restored.Request.String()))
+			}
+		}
+		return append(current, restored), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
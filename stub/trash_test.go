@@ -0,0 +1,43 @@
+package stub
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTrash_Restore(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryStubsStore()
+	store.Add(ctx, newTestStub("method1", "{\"name\":\"John\"}"))
+	deleted := allStubs(t, store)
+	store.DeleteAll(ctx)
+	trash := NewInMemoryTrash(time.Hour)
+	trash.Put("tester", deleted)
+
+	trashed := trash.GetAll()
+	assert.Equal(t, 1, len(trashed))
+	assert.Equal(t, "tester", trashed[0].DeletedBy)
+	restored, err := trash.Get(deleted[0].ID).Restore(ctx, store)
+	assert.NoError(t, err)
+	assert.Equal(t, deleted[0].ID, restored.ID)
+	assert.Equal(t, deleted[0].ID, allStubs(t, store)[0].ID)
+
+	_, err = trashed[0].Restore(ctx, store)
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.NoError(t, trash.Remove(deleted[0].ID))
+	assert.True(t, errors.Is(trash.Remove(deleted[0].ID), ErrNotFound))
+}
+
+func TestTrash_Retention(t *testing.T) {
+	trash := NewInMemoryTrash(time.Hour).(*inMemoryTrash)
+	s := newTestStub("method1", "{\"name\":\"John\"}")
+	s.ID = "1"
+	trash.Put("tester", []*Stub{s})
+	trash.stubs["1"].DeletedAt = time.Now().Add(-2 * time.Hour)
+
+	assert.Nil(t, trash.Get("1"))
+	assert.Empty(t, trash.GetAll())
+}
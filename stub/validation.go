@@ -36,12 +36,27 @@ func IsStubValid(stub *Stub, request, response reflect.Type) (isValid bool, erro
 	if !valid {
 		return valid, errorMessages
 	}
-	reqValid, reqErrorMessages := stub.Request.Content.isJsonValid(request, "request.content")
+	reqValid, reqErrorMessages := true, []string(nil)
+	if stub.Request.Content != "" {
+		reqValid, reqErrorMessages = stub.Request.Content.isJsonValid(request, "request.content")
+	}
 	respValid := true
 	respErrorMessages := make([]string, 0)
-	if stub.Response.Type == "success" {
+	hasContent := stub.Response.Content != "" ||
+		(len(stub.Response.Stream) == 0 && stub.Response.Pages == nil && stub.Response.Operation == nil)
+	if stub.Response.Type == "success" && hasContent {
 		respValid, respErrorMessages = stub.Response.Content.isJsonValid(response, "response.content")
 	}
+	for i, message := range stub.Response.Stream {
+		messageValid, messageErrorMessages := message.isJsonValid(response, fmt.Sprintf("response.stream[%d]", i))
+		respValid = respValid && messageValid
+		respErrorMessages = append(respErrorMessages, messageErrorMessages...)
+	}
+	for i, test := range stub.Tests {
+		testValid, testErrorMessages := test.Request.isJsonValid(request, fmt.Sprintf("tests[%d].request", i))
+		reqValid = reqValid && testValid
+		reqErrorMessages = append(reqErrorMessages, testErrorMessages...)
+	}
 	errorMessages = append(errorMessages, reqErrorMessages...)
 	errorMessages = append(errorMessages, respErrorMessages...)
 	return reqValid && respValid, errorMessages
@@ -74,23 +89,24 @@ func isJsonValid(t reflect.Type, json map[string]interface{}, baseName string) (
 			errorMessages = append(errorMessages, fmt.Sprintf("Field '%s.%s' does not exist", baseName, jsonName))
 			continue
 		}
-		if fieldValue == nil {
+		if fieldValue == nil || fieldValue == UnsetMarker {
 			continue
 		}
+		fieldType := scalarType(field.Type)
 		switch {
-		case field.Type.Kind() == reflect.String:
+		case fieldType.Kind() == reflect.String:
 			switch fieldValue.(type) {
 			case string:
 			default:
 				errorMessages = append(errorMessages, fmt.Sprintf("Field '%s.%s' is expected to be a string.", baseName, jsonName))
 			}
-		case field.Type.Kind() == reflect.Ptr:
+		case fieldType.Kind() == reflect.Ptr:
 			{
-				_, subTypeErrorMessages := isJsonValid(field.Type.Elem(), fieldValue.(map[string]interface{}), baseName+"."+jsonName)
+				_, subTypeErrorMessages := isJsonValid(fieldType.Elem(), fieldValue.(map[string]interface{}), baseName+"."+jsonName)
 				errorMessages = append(errorMessages, subTypeErrorMessages...)
 			}
-		case isEnum(field.Type):
-			enum := reflect.New(field.Type).Interface()
+		case isEnum(fieldType):
+			enum := reflect.New(fieldType).Interface()
 			values := getEnumValues(enum.(EnumType))
 			found := false
 			for _, value := range values {
@@ -106,33 +122,116 @@ func isJsonValid(t reflect.Type, json map[string]interface{}, baseName string) (
 	return len(errorMessages) == 0, errorMessages
 }
 
+// scalarType returns the type of the value of the proto3 optional scalar fields, which are pointers, and the type
+// given otherwise
+func scalarType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Struct {
+		return t.Elem()
+	}
+	return t
+}
+
 func (stub *Stub) IsValid() (isValid bool, errMsgs []string) {
 	if stub.FullMethod == "" {
 		errMsgs = append(errMsgs, "Method can't be empty.")
 	}
+	if stub.ContentFormat != "" && stub.ContentFormat != ContentFormatJSON && stub.ContentFormat != ContentFormatText {
+		errMsgs = append(errMsgs, "Content format can only be either 'json' or 'prototext'.")
+	}
 	// Validate request
 	if stub.Request == nil {
 		errMsgs = append(errMsgs, "Request can't be empty.")
 	}
-	if stub.Request.Content == "" {
+	matchedByExpr := stub.Request.MatchExpr != "" && stub.Request.Match == ""
+	if stub.Request.Content == "" && !matchedByExpr {
 		errMsgs = append(errMsgs, "Request content can't be empty.")
 	}
-	if stub.Request.Match != "exact" && stub.Request.Match != "partial" {
+	if stub.Request.Match != "exact" && stub.Request.Match != "partial" && !matchedByExpr {
 		errMsgs = append(errMsgs, "Request matching type can only be either 'exact' or 'partial'.")
 	}
+	if stub.Request.MatchExpr != "" {
+		if _, err := compileMatchExpr(stub.Request.MatchExpr, stub.FullMethod); err != nil {
+			errMsgs = append(errMsgs, fmt.Sprintf("Request matching expression is not valid: %s", err.Error()))
+		}
+	}
+	errMsgs = append(errMsgs, stub.Request.Capture.validate()...)
 	// Validate response
 	if stub.Response == nil {
 		errMsgs = append(errMsgs, "Response can't be empty.")
 	}
-	if stub.Response.Type != "error" && stub.Response.Type != "success" {
-		errMsgs = append(errMsgs, "Response type can only be either 'error' or 'success'.")
+	if stub.Response.Type != "error" && stub.Response.Type != "success" && stub.Response.Type != ResponseTypeScript {
+		errMsgs = append(errMsgs, "Response type can only be either 'error', 'success' or 'script'.")
+	}
+	if stub.Response.Type == ResponseTypeScript {
+		errMsgs = append(errMsgs, validateScript(stub.Response.Script)...)
 	}
-	if stub.Response.Type == "success" && stub.Response.Content == "" {
+	if stub.Response.Type == "success" && stub.Response.Content == "" && len(stub.Response.Stream) == 0 &&
+		stub.Response.Pages == nil && stub.Response.Operation == nil {
 		errMsgs = append(errMsgs, "Response content is mandatory when the response type is 'success'.")
 	}
 	if stub.Response.Type == "error" && stub.Response.Error == nil {
 		errMsgs = append(errMsgs, "Response error is mandatory when the response type ir 'error'.")
 	}
+	if stub.Response.TrailersOnly && stub.Response.Type != "error" && stub.Response.Type != ResponseTypeScript {
+		errMsgs = append(errMsgs, "Only error responses can be trailers-only.")
+	}
+	if stub.Response.TrailersOnly && len(stub.Response.Stream) > 0 {
+		errMsgs = append(errMsgs, "Trailers-only responses can't have stream messages.")
+	}
+	if stub.Response.Error != nil && !stub.Response.Error.Code.isKnown() {
+		errMsgs = append(errMsgs, fmt.Sprintf("Response error code %s is not a gRPC status code.", stub.Response.Error.Code))
+	}
+	if stub.Response.Error != nil && stub.Response.Error.RetryDelay != "" && !isValidRetryDelay(stub.Response.Error.RetryDelay) {
+		errMsgs = append(errMsgs, fmt.Sprintf("Response error retryDelay '%s' is not a valid duration.", stub.Response.Error.RetryDelay))
+	}
+	if stub.Request.Peer != nil {
+		errMsgs = append(errMsgs, stub.Request.Peer.validate()...)
+	}
+	if stub.Response.Pages != nil {
+		errMsgs = append(errMsgs, stub.Response.Pages.validate()...)
+	}
+	if stub.Response.Operation != nil {
+		errMsgs = append(errMsgs, stub.Response.Operation.validate()...)
+	}
+	if stub.Response.FailThenSucceed != nil {
+		errMsgs = append(errMsgs, stub.Response.FailThenSucceed.validate()...)
+	}
+	if stub.Response.Pacing != nil {
+		errMsgs = append(errMsgs, stub.Response.Pacing.validate(stub.Response.Type)...)
+	}
+	if stub.Response.StreamFaults != nil {
+		errMsgs = append(errMsgs, stub.Response.StreamFaults.validate(streamLength(stub.Response))...)
+	}
+	errMsgs = append(errMsgs, validateResponseMetadata("header", stub.Response.Headers)...)
+	errMsgs = append(errMsgs, validateResponseMetadata("trailer", stub.Response.Trailers)...)
+	if stub.Response.FrameFault != nil {
+		errMsgs = append(errMsgs, stub.Response.FrameFault.validate(stub.Response.Type)...)
+	}
+	if stub.Scenario != nil && stub.Scenario.Name == "" {
+		errMsgs = append(errMsgs, "Scenario name can't be empty.")
+	}
+	if expected := stub.ExpectedCalls; expected != nil {
+		if expected.Min < 0 {
+			errMsgs = append(errMsgs, "Minimum expected calls can't be negative.")
+		}
+		if expected.Max != nil && *expected.Max < expected.Min {
+			errMsgs = append(errMsgs, "Maximum expected calls can't be less than the minimum.")
+		}
+	}
+	if len(errMsgs) == 0 {
+		errMsgs = stub.runTests()
+	}
 
 	return len(errMsgs) == 0, errMsgs
 }
+
+// streamLength is the number of messages streamed by the response, -1 when they are produced by a script
+func streamLength(response *StubResponse) int {
+	switch {
+	case response.Type == ResponseTypeScript:
+		return -1
+	case len(response.Stream) == 0 && response.Type != "error":
+		return 1
+	}
+	return len(response.Stream)
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real time clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// MockClock is a clock that can be set, frozen and advanced. It follows the real time until it is changed.
+type MockClock struct {
+	mutex sync.RWMutex
+	// Difference to the real time while running
+	offset time.Duration
+	// Time at which the clock is stopped while frozen
+	frozenAt *time.Time
+}
+
+func NewMockClock() *MockClock {
+	return new(MockClock)
+}
+
+func (c *MockClock) Now() time.Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.now()
+}
+
+func (c *MockClock) now() time.Time {
+	if c.frozenAt != nil {
+		return *c.frozenAt
+	}
+	return time.Now().Add(c.offset)
+}
+
+// IsFrozen checks if the clock is stopped
+func (c *MockClock) IsFrozen() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.frozenAt != nil
+}
+
+// Set changes the current time. The clock keeps running from it unless frozen.
+func (c *MockClock) Set(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.frozenAt != nil {
+		c.frozenAt = &t
+		return
+	}
+	c.offset = time.Until(t)
+}
+
+// Freeze stops the clock at the current time
+func (c *MockClock) Freeze() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	c.frozenAt = &now
+}
+
+// Unfreeze makes the clock run again from the time it was stopped
+func (c *MockClock) Unfreeze() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.frozenAt == nil {
+		return
+	}
+	c.offset = time.Until(*c.frozenAt)
+	c.frozenAt = nil
+}
+
+// Advance moves the clock forward (or backwards when d is negative)
+func (c *MockClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.frozenAt != nil {
+		advanced := c.frozenAt.Add(d)
+		c.frozenAt = &advanced
+		return
+	}
+	c.offset += d
+}
+
+// Reset makes the clock follow the real time again
+func (c *MockClock) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.offset = 0
+	c.frozenAt = nil
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMockClock_Freeze(t *testing.T) {
+	clock := NewMockClock()
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.Freeze()
+	clock.Set(at)
+	assert.True(t, clock.IsFrozen())
+	assert.Equal(t, at, clock.Now())
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, at.Add(time.Hour), clock.Now())
+
+	clock.Unfreeze()
+	assert.False(t, clock.IsFrozen())
+	assert.WithinDuration(t, at.Add(time.Hour), clock.Now(), time.Second)
+}
+
+func TestMockClock_Advance(t *testing.T) {
+	clock := NewMockClock()
+	clock.Advance(24 * time.Hour)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), clock.Now(), time.Second)
+
+	clock.Reset()
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+}
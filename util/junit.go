@@ -0,0 +1,55 @@
+package util
+
+import (
+	"encoding/xml"
+)
+
+// JUnitTestSuite is a test suite in the JUnit XML format understood by the CI servers
+type JUnitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase is a test case of a JUnitTestSuite, failed when Failure is set and skipped when Skipped is set
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+}
+
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// NewJUnitTestSuite creates the suite with the test cases, counting the tests, failures and skipped tests
+func NewJUnitTestSuite(name string, testCases []JUnitTestCase) *JUnitTestSuite {
+	suite := &JUnitTestSuite{Name: name, Tests: len(testCases), TestCases: testCases}
+	for _, testCase := range testCases {
+		if testCase.Failure != nil {
+			suite.Failures++
+		}
+		if testCase.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+// Marshal encodes the suite in XML, with the XML header
+func (s *JUnitTestSuite) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,298 @@
+package util
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotJWT              = errors.New("the token is not a JWT")
+	ErrJWTKeyNotFound      = errors.New("no key found to verify the JWT")
+	ErrJWTInvalidSignature = errors.New("invalid JWT signature")
+)
+
+// JWT is a decoded JSON Web Token
+type JWT struct {
+	Header map[string]interface{}
+	Claims map[string]interface{}
+
+	signingInput string
+	signature    []byte
+}
+
+// ParseJWT decodes the token without verifying it
+func ParseJWT(token string) (*JWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrNotJWT
+	}
+	jwt := &JWT{signingInput: parts[0] + "." + parts[1]}
+	if err := decodeJWTPart(parts[0], &jwt.Header); err != nil {
+		return nil, ErrNotJWT
+	}
+	if err := decodeJWTPart(parts[1], &jwt.Claims); err != nil {
+		return nil, ErrNotJWT
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrNotJWT
+	}
+	jwt.signature = signature
+	return jwt, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func (t *JWT) headerString(name string) string {
+	value, _ := t.Header[name].(string)
+	return value
+}
+
+// Verify checks the signature of the token with the key of the set with its key ID (kid) and algorithm.
+// The algorithms supported are HS256/384/512, RS256/384/512 and ES256/384/512.
+func (t *JWT) Verify(keys *JWKS) error {
+	alg := t.headerString("alg")
+	key := keys.find(t.headerString("kid"), alg)
+	if key == nil {
+		return ErrJWTKeyNotFound
+	}
+	return t.verifyWithKey(alg, key)
+}
+
+// ValidateTime checks the expiration (exp) and not before (nbf) claims, when present, at the time given
+func (t *JWT) ValidateTime(now time.Time) error {
+	if exp, ok := t.numericClaim("exp"); ok && !now.Before(time.Unix(exp, 0)) {
+		return errors.New("the JWT has expired")
+	}
+	if nbf, ok := t.numericClaim("nbf"); ok && now.Before(time.Unix(nbf, 0)) {
+		return errors.New("the JWT is not valid yet")
+	}
+	return nil
+}
+
+func (t *JWT) numericClaim(name string) (int64, bool) {
+	number, ok := t.Claims[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Float64()
+	return int64(value), err == nil
+}
+
+func (t *JWT) verifyWithKey(alg string, key interface{}) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported JWT algorithm: %s", alg)
+	}
+	var hashFunc crypto.Hash
+	var newHash func() hash.Hash
+	switch alg[2:] {
+	case "256":
+		hashFunc, newHash = crypto.SHA256, sha256.New
+	case "384":
+		hashFunc, newHash = crypto.SHA384, sha512.New384
+	case "512":
+		hashFunc, newHash = crypto.SHA512, sha512.New
+	default:
+		return fmt.Errorf("unsupported JWT algorithm: %s", alg)
+	}
+	digest := newHash()
+	digest.Write([]byte(t.signingInput))
+	switch k := key.(type) {
+	case []byte:
+		if alg[:2] != "HS" {
+			break
+		}
+		mac := hmac.New(newHash, k)
+		mac.Write([]byte(t.signingInput))
+		if !hmac.Equal(mac.Sum(nil), t.signature) {
+			return ErrJWTInvalidSignature
+		}
+		return nil
+	case *rsa.PublicKey:
+		if alg[:2] != "RS" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(k, hashFunc, digest.Sum(nil), t.signature) != nil {
+			return ErrJWTInvalidSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" || len(t.signature)%2 != 0 {
+			break
+		}
+		half := len(t.signature) / 2
+		r := new(big.Int).SetBytes(t.signature[:half])
+		s := new(big.Int).SetBytes(t.signature[half:])
+		if !ecdsa.Verify(k, digest.Sum(nil), r, s) {
+			return ErrJWTInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("the key can't verify JWTs signed with %s", alg)
+}
+
+// JWKS is a set of JSON Web Keys used to verify JWTs
+type JWKS struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key interface{}
+}
+
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric
+	K string `json:"k"`
+}
+
+// ParseJWKS reads a JSON Web Key Set ({"keys": [...]}) with RSA, EC and symmetric keys
+func ParseJWKS(data []byte) (*JWKS, error) {
+	set := struct {
+		Keys []jwkJSON `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	jwks := new(JWKS)
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s in JWKS: %w", k.Kid, err)
+		}
+		jwks.keys = append(jwks.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return jwks, nil
+}
+
+// NewSecretJWKS returns a set with the secret as the only key, to verify JWTs signed with the HS algorithms
+func NewSecretJWKS(secret []byte) *JWKS {
+	return &JWKS{keys: []jwk{{key: secret}}}
+}
+
+// ParsePublicKeyPEM returns a set with the RSA or EC public key, or the key of the certificate, in PEM format
+func ParsePublicKeyPEM(data []byte) (*JWKS, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return &JWKS{keys: []jwk{{key: key}}}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type: %T", key)
+}
+
+func (k jwkJSON) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, nErr := decodeBigInt(k.N)
+		e, eErr := decodeBigInt(k.E)
+		if nErr != nil || eErr != nil {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, xErr := decodeBigInt(k.X)
+		y, yErr := decodeBigInt(k.Y)
+		if xErr != nil || yErr != nil {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// find returns the key with the key ID given or, when the token has no key ID, the first key for the algorithm
+func (j *JWKS) find(kid, alg string) interface{} {
+	if j == nil {
+		return nil
+	}
+	for _, k := range j.keys {
+		if kid != "" && k.kid != kid {
+			continue
+		}
+		if alg != "" && k.alg != "" && k.alg != alg {
+			continue
+		}
+		return k.key
+	}
+	return nil
+}
+
+// HasKey checks if the set has the key with the ID given
+func (j *JWKS) HasKey(kid string) bool {
+	return j.find(kid, "") != nil
+}
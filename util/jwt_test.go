@@ -0,0 +1,111 @@
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func newTestJWT(t *testing.T, header, claims map[string]interface{}, sign func(signingInput string) []byte) string {
+	headerJson, _ := json.Marshal(header)
+	claimsJson, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJson) + "." + base64.RawURLEncoding.EncodeToString(claimsJson)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(signingInput))
+}
+
+func TestJWT_Verify_HS256(t *testing.T) {
+	secret := []byte("secret")
+	token := newTestJWT(t, map[string]interface{}{"alg": "HS256", "kid": "k1"}, map[string]interface{}{"sub": "user-1"}, func(signingInput string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil)
+	})
+	keys, err := ParseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"k1","k":"` + base64.RawURLEncoding.EncodeToString(secret) + `"}]}`))
+	assert.NoError(t, err)
+	assert.True(t, keys.HasKey("k1"))
+	assert.False(t, keys.HasKey("k2"))
+
+	jwt, err := ParseJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", jwt.Claims["sub"])
+	assert.NoError(t, jwt.Verify(keys))
+
+	other, _ := ParseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"k1","k":"b3RoZXI"}]}`))
+	assert.Equal(t, ErrJWTInvalidSignature, jwt.Verify(other))
+	other, _ = ParseJWKS([]byte(`{"keys":[{"kty":"oct","kid":"k2","k":"b3RoZXI"}]}`))
+	assert.Equal(t, ErrJWTKeyNotFound, jwt.Verify(other))
+}
+
+func TestJWT_Verify_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	token := newTestJWT(t, map[string]interface{}{"alg": "RS256"}, map[string]interface{}{"sub": "user-1"}, func(signingInput string) []byte {
+		digest := sha256.Sum256([]byte(signingInput))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		return signature
+	})
+	keys, err := ParseJWKS([]byte(fmt.Sprintf(`{"keys":[{"kty":"RSA","alg":"RS256","n":"%s","e":"AQAB"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()))))
+	assert.NoError(t, err)
+
+	jwt, err := ParseJWT(token)
+	assert.NoError(t, err)
+	assert.NoError(t, jwt.Verify(keys))
+
+	jwt.Header["alg"] = "HS256"
+	assert.Equal(t, ErrJWTKeyNotFound, jwt.Verify(keys))
+}
+
+func TestParsePublicKeyPEM(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	keys, err := ParsePublicKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	assert.NoError(t, err)
+
+	token := newTestJWT(t, map[string]interface{}{"alg": "ES256"}, map[string]interface{}{"sub": "user-1"}, func(signingInput string) []byte {
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		signature := make([]byte, 64)
+		copy(signature[32-len(r.Bytes()):32], r.Bytes())
+		copy(signature[64-len(s.Bytes()):], s.Bytes())
+		return signature
+	})
+	jwt, err := ParseJWT(token)
+	assert.NoError(t, err)
+	assert.NoError(t, jwt.Verify(keys))
+
+	_, err = ParsePublicKeyPEM([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestParseJWT_NotJWT(t *testing.T) {
+	_, err := ParseJWT("opaque-token")
+	assert.Equal(t, ErrNotJWT, err)
+	_, err = ParseJWT("a.b.c")
+	assert.Equal(t, ErrNotJWT, err)
+}
+
+func TestJWT_ValidateTime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	token := newTestJWT(t, map[string]interface{}{"alg": "none"}, map[string]interface{}{"nbf": 1599999000, "exp": 1600001000}, func(string) []byte {
+		return nil
+	})
+	jwt, err := ParseJWT(token)
+	assert.NoError(t, err)
+	assert.NoError(t, jwt.ValidateTime(now))
+	assert.Error(t, jwt.ValidateTime(now.Add(time.Hour)))
+	assert.Error(t, jwt.ValidateTime(now.Add(-time.Hour)))
+}
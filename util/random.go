@@ -0,0 +1,119 @@
+package util
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Random generates the random values of the responses and faults
+type Random interface {
+	// Intn returns a number in [0, n)
+	Intn(n int) int
+	// Float64 returns a number in [0.0, 1.0)
+	Float64() float64
+}
+
+// SeededRandom generates reproducible random values: the same seed produces the same sequence. Besides the global
+// sequence, there is a sequence per key with its own seed (e.g. per stub), independent of the other calls.
+type SeededRandom struct {
+	mutex  sync.Mutex
+	seed   int64
+	global *rand.Rand
+	keyed  map[string]*keyedRandom
+}
+
+type keyedRandom struct {
+	seed int64
+	rand *rand.Rand
+}
+
+// NewSeededRandom creates a generator with the seed given or, when it is 0, with a seed based on the current time
+func NewSeededRandom(seed int64) *SeededRandom {
+	r := new(SeededRandom)
+	r.SetSeed(seed)
+	return r
+}
+
+// Seed returns the seed of the global sequence, so that a run can be reproduced
+func (r *SeededRandom) Seed() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.seed
+}
+
+// SetSeed changes the seed of the global sequence (a seed based on the current time when it is 0) and restarts all
+// the sequences
+func (r *SeededRandom) SetSeed(seed int64) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.seed = seed
+	r.reset()
+}
+
+// Reset restarts all the sequences from their seeds
+func (r *SeededRandom) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.reset()
+}
+
+func (r *SeededRandom) reset() {
+	r.global = rand.New(rand.NewSource(r.seed))
+	r.keyed = make(map[string]*keyedRandom, 0)
+}
+
+func (r *SeededRandom) Intn(n int) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.global.Intn(n)
+}
+
+func (r *SeededRandom) Float64() float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.global.Float64()
+}
+
+// Keyed returns the sequence of the key with the seed given. The sequence continues across calls until it is reset or
+// the seed changes.
+func (r *SeededRandom) Keyed(key string, seed int64) Random {
+	return keyedSequence{parent: r, key: key, seed: seed}
+}
+
+func (r *SeededRandom) keyedRand(key string, seed int64) *rand.Rand {
+	k, found := r.keyed[key]
+	if !found || k.seed != seed {
+		k = &keyedRandom{seed: seed, rand: rand.New(rand.NewSource(seed))}
+		r.keyed[key] = k
+	}
+	return k.rand
+}
+
+type keyedSequence struct {
+	parent *SeededRandom
+	key    string
+	seed   int64
+}
+
+func (s keyedSequence) Intn(n int) int {
+	s.parent.mutex.Lock()
+	defer s.parent.mutex.Unlock()
+
+	return s.parent.keyedRand(s.key, s.seed).Intn(n)
+}
+
+func (s keyedSequence) Float64() float64 {
+	s.parent.mutex.Lock()
+	defer s.parent.mutex.Unlock()
+
+	return s.parent.keyedRand(s.key, s.seed).Float64()
+}
@@ -0,0 +1,41 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func sequence(r Random) []int {
+	values := make([]int, 0, 5)
+	for i := 0; i < 5; i++ {
+		values = append(values, r.Intn(1000))
+	}
+	return values
+}
+
+func TestSeededRandom(t *testing.T) {
+	r := NewSeededRandom(42)
+	first := sequence(r)
+	assert.Equal(t, int64(42), r.Seed())
+	assert.Equal(t, first, sequence(NewSeededRandom(42)))
+	assert.NotEqual(t, first, sequence(r))
+
+	r.Reset()
+	assert.Equal(t, first, sequence(r))
+	assert.NotZero(t, NewSeededRandom(0).Seed())
+}
+
+func TestSeededRandom_Keyed(t *testing.T) {
+	r := NewSeededRandom(42)
+	keyed := sequence(r.Keyed("stub-1", 7))
+	// The keyed sequences don't depend on the global one or on other keys
+	r = NewSeededRandom(1)
+	sequence(r)
+	sequence(r.Keyed("stub-2", 7))
+	assert.Equal(t, keyed, sequence(r.Keyed("stub-1", 7)))
+	assert.NotEqual(t, keyed, sequence(r.Keyed("stub-1", 7)))
+
+	r.Reset()
+	assert.Equal(t, keyed, sequence(r.Keyed("stub-1", 7)))
+	assert.NotEqual(t, keyed, sequence(r.Keyed("stub-1", 8)))
+}
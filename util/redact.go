@@ -0,0 +1,159 @@
+package util
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+)
+
+// RedactedValue replaces the values of the redacted fields
+const RedactedValue = "[REDACTED]"
+
+// omittedPayload replaces the payloads in the logs when payload logging is disabled
+const omittedPayload = "<payload omitted>"
+
+// Redactor replaces the values of sensitive fields in JSON payloads.
+// A field path without dots (e.g. password) matches the field at any depth. A dotted path (e.g. customer.ssn) matches
+// from the root of the payload and * matches any field name. Arrays are traversed transparently. Field names are
+// compared ignoring case and underscores so that both the proto (ssn_number) and JSON (ssnNumber) names match.
+type Redactor struct {
+	anywhere map[string]bool
+	paths    [][]string
+}
+
+func NewRedactor(fields []string) *Redactor {
+	r := &Redactor{anywhere: make(map[string]bool, 0)}
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		segments := strings.Split(field, ".")
+		if len(segments) == 1 {
+			r.anywhere[normalizeFieldName(field)] = true
+			continue
+		}
+		for i := range segments {
+			segments[i] = normalizeFieldName(segments[i])
+		}
+		r.paths = append(r.paths, segments)
+	}
+	return r
+}
+
+// IsEmpty checks if there is no field to be redacted
+func (r *Redactor) IsEmpty() bool {
+	return len(r.anywhere) == 0 && len(r.paths) == 0
+}
+
+// RedactJSON returns the JSON payload with the values of the redacted fields replaced. Payloads that are not valid
+// JSON are returned unchanged.
+func (r *Redactor) RedactJSON(data string) string {
+	if r.IsEmpty() {
+		return data
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return data
+	}
+	redacted, _ := json.Marshal(r.Redact(value))
+	return string(redacted)
+}
+
+// Redact replaces in place the values of the redacted fields in a payload decoded from JSON and returns it
+func (r *Redactor) Redact(value interface{}) interface{} {
+	if r.IsEmpty() {
+		return value
+	}
+	r.redact(value, r.paths)
+	return value
+}
+
+// RedactMetadata returns a copy of the metadata (e.g. of a gRPC call) with the values of the redacted keys replaced.
+// The keys are matched as the field paths without dots, e.g. authorization.
+func (r *Redactor) RedactMetadata(md map[string][]string) map[string][]string {
+	redacted := make(map[string][]string, len(md))
+	for key, values := range md {
+		if r.anywhere[normalizeFieldName(key)] {
+			values = []string{RedactedValue}
+		}
+		redacted[key] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+func (r *Redactor) redact(value interface{}, paths [][]string) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, fieldValue := range typedValue {
+			name := normalizeFieldName(key)
+			if r.anywhere[name] {
+				typedValue[key] = RedactedValue
+				continue
+			}
+			remaining := make([][]string, 0)
+			for _, path := range paths {
+				if path[0] != "*" && path[0] != name {
+					continue
+				}
+				if len(path) == 1 {
+					typedValue[key] = RedactedValue
+					remaining = nil
+					break
+				}
+				remaining = append(remaining, path[1:])
+			}
+			if remaining == nil {
+				continue
+			}
+			r.redact(fieldValue, remaining)
+		}
+	case []interface{}:
+		for _, item := range typedValue {
+			r.redact(item, paths)
+		}
+	}
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+type payloadLogging struct {
+	disabled bool
+	redactor *Redactor
+}
+
+var payloadLoggingConfig atomic.Value
+
+func init() {
+	payloadLoggingConfig.Store(payloadLogging{redactor: NewRedactor(nil)})
+}
+
+// ConfigurePayloadLogging sets whether payloads (requests, responses and stubs) are written to the logs and which
+// fields are redacted from them.
+func ConfigurePayloadLogging(enabled bool, redactedFields []string) {
+	payloadLoggingConfig.Store(payloadLogging{
+		disabled: !enabled,
+		redactor: NewRedactor(redactedFields),
+	})
+}
+
+// PayloadRedactor returns the redactor configured for the payloads kept by the server
+func PayloadRedactor() *Redactor {
+	return payloadLoggingConfig.Load().(payloadLogging).redactor
+}
+
+// IsPayloadLoggingEnabled checks if payloads can be written to the logs
+func IsPayloadLoggingEnabled() bool {
+	return !payloadLoggingConfig.Load().(payloadLogging).disabled
+}
+
+// LoggablePayload returns the JSON payload as it must be written to the logs
+func LoggablePayload(data string) string {
+	config := payloadLoggingConfig.Load().(payloadLogging)
+	if config.disabled {
+		return omittedPayload
+	}
+	return config.redactor.RedactJSON(data)
+}
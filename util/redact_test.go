@@ -0,0 +1,42 @@
+package util
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedactor_RedactJSON(t *testing.T) {
+	redactor := NewRedactor([]string{"password", "customer.ssn_number"})
+	redacted := redactor.RedactJSON(`{"password":"secret","customer":{"ssnNumber":"123","name":"John","password":"x"},"ssnNumber":"456"}`)
+	assert.Equal(t, `{"customer":{"name":"John","password":"[REDACTED]","ssnNumber":"[REDACTED]"},"password":"[REDACTED]","ssnNumber":"456"}`, redacted)
+}
+
+func TestRedactor_RedactJSON_Arrays(t *testing.T) {
+	redactor := NewRedactor([]string{"users.*.token"})
+	redacted := redactor.RedactJSON(`{"users":[{"account":{"token":"a"}},{"account":{"token":"b","id":1}}]}`)
+	assert.Equal(t, `{"users":[{"account":{"token":"[REDACTED]"}},{"account":{"id":1,"token":"[REDACTED]"}}]}`, redacted)
+}
+
+func TestRedactor_RedactJSON_NoFields(t *testing.T) {
+	payload := `{ "password": "secret" }`
+	assert.Equal(t, payload, NewRedactor(nil).RedactJSON(payload))
+	assert.Equal(t, "not json", NewRedactor([]string{"password"}).RedactJSON("not json"))
+}
+
+func TestLoggablePayload(t *testing.T) {
+	defer ConfigurePayloadLogging(true, nil)
+
+	ConfigurePayloadLogging(true, []string{"password"})
+	assert.Equal(t, `{"password":"[REDACTED]"}`, LoggablePayload(`{"password":"secret"}`))
+
+	ConfigurePayloadLogging(false, nil)
+	assert.False(t, IsPayloadLoggingEnabled())
+	assert.Equal(t, omittedPayload, LoggablePayload(`{"password":"secret"}`))
+}
+
+func TestRedactor_RedactMetadata(t *testing.T) {
+	md := map[string][]string{"authorization": {"Bearer secret"}, "x-api-key": {"key"}, "x-tenant": {"acme"}}
+	redacted := NewRedactor([]string{"Authorization", "x-api-key"}).RedactMetadata(md)
+	assert.Equal(t, map[string][]string{"authorization": {RedactedValue}, "x-api-key": {RedactedValue}, "x-tenant": {"acme"}}, redacted)
+	assert.Equal(t, []string{"Bearer secret"}, md["authorization"])
+}